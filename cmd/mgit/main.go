@@ -4,7 +4,7 @@ import (
 	"context"
 	"os"
 
-	"mgit/internal/cli"
+	"github.com/pavelBuzdanov/mgit/internal/cli"
 )
 
 func main() {
@@ -0,0 +1,246 @@
+// Package agentproxy is an ssh-agent that forwards to another agent but
+// lets each connection use only the identities chosen for the host the ssh
+// client is connecting to. It learns the host from the session-bind
+// extension OpenSSH 8.9 and later send before asking for identities.
+package agentproxy
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/pavelBuzdanov/mgit/internal/sshkeys"
+)
+
+// Message numbers from the ssh-agent protocol (draft-miller-ssh-agent).
+const (
+	agentFailure            = 5
+	agentSuccess            = 6
+	agentcRequestIdentities = 11
+	agentIdentitiesAnswer   = 12
+	agentcSignRequest       = 13
+	agentcExtension         = 27
+)
+
+const sessionBind = "session-bind@openssh.com"
+
+// maxMessage is the largest message accepted from either side, as in
+// OpenSSH's agent.
+const maxMessage = 256 << 10
+
+// Selection is what a connection may use.
+type Selection struct {
+	// Destination is the host the connection is bound to.
+	Destination string
+	// Keys are the SHA256 fingerprints of the identities it may use.
+	Keys map[string]bool
+	// Rules name where Keys come from, for the log.
+	Rules []string
+}
+
+// Filter returns the selection for a connection bound to hostKey, or for a
+// connection that sent no session-bind (older ssh, other clients) when
+// hostKey is nil. A nil Selection lets every identity through.
+type Filter func(hostKey []byte) *Selection
+
+// Proxy serves the agent protocol in front of Upstream.
+type Proxy struct {
+	// Upstream is the socket of the agent that holds the keys.
+	Upstream string
+	Filter   Filter
+	// Logf, if set, is told about every decision.
+	Logf func(format string, args ...any)
+}
+
+// Serve accepts connections on ln until ctx is done.
+func (p *Proxy) Serve(ctx context.Context, ln net.Listener) error {
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer conn.Close()
+			if err := p.serveConn(conn); err != nil && !errors.Is(err, io.EOF) {
+				p.logf("connection: %v", err)
+			}
+		}()
+	}
+}
+
+func (p *Proxy) serveConn(client net.Conn) error {
+	upstream, err := net.Dial("unix", p.Upstream)
+	if err != nil {
+		return fmt.Errorf("connect to upstream agent: %w", err)
+	}
+	defer upstream.Close()
+	sel := p.Filter(nil)
+	for {
+		req, err := readMessage(client)
+		if err != nil {
+			return err
+		}
+		var resp []byte
+		switch req[0] {
+		case agentcRequestIdentities:
+			if resp, err = roundTrip(upstream, req); err != nil {
+				return err
+			}
+			if sel != nil && resp[0] == agentIdentitiesAnswer {
+				resp = p.filterIdentities(resp, sel)
+			}
+		case agentcSignRequest:
+			blob, _, _ := readString(req[1:])
+			if sel != nil && !sel.Keys[sshkeys.Fingerprint(blob)] {
+				p.logf("%s: refused to sign with %s, which no rule for the host uses", sel.Destination, sshkeys.Fingerprint(blob))
+				resp = []byte{agentFailure}
+				break
+			}
+			if resp, err = roundTrip(upstream, req); err != nil {
+				return err
+			}
+		case agentcExtension:
+			if resp, err = roundTrip(upstream, req); err != nil {
+				return err
+			}
+			hostKey, forwarding, ok := parseSessionBind(req[1:])
+			// The upstream agent checks the host's signature over the
+			// session; an older one fails the extension, which is trusted
+			// only from a local ssh, not a forwarded agent.
+			if ok && (resp[0] == agentSuccess || !forwarding) {
+				sel = p.Filter(hostKey)
+			}
+		default:
+			if resp, err = roundTrip(upstream, req); err != nil {
+				return err
+			}
+		}
+		if err := writeMessage(client, resp); err != nil {
+			return err
+		}
+	}
+}
+
+// filterIdentities drops the identities sel doesn't allow from an
+// SSH_AGENT_IDENTITIES_ANSWER.
+func (p *Proxy) filterIdentities(resp []byte, sel *Selection) []byte {
+	if len(resp) < 5 {
+		return resp
+	}
+	n := binary.BigEndian.Uint32(resp[1:5])
+	rest := resp[5:]
+	out := []byte{agentIdentitiesAnswer, 0, 0, 0, 0}
+	kept := uint32(0)
+	for i := uint32(0); i < n; i++ {
+		blob, after, ok := readString(rest)
+		if !ok {
+			return resp
+		}
+		comment, after, ok := readString(after)
+		if !ok {
+			return resp
+		}
+		rest = after
+		if sel.Keys[sshkeys.Fingerprint(blob)] {
+			out = appendString(appendString(out, blob), comment)
+			kept++
+		}
+	}
+	binary.BigEndian.PutUint32(out[1:5], kept)
+	if kept == 0 && len(sel.Keys) > 0 {
+		p.logf("%s: none of the keys of %v is in the upstream agent; add them with ssh-add", sel.Destination, sel.Rules)
+	} else {
+		p.logf("%s: offering %d of %d identities (rules %v)", sel.Destination, kept, n, sel.Rules)
+	}
+	return out
+}
+
+func (p *Proxy) logf(format string, args ...any) {
+	if p.Logf != nil {
+		p.Logf(format, args...)
+	}
+}
+
+// parseSessionBind reads the host key and forwarding flag of a
+// session-bind@openssh.com extension request (after the message number).
+func parseSessionBind(body []byte) (hostKey []byte, forwarding, ok bool) {
+	name, rest, ok := readString(body)
+	if !ok || string(name) != sessionBind {
+		return nil, false, false
+	}
+	hostKey, rest, ok = readString(rest)
+	if !ok {
+		return nil, false, false
+	}
+	for range 2 { // session identifier, signature
+		if _, rest, ok = readString(rest); !ok {
+			return nil, false, false
+		}
+	}
+	if len(rest) < 1 {
+		return nil, false, false
+	}
+	return hostKey, rest[0] != 0, true
+}
+
+func roundTrip(upstream net.Conn, req []byte) ([]byte, error) {
+	if err := writeMessage(upstream, req); err != nil {
+		return nil, fmt.Errorf("upstream agent: %w", err)
+	}
+	resp, err := readMessage(upstream)
+	if err != nil {
+		return nil, fmt.Errorf("upstream agent: %w", err)
+	}
+	return resp, nil
+}
+
+func readMessage(r io.Reader) ([]byte, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n == 0 || n > maxMessage {
+		return nil, fmt.Errorf("bad message length %d", n)
+	}
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func writeMessage(w io.Writer, msg []byte) error {
+	_, err := w.Write(appendString(nil, msg))
+	return err
+}
+
+func readString(b []byte) (s, rest []byte, ok bool) {
+	if len(b) < 4 {
+		return nil, nil, false
+	}
+	n := binary.BigEndian.Uint32(b)
+	if uint64(n) > uint64(len(b)-4) {
+		return nil, nil, false
+	}
+	return b[4 : 4+n], b[4+n:], true
+}
+
+func appendString(b, s []byte) []byte {
+	return append(binary.BigEndian.AppendUint32(b, uint32(len(s))), s...)
+}
@@ -0,0 +1,114 @@
+package agentproxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/pavelBuzdanov/mgit/internal/sshkeys"
+)
+
+// fakeAgent answers identity requests with keys, signs anything and fails
+// extensions, like an agent older than session-bind.
+func fakeAgent(t *testing.T, keys ...[]byte) string {
+	path := filepath.Join(t.TempDir(), "up.sock")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				for {
+					req, err := readMessage(conn)
+					if err != nil {
+						return
+					}
+					resp := []byte{agentFailure}
+					switch req[0] {
+					case agentcRequestIdentities:
+						resp = binary.BigEndian.AppendUint32([]byte{agentIdentitiesAnswer}, uint32(len(keys)))
+						for _, k := range keys {
+							resp = appendString(appendString(resp, k), []byte("comment"))
+						}
+					case agentcSignRequest:
+						resp = appendString([]byte{14}, []byte("sig"))
+					}
+					writeMessage(conn, resp)
+				}
+			}()
+		}
+	}()
+	return path
+}
+
+func TestProxyFiltersByBoundHost(t *testing.T) {
+	work, personal, hostKey := []byte("work-key"), []byte("personal-key"), []byte("github-host-key")
+	upstream := fakeAgent(t, work, personal)
+	p := &Proxy{Upstream: upstream, Filter: func(hk []byte) *Selection {
+		if !bytes.Equal(hk, hostKey) {
+			return nil
+		}
+		return &Selection{Destination: "github.com", Keys: map[string]bool{sshkeys.Fingerprint(work): true}}
+	}}
+	path := filepath.Join(t.TempDir(), "proxy.sock")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go p.Serve(ctx, ln)
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	call := func(req []byte) []byte {
+		t.Helper()
+		if err := writeMessage(conn, req); err != nil {
+			t.Fatal(err)
+		}
+		resp, err := readMessage(conn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	count := func(resp []byte) uint32 { return binary.BigEndian.Uint32(resp[1:5]) }
+
+	if n := count(call([]byte{agentcRequestIdentities})); n != 2 {
+		t.Fatalf("before session-bind: %d identities, want 2", n)
+	}
+	bind := appendString([]byte{agentcExtension}, []byte(sessionBind))
+	for _, s := range []string{string(hostKey), "session", "signature"} {
+		bind = appendString(bind, []byte(s))
+	}
+	bind = append(bind, 0)
+	if resp := call(bind); resp[0] != agentFailure {
+		t.Fatalf("session-bind answered %d, want the upstream's failure", resp[0])
+	}
+	resp := call([]byte{agentcRequestIdentities})
+	if n := count(resp); n != 1 {
+		t.Fatalf("after session-bind: %d identities, want 1", n)
+	}
+	if blob, _, _ := readString(resp[5:]); !bytes.Equal(blob, work) {
+		t.Errorf("offered %q, want %q", blob, work)
+	}
+	if resp := call(appendString([]byte{agentcSignRequest}, personal)); resp[0] != agentFailure {
+		t.Errorf("sign with personal key answered %d, want failure", resp[0])
+	}
+	if resp := call(appendString([]byte{agentcSignRequest}, work)); resp[0] != 14 {
+		t.Errorf("sign with work key answered %d, want a signature", resp[0])
+	}
+}
@@ -0,0 +1,257 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pavelBuzdanov/mgit/internal/agentproxy"
+	"github.com/pavelBuzdanov/mgit/internal/config"
+	"github.com/pavelBuzdanov/mgit/internal/sshkeys"
+	"github.com/pavelBuzdanov/mgit/pkg/matcher"
+	"github.com/pavelBuzdanov/mgit/pkg/trace"
+)
+
+// handleAgent runs an ssh-agent proxy on its own socket in front of the
+// agent at SSH_AUTH_SOCK. ssh clients pointed at it (plain git, IDEs, any
+// tool) see only the identities of the rules for the host they connect to,
+// so key selection works without the mgit wrapper. It runs until
+// interrupted.
+func (a *App) handleAgent(ctx context.Context, opts globalOptions, args []string) int {
+	fs := flag.NewFlagSet("mgit agent", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	socket := fs.String("socket", "", "")
+	upstream := fs.String("upstream", os.Getenv("SSH_AUTH_SOCK"), "")
+	if err := fs.Parse(args); err != nil {
+		return a.fail(opts, usageError(err))
+	}
+	if fs.NArg() > 0 {
+		return a.fail(opts, usageError(errors.New("usage: mgit agent [--socket PATH] [--upstream PATH]")))
+	}
+	if runtime.GOOS == "windows" {
+		return a.fail(opts, errors.New("mgit agent needs a Unix socket; the Windows OpenSSH agent uses a named pipe"))
+	}
+	if *upstream == "" {
+		return a.fail(opts, errors.New("no upstream agent: SSH_AUTH_SOCK is not set (start ssh-agent or pass --upstream)"))
+	}
+	if *socket == "" {
+		path, err := defaultAgentSocket()
+		if err != nil {
+			return a.fail(opts, err)
+		}
+		*socket = path
+	}
+	if sameFile(*socket, *upstream) {
+		return a.fail(opts, usageError(fmt.Errorf("the upstream agent is %s itself; point SSH_AUTH_SOCK at the real agent", *socket)))
+	}
+	_, cfgPath, err := a.tryLoadConfig(opts)
+	if err != nil {
+		return a.fail(opts, err)
+	}
+
+	ln, err := listenAgent(*socket)
+	if err != nil {
+		return a.fail(opts, err)
+	}
+	defer os.Remove(*socket)
+
+	logf := func(format string, args ...any) {
+		trace.Event("agent", "msg", fmt.Sprintf(format, args...))
+		if opts.Verbose {
+			fmt.Fprintf(a.stderr, "%s %s\n", time.Now().Format("15:04:05"), fmt.Sprintf(format, args...))
+		}
+	}
+	proxy := &agentproxy.Proxy{
+		Upstream: *upstream,
+		Logf:     logf,
+		Filter: func(hostKey []byte) *agentproxy.Selection {
+			if hostKey == nil {
+				return nil
+			}
+			// Reloaded per connection, so rule edits apply at once. It is
+			// the config every other command sees: remote rules merged in,
+			// untrusted settings dropped.
+			cfg, _, err := a.tryLoadConfig(opts)
+			if err != nil {
+				logf("load %s: %v; offering every identity", cfgPath, err)
+				return nil
+			}
+			sel, notes, err := agentSelection(cfg, config.KnownHostsFiles(), hostKey)
+			for _, n := range notes {
+				logf("%s", n)
+			}
+			if err != nil {
+				logf("%v; offering every identity", err)
+				return nil
+			}
+			return sel
+		},
+	}
+
+	if opts.Output.Structured() {
+		a.printData(opts, map[string]any{"socket": *socket, "upstream": *upstream, "config": cfgPath})
+	} else {
+		fmt.Fprintf(a.stdout, "SSH_AUTH_SOCK=%s; export SSH_AUTH_SOCK;\n", *socket)
+		a.infof(opts, "# mgit agent: rules from %s, keys from %s. Stop with Ctrl-C.\n", cfgPath, *upstream)
+	}
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := proxy.Serve(ctx, ln); err != nil {
+		return a.fail(opts, err)
+	}
+	return 0
+}
+
+// agentSelection finds the hosts known_hosts pins hostKey to and the keys
+// of the rules for them. The connection doesn't show the owner, so every
+// rule for the host counts; nil means no rule covers it and the agent is
+// left alone. A pin (see mgit pin) selects its rule's key for every host,
+// as it does for every remote. Notes explain rules whose key can't be
+// identified.
+func agentSelection(cfg *config.Config, knownHosts []string, hostKey []byte) (*agentproxy.Selection, []string, error) {
+	pinned, isPinned, err := config.PinnedRule(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	var candidates []string
+	for _, r := range cfg.Rules {
+		if !strings.ContainsAny(r.Host, "*?[") {
+			candidates = append(candidates, r.Host)
+		}
+	}
+	for alias := range cfg.HostAliases {
+		candidates = append(candidates, alias)
+	}
+	hosts, err := sshkeys.HostsForKey(knownHosts, hostKey, candidates)
+	if err != nil {
+		return nil, nil, fmt.Errorf("known_hosts: %w", err)
+	}
+	if isPinned {
+		return pinnedSelection(pinned, hosts)
+	}
+	if len(hosts) == 0 {
+		return nil, nil, nil
+	}
+	for alias, host := range cfg.HostAliases {
+		if slices.Contains(hosts, strings.ToLower(alias)) && !slices.Contains(hosts, strings.ToLower(host)) {
+			hosts = append(hosts, strings.ToLower(host))
+		}
+	}
+
+	sel := &agentproxy.Selection{Destination: hosts[0], Keys: map[string]bool{}}
+	var notes []string
+	for _, r := range cfg.Rules {
+		if !r.HasSSH() || !slices.ContainsFunc(hosts, func(h string) bool { return matcher.MatchesHost(r, h) }) {
+			continue
+		}
+		sel.Rules = append(sel.Rules, r.ID)
+		fp, err := ruleFingerprint(r)
+		if err != nil {
+			notes = append(notes, fmt.Sprintf("rule %s: %v", r.ID, err))
+			continue
+		}
+		sel.Keys[fp] = true
+	}
+	if len(sel.Rules) == 0 {
+		return nil, notes, nil
+	}
+	return sel, notes, nil
+}
+
+// pinnedSelection offers only the key of the pinned rule, whichever of hosts,
+// possibly none, the connection goes to.
+func pinnedSelection(pinned config.Rule, hosts []string) (*agentproxy.Selection, []string, error) {
+	sel := &agentproxy.Selection{Destination: "unknown host", Keys: map[string]bool{}, Rules: []string{pinned.ID}}
+	if len(hosts) > 0 {
+		sel.Destination = hosts[0]
+	}
+	fp, err := ruleFingerprint(pinned)
+	if err != nil {
+		return sel, []string{fmt.Sprintf("pinned rule %s: %v", pinned.ID, err)}, nil
+	}
+	sel.Keys[fp] = true
+	return sel, nil, nil
+}
+
+// ruleFingerprint is the SHA256 fingerprint of the key a rule selects, read
+// from its agent reference or the key's .pub file.
+func ruleFingerprint(r config.Rule) (string, error) {
+	if r.UsesAgent() {
+		if strings.HasPrefix(r.Agent, "SHA256:") {
+			return r.Agent, nil
+		}
+		id, err := sshkeys.ParsePublicKeyLine(r.Agent)
+		return id.Fingerprint, err
+	}
+	if sshkeys.IsProviderRef(r.Key) {
+		return "", fmt.Errorf("key %s is fetched at run time and never in the agent", r.Key)
+	}
+	path, err := config.ExpandPath(r.Key)
+	if err != nil {
+		return "", err
+	}
+	id, err := sshkeys.ReadPublicKeyFile(sshkeys.PublicKeyPath(path))
+	if err != nil {
+		return "", fmt.Errorf("no public key next to %s: %w", r.Key, err)
+	}
+	return id.Fingerprint, nil
+}
+
+// defaultAgentSocket is $XDG_RUNTIME_DIR/mgit-agent.sock, or agent.sock in
+// mgit's cache directory.
+func defaultAgentSocket() (string, error) {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "mgit-agent.sock"), nil
+	}
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cache, "mgit", "agent.sock"), nil
+}
+
+// listenAgent listens on path, readable by the user only. A socket left
+// behind by an agent that is gone is replaced; a live one is an error.
+func listenAgent(path string) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	if _, err := os.Lstat(path); err == nil {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("an agent is already listening on %s", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+func sameFile(a, b string) bool {
+	sa, errA := os.Stat(a)
+	sb, errB := os.Stat(b)
+	if errA != nil || errB != nil {
+		return filepath.Clean(a) == filepath.Clean(b)
+	}
+	return os.SameFile(sa, sb)
+}
@@ -0,0 +1,69 @@
+package cli
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/pavelBuzdanov/mgit/internal/config"
+	"github.com/pavelBuzdanov/mgit/internal/sshkeys"
+)
+
+func TestAgentSelection(t *testing.T) {
+	dir := t.TempDir()
+	hostKey := []byte("github-host-key")
+	knownHosts := filepath.Join(dir, "known_hosts")
+	if err := os.WriteFile(knownHosts, []byte("gh-work ssh-ed25519 "+base64.StdEncoding.EncodeToString(hostKey)+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	workBlob := []byte("work-key")
+	workPub := "ssh-ed25519 " + base64.StdEncoding.EncodeToString(workBlob) + " work"
+	if err := os.WriteFile(filepath.Join(dir, "id_work.pub"), []byte(workPub+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{
+		HostAliases: map[string]string{"gh-work": "github.com"},
+		Rules: []config.Rule{
+			{ID: "work", Host: "github.com", Owner: "CompanyOrg", Key: filepath.Join(dir, "id_work")},
+			{ID: "mine", Host: "github.com", Owner: "me", Agent: "SHA256:mine"},
+			{ID: "nopub", Host: "github.com", Owner: "x", Key: filepath.Join(dir, "id_missing")},
+			{ID: "lab", Host: "gitlab.com", Owner: "*", Key: filepath.Join(dir, "id_lab")},
+		},
+	}
+
+	sel, notes, err := agentSelection(cfg, []string{knownHosts}, hostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sel == nil {
+		t.Fatal("no selection for a host with rules")
+	}
+	if want := []string{"work", "mine", "nopub"}; !slices.Equal(sel.Rules, want) {
+		t.Errorf("rules = %q, want %q", sel.Rules, want)
+	}
+	if !sel.Keys[sshkeys.Fingerprint(workBlob)] || !sel.Keys["SHA256:mine"] || len(sel.Keys) != 2 {
+		t.Errorf("keys = %v", sel.Keys)
+	}
+	if len(notes) != 1 {
+		t.Errorf("notes = %q, want one for rule nopub", notes)
+	}
+
+	if sel, _, _ := agentSelection(cfg, []string{knownHosts}, []byte("other-host")); sel != nil {
+		t.Errorf("unknown host key selected %v, want nil", sel)
+	}
+
+	// A pin offers its rule's key for every host, known or not.
+	cfg.Pin = &config.Pin{Rule: "work"}
+	for _, key := range [][]byte{hostKey, []byte("other-host")} {
+		sel, _, err := agentSelection(cfg, []string{knownHosts}, key)
+		if err != nil || sel == nil || !slices.Equal(sel.Rules, []string{"work"}) || !sel.Keys[sshkeys.Fingerprint(workBlob)] || len(sel.Keys) != 1 {
+			t.Errorf("pinned selection = %+v, %v; want only the work key", sel, err)
+		}
+	}
+	cfg.Pin = &config.Pin{Rule: "gone"}
+	if _, _, err := agentSelection(cfg, []string{knownHosts}, hostKey); err == nil {
+		t.Error("pin to a missing rule: no error")
+	}
+}
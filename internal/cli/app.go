@@ -3,24 +3,33 @@ package cli
 import (
 	"bufio"
 	"context"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"io/fs"
+	"maps"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
 
-	"mgit/internal/config"
-	"mgit/internal/doctor"
-	"mgit/internal/giturl"
-	"mgit/internal/resolve"
-	"mgit/internal/runner"
-	"mgit/internal/sshkeys"
-	"mgit/internal/ui"
+	"github.com/pavelBuzdanov/mgit/internal/config"
+	"github.com/pavelBuzdanov/mgit/internal/doctor"
+	"github.com/pavelBuzdanov/mgit/internal/resolve"
+	"github.com/pavelBuzdanov/mgit/internal/runner"
+	"github.com/pavelBuzdanov/mgit/internal/sshkeys"
+	"github.com/pavelBuzdanov/mgit/internal/ui"
+	"github.com/pavelBuzdanov/mgit/pkg/giturl"
+	"github.com/pavelBuzdanov/mgit/pkg/matcher"
+	"github.com/pavelBuzdanov/mgit/pkg/trace"
 )
 
 const version = "0.1.0"
@@ -29,13 +38,66 @@ type App struct {
 	stdin  io.Reader
 	stdout io.Writer
 	stderr io.Writer
+
+	// lineMu serializes printLine calls from concurrent workers.
+	lineMu sync.Mutex
+
+	// askpass serves passphrases asked with askpass "prompt", by key path,
+	// until the run ends; askpassWarned holds the keys already warned about.
+	askpassMu     sync.Mutex
+	askpass       map[string]*askpassServer
+	askpassWarned map[string]bool
+
+	// remoteRules holds the remote rules loaded this run, by config path.
+	remoteMu    sync.Mutex
+	remoteRules map[string]remoteRulesResult
+	// insecureWarned is set once --insecure let an unsigned config through.
+	insecureWarned bool
+	// untrustedWarned is set once settings of an untrusted config were
+	// ignored.
+	untrustedWarned bool
+	// redact is set when structured output is redacted; redactConfig is
+	// the config it takes key paths and hosts from, nil when none loads.
+	redact       bool
+	redactConfig *config.Config
 }
 
 type globalOptions struct {
 	ConfigPath string
-	JSON       bool
+	Output     ui.Format
 	Verbose    bool
 	DryRun     bool
+	NoColor    bool
+	Quiet      bool
+	Yes        bool
+	LogFile    string
+	// Retry is --retry; -1 when not given, so the config's retry applies.
+	Retry int
+	// Timeout bounds the whole command; subprocesses still running when it
+	// expires are killed.
+	Timeout time.Duration
+	// StrictEnv fails instead of overriding a GIT_SSH_COMMAND or
+	// core.sshCommand set outside mgit.
+	StrictEnv bool
+	// Strict refuses remotes only a catch-all rule or defaultKey covers, as
+	// the config's strict setting does.
+	Strict bool
+	// Insecure warns instead of failing when a config or remote rule set is
+	// not signed by a trusted key.
+	Insecure bool
+	// SSHVerbose is --ssh-verbose: how many -v flags ssh gets, 0 for none.
+	SSHVerbose int
+	// ShowSecrets turns off the redaction of credentials in printed URLs,
+	// and --redact.
+	ShowSecrets bool
+	// Redact masks key paths, user names and private hosts in structured
+	// output, as the config's redact setting does.
+	Redact bool
+	// Dir is the repository a command operates on; empty means the working
+	// directory. Workspace commands set it per registered repository.
+	Dir string
+	// Backend is --backend: the git binary, or go-git in process.
+	Backend runner.Backend
 }
 
 func New(stdin io.Reader, stdout, stderr io.Writer) *App {
@@ -44,16 +106,49 @@ func New(stdin io.Reader, stdout, stderr io.Writer) *App {
 
 func (a *App) Run(ctx context.Context, args []string) int {
 	opts, rest, err := parseGlobalOptions(args)
+	if !opts.ShowSecrets {
+		a.stdout, a.stderr = redactWriter{a.stdout}, redactWriter{a.stderr}
+	}
+	if err == nil && opts.Quiet && opts.Verbose {
+		err = errors.New("--quiet and --verbose cannot be used together")
+	}
 	if err != nil {
 		a.printErr(err)
 		a.printUsage()
-		return 2
+		return exitUsage
+	}
+	if opts.Dir != "" {
+		dir, err := chdirTarget(opts.Dir)
+		if err != nil {
+			return a.fail(opts, err)
+		}
+		opts.Dir = dir
+	}
+	a.setupRedaction(opts)
+	stopTrace, err := a.startTrace(opts)
+	if err != nil {
+		return a.fail(opts, usageError(err))
 	}
+	defer stopTrace()
+	defer a.closeAskpass()
+	trace.Event("mgit.run", "version", version, "args", args)
 	if len(rest) == 0 {
 		a.printUsage()
 		return 0
 	}
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+	code := a.dispatch(ctx, opts, rest)
+	if code != 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return a.fail(opts, withExitCode(exitTimeout, fmt.Errorf("timed out after %s (--timeout)", opts.Timeout)))
+	}
+	return code
+}
 
+func (a *App) dispatch(ctx context.Context, opts globalOptions, rest []string) int {
 	switch rest[0] {
 	case "help", "--help", "-h":
 		a.printUsage()
@@ -65,21 +160,82 @@ func (a *App) Run(ctx context.Context, args []string) int {
 		return a.handleConfig(ctx, opts, rest[1:])
 	case "rule":
 		return a.handleRule(ctx, opts, rest[1:])
+	case "ui":
+		return a.handleRuleManage(ctx, opts, rest[1:])
 	case "resolve":
 		return a.handleResolve(ctx, opts, rest[1:])
 	case "doctor":
 		return a.handleDoctor(ctx, opts, rest[1:])
+	case "status":
+		return a.handleStatus(ctx, opts, rest[1:])
+	case "setup":
+		return a.handleSetup(ctx, opts, rest[1:])
+	case "import":
+		return a.handleImport(ctx, opts, rest[1:])
+	case "export":
+		return a.handleExport(ctx, opts, rest[1:])
+	case "remotes":
+		return a.handleRemotes(ctx, opts, rest[1:])
+	case "which":
+		return a.handleWhich(ctx, opts, rest[1:])
 	case "ssh-test":
 		return a.handleSSHTest(ctx, opts, rest[1:])
+	case "ssh-cleanup":
+		return a.handleSSHCleanup(ctx, opts, rest[1:])
+	case "selftest":
+		return a.handleSelftest(ctx, opts, rest[1:])
+	case "agent":
+		return a.handleAgent(ctx, opts, rest[1:])
+	case "ssh-config-hook":
+		return a.handleSSHConfigHook(ctx, opts, rest[1:])
+	case "match-host":
+		return a.handleMatchHost(ctx, opts, rest[1:])
+	case "install-dispatcher":
+		return a.handleInstallDispatcher(ctx, opts, rest[1:])
+	case "pin":
+		return a.handlePin(ctx, opts, rest[1:])
+	case "unpin":
+		return a.handleUnpin(ctx, opts, rest[1:])
+	case "key":
+		return a.handleKey(ctx, opts, rest[1:])
+	case "knownhosts":
+		return a.handleKnownHosts(ctx, opts, rest[1:])
+	case "guard":
+		return a.handleGuard(ctx, opts, rest[1:])
+	case "hooks":
+		return a.handleHooks(ctx, opts, rest[1:])
+	case "shim":
+		return a.handleShim(ctx, opts, rest[1:])
+	case "gh", "glab":
+		return a.handleForgeCLI(ctx, opts, forgeCLIs[rest[0]], rest[1:])
+	case "sync":
+		return a.handleSync(ctx, opts, rest[1:])
+	case "ws", "workspace":
+		return a.handleWorkspace(ctx, opts, rest[1:])
+	case "stats":
+		return a.handleStats(ctx, opts, rest[1:])
 	case "exec":
 		return a.handleExec(ctx, opts, rest[1:])
+	case "askpass-helper":
+		return a.handleAskpassHelper(ctx, opts, rest[1:])
+	case "remote":
+		if len(rest) > 1 && rest[1] == "add" {
+			return a.handleRemoteAdd(ctx, opts, rest)
+		}
+		return a.handleExec(ctx, opts, rest)
 	default:
+		if path, ok := findPlugin(rest[0]); ok {
+			return a.runPlugin(ctx, opts, path, rest[1:])
+		}
+		if hint := a.suggestCommand(ctx, opts, rest[0]); hint != "" {
+			return a.fail(opts, usageError(fmt.Errorf("unknown command %q\nDid you mean %q?", rest[0], hint)))
+		}
 		return a.handleExec(ctx, opts, rest)
 	}
 }
 
 func parseGlobalOptions(args []string) (globalOptions, []string, error) {
-	var opts globalOptions
+	opts := globalOptions{Output: ui.FormatText, Retry: -1}
 	rest := make([]string, 0, len(args))
 	i := 0
 	for i < len(args) {
@@ -94,11 +250,92 @@ func parseGlobalOptions(args []string) (globalOptions, []string, error) {
 		}
 		switch {
 		case a == "--json":
-			opts.JSON = true
+			opts.Output = ui.FormatJSON
+		case a == "--output", strings.HasPrefix(a, "--output="):
+			value := strings.TrimPrefix(a, "--output=")
+			if a == "--output" {
+				if i+1 >= len(args) {
+					return opts, nil, fmt.Errorf("--output requires a value")
+				}
+				i++
+				value = args[i]
+			}
+			f, err := ui.ParseFormat(value)
+			if err != nil {
+				return opts, nil, err
+			}
+			opts.Output = f
 		case a == "--verbose":
 			opts.Verbose = true
 		case a == "--dry-run":
 			opts.DryRun = true
+		case a == "--no-color":
+			opts.NoColor = true
+		case a == "--quiet", a == "-q":
+			opts.Quiet = true
+		case a == "--yes", a == "-y":
+			opts.Yes = true
+		case a == "--show-secrets":
+			opts.ShowSecrets = true
+		case a == "--redact":
+			opts.Redact = true
+		case a == "--strict-env":
+			opts.StrictEnv = true
+		case a == "--strict":
+			opts.Strict = true
+		case a == "--insecure":
+			opts.Insecure = true
+		case a == "--ssh-verbose":
+			opts.SSHVerbose = 1
+		case strings.HasPrefix(a, "--ssh-verbose="):
+			value := strings.TrimPrefix(a, "--ssh-verbose=")
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > 3 {
+				return opts, nil, fmt.Errorf("--ssh-verbose: expected a level from 1 to 3, got %q", value)
+			}
+			opts.SSHVerbose = n
+		case a == "--retry", strings.HasPrefix(a, "--retry="):
+			value := strings.TrimPrefix(a, "--retry=")
+			if a == "--retry" {
+				if i+1 >= len(args) {
+					return opts, nil, fmt.Errorf("--retry requires a value")
+				}
+				i++
+				value = args[i]
+			}
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return opts, nil, fmt.Errorf("--retry: expected a number of retries >= 0, got %q", value)
+			}
+			opts.Retry = n
+		case a == "--timeout", strings.HasPrefix(a, "--timeout="):
+			value := strings.TrimPrefix(a, "--timeout=")
+			if a == "--timeout" {
+				if i+1 >= len(args) {
+					return opts, nil, fmt.Errorf("--timeout requires a value")
+				}
+				i++
+				value = args[i]
+			}
+			d, err := time.ParseDuration(value)
+			if err != nil || d <= 0 {
+				return opts, nil, fmt.Errorf("--timeout: invalid duration %q (e.g. 30s, 5m)", value)
+			}
+			opts.Timeout = d
+		case a == "--backend", strings.HasPrefix(a, "--backend="):
+			value := strings.TrimPrefix(a, "--backend=")
+			if a == "--backend" {
+				if i+1 >= len(args) {
+					return opts, nil, fmt.Errorf("--backend requires a value")
+				}
+				i++
+				value = args[i]
+			}
+			b, err := runner.ParseBackend(value)
+			if err != nil {
+				return opts, nil, fmt.Errorf("--backend: %w", err)
+			}
+			opts.Backend = b
 		case a == "--config":
 			if i+1 >= len(args) {
 				return opts, nil, fmt.Errorf("--config requires a value")
@@ -107,6 +344,31 @@ func parseGlobalOptions(args []string) (globalOptions, []string, error) {
 			opts.ConfigPath = args[i]
 		case strings.HasPrefix(a, "--config="):
 			opts.ConfigPath = strings.TrimPrefix(a, "--config=")
+		case a == "--log-file":
+			if i+1 >= len(args) {
+				return opts, nil, fmt.Errorf("--log-file requires a value")
+			}
+			i++
+			opts.LogFile = args[i]
+		case strings.HasPrefix(a, "--log-file="):
+			opts.LogFile = strings.TrimPrefix(a, "--log-file=")
+		case a == "-C", a == "--chdir", strings.HasPrefix(a, "--chdir="):
+			value := strings.TrimPrefix(a, "--chdir=")
+			if a == "-C" || a == "--chdir" {
+				if i+1 >= len(args) {
+					return opts, nil, fmt.Errorf("%s requires a directory", a)
+				}
+				i++
+				value = args[i]
+			}
+			// As with git, each -C is relative to the previous one, and an
+			// empty one is ignored.
+			if value != "" {
+				if opts.Dir != "" && !filepath.IsAbs(value) && !strings.HasPrefix(value, "~") {
+					value = filepath.Join(opts.Dir, value)
+				}
+				opts.Dir = value
+			}
 		default:
 			rest = append(rest, args[i:]...)
 			return opts, rest, nil
@@ -116,8 +378,160 @@ func parseGlobalOptions(args []string) (globalOptions, []string, error) {
 	return opts, rest, nil
 }
 
+// chdirTarget makes the -C directory absolute and checks that it exists.
+func chdirTarget(dir string) (string, error) {
+	dir, err := config.ExpandPath(dir)
+	if err == nil {
+		dir, err = filepath.Abs(dir)
+	}
+	if err != nil {
+		return "", fmt.Errorf("-C: %w", err)
+	}
+	st, err := os.Stat(dir)
+	if err != nil {
+		return "", fmt.Errorf("cannot change to %s: %w", dir, errors.Unwrap(err))
+	}
+	if !st.IsDir() {
+		return "", fmt.Errorf("cannot change to %s: not a directory", dir)
+	}
+	return dir, nil
+}
+
+// startTrace enables trace output: JSON lines appended to --log-file, or
+// key=value lines on stderr with MGIT_DEBUG=1 (MGIT_DEBUG=json for JSON).
+func (a *App) startTrace(opts globalOptions) (func(), error) {
+	if opts.LogFile != "" {
+		path, err := config.ExpandPath(opts.LogFile)
+		if err != nil {
+			return nil, fmt.Errorf("--log-file: %w", err)
+		}
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("open log file: %w", err)
+		}
+		var w io.Writer = f
+		if !opts.ShowSecrets {
+			w = redactWriter{f}
+		}
+		trace.Enable(w, trace.FormatJSON)
+		return func() {
+			trace.Disable()
+			_ = f.Close()
+		}, nil
+	}
+	switch strings.ToLower(strings.TrimSpace(os.Getenv("MGIT_DEBUG"))) {
+	case "", "0", "false":
+		return func() {}, nil
+	case "json":
+		trace.Enable(a.stderr, trace.FormatJSON)
+	default:
+		trace.Enable(a.stderr, trace.FormatText)
+	}
+	return trace.Disable, nil
+}
+
 func (a *App) newShell(opts globalOptions) *runner.Shell {
-	return runner.NewShell(a.stdout, a.stderr, opts.Verbose)
+	shell := runner.NewShell(rawWriter(a.stdout), rawWriter(a.stderr), opts.Verbose)
+	shell.Log = a.stderr
+	shell.Dir = opts.Dir
+	return shell
+}
+
+// gitOps returns the git operations for shell, on the backend --backend
+// picked.
+func (a *App) gitOps(opts globalOptions, shell *runner.Shell) *runner.GitOps {
+	git := runner.NewGitOps(shell)
+	git.Backend = opts.Backend
+	return git
+}
+
+// redactWriter hides credentials in URLs written through it (see
+// giturl.Redact). mgit writes a line or a whole document per call, so URLs
+// are not split across writes. Subprocesses get the wrapped writer back from
+// rawWriter, so git still sees a terminal.
+type redactWriter struct {
+	w io.Writer
+}
+
+func (r redactWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(r.w, giturl.Redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (r redactWriter) Unwrap() io.Writer { return r.w }
+
+func rawWriter(w io.Writer) io.Writer {
+	return ui.Unwrap(w)
+}
+
+// redactResult masks the parsed user of res for printing unless
+// --show-secrets is set. URLs are redacted by redactWriter on output, but a
+// token passed as an HTTPS username also lands in Parsed.User.
+func redactResult(opts globalOptions, res *resolve.Result) *resolve.Result {
+	if opts.ShowSecrets || res == nil || res.Parsed == nil {
+		return res
+	}
+	out := *res
+	parsed := res.Parsed.Redacted()
+	out.Parsed = &parsed
+	return &out
+}
+
+// infof prints informational output that --quiet suppresses: progress,
+// confirmations and notes, as opposed to the result a command exists for.
+func (a *App) infof(opts globalOptions, format string, args ...any) {
+	if opts.Quiet {
+		return
+	}
+	fmt.Fprintf(a.stdout, format, args...)
+}
+
+// printData writes a command's result in the structured format chosen with
+// --output (or --json).
+func (a *App) printData(opts globalOptions, v any) {
+	if opts.Output.Structured() {
+		v = a.redactOutput(v)
+	}
+	if err := ui.Print(a.stdout, opts.Output, v); err != nil {
+		a.printErr(err)
+	}
+}
+
+// printLine writes one record of --output jsonl. Bulk commands call it per
+// target as soon as the target completes, possibly from several workers.
+func (a *App) printLine(v any) {
+	a.lineMu.Lock()
+	defer a.lineMu.Unlock()
+	if err := ui.PrintLine(a.stdout, a.redactOutput(v)); err != nil {
+		a.printErr(err)
+	}
+}
+
+func (a *App) color(opts globalOptions) ui.Color {
+	return ui.Color{Enabled: ui.ColorEnabled(a.stdout, opts.NoColor)}
+}
+
+// sshBinary is the plain ssh client, without a rule's sshCommand: MGIT_SSH
+// or the config's sshBinary when set, else ssh from PATH.
+func (a *App) sshBinary(opts globalOptions) runner.SSHClient {
+	cfg, _, err := a.tryLoadConfig(opts)
+	if err != nil {
+		cfg = &config.Config{}
+	}
+	bin := cfg.SSHBinaryPath()
+	if bin == "" {
+		return nil
+	}
+	if expanded, err := config.ExpandPath(bin); err == nil && strings.HasPrefix(bin, "~") {
+		bin = expanded
+	}
+	return runner.SSHClient{bin}
+}
+
+func (a *App) configPath(opts globalOptions) (string, error) {
+	return config.ResolvePathIn(opts.ConfigPath, opts.Dir)
 }
 
 func (a *App) handleConfig(ctx context.Context, opts globalOptions, args []string) int {
@@ -130,69 +544,254 @@ func (a *App) handleConfig(ctx context.Context, opts globalOptions, args []strin
 		fs := flag.NewFlagSet("mgit config init", flag.ContinueOnError)
 		fs.SetOutput(io.Discard)
 		force := fs.Bool("force", false, "")
+		gitignore := fs.String("gitignore", "", "")
 		if err := fs.Parse(args[1:]); err != nil {
-			a.printErr(err)
-			return 2
+			return a.fail(opts, usageError(err))
 		}
-		path, created, err := config.Init(opts.ConfigPath, *force)
+		ignoreMode, err := gitignoreMode(*gitignore)
 		if err != nil {
-			a.printErr(err)
-			return 1
+			return a.fail(opts, usageError(err))
 		}
-		if changed, err := config.EnsureGitignoreExcludesMgit(path); err == nil && changed {
-			fmt.Fprintln(a.stdout, "Updated .gitignore: added .mgit")
-		} else if err != nil && opts.Verbose {
-			fmt.Fprintf(a.stderr, "warn: failed to update .gitignore: %v\n", err)
+		path, err := a.configPath(opts)
+		if err != nil {
+			return a.fail(opts, err)
+		}
+		if *force {
+			if existing, err := config.Load(path); err == nil {
+				ok, err := a.confirm(opts, fmt.Sprintf("This will overwrite %s (%d rules) with the example config.", path, len(existing.Rules)))
+				if err != nil {
+					return a.fail(opts, err)
+				}
+				if !ok {
+					return a.fail(opts, errAborted)
+				}
+			}
+		}
+		path, created, err := config.Init(path, *force)
+		if err != nil {
+			return a.fail(opts, err)
 		}
+		a.excludeMgit(opts, path, ignoreMode)
 		if created {
-			fmt.Fprintf(a.stdout, "Created config: %s\n", path)
+			a.infof(opts, "Created config: %s\n", path)
 		} else {
-			fmt.Fprintf(a.stdout, "Config already exists: %s\n", path)
+			a.infof(opts, "Config already exists: %s\n", path)
 		}
 		return 0
 	case "path":
-		path, err := config.ResolvePath(opts.ConfigPath)
+		path, err := a.configPath(opts)
 		if err != nil {
-			a.printErr(err)
-			return 1
+			return a.fail(opts, err)
 		}
 		fmt.Fprintln(a.stdout, path)
 		return 0
+	case "refresh":
+		path, err := a.configPath(opts)
+		if err != nil {
+			return a.fail(opts, err)
+		}
+		cfg, _, sigErr, err := config.LoadVerified(path)
+		if err == nil {
+			err = a.allowUnverified(opts, sigErr)
+		}
+		if err != nil {
+			return a.fail(opts, withExitCode(exitConfig, err))
+		}
+		if cfg.RemoteRules == "" {
+			return a.fail(opts, withExitCode(exitConfig, fmt.Errorf("%s sets no remoteRules", config.DescribePath(path))))
+		}
+		res := a.remoteRulesFor(opts, path, cfg, true)
+		if res.err == nil && res.rules.FetchErr != nil {
+			res.err = fmt.Errorf("%w; still using the copy fetched %s ago", res.rules.FetchErr, since(res.rules.FetchedAt))
+		}
+		if res.err == nil && res.rules.SignatureErr != nil && !opts.Insecure {
+			res.err = withExitCode(exitConfig, fmt.Errorf("remote rules %s: %w", res.rules.URL, res.rules.SignatureErr))
+		}
+		if res.err != nil {
+			return a.fail(opts, res.err)
+		}
+		if opts.Output.Structured() {
+			a.printData(opts, map[string]any{"url": res.rules.URL, "rules": len(res.rules.Rules), "fetchedAt": config.Timestamp(res.rules.FetchedAt)})
+		} else {
+			fmt.Fprintf(a.stdout, "Fetched %d rule(s) from %s\n", len(res.rules.Rules), res.rules.URL)
+		}
+		return 0
 	case "validate":
 		cfg, path, err := a.loadConfig(opts)
 		if err != nil {
-			a.printErr(err)
-			return 1
+			return a.fail(opts, err)
 		}
-		issues := cfg.Validate()
-		if opts.JSON {
-			_ = ui.PrintJSON(a.stdout, map[string]any{
+		issues := append(config.Validate(cfg), matcher.AmbiguityIssues(cfg.Rules)...)
+		if opts.Output.Structured() {
+			a.printData(opts, map[string]any{
 				"configPath": path,
 				"valid":      !config.HasErrors(issues),
 				"issues":     issues,
 			})
+		} else if opts.Output == ui.FormatTable {
+			c := a.color(opts)
+			if len(issues) == 0 {
+				fmt.Fprintf(a.stdout, "Validation: %s\n", c.Green("OK"))
+			} else {
+				tw := tabwriter.NewWriter(a.stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(tw, "LEVEL\tFIELD\tMESSAGE")
+				for _, issue := range issues {
+					fmt.Fprintf(tw, "%s\t%s\t%s\n", strings.ToUpper(issue.Level), dash(issue.Field), issue.Message)
+				}
+				_ = tw.Flush()
+			}
 		} else {
+			c := a.color(opts)
 			fmt.Fprintf(a.stdout, "Config: %s\n", path)
 			if len(issues) == 0 {
-				fmt.Fprintln(a.stdout, "Validation: OK")
+				fmt.Fprintf(a.stdout, "Validation: %s\n", c.Green("OK"))
 			} else {
 				for _, issue := range issues {
 					field := ""
 					if issue.Field != "" {
 						field = " (" + issue.Field + ")"
 					}
-					fmt.Fprintf(a.stdout, "[%s]%s %s\n", strings.ToUpper(issue.Level), field, issue.Message)
+					fmt.Fprintf(a.stdout, "[%s]%s %s\n", c.Level(issue.Level), field, issue.Message)
 				}
 				if config.HasErrors(issues) {
-					fmt.Fprintln(a.stdout, "Validation: FAILED")
+					fmt.Fprintf(a.stdout, "Validation: %s\n", c.Red("FAILED"))
 				} else {
-					fmt.Fprintln(a.stdout, "Validation: OK (with warnings)")
+					fmt.Fprintf(a.stdout, "Validation: %s\n", c.Yellow("OK (with warnings)"))
 				}
 			}
 		}
 		if config.HasErrors(issues) {
-			return 1
+			return exitConfig
+		}
+		return 0
+	case "schema":
+		fmt.Fprint(a.stdout, config.Schema)
+		return 0
+	case "get":
+		if len(args) != 2 {
+			a.printConfigUsage()
+			return 2
+		}
+		cfg, _, err := a.loadConfig(opts)
+		if err != nil {
+			return a.fail(opts, err)
+		}
+		value, key, err := config.Get(cfg, args[1])
+		if err != nil {
+			return a.fail(opts, err)
+		}
+		if opts.Output.Structured() {
+			a.printData(opts, map[string]any{"key": key, "value": value})
+			return 0
+		}
+		switch v := value.(type) {
+		case string, int, bool:
+			fmt.Fprintln(a.stdout, v)
+		default:
+			data, _ := json.MarshalIndent(v, "", "  ")
+			fmt.Fprintln(a.stdout, string(data))
+		}
+		return 0
+	case "set":
+		if len(args) != 3 {
+			a.printConfigUsage()
+			return 2
+		}
+		var key string
+		var issues []config.ValidationIssue
+		path, err := a.updateConfig(opts, func(cfg *config.Config) error {
+			before := map[config.ValidationIssue]bool{}
+			for _, issue := range config.Validate(cfg) {
+				before[issue] = true
+			}
+			var err error
+			if key, err = config.Set(cfg, args[1], args[2]); err != nil {
+				return err
+			}
+			// Refuse a change that leaves the config with errors it didn't
+			// have; problems that were already there don't block it.
+			for _, issue := range config.Validate(cfg) {
+				if issue.Level == "error" && !before[issue] {
+					issues = append(issues, issue)
+				}
+			}
+			if len(issues) > 0 {
+				return fmt.Errorf("%s: %s", issues[0].Field, issues[0].Message)
+			}
+			if opts.DryRun {
+				return errDryRun
+			}
+			return nil
+		})
+		if errors.Is(err, errDryRun) {
+			fmt.Fprintf(a.stdout, "Dry run: would set %s = %s in %s\n", key, args[2], path)
+			return 0
+		}
+		if err != nil {
+			return a.fail(opts, err)
+		}
+		a.infof(opts, "Set %s = %s in %s\n", key, args[2], path)
+		return 0
+	case "history":
+		path, err := a.configPath(opts)
+		if err != nil {
+			return a.fail(opts, err)
+		}
+		history, err := config.History(path)
+		if err != nil {
+			return a.fail(opts, err)
+		}
+		if opts.Output.Structured() {
+			if history == nil {
+				history = []config.Snapshot{}
+			}
+			a.printData(opts, map[string]any{
+				"configPath": path,
+				"snapshots":  history,
+			})
+			return 0
+		}
+		if len(history) == 0 {
+			a.infof(opts, "No history for %s\n", path)
+			return 0
+		}
+		tw := tabwriter.NewWriter(a.stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "#\tSAVED\tRULES\tSNAPSHOT")
+		for i, s := range history {
+			fmt.Fprintf(tw, "%d\t%s\t%d\t%s\n", i+1, s.Time.Local().Format("2006-01-02 15:04:05"), s.Rules, s.Path)
+		}
+		_ = tw.Flush()
+		return 0
+	case "undo":
+		path, err := a.configPath(opts)
+		if err != nil {
+			return a.fail(opts, err)
+		}
+		history, err := config.History(path)
+		if err != nil {
+			return a.fail(opts, err)
+		}
+		if len(history) == 0 {
+			return a.fail(opts, errors.New("no config history to undo"))
+		}
+		latest := history[0]
+		saved := latest.Time.Local().Format("2006-01-02 15:04:05")
+		if opts.DryRun {
+			fmt.Fprintf(a.stdout, "Dry run: would restore %s to the version saved %s (%s)\n", path, saved, plural(latest.Rules, "rule"))
+			return 0
+		}
+		ok, err := a.confirm(opts, fmt.Sprintf("This will replace %s with the version saved %s (%s).", path, saved, plural(latest.Rules, "rule")))
+		if err != nil {
+			return a.fail(opts, err)
+		}
+		if !ok {
+			return a.fail(opts, errAborted)
+		}
+		restored, err := config.Undo(path)
+		if err != nil {
+			return a.fail(opts, err)
 		}
+		a.infof(opts, "Restored %s to the version saved %s (%s)\n", path, restored.Time.Local().Format("2006-01-02 15:04:05"), plural(restored.Rules, "rule"))
 		return 0
 	default:
 		a.printConfigUsage()
@@ -208,63 +807,138 @@ func (a *App) handleRule(ctx context.Context, opts globalOptions, args []string)
 	}
 	switch args[0] {
 	case "list":
+		fs := flag.NewFlagSet("mgit rule list", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		tag := fs.String("tag", "", "")
+		if err := fs.Parse(args[1:]); err != nil {
+			return a.fail(opts, usageError(err))
+		}
 		cfg, _, err := a.loadConfig(opts)
 		if err != nil {
-			a.printErr(err)
-			return 1
+			return a.fail(opts, err)
 		}
-		if opts.JSON {
-			_ = ui.PrintJSON(a.stdout, map[string]any{"rules": cfg.Rules})
+		// Numbering stays the rule's position in the config, so the # of a
+		// filtered listing still works with rule remove --index.
+		type listed struct {
+			n    int
+			rule config.Rule
+		}
+		rules := []config.Rule{}
+		var shown []listed
+		for i, r := range cfg.Rules {
+			if *tag == "" || r.HasTag(*tag) {
+				rules = append(rules, r)
+				shown = append(shown, listed{i + 1, r})
+			}
+		}
+		if opts.Output.Structured() {
+			a.printData(opts, map[string]any{"rules": rules})
 			return 0
 		}
-		if len(cfg.Rules) == 0 {
-			fmt.Fprintln(a.stdout, "No rules configured")
+		if len(shown) == 0 {
+			if *tag != "" {
+				fmt.Fprintf(a.stdout, "No rules tagged %s\n", *tag)
+			} else {
+				fmt.Fprintln(a.stdout, "No rules configured")
+			}
 			return 0
 		}
-		for i, r := range cfg.Rules {
-			fmt.Fprintf(a.stdout, "%d. id=%s host=%s owner=%s key=%s", i+1, r.ID, r.Host, r.Owner, r.Key)
+		if opts.Output == ui.FormatTable {
+			tw := tabwriter.NewWriter(a.stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "#\tID\tHOST\tOWNER\tREMOTE\tKEY/AGENT\tPRIORITY\tEMAIL\tSIGNING KEY\tTAGS\tDESCRIPTION")
+			for _, l := range shown {
+				r := l.rule
+				fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\t%s\n", l.n, r.ID, r.Host, r.Owner, dash(r.Remote), ruleKeyLabel(r), r.Priority, dash(r.Email), dash(r.SigningKey), dash(strings.Join(r.Tags, ",")), dash(r.Description))
+			}
+			_ = tw.Flush()
+			return 0
+		}
+		for _, l := range shown {
+			i, r := l.n-1, l.rule
+			switch {
+			case r.UsesAgent():
+				fmt.Fprintf(a.stdout, "%d. id=%s host=%s owner=%s agent=%s", i+1, r.ID, r.Host, r.Owner, r.Agent)
+			case r.HasSSH():
+				fmt.Fprintf(a.stdout, "%d. id=%s host=%s owner=%s key=%s", i+1, r.ID, r.Host, r.Owner, r.Key)
+			default:
+				fmt.Fprintf(a.stdout, "%d. id=%s host=%s owner=%s", i+1, r.ID, r.Host, r.Owner)
+			}
+			if r.Remote != "" {
+				fmt.Fprintf(a.stdout, " remote=%s", r.Remote)
+			}
 			if r.Priority != 0 {
 				fmt.Fprintf(a.stdout, " priority=%d", r.Priority)
 			}
+			if r.SigningKey != "" {
+				fmt.Fprintf(a.stdout, " signingKey=%s", r.SigningKey)
+			}
+			if r.Email != "" {
+				fmt.Fprintf(a.stdout, " email=%s", r.Email)
+			}
+			if r.HTTPSUser != "" {
+				fmt.Fprintf(a.stdout, " httpsUser=%s", r.HTTPSUser)
+			}
+			if r.CredentialHelper != "" {
+				fmt.Fprintf(a.stdout, " credentialHelper=%q", r.CredentialHelper)
+			}
+			if len(r.Tags) > 0 {
+				fmt.Fprintf(a.stdout, " tags=%s", strings.Join(r.Tags, ","))
+			}
+			if r.Description != "" {
+				fmt.Fprintf(a.stdout, " description=%q", r.Description)
+			}
 			fmt.Fprintln(a.stdout)
 		}
 		return 0
 	case "add":
 		fs := flag.NewFlagSet("mgit rule add", flag.ContinueOnError)
 		fs.SetOutput(io.Discard)
-		var host, owner, namespace, key, id, remoteURL string
+		var host, owner, namespace, remote, key, agent, keyFromDiscovery, skProvider, strictHostKeys, knownHostsFile, signingKey, signingFormat, email, description, tags, httpsUser, credentialHelper, id, remoteURL string
 		var priority int
 		noPrompt := fs.Bool("no-prompt", false, "")
 		force := fs.Bool("force", false, "")
 		fs.StringVar(&host, "host", "", "")
 		fs.StringVar(&owner, "owner", "", "")
 		fs.StringVar(&namespace, "namespace", "", "")
+		fs.StringVar(&remote, "remote", "", "")
 		fs.StringVar(&key, "key", "", "")
+		fs.StringVar(&agent, "agent", "", "")
+		fs.StringVar(&keyFromDiscovery, "key-from-discovery", "", "")
+		fs.StringVar(&skProvider, "security-key-provider", "", "")
+		fs.StringVar(&strictHostKeys, "strict-host-key-checking", "", "")
+		fs.StringVar(&knownHostsFile, "known-hosts-file", "", "")
+		fs.StringVar(&signingKey, "signing-key", "", "")
+		fs.StringVar(&signingFormat, "signing-format", "", "")
+		fs.StringVar(&email, "email", "", "")
+		fs.StringVar(&description, "description", "", "")
+		fs.StringVar(&tags, "tags", "", "")
+		fs.StringVar(&httpsUser, "https-user", "", "")
+		fs.StringVar(&credentialHelper, "credential-helper", "", "")
 		fs.StringVar(&remoteURL, "url", "", "")
 		fs.StringVar(&id, "id", "", "")
 		fs.IntVar(&priority, "priority", 0, "")
 		if err := fs.Parse(args[1:]); err != nil {
-			a.printErr(err)
-			return 2
+			return a.fail(opts, usageError(err))
 		}
 		pos := fs.Args()
 		if remoteURL == "" && len(pos) > 0 {
 			remoteURL = pos[0]
 		}
+		hostFromURL := false
 		if remoteURL != "" {
 			parsed, err := giturl.Parse(remoteURL)
 			if err != nil {
-				a.printErr(fmt.Errorf("failed to parse URL %q: %w", remoteURL, err))
-				return 2
+				return a.fail(opts, usageError(fmt.Errorf("failed to parse URL %q: %w", remoteURL, err)))
 			}
 			if strings.TrimSpace(host) == "" {
 				host = parsed.Host
+				hostFromURL = true
 			}
 			if strings.TrimSpace(owner) == "" && strings.TrimSpace(namespace) == "" {
 				owner = parsed.Owner
 			}
-			if !opts.JSON {
-				fmt.Fprintf(a.stdout, "Detected from URL: host=%s owner=%s repo=%s transport=%s\n", parsed.Host, parsed.Owner, parsed.Repo, parsed.Transport)
+			if !opts.Output.Structured() {
+				a.infof(opts, "Detected from URL: host=%s owner=%s repo=%s transport=%s\n", parsed.Host, parsed.Owner, parsed.Repo, parsed.Transport)
 			}
 		}
 		if owner == "" {
@@ -276,40 +950,94 @@ func (a *App) handleRule(ctx context.Context, opts globalOptions, args []string)
 		if strings.TrimSpace(owner) == "" {
 			owner = "*"
 		}
-		if strings.TrimSpace(key) == "" {
-			if *noPrompt {
-				a.printErr(errors.New("--key is required when --no-prompt is used"))
-				return 2
-			}
-			selected, err := a.selectSSHKeyInteractively(host, owner)
-			if err != nil {
-				a.printErr(err)
-				return 1
+		// A rule with HTTPS settings and no key serves HTTPS remotes only.
+		httpsOnly := strings.TrimSpace(httpsUser) != "" || strings.TrimSpace(credentialHelper) != ""
+		if strings.TrimSpace(key) == "" && strings.TrimSpace(agent) == "" && keyFromDiscovery == "" && !httpsOnly {
+			if def := strings.TrimSpace(os.Getenv("MGIT_DEFAULT_KEY")); def != "" {
+				if sshkeys.IsAgentRef(def) {
+					agent = def
+				} else {
+					key = def
+				}
 			}
-			key = selected
 		}
-		cfg, path, err := a.loadOrCreateConfig(opts)
-		if err != nil {
-			a.printErr(err)
-			return 1
+		if strings.TrimSpace(key) == "" && strings.TrimSpace(agent) == "" && (keyFromDiscovery != "" || !httpsOnly) {
+			var selected sshkeys.Candidate
+			var err error
+			switch {
+			case keyFromDiscovery != "":
+				var keys []sshkeys.Candidate
+				if keys, err = discoverKeys(); err == nil {
+					selected, err = sshkeys.Select(keys, keyFromDiscovery)
+				}
+				if err != nil {
+					return a.fail(opts, fmt.Errorf("--key-from-discovery: %w", err))
+				}
+			case *noPrompt:
+				return a.fail(opts, usageError(errors.New("--key, --agent or --key-from-discovery is required when --no-prompt is used")))
+			default:
+				if selected, err = a.selectSSHKeyInteractively(host, owner); err != nil {
+					return a.fail(opts, err)
+				}
+			}
+			if selected.Source == sshkeys.SourceAgent {
+				agent = selected.Fingerprint
+			} else {
+				key = selected.Path
+			}
 		}
-		if err := cfg.AddRule(config.Rule{
+		rule := config.Rule{
 			ID:       id,
 			Host:     host,
 			Owner:    owner,
+			Remote:   remote,
 			Key:      key,
+			Agent:    agent,
 			Priority: priority,
-		}, *force); err != nil {
-			a.printErr(err)
-			return 1
+
+			SecurityKeyProvider:   skProvider,
+			StrictHostKeyChecking: strictHostKeys,
+			KnownHostsFile:        knownHostsFile,
+			SigningKey:            signingKey,
+			SigningFormat:         signingFormat,
+			Email:                 email,
+
+			Description: description,
+			Tags:        config.ParseTags(tags),
+
+			HTTPSUser:        httpsUser,
+			CredentialHelper: credentialHelper,
+		}
+		var keyWarning string
+		path, err := a.updateConfig(opts, func(cfg *config.Config) error {
+			if canonical, ok := cfg.CanonicalHost(rule.Host); ok && hostFromURL {
+				a.infof(opts, "Host alias %s maps to %s; the rule uses %s\n", rule.Host, canonical, canonical)
+				rule.Host = canonical
+			}
+			if level, msg := config.RuleKeyTypeIssue(cfg, rule); level == "warning" {
+				keyWarning = msg
+			}
+			return config.AddRule(cfg, rule, *force)
+		})
+		if err != nil {
+			return a.fail(opts, err)
+		}
+		if keyWarning != "" {
+			fmt.Fprintf(a.stderr, "warn: %s\n", keyWarning)
 		}
-		if err := config.Save(path, cfg); err != nil {
-			a.printErr(err)
-			return 1
+		host = rule.Host
+		switch {
+		case strings.TrimSpace(agent) != "":
+			a.infof(opts, "Rule added: host=%s owner=%s agent=%s\n", host, owner, agent)
+		case strings.TrimSpace(key) != "":
+			a.infof(opts, "Rule added: host=%s owner=%s key=%s\n", host, owner, key)
+		default:
+			a.infof(opts, "Rule added: host=%s owner=%s (HTTPS only)\n", host, owner)
 		}
-		fmt.Fprintf(a.stdout, "Rule added: host=%s owner=%s key=%s\n", host, owner, key)
-		fmt.Fprintf(a.stdout, "Saved to %s\n", path)
+		a.infof(opts, "Saved to %s\n", path)
 		return 0
+	case "manage":
+		return a.handleRuleManage(ctx, opts, args[1:])
 	case "remove":
 		fs := flag.NewFlagSet("mgit rule remove", flag.ContinueOnError)
 		fs.SetOutput(io.Discard)
@@ -322,27 +1050,51 @@ func (a *App) handleRule(ctx context.Context, opts globalOptions, args []string)
 		fs.StringVar(&sel.Key, "key", "", "")
 		fs.IntVar(&sel.Index, "index", 0, "")
 		if err := fs.Parse(args[1:]); err != nil {
-			a.printErr(err)
-			return 2
+			return a.fail(opts, usageError(err))
 		}
 		if sel.Owner == "" {
 			sel.Owner = namespace
 		}
 		cfg, path, err := a.loadConfig(opts)
 		if err != nil {
-			a.printErr(err)
-			return 1
+			return a.fail(opts, err)
+		}
+		removed, ok := config.RemoveRule(cfg, sel)
+		if !ok {
+			err := errors.New("rule not found")
+			if sel.ID != "" {
+				ids := make([]string, 0, len(cfg.Rules))
+				for _, r := range cfg.Rules {
+					ids = append(ids, r.ID)
+				}
+				if hint := suggest(sel.ID, ids); hint != "" {
+					err = fmt.Errorf("%w\nDid you mean --id %s?", err, hint)
+				}
+			}
+			return a.fail(opts, err)
+		}
+		if opts.DryRun {
+			fmt.Fprintf(a.stdout, "Dry run: would remove rule id=%s host=%s owner=%s %s from %s\n", removed.ID, removed.Host, removed.Owner, ruleKeyField(removed), path)
+			return 0
+		}
+		ok, err = a.confirm(opts, fmt.Sprintf("This will remove rule id=%s host=%s owner=%s %s from %s.", removed.ID, removed.Host, removed.Owner, ruleKeyField(removed), path))
+		if err != nil {
+			return a.fail(opts, err)
 		}
-		removed, ok := cfg.RemoveRule(sel)
 		if !ok {
-			a.printErr(errors.New("rule not found"))
-			return 1
+			return a.fail(opts, errAborted)
 		}
-		if err := config.Save(path, cfg); err != nil {
-			a.printErr(err)
-			return 1
+		// Remove by id under the lock: the file may have changed while the
+		// confirmation prompt was open.
+		if _, err := a.updateConfig(opts, func(cfg *config.Config) error {
+			if _, ok := config.RemoveRule(cfg, config.RemoveSelector{ID: removed.ID}); !ok {
+				return fmt.Errorf("rule %s was removed concurrently", removed.ID)
+			}
+			return nil
+		}); err != nil {
+			return a.fail(opts, err)
 		}
-		fmt.Fprintf(a.stdout, "Removed rule id=%s host=%s owner=%s\n", removed.ID, removed.Host, removed.Owner)
+		a.infof(opts, "Removed rule id=%s host=%s owner=%s\n", removed.ID, removed.Host, removed.Owner)
 		return 0
 	default:
 		a.printRuleUsage()
@@ -350,35 +1102,78 @@ func (a *App) handleRule(ctx context.Context, opts globalOptions, args []string)
 	}
 }
 
+// ruleKeyField renders a rule's identity as key=... or agent=....
+func ruleKeyField(r config.Rule) string {
+	if r.UsesAgent() {
+		return "agent=" + r.Agent
+	}
+	return "key=" + r.Key
+}
+
 func (a *App) handleResolve(ctx context.Context, opts globalOptions, args []string) int {
 	fs := flag.NewFlagSet("mgit resolve", flag.ContinueOnError)
 	fs.SetOutput(io.Discard)
 	var remoteName, rawURL string
 	fs.StringVar(&remoteName, "remote", "", "")
 	fs.StringVar(&rawURL, "url", "", "")
+	explain := fs.Bool("explain", false, "")
+	push := fs.Bool("push", false, "")
+	submodules := fs.Bool("submodules", false, "")
+	target := fs.String("target", "", "")
+	port := fs.String("port", "", "")
+	command := fs.String("command", "", "")
+	sshCommandOnly := fs.Bool("ssh-command", false, "")
 	if err := fs.Parse(args); err != nil {
-		a.printErr(err)
-		return 2
+		return a.fail(opts, usageError(err))
+	}
+	if (*port != "" || *command != "") && *target == "" {
+		return a.fail(opts, usageError(errors.New("--port and --command need --target")))
+	}
+	if *target != "" {
+		if remoteName != "" || rawURL != "" || *submodules {
+			return a.fail(opts, usageError(errors.New("--target cannot be combined with --remote, --url or --submodules")))
+		}
+		u, err := a.targetURL(ctx, opts, *target, *port, *command)
+		if err != nil {
+			return a.fail(opts, err)
+		}
+		rawURL = u
+	}
+	if *submodules {
+		if remoteName != "" || rawURL != "" || *explain {
+			return a.fail(opts, usageError(errors.New("--submodules cannot be combined with --remote, --url or --explain")))
+		}
+		return a.resolveSubmodules(ctx, opts)
 	}
 	if remoteName == "" && rawURL == "" {
-		a.printErr(errors.New("specify --remote <name> or --url <remote-url>"))
-		return 2
+		return a.fail(opts, usageError(errors.New("specify --remote <name> or --url <remote-url>")))
 	}
 	if remoteName != "" && rawURL != "" {
-		a.printErr(errors.New("use only one of --remote or --url"))
-		return 2
+		return a.fail(opts, usageError(errors.New("use only one of --remote or --url")))
+	}
+	if *push && remoteName == "" {
+		return a.fail(opts, usageError(errors.New("--push needs --remote")))
 	}
 
 	var source string
 	if remoteName != "" {
-		git := runner.NewGitOps(a.newShell(opts))
+		git := a.gitOps(opts, a.newShell(opts))
+		git.ReadConfigFiles = true
 		u, err := git.RemoteURL(ctx, remoteName)
+		source = "remote:" + remoteName
+		if *push {
+			var urls []string
+			if urls, err = git.PushURLs(ctx, remoteName); err == nil && len(urls) > 0 {
+				u = urls[0]
+			}
+			source += " (push)"
+		}
 		if err != nil {
-			a.printErr(fmt.Errorf("failed to get URL for remote %q: %w", remoteName, err))
-			return 1
+			return a.fail(opts, remoteURLError(ctx, git, remoteName, err))
 		}
 		rawURL = u
-		source = "remote:" + remoteName
+	} else if *target != "" {
+		source = "target:" + *target
 	} else {
 		source = "url"
 	}
@@ -387,37 +1182,102 @@ func (a *App) handleResolve(ctx context.Context, opts globalOptions, args []stri
 	if err != nil {
 		// Resolve still works for HTTPS without config, but for simplicity parse first and branch.
 		if rawURL == "" {
-			a.printErr(err)
-			return 1
+			return a.fail(opts, err)
 		}
-		res, parseErr := resolve.FromURL(nil, rawURL)
+		res, parseErr := resolve.FromRemote(nil, remoteName, rawURL)
 		if parseErr == nil && !res.SSHSelectionApplies {
-			a.printResolveResult(source, remoteName, res, opts)
+			a.printResolveResult(source, remoteName, res, nil, opts)
 			return 0
 		}
-		a.printErr(err)
-		return 1
+		return a.fail(opts, err)
+	}
+	var candidates []matcher.Candidate
+	if *explain {
+		if candidates, err = resolve.Candidates(cfg, remoteName, rawURL); err != nil {
+			return a.fail(opts, err)
+		}
 	}
-	res, err := resolve.FromURL(cfg, rawURL)
+	res, err := resolve.FromRemote(cfg, remoteName, rawURL)
 	if err != nil {
-		a.printErr(err)
-		return 1
+		if *explain {
+			if opts.Output.Structured() {
+				a.printData(opts, map[string]any{"source": source, "url": rawURL, "candidates": candidates, "error": err.Error()})
+			} else {
+				a.printCandidates(candidates)
+			}
+		}
+		return a.fail(opts, err)
 	}
-	a.printResolveResult(source, remoteName, res, opts)
+	if *sshCommandOnly {
+		switch {
+		case !res.SSHSelectionApplies:
+			return a.fail(opts, fmt.Errorf("%s is not an SSH remote; no key applies", rawURL))
+		case res.KeyProvider != "":
+			return a.fail(opts, fmt.Errorf("the key for %s is fetched from %s per command; run git through mgit for it", rawURL, res.KeyProvider))
+		}
+		fmt.Fprintln(a.stdout, res.GITSSHCommand)
+		return 0
+	}
+	a.printResolveResult(source, remoteName, res, candidates, opts)
 	return 0
 }
 
+// printCandidates renders resolve --explain: every rule with its score, or
+// why it was skipped or lost.
+func (a *App) printCandidates(candidates []matcher.Candidate) {
+	if len(candidates) == 0 {
+		fmt.Fprintln(a.stdout, "No rules configured")
+		return
+	}
+	tw := tabwriter.NewWriter(a.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "#\tID\tHOST\tOWNER\tREMOTE\tPRIORITY\tSCORE\tRESULT")
+	for _, c := range candidates {
+		score, result := "-", c.Reason
+		if c.Matched {
+			score = strconv.Itoa(c.Score)
+		}
+		if c.Selected {
+			result = "selected"
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%d\t%s\t%s\n", c.Index+1, c.ID, c.Host, c.Owner, dash(c.Remote), c.Priority, score, result)
+	}
+	_ = tw.Flush()
+}
+
 func (a *App) handleExec(ctx context.Context, opts globalOptions, gitArgs []string) int {
 	if len(gitArgs) == 0 {
-		a.printErr(errors.New("missing git arguments; use e.g. `mgit push origin main`"))
-		return 2
+		return a.fail(opts, usageError(errors.New("missing git arguments; use e.g. `mgit push origin main`")))
+	}
+	// Without a config git runs unchecked, but one that exists and does not
+	// load may hold a policy, so nothing runs.
+	cfg, _, cfgErr := a.loadConfig(opts)
+	if errors.Is(cfgErr, fs.ErrNotExist) {
+		cfg = nil
+	} else if cfgErr != nil {
+		return a.fail(opts, cfgErr)
 	}
 
-	git := runner.NewGitOps(a.newShell(opts))
-	target, err := runner.InferGitTarget(gitArgs)
+	git := a.gitOps(opts, a.newShell(opts))
+	inferArgs := gitArgs
+	if cfg != nil && config.HasGitPolicy(cfg) {
+		checked, err := config.ExpandGitAliases(gitArgs, func(name string) string {
+			return git.ConfigValue(ctx, "alias."+name)
+		})
+		if err == nil {
+			err = config.CheckGitCommand(cfg, checked)
+		}
+		if err != nil {
+			return a.fail(opts, withExitCode(exitPolicy, err))
+		}
+		// Policy entries name git subcommands, so the destination is
+		// checked for what an alias runs.
+		if i := config.GitSubcommandIndex(checked); i >= 0 {
+			inferArgs = checked[i:]
+		}
+	}
+	target, err := runner.InferGitTarget(inferArgs)
 	if err != nil {
-		a.printErr(err)
-		return 2
+		return a.fail(opts, usageError(err))
 	}
 	notes := []string{}
 	if target.Notes != "" {
@@ -433,7 +1293,11 @@ func (a *App) handleExec(ctx context.Context, opts globalOptions, gitArgs []stri
 		remoteName = target.RemoteName
 	case runner.TargetNone:
 		if target.Command == "push" || target.Command == "fetch" || target.Command == "pull" {
-			guessed, guessErr := git.GuessDefaultRemote(ctx)
+			guess := git.GuessDefaultRemote
+			if target.Command == "push" {
+				guess = git.DefaultPushRemote
+			}
+			guessed, guessErr := guess(ctx)
 			if guessErr == nil {
 				remoteName = guessed
 				target.Kind = runner.TargetRemote
@@ -442,135 +1306,500 @@ func (a *App) handleExec(ctx context.Context, opts globalOptions, gitArgs []stri
 			}
 		}
 	}
-	if remoteName != "" {
+	// A push goes to every push URL of the remote; the key is resolved for
+	// the first and checked against the others below.
+	var pushURLs []string
+	if remoteName != "" && target.Command == "push" {
+		if pushURLs, err = git.PushURLs(ctx, remoteName); err == nil && len(pushURLs) == 0 {
+			err = fmt.Errorf("remote %q has no URL", remoteName)
+		}
+		if err != nil {
+			return a.fail(opts, remoteURLError(ctx, git, remoteName, err))
+		}
+		rawURL = pushURLs[0]
+	} else if remoteName != "" {
 		u, err := git.RemoteURL(ctx, remoteName)
 		if err != nil {
-			a.printErr(fmt.Errorf("failed to get URL for remote %q: %w", remoteName, err))
-			return 1
+			return a.fail(opts, remoteURLError(ctx, git, remoteName, err))
 		}
 		rawURL = u
 	}
 
+	if cfg != nil {
+		destinations := pushURLs
+		if len(destinations) == 0 && rawURL != "" {
+			destinations = []string{rawURL}
+		}
+		if err := checkPolicy(cfg, remoteName, target.Command, destinations); err != nil {
+			return a.fail(opts, err)
+		}
+	}
+
+	if runner.CreatesSignedObjects(target.Command) {
+		signing, note := a.signingArgs(ctx, opts, git, remoteName, rawURL)
+		gitArgs = append(signing, gitArgs...)
+		if note != "" {
+			notes = append(notes, note)
+		}
+	}
+
 	extraEnv := map[string]string{}
+	ruleEnv, note := a.ruleEnv(opts, remoteName, rawURL)
+	if len(ruleEnv) > 0 {
+		maps.Copy(extraEnv, ruleEnv)
+		notes = append(notes, note)
+	}
 	var res *resolve.Result
+	ruleSSH := false // whether GIT_SSH_COMMAND comes from the rule
 	if rawURL != "" && !target.SkipSSHSelection {
-		// Load config lazily; HTTPS remotes can proceed without it.
-		cfg, _, cfgErr := a.loadConfig(opts)
-		if cfgErr != nil {
-			if strings.Contains(rawURL, "://") && strings.HasPrefix(strings.ToLower(rawURL), "https://") {
-				notes = append(notes, "config not loaded, but remote uses HTTPS so SSH rule selection is skipped")
-			} else {
-				a.printErr(cfgErr)
-				return 1
-			}
-		}
-		res, err = resolve.FromURL(cfg, rawURL)
+		var resNotes []string
+		res, resNotes, err = a.resolveRemote(opts, remoteName, rawURL)
 		if err != nil {
-			a.printErr(err)
-			return 1
+			return a.fail(opts, err)
 		}
 		if res.SSHSelectionApplies {
-			extraEnv["GIT_SSH_COMMAND"] = res.GITSSHCommand
+			apply, note, warning, err := a.reconcileSSHCommand(ctx, opts, cfg, git, res)
+			if err != nil {
+				return a.fail(opts, err)
+			}
+			if apply {
+				ruleSSH = true
+				extraEnv["GIT_SSH_COMMAND"] = res.GITSSHCommand
+			}
+			if note != "" {
+				notes = append(notes, note)
+			}
+			if warning != "" {
+				notes = append(notes, warning)
+				if !opts.DryRun {
+					fmt.Fprintf(a.stderr, "warn: %s\n", warning)
+				}
+			}
+		}
+		gitArgs = append(resolve.GitConfigArgs(res.GitConfig), gitArgs...)
+		notes = append(notes, resNotes...)
+		if len(pushURLs) > 1 {
+			gitConfig, warning := a.resolvePushURLs(opts, remoteName, pushURLs, res)
+			gitArgs = append(resolve.GitConfigArgs(gitConfig), gitArgs...)
+			if warning != "" {
+				notes = append(notes, warning)
+				if !opts.DryRun {
+					fmt.Fprintf(a.stderr, "warn: %s\n", warning)
+				}
+			}
 		}
-		notes = append(notes, res.Notes...)
 	} else if rawURL != "" && target.SkipSSHSelection {
 		// No SSH override needed for this command (e.g. remote set-url).
 	}
 
+	if _, ok := extraEnv["GIT_SSH_COMMAND"]; ok && !git.Capabilities(ctx).SSHCommand {
+		notes = append(notes, "this git predates GIT_SSH_COMMAND; it is passed to git as a GIT_SSH wrapper script")
+	}
+
+	if git.UsesGoGit() {
+		notes = append(notes, "git is run in process by the go-git backend")
+		dropped, err := goGitDropped(gitArgs, ruleEnv)
+		if err != nil {
+			return a.fail(opts, err)
+		}
+		if len(dropped) > 0 {
+			warning := fmt.Sprintf("the go-git backend does not apply %s; use the git binary for them", strings.Join(dropped, ", "))
+			notes = append(notes, warning)
+			if !opts.DryRun {
+				fmt.Fprintf(a.stderr, "warn: %s\n", warning)
+			}
+		}
+	}
 	if opts.DryRun {
+		repro := runner.ReproCommand(opts.Dir, extraEnv, gitArgs)
 		payload := map[string]any{
-			"gitArgs":   gitArgs,
-			"target":    target,
-			"remoteURL": rawURL,
-			"env":       extraEnv,
-			"notes":     notes,
+			"gitArgs":      gitArgs,
+			"target":       target,
+			"remoteURL":    rawURL,
+			"env":          extraEnv,
+			"reproCommand": repro,
+			"notes":        notes,
+		}
+		if len(pushURLs) > 1 {
+			payload["pushURLs"] = pushURLs
 		}
 		if res != nil {
-			payload["resolution"] = res
+			payload["resolution"] = redactResult(opts, res)
 		}
-		if opts.JSON {
-			_ = ui.PrintJSON(a.stdout, payload)
+		if opts.Output.Structured() {
+			a.printData(opts, payload)
 		} else {
 			fmt.Fprintf(a.stdout, "Dry run: git %s\n", strings.Join(gitArgs, " "))
 			if rawURL != "" {
 				fmt.Fprintf(a.stdout, "Resolved URL: %s\n", rawURL)
 			}
+			for _, u := range pushURLs[min(1, len(pushURLs)):] {
+				fmt.Fprintf(a.stdout, "Also pushes to: %s\n", u)
+			}
 			if target.Kind == runner.TargetRemote {
 				fmt.Fprintf(a.stdout, "Remote: %s\n", target.RemoteName)
 			}
 			if len(extraEnv) > 0 {
-				for k, v := range extraEnv {
-					fmt.Fprintf(a.stdout, "%s=%s\n", k, v)
+				for _, k := range slices.Sorted(maps.Keys(extraEnv)) {
+					fmt.Fprintf(a.stdout, "%s=%s\n", k, extraEnv[k])
 				}
 			} else {
 				fmt.Fprintln(a.stdout, "No SSH env override will be applied")
 			}
+			fmt.Fprintf(a.stdout, "Command: %s\n", repro)
 			for _, n := range notes {
-				fmt.Fprintf(a.stdout, "Note: %s\n", n)
+				a.infof(opts, "Note: %s\n", n)
 			}
 		}
 		return 0
 	}
 
-	if err := git.RunGit(ctx, gitArgs, extraEnv); err != nil {
-		a.printErr(err)
-		return 1
+	if ruleSSH {
+		if err := res.CheckKey(); err != nil {
+			return a.fail(opts, err)
+		}
+		env, err := a.passphraseEnv(opts, res)
+		if err != nil {
+			return a.fail(opts, err)
+		}
+		maps.Copy(extraEnv, env)
+	}
+	if ruleSSH && res.KeyProvider != "" {
+		cleanup, err := res.MaterializeKey(ctx)
+		defer cleanup()
+		if err != nil {
+			return a.fail(opts, err)
+		}
+		extraEnv["GIT_SSH_COMMAND"] = res.GITSSHCommand
+	}
+	if target.Command == "push" && target.Kind == runner.TargetRemote {
+		if err := a.guardPush(ctx, opts, git, target.RemoteName); err != nil {
+			return a.fail(opts, err)
+		}
+	}
+	if ruleSSH && git.UsesGoGit() {
+		var ignored []string
+		git.Identity, ignored = goGitIdentity(res)
+		if len(ignored) > 0 {
+			fmt.Fprintf(a.stderr, "warn: the go-git backend does not apply ssh options (%s); use the git binary for them\n", strings.Join(ignored, ", "))
+		}
+	}
+	retries := 0
+	if runner.RetryableCommand(target.Command) {
+		retries = a.retries(opts)
+	}
+	err = git.RunGitRetry(ctx, gitArgs, extraEnv, retries, func(attempt, attempts int, wait time.Duration, reason string) {
+		fmt.Fprintf(a.stderr, "Retrying in %s (attempt %d/%d) after: %s\n", wait, attempt, attempts, reason)
+	})
+	a.recordUsage(opts, res)
+	if code, ok := exitErrorCode(err); ok {
+		err = withExitCode(code, err)
+	}
+	if err != nil {
+		return a.fail(opts, err)
+	}
+	return 0
+}
+
+// goGitDropped lists what the go-git backend leaves out of a git run: the
+// -c settings in front of gitArgs, such as signing config, and env, the
+// rule's environment. HTTPS credential settings choose the account git
+// logs in as, so losing them is an error rather than a warning.
+func goGitDropped(gitArgs []string, env map[string]string) ([]string, error) {
+	var dropped, creds []string
+	for len(gitArgs) > 1 && gitArgs[0] == "-c" {
+		key, _, _ := strings.Cut(gitArgs[1], "=")
+		if strings.HasPrefix(strings.ToLower(key), "credential.") {
+			creds = append(creds, key)
+		} else {
+			dropped = append(dropped, "-c "+key)
+		}
+		gitArgs = gitArgs[2:]
+	}
+	if len(creds) > 0 {
+		return nil, fmt.Errorf("the go-git backend cannot apply the HTTPS credential settings %s; install git or use --backend git", strings.Join(creds, ", "))
+	}
+	for _, name := range slices.Sorted(maps.Keys(env)) {
+		dropped = append(dropped, "env "+name)
+	}
+	return dropped, nil
+}
+
+// goGitIdentity is the SSH identity of res for the go-git backend: the
+// rule's key file, or ssh-agent for agent rules, the known_hosts files ssh
+// would check, mgit's own included, and the rule's StrictHostKeyChecking.
+// It also returns the ssh options of res go-git cannot apply.
+func goGitIdentity(res *resolve.Result) (*runner.SSHIdentity, []string) {
+	var ignored []string
+	for _, o := range res.SSHOptions {
+		// known_hosts checking is go-git's own, with the rule's file below.
+		if !strings.HasPrefix(o, "StrictHostKeyChecking=") && !strings.HasPrefix(o, "UserKnownHostsFile=") {
+			ignored = append(ignored, o)
+		}
+	}
+	// For agent rules KeyPath is the identity's public key, so only that
+	// identity is offered.
+	id := &runner.SSHIdentity{KeyPath: res.KeyPath, KnownHostsFiles: config.KnownHostsFiles()}
+	if r := res.MatchedRule; r != nil {
+		id.StrictHostKeyChecking = r.EffectiveStrictHostKeyChecking()
+		// As with ssh, the rule's file replaces every other.
+		if r.KnownHostsFile != "" {
+			if path, err := config.ExpandPath(r.KnownHostsFile); err == nil {
+				id.KnownHostsFiles = []string{path}
+			}
+		}
+	}
+	return id, ignored
+}
+
+// retries is --retry, or the config's retry when the flag is not given.
+func (a *App) retries(opts globalOptions) int {
+	if opts.Retry >= 0 {
+		return opts.Retry
+	}
+	if cfg, _, err := a.loadConfig(opts); err == nil {
+		return cfg.Retry
 	}
 	return 0
 }
 
+// resolveRemote resolves the rule for rawURL, read from the git remote named
+// remote (empty for a plain URL), with the config that applies to
+// opts.Dir. The config is loaded lazily: HTTPS remotes can proceed without it.
+func (a *App) resolveRemote(opts globalOptions, remote, rawURL string) (*resolve.Result, []string, error) {
+	var notes []string
+	cfg, _, cfgErr := a.loadConfig(opts)
+	if cfgErr != nil {
+		if strings.Contains(rawURL, "://") && strings.HasPrefix(strings.ToLower(rawURL), "https://") {
+			notes = append(notes, "config not loaded, but remote uses HTTPS so SSH rule selection is skipped")
+		} else {
+			return nil, nil, cfgErr
+		}
+	}
+	res, err := resolve.FromRemote(cfg, remote, rawURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	sshVerbose(opts, res)
+	return res, append(notes, res.Notes...), nil
+}
+
+// sshVerbose applies --ssh-verbose to the ssh client of res.
+func sshVerbose(opts globalOptions, res *resolve.Result) {
+	if opts.SSHVerbose == 0 || !res.SSHSelectionApplies {
+		return
+	}
+	res.SSHClient = res.SSHClient.Verbose(opts.SSHVerbose)
+	res.GITSSHCommand = res.SSHClient.Command(res.KeyPath, res.SSHOptions...)
+}
+
+// resolvePushURLs resolves the push URLs of remote after the first, whose
+// result is first. HTTPS credential settings are scoped to their URL, so all
+// of them are returned to pass to git; SSH is one GIT_SSH_COMMAND for the
+// whole push, so it warns when the SSH URLs need different keys.
+func (a *App) resolvePushURLs(opts globalOptions, remote string, urls []string, first *resolve.Result) ([]string, string) {
+	var gitConfig, conflicts []string
+	for _, u := range urls[1:] {
+		res, _, err := a.resolveRemote(opts, remote, u)
+		switch {
+		case err != nil:
+			conflicts = append(conflicts, fmt.Sprintf("%s: %v", u, err))
+		case res.SSHSelectionApplies && (!first.SSHSelectionApplies || res.GITSSHCommand != first.GITSSHCommand):
+			conflicts = append(conflicts, fmt.Sprintf("%s needs key %s", u, res.KeyPath))
+		default:
+			gitConfig = append(gitConfig, res.GitConfig...)
+		}
+	}
+	if len(conflicts) == 0 {
+		return gitConfig, ""
+	}
+	key := "no key"
+	if first.SSHSelectionApplies {
+		key = "key " + first.KeyPath
+	}
+	return gitConfig, fmt.Sprintf("remote %s has push URLs that one GIT_SSH_COMMAND cannot serve: %s uses %s, but %s; push to those URLs separately", remote, urls[0], key, strings.Join(conflicts, ", "))
+}
+
+// signingArgs resolves the signing identity for commit-creating commands. It
+// never fails the command: without a config, remote or matching rule, git's own
+// signing settings apply unchanged.
+func (a *App) signingArgs(ctx context.Context, opts globalOptions, git *runner.GitOps, remote, rawURL string) ([]string, string) {
+	cfg, _, err := a.loadConfig(opts)
+	if err != nil {
+		return nil, ""
+	}
+	if rawURL == "" {
+		if remote, err = git.GuessDefaultRemote(ctx); err != nil {
+			return nil, ""
+		}
+		if rawURL, err = git.RemoteURL(ctx, remote); err != nil {
+			return nil, ""
+		}
+	}
+	rule, err := resolve.RuleForRemote(cfg, remote, rawURL)
+	if err != nil || rule.SigningKey == "" {
+		return nil, ""
+	}
+	args, err := resolve.SigningArgs(*rule)
+	if err != nil {
+		return nil, err.Error()
+	}
+	return args, fmt.Sprintf("signing identity from rule %s: %s (%s)", rule.ID, rule.SigningKey, rule.EffectiveSigningFormat())
+}
+
+// ruleEnv returns the env of the rule for rawURL. Like signing, it applies to
+// HTTPS remotes too, where proxies and CA bundles matter most.
+func (a *App) ruleEnv(opts globalOptions, remote, rawURL string) (map[string]string, string) {
+	if rawURL == "" {
+		return nil, ""
+	}
+	cfg, _, err := a.loadConfig(opts)
+	if err != nil {
+		return nil, ""
+	}
+	rule, err := resolve.RuleForRemote(cfg, remote, rawURL)
+	if err != nil || len(rule.Env) == 0 {
+		return nil, ""
+	}
+	return rule.Env, fmt.Sprintf("environment from rule %s: %s", rule.ID, strings.Join(slices.Sorted(maps.Keys(rule.Env)), ", "))
+}
+
 func (a *App) handleDoctor(ctx context.Context, opts globalOptions, args []string) int {
 	fs := flag.NewFlagSet("mgit doctor", flag.ContinueOnError)
 	fs.SetOutput(io.Discard)
+	connect := fs.Bool("connect", false, "")
+	coverage := fs.Bool("coverage", false, "")
+	useWorkspace := fs.Bool("workspace", false, "")
+	scan := fs.String("scan", "", "")
+	emitFixes := fs.String("emit-fixes", "", "")
+	var repos []string
+	fs.Func("repo", "", func(v string) error {
+		repos = append(repos, v)
+		return nil
+	})
 	if err := fs.Parse(args); err != nil {
-		a.printErr(err)
-		return 2
+		return a.fail(opts, usageError(err))
+	}
+	if *emitFixes != "" && *coverage {
+		return a.fail(opts, usageError(errors.New("--emit-fixes cannot be combined with --coverage")))
+	}
+	if (*useWorkspace || *scan != "") && !*coverage {
+		return a.fail(opts, usageError(errors.New("--workspace and --scan only apply to --coverage")))
+	}
+	if *useWorkspace && *scan != "" {
+		return a.fail(opts, usageError(errors.New("use either --scan or --workspace")))
 	}
+	if *coverage {
+		if len(repos) > 0 {
+			return a.fail(opts, usageError(errors.New("--repo cannot be combined with --coverage; use --scan or --workspace")))
+		}
+		if *connect {
+			return a.fail(opts, usageError(errors.New("--coverage cannot be combined with --connect")))
+		}
+		return a.handleCoverage(ctx, opts, *useWorkspace, *scan)
+	}
+	if len(repos) > 0 {
+		return a.doctorRepos(ctx, opts, repos, *connect, *emitFixes)
+	}
+	rep, failed := a.doctorReport(ctx, opts, *connect)
+	if *emitFixes != "" {
+		if err := a.writeFixes(opts, *emitFixes, rep.Fixes()); err != nil {
+			return a.fail(opts, err)
+		}
+	}
+	switch {
+	case opts.Output.Structured():
+		a.printData(opts, rep)
+	case opts.Output == ui.FormatTable:
+		a.printDoctorTable(rep)
+	default:
+		a.printDoctorText(opts, rep)
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// repoDoctorReport is the doctor report of one --repo path.
+type repoDoctorReport struct {
+	Path string `json:"path"`
+	doctor.Report
+}
+
+// doctorRepos runs doctor in each of repos, as if started there, and prints
+// one section per path. The fixes of all of them go into one script.
+func (a *App) doctorRepos(ctx context.Context, opts globalOptions, repos []string, connect bool, emitFixes string) int {
+	reports := make([]repoDoctorReport, 0, len(repos))
+	var fixes []doctor.Fix
+	anyFailed := false
+	for _, repo := range repos {
+		// A relative --repo is taken from the -C directory.
+		if opts.Dir != "" && !filepath.IsAbs(repo) && !strings.HasPrefix(repo, "~") {
+			repo = filepath.Join(opts.Dir, repo)
+		}
+		dir, err := chdirTarget(repo)
+		if err != nil {
+			return a.fail(opts, usageError(fmt.Errorf("--repo: %w", err)))
+		}
+		repoOpts := opts
+		repoOpts.Dir = dir
+		rep, failed := a.doctorReport(ctx, repoOpts, connect)
+		reports = append(reports, repoDoctorReport{Path: dir, Report: rep})
+		fixes = append(fixes, rep.Fixes()...)
+		anyFailed = anyFailed || failed
+	}
+	if emitFixes != "" {
+		if err := a.writeFixes(opts, emitFixes, fixes); err != nil {
+			return a.fail(opts, err)
+		}
+	}
+	if opts.Output.Structured() {
+		a.printData(opts, map[string]any{"repos": reports})
+	} else {
+		for i, r := range reports {
+			if i > 0 {
+				fmt.Fprintln(a.stdout)
+			}
+			fmt.Fprintf(a.stdout, "== %s ==\n", r.Path)
+			if opts.Output == ui.FormatTable {
+				a.printDoctorTable(r.Report)
+			} else {
+				a.printDoctorText(opts, r.Report)
+			}
+		}
+	}
+	if anyFailed {
+		return 1
+	}
+	return 0
+}
+
+// doctorReport builds the doctor report for the repository of opts and
+// reports whether it has errors.
+func (a *App) doctorReport(ctx context.Context, opts globalOptions, connect bool) (doctor.Report, bool) {
 	var cfg *config.Config
-	cfgPath, _ := config.ResolvePath(opts.ConfigPath)
+	cfgPath, _ := a.configPath(opts)
 	cfgLoaded, _, cfgErr := a.tryLoadConfig(opts)
 	if cfgErr == nil {
 		cfg = cfgLoaded
 	}
 
-	git := runner.NewGitOps(a.newShell(opts))
-	rep := doctor.Build(ctx, git, cfg, cfgPath)
+	shell := a.newShell(opts)
+	shell.SerializeOutput()
+	rep := doctor.Build(ctx, a.gitOps(opts, shell), cfg, cfgPath)
 	if cfgErr != nil {
 		rep.Checks = append([]doctor.Check{{Name: "config-load", Status: "error", Message: cfgErr.Error()}}, rep.Checks...)
 	}
+	if cfg != nil && cfg.RemoteRules != "" {
+		rep.Checks = append(rep.Checks, a.remoteRulesCheck(opts, cfgPath, cfg))
+	}
+	if connect {
+		a.connectRemotes(ctx, opts, &rep)
+	}
 
-	if opts.JSON {
-		_ = ui.PrintJSON(a.stdout, rep)
-	} else {
-		fmt.Fprintf(a.stdout, "Config path: %s\n", rep.ConfigPath)
-		for _, c := range rep.Checks {
-			fmt.Fprintf(a.stdout, "[%s] %s: %s\n", strings.ToUpper(c.Status), c.Name, c.Message)
-		}
-		for _, issue := range rep.ConfigIssues {
-			field := issue.Field
-			if field != "" {
-				field = " (" + field + ")"
-			}
-			fmt.Fprintf(a.stdout, "[%s] config%s: %s\n", strings.ToUpper(issue.Level), field, issue.Message)
-		}
-		if len(rep.Remotes) > 0 {
-			fmt.Fprintln(a.stdout, "Remotes:")
-			for _, r := range rep.Remotes {
-				fmt.Fprintf(a.stdout, "  - %s => %s\n", r.Name, r.URL)
-				if r.Error != "" {
-					fmt.Fprintf(a.stdout, "    error: %s\n", r.Error)
-					continue
-				}
-				if r.Result != nil && r.Result.Parsed != nil {
-					fmt.Fprintf(a.stdout, "    parsed: host=%s owner=%s repo=%s transport=%s\n", r.Result.Parsed.Host, r.Result.Parsed.Owner, r.Result.Parsed.Repo, r.Result.Parsed.Transport)
-					if r.Result.MatchedRule != nil {
-						fmt.Fprintf(a.stdout, "    rule: id=%s key=%s\n", r.Result.MatchedRule.ID, r.Result.KeyPath)
-					} else {
-						fmt.Fprintln(a.stdout, "    rule: n/a (non-SSH remote)")
-					}
-				}
-			}
-		}
+	for i := range rep.Remotes {
+		rep.Remotes[i].Result = redactResult(opts, rep.Remotes[i].Result)
 	}
 
 	hasError := cfgErr != nil
@@ -582,10 +1811,53 @@ func (a *App) handleDoctor(ctx context.Context, opts globalOptions, args []strin
 	if len(rep.Unmatched) > 0 {
 		hasError = true
 	}
-	if hasError {
-		return 1
+	return rep, hasError
+}
+
+func (a *App) writeFixes(opts globalOptions, path string, fixes []doctor.Fix) error {
+	if err := os.WriteFile(path, []byte(doctor.FixScript(fixes, time.Now())), 0o600); err != nil {
+		return fmt.Errorf("write fixes: %w", err)
+	}
+	if !opts.Quiet {
+		fmt.Fprintf(a.stderr, "Wrote %d fix(es) to %s; review it, then run: sh %s\n", len(fixes), path, path)
+	}
+	return nil
+}
+
+func (a *App) printDoctorText(opts globalOptions, rep doctor.Report) {
+	color := a.color(opts)
+	fmt.Fprintf(a.stdout, "Config path: %s\n", config.DescribePath(rep.ConfigPath))
+	for _, c := range rep.Checks {
+		fmt.Fprintf(a.stdout, "[%s] %s: %s\n", color.Level(c.Status), c.Name, c.Message)
+	}
+	for _, issue := range rep.ConfigIssues {
+		field := issue.Field
+		if field != "" {
+			field = " (" + field + ")"
+		}
+		fmt.Fprintf(a.stdout, "[%s] config%s: %s\n", color.Level(issue.Level), field, issue.Message)
+	}
+	if len(rep.Remotes) > 0 {
+		fmt.Fprintln(a.stdout, "Remotes:")
+		for _, r := range rep.Remotes {
+			fmt.Fprintf(a.stdout, "  - %s => %s\n", r.Name, r.URL)
+			if r.Error != "" {
+				fmt.Fprintf(a.stdout, "    %s %s\n", color.Red("error:"), r.Error)
+				continue
+			}
+			if r.Warning != "" {
+				fmt.Fprintf(a.stdout, "    %s %s\n", color.Yellow("warning:"), r.Warning)
+			}
+			if r.Result != nil && r.Result.Parsed != nil {
+				fmt.Fprintf(a.stdout, "    parsed: host=%s owner=%s repo=%s transport=%s\n", r.Result.Parsed.Host, r.Result.Parsed.Owner, r.Result.Parsed.Repo, r.Result.Parsed.Transport)
+				if r.Result.MatchedRule != nil {
+					fmt.Fprintf(a.stdout, "    rule: id=%s key=%s\n", r.Result.MatchedRule.ID, r.Result.KeyPath)
+				} else {
+					fmt.Fprintln(a.stdout, "    rule: n/a (non-SSH remote)")
+				}
+			}
+		}
 	}
-	return 0
 }
 
 func (a *App) handleSSHTest(ctx context.Context, opts globalOptions, args []string) int {
@@ -593,72 +1865,106 @@ func (a *App) handleSSHTest(ctx context.Context, opts globalOptions, args []stri
 	fs.SetOutput(io.Discard)
 	var remoteName, rawURL string
 	localDryRun := fs.Bool("dry-run", false, "")
+	all := fs.Bool("all", false, "")
 	fs.StringVar(&remoteName, "remote", "", "")
 	fs.StringVar(&rawURL, "url", "", "")
 	if err := fs.Parse(args); err != nil {
-		a.printErr(err)
-		return 2
+		return a.fail(opts, usageError(err))
+	}
+	if *all {
+		if remoteName != "" || rawURL != "" {
+			return a.fail(opts, usageError(errors.New("--all cannot be combined with --remote or --url")))
+		}
+		if *localDryRun {
+			opts.DryRun = true
+		}
+		return a.handleSSHTestAll(ctx, opts)
 	}
 	if remoteName == "" && rawURL == "" {
-		a.printErr(errors.New("specify --remote <name> or --url <remote-url>"))
-		return 2
+		return a.fail(opts, usageError(errors.New("specify --remote <name>, --url <remote-url> or --all")))
 	}
 	if remoteName != "" && rawURL != "" {
-		a.printErr(errors.New("use only one of --remote or --url"))
-		return 2
+		return a.fail(opts, usageError(errors.New("use only one of --remote or --url")))
 	}
 
-	git := runner.NewGitOps(a.newShell(opts))
+	git := a.gitOps(opts, a.newShell(opts))
 	if remoteName != "" {
 		u, err := git.RemoteURL(ctx, remoteName)
 		if err != nil {
-			a.printErr(fmt.Errorf("failed to get URL for remote %q: %w", remoteName, err))
-			return 1
+			return a.fail(opts, remoteURLError(ctx, git, remoteName, err))
 		}
 		rawURL = u
 	}
 
 	cfg, _, err := a.loadConfig(opts)
 	if err != nil {
-		a.printErr(err)
-		return 1
+		return a.fail(opts, err)
 	}
-	res, err := resolve.FromURL(cfg, rawURL)
+	res, err := resolve.FromRemote(cfg, remoteName, rawURL)
 	if err != nil {
-		a.printErr(err)
-		return 1
+		return a.fail(opts, err)
 	}
 	if !res.SSHSelectionApplies || res.Parsed == nil {
-		a.printErr(errors.New("SSH test is only applicable for SSH remotes"))
-		return 1
+		return a.fail(opts, errors.New("SSH test is only applicable for SSH remotes"))
+	}
+	sshVerbose(opts, res)
+	dryRun := opts.DryRun || *localDryRun
+	if !dryRun {
+		if err := res.CheckKey(); err != nil {
+			return a.fail(opts, err)
+		}
 	}
-	sshArgs := []string{"-F", "/dev/null", "-i", res.KeyPath, "-o", "IdentitiesOnly=yes", "-o", "BatchMode=yes", "-T", res.Parsed.TargetUserHost()}
-	if opts.DryRun || *localDryRun {
-		if opts.JSON {
-			_ = ui.PrintJSON(a.stdout, map[string]any{
+	if !dryRun && res.KeyProvider != "" {
+		cleanup, err := res.MaterializeKey(ctx)
+		defer cleanup()
+		if err != nil {
+			return a.fail(opts, err)
+		}
+	}
+	sshArgs := sshTestArgs(res)
+	if res.SecurityKey {
+		fmt.Fprintln(a.stderr, "Security key detected: touch the device when it blinks.")
+	}
+	if res.KeyNeedsPassphrase {
+		fmt.Fprintf(a.stderr, "warn: %s\n", resolve.PassphraseWarning(res.KeyPath))
+	}
+	if dryRun {
+		if opts.Output.Structured() {
+			a.printData(opts, map[string]any{
 				"url":        rawURL,
-				"sshCommand": append([]string{"ssh"}, sshArgs...),
+				"sshCommand": append([]string{res.SSHClient.Name()}, sshArgs...),
 				"keyPath":    res.KeyPath,
 			})
+		} else if opts.Output == ui.FormatTable {
+			a.printFields([][2]string{
+				{"url", rawURL},
+				{"keyPath", res.KeyPath},
+				{"sshCommand", res.SSHClient.Name() + " " + strings.Join(sshArgs, " ")},
+			})
 		} else {
-			fmt.Fprintf(a.stdout, "Dry run: ssh %s\n", strings.Join(sshArgs, " "))
+			fmt.Fprintf(a.stdout, "Dry run: %s %s\n", res.SSHClient.Name(), strings.Join(sshArgs, " "))
 		}
 		return 0
 	}
-	if err := a.newShell(opts).Run(ctx, "ssh", sshArgs, nil); err != nil {
-		// For GitHub, "ssh -T git@github.com" returns exit code 1 even after successful auth.
-		if strings.EqualFold(res.Parsed.Host, "github.com") && hasExitCode(err, 1) {
-			return 0
-		}
-		a.printErr(err)
-		return 1
+	if err := a.newShell(opts).Run(ctx, res.SSHClient.Name(), sshArgs, nil); err != nil && !sshTestSucceeded(res, err) {
+		return a.fail(opts, withExitCode(exitSSH, err))
 	}
 	return 0
 }
 
 func hasExitCode(err error, code int) bool {
+	c, ok := exitErrorCode(err)
+	return ok && c == code
+}
+
+// exitErrorCode returns the exit code of a child process that ran and
+// failed.
+func exitErrorCode(err error) (int, bool) {
 	var exitErr *exec.ExitError
-	return errors.As(err, &exitErr) && exitErr.ExitCode() == code
+	if errors.As(err, &exitErr) && exitErr.ExitCode() > 0 {
+		return exitErr.ExitCode(), true
+	}
+	return 0, false
 }
 
 func (a *App) loadConfig(opts globalOptions) (*config.Config, string, error) {
@@ -666,19 +1972,34 @@ func (a *App) loadConfig(opts globalOptions) (*config.Config, string, error) {
 }
 
 func (a *App) tryLoadConfig(opts globalOptions) (*config.Config, string, error) {
-	path, err := config.ResolvePath(opts.ConfigPath)
+	path, err := a.configPath(opts)
 	if err != nil {
 		return nil, "", err
 	}
-	cfg, err := config.Load(path)
+	cfg, trusted, sigErr, err := config.LoadVerified(path)
+	if err == nil {
+		if err := a.allowUnverified(opts, sigErr); err != nil {
+			return nil, path, withExitCode(exitConfig, err)
+		}
+		if err := a.withRemoteRules(opts, path, cfg); err != nil {
+			return nil, path, withExitCode(exitConfig, err)
+		}
+		a.restrictConfig(opts, path, cfg, trusted)
+	}
+	if err == nil && opts.Strict {
+		cfg.Strict = true
+	}
+	if err != nil && config.IsEnvSource(path) {
+		return nil, path, withExitCode(exitConfig, err)
+	}
 	if err != nil {
-		return nil, path, fmt.Errorf("%w\nHint: initialize config with: mgit config init", err)
+		return nil, path, withExitCode(exitConfig, fmt.Errorf("%w\nHint: initialize config with: mgit config init", err))
 	}
 	return cfg, path, nil
 }
 
 func (a *App) loadOrCreateConfig(opts globalOptions) (*config.Config, string, error) {
-	path, err := config.ResolvePath(opts.ConfigPath)
+	path, err := a.configPath(opts)
 	if err != nil {
 		return nil, "", err
 	}
@@ -693,68 +2014,157 @@ func (a *App) loadOrCreateConfig(opts globalOptions) (*config.Config, string, er
 	if err := config.Save(path, cfg); err != nil {
 		return nil, path, fmt.Errorf("create config at %s: %w", path, err)
 	}
-	if changed, err := config.EnsureGitignoreExcludesMgit(path); err == nil && changed {
-		fmt.Fprintln(a.stdout, "Updated .gitignore: added .mgit")
-	} else if err != nil && opts.Verbose {
-		fmt.Fprintf(a.stderr, "warn: failed to update .gitignore: %v\n", err)
-	}
-	fmt.Fprintf(a.stdout, "Created config: %s\n", path)
+	a.announceCreatedConfig(opts, path)
 	return cfg, path, nil
 }
 
-func (a *App) selectSSHKeyInteractively(host, owner string) (string, error) {
+// updateConfig runs fn against the config under the config lock and saves
+// the result, creating the config when it doesn't exist yet.
+func (a *App) updateConfig(opts globalOptions, fn func(cfg *config.Config) error) (string, error) {
+	path, err := a.configPath(opts)
+	if err != nil {
+		return "", err
+	}
+	_, statErr := os.Stat(path)
+	if err := config.Update(path, fn); err != nil {
+		return path, err
+	}
+	if errors.Is(statErr, fs.ErrNotExist) {
+		a.announceCreatedConfig(opts, path)
+	}
+	return path, nil
+}
+
+func (a *App) announceCreatedConfig(opts globalOptions, path string) {
+	if mode, err := gitignoreMode(""); err != nil {
+		fmt.Fprintf(a.stderr, "warn: %v; leaving ignore files untouched\n", err)
+	} else {
+		a.excludeMgit(opts, path, mode)
+	}
+	a.infof(opts, "Created config: %s\n", path)
+}
+
+// gitignoreMode picks how a new repo-local config is kept out of git: the
+// --gitignore value, else MGIT_GITIGNORE, else the global config's
+// gitignore setting.
+func gitignoreMode(flagValue string) (config.IgnoreMode, error) {
+	if flagValue != "" {
+		return config.ParseIgnoreMode(flagValue)
+	}
+	if env := os.Getenv("MGIT_GITIGNORE"); env != "" {
+		mode, err := config.ParseIgnoreMode(env)
+		if err != nil {
+			return "", fmt.Errorf("MGIT_GITIGNORE: %w", err)
+		}
+		return mode, nil
+	}
+	if path, err := config.GlobalDefaultPath(); err == nil {
+		if cfg, err := config.Load(path); err == nil {
+			mode, err := config.ParseIgnoreMode(cfg.Gitignore)
+			if err != nil {
+				return "", fmt.Errorf("gitignore in %s: %w", path, err)
+			}
+			return mode, nil
+		}
+	}
+	return config.IgnoreGitignore, nil
+}
+
+// excludeMgit keeps the .mgit directory of a repo-local config out of git,
+// by .gitignore, .git/info/exclude or not at all depending on mode.
+func (a *App) excludeMgit(opts globalOptions, path string, mode config.IgnoreMode) {
+	file, err := config.ExcludeMgit(path, mode)
+	if err != nil {
+		if opts.Verbose {
+			fmt.Fprintf(a.stderr, "warn: failed to exclude .mgit from git: %v\n", err)
+		}
+		return
+	}
+	if file == "" {
+		return
+	}
+	if rel, err := filepath.Rel(filepath.Dir(filepath.Dir(path)), file); err == nil {
+		file = rel
+	}
+	a.infof(opts, "Updated %s: added .mgit\n", filepath.ToSlash(file))
+}
+
+func (a *App) selectSSHKeyInteractively(host, owner string) (sshkeys.Candidate, error) {
 	if !a.stdinIsTTY() {
-		return "", errors.New("no --key provided and interactive prompt is unavailable (stdin is not a TTY). Use --key <path> or run in a terminal")
+		return sshkeys.Candidate{}, errors.New("no --key provided and interactive prompt is unavailable (stdin is not a TTY). Use --key <path>, --key-from-discovery <index|glob>, MGIT_DEFAULT_KEY, or run in a terminal")
 	}
-	keys, err := sshkeys.DiscoverDefault()
+	keys, err := discoverKeys()
 	if err != nil {
-		return "", err
+		return sshkeys.Candidate{}, err
 	}
 	fmt.Fprintln(a.stdout, "Select SSH key for the new rule:")
 	fmt.Fprintf(a.stdout, "  host=%s\n", host)
 	fmt.Fprintf(a.stdout, "  owner=%s\n", owner)
 	if len(keys) == 0 {
-		fmt.Fprintln(a.stdout, "No SSH keys found in ~/.ssh.")
+		fmt.Fprintln(a.stdout, "No SSH keys found in ~/.ssh or ssh-agent.")
 		custom, err := a.promptLine("Enter key path (or leave empty to cancel): ")
 		if err != nil {
-			return "", err
+			return sshkeys.Candidate{}, err
 		}
 		custom = strings.TrimSpace(custom)
 		if custom == "" {
-			return "", errors.New("cancelled")
+			return sshkeys.Candidate{}, errors.New("cancelled")
 		}
-		return custom, nil
+		return sshkeys.Candidate{Path: custom, Source: sshkeys.SourceFile}, nil
 	}
 	items := make([]string, 0, len(keys))
 	for _, k := range keys {
-		label := k.Path
-		if k.HasPublicPair {
-			label += " (has .pub)"
-		}
-		items = append(items, label)
+		items = append(items, keyCandidateLabel(k))
 	}
 	res, err := a.pickOptionInteractive("Select SSH key:", items)
 	if err != nil {
-		return "", err
+		return sshkeys.Candidate{}, err
 	}
 	switch res.Kind {
 	case "index":
-		return keys[res.Index].Path, nil
+		return keys[res.Index], nil
 	case "custom":
 		custom, err := a.promptLine("Enter key path: ")
 		if err != nil {
-			return "", err
+			return sshkeys.Candidate{}, err
 		}
 		custom = strings.TrimSpace(custom)
 		if custom == "" {
-			return "", errors.New("cancelled")
+			return sshkeys.Candidate{}, errors.New("cancelled")
 		}
-		return custom, nil
+		return sshkeys.Candidate{Path: custom, Source: sshkeys.SourceFile}, nil
 	default:
-		return "", errors.New("cancelled")
+		return sshkeys.Candidate{}, errors.New("cancelled")
 	}
 }
 
+// discoverKeys lists the keys the interactive picker offers, in its order:
+// files in ~/.ssh, then ssh-agent identities without a file on disk.
+func discoverKeys() ([]sshkeys.Candidate, error) {
+	keys, err := sshkeys.DiscoverDefault()
+	if err != nil {
+		return nil, err
+	}
+	// Agent identities are optional: a missing or empty agent just means no extra choices.
+	if agentKeys, agentErr := sshkeys.DiscoverAgent(); agentErr == nil {
+		keys = sshkeys.MergeAgent(keys, agentKeys)
+	}
+	return keys, nil
+}
+
+func keyCandidateLabel(k sshkeys.Candidate) string {
+	if k.Source == sshkeys.SourceAgent {
+		return "agent: " + k.Summary()
+	}
+	label := k.Path
+	if summary := k.Summary(); summary != "" {
+		label += "  " + summary
+	} else if k.HasPublicPair {
+		label += " (has .pub)"
+	}
+	return label
+}
+
 func (a *App) promptLine(prompt string) (string, error) {
 	fmt.Fprint(a.stdout, prompt)
 	r := bufio.NewReader(a.stdin)
@@ -762,9 +2172,41 @@ func (a *App) promptLine(prompt string) (string, error) {
 	if err != nil && !errors.Is(err, io.EOF) {
 		return "", err
 	}
+	if errors.Is(err, io.EOF) && line == "" {
+		// Nothing left to read: retrying the prompt would loop forever.
+		return "", io.EOF
+	}
 	return strings.TrimRight(line, "\r\n"), nil
 }
 
+// confirm shows what a destructive command is about to change and asks
+// before going ahead. It only asks on a terminal: --yes and non-interactive
+// stdin (scripts, CI) proceed without a prompt. The prompt goes to stderr so
+// structured stdout stays parseable.
+func (a *App) confirm(opts globalOptions, changes ...string) (bool, error) {
+	if opts.Yes || !a.stdinIsTTY() {
+		return true, nil
+	}
+	for _, c := range changes {
+		fmt.Fprintln(a.stderr, c)
+	}
+	fmt.Fprint(a.stderr, "Proceed? [y/N]: ")
+	line, err := bufio.NewReader(a.stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return false, err
+	}
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "y", "yes":
+		return true, nil
+	}
+	return false, nil
+}
+
+var errAborted = errors.New("aborted")
+
+// errDryRun is returned from a config.Update callback to discard the change.
+var errDryRun = errors.New("dry run")
+
 func (a *App) stdinIsTTY() bool {
 	f, ok := a.stdin.(*os.File)
 	if !ok {
@@ -777,63 +2219,186 @@ func (a *App) stdinIsTTY() bool {
 	return (info.Mode() & os.ModeCharDevice) != 0
 }
 
-func (a *App) printResolveResult(source, remoteName string, res *resolve.Result, opts globalOptions) {
+func (a *App) printResolveResult(source, remoteName string, res *resolve.Result, candidates []matcher.Candidate, opts globalOptions) {
 	payload := map[string]any{
 		"source": source,
 		"url":    res.URL,
-		"result": res,
+		"result": redactResult(opts, res),
 	}
 	if remoteName != "" {
 		payload["remote"] = remoteName
 	}
-	if opts.JSON {
-		_ = ui.PrintJSON(a.stdout, payload)
+	if candidates != nil {
+		payload["candidates"] = candidates
+	}
+	if opts.Output.Structured() {
+		a.printData(opts, payload)
 		return
 	}
+	if opts.Output == ui.FormatTable {
+		rows := [][2]string{{"source", source}, {"remote", dash(remoteName)}, {"url", res.URL}}
+		if p := res.Parsed; p != nil {
+			rows = append(rows, [2]string{"host", p.Host}, [2]string{"owner", p.Owner}, [2]string{"repo", p.Repo}, [2]string{"transport", string(p.Transport)})
+		}
+		rule := "-"
+		if res.MatchedRule != nil {
+			rule = res.MatchedRule.ID
+		}
+		fallback := "no"
+		if res.Fallback {
+			fallback = "yes"
+		}
+		rows = append(rows, [2]string{"rule", rule}, [2]string{"fallback", fallback}, [2]string{"keyPath", dash(res.KeyPath)}, [2]string{"gitSshCommand", dash(res.GITSSHCommand)})
+		for _, kv := range res.GitConfig {
+			rows = append(rows, [2]string{"gitConfig", kv})
+		}
+		for _, n := range res.Notes {
+			rows = append(rows, [2]string{"note", n})
+		}
+		a.printFields(rows)
+		if candidates != nil {
+			fmt.Fprintln(a.stdout)
+			a.printCandidates(candidates)
+		}
+		return
+	}
+	c := a.color(opts)
 	fmt.Fprintf(a.stdout, "Source: %s\n", source)
 	fmt.Fprintf(a.stdout, "URL: %s\n", res.URL)
 	if res.Parsed != nil {
 		fmt.Fprintf(a.stdout, "Parsed: host=%s owner=%s repo=%s transport=%s\n", res.Parsed.Host, res.Parsed.Owner, res.Parsed.Repo, res.Parsed.Transport)
 	}
-	if res.MatchedRule != nil {
-		fmt.Fprintf(a.stdout, "Matched rule: id=%s host=%s owner=%s\n", res.MatchedRule.ID, res.MatchedRule.Host, res.MatchedRule.Owner)
+	if res.Fallback {
+		fmt.Fprintf(a.stdout, "Matched rule: %s (fallback used: defaultKey)\n", c.Yellow("none"))
 		fmt.Fprintf(a.stdout, "Key path: %s\n", res.KeyPath)
 		fmt.Fprintf(a.stdout, "GIT_SSH_COMMAND: %s\n", res.GITSSHCommand)
+	} else if res.MatchedRule != nil {
+		fmt.Fprintf(a.stdout, "Matched rule: %s host=%s owner=%s\n", c.Green("id="+res.MatchedRule.ID), res.MatchedRule.Host, res.MatchedRule.Owner)
+		if res.SSHSelectionApplies {
+			fmt.Fprintf(a.stdout, "Key path: %s\n", res.KeyPath)
+			fmt.Fprintf(a.stdout, "GIT_SSH_COMMAND: %s\n", res.GITSSHCommand)
+		}
+		for _, kv := range res.GitConfig {
+			fmt.Fprintf(a.stdout, "Git config: %s\n", kv)
+		}
 	} else {
-		fmt.Fprintln(a.stdout, "Matched rule: n/a")
+		fmt.Fprintf(a.stdout, "Matched rule: %s\n", c.Yellow("n/a"))
 	}
 	for _, n := range res.Notes {
-		fmt.Fprintf(a.stdout, "Note: %s\n", n)
+		a.infof(opts, "%s %s\n", c.Yellow("Note:"), n)
+	}
+	if candidates != nil {
+		fmt.Fprintln(a.stdout, "\nCandidates:")
+		a.printCandidates(candidates)
+	}
+}
+
+// printFields renders a single record as a two-column table for --output table.
+func (a *App) printFields(rows [][2]string) {
+	tw := tabwriter.NewWriter(a.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "FIELD\tVALUE")
+	for _, r := range rows {
+		fmt.Fprintf(tw, "%s\t%s\n", r[0], r[1])
 	}
+	_ = tw.Flush()
+}
+
+func (a *App) printDoctorTable(rep doctor.Report) {
+	tw := tabwriter.NewWriter(a.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CHECK\tSTATUS\tMESSAGE")
+	for _, c := range rep.Checks {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", c.Name, strings.ToUpper(c.Status), c.Message)
+	}
+	for _, issue := range rep.ConfigIssues {
+		fmt.Fprintf(tw, "config %s\t%s\t%s\n", dash(issue.Field), strings.ToUpper(issue.Level), issue.Message)
+	}
+	_ = tw.Flush()
+	if len(rep.Remotes) == 0 {
+		return
+	}
+	fmt.Fprintln(a.stdout)
+	tw = tabwriter.NewWriter(a.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "REMOTE\tURL\tRULE\tKEY\tPROBLEM")
+	for _, r := range rep.Remotes {
+		rule, key := "-", "-"
+		if r.Result != nil && r.Result.MatchedRule != nil {
+			rule, key = r.Result.MatchedRule.ID, r.Result.KeyPath
+		}
+		problem := r.Error
+		if problem == "" {
+			problem = r.Warning
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", r.Name, r.URL, rule, key, dash(problem))
+	}
+	_ = tw.Flush()
 }
 
 func (a *App) printUsage() {
 	fmt.Fprintln(a.stdout, "mgit - smart git wrapper with SSH key auto-selection by remote URL")
 	fmt.Fprintln(a.stdout)
 	fmt.Fprintln(a.stdout, "Usage:")
-	fmt.Fprintln(a.stdout, "  mgit [--config PATH] [--json] [--verbose] [--dry-run] <command> [args]")
+	fmt.Fprintln(a.stdout, "  mgit [-C DIR] [--config PATH] [--output json|jsonl|yaml|table|text] [--json] [--verbose] [--dry-run] [--no-color] [--quiet] [--yes] [--log-file PATH] [--timeout DURATION] [--retry N] [--strict] [--strict-env] [--insecure] [--ssh-verbose[=N]] [--backend auto|git|go-git] [--show-secrets] [--redact] <command> [args]")
 	fmt.Fprintln(a.stdout, "  mgit [--config PATH] [--verbose] [--dry-run] <git-subcommand> [git args]")
 	fmt.Fprintln(a.stdout)
 	fmt.Fprintln(a.stdout, "Commands:")
-	fmt.Fprintln(a.stdout, "  config init|path|validate")
-	fmt.Fprintln(a.stdout, "  rule add|list|remove")
-	fmt.Fprintln(a.stdout, "  resolve --remote <name> | --url <url>")
-	fmt.Fprintln(a.stdout, "  doctor")
-	fmt.Fprintln(a.stdout, "  ssh-test --remote <name> | --url <url>")
+	fmt.Fprintln(a.stdout, "  setup [--hosts github.com,gitlab.com]")
+	fmt.Fprintln(a.stdout, "  import ssh-config|gitconfig [--file PATH]")
+	fmt.Fprintln(a.stdout, "  export ssh-config | gitconfig --dir DIR [--file PATH] [--name NAME]")
+	fmt.Fprintln(a.stdout, "  config init|path|validate|get|set|schema|history|undo|refresh")
+	fmt.Fprintln(a.stdout, "  rule add|list|remove|manage")
+	fmt.Fprintln(a.stdout, "  ui")
+	fmt.Fprintln(a.stdout, "  resolve [--explain] --remote <name> [--push] | --url <url>")
+	fmt.Fprintln(a.stdout, "  resolve --submodules")
+	fmt.Fprintln(a.stdout, "  resolve --target <user@host> [--port N] [--command CMD] [--ssh-command]")
+	fmt.Fprintln(a.stdout, "  doctor [--repo <path>]... [--connect] [--emit-fixes <file>] | --coverage [--workspace | --scan <dir>]")
+	fmt.Fprintln(a.stdout, "  status")
+	fmt.Fprintln(a.stdout, "  selftest [--keep]")
+	fmt.Fprintln(a.stdout, "  remotes")
+	fmt.Fprintln(a.stdout, "  which [--rule] [--no-cache] [remote|url]")
+	fmt.Fprintln(a.stdout, "  ssh-test --remote <name> | --url <url> | --all")
+	fmt.Fprintln(a.stdout, "  ssh-cleanup [--list]")
+	fmt.Fprintln(a.stdout, "  agent [--socket PATH] [--upstream PATH]")
+	fmt.Fprintln(a.stdout, "  ssh-config-hook [--agent [--socket PATH]]")
+	fmt.Fprintln(a.stdout, "  match-host [--key KEY] HOST")
+	fmt.Fprintln(a.stdout, "  install-dispatcher [--dir DIR] [--ssh PATH] [--global] | --uninstall")
+	fmt.Fprintln(a.stdout, "  pin --key <path> | --rule <id>")
+	fmt.Fprintln(a.stdout, "  unpin")
+	fmt.Fprintln(a.stdout, "  key list|generate|rotate|upload")
+	fmt.Fprintln(a.stdout, "  knownhosts add|verify")
+	fmt.Fprintln(a.stdout, "  guard [--remote <name>] [--force]")
+	fmt.Fprintln(a.stdout, "  hooks install [--pre-commit] | uninstall")
+	fmt.Fprintln(a.stdout, "  shim install|status|uninstall [--dir DIR]")
+	fmt.Fprintln(a.stdout, "  ws add|remove|list|exec|status")
+	fmt.Fprintln(a.stdout, "  sync [--workspace | --scan <dir>] [--pull] [--jobs N]")
+	fmt.Fprintln(a.stdout, "  stats [enable|disable]")
 	fmt.Fprintln(a.stdout, "  exec <git args>")
+	fmt.Fprintln(a.stdout, "  gh|glab <args>                 # run gh or glab with the key for the repo it works on")
 	fmt.Fprintln(a.stdout, "  version")
+	if plugins := discoverPlugins(); len(plugins) > 0 {
+		fmt.Fprintln(a.stdout)
+		fmt.Fprintln(a.stdout, "Plugins (mgit-<name> on PATH):")
+		for _, p := range plugins {
+			fmt.Fprintf(a.stdout, "  %s\n", p)
+		}
+	}
 }
 
 func (a *App) printConfigUsage() {
-	fmt.Fprintln(a.stdout, "Usage: mgit config init [--force] | path | validate")
+	fmt.Fprintln(a.stdout, "Usage:")
+	fmt.Fprintln(a.stdout, "  mgit config init [--force] [--gitignore gitignore|exclude|off] | path | validate | schema | history | undo | refresh")
+	fmt.Fprintln(a.stdout, "  mgit config get <key>            # e.g. rules[0].priority, rules[work].key, strict, hostAliases.<host>")
+	fmt.Fprintln(a.stdout, "  mgit config set <key> <value>    # typed: numbers, true/false, a,b lists, JSON for rules")
 }
 
 func (a *App) printRuleUsage() {
 	fmt.Fprintln(a.stdout, "Usage:")
-	fmt.Fprintln(a.stdout, "  mgit rule list")
+	fmt.Fprintln(a.stdout, "  mgit rule list [--tag TAG]")
 	fmt.Fprintln(a.stdout, "  mgit rule add <remote-url>              # interactive key selection from ~/.ssh")
-	fmt.Fprintln(a.stdout, "  mgit rule add --host <host|*> --owner <owner|namespace|*> --key <path> [--priority N] [--id ID] [--force]")
+	fmt.Fprintln(a.stdout, "  mgit rule add --host <host|*> --owner <owner|namespace|*> --key <path> [--remote NAME] [--priority N] [--id ID] [--security-key-provider P] [--strict-host-key-checking yes|accept-new|ask|no] [--known-hosts-file F] [--signing-key K [--signing-format ssh|openpgp|x509]] [--email E] [--description TEXT] [--tags a,b] [--https-user U] [--credential-helper H] [--force]")
+	fmt.Fprintln(a.stdout, "  mgit rule add --host <host|*> --owner <owner|namespace|*> --agent <SHA256:fingerprint|public-key>")
+	fmt.Fprintln(a.stdout, "  mgit rule add --key-from-discovery <index|glob> <remote-url>   # non-interactive; MGIT_DEFAULT_KEY=<path|agent ref> also works")
 	fmt.Fprintln(a.stdout, "  mgit rule remove [--index N | --id ID | --host H --owner O [--key K]]")
+	fmt.Fprintln(a.stdout, "  mgit rule manage                        # full-screen editor (same as mgit ui)")
 }
 
 func (a *App) printErr(err error) {
@@ -0,0 +1,280 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pavelBuzdanov/mgit/internal/config"
+	"github.com/pavelBuzdanov/mgit/internal/resolve"
+	"github.com/pavelBuzdanov/mgit/internal/runner"
+)
+
+// askpassSocketEnv tells mgit askpass-helper where the passphrase typed at
+// the "prompt" askpass is served.
+const askpassSocketEnv = "MGIT_ASKPASS_SOCKET"
+
+// askpassServer hands one passphrase to the askpass-helper processes ssh
+// starts during a run, over a socket in a directory only the user can read.
+type askpassServer struct {
+	dir      string
+	listener net.Listener
+}
+
+func (s *askpassServer) env() map[string]string {
+	return map[string]string{
+		"SSH_ASKPASS":         filepath.Join(s.dir, "askpass"),
+		"SSH_ASKPASS_REQUIRE": "force",
+		askpassSocketEnv:      s.listener.Addr().String(),
+	}
+}
+
+func (s *askpassServer) close() {
+	_ = s.listener.Close()
+	_ = os.RemoveAll(s.dir)
+}
+
+// serveAskpass starts serving passphrase, the passphrase of keyPath, to the
+// askpass script it writes, which runs self as mgit askpass-helper.
+func serveAskpass(self, keyPath, passphrase string) (*askpassServer, error) {
+	dir, err := os.MkdirTemp("", "mgit-askpass-")
+	if err != nil {
+		return nil, fmt.Errorf("create askpass directory: %w", err)
+	}
+	script := "#!/bin/sh\n# Written by mgit for the passphrase asked on this run.\nexec " + runner.ShellArg(self) + " askpass-helper \"$@\"\n"
+	if err := os.WriteFile(filepath.Join(dir, "askpass"), []byte(script), 0o700); err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, fmt.Errorf("write askpass script: %w", err)
+	}
+	ln, err := net.Listen("unix", filepath.Join(dir, "socket"))
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, fmt.Errorf("listen for askpass: %w", err)
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go answerAskpass(conn, keyPath, passphrase)
+		}
+	}()
+	return &askpassServer{dir: dir, listener: ln}, nil
+}
+
+// answerAskpass reads the prompt an askpass-helper was run with from conn
+// and writes passphrase back only when ssh is asking for the passphrase of
+// keyPath. Anything else, such as a password or keyboard-interactive prompt
+// of a server, gets nothing.
+func answerAskpass(conn net.Conn, keyPath, passphrase string) {
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(10 * time.Second))
+	prompt, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil || !isPassphrasePrompt(strings.TrimSuffix(prompt, "\n"), keyPath) {
+		return
+	}
+	_, _ = io.WriteString(conn, passphrase+"\n")
+}
+
+// isPassphrasePrompt reports whether prompt is OpenSSH's prompt for the
+// passphrase of keyPath, "Enter passphrase for key '<path>': ", in which
+// the path is cut after 100 bytes.
+func isPassphrasePrompt(prompt, keyPath string) bool {
+	path, ok := strings.CutPrefix(strings.TrimSpace(prompt), "Enter passphrase for key '")
+	if !ok {
+		return false
+	}
+	path, ok = strings.CutSuffix(path, "':")
+	if !ok {
+		return false
+	}
+	if len(keyPath) > 100 {
+		keyPath = keyPath[:100]
+	}
+	return path == keyPath
+}
+
+// closeAskpass stops the passphrase servers of the run.
+func (a *App) closeAskpass() {
+	a.askpassMu.Lock()
+	defer a.askpassMu.Unlock()
+	for _, s := range a.askpass {
+		s.close()
+	}
+	a.askpass = nil
+}
+
+// passphraseEnv returns the environment that lets ssh get the passphrase of
+// res's key when it is encrypted and not in an agent: the askpass program of
+// the config or MGIT_ASKPASS, or with "prompt" a passphrase asked once per
+// run and key. Without askpass ssh asks on the terminal itself, so there is
+// only a warning, once per key, when there is none.
+func (a *App) passphraseEnv(opts globalOptions, res *resolve.Result) (map[string]string, error) {
+	if res == nil || !res.KeyNeedsPassphrase {
+		return nil, nil
+	}
+	program := ""
+	if cfg, _, err := a.loadConfig(opts); err == nil {
+		program = cfg.AskpassProgram()
+	}
+	switch program {
+	case config.AskpassPrompt:
+		env, err := a.promptAskpass(res.KeyPath)
+		if err != nil {
+			return nil, err
+		}
+		// With SSH_ASKPASS_REQUIRE=force ssh would run the helper for a
+		// server's password and keyboard-interactive prompts as well: only
+		// the key may authenticate.
+		res.SSHOptions = append(res.SSHOptions, "PasswordAuthentication=no", "KbdInteractiveAuthentication=no")
+		res.GITSSHCommand = res.SSHClient.Command(res.KeyPath, res.SSHOptions...)
+		env["GIT_SSH_COMMAND"] = res.GITSSHCommand
+		return env, nil
+	case "":
+		if tty, err := openTerminal(); err == nil {
+			_ = tty.Close()
+		} else if a.warnOnce(res.KeyPath) {
+			fmt.Fprintf(a.stderr, "warn: key %s is passphrase-protected, not loaded in ssh-agent, and there is no terminal for ssh to ask on; load it with ssh-add %s or set askpass in the config (or %s)\n", res.KeyPath, res.KeyPath, config.AskpassEnv)
+		}
+		return nil, nil
+	}
+	path, err := config.ExpandPath(program)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{"SSH_ASKPASS": path, "SSH_ASKPASS_REQUIRE": "force"}, nil
+}
+
+// warnOnce reports whether keyPath has not been warned about yet this run.
+func (a *App) warnOnce(keyPath string) bool {
+	a.askpassMu.Lock()
+	defer a.askpassMu.Unlock()
+	if a.askpassWarned[keyPath] {
+		return false
+	}
+	if a.askpassWarned == nil {
+		a.askpassWarned = map[string]bool{}
+	}
+	a.askpassWarned[keyPath] = true
+	return true
+}
+
+// promptAskpass asks for the passphrase of keyPath on the terminal, the
+// first time the run needs it, and returns the environment that hands it to
+// ssh.
+func (a *App) promptAskpass(keyPath string) (map[string]string, error) {
+	a.askpassMu.Lock()
+	defer a.askpassMu.Unlock()
+	if s, ok := a.askpass[keyPath]; ok {
+		return s.env(), nil
+	}
+	if runtime.GOOS == "windows" {
+		return nil, withExitCode(exitKeyMissing, fmt.Errorf("askpass %q is not supported on Windows; set askpass to an askpass program or load key %s into ssh-agent", config.AskpassPrompt, keyPath))
+	}
+	tty, err := openTerminal()
+	if err != nil {
+		return nil, withExitCode(exitKeyMissing, fmt.Errorf("key %s needs a passphrase but there is no terminal to ask on; load it with ssh-add %s or set askpass to a program", keyPath, keyPath))
+	}
+	defer tty.Close()
+	raw, err := newRawTerminal(tty)
+	if err != nil {
+		return nil, fmt.Errorf("read passphrase: %w", err)
+	}
+	passphrase, err := readPassphrase(tty, tty, fmt.Sprintf("Enter passphrase for %s: ", keyPath))
+	raw.restore()
+	if err != nil {
+		return nil, err
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("askpass: %w", err)
+	}
+	s, err := serveAskpass(self, keyPath, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if a.askpass == nil {
+		a.askpass = map[string]*askpassServer{}
+	}
+	a.askpass[keyPath] = s
+	return s.env(), nil
+}
+
+// readPassphrase reads a line from a terminal in raw mode, without echo.
+// Backspace deletes, Ctrl-C and Ctrl-D abort.
+func readPassphrase(r io.Reader, w io.Writer, prompt string) (string, error) {
+	fmt.Fprint(w, prompt)
+	defer fmt.Fprint(w, "\r\n")
+	var line []byte
+	buf := make([]byte, 1)
+	for {
+		if _, err := r.Read(buf); err != nil {
+			if errors.Is(err, io.EOF) {
+				return "", errAborted
+			}
+			return "", err
+		}
+		switch b := buf[0]; b {
+		case '\r', '\n':
+			return string(line), nil
+		case 0x03, 0x04:
+			return "", errAborted
+		case 0x7f, 0x08:
+			if len(line) > 0 {
+				_, size := utf8.DecodeLastRune(line)
+				line = line[:len(line)-size]
+			}
+		default:
+			line = append(line, b)
+		}
+	}
+}
+
+// handleAskpassHelper is the askpass program of the "prompt" askpass: ssh
+// runs it with the prompt as argument and reads the passphrase from stdout.
+// It exits 1 without output for any prompt but the one for the passphrase
+// of the key mgit asked about (see answerAskpass).
+func (a *App) handleAskpassHelper(ctx context.Context, opts globalOptions, args []string) int {
+	socket := strings.TrimSpace(os.Getenv(askpassSocketEnv))
+	if socket == "" {
+		return a.fail(opts, usageError(errors.New("askpass-helper is run by ssh during mgit commands with askpass set to prompt; "+askpassSocketEnv+" is not set")))
+	}
+	if len(args) != 1 {
+		return a.fail(opts, usageError(errors.New("askpass-helper takes the prompt as its only argument")))
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", socket)
+	if err != nil {
+		return a.fail(opts, fmt.Errorf("askpass: %w", err))
+	}
+	defer conn.Close()
+	if _, err := io.WriteString(conn, strings.ReplaceAll(args[0], "\n", " ")+"\n"); err != nil {
+		return a.fail(opts, fmt.Errorf("askpass: %w", err))
+	}
+	passphrase, err := io.ReadAll(conn)
+	if err != nil {
+		return a.fail(opts, fmt.Errorf("askpass: %w", err))
+	}
+	if len(passphrase) == 0 {
+		return a.fail(opts, fmt.Errorf("askpass: not answering %q; only the passphrase mgit asked for is supplied", args[0]))
+	}
+	// The passphrase must reach ssh as typed, not redacted.
+	out := a.stdout
+	if w, ok := out.(redactWriter); ok {
+		out = w.w
+	}
+	if _, err := out.Write(passphrase); err != nil {
+		return a.fail(opts, fmt.Errorf("askpass: %w", err))
+	}
+	return 0
+}
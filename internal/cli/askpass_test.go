@@ -0,0 +1,77 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadPassphrase(t *testing.T) {
+	var echo bytes.Buffer
+	got, err := readPassphrase(strings.NewReader("secx\x7fret\r"), &echo, "Passphrase: ")
+	if err != nil || got != "secret" {
+		t.Fatalf("readPassphrase = %q, %v; want secret", got, err)
+	}
+	if strings.Contains(echo.String(), "sec") {
+		t.Errorf("passphrase echoed: %q", echo.String())
+	}
+	if _, err := readPassphrase(strings.NewReader("abc\x03"), &echo, ""); !errors.Is(err, errAborted) {
+		t.Errorf("Ctrl-C: err = %v, want errAborted", err)
+	}
+}
+
+func TestAskpassHelperServesPassphrase(t *testing.T) {
+	s, err := serveAskpass("/usr/bin/mgit", "/home/me/.ssh/id_work", "p4ss word")
+	if err != nil {
+		t.Fatalf("serveAskpass: %v", err)
+	}
+	env := s.env()
+	script, err := os.ReadFile(env["SSH_ASKPASS"])
+	if err != nil || !strings.Contains(string(script), "/usr/bin/mgit askpass-helper") {
+		t.Fatalf("askpass script = %q, %v", script, err)
+	}
+	t.Setenv(askpassSocketEnv, env[askpassSocketEnv])
+	// ssh runs the helper once per attempt; each gets the passphrase.
+	for range 2 {
+		var stdout, stderr bytes.Buffer
+		code := New(strings.NewReader(""), &stdout, &stderr).Run(context.Background(), []string{"askpass-helper", "Enter passphrase for key '/home/me/.ssh/id_work': "})
+		if code != 0 || stdout.String() != "p4ss word\n" {
+			t.Fatalf("askpass-helper = %d, %q (stderr %q)", code, stdout.String(), stderr.String())
+		}
+	}
+	// A server's password prompt, or another key's, gets nothing.
+	for _, prompt := range []string{"git@evil.example's password: ", "Enter passphrase for key '/home/me/.ssh/id_other': ", "Password:"} {
+		var stdout, stderr bytes.Buffer
+		code := New(strings.NewReader(""), &stdout, &stderr).Run(context.Background(), []string{"askpass-helper", prompt})
+		if code != exitFailure || stdout.Len() != 0 {
+			t.Errorf("askpass-helper %q = %d, %q", prompt, code, stdout.String())
+		}
+	}
+	s.close()
+	if _, err := os.Stat(filepath.Dir(env["SSH_ASKPASS"])); !os.IsNotExist(err) {
+		t.Errorf("askpass directory left behind: %v", err)
+	}
+}
+
+func TestIsPassphrasePrompt(t *testing.T) {
+	long := "/home/me/" + strings.Repeat("k", 120)
+	for _, tc := range []struct {
+		prompt, key string
+		want        bool
+	}{
+		{"Enter passphrase for key '/k': ", "/k", true},
+		{"Enter passphrase for key '/k':", "/k", true},
+		{"Enter passphrase for key '" + long[:100] + "': ", long, true},
+		{"Enter passphrase for key '/other': ", "/k", false},
+		{"Enter passphrase for key '/k' (again): ", "/k", false},
+		{"(git@host) Password: ", "/k", false},
+	} {
+		if got := isPassphrasePrompt(tc.prompt, tc.key); got != tc.want {
+			t.Errorf("isPassphrasePrompt(%q, %q) = %v", tc.prompt, tc.key, got)
+		}
+	}
+}
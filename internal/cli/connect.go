@@ -0,0 +1,246 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/pavelBuzdanov/mgit/internal/doctor"
+	"github.com/pavelBuzdanov/mgit/internal/resolve"
+	"github.com/pavelBuzdanov/mgit/internal/runner"
+	"github.com/pavelBuzdanov/mgit/internal/ui"
+)
+
+// sshTestArgs builds the `ssh -T` arguments for a resolved SSH remote. FIDO2
+// keys need user presence (touch, sometimes a PIN), which BatchMode would
+// turn into a failure, so only they run without it.
+func sshTestArgs(res *resolve.Result, extra ...string) []string {
+	args := res.SSHClient.Args(res.KeyPath, res.SSHOptions...)
+	if !res.SecurityKey {
+		args = append(args, res.SSHClient.BatchArgs()...)
+	}
+	args = append(args, extra...)
+	args = append(args, res.SSHClient.PortArgs(res.Parsed.Port)...)
+	return append(args, "-T", res.Parsed.TargetUserHost())
+}
+
+// sshTestSucceeded reports whether a failed `ssh -T` still authenticated:
+// GitHub answers a successful login with exit code 1.
+func sshTestSucceeded(res *resolve.Result, err error) bool {
+	return strings.EqualFold(res.Parsed.Host, "github.com") && hasExitCode(err, 1)
+}
+
+// probeSSH runs `ssh -T` for a resolved remote and returns what the server
+// said. Unlike ssh-test --remote it captures output and gives up on
+// unreachable hosts after a short timeout, for use across many remotes.
+func (a *App) probeSSH(ctx context.Context, opts globalOptions, res *resolve.Result) (string, error) {
+	if res.KeyProvider != "" {
+		cleanup, err := res.MaterializeKey(ctx)
+		defer cleanup()
+		if err != nil {
+			return "", err
+		}
+	}
+	var out bytes.Buffer
+	shell := runner.NewShell(&out, &out, false)
+	if opts.SSHVerbose > 0 {
+		// The debug output is for the user; the greeting is still picked
+		// out of the rest for the summary.
+		shell.Stderr = io.MultiWriter(&out, rawWriter(a.stderr))
+	}
+	shell.Dir = opts.Dir
+	var extra []string
+	if !res.SSHClient.Plink() {
+		extra = []string{"-o", "ConnectTimeout=10"}
+	}
+	err := shell.Run(ctx, res.SSHClient.Name(), sshTestArgs(res, extra...), nil)
+	output := strings.TrimSpace(withoutSSHDebug(out.String()))
+	if err != nil && !sshTestSucceeded(res, err) {
+		if output != "" {
+			return output, errors.New(lastLine(output))
+		}
+		return output, err
+	}
+	return output, nil
+}
+
+// withoutSSHDebug drops the lines ssh -v adds to its output.
+func withoutSSHDebug(s string) string {
+	lines := strings.Split(s, "\n")
+	kept := lines[:0]
+	for _, l := range lines {
+		l = strings.TrimRight(l, "\r")
+		if strings.HasPrefix(l, "debug") || strings.HasPrefix(l, "OpenSSH_") || strings.HasPrefix(l, "Transferred: ") || strings.HasPrefix(l, "Bytes per second: ") {
+			continue
+		}
+		kept = append(kept, l)
+	}
+	return strings.Join(kept, "\n")
+}
+
+func lastLine(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+		return strings.TrimSpace(s[i+1:])
+	}
+	return s
+}
+
+// progressFor returns a progress renderer for human output, or nil (which
+// reports nothing) for structured or quiet runs. Progress goes to stderr so
+// it never mixes with the results on stdout.
+func (a *App) progressFor(opts globalOptions, total int) *ui.Progress {
+	if opts.Output.Structured() || opts.Quiet || total == 0 {
+		return nil
+	}
+	return ui.NewProgress(a.stderr, a.stdout, total)
+}
+
+type sshTestResult struct {
+	Remote  string `json:"remote"`
+	URL     string `json:"url"`
+	RuleID  string `json:"ruleId,omitempty"`
+	KeyPath string `json:"keyPath,omitempty"`
+	Status  string `json:"status"` // ok|failed|skipped|dry-run
+	Message string `json:"message,omitempty"`
+}
+
+// handleSSHTestAll runs ssh-test against every remote of the repository.
+func (a *App) handleSSHTestAll(ctx context.Context, opts globalOptions) int {
+	git := a.gitOps(opts, a.newShell(opts))
+	remotes, err := git.Remotes(ctx)
+	if err != nil {
+		return a.fail(opts, fmt.Errorf("failed to read remotes: %w", err))
+	}
+	if len(remotes) == 0 {
+		return a.fail(opts, errors.New("no remotes configured"))
+	}
+	names := make([]string, 0, len(remotes))
+	for name := range remotes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	cfg, _, cfgErr := a.loadConfig(opts)
+
+	results := make([]sshTestResult, 0, len(names))
+	failed, code := 0, exitOK
+	progress := a.progressFor(opts, len(names))
+	for _, name := range names {
+		r := sshTestResult{Remote: name, URL: remotes[name]}
+		progress.Start(name)
+		res, err := resolve.FromRemote(cfg, name, r.URL)
+		switch {
+		case err != nil && cfgErr != nil:
+			r.Status, r.Message = "failed", firstLine(cfgErr.Error())
+			err = withExitCode(exitConfig, cfgErr)
+		case err != nil:
+			r.Status, r.Message = "failed", err.Error()
+		case !res.SSHSelectionApplies:
+			r.Status, r.Message = "skipped", "not an SSH remote"
+		default:
+			sshVerbose(opts, res)
+			r.RuleID, r.KeyPath = res.MatchedRule.ID, res.KeyPath
+			if opts.DryRun {
+				r.Status, r.Message = "dry-run", "ssh "+strings.Join(sshTestArgs(res), " ")
+				break
+			}
+			if err = res.CheckKey(); err != nil {
+				r.Status, r.Message = "failed", err.Error()
+				break
+			}
+			out, probeErr := a.probeSSH(ctx, opts, res)
+			if probeErr != nil {
+				r.Status, r.Message = "failed", probeErr.Error()
+				err = withExitCode(exitSSH, probeErr)
+			} else {
+				r.Status, r.Message = "ok", lastLine(out)
+			}
+		}
+		if r.Status == "failed" {
+			failed++
+			if code == exitOK {
+				code = exitCodeFor(err)
+			}
+		}
+		results = append(results, r)
+		progress.Done(name)
+		if opts.Output == ui.FormatJSONL {
+			a.printLine(r)
+		}
+	}
+	progress.Finish()
+
+	switch {
+	case opts.Output == ui.FormatJSONL:
+	case opts.Output.Structured():
+		a.printData(opts, map[string]any{"remotes": results, "failed": failed})
+	default:
+		c := a.color(opts)
+		tw := tabwriter.NewWriter(a.stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "REMOTE\tRULE\tSTATUS\tMESSAGE")
+		for _, r := range results {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.Remote, dash(r.RuleID), sshTestStatus(c, r.Status), dash(r.Message))
+		}
+		_ = tw.Flush()
+	}
+	return code
+}
+
+func sshTestStatus(c ui.Color, status string) string {
+	text := strings.ToUpper(status)
+	switch status {
+	case "ok":
+		return c.Green(text)
+	case "failed":
+		return c.Red(text)
+	}
+	return c.Yellow(text)
+}
+
+// connectRemotes adds a connect check per SSH remote to a doctor report.
+// Up to doctor.Parallelism handshakes run at once, one at a time under
+// --ssh-verbose so the debug output of each stays together; the checks
+// follow the order of the remotes either way.
+func (a *App) connectRemotes(ctx context.Context, opts globalOptions, rep *doctor.Report) {
+	var targets []*doctor.RemoteReport
+	for i := range rep.Remotes {
+		if r := &rep.Remotes[i]; r.Result != nil && r.Result.SSHSelectionApplies {
+			targets = append(targets, r)
+		}
+	}
+	jobs := doctor.Parallelism
+	if opts.SSHVerbose > 0 {
+		jobs = 1
+	}
+	progress := a.progressFor(opts, len(targets))
+	checks := make([]doctor.Check, len(targets))
+	sem := make(chan struct{}, jobs)
+	var wg sync.WaitGroup
+	for i, r := range targets {
+		wg.Add(1)
+		go func(i int, r *doctor.RemoteReport) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			progress.Start(r.Name)
+			out, err := a.probeSSH(ctx, opts, r.Result)
+			if err != nil {
+				r.Connection = &doctor.Connection{Message: err.Error()}
+				checks[i] = doctor.Check{Name: "connect", Status: "error", Message: fmt.Sprintf("%s: %v", r.Name, err)}
+			} else {
+				r.Connection = &doctor.Connection{OK: true, Message: lastLine(out)}
+				checks[i] = doctor.Check{Name: "connect", Status: "ok", Message: fmt.Sprintf("%s: authenticated as rule %s", r.Name, r.Result.MatchedRule.ID)}
+			}
+			progress.Done(r.Name)
+		}(i, r)
+	}
+	wg.Wait()
+	progress.Finish()
+	rep.Checks = append(rep.Checks, checks...)
+}
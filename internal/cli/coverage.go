@@ -0,0 +1,147 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pavelBuzdanov/mgit/internal/config"
+	"github.com/pavelBuzdanov/mgit/internal/doctor"
+	"github.com/pavelBuzdanov/mgit/internal/runner"
+	"github.com/pavelBuzdanov/mgit/internal/ui"
+	"github.com/pavelBuzdanov/mgit/internal/workspace"
+)
+
+// coverageRepo is the line doctor --coverage streams per repository with
+// --output jsonl, before the report itself.
+type coverageRepo struct {
+	Repo    string              `json:"repo"`
+	Path    string              `json:"path,omitempty"`
+	Remotes []doctor.SeenRemote `json:"remotes"`
+	Error   string              `json:"error,omitempty"`
+}
+
+// handleCoverage implements doctor --coverage: every (host, owner) seen in
+// the remotes of the current repository, the registered workspace or the
+// repositories under a directory, against the rule that wins it. It exits 1
+// when an SSH pair has no rule.
+func (a *App) handleCoverage(ctx context.Context, opts globalOptions, useWorkspace bool, scan string) int {
+	cfg, _, err := a.loadConfig(opts)
+	if err != nil {
+		return a.fail(opts, err)
+	}
+	var repos []workspace.Repo
+	switch {
+	case scan != "":
+		root, err := config.ExpandPath(scan)
+		if err != nil {
+			return a.fail(opts, usageError(err))
+		}
+		if repos, err = workspace.Scan(root); err != nil {
+			return a.fail(opts, err)
+		}
+	case useWorkspace:
+		reg, _, err := a.loadWorkspace()
+		if err != nil {
+			return a.fail(opts, err)
+		}
+		repos = reg.Repos
+	default:
+		repos = []workspace.Repo{{Path: opts.Dir}}
+	}
+
+	var seen []doctor.SeenRemote
+	for _, repo := range repos {
+		shell := runner.NewShell(io.Discard, io.Discard, false)
+		shell.Dir = repo.Path
+		remotes, err := a.gitOps(opts, shell).Remotes(ctx)
+		line := coverageRepo{Repo: repo.Name, Path: repo.Path, Remotes: []doctor.SeenRemote{}}
+		if err != nil {
+			if len(repos) == 1 && repo.Name == "" {
+				return a.fail(opts, fmt.Errorf("failed to read remotes: %w", err))
+			}
+			fmt.Fprintf(a.stderr, "warn: %s: failed to read remotes: %s\n", repo.Name, firstLine(err.Error()))
+			if opts.Output == ui.FormatJSONL {
+				line.Error = firstLine(err.Error())
+				a.printLine(line)
+			}
+			continue
+		}
+		names := make([]string, 0, len(remotes))
+		for name := range remotes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			sr := doctor.SeenRemote{Repo: repo.Name, Name: name, URL: remotes[name]}
+			seen = append(seen, sr)
+			line.Remotes = append(line.Remotes, sr)
+		}
+		if opts.Output == ui.FormatJSONL {
+			a.printLine(line)
+		}
+	}
+	if len(seen) == 0 {
+		return a.fail(opts, errors.New("no remotes found"))
+	}
+
+	rep := doctor.Coverage(cfg, seen)
+	if opts.Output == ui.FormatJSONL {
+		a.printLine(rep)
+	} else if opts.Output.Structured() {
+		a.printData(opts, rep)
+	} else {
+		a.printCoverage(rep)
+	}
+	if rep.Holes() > 0 {
+		return 1
+	}
+	return 0
+}
+
+func (a *App) printCoverage(rep doctor.CoverageReport) {
+	tw := tabwriter.NewWriter(a.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "HOST\tOWNER\tTRANSPORT\tREMOTES\tRULE\tNOTE")
+	for _, p := range rep.Pairs {
+		note := ""
+		switch {
+		case p.Hole && p.Fallback:
+			note = "no rule (defaultKey fallback)"
+		case p.Hole:
+			note = "no rule"
+		case len(p.Losing) > 0:
+			note = "also matches " + strings.Join(p.Losing, ", ")
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\n", p.Host, p.Owner, p.Transport, len(p.Remotes), dash(p.Rule), dash(note))
+	}
+	_ = tw.Flush()
+
+	if len(rep.Rules) > 0 {
+		fmt.Fprintln(a.stdout)
+		fmt.Fprintln(a.stdout, "Rules:")
+		for _, r := range rep.Rules {
+			switch r.Status {
+			case "used":
+				fmt.Fprintf(a.stdout, "  %s (%s/%s): wins %d pair(s)\n", r.ID, r.Host, r.Owner, r.Pairs)
+			case "shadowed":
+				fmt.Fprintf(a.stdout, "  %s (%s/%s): shadowed by %s\n", r.ID, r.Host, r.Owner, strings.Join(r.ShadowedBy, ", "))
+			default:
+				fmt.Fprintf(a.stdout, "  %s (%s/%s): matches no remote seen\n", r.ID, r.Host, r.Owner)
+			}
+		}
+	}
+	if len(rep.MissingRules) > 0 {
+		fmt.Fprintln(a.stdout)
+		fmt.Fprintln(a.stdout, "Missing rules:")
+		for _, r := range rep.MissingRules {
+			fmt.Fprintf(a.stdout, "  mgit rule add --host %s --owner %s --key <key>\n", r.Host, r.Owner)
+		}
+	}
+	for _, s := range rep.Skipped {
+		fmt.Fprintf(a.stderr, "warn: skipped %s (%s): not a network URL\n", s.Name, s.URL)
+	}
+}
@@ -0,0 +1,213 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/pavelBuzdanov/mgit/internal/config"
+	"github.com/pavelBuzdanov/mgit/internal/runner"
+	"github.com/pavelBuzdanov/mgit/internal/shim"
+)
+
+// handleInstallDispatcher writes the ssh dispatcher (see
+// shim.DispatcherScript) and, with --global, makes it git's
+// core.sshCommand, so every git on the machine picks keys by the rules:
+// submodules, libgit2 tools and IDEs included.
+func (a *App) handleInstallDispatcher(ctx context.Context, opts globalOptions, args []string) int {
+	fs := flag.NewFlagSet("mgit install-dispatcher", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	dir := fs.String("dir", "", "")
+	sshPath := fs.String("ssh", "", "")
+	global := fs.Bool("global", false, "")
+	uninstall := fs.Bool("uninstall", false, "")
+	if err := fs.Parse(args); err != nil {
+		return a.fail(opts, usageError(err))
+	}
+	if fs.NArg() > 0 {
+		return a.fail(opts, usageError(errors.New("usage: mgit install-dispatcher [--dir DIR] [--ssh PATH] [--global] | --uninstall [--dir DIR]")))
+	}
+	if runtime.GOOS == "windows" {
+		return a.fail(opts, errors.New("the ssh dispatcher is a sh script and is not supported on Windows"))
+	}
+	if *dir == "" {
+		d, err := shim.DefaultDispatcherDir()
+		if err != nil {
+			return a.fail(opts, err)
+		}
+		*dir = d
+	}
+	if abs, err := filepath.Abs(*dir); err == nil {
+		*dir = abs
+	}
+	path := filepath.Join(*dir, "ssh")
+	git := a.gitOps(opts, a.newShell(opts))
+	var current string
+	if entries := git.ScopedConfigEntries(ctx, "--global", `^core\.sshcommand$`); len(entries) > 0 {
+		current = entries[len(entries)-1].Value
+	}
+
+	if *uninstall {
+		if opts.DryRun {
+			fmt.Fprintf(a.stdout, "Dry run: would remove %s\n", path)
+			return 0
+		}
+		removed, err := shim.UninstallDispatcher(*dir)
+		if err != nil {
+			return a.fail(opts, err)
+		}
+		unset := false
+		if current == path {
+			if err := git.RunGit(ctx, []string{"config", "--global", "--unset", "core.sshCommand"}, nil); err != nil {
+				return a.fail(opts, err)
+			}
+			unset = true
+		}
+		if opts.Output.Structured() {
+			a.printData(opts, map[string]any{"path": path, "removed": removed, "unsetCoreSshCommand": unset})
+			return 0
+		}
+		if !removed {
+			a.infof(opts, "No ssh dispatcher at %s\n", path)
+		} else {
+			a.infof(opts, "Removed ssh dispatcher %s\n", path)
+		}
+		if unset {
+			a.infof(opts, "Unset core.sshCommand in the global git config\n")
+		}
+		return 0
+	}
+
+	if *sshPath == "" {
+		p, err := exec.LookPath(a.sshBinary(opts).Name())
+		if err != nil {
+			return a.fail(opts, fmt.Errorf("ssh not found: %w", err))
+		}
+		*sshPath = p
+	}
+	if shim.IsDispatcher(*sshPath) {
+		return a.fail(opts, usageError(fmt.Errorf("%s is an mgit dispatcher itself; pass the real ssh with --ssh", *sshPath)))
+	}
+	mgitPath, err := os.Executable()
+	if err != nil {
+		return a.fail(opts, fmt.Errorf("locate the mgit binary: %w", err))
+	}
+	if opts.DryRun {
+		fmt.Fprintf(a.stdout, "Dry run: would install %s (ssh: %s, mgit: %s)\n", path, *sshPath, mgitPath)
+		if *global {
+			fmt.Fprintf(a.stdout, "Dry run: would set core.sshCommand=%s in the global git config\n", path)
+		}
+		return 0
+	}
+	if *global && current != "" && current != path {
+		ok, err := a.confirm(opts, fmt.Sprintf("The global core.sshCommand is %q; it will be replaced by %s.", current, path))
+		if err != nil {
+			return a.fail(opts, err)
+		}
+		if !ok {
+			return a.fail(opts, errAborted)
+		}
+	}
+	path, updated, err := shim.InstallDispatcher(*dir, *sshPath, mgitPath)
+	if err != nil {
+		return a.fail(opts, err)
+	}
+	if *global {
+		if err := git.RunGit(ctx, []string{"config", "--global", "core.sshCommand", path}, nil); err != nil {
+			return a.fail(opts, err)
+		}
+	}
+	action := "installed"
+	if updated {
+		action = "updated"
+	}
+	if opts.Output.Structured() {
+		a.printData(opts, map[string]any{"action": action, "path": path, "ssh": *sshPath, "mgit": mgitPath, "global": *global})
+		return 0
+	}
+	a.infof(opts, "ssh dispatcher %s: %s (ssh: %s, mgit: %s)\n", action, path, *sshPath, mgitPath)
+	if *global {
+		a.infof(opts, "Set core.sshCommand=%s in the global git config\n", path)
+	} else {
+		a.infof(opts, "Use it with: git config --global core.sshCommand %s   (or GIT_SSH=%s)\n", runner.ShellArg(path), runner.ShellArg(path))
+	}
+	return 0
+}
+
+// targetURL turns what ssh is asked to connect to into a remote URL for
+// resolve: the destination (user@host), the port and git's remote command
+// (git-upload-pack 'owner/repo.git'), whose path gives the owner. Without a
+// command the current repository's remotes or the host's rules stand in, as
+// for match-host.
+func (a *App) targetURL(ctx context.Context, opts globalOptions, target, port, command string) (string, error) {
+	user, host, ok := strings.Cut(target, "@")
+	if !ok {
+		user, host = "", target
+	}
+	if host == "" {
+		return "", fmt.Errorf("no host in --target %q", target)
+	}
+	prefix := "ssh://"
+	if user != "" {
+		prefix += user + "@"
+	}
+	prefix += host
+	if port != "" && port != "22" {
+		prefix += ":" + port
+	}
+	if path := commandPath(command); path != "" {
+		return prefix + "/" + path, nil
+	}
+
+	cfg, _, err := a.loadConfig(opts)
+	if err != nil {
+		return "", err
+	}
+	quiet := a.newShell(opts)
+	quiet.Stderr = io.Discard
+	remotes, _ := a.gitOps(opts, quiet).Remotes(ctx)
+	choice := chooseHostKey(cfg, host, remotes)
+	switch {
+	case choice.Remote != "":
+		return remotes[choice.Remote], nil
+	case choice.RuleID != "":
+		for _, r := range cfg.Rules {
+			if r.ID == choice.RuleID {
+				return prefix + "/" + ownerFor(r) + "/repo.git", nil
+			}
+		}
+	}
+	return "", fmt.Errorf("%s: %s", host, choice.Reason)
+}
+
+// commandPath returns the repository path of a git remote command such as
+// git-upload-pack '/owner/repo.git', with git's shell quoting undone and the
+// leading / dropped.
+func commandPath(command string) string {
+	_, arg, ok := strings.Cut(strings.TrimSpace(command), " ")
+	if !ok {
+		return ""
+	}
+	arg = strings.TrimSpace(arg)
+	if len(arg) >= 2 && arg[0] == '\'' && arg[len(arg)-1] == '\'' {
+		arg = strings.NewReplacer(`'\''`, `'`, `'\!'`, `!`).Replace(arg[1 : len(arg)-1])
+	}
+	return strings.TrimPrefix(arg, "/")
+}
+
+// ownerFor is an owner the rule matches, for resolving a host whose owner
+// is unknown: the rule's own owner with wildcards filled in.
+func ownerFor(r config.Rule) string {
+	owner := strings.NewReplacer("**", "x", "*", "x", "?", "x").Replace(r.Owner)
+	if owner == "" {
+		return "x"
+	}
+	return owner
+}
@@ -0,0 +1,19 @@
+package cli
+
+import "testing"
+
+func TestCommandPath(t *testing.T) {
+	for command, want := range map[string]string{
+		"git-upload-pack 'CompanyOrg/app.git'":  "CompanyOrg/app.git",
+		"git-receive-pack '/group/sub/app.git'": "group/sub/app.git",
+		`git-upload-pack 'it'\''s/a'\!'b.git'`:  "it's/a!b.git",
+		"git-upload-pack '~user/app.git'":       "~user/app.git",
+		"git-upload-archive CompanyOrg/app.git": "CompanyOrg/app.git",
+		"git-upload-pack":                       "",
+		"":                                      "",
+	} {
+		if got := commandPath(command); got != want {
+			t.Errorf("commandPath(%q) = %q, want %q", command, got, want)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package cli
+
+import (
+	"errors"
+
+	"github.com/pavelBuzdanov/mgit/internal/resolve"
+	"github.com/pavelBuzdanov/mgit/pkg/matcher"
+)
+
+// Exit codes. Scripts rely on them to tell e.g. "no rule matched" from "git
+// rejected the push", so a code is never reused for something else. The git
+// wrapper exits with git's own code when git itself fails.
+const (
+	exitOK         = 0
+	exitFailure    = 1 // anything without a more specific code
+	exitUsage      = 2 // bad flags or arguments
+	exitConfig     = 3 // config missing, unreadable or invalid
+	exitNoRule     = 4 // no rule (and no defaultKey) for the remote
+	exitKeyMissing = 5 // the rule's key file, agent identity or provider key is unavailable
+	exitSSH        = 6 // ssh could not connect or authenticate
+	exitPolicy     = 7 // a policy entry denies the command for the remote
+	// exitTimeout is the exit code when --timeout expires, as with timeout(1).
+	exitTimeout = 124
+)
+
+// codedError gives err a specific exit code.
+type codedError struct {
+	code int
+	err  error
+}
+
+func (e *codedError) Error() string { return e.err.Error() }
+func (e *codedError) Unwrap() error { return e.err }
+
+func withExitCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &codedError{code: code, err: err}
+}
+
+func usageError(err error) error { return withExitCode(exitUsage, err) }
+
+// exitCodeFor maps err to its exit code: an explicit withExitCode code
+// first, then the sentinel errors of the resolution packages.
+func exitCodeFor(err error) int {
+	var ce *codedError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &ce):
+		return ce.code
+	case errors.Is(err, matcher.ErrNoMatch):
+		return exitNoRule
+	case errors.Is(err, resolve.ErrKeyMissing):
+		return exitKeyMissing
+	}
+	return exitFailure
+}
+
+// errorPayload is what a failed command prints with --output json/yaml/jsonl.
+type errorPayload struct {
+	Error string `json:"error"`
+	Code  int    `json:"code"`
+}
+
+// fail reports err, as text on stderr or as an errorPayload on stdout for
+// structured output, and returns its exit code.
+func (a *App) fail(opts globalOptions, err error) int {
+	code := exitCodeFor(err)
+	if opts.Output.Structured() {
+		a.printData(opts, errorPayload{Error: err.Error(), Code: code})
+	} else {
+		a.printErr(err)
+	}
+	return code
+}
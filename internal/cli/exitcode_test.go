@@ -0,0 +1,77 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExitCodes(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(cfgPath, []byte(`{"version":1,"rules":[{"id":"work","host":"github.com","owner":"CompanyOrg","key":"`+filepath.Join(dir, "missing")+`"}]}`), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	run := func(args ...string) (int, string) {
+		var stdout, stderr bytes.Buffer
+		code := New(strings.NewReader(""), &stdout, &stderr).Run(context.Background(), args)
+		return code, stdout.String()
+	}
+
+	for _, tc := range []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"usage", []string{"--config", cfgPath, "which", "--bogus"}, exitUsage},
+		{"config", []string{"--config", filepath.Join(dir, "absent.json"), "which", "git@github.com:CompanyOrg/app.git"}, exitConfig},
+		{"no rule", []string{"--config", cfgPath, "which", "git@gitlab.com:other/app.git"}, exitNoRule},
+		{"key missing", []string{"--config", cfgPath, "ssh-test", "--url", "git@github.com:CompanyOrg/app.git"}, exitKeyMissing},
+	} {
+		if code, _ := run(tc.args...); code != tc.want {
+			t.Errorf("%s: code=%d, want %d", tc.name, code, tc.want)
+		}
+	}
+
+	code, out := run("--config", cfgPath, "--json", "which", "git@gitlab.com:other/app.git")
+	var payload errorPayload
+	if err := json.Unmarshal([]byte(out), &payload); err != nil || payload.Code != code || payload.Code != exitNoRule || payload.Error == "" {
+		t.Errorf("--json error: code=%d stdout=%q", code, out)
+	}
+}
+
+func TestSSHTestResolvesRemoteName(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	repo := filepath.Join(dir, "repo")
+	for _, args := range [][]string{{"init", "-q", repo}, {"-C", repo, "remote", "add", "upstream", "git@github.com:CompanyOrg/app.git"}} {
+		if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	keys := map[string]string{}
+	for _, name := range []string{"origin_key", "upstream_key"} {
+		keys[name] = filepath.Join(dir, name)
+		if err := os.WriteFile(keys[name], []byte("dummy"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfgPath := filepath.Join(dir, "config.json")
+	cfg := `{"version":1,"rules":[{"id":"any","host":"github.com","owner":"CompanyOrg","key":"` + keys["origin_key"] + `"},` +
+		`{"id":"up","host":"github.com","owner":"CompanyOrg","remote":"upstream","key":"` + keys["upstream_key"] + `"}]}`
+	if err := os.WriteFile(cfgPath, []byte(cfg), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var stdout, stderr bytes.Buffer
+	code := New(strings.NewReader(""), &stdout, &stderr).Run(context.Background(), []string{"-C", repo, "--config", cfgPath, "ssh-test", "--remote", "upstream", "--dry-run"})
+	if code != 0 || !strings.Contains(stdout.String(), keys["upstream_key"]) {
+		t.Fatalf("code=%d stdout=%q stderr=%q; want the upstream rule's key", code, stdout.String(), stderr.String())
+	}
+}
@@ -0,0 +1,216 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pavelBuzdanov/mgit/internal/config"
+	"github.com/pavelBuzdanov/mgit/internal/resolve"
+	"github.com/pavelBuzdanov/mgit/internal/sshconfig"
+	"github.com/pavelBuzdanov/mgit/internal/sshkeys"
+)
+
+func (a *App) handleExport(ctx context.Context, opts globalOptions, args []string) int {
+	if len(args) == 0 {
+		return a.fail(opts, usageError(errors.New("usage: mgit export ssh-config | gitconfig --dir DIR [--file PATH] [--name NAME]")))
+	}
+	switch args[0] {
+	case "ssh-config":
+		return a.handleExportSSHConfig(ctx, opts, args[1:])
+	case "gitconfig":
+		return a.handleExportGitConfig(ctx, opts, args[1:])
+	default:
+		return a.fail(opts, usageError(fmt.Errorf("unknown export format %q (supported: ssh-config, gitconfig)", args[0])))
+	}
+}
+
+// handleExportSSHConfig prints the rules as ssh_config Host blocks, for
+// people and tools that run plain ssh and git without mgit.
+func (a *App) handleExportSSHConfig(_ context.Context, opts globalOptions, args []string) int {
+	fs := flag.NewFlagSet("mgit export ssh-config", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	if err := fs.Parse(args); err != nil {
+		return a.fail(opts, usageError(err))
+	}
+	if fs.NArg() > 0 {
+		return a.fail(opts, usageError(errors.New("usage: mgit export ssh-config")))
+	}
+	cfg, _, err := a.loadConfig(opts)
+	if err != nil {
+		return a.fail(opts, err)
+	}
+	fmt.Fprint(a.stdout, sshconfig.Export(cfg))
+	return 0
+}
+
+// handleExportGitConfig is the reverse of import gitconfig: the catch-all
+// rule of the config in --dir becomes a git config file with its
+// core.sshCommand, email and signing key, and the includeIf "gitdir:"
+// section that loads it for every repository under the directory is
+// printed for the user's ~/.gitconfig.
+func (a *App) handleExportGitConfig(_ context.Context, opts globalOptions, args []string) int {
+	fs := flag.NewFlagSet("mgit export gitconfig", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	dirFlag := fs.String("dir", "", "")
+	file := fs.String("file", "", "")
+	name := fs.String("name", "", "")
+	if err := fs.Parse(args); err != nil {
+		return a.fail(opts, usageError(err))
+	}
+	if *dirFlag == "" || fs.NArg() > 0 {
+		return a.fail(opts, usageError(errors.New("usage: mgit export gitconfig --dir DIR [--file PATH] [--name NAME]")))
+	}
+	dir, err := config.ExpandPath(*dirFlag)
+	if err != nil {
+		return a.fail(opts, usageError(err))
+	}
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		return a.fail(opts, err)
+	}
+	cfgPath := filepath.Join(dir, config.RepoConfigRelativePath)
+	cfg, err := config.Load(cfgPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			err = fmt.Errorf("%s has no config of its own (%s); directory-scoped rules live there", dir, cfgPath)
+		}
+		return a.fail(opts, err)
+	}
+	if *file == "" {
+		*file = "~/.gitconfig-" + filepath.Base(dir)
+	}
+	target, err := config.ExpandPath(*file)
+	if err != nil {
+		return a.fail(opts, usageError(err))
+	}
+	contents, notes, err := gitContextConfig(cfg, cfgPath, *name)
+	if err != nil {
+		return a.fail(opts, err)
+	}
+	snippet := fmt.Sprintf("[includeIf %q]\n\tpath = %s\n", "gitdir:"+homeRelative(dir)+"/", homeRelative(target))
+
+	if opts.Output.Structured() {
+		a.printData(opts, map[string]any{"dir": dir, "config": cfgPath, "file": target, "contents": contents, "include": snippet, "notes": notes, "dryRun": opts.DryRun})
+	}
+	if opts.DryRun {
+		if !opts.Output.Structured() {
+			fmt.Fprintf(a.stdout, "Dry run: would write %s:\n\n%s\nand include it from ~/.gitconfig with:\n\n%s", target, contents, snippet)
+			for _, n := range notes {
+				a.infof(opts, "Note: %s\n", n)
+			}
+		}
+		return 0
+	}
+	if old, err := os.ReadFile(target); err == nil && string(old) != contents {
+		ok, err := a.confirm(opts, fmt.Sprintf("%s exists and will be replaced.", target))
+		if err != nil {
+			return a.fail(opts, err)
+		}
+		if !ok {
+			return a.fail(opts, errAborted)
+		}
+	}
+	if err := os.WriteFile(target, []byte(contents), 0o644); err != nil {
+		return a.fail(opts, err)
+	}
+	if opts.Output.Structured() {
+		return 0
+	}
+	a.infof(opts, "Wrote %s. Add this to ~/.gitconfig:\n\n", target)
+	fmt.Fprint(a.stdout, snippet)
+	for _, n := range notes {
+		a.infof(opts, "Note: %s\n", n)
+	}
+	return 0
+}
+
+// gitContextConfig renders the catch-all rule of a directory's config as a
+// git config file. git's includeIf "gitdir:" gives every repository under
+// the directory the same settings, so rules for particular hosts or owners
+// have no equivalent and are listed in the notes.
+func gitContextConfig(cfg *config.Config, cfgPath, name string) (string, []string, error) {
+	var notes []string
+	var rule *config.Rule
+	for i, r := range cfg.Rules {
+		if rule == nil && r.Host == "*" && r.Owner == "*" && r.Remote == "" && r.HasSSH() {
+			rule = &cfg.Rules[i]
+			continue
+		}
+		notes = append(notes, fmt.Sprintf("rule %s (%s/%s) not exported: git applies an includeIf to every repository under the directory, whatever its remote", r.ID, r.Host, r.Owner))
+	}
+	if rule == nil {
+		return "", notes, fmt.Errorf("%s has no catch-all rule (host \"*\", owner \"*\") to export; add one with mgit rule add --host '*' --owner '*' --key KEY", cfgPath)
+	}
+	if sshkeys.IsProviderRef(rule.Key) {
+		return "", notes, fmt.Errorf("rule %s: key is fetched from %s at run time, which plain git cannot do", rule.ID, rule.Key)
+	}
+	keyPath, err := resolve.RuleKeyPath(*rule)
+	if err != nil {
+		return "", notes, err
+	}
+	client, err := config.SSHClientFor(cfg, *rule)
+	if err != nil {
+		return "", notes, err
+	}
+	if rule.UsesAgent() {
+		notes = append(notes, "the key is an ssh-agent identity; git's ssh needs SSH_AUTH_SOCK pointing at an agent holding it")
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Generated by mgit export gitconfig from %s (rule %s).\n", cfgPath, rule.ID)
+	email := rule.Email
+	if strings.ContainsAny(email, "*?[") {
+		notes = append(notes, fmt.Sprintf("email %q is a pattern, not an address; user.email left out", email))
+		email = ""
+	}
+	if name != "" || email != "" || rule.SigningKey != "" {
+		b.WriteString("[user]\n")
+		writeGitValue(&b, "name", name)
+		writeGitValue(&b, "email", email)
+	}
+	if rule.SigningKey != "" {
+		args, err := resolve.SigningArgs(*rule)
+		if err != nil {
+			return "", notes, err
+		}
+		// args is -c gpg.format=... -c user.signingkey=...
+		_, format, _ := strings.Cut(args[1], "=")
+		_, key, _ := strings.Cut(args[3], "=")
+		writeGitValue(&b, "signingkey", key)
+		fmt.Fprintf(&b, "[gpg]\n\tformat = %s\n", format)
+	}
+	b.WriteString("[core]\n")
+	writeGitValue(&b, "sshCommand", client.Command(keyPath, resolve.RuleSSHOptions(*rule)...))
+	return b.String(), notes, nil
+}
+
+// writeGitValue writes one "key = value" line of a git config section,
+// quoting the value when git would otherwise cut or change it.
+func writeGitValue(b *strings.Builder, key, value string) {
+	if value == "" {
+		return
+	}
+	if strings.ContainsAny(value, `"\;#`) || strings.TrimSpace(value) != value {
+		value = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+	}
+	fmt.Fprintf(b, "\t%s = %s\n", key, value)
+}
+
+// homeRelative writes a path under the home directory as ~/..., the way
+// people write it in ~/.gitconfig.
+func homeRelative(path string) string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	if rel, err := filepath.Rel(home, path); err == nil && rel != "." && !strings.HasPrefix(rel, "..") {
+		return "~/" + filepath.ToSlash(rel)
+	}
+	return path
+}
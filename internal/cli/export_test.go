@@ -0,0 +1,44 @@
+package cli
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pavelBuzdanov/mgit/internal/config"
+)
+
+func TestGitContextConfig(t *testing.T) {
+	cfg := &config.Config{Rules: []config.Rule{
+		{ID: "gh", Host: "github.com", Owner: "CompanyOrg", Key: "/keys/gh"},
+		{ID: "work", Host: "*", Owner: "*", Key: "/keys/id work", Email: "jo@corp.example", SigningKey: "/keys/sign.pub"},
+	}}
+	got, notes, err := gitContextConfig(cfg, "/w/.mgit/config.json", "Jo Doe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"[user]\n\tname = Jo Doe\n\temail = jo@corp.example\n\tsigningkey = /keys/sign.pub\n[gpg]\n\tformat = ssh\n",
+		"[core]\n\tsshCommand = ssh -F /dev/null -i '/keys/id work' -o IdentitiesOnly=yes\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("config lacks %q:\n%s", want, got)
+		}
+	}
+	if len(notes) != 1 || !strings.Contains(notes[0], "rule gh") {
+		t.Errorf("notes = %q, want one about rule gh", notes)
+	}
+
+	cfg.Rules = cfg.Rules[:1]
+	if _, _, err := gitContextConfig(cfg, "/w/.mgit/config.json", ""); err == nil || !strings.Contains(err.Error(), "no catch-all rule") {
+		t.Errorf("err = %v, want missing catch-all", err)
+	}
+}
+
+func TestWriteGitValueQuotes(t *testing.T) {
+	var b strings.Builder
+	writeGitValue(&b, "sshCommand", `ssh -o "ProxyCommand=nc %h 22" # x`)
+	writeGitValue(&b, "name", "")
+	if want := "\tsshCommand = \"ssh -o \\\"ProxyCommand=nc %h 22\\\" # x\"\n"; b.String() != want {
+		t.Errorf("got %q, want %q", b.String(), want)
+	}
+}
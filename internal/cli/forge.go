@@ -0,0 +1,235 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pavelBuzdanov/mgit/internal/runner"
+	"github.com/pavelBuzdanov/mgit/pkg/giturl"
+	"github.com/pavelBuzdanov/mgit/pkg/trace"
+)
+
+// forgeCLI describes a hosting CLI (gh, glab) that runs git itself.
+type forgeCLI struct {
+	name string
+	// hostEnv names the variable the tool reads its default host from.
+	hostEnv     string
+	defaultHost string
+	// hostInRepo: a three-part --repo value is HOST/OWNER/REPO (gh); for
+	// glab it is GROUP/SUBGROUP/REPO.
+	hostInRepo bool
+}
+
+var forgeCLIs = map[string]forgeCLI{
+	"gh":   {name: "gh", hostEnv: "GH_HOST", defaultHost: "github.com", hostInRepo: true},
+	"glab": {name: "glab", hostEnv: "GITLAB_HOST", defaultHost: "gitlab.com"},
+}
+
+// handleForgeCLI implements `mgit gh ...` and `mgit glab ...`: it finds the
+// repository the command is about (`repo clone <repo>`, -R/--repo, else the
+// current repository's remote), resolves it like a git remote and runs the
+// tool with the rule's GIT_SSH_COMMAND, env (e.g. GH_TOKEN) and HTTPS
+// credential settings, so the git it spawns uses the right account.
+func (a *App) handleForgeCLI(ctx context.Context, opts globalOptions, tool forgeCLI, args []string) int {
+	git := a.gitOps(opts, a.newShell(opts))
+	var remoteName, sshURL, httpsURL string
+	if spec, ok := forgeRepoArg(args); ok {
+		sshURL, httpsURL = tool.repoURLs(spec)
+	} else {
+		quiet := a.newShell(opts)
+		quiet.Stderr = io.Discard // no upstream is fine here
+		if remote, err := a.gitOps(opts, quiet).GuessDefaultRemote(ctx); err == nil {
+			if u, err := git.RemoteURL(ctx, remote); err == nil {
+				remoteName, sshURL = remote, u
+			}
+		}
+	}
+
+	env := map[string]string{}
+	var notes []string
+	if sshURL != "" {
+		var (
+			cleanup func()
+			err     error
+		)
+		notes, cleanup, err = a.forgeEnv(ctx, opts, remoteName, sshURL, httpsURL, env)
+		defer cleanup()
+		if err != nil {
+			return a.fail(opts, err)
+		}
+	} else {
+		notes = append(notes, "no repository in the arguments or the current directory; running "+tool.name+" unchanged")
+	}
+
+	if opts.DryRun {
+		if opts.Output.Structured() {
+			a.printData(opts, map[string]any{"tool": tool.name, "args": args, "remoteURL": sshURL, "env": env, "notes": notes})
+			return 0
+		}
+		fmt.Fprintf(a.stdout, "Dry run: %s %s\n", tool.name, strings.Join(args, " "))
+		if sshURL != "" {
+			fmt.Fprintf(a.stdout, "Resolved URL: %s\n", sshURL)
+		}
+		for _, k := range slices.Sorted(maps.Keys(env)) {
+			fmt.Fprintf(a.stdout, "%s=%s\n", k, env[k])
+		}
+		for _, n := range notes {
+			a.infof(opts, "Note: %s\n", n)
+		}
+		return 0
+	}
+
+	path, err := exec.LookPath(tool.name)
+	if err != nil {
+		return a.fail(opts, fmt.Errorf("%s not found in PATH: %w", tool.name, err))
+	}
+	cmd := runner.CommandContext(ctx, path, args...)
+	cmd.Dir = opts.Dir
+	cmd.Stdin = a.stdin
+	cmd.Stdout = rawWriter(a.stdout)
+	cmd.Stderr = rawWriter(a.stderr)
+	cmd.Env = os.Environ()
+	for _, k := range slices.Sorted(maps.Keys(env)) {
+		cmd.Env = append(cmd.Env, k+"="+env[k])
+	}
+	if opts.Verbose {
+		fmt.Fprintf(a.stderr, "exec: %s %s\n", path, strings.Join(args, " "))
+	}
+	done := trace.Start("exec", "cmd", path, "args", args, "env", strings.Join(slices.Sorted(maps.Keys(env)), " "))
+	err = cmd.Run()
+	done("error", errString(err))
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitCode()
+		}
+		return a.fail(opts, fmt.Errorf("run %s: %w", tool.name, err))
+	}
+	return 0
+}
+
+// forgeEnv fills env for a repository reached over SSH at sshURL or over
+// HTTPS at httpsURL (empty for an existing remote, whose URL is known): the
+// SSH rule's GIT_SSH_COMMAND and env, and the HTTPS rule's credential
+// settings as GIT_CONFIG_* variables, since the tool's git takes no -c from
+// mgit. Which protocol the tool picks is its own setting, so either may
+// resolve; it fails only when neither does. A provider-backed SSH key is
+// fetched into a temp file unless this is a dry run; the returned cleanup
+// removes it and is always non-nil.
+func (a *App) forgeEnv(ctx context.Context, opts globalOptions, remote, sshURL, httpsURL string, env map[string]string) ([]string, func(), error) {
+	var notes []string
+	cleanup := func() {}
+	res, resNotes, sshErr := a.resolveRemote(opts, remote, sshURL)
+	if sshErr == nil {
+		notes = append(notes, resNotes...)
+		if !opts.DryRun && res.KeyProvider != "" {
+			var err error
+			if cleanup, err = res.MaterializeKey(ctx); err != nil {
+				return notes, cleanup, err
+			}
+		}
+		if res.SSHSelectionApplies {
+			env["GIT_SSH_COMMAND"] = res.GITSSHCommand
+		}
+		if ruleEnv, note := a.ruleEnv(opts, remote, sshURL); len(ruleEnv) > 0 {
+			maps.Copy(env, ruleEnv)
+			notes = append(notes, note)
+		}
+		addGitConfigEnv(env, res.GitConfig)
+	}
+	if httpsURL == "" {
+		return notes, cleanup, sshErr
+	}
+	res, _, httpsErr := a.resolveRemote(opts, "", httpsURL)
+	if httpsErr == nil && len(res.GitConfig) > 0 {
+		addGitConfigEnv(env, res.GitConfig)
+		notes = append(notes, "HTTPS credential settings for "+httpsURL+" passed as GIT_CONFIG_* variables")
+		if ruleEnv, note := a.ruleEnv(opts, "", httpsURL); len(ruleEnv) > 0 {
+			maps.Copy(env, ruleEnv)
+			notes = append(notes, note)
+		}
+	}
+	if sshErr != nil {
+		if httpsErr != nil || len(env) == 0 {
+			return notes, cleanup, sshErr
+		}
+		notes = append(notes, "no SSH key for "+sshURL+": "+sshErr.Error())
+	}
+	return notes, cleanup, nil
+}
+
+// addGitConfigEnv appends key=value pairs to env as git's GIT_CONFIG_COUNT,
+// GIT_CONFIG_KEY_<n> and GIT_CONFIG_VALUE_<n> (git 2.31+).
+func addGitConfigEnv(env map[string]string, pairs []string) {
+	n, _ := strconv.Atoi(env["GIT_CONFIG_COUNT"])
+	for _, p := range pairs {
+		k, v, _ := strings.Cut(p, "=")
+		env[fmt.Sprintf("GIT_CONFIG_KEY_%d", n)] = k
+		env[fmt.Sprintf("GIT_CONFIG_VALUE_%d", n)] = v
+		n++
+	}
+	if n > 0 {
+		env["GIT_CONFIG_COUNT"] = strconv.Itoa(n)
+	}
+}
+
+// forgeRepoArg finds the repository a gh or glab command names: the value
+// of -R/--repo, or the argument after `repo clone` (and a few other repo
+// subcommands that take one).
+func forgeRepoArg(args []string) (string, bool) {
+	for i, arg := range args {
+		switch {
+		case (arg == "-R" || arg == "--repo") && i+1 < len(args):
+			return args[i+1], true
+		case strings.HasPrefix(arg, "--repo="):
+			return strings.TrimPrefix(arg, "--repo="), true
+		case strings.HasPrefix(arg, "-R") && len(arg) > 2:
+			return arg[2:], true
+		}
+	}
+	if len(args) >= 3 && args[0] == "repo" {
+		switch args[1] {
+		case "clone", "fork", "view", "sync":
+			for _, arg := range args[2:] {
+				if arg == "--" {
+					break
+				}
+				if !strings.HasPrefix(arg, "-") {
+					return arg, true
+				}
+			}
+		}
+	}
+	return "", false
+}
+
+// repoURLs turns a repository as the tool accepts it (OWNER/REPO,
+// HOST/OWNER/REPO for gh, GROUP/.../REPO for glab, or a URL) into the SSH
+// and HTTPS URLs the tool's git may use. A URL is returned as the SSH URL
+// alone: it already says which protocol is used.
+func (t forgeCLI) repoURLs(spec string) (sshURL, httpsURL string) {
+	if giturl.IsLikelyRemoteURL(spec) {
+		return spec, ""
+	}
+	host := t.defaultHost
+	if h := os.Getenv(t.hostEnv); h != "" {
+		host = h
+	}
+	path := strings.Trim(strings.TrimSuffix(spec, ".git"), "/")
+	if parts := strings.Split(path, "/"); t.hostInRepo && len(parts) == 3 {
+		host, path = parts[0], parts[1]+"/"+parts[2]
+	} else if len(parts) == 1 {
+		// gh repo clone REPO clones the user's own repo; its owner is
+		// only known to gh.
+		return "", ""
+	}
+	return "git@" + host + ":" + path + ".git", "https://" + host + "/" + path + ".git"
+}
@@ -0,0 +1,102 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestForgeRepoArg(t *testing.T) {
+	for _, tc := range []struct {
+		args []string
+		want string
+		ok   bool
+	}{
+		{[]string{"repo", "clone", "acme/app", "dir"}, "acme/app", true},
+		{[]string{"repo", "clone", "--", "acme/app"}, "", false},
+		{[]string{"pr", "list", "-R", "acme/app"}, "acme/app", true},
+		{[]string{"issue", "list", "--repo=ghe.corp/acme/app"}, "ghe.corp/acme/app", true},
+		{[]string{"pr", "list"}, "", false},
+	} {
+		got, ok := forgeRepoArg(tc.args)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("forgeRepoArg(%q) = %q, %v; want %q, %v", tc.args, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestForgeRepoURLs(t *testing.T) {
+	t.Setenv("GH_HOST", "")
+	t.Setenv("GITLAB_HOST", "")
+	for _, tc := range []struct {
+		tool, spec, ssh, https string
+	}{
+		{"gh", "acme/app", "git@github.com:acme/app.git", "https://github.com/acme/app.git"},
+		{"gh", "ghe.corp/acme/app", "git@ghe.corp:acme/app.git", "https://ghe.corp/acme/app.git"},
+		{"glab", "grp/sub/app", "git@gitlab.com:grp/sub/app.git", "https://gitlab.com/grp/sub/app.git"},
+		{"gh", "git@github.com:acme/app.git", "git@github.com:acme/app.git", ""},
+		{"gh", "app", "", ""},
+	} {
+		ssh, https := forgeCLIs[tc.tool].repoURLs(tc.spec)
+		if ssh != tc.ssh || https != tc.https {
+			t.Errorf("%s repoURLs(%q) = %q, %q; want %q, %q", tc.tool, tc.spec, ssh, https, tc.ssh, tc.https)
+		}
+	}
+}
+
+func TestAddGitConfigEnv(t *testing.T) {
+	env := map[string]string{}
+	addGitConfigEnv(env, []string{"credential.https://h.username=jdoe", "credential.https://h.helper="})
+	addGitConfigEnv(env, []string{"credential.https://h.helper=store"})
+	if env["GIT_CONFIG_COUNT"] != "3" || env["GIT_CONFIG_KEY_1"] != "credential.https://h.helper" || env["GIT_CONFIG_VALUE_1"] != "" || env["GIT_CONFIG_VALUE_2"] != "store" {
+		t.Fatalf("addGitConfigEnv() = %v", env)
+	}
+}
+
+func TestForgeCLIMaterializesProviderKey(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake provider and gh are shell scripts")
+	}
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "bin")
+	if err := os.Mkdir(bin, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "seen")
+	scripts := map[string]string{
+		"pass": "#!/bin/sh\nprintf 'KEY-FOR-%s' \"$2\"\n",
+		// Records the key file GIT_SSH_COMMAND points at while gh runs.
+		"gh": "#!/bin/sh\neval \"set -- $GIT_SSH_COMMAND\"\nwhile [ $# -gt 0 ]; do\n  if [ \"$1\" = -i ]; then printf '%s\\n' \"$2\" > " + out + "; cat \"$2\" >> " + out + "; fi\n  shift\ndone\n",
+	}
+	for name, script := range scripts {
+		if err := os.WriteFile(filepath.Join(bin, name), []byte(script), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("GH_HOST", "")
+	cfgPath := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(cfgPath, []byte(`{"version":1,"rules":[{"id":"vault","host":"github.com","owner":"*","key":"pass:ssh/work"}]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if code := New(strings.NewReader(""), &stdout, &stderr).Run(context.Background(), []string{"--config", cfgPath, "gh", "repo", "view", "acme/app"}); code != 0 {
+		t.Fatalf("gh: code=%d stderr=%q", code, stderr.String())
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("gh did not see a key file: %v", err)
+	}
+	keyPath, key, _ := strings.Cut(string(data), "\n")
+	if key != "KEY-FOR-ssh/work\n" {
+		t.Fatalf("key file seen by gh = %q, want the provider's key", key)
+	}
+	if _, err := os.Stat(keyPath); !os.IsNotExist(err) {
+		t.Fatalf("materialized key %s was not removed: %v", keyPath, err)
+	}
+}
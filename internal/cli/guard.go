@@ -0,0 +1,114 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pavelBuzdanov/mgit/internal/guard"
+	"github.com/pavelBuzdanov/mgit/internal/resolve"
+	"github.com/pavelBuzdanov/mgit/internal/runner"
+)
+
+func (a *App) handleGuard(ctx context.Context, opts globalOptions, args []string) int {
+	fs := flag.NewFlagSet("mgit guard", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	var remoteName string
+	force := fs.Bool("force", false, "")
+	fs.StringVar(&remoteName, "remote", "", "")
+	if err := fs.Parse(args); err != nil {
+		return a.fail(opts, usageError(err))
+	}
+	if remoteName == "" && fs.NArg() > 0 {
+		remoteName = fs.Arg(0)
+	}
+	git := a.gitOps(opts, a.newShell(opts))
+	if remoteName == "" {
+		guessed, err := git.GuessDefaultRemote(ctx)
+		if err != nil {
+			return a.fail(opts, usageError(fmt.Errorf("%w; use --remote <name>", err)))
+		}
+		remoteName = guessed
+	}
+	rep, err := a.checkIdentity(ctx, opts, git, remoteName)
+	if err != nil {
+		return a.fail(opts, err)
+	}
+	if opts.Output.Structured() {
+		a.printData(opts, rep)
+	} else {
+		switch {
+		case !rep.Checked:
+			a.infof(opts, "Identity guard: remote %s has no expected identity (set email/signingKey on rule %s)\n", rep.Remote, rep.RuleID)
+		case rep.OK():
+			a.infof(opts, "Identity guard: OK (remote %s, rule %s)\n", rep.Remote, rep.RuleID)
+		default:
+			a.printGuardIssues(a.stdout, rep)
+		}
+	}
+	if rep.OK() || *force {
+		return 0
+	}
+	return 1
+}
+
+// checkIdentity runs the identity guard for a remote using the rule its URL matches.
+func (a *App) checkIdentity(ctx context.Context, opts globalOptions, git *runner.GitOps, remoteName string) (guard.Report, error) {
+	cfg, _, err := a.loadConfig(opts)
+	if err != nil {
+		return guard.Report{}, err
+	}
+	rawURL, err := git.RemoteURL(ctx, remoteName)
+	if err != nil {
+		return guard.Report{}, remoteURLError(ctx, git, remoteName, err)
+	}
+	rule, err := resolve.RuleForRemote(cfg, remoteName, rawURL)
+	if err != nil {
+		return guard.Report{Remote: remoteName}, nil
+	}
+	return guard.Check(ctx, git, *rule, remoteName)
+}
+
+// guardPush applies the identity guard before a push. MGIT_GUARD=warn reports
+// mismatches without blocking; MGIT_GUARD=off skips the check.
+func (a *App) guardPush(ctx context.Context, opts globalOptions, git *runner.GitOps, remoteName string) error {
+	mode := strings.ToLower(strings.TrimSpace(os.Getenv("MGIT_GUARD")))
+	if mode == "off" {
+		return nil
+	}
+	rep, err := a.checkIdentity(ctx, opts, git, remoteName)
+	if err != nil || rep.OK() {
+		// Missing config is reported by SSH resolution; the guard only acts on real mismatches.
+		return nil
+	}
+	a.printGuardIssues(a.stderr, rep)
+	if mode == "warn" {
+		return nil
+	}
+	return errors.New("identity guard refused the push; fix the identity above or rerun with MGIT_GUARD=warn")
+}
+
+func (a *App) printGuardIssues(w io.Writer, rep guard.Report) {
+	fmt.Fprintf(w, "Identity guard: mismatch for remote %s (rule %s)\n", rep.Remote, rep.RuleID)
+	for _, issue := range rep.Issues {
+		switch issue.Kind {
+		case "commit-author":
+			fmt.Fprintf(w, "  commit %s authored by %q, expected %q\n", shortHash(issue.Commit), issue.Actual, issue.Expected)
+		case "email":
+			fmt.Fprintf(w, "  user.email is %q, expected %q\n", issue.Actual, issue.Expected)
+		default:
+			fmt.Fprintf(w, "  %s is %q, expected %q\n", issue.Kind, issue.Actual, issue.Expected)
+		}
+	}
+}
+
+func shortHash(h string) string {
+	if len(h) > 12 {
+		return h[:12]
+	}
+	return h
+}
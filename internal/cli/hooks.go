@@ -0,0 +1,85 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/pavelBuzdanov/mgit/internal/hooks"
+)
+
+func (a *App) handleHooks(ctx context.Context, opts globalOptions, args []string) int {
+	if len(args) == 0 {
+		a.printHooksUsage()
+		return 2
+	}
+	var apply func(dir, name string) (hooks.Result, error)
+	switch args[0] {
+	case "install":
+		apply = hooks.Install
+	case "uninstall":
+		apply = hooks.Uninstall
+	default:
+		a.printHooksUsage()
+		return 2
+	}
+	fs := flag.NewFlagSet("mgit hooks "+args[0], flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	preCommit := fs.Bool("pre-commit", false, "")
+	if err := fs.Parse(args[1:]); err != nil {
+		return a.fail(opts, usageError(err))
+	}
+	names := []string{"pre-push"}
+	if *preCommit || args[0] == "uninstall" {
+		names = append(names, "pre-commit")
+	}
+
+	git := a.gitOps(opts, a.newShell(opts))
+	dir, err := git.HooksDir(ctx)
+	if err != nil {
+		return a.fail(opts, fmt.Errorf("locate hooks directory (not a git repository?): %w", err))
+	}
+	var results []hooks.Result
+	for _, name := range names {
+		if opts.DryRun {
+			results = append(results, hooks.Result{Hook: name, Path: filepath.Join(dir, name), Action: "dry-run"})
+			continue
+		}
+		res, err := apply(dir, name)
+		if err != nil {
+			return a.fail(opts, err)
+		}
+		results = append(results, res)
+	}
+	if opts.Output.Structured() {
+		a.printData(opts, map[string]any{"hooksDir": dir, "hooks": results})
+		return 0
+	}
+	for _, r := range results {
+		switch r.Action {
+		case "chained":
+			a.infof(opts, "Installed %s (existing hook kept as %s and run first)\n", r.Path, r.Chained)
+		case "restored":
+			a.infof(opts, "Removed %s (restored previous hook)\n", r.Path)
+		case "skipped":
+			a.infof(opts, "No mgit %s hook installed\n", r.Hook)
+		case "dry-run":
+			fmt.Fprintf(a.stdout, "Dry run: %s %s\n", args[0], r.Path)
+		case "updated":
+			a.infof(opts, "Updated %s\n", r.Path)
+		case "removed":
+			a.infof(opts, "Removed %s\n", r.Path)
+		default:
+			a.infof(opts, "Installed %s\n", r.Path)
+		}
+	}
+	return 0
+}
+
+func (a *App) printHooksUsage() {
+	fmt.Fprintln(a.stdout, "Usage:")
+	fmt.Fprintln(a.stdout, "  mgit hooks install [--pre-commit]   # pre-push hook running mgit guard; existing hooks are chained")
+	fmt.Fprintln(a.stdout, "  mgit hooks uninstall")
+}
@@ -0,0 +1,350 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/pavelBuzdanov/mgit/internal/config"
+	"github.com/pavelBuzdanov/mgit/internal/doctor"
+	"github.com/pavelBuzdanov/mgit/internal/sshconfig"
+	"github.com/pavelBuzdanov/mgit/pkg/giturl"
+)
+
+// importTarget is an import bound for one config file.
+type importTarget struct {
+	Path   string        `json:"path"`
+	Import config.Import `json:"import"`
+}
+
+func (a *App) handleImport(ctx context.Context, opts globalOptions, args []string) int {
+	if len(args) == 0 {
+		return a.fail(opts, usageError(errors.New("usage: mgit import ssh-config [--file PATH] | gitconfig [--file PATH]")))
+	}
+	switch args[0] {
+	case "ssh-config":
+		return a.handleImportSSHConfig(ctx, opts, args[1:])
+	case "gitconfig":
+		return a.handleImportGitConfig(ctx, opts, args[1:])
+	default:
+		return a.fail(opts, usageError(fmt.Errorf("unknown import source %q (supported: ssh-config, gitconfig)", args[0])))
+	}
+}
+
+// handleImportSSHConfig turns the Host blocks of ~/.ssh/config that pin an
+// IdentityFile into rules, host aliases and host defaults, shows what would
+// change and merges it into the config after confirmation.
+func (a *App) handleImportSSHConfig(ctx context.Context, opts globalOptions, args []string) int {
+	fs := flag.NewFlagSet("mgit import ssh-config", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	file := fs.String("file", "", "")
+	if err := fs.Parse(args); err != nil {
+		return a.fail(opts, usageError(err))
+	}
+	if *file == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return a.fail(opts, err)
+		}
+		*file = filepath.Join(home, ".ssh", "config")
+	}
+	blocks, err := sshconfig.Load(*file)
+	if err != nil {
+		return a.fail(opts, fmt.Errorf("read ssh config: %w", err))
+	}
+	path, err := a.configPath(opts)
+	if err != nil {
+		return a.fail(opts, err)
+	}
+	return a.applyImport(opts, []importTarget{{Path: path, Import: sshconfig.ToConfig(blocks)}}, nil)
+}
+
+// handleImportGitConfig reads the conditional includes of the global git
+// config (or --file) and turns the core.sshCommand key, user.email and
+// signing key of each included file into a rule. A gitdir: include becomes
+// a catch-all rule in a config inside that directory, which mgit finds for
+// every repository below it; a hasconfig:remote.*.url: include becomes a
+// rule for the URL's host and owner in the usual config.
+func (a *App) handleImportGitConfig(ctx context.Context, opts globalOptions, args []string) int {
+	fs := flag.NewFlagSet("mgit import gitconfig", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	file := fs.String("file", "", "")
+	if err := fs.Parse(args); err != nil {
+		return a.fail(opts, usageError(err))
+	}
+	scope := "--global"
+	if *file != "" {
+		expanded, err := config.ExpandPath(*file)
+		if err != nil {
+			return a.fail(opts, usageError(err))
+		}
+		scope = "--file=" + expanded
+	}
+	git := a.gitOps(opts, a.newShell(opts))
+	includes := git.ScopedConfigEntries(ctx, scope, `^includeif\..*\.path$`)
+	if len(includes) == 0 {
+		a.infof(opts, "No includeIf sections found.\n")
+		return 0
+	}
+	defaultPath, err := a.configPath(opts)
+	if err != nil {
+		return a.fail(opts, err)
+	}
+
+	var notes []string
+	targets := map[string]*importTarget{}
+	var order []string
+	for _, inc := range includes {
+		condition := strings.TrimSuffix(strings.TrimPrefix(inc.Name, "includeif."), ".path")
+		where := fmt.Sprintf("includeIf %q", condition)
+		sc, note := includeScope(condition, filepath.Dir(inc.Origin))
+		if note != "" {
+			notes = append(notes, where+": "+note+"; skipped")
+			continue
+		}
+		included := includePath(inc.Value, filepath.Dir(inc.Origin))
+		settings := map[string]string{}
+		for _, e := range git.ScopedConfigEntries(ctx, "--file="+included, `^(core\.sshcommand|user\.email|user\.signingkey|gpg\.format)$`) {
+			settings[e.Name] = e.Value
+		}
+		keys := doctor.SSHCommandKeys(settings["core.sshcommand"])
+		if len(keys) == 0 {
+			notes = append(notes, fmt.Sprintf("%s: %s sets no core.sshCommand with a key; skipped", where, inc.Value))
+			continue
+		}
+		rule := config.Rule{
+			Host:          sc.Host,
+			Owner:         sc.Owner,
+			Key:           keys[0],
+			Email:         settings["user.email"],
+			SigningKey:    settings["user.signingkey"],
+			SigningFormat: settings["gpg.format"],
+			Description:   "imported from git " + where,
+		}
+		if rule.SigningKey == "" {
+			rule.SigningFormat = ""
+		}
+		path := defaultPath
+		if sc.Dir != "" {
+			path = filepath.Join(sc.Dir, config.RepoConfigRelativePath)
+		}
+		t, ok := targets[path]
+		if !ok {
+			t = &importTarget{Path: path}
+			targets[path] = t
+			order = append(order, path)
+		}
+		t.Import.Rules = append(t.Import.Rules, rule)
+	}
+	var list []importTarget
+	for _, path := range order {
+		list = append(list, *targets[path])
+	}
+	return a.applyImport(opts, list, notes)
+}
+
+// importScope is where an included file applies: every repository under
+// Dir, or remotes of Host and Owner.
+type importScope struct {
+	Dir         string
+	Host, Owner string
+}
+
+// includeScope maps an includeIf condition to the scope of the rule that
+// replaces it, or explains why it has none. base is the directory of the
+// file with the includeIf, for ./ patterns.
+func includeScope(condition, base string) (importScope, string) {
+	kind, pattern, _ := strings.Cut(condition, ":")
+	switch kind {
+	case "gitdir", "gitdir/i":
+		switch {
+		case strings.HasPrefix(pattern, "./"):
+			trailing := strings.HasSuffix(pattern, "/")
+			pattern = filepath.Join(base, pattern[2:])
+			if trailing {
+				pattern += "/"
+			}
+		case !strings.HasPrefix(pattern, "~/") && !strings.HasPrefix(pattern, "/"):
+			return importScope{}, "a relative gitdir pattern matches at any depth, which no directory covers"
+		}
+		dir := strings.TrimSuffix(pattern, "**")
+		if strings.HasSuffix(dir, "/") {
+			dir = strings.TrimSuffix(dir, "/")
+		} else if strings.HasSuffix(dir, "/.git") {
+			dir = strings.TrimSuffix(dir, "/.git")
+		}
+		if strings.ContainsAny(dir, "*?[") {
+			return importScope{}, "wildcards in the middle of a gitdir pattern match directories no single config covers"
+		}
+		expanded, err := config.ExpandPath(dir)
+		if err != nil {
+			return importScope{}, err.Error()
+		}
+		return importScope{Dir: expanded, Host: "*", Owner: "*"}, ""
+	case "hasconfig":
+		u, ok := strings.CutPrefix(pattern, "remote.*.url:")
+		if !ok {
+			return importScope{}, "only hasconfig:remote.*.url: conditions can be imported"
+		}
+		u = strings.TrimSuffix(strings.TrimSuffix(u, "/**"), "/*")
+		parsed, err := giturl.Parse(u + "/repo.git")
+		if err != nil || parsed.Host == "" || parsed.Owner == "" {
+			return importScope{}, fmt.Sprintf("no host and owner in URL pattern %q", u)
+		}
+		return importScope{Host: parsed.Host, Owner: parsed.Owner}, ""
+	default:
+		return importScope{}, fmt.Sprintf("%s conditions have no mgit equivalent", kind)
+	}
+}
+
+// includePath resolves an include path as git does: ~ is the home directory
+// and relative paths are relative to the including file.
+func includePath(path, base string) string {
+	if expanded, err := config.ExpandPath(path); err == nil && strings.HasPrefix(path, "~") {
+		return expanded
+	}
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(base, path)
+}
+
+// applyImport previews targets against the configs they go to, asks, and
+// merges them.
+func (a *App) applyImport(opts globalOptions, targets []importTarget, notes []string) int {
+	type plan struct {
+		Path    string   `json:"path"`
+		Changes []string `json:"changes"`
+	}
+	var plans []plan
+	total := 0
+	for _, t := range targets {
+		preview, err := config.Load(t.Path)
+		if errors.Is(err, fs.ErrNotExist) {
+			preview, err = &config.Config{Version: config.CurrentVersion}, nil
+		}
+		if err != nil {
+			return a.fail(opts, err)
+		}
+		changes, kept := mergeImport(preview, t.Import)
+		notes = append(notes, t.Import.Notes...)
+		notes = append(notes, kept...)
+		plans = append(plans, plan{Path: t.Path, Changes: changes})
+		total += len(changes)
+	}
+	if opts.Output.Structured() {
+		a.printData(opts, map[string]any{"targets": targets, "changes": plans, "notes": notes})
+	} else {
+		for _, n := range notes {
+			fmt.Fprintf(a.stderr, "note: %s\n", n)
+		}
+	}
+	if total == 0 {
+		a.infof(opts, "Nothing to import.\n")
+		return 0
+	}
+	if opts.DryRun {
+		if !opts.Output.Structured() {
+			for _, p := range plans {
+				for _, c := range p.Changes {
+					fmt.Fprintf(a.stdout, "Dry run: would add %s to %s\n", c, p.Path)
+				}
+			}
+		}
+		return 0
+	}
+	var lines []string
+	for _, p := range plans {
+		if len(p.Changes) == 0 {
+			continue
+		}
+		lines = append(lines, "This will add to "+p.Path+":")
+		for _, c := range p.Changes {
+			lines = append(lines, "  "+c)
+		}
+	}
+	ok, err := a.confirm(opts, lines...)
+	if err != nil {
+		return a.fail(opts, err)
+	}
+	if !ok {
+		return a.fail(opts, errAborted)
+	}
+	for i, t := range targets {
+		if len(plans[i].Changes) == 0 {
+			continue
+		}
+		_, statErr := os.Stat(t.Path)
+		var changes []string
+		if err := config.Update(t.Path, func(cfg *config.Config) error {
+			changes, _ = mergeImport(cfg, t.Import)
+			return nil
+		}); err != nil {
+			return a.fail(opts, err)
+		}
+		if errors.Is(statErr, fs.ErrNotExist) {
+			a.announceCreatedConfig(opts, t.Path)
+		}
+		if !opts.Output.Structured() {
+			for _, c := range changes {
+				a.infof(opts, "Added %s\n", c)
+			}
+			a.infof(opts, "Saved to %s\n", t.Path)
+		}
+	}
+	return 0
+}
+
+// mergeImport adds imp to cfg, keeping whatever cfg already says: an alias
+// or host default that exists is left alone, and so is a rule for the same
+// host and owner. It returns one line per change and notes on what was kept.
+func mergeImport(cfg *config.Config, imp config.Import) (changes, notes []string) {
+	for _, alias := range slices.Sorted(maps.Keys(imp.HostAliases)) {
+		host := imp.HostAliases[alias]
+		if existing, ok := cfg.HostAliases[alias]; ok {
+			if !strings.EqualFold(existing, host) {
+				notes = append(notes, fmt.Sprintf("hostAliases.%s is already %s; not changed to %s", alias, existing, host))
+			}
+			continue
+		}
+		if cfg.HostAliases == nil {
+			cfg.HostAliases = map[string]string{}
+		}
+		cfg.HostAliases[alias] = host
+		changes = append(changes, fmt.Sprintf("host alias %s -> %s", alias, host))
+	}
+	for _, d := range imp.HostDefaults {
+		if slices.ContainsFunc(cfg.HostDefaults, func(e config.HostDefault) bool { return strings.EqualFold(e.Host, d.Host) }) {
+			notes = append(notes, fmt.Sprintf("hostDefaults already has an entry for %s; left as is", d.Host))
+			continue
+		}
+		cfg.HostDefaults = append(cfg.HostDefaults, d)
+		changes = append(changes, fmt.Sprintf("host defaults for %s: %s", d.Host, strings.Join(d.SSHOptions(), " ")))
+	}
+	for _, r := range imp.Rules {
+		if i := slices.IndexFunc(cfg.Rules, func(e config.Rule) bool {
+			return strings.EqualFold(e.Host, r.Host) && strings.EqualFold(e.Owner, r.Owner) && e.Remote == ""
+		}); i >= 0 {
+			notes = append(notes, fmt.Sprintf("rule %s already covers host=%s owner=%s; %s not imported", cfg.Rules[i].ID, r.Host, r.Owner, r.Key))
+			continue
+		}
+		if err := config.AddRule(cfg, r, false); err != nil {
+			notes = append(notes, fmt.Sprintf("rule host=%s owner=%s: %v", r.Host, r.Owner, err))
+			continue
+		}
+		change := fmt.Sprintf("rule host=%s owner=%s key=%s", r.Host, r.Owner, r.Key)
+		if r.Email != "" {
+			change += " email=" + r.Email
+		}
+		changes = append(changes, change)
+	}
+	return changes, notes
+}
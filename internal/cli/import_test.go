@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pavelBuzdanov/mgit/internal/config"
+)
+
+func TestMergeImportKeepsExistingSettings(t *testing.T) {
+	cfg := &config.Config{
+		Version:     1,
+		HostAliases: map[string]string{"gh-work": "github.example"},
+		Rules:       []config.Rule{{ID: "mine", Host: "github.com", Owner: "*", Key: "/keys/mine"}},
+	}
+	imp := config.Import{
+		HostAliases:  map[string]string{"gh-work": "github.com", "gl": "gitlab.com"},
+		HostDefaults: []config.HostDefault{{Host: "gl", Options: []string{"HostName=gitlab.com"}}},
+		Rules: []config.Rule{
+			{Host: "github.com", Owner: "*", Key: "/keys/imported"},
+			{Host: "gitlab.com", Owner: "*", Key: "/keys/gl"},
+		},
+	}
+	changes, notes := mergeImport(cfg, imp)
+	if len(changes) != 3 || !strings.Contains(strings.Join(changes, "\n"), "rule host=gitlab.com owner=* key=/keys/gl") {
+		t.Errorf("changes = %q", changes)
+	}
+	if len(notes) != 2 {
+		t.Errorf("notes = %q", notes)
+	}
+	if cfg.HostAliases["gh-work"] != "github.example" || cfg.HostAliases["gl"] != "gitlab.com" {
+		t.Errorf("aliases = %v", cfg.HostAliases)
+	}
+	if len(cfg.Rules) != 2 || cfg.Rules[0].Key != "/keys/mine" {
+		t.Errorf("rules = %+v", cfg.Rules)
+	}
+}
+
+func TestIncludeScope(t *testing.T) {
+	home, _ := os.UserHomeDir()
+	for _, tc := range []struct {
+		condition string
+		want      importScope
+		skipped   bool
+	}{
+		{condition: "gitdir:~/work/", want: importScope{Dir: filepath.Join(home, "work"), Host: "*", Owner: "*"}},
+		{condition: "gitdir/i:/src/client/**", want: importScope{Dir: "/src/client", Host: "*", Owner: "*"}},
+		{condition: "gitdir:/src/one/.git", want: importScope{Dir: "/src/one", Host: "*", Owner: "*"}},
+		{condition: "gitdir:./work/", want: importScope{Dir: "/etc/work", Host: "*", Owner: "*"}},
+		{condition: "hasconfig:remote.*.url:git@github.com:Corp/**", want: importScope{Host: "github.com", Owner: "Corp"}},
+		{condition: "hasconfig:remote.*.url:https://gitlab.com/group/sub/**", want: importScope{Host: "gitlab.com", Owner: "group/sub"}},
+		{condition: "gitdir:work/", skipped: true},
+		{condition: "gitdir:~/src/*/client/", skipped: true},
+		{condition: "onbranch:main", skipped: true},
+	} {
+		got, note := includeScope(tc.condition, "/etc")
+		if (note != "") != tc.skipped || got != tc.want {
+			t.Errorf("includeScope(%q) = %+v, %q", tc.condition, got, note)
+		}
+	}
+}
@@ -6,9 +6,10 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
 	"strconv"
 	"strings"
+
+	"github.com/pavelBuzdanov/mgit/internal/ui"
 )
 
 type menuResult struct {
@@ -49,14 +50,14 @@ func (a *App) pickOptionInteractive(title string, items []string) (menuResult, e
 
 	r := bufio.NewReader(a.stdin)
 	for {
-		b, err := r.ReadByte()
+		k, err := readKey(r)
 		if err != nil {
 			return menuResult{}, err
 		}
-		switch b {
-		case 3: // Ctrl+C
+		switch k.Kind {
+		case keyCtrlC:
 			return menuResult{}, errors.New("cancelled")
-		case 13, 10: // Enter
+		case keyEnter:
 			if strings.TrimSpace(numberBuf) != "" {
 				n, convErr := strconv.Atoi(numberBuf)
 				if convErr == nil {
@@ -80,37 +81,21 @@ func (a *App) pickOptionInteractive(title string, items []string) (menuResult, e
 				return menuResult{Kind: "custom"}, nil
 			}
 			return menuResult{Kind: "cancel"}, nil
-		case 27: // ESC / arrow sequence
-			b2, _ := r.ReadByte()
-			if b2 != '[' {
-				numberBuf = ""
-				render()
-				continue
-			}
-			b3, _ := r.ReadByte()
-			switch b3 {
-			case 'A':
-				if selected > 0 {
-					selected--
-				} else {
-					selected = len(items) + 1
-				}
-				numberBuf = ""
-				render()
-			case 'B':
-				if selected < len(items)+1 {
-					selected++
-				} else {
-					selected = 0
-				}
-				numberBuf = ""
-				render()
-			default:
-				numberBuf = ""
+		case keyUp:
+			selected = wrapIndex(selected-1, len(items)+2)
+			numberBuf = ""
+			render()
+		case keyDown:
+			selected = wrapIndex(selected+1, len(items)+2)
+			numberBuf = ""
+			render()
+		case keyBackspace:
+			if numberBuf != "" {
+				numberBuf = numberBuf[:len(numberBuf)-1]
 				render()
 			}
-		default:
-			switch {
+		case keyRune:
+			switch b := k.Rune; {
 			case b >= '1' && b <= '9':
 				numberBuf += string(b)
 				render()
@@ -120,33 +105,96 @@ func (a *App) pickOptionInteractive(title string, items []string) (menuResult, e
 					render()
 				}
 			case b == 'k' || b == 'K':
-				if selected > 0 {
-					selected--
-				} else {
-					selected = len(items) + 1
-				}
+				selected = wrapIndex(selected-1, len(items)+2)
 				numberBuf = ""
 				render()
 			case b == 'j' || b == 'J':
-				if selected < len(items)+1 {
-					selected++
-				} else {
-					selected = 0
-				}
+				selected = wrapIndex(selected+1, len(items)+2)
 				numberBuf = ""
 				render()
 			case b == 'c' || b == 'C':
 				return menuResult{Kind: "custom"}, nil
 			case b == 'q' || b == 'Q':
 				return menuResult{Kind: "cancel"}, nil
-			case b == 127 || b == 8: // backspace
-				if numberBuf != "" {
-					numberBuf = numberBuf[:len(numberBuf)-1]
-					render()
-				}
 			}
+		default:
+			numberBuf = ""
+			render()
+		}
+	}
+}
+
+type keyKind int
+
+const (
+	keyUnknown keyKind = iota
+	keyRune
+	keyUp
+	keyDown
+	keyEnter
+	keyEscape
+	keyBackspace
+	keyCtrlC
+)
+
+type keyPress struct {
+	Kind keyKind
+	Rune rune
+}
+
+// readKey decodes one key press from a terminal in raw mode. A lone ESC is
+// told apart from an arrow sequence by whether more input is already buffered.
+func readKey(r *bufio.Reader) (keyPress, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return keyPress{}, err
+	}
+	switch {
+	case b == 3:
+		return keyPress{Kind: keyCtrlC}, nil
+	case b == 13 || b == 10:
+		return keyPress{Kind: keyEnter}, nil
+	case b == 127 || b == 8:
+		return keyPress{Kind: keyBackspace}, nil
+	case b == 27:
+		if r.Buffered() == 0 {
+			return keyPress{Kind: keyEscape}, nil
+		}
+		b2, _ := r.ReadByte()
+		if b2 != '[' && b2 != 'O' {
+			return keyPress{Kind: keyEscape}, nil
+		}
+		// Skip CSI parameters such as the "1;5" in ESC [ 1 ; 5 A (Ctrl+Up,
+		// common on Windows Terminal) or the "3" in ESC [ 3 ~ (Delete).
+		b3, _ := r.ReadByte()
+		for b3 >= 0x30 && b3 <= 0x3f && r.Buffered() > 0 {
+			b3, _ = r.ReadByte()
+		}
+		switch b3 {
+		case 'A':
+			return keyPress{Kind: keyUp}, nil
+		case 'B':
+			return keyPress{Kind: keyDown}, nil
+		}
+		return keyPress{Kind: keyUnknown}, nil
+	case b >= 0x80:
+		_ = r.UnreadByte()
+		ru, _, err := r.ReadRune()
+		if err != nil {
+			return keyPress{}, err
 		}
+		return keyPress{Kind: keyRune, Rune: ru}, nil
+	case b < 32:
+		return keyPress{Kind: keyUnknown}, nil
+	}
+	return keyPress{Kind: keyRune, Rune: rune(b)}, nil
+}
+
+func wrapIndex(i, n int) int {
+	if n <= 0 {
+		return 0
 	}
+	return ((i % n) + n) % n
 }
 
 func (a *App) pickOptionLinePrompt(title string, items []string) (menuResult, error) {
@@ -158,6 +206,9 @@ func (a *App) pickOptionLinePrompt(title string, items []string) (menuResult, er
 	fmt.Fprintf(a.stdout, "  %d) Cancel\n", len(items)+2)
 	for {
 		answer, err := a.promptLine("Choose option: ")
+		if errors.Is(err, io.EOF) {
+			return menuResult{Kind: "cancel"}, nil
+		}
 		if err != nil {
 			return menuResult{}, err
 		}
@@ -218,44 +269,6 @@ func redrawLines(w io.Writer, lines []string, lastCount *int) {
 func hideCursor(w io.Writer) { fmt.Fprint(w, "\x1b[?25l") }
 func showCursor(w io.Writer) { fmt.Fprint(w, "\x1b[?25h") }
 
-type rawTerminal struct {
-	stdin *os.File
-	state string
-}
-
-func newRawTerminal(stdin *os.File) (*rawTerminal, error) {
-	get := exec.Command("stty", "-g")
-	get.Stdin = stdin
-	out, err := get.Output()
-	if err != nil {
-		return nil, err
-	}
-	state := strings.TrimSpace(string(out))
-	set := exec.Command("stty", "raw", "-echo")
-	set.Stdin = stdin
-	if err := set.Run(); err != nil {
-		return nil, err
-	}
-	return &rawTerminal{stdin: stdin, state: state}, nil
-}
-
-func (r *rawTerminal) restore() {
-	if r == nil || r.stdin == nil || r.state == "" {
-		return
-	}
-	cmd := exec.Command("stty", r.state)
-	cmd.Stdin = r.stdin
-	_ = cmd.Run()
-}
-
 func (a *App) stdoutIsTTY() bool {
-	f, ok := a.stdout.(*os.File)
-	if !ok {
-		return false
-	}
-	info, err := f.Stat()
-	if err != nil {
-		return false
-	}
-	return (info.Mode() & os.ModeCharDevice) != 0
+	return ui.IsTerminal(a.stdout)
 }
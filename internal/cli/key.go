@@ -0,0 +1,509 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pavelBuzdanov/mgit/internal/config"
+	"github.com/pavelBuzdanov/mgit/internal/forge"
+	"github.com/pavelBuzdanov/mgit/internal/resolve"
+	"github.com/pavelBuzdanov/mgit/internal/runner"
+	"github.com/pavelBuzdanov/mgit/internal/sshkeys"
+	"github.com/pavelBuzdanov/mgit/pkg/giturl"
+)
+
+func (a *App) handleKey(ctx context.Context, opts globalOptions, args []string) int {
+	_ = ctx
+	if len(args) == 0 {
+		a.printKeyUsage()
+		return 2
+	}
+	switch args[0] {
+	case "list":
+		fs := flag.NewFlagSet("mgit key list", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		var dir string
+		noAgent := fs.Bool("no-agent", false, "")
+		fs.StringVar(&dir, "dir", "", "")
+		if err := fs.Parse(args[1:]); err != nil {
+			return a.fail(opts, usageError(err))
+		}
+		var keys []sshkeys.Candidate
+		var err error
+		if dir != "" {
+			keys, err = sshkeys.Discover(dir)
+		} else {
+			keys, err = sshkeys.DiscoverDefault()
+		}
+		if err != nil {
+			return a.fail(opts, err)
+		}
+		if !*noAgent {
+			if agentKeys, agentErr := sshkeys.DiscoverAgent(); agentErr == nil {
+				keys = sshkeys.MergeAgent(keys, agentKeys)
+			} else if opts.Verbose {
+				fmt.Fprintf(a.stderr, "warn: %v\n", agentErr)
+			}
+		}
+		if opts.Output.Structured() {
+			a.printData(opts, map[string]any{"keys": keys})
+			return 0
+		}
+		if len(keys) == 0 {
+			fmt.Fprintln(a.stdout, "No SSH keys found")
+			return 0
+		}
+		for _, k := range keys {
+			fmt.Fprintln(a.stdout, keyCandidateLabel(k))
+		}
+		return 0
+	case "generate":
+		return a.handleKeyGenerate(ctx, opts, args[1:])
+	case "upload":
+		return a.handleKeyUpload(ctx, opts, args[1:])
+	case "rotate":
+		return a.handleKeyRotate(ctx, opts, args[1:])
+	default:
+		a.printKeyUsage()
+		return 2
+	}
+}
+
+func (a *App) handleKeyGenerate(ctx context.Context, opts globalOptions, args []string) int {
+	fs := flag.NewFlagSet("mgit key generate", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	var host, owner, remoteURL, keyType, name, dir, comment, id, skProvider, rotateAfter string
+	var priority int
+	noRule := fs.Bool("no-rule", false, "")
+	noPassphrase := fs.Bool("no-passphrase", false, "")
+	fs.StringVar(&host, "host", "", "")
+	fs.StringVar(&owner, "owner", "", "")
+	fs.StringVar(&remoteURL, "url", "", "")
+	fs.StringVar(&keyType, "type", "ed25519", "")
+	fs.StringVar(&name, "name", "", "")
+	fs.StringVar(&dir, "dir", "~/.ssh", "")
+	fs.StringVar(&comment, "comment", "", "")
+	fs.StringVar(&id, "id", "", "")
+	fs.StringVar(&skProvider, "security-key-provider", "", "")
+	fs.StringVar(&rotateAfter, "rotate-after", "", "")
+	fs.IntVar(&priority, "priority", 0, "")
+	if err := fs.Parse(args); err != nil {
+		return a.fail(opts, usageError(err))
+	}
+	if rotateAfter != "" {
+		if _, err := config.ParseRotateAfter(rotateAfter); err != nil {
+			return a.fail(opts, usageError(err))
+		}
+	}
+	if remoteURL == "" && fs.NArg() > 0 {
+		remoteURL = fs.Arg(0)
+	}
+	if remoteURL != "" {
+		parsed, err := giturl.Parse(remoteURL)
+		if err != nil {
+			return a.fail(opts, usageError(fmt.Errorf("failed to parse URL %q: %w", remoteURL, err)))
+		}
+		if strings.TrimSpace(host) == "" {
+			host = parsed.Host
+		}
+		if strings.TrimSpace(owner) == "" {
+			owner = parsed.Owner
+		}
+	}
+	if strings.TrimSpace(host) == "" {
+		return a.fail(opts, usageError(errors.New("--host (or a remote URL) is required")))
+	}
+	if strings.TrimSpace(owner) == "" {
+		owner = "*"
+	}
+	if name == "" {
+		name = sshkeys.DefaultKeyName(keyType, host, owner)
+	}
+	keyDir, err := config.ExpandPath(dir)
+	if err != nil {
+		return a.fail(opts, usageError(err))
+	}
+	keyPath := filepath.Join(keyDir, name)
+	if comment == "" {
+		comment = defaultKeyComment(host, owner)
+	}
+	genArgs, err := sshkeys.GenerateArgs(sshkeys.GenerateOptions{
+		Type:    keyType,
+		Path:    keyPath,
+		Comment: comment,
+		// ssh-keygen asks for the passphrase on the terminal; without one, skip the prompt.
+		NoPassphrase:        *noPassphrase || !a.stdinIsTTY(),
+		SecurityKeyProvider: skProvider,
+	})
+	if err != nil {
+		return a.fail(opts, usageError(err))
+	}
+	if cfg, _, err := a.tryLoadConfig(opts); err == nil && !*noRule {
+		if level, msg := config.KeyTypeNameIssue(cfg, keyType, generatedKeyBits(keyType)); level == "error" {
+			return a.fail(opts, usageError(fmt.Errorf("--type %s: %s", keyType, msg)))
+		}
+	}
+	if opts.DryRun {
+		fmt.Fprintf(a.stdout, "Dry run: ssh-keygen %s\n", strings.Join(genArgs, " "))
+		return 0
+	}
+	pub, err := a.generateKeyPair(ctx, opts, keyPath, genArgs)
+	if err != nil {
+		return a.fail(opts, err)
+	}
+
+	var ruleID, cfgPath string
+	if !*noRule {
+		rule := config.Rule{
+			ID:       id,
+			Host:     host,
+			Owner:    owner,
+			Key:      keyPath,
+			Priority: priority,
+
+			SecurityKeyProvider: skProvider,
+			CreatedAt:           config.Timestamp(time.Now()),
+			RotateAfter:         rotateAfter,
+		}
+		path, err := a.updateConfig(opts, func(cfg *config.Config) error {
+			if err := config.AddRule(cfg, rule, false); err != nil {
+				return err
+			}
+			ruleID = cfg.Rules[len(cfg.Rules)-1].ID
+			return nil
+		})
+		if err != nil {
+			// Without its rule the pair is an orphan, and a retry would
+			// fail on "already exists".
+			if rmErr := sshkeys.RemoveKeyPair(keyPath); rmErr != nil {
+				err = fmt.Errorf("%w (remove the generated key: %v)", err, rmErr)
+			}
+			return a.fail(opts, err)
+		}
+		cfgPath = path
+	}
+
+	if opts.Output.Structured() {
+		payload := map[string]any{
+			"keyPath":   keyPath,
+			"publicKey": strings.TrimSpace(string(pub)),
+		}
+		if ruleID != "" {
+			payload["ruleId"] = ruleID
+			payload["configPath"] = cfgPath
+		}
+		a.printData(opts, payload)
+		return 0
+	}
+	a.infof(opts, "Generated key: %s\n", keyPath)
+	if ruleID != "" {
+		a.infof(opts, "Rule added: id=%s host=%s owner=%s key=%s\n", ruleID, host, owner, keyPath)
+		a.infof(opts, "Saved to %s\n", cfgPath)
+	}
+	a.infof(opts, "Public key (add it to your account's SSH keys):\n\n")
+	fmt.Fprint(a.stdout, string(pub))
+	return 0
+}
+
+// generateKeyPair runs ssh-keygen for keyPath and returns the new public key.
+func (a *App) generateKeyPair(ctx context.Context, opts globalOptions, keyPath string, genArgs []string) ([]byte, error) {
+	if err := sshkeys.CheckGenerateTarget(keyPath); err != nil {
+		return nil, err
+	}
+	// ssh-keygen chatter goes to stderr so stdout stays parseable with --json.
+	shell := runner.NewShell(rawWriter(a.stderr), rawWriter(a.stderr), opts.Verbose)
+	shell.Log = a.stderr
+	if err := shell.Run(ctx, "ssh-keygen", genArgs, nil); err != nil {
+		return nil, err
+	}
+	if err := sshkeys.FixPermissions(keyPath); err != nil {
+		return nil, err
+	}
+	pub, err := os.ReadFile(keyPath + ".pub")
+	if err != nil {
+		return nil, fmt.Errorf("read public key: %w", err)
+	}
+	return pub, nil
+}
+
+func (a *App) handleKeyRotate(ctx context.Context, opts globalOptions, args []string) int {
+	fs := flag.NewFlagSet("mgit key rotate", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	var ruleID, keyType, comment string
+	noPassphrase := fs.Bool("no-passphrase", false, "")
+	fs.StringVar(&ruleID, "rule", "", "")
+	fs.StringVar(&keyType, "type", "", "")
+	fs.StringVar(&comment, "comment", "", "")
+	if err := fs.Parse(args); err != nil {
+		return a.fail(opts, usageError(err))
+	}
+	if ruleID == "" {
+		return a.fail(opts, usageError(errors.New("--rule <id> is required")))
+	}
+	cfg, _, err := a.loadConfig(opts)
+	if err != nil {
+		return a.fail(opts, err)
+	}
+	idx := cfg.RuleIndex(ruleID)
+	if idx < 0 {
+		return a.fail(opts, fmt.Errorf("rule %q not found", ruleID))
+	}
+	rule := cfg.Rules[idx]
+	if rule.UsesAgent() || sshkeys.IsProviderRef(rule.Key) {
+		return a.fail(opts, fmt.Errorf("rule %q does not use a key file; rotate it where the key is stored", rule.ID))
+	}
+	oldPath, err := config.ExpandPath(rule.Key)
+	if err != nil {
+		return a.fail(opts, err)
+	}
+	if keyType == "" {
+		keyType = "ed25519"
+		if old, err := sshkeys.ReadPublicKeyFile(oldPath + ".pub"); err == nil {
+			keyType = generateTypeFor(old.Type)
+		}
+		// Rotating a key the config no longer accepts replaces its type.
+		if level, _ := config.KeyTypeNameIssue(cfg, keyType, generatedKeyBits(keyType)); level == "error" {
+			keyType = "ed25519"
+		}
+	} else if level, msg := config.KeyTypeNameIssue(cfg, keyType, generatedKeyBits(keyType)); level == "error" {
+		return a.fail(opts, usageError(fmt.Errorf("--type %s: %s", keyType, msg)))
+	}
+	if comment == "" {
+		comment = defaultKeyComment(rule.Host, rule.Owner)
+	}
+	now := time.Now()
+	newPath := rotatedKeyPath(filepath.Dir(oldPath), sshkeys.DefaultKeyName(keyType, rule.Host, rule.Owner), now)
+	genArgs, err := sshkeys.GenerateArgs(sshkeys.GenerateOptions{
+		Type:                keyType,
+		Path:                newPath,
+		Comment:             comment,
+		NoPassphrase:        *noPassphrase || !a.stdinIsTTY(),
+		SecurityKeyProvider: rule.SecurityKeyProvider,
+	})
+	if err != nil {
+		return a.fail(opts, usageError(err))
+	}
+	if opts.DryRun {
+		fmt.Fprintf(a.stdout, "Dry run: ssh-keygen %s\n", strings.Join(genArgs, " "))
+		fmt.Fprintf(a.stdout, "Dry run: rule %s key %s -> %s\n", rule.ID, oldPath, newPath)
+		return 0
+	}
+	ok, err := a.confirm(opts,
+		fmt.Sprintf("This will generate a new %s key at %s and point rule %s at it.", keyType, newPath, rule.ID),
+		fmt.Sprintf("The old key stays at %s until you remove it.", oldPath))
+	if err != nil {
+		return a.fail(opts, err)
+	}
+	if !ok {
+		return a.fail(opts, errAborted)
+	}
+	pub, err := a.generateKeyPair(ctx, opts, newPath, genArgs)
+	if err != nil {
+		return a.fail(opts, err)
+	}
+	// Swap the rule only after the new pair exists, so a failed ssh-keygen leaves the config untouched.
+	if _, err := a.updateConfig(opts, func(cfg *config.Config) error {
+		idx := cfg.RuleIndex(rule.ID)
+		if idx < 0 {
+			return fmt.Errorf("rule %s was removed concurrently; new key left at %s", rule.ID, newPath)
+		}
+		cfg.Rules[idx].Key = newPath
+		cfg.Rules[idx].CreatedAt = config.Timestamp(now)
+		return nil
+	}); err != nil {
+		return a.fail(opts, err)
+	}
+	if opts.Output.Structured() {
+		a.printData(opts, map[string]any{
+			"rule":       rule.ID,
+			"oldKeyPath": oldPath,
+			"keyPath":    newPath,
+			"publicKey":  strings.TrimSpace(string(pub)),
+		})
+		return 0
+	}
+	a.infof(opts, "Rotated rule %s: %s -> %s\n", rule.ID, oldPath, newPath)
+	a.infof(opts, "Upload the new public key, then remove the old one from the forge and disk:\n\n")
+	fmt.Fprint(a.stdout, string(pub))
+	return 0
+}
+
+// rotatedKeyPath names the key a rotation on now generates: name_YYYYMMDD in
+// dir, with a _2, _3, ... suffix when an earlier rotation that day already
+// took the name.
+func rotatedKeyPath(dir, name string, now time.Time) string {
+	base := filepath.Join(dir, name+"_"+now.Format("20060102"))
+	path := base
+	for n := 2; sshkeys.KeyPairExists(path); n++ {
+		path = fmt.Sprintf("%s_%d", base, n)
+	}
+	return path
+}
+
+// generateTypeFor maps a public key algorithm back to a key generate --type value.
+// generatedKeyBits is the size of the keys GenerateArgs makes of keyType,
+// 0 where the type fixes it.
+func generatedKeyBits(keyType string) int {
+	switch keyType {
+	case "rsa":
+		return 4096
+	case "ecdsa":
+		return 521
+	}
+	return 0
+}
+
+func generateTypeFor(algo string) string {
+	switch {
+	case algo == "ssh-rsa":
+		return "rsa"
+	case strings.HasPrefix(algo, "ecdsa-"):
+		return "ecdsa"
+	case strings.HasPrefix(algo, "sk-ssh-ed25519"):
+		return "ed25519-sk"
+	case strings.HasPrefix(algo, "sk-ecdsa-"):
+		return "ecdsa-sk"
+	default:
+		return "ed25519"
+	}
+}
+
+func (a *App) handleKeyUpload(ctx context.Context, opts globalOptions, args []string) int {
+	fs := flag.NewFlagSet("mgit key upload", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	var ruleID, provider, apiURL, title string
+	test := fs.Bool("test", false, "")
+	fs.StringVar(&ruleID, "rule", "", "")
+	fs.StringVar(&provider, "provider", "", "")
+	fs.StringVar(&apiURL, "api-url", "", "")
+	fs.StringVar(&title, "title", "", "")
+	if err := fs.Parse(args); err != nil {
+		return a.fail(opts, usageError(err))
+	}
+	if ruleID == "" {
+		return a.fail(opts, usageError(errors.New("--rule <id> is required")))
+	}
+	cfg, _, err := a.loadConfig(opts)
+	if err != nil {
+		return a.fail(opts, err)
+	}
+	idx := cfg.RuleIndex(ruleID)
+	if idx < 0 {
+		return a.fail(opts, fmt.Errorf("rule %q not found", ruleID))
+	}
+	rule := cfg.Rules[idx]
+	if provider == "" {
+		provider = forge.DetectProvider(rule.Host)
+		if provider == "" {
+			return a.fail(opts, usageError(fmt.Errorf("cannot detect forge for host %q; use --provider github|gitlab", rule.Host)))
+		}
+	}
+	if apiURL == "" {
+		host := rule.Host
+		if strings.ContainsAny(host, "*?[") {
+			host = ""
+		}
+		apiURL, err = forge.DefaultAPIURL(provider, host)
+		if err != nil {
+			return a.fail(opts, usageError(err))
+		}
+	}
+	keyPath, err := resolve.RuleKeyPath(rule)
+	if err != nil {
+		return a.fail(opts, err)
+	}
+	if sshkeys.IsProviderRef(keyPath) {
+		return a.fail(opts, fmt.Errorf("rule %q keeps its key in %s; upload the public key from there", rule.ID, sshkeys.ProviderName(keyPath)))
+	}
+	pubPath := sshkeys.PublicKeyPath(keyPath)
+	pub, err := sshkeys.ReadPublicKeyFile(pubPath)
+	if err != nil {
+		return a.fail(opts, err)
+	}
+	if title == "" {
+		title = pub.Comment
+		if title == "" {
+			title = "mgit " + rule.ID
+		}
+	}
+	if opts.DryRun {
+		fmt.Fprintf(a.stdout, "Dry run: upload %s (%s) to %s as %q\n", pubPath, pub.Fingerprint, apiURL, title)
+		return 0
+	}
+	token := forge.TokenFromEnv(provider)
+	if token == "" {
+		return a.fail(opts, fmt.Errorf("no API token found; set %s", tokenEnvHint(provider)))
+	}
+	client := &forge.Client{Provider: provider, APIURL: apiURL, Token: token}
+	uploaded, err := client.UploadKey(ctx, title, pub.PublicKey)
+	if err != nil {
+		return a.fail(opts, err)
+	}
+	if opts.Output.Structured() {
+		a.printData(opts, map[string]any{
+			"rule":        rule.ID,
+			"provider":    provider,
+			"keyId":       uploaded.ID,
+			"title":       uploaded.Title,
+			"fingerprint": pub.Fingerprint,
+		})
+	} else {
+		a.infof(opts, "Uploaded %s to %s (id=%d title=%q)\n", pub.Fingerprint, provider, uploaded.ID, uploaded.Title)
+	}
+	if !*test {
+		return 0
+	}
+	if strings.ContainsAny(rule.Host, "*?[") {
+		fmt.Fprintf(a.stderr, "warn: skipping SSH test: rule host %q is a pattern\n", rule.Host)
+		return 0
+	}
+	target := giturl.ParsedRemote{Host: rule.Host}
+	sshClient, err := config.SSHClientFor(cfg, rule)
+	if err != nil {
+		return a.fail(opts, err)
+	}
+	sshArgs := append(sshClient.Args(keyPath, resolve.WithKnownHosts(sshClient, resolve.RuleSSHOptions(rule))...), sshClient.BatchArgs()...)
+	sshArgs = append(sshArgs, "-T", target.TargetUserHost())
+	if err := a.newShell(opts).Run(ctx, sshClient.Name(), sshArgs, nil); err != nil {
+		// GitHub answers "ssh -T" with exit code 1 after successful auth.
+		if provider == forge.ProviderGitHub && hasExitCode(err, 1) {
+			return 0
+		}
+		return a.fail(opts, err)
+	}
+	return 0
+}
+
+func tokenEnvHint(provider string) string {
+	if provider == forge.ProviderGitLab {
+		return "GITLAB_TOKEN"
+	}
+	return "GITHUB_TOKEN or GH_TOKEN"
+}
+
+func defaultKeyComment(host, owner string) string {
+	user := os.Getenv("USER")
+	if user == "" {
+		user = "mgit"
+	}
+	if owner == "*" {
+		return fmt.Sprintf("%s %s", user, host)
+	}
+	return fmt.Sprintf("%s %s/%s", user, host, owner)
+}
+
+func (a *App) printKeyUsage() {
+	fmt.Fprintln(a.stdout, "Usage:")
+	fmt.Fprintln(a.stdout, "  mgit key list [--dir DIR] [--no-agent]")
+	fmt.Fprintln(a.stdout, "  mgit key generate --host <host> --owner <owner> [--type ed25519|ecdsa|rsa|ed25519-sk|ecdsa-sk] [--name NAME] [--dir DIR] [--no-passphrase] [--no-rule] [--rotate-after 180d]")
+	fmt.Fprintln(a.stdout, "  mgit key generate <remote-url> [flags]")
+	fmt.Fprintln(a.stdout, "  mgit key rotate --rule <id> [--type T] [--no-passphrase]")
+	fmt.Fprintln(a.stdout, "  mgit key upload --rule <id> [--provider github|gitlab] [--api-url URL] [--title T] [--test]")
+}
@@ -0,0 +1,301 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/pavelBuzdanov/mgit/internal/config"
+	"github.com/pavelBuzdanov/mgit/internal/runner"
+	"github.com/pavelBuzdanov/mgit/internal/sshkeys"
+)
+
+// knownHostsEntry is a host as `knownhosts add` and `knownhosts verify`
+// report it: the keys it presents and, for verify, how they compare with
+// the keys on record.
+type knownHostsEntry struct {
+	Host    string            `json:"host"`
+	Status  string            `json:"status,omitempty"`
+	Message string            `json:"message,omitempty"`
+	Keys    []sshkeys.HostKey `json:"keys,omitempty"`
+	// Changed is set when the host presents a different key of a type
+	// already on record.
+	Changed bool `json:"changed,omitempty"`
+}
+
+func (a *App) handleKnownHosts(ctx context.Context, opts globalOptions, args []string) int {
+	if len(args) == 0 {
+		a.printKnownHostsUsage()
+		return 2
+	}
+	switch args[0] {
+	case "add":
+		return a.handleKnownHostsAdd(ctx, opts, args[1:])
+	case "verify":
+		return a.handleKnownHostsVerify(ctx, opts, args[1:])
+	default:
+		a.printKnownHostsUsage()
+		return 2
+	}
+}
+
+func (a *App) handleKnownHostsAdd(ctx context.Context, opts globalOptions, args []string) int {
+	fs := flag.NewFlagSet("mgit knownhosts add", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	port := fs.String("port", "", "")
+	if err := fs.Parse(args); err != nil {
+		return a.fail(opts, usageError(err))
+	}
+	if fs.NArg() == 0 {
+		return a.fail(opts, usageError(errors.New("usage: mgit knownhosts add [--port N] <host>...")))
+	}
+	path, err := config.KnownHostsPath()
+	if err != nil {
+		return a.fail(opts, err)
+	}
+	known, err := config.ReadKnownHosts(path)
+	if err != nil {
+		return a.fail(opts, err)
+	}
+	var entries []knownHostsEntry
+	for _, host := range fs.Args() {
+		name := sshkeys.KnownHostName(host, *port)
+		keys, err := a.keyscan(ctx, opts, name)
+		if err != nil {
+			return a.fail(opts, err)
+		}
+		entry := knownHostsEntry{Host: name, Keys: keys, Status: "added"}
+		switch old := hostKeysOf(known, name); {
+		case sameHostKeys(old, keys):
+			entry.Status, entry.Message = "unchanged", "already known"
+		case len(old) > 0:
+			entry.Status, entry.Message = "replaced", fmt.Sprintf("replaces the %d key(s) on record", len(old))
+			entry.Changed = changedHostKey(old, keys) != ""
+		}
+		if !opts.Output.Structured() {
+			fmt.Fprintf(a.stdout, "Host keys of %s:\n", name)
+			for _, k := range keys {
+				fmt.Fprintf(a.stdout, "  %-20s %s\n", k.Type, k.Fingerprint)
+			}
+		}
+		if entry.Changed {
+			fmt.Fprintf(a.stderr, "warn: %s presents a different host key than the one on record (%s); make sure the host really changed its key\n", name, changedHostKey(hostKeysOf(known, name), keys))
+		}
+		entries = append(entries, entry)
+	}
+
+	var changes []string
+	for _, e := range entries {
+		if e.Status != "unchanged" {
+			changes = append(changes, fmt.Sprintf("Add %d host key(s) for %s to %s", len(e.Keys), e.Host, path))
+		}
+	}
+	if len(changes) > 0 && !opts.Output.Structured() {
+		a.infof(opts, "Compare the fingerprints with the ones the host publishes before trusting them.\n")
+	}
+	if len(changes) > 0 && !opts.DryRun {
+		ok, err := a.confirm(opts, changes...)
+		if err != nil {
+			return a.fail(opts, err)
+		}
+		if !ok {
+			return a.fail(opts, errAborted)
+		}
+		for _, e := range entries {
+			if e.Status == "unchanged" {
+				continue
+			}
+			if err := config.SetKnownHostKeys(path, e.Host, e.Keys); err != nil {
+				return a.fail(opts, err)
+			}
+		}
+	}
+	if opts.Output.Structured() {
+		a.printData(opts, map[string]any{"path": path, "dryRun": opts.DryRun, "hosts": entries})
+		return 0
+	}
+	for _, e := range entries {
+		switch {
+		case e.Status == "unchanged":
+			a.infof(opts, "%s: already known\n", e.Host)
+		case opts.DryRun:
+			a.infof(opts, "Would add %d host key(s) for %s to %s (dry-run)\n", len(e.Keys), e.Host, path)
+		default:
+			a.infof(opts, "Added %d host key(s) for %s to %s\n", len(e.Keys), e.Host, path)
+		}
+	}
+	return 0
+}
+
+func (a *App) handleKnownHostsVerify(ctx context.Context, opts globalOptions, args []string) int {
+	fs := flag.NewFlagSet("mgit knownhosts verify", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	port := fs.String("port", "", "")
+	if err := fs.Parse(args); err != nil {
+		return a.fail(opts, usageError(err))
+	}
+	path, err := config.KnownHostsPath()
+	if err != nil {
+		return a.fail(opts, err)
+	}
+	known, err := config.ReadKnownHosts(path)
+	if err != nil {
+		return a.fail(opts, err)
+	}
+	var names []string
+	for _, k := range known {
+		if !slices.Contains(names, k.Host) {
+			names = append(names, k.Host)
+		}
+	}
+	if fs.NArg() > 0 {
+		var selected []string
+		for _, host := range fs.Args() {
+			name := sshkeys.KnownHostName(host, *port)
+			if !slices.Contains(names, name) {
+				return a.fail(opts, fmt.Errorf("%s has no host keys in %s; add them with: mgit knownhosts add %s", name, path, knownHostsAddArgs(name)))
+			}
+			selected = append(selected, name)
+		}
+		names = selected
+	}
+
+	var entries []knownHostsEntry
+	failed := false
+	for _, name := range names {
+		entry := knownHostsEntry{Host: name, Status: "ok"}
+		old := hostKeysOf(known, name)
+		keys, err := a.keyscan(ctx, opts, name)
+		switch {
+		case err != nil:
+			entry.Status, entry.Message = "error", err.Error()
+		case changedHostKey(old, keys) != "":
+			entry.Status, entry.Changed = "error", true
+			entry.Message = "host key changed: " + changedHostKey(old, keys) + "; if the host announced the change, run: mgit knownhosts add " + knownHostsAddArgs(name)
+		case !anyHostKey(old, keys):
+			entry.Status = "error"
+			entry.Message = "host presents none of the key types on record; if the host announced the change, run: mgit knownhosts add " + knownHostsAddArgs(name)
+		default:
+			entry.Message = fmt.Sprintf("%d key(s) match", len(old))
+		}
+		entry.Keys = keys
+		failed = failed || entry.Status != "ok"
+		entries = append(entries, entry)
+	}
+	if opts.Output.Structured() {
+		a.printData(opts, map[string]any{"path": path, "hosts": entries})
+	} else {
+		if len(entries) == 0 {
+			fmt.Fprintf(a.stdout, "No hosts in %s; add one with: mgit knownhosts add <host>\n", path)
+		}
+		color := a.color(opts)
+		for _, e := range entries {
+			fmt.Fprintf(a.stdout, "[%s] %s: %s\n", color.Level(e.Status), e.Host, e.Message)
+		}
+	}
+	if failed {
+		return exitFailure
+	}
+	return 0
+}
+
+// keyscan runs ssh-keyscan for name, a host or [host]:port as known_hosts
+// writes it, and returns the host keys it reports.
+func (a *App) keyscan(ctx context.Context, opts globalOptions, name string) ([]sshkeys.HostKey, error) {
+	host, port := name, ""
+	if h, p, ok := strings.Cut(strings.TrimPrefix(name, "["), "]:"); ok && strings.HasPrefix(name, "[") {
+		host, port = h, p
+	}
+	args := []string{"-T", "10"}
+	if port != "" {
+		args = append(args, "-p", port)
+	}
+	args = append(args, host)
+	var stderr bytes.Buffer
+	shell := runner.NewShell(io.Discard, &stderr, opts.Verbose)
+	shell.Log = a.stderr
+	out, err := shell.Output(ctx, "ssh-keyscan", args, nil)
+	var keys []sshkeys.HostKey
+	for _, k := range sshkeys.ParseHostKeys(out) {
+		if k.Host == name {
+			keys = append(keys, k)
+		}
+	}
+	if err == nil && len(keys) > 0 {
+		return keys, nil
+	}
+	var reason []string
+	for _, line := range strings.Split(stderr.String(), "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			reason = append(reason, line)
+		}
+	}
+	if err == nil {
+		err = fmt.Errorf("ssh-keyscan found no host keys for %s", name)
+	}
+	if len(reason) > 0 {
+		err = fmt.Errorf("%w: %s", err, strings.Join(reason, "; "))
+	}
+	return nil, err
+}
+
+// knownHostsAddArgs are the arguments of `mgit knownhosts add` for name.
+func knownHostsAddArgs(name string) string {
+	if h, p, ok := strings.Cut(strings.TrimPrefix(name, "["), "]:"); ok && strings.HasPrefix(name, "[") {
+		return "--port " + p + " " + runner.ShellArg(h)
+	}
+	return runner.ShellArg(name)
+}
+
+func hostKeysOf(keys []sshkeys.HostKey, name string) []sshkeys.HostKey {
+	var out []sshkeys.HostKey
+	for _, k := range keys {
+		if k.Host == name {
+			out = append(out, k)
+		}
+	}
+	return out
+}
+
+func sameHostKeys(a, b []sshkeys.HostKey) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, k := range a {
+		if !slices.ContainsFunc(b, func(o sshkeys.HostKey) bool { return o.Key == k.Key }) {
+			return false
+		}
+	}
+	return true
+}
+
+// anyHostKey reports whether the host presents at least one key on record.
+func anyHostKey(old, scanned []sshkeys.HostKey) bool {
+	return slices.ContainsFunc(scanned, func(k sshkeys.HostKey) bool {
+		return slices.ContainsFunc(old, func(o sshkeys.HostKey) bool { return o.Key == k.Key })
+	})
+}
+
+// changedHostKey describes the first key type on record for which the host
+// now presents a different key, or returns "" when there is none. New key
+// types alone are not a change: hosts add them over time.
+func changedHostKey(old, scanned []sshkeys.HostKey) string {
+	for _, k := range scanned {
+		i := slices.IndexFunc(old, func(o sshkeys.HostKey) bool { return o.Type == k.Type })
+		if i >= 0 && !slices.ContainsFunc(old, func(o sshkeys.HostKey) bool { return o.Type == k.Type && o.Key == k.Key }) {
+			return fmt.Sprintf("%s key is %s, was %s", k.Type, k.Fingerprint, old[i].Fingerprint)
+		}
+	}
+	return ""
+}
+
+func (a *App) printKnownHostsUsage() {
+	fmt.Fprintln(a.stdout, "Usage:")
+	fmt.Fprintln(a.stdout, "  mgit knownhosts add [--port N] <host>...    # scan, show fingerprints, confirm, record")
+	fmt.Fprintln(a.stdout, "  mgit knownhosts verify [--port N] [<host>...]  # check recorded hosts for changed keys")
+}
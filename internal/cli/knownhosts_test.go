@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/pavelBuzdanov/mgit/internal/config"
+)
+
+func TestKnownHostsAddAndVerify(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell script ssh-keyscan")
+	}
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "config"))
+	// The fake ssh-keyscan reports the key in $HOST_KEY for its last argument.
+	script := "#!/bin/sh\nfor a; do host=$a; done\necho \"$host ssh-ed25519 $HOST_KEY\"\n"
+	if err := os.WriteFile(filepath.Join(dir, "ssh-keyscan"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	run := func(key string, args ...string) (int, string) {
+		t.Setenv("HOST_KEY", key)
+		var stdout, stderr bytes.Buffer
+		code := New(strings.NewReader(""), &stdout, &stderr).Run(context.Background(), args)
+		return code, stdout.String() + stderr.String()
+	}
+	const (
+		oldKey = "AAAAC3NzaC1lZDI1NTE5AAAAIDZEsmwrZQYbOtVJ0yfiERS6xC1mKVyLYE5jxoh24Le4"
+		newKey = "AAAAC3NzaC1lZDI1NTE5AAAAIBajzHANRIMR5APDyBREt7qH7A/M5JbfHQo+Hg4Tv7G5"
+	)
+
+	if code, out := run(oldKey, "knownhosts", "add", "git.corp.example"); code != 0 || !strings.Contains(out, "SHA256:AzErAd2Rs97WgT1/BP+mDdCjVyW8Bu23Zmqtd0q+GtA") {
+		t.Fatalf("add: code=%d, output lacks the fingerprint:\n%s", code, out)
+	}
+	path, err := config.KnownHostsPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(path); err != nil || !strings.Contains(string(data), "git.corp.example ssh-ed25519 "+oldKey) {
+		t.Fatalf("known_hosts = %q, %v; want the scanned key", data, err)
+	}
+	if opt := config.KnownHostsOption(); !strings.HasSuffix(opt, " "+path) {
+		t.Errorf("KnownHostsOption() = %q, want it to name %s", opt, path)
+	}
+	if code, out := run(oldKey, "knownhosts", "verify"); code != 0 || !strings.Contains(out, "[OK] git.corp.example") {
+		t.Fatalf("verify with the same key: code=%d\n%s", code, out)
+	}
+	if code, out := run(newKey, "knownhosts", "verify"); code != exitFailure || !strings.Contains(out, "host key changed") {
+		t.Fatalf("verify with a changed key: code=%d\n%s", code, out)
+	}
+	if code, out := run(newKey, "--dry-run", "knownhosts", "add", "git.corp.example"); code != 0 || !strings.Contains(out, "different host key") {
+		t.Fatalf("add of a changed key: code=%d, want a warning\n%s", code, out)
+	}
+	if code, _ := run(oldKey, "knownhosts", "verify"); code != 0 {
+		t.Fatalf("--dry-run add replaced the recorded key")
+	}
+}
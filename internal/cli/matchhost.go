@@ -0,0 +1,274 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/pavelBuzdanov/mgit/internal/config"
+	"github.com/pavelBuzdanov/mgit/internal/resolve"
+	"github.com/pavelBuzdanov/mgit/internal/runner"
+	"github.com/pavelBuzdanov/mgit/internal/sshkeys"
+	"github.com/pavelBuzdanov/mgit/pkg/matcher"
+)
+
+// hostKeyChoice is the key match-host picks for a host, and why.
+type hostKeyChoice struct {
+	Host   string `json:"host"`
+	Key    string `json:"keyPath,omitempty"`
+	RuleID string `json:"ruleId,omitempty"`
+	// Remote is the current repository's remote the choice came from.
+	Remote string `json:"remote,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// handleMatchHost answers for ssh which key the rules pick for a host: the
+// key path on stdout, or with --key KEY only the exit status (0 when KEY is
+// the one). It exits 1 when no key applies. ssh runs it from `Match exec`
+// lines written by ssh-config-hook, with the cwd of the git that started
+// ssh, so a repository's remotes tell owners on one host apart.
+func (a *App) handleMatchHost(ctx context.Context, opts globalOptions, args []string) int {
+	fs := flag.NewFlagSet("mgit match-host", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	key := fs.String("key", "", "")
+	if err := fs.Parse(args); err != nil {
+		return a.fail(opts, usageError(err))
+	}
+	if fs.NArg() != 1 {
+		return a.fail(opts, usageError(errors.New("usage: mgit match-host [--key KEY] HOST")))
+	}
+	cfg, _, err := a.loadConfig(opts)
+	if err != nil {
+		// ssh runs this for every connection to the hooked hosts, also
+		// from directories with no config; it only means no key applies.
+		if opts.Verbose {
+			a.printErr(err)
+		}
+		return 1
+	}
+	quiet := a.newShell(opts)
+	quiet.Stderr = io.Discard // outside a repository is fine
+	remotes, _ := a.gitOps(opts, quiet).Remotes(ctx)
+	choice := chooseHostKey(cfg, fs.Arg(0), remotes)
+
+	if *key != "" {
+		want, err := config.ExpandPath(*key)
+		if err != nil {
+			return a.fail(opts, usageError(err))
+		}
+		if choice.Key == "" || filepath.Clean(choice.Key) != filepath.Clean(want) {
+			return 1
+		}
+		return 0
+	}
+	switch {
+	case opts.Output.Structured():
+		a.printData(opts, choice)
+	case choice.Key != "":
+		fmt.Fprintln(a.stdout, choice.Key)
+	}
+	if choice.Key == "" {
+		if opts.Verbose {
+			fmt.Fprintf(a.stderr, "%s: %s\n", choice.Host, choice.Reason)
+		}
+		return 1
+	}
+	return 0
+}
+
+// chooseHostKey picks the key for an ssh connection to host. ssh only names
+// the host, so remotes of the current repository on that host resolve it
+// first, as mgit would for the remote. Otherwise the rules for the host
+// decide when they agree on one key, or when one of them takes any owner.
+func chooseHostKey(cfg *config.Config, host string, remotes map[string]string) hostKeyChoice {
+	choice := hostKeyChoice{Host: host}
+	canonical := strings.ToLower(host)
+	if h, ok := cfg.HostAliases[host]; ok {
+		canonical = strings.ToLower(h)
+	}
+
+	var fromRemotes []hostKeyChoice
+	for _, name := range slices.Sorted(maps.Keys(remotes)) {
+		parsed, err := resolve.ParseRemote(cfg, name, remotes[name])
+		if err != nil || !parsed.IsSSH() || strings.ToLower(parsed.Host) != canonical {
+			continue
+		}
+		res, err := resolve.FromRemote(cfg, name, remotes[name])
+		if err != nil || !res.SSHSelectionApplies || res.KeyProvider != "" {
+			continue
+		}
+		c := hostKeyChoice{Host: host, Key: res.KeyPath, Remote: name}
+		if res.MatchedRule != nil && !res.Fallback {
+			c.RuleID = res.MatchedRule.ID
+		}
+		if !slices.ContainsFunc(fromRemotes, func(o hostKeyChoice) bool { return o.Key == c.Key }) {
+			fromRemotes = append(fromRemotes, c)
+		}
+	}
+	switch len(fromRemotes) {
+	case 0:
+	case 1:
+		return fromRemotes[0]
+	default:
+		choice.Reason = fmt.Sprintf("remotes %s and %s on %s use different keys", fromRemotes[0].Remote, fromRemotes[1].Remote, host)
+		return choice
+	}
+
+	var keys []string
+	var catchAll []config.Rule
+	var ids []string
+	for _, r := range cfg.Rules {
+		if !r.HasSSH() || r.Remote != "" || sshkeys.IsProviderRef(r.Key) || !matcher.MatchesHost(r, canonical) {
+			continue
+		}
+		path, err := resolve.RuleKeyPath(r)
+		if err != nil {
+			continue
+		}
+		if !slices.Contains(keys, path) {
+			keys = append(keys, path)
+			ids = append(ids, r.ID)
+		}
+		if r.Owner == "*" || r.Owner == "**" {
+			catchAll = append(catchAll, r)
+		}
+	}
+	switch {
+	case len(keys) == 0:
+		choice.Reason = "no rule for the host"
+	case len(keys) == 1:
+		choice.Key, choice.RuleID = keys[0], ids[0]
+	case len(catchAll) == 1:
+		choice.RuleID = catchAll[0].ID
+		choice.Key, _ = resolve.RuleKeyPath(catchAll[0])
+	default:
+		choice.Reason = fmt.Sprintf("rules %s choose different keys for owners on %s; run ssh from a repository with a remote there", strings.Join(ids, ", "), host)
+	}
+	return choice
+}
+
+// handleSSHConfigHook prints ssh_config Match blocks that ask match-host
+// which of the rules' keys to use, so plain ssh and git follow the rules.
+func (a *App) handleSSHConfigHook(_ context.Context, opts globalOptions, args []string) int {
+	fs := flag.NewFlagSet("mgit ssh-config-hook", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	agent := fs.Bool("agent", false, "")
+	socket := fs.String("socket", "", "")
+	if err := fs.Parse(args); err != nil {
+		return a.fail(opts, usageError(err))
+	}
+	if fs.NArg() > 0 {
+		return a.fail(opts, usageError(errors.New("usage: mgit ssh-config-hook [--agent [--socket PATH]]")))
+	}
+	if *socket != "" {
+		*agent = true
+	}
+	if *agent && *socket == "" {
+		path, err := defaultAgentSocket()
+		if err != nil {
+			return a.fail(opts, err)
+		}
+		*socket = path
+	}
+	cfg, _, err := a.loadConfig(opts)
+	if err != nil {
+		return a.fail(opts, err)
+	}
+	self, err := os.Executable()
+	if err != nil {
+		self = "mgit"
+	}
+	command := runner.ShellArg(self)
+	if config.IsEnvSource(opts.ConfigPath) {
+		command += " --config " + config.EnvSource
+	} else if opts.ConfigPath != "" {
+		path, err := config.ExpandPath(opts.ConfigPath)
+		if err != nil {
+			return a.fail(opts, usageError(err))
+		}
+		if path, err = filepath.Abs(path); err == nil {
+			command += " --config " + runner.ShellArg(path)
+		}
+	}
+	blocks, notes := matchExecBlocks(cfg, command, *socket)
+	fmt.Fprint(a.stdout, "# Generated by mgit ssh-config-hook. Add to ~/.ssh/config, after any Host\n")
+	fmt.Fprint(a.stdout, "# blocks that set HostName: ssh asks mgit which key the rules pick.\n")
+	for _, b := range blocks {
+		fmt.Fprint(a.stdout, "\n"+b)
+	}
+	for _, n := range notes {
+		a.infof(opts, "# Note: %s\n", n)
+	}
+	return 0
+}
+
+// matchExecBlocks returns one Match block per key the rules use, limited to
+// the hosts of those rules so other ssh connections don't run mgit. With
+// agentSocket, the blocks also send those connections to mgit agent.
+func matchExecBlocks(cfg *config.Config, command, agentSocket string) (blocks, notes []string) {
+	var keys []string
+	hosts := map[string][]string{}
+	for _, r := range cfg.Rules {
+		if !r.HasSSH() {
+			continue
+		}
+		if sshkeys.IsProviderRef(r.Key) {
+			notes = append(notes, fmt.Sprintf("rule %s: key %s is fetched at run time; ssh cannot use it", r.ID, r.Key))
+			continue
+		}
+		path, err := resolve.RuleKeyPath(r)
+		if err != nil {
+			notes = append(notes, fmt.Sprintf("rule %s: %v", r.ID, err))
+			continue
+		}
+		if _, ok := hosts[path]; !ok {
+			keys = append(keys, path)
+		}
+		for _, h := range append([]string{r.Host}, aliasesOf(cfg, r.Host)...) {
+			if !slices.Contains(hosts[path], h) {
+				hosts[path] = append(hosts[path], h)
+			}
+		}
+	}
+	for _, key := range keys {
+		var b strings.Builder
+		match := "Match"
+		if !slices.Contains(hosts[key], "*") {
+			match += " host " + strings.Join(hosts[key], ",")
+		}
+		fmt.Fprintf(&b, "%s exec \"%s match-host --key %s %%h\"\n", match, command, runner.ShellArg(key))
+		fmt.Fprintf(&b, "  IdentityFile %s\n  IdentitiesOnly yes\n", quoteArg(key))
+		if agentSocket != "" {
+			fmt.Fprintf(&b, "  IdentityAgent %s\n", quoteArg(agentSocket))
+		}
+		blocks = append(blocks, b.String())
+	}
+	return blocks, notes
+}
+
+// aliasesOf lists the host aliases that map to host.
+func aliasesOf(cfg *config.Config, host string) []string {
+	var aliases []string
+	for alias, h := range cfg.HostAliases {
+		if strings.EqualFold(h, host) {
+			aliases = append(aliases, alias)
+		}
+	}
+	slices.Sort(aliases)
+	return aliases
+}
+
+// quoteArg double-quotes an ssh_config argument with spaces.
+func quoteArg(s string) string {
+	if strings.ContainsAny(s, " \t") {
+		return `"` + s + `"`
+	}
+	return s
+}
@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pavelBuzdanov/mgit/internal/config"
+)
+
+func TestChooseHostKey(t *testing.T) {
+	cfg := &config.Config{
+		HostAliases: map[string]string{"gh-work": "github.com"},
+		Rules: []config.Rule{
+			{ID: "work", Host: "github.com", Owner: "CompanyOrg", Key: "/keys/work"},
+			{ID: "me", Host: "github.com", Owner: "me", Key: "/keys/me"},
+			{ID: "lab", Host: "gitlab.com", Owner: "*", Key: "/keys/lab"},
+			{ID: "lab-team", Host: "gitlab.com", Owner: "team", Key: "/keys/team"},
+			{ID: "corp", Host: "*.corp.example", Owner: "*", Key: "/keys/corp"},
+		},
+	}
+	for _, tc := range []struct {
+		name, host string
+		remotes    map[string]string
+		key, rule  string
+	}{
+		{"remote decides the owner", "github.com", map[string]string{"origin": "git@github.com:CompanyOrg/app.git"}, "/keys/work", "work"},
+		{"alias maps to the host", "gh-work", map[string]string{"origin": "git@github.com:me/app.git"}, "/keys/me", "me"},
+		{"owners disagree without a remote", "github.com", nil, "", ""},
+		{"catch-all owner wins without a remote", "gitlab.com", nil, "/keys/lab", "lab"},
+		{"wildcard host", "git.corp.example", nil, "/keys/corp", "corp"},
+		{"no rule", "example.org", nil, "", ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := chooseHostKey(cfg, tc.host, tc.remotes)
+			if got.Key != tc.key || got.RuleID != tc.rule {
+				t.Errorf("chooseHostKey(%s) = %+v, want key %q rule %q", tc.host, got, tc.key, tc.rule)
+			}
+			if got.Key == "" && got.Reason == "" {
+				t.Error("no key and no reason")
+			}
+		})
+	}
+}
+
+func TestMatchExecBlocks(t *testing.T) {
+	cfg := &config.Config{
+		HostAliases: map[string]string{"gh-work": "github.com"},
+		Rules: []config.Rule{
+			{ID: "work", Host: "github.com", Owner: "CompanyOrg", Key: "/keys/id work"},
+			{ID: "corp", Host: "*.corp.example", Owner: "*", Key: "/keys/id work"},
+			{ID: "all", Host: "*", Owner: "*", Key: "/keys/other"},
+			{ID: "vault", Host: "gitlab.com", Owner: "*", Key: "op://Private/gitlab/private key"},
+		},
+	}
+	blocks, notes := matchExecBlocks(cfg, "mgit", "")
+	want := []string{
+		"Match host github.com,gh-work,*.corp.example exec \"mgit match-host --key '/keys/id work' %h\"\n  IdentityFile \"/keys/id work\"\n  IdentitiesOnly yes\n",
+		"Match exec \"mgit match-host --key /keys/other %h\"\n  IdentityFile /keys/other\n  IdentitiesOnly yes\n",
+	}
+	if strings.Join(blocks, "|") != strings.Join(want, "|") {
+		t.Errorf("blocks:\n%s\nwant:\n%s", strings.Join(blocks, "\n"), strings.Join(want, "\n"))
+	}
+	if len(notes) != 1 || !strings.Contains(notes[0], "rule vault") {
+		t.Errorf("notes = %q, want one about rule vault", notes)
+	}
+
+	blocks, _ = matchExecBlocks(cfg, "mgit", "/run/user/1000/mgit-agent.sock")
+	if !strings.HasSuffix(blocks[0], "  IdentityAgent /run/user/1000/mgit-agent.sock\n") {
+		t.Errorf("block without IdentityAgent:\n%s", blocks[0])
+	}
+}
@@ -0,0 +1,82 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pavelBuzdanov/mgit/internal/config"
+	"github.com/pavelBuzdanov/mgit/internal/resolve"
+)
+
+// handlePin stores a pin in the repository's config, so every SSH remote
+// resolves to one rule or key whatever the rules match.
+func (a *App) handlePin(ctx context.Context, opts globalOptions, args []string) int {
+	fs := flag.NewFlagSet("mgit pin", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	key := fs.String("key", "", "")
+	rule := fs.String("rule", "", "")
+	if err := fs.Parse(args); err != nil {
+		return a.fail(opts, usageError(err))
+	}
+	pin := &config.Pin{Rule: strings.TrimSpace(*rule), Key: strings.TrimSpace(*key)}
+	if fs.NArg() > 0 || (pin.Rule == "") == (pin.Key == "") {
+		return a.fail(opts, usageError(errors.New("usage: mgit pin --key <path> | --rule <id>")))
+	}
+	path, err := a.updateConfig(opts, func(cfg *config.Config) error {
+		cfg.Pin = pin
+		for _, issue := range config.Validate(cfg) {
+			if issue.Level == "error" && strings.HasPrefix(issue.Field, "pin") {
+				return fmt.Errorf("%s: %s", issue.Field, issue.Message)
+			}
+		}
+		if opts.DryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if errors.Is(err, errDryRun) {
+		fmt.Fprintf(a.stdout, "Dry run: would pin in %s\n  %s\n", path, resolve.PinNote(pin))
+		return 0
+	}
+	if err != nil {
+		return a.fail(opts, err)
+	}
+	if opts.Output.Structured() {
+		a.printData(opts, map[string]any{"pin": pin, "configPath": path})
+		return 0
+	}
+	a.infof(opts, "%s\nSaved to %s\n", resolve.PinNote(pin), path)
+	return 0
+}
+
+// handleUnpin removes the pin, so remotes are matched against the rules
+// again.
+func (a *App) handleUnpin(ctx context.Context, opts globalOptions, args []string) int {
+	if len(args) > 0 {
+		return a.fail(opts, usageError(errors.New("usage: mgit unpin")))
+	}
+	var old *config.Pin
+	path, err := a.updateConfig(opts, func(cfg *config.Config) error {
+		old, cfg.Pin = cfg.Pin, nil
+		if old == nil || opts.DryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	switch {
+	case errors.Is(err, errDryRun) && old == nil:
+		a.infof(opts, "No pin in %s\n", path)
+		return 0
+	case errors.Is(err, errDryRun):
+		fmt.Fprintf(a.stdout, "Dry run: would remove the pin from %s\n", path)
+		return 0
+	case err != nil:
+		return a.fail(opts, err)
+	}
+	a.infof(opts, "Pin removed from %s\n", path)
+	return 0
+}
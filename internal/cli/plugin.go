@@ -0,0 +1,130 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pavelBuzdanov/mgit/internal/runner"
+	"github.com/pavelBuzdanov/mgit/internal/ui"
+	"github.com/pavelBuzdanov/mgit/pkg/trace"
+)
+
+// pluginPrefix names external subcommands: `mgit foo` runs `mgit-foo` from
+// PATH when foo is not a built-in command.
+const pluginPrefix = "mgit-"
+
+// findPlugin looks up the executable for subcommand name on PATH.
+func findPlugin(name string) (string, bool) {
+	if name == "" || strings.HasPrefix(name, "-") || strings.ContainsAny(name, `/\`) {
+		return "", false
+	}
+	path, err := exec.LookPath(pluginPrefix + name)
+	if err != nil {
+		return "", false
+	}
+	return path, true
+}
+
+// discoverPlugins lists plugin subcommand names available on PATH.
+func discoverPlugins() []string {
+	seen := map[string]bool{}
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			name := e.Name()
+			if !strings.HasPrefix(name, pluginPrefix) || e.IsDir() {
+				continue
+			}
+			if runtime.GOOS == "windows" {
+				name = strings.TrimSuffix(name, filepath.Ext(name))
+			} else if info, err := e.Info(); err != nil || info.Mode()&0o111 == 0 {
+				continue
+			}
+			if sub := strings.TrimPrefix(name, pluginPrefix); sub != "" {
+				seen[sub] = true
+			}
+		}
+	}
+	names := make([]string, 0, len(seen))
+	for n := range seen {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// pluginEnv passes the global options to a plugin. MGIT_CONFIG_PATH is the
+// config mgit itself would use, whether or not it exists yet.
+func (a *App) pluginEnv(opts globalOptions) []string {
+	env := []string{
+		"MGIT_JSON=" + boolEnv(opts.Output == ui.FormatJSON),
+		"MGIT_OUTPUT=" + string(opts.Output),
+		"MGIT_VERBOSE=" + boolEnv(opts.Verbose),
+		"MGIT_DRY_RUN=" + boolEnv(opts.DryRun),
+		"MGIT_NO_COLOR=" + boolEnv(opts.NoColor),
+		"MGIT_QUIET=" + boolEnv(opts.Quiet),
+		"MGIT_YES=" + boolEnv(opts.Yes),
+		"MGIT_SHOW_SECRETS=" + boolEnv(opts.ShowSecrets),
+	}
+	if path, err := a.configPath(opts); err == nil {
+		env = append(env, "MGIT_CONFIG_PATH="+path)
+	}
+	if opts.LogFile != "" {
+		env = append(env, "MGIT_LOG_FILE="+opts.LogFile)
+	}
+	if opts.Retry >= 0 {
+		env = append(env, "MGIT_RETRY="+strconv.Itoa(opts.Retry))
+	}
+	if exe, err := os.Executable(); err == nil {
+		env = append(env, "MGIT_BIN="+exe)
+	}
+	return env
+}
+
+func (a *App) runPlugin(ctx context.Context, opts globalOptions, path string, args []string) int {
+	cmd := runner.CommandContext(ctx, path, args...)
+	cmd.Dir = opts.Dir
+	cmd.Stdin = a.stdin
+	cmd.Stdout = rawWriter(a.stdout)
+	cmd.Stderr = rawWriter(a.stderr)
+	cmd.Env = append(os.Environ(), a.pluginEnv(opts)...)
+	if opts.Verbose {
+		fmt.Fprintf(a.stderr, "exec: %s %s\n", path, strings.Join(args, " "))
+	}
+	done := trace.Start("plugin", "path", path, "args", args)
+	err := cmd.Run()
+	done("error", errString(err))
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitCode()
+		}
+		return a.fail(opts, fmt.Errorf("run plugin %s: %w", path, err))
+	}
+	return 0
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+func boolEnv(v bool) string {
+	if v {
+		return "1"
+	}
+	return "0"
+}
@@ -0,0 +1,50 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestPluginDispatchPassesGlobalOptions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell script plugin")
+	}
+	dir := t.TempDir()
+	script := "#!/bin/sh\necho \"args=$* json=$MGIT_JSON dry=$MGIT_DRY_RUN config=$MGIT_CONFIG_PATH\"\nexit 3\n"
+	if err := os.WriteFile(filepath.Join(dir, "mgit-hello"), []byte(script), 0o755); err != nil {
+		t.Fatalf("write plugin: %v", err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	if got := discoverPlugins(); len(got) == 0 || !contains(got, "hello") {
+		t.Fatalf("discoverPlugins() = %v, want hello", got)
+	}
+	if _, ok := findPlugin("../hello"); ok {
+		t.Fatalf("findPlugin() must reject path-like names")
+	}
+
+	var stdout, stderr bytes.Buffer
+	cfg := filepath.Join(dir, "cfg.json")
+	code := New(strings.NewReader(""), &stdout, &stderr).Run(context.Background(), []string{"--json", "--config", cfg, "hello", "a", "b"})
+	if code != 3 {
+		t.Fatalf("exit code = %d, want 3 (stderr: %s)", code, stderr.String())
+	}
+	want := "args=a b json=1 dry=0 config=" + cfg
+	if got := strings.TrimSpace(stdout.String()); got != want {
+		t.Fatalf("plugin output = %q, want %q", got, want)
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
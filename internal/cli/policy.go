@@ -0,0 +1,40 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/pavelBuzdanov/mgit/internal/config"
+	"github.com/pavelBuzdanov/mgit/internal/resolve"
+	"github.com/pavelBuzdanov/mgit/pkg/giturl"
+	"github.com/pavelBuzdanov/mgit/pkg/matcher"
+)
+
+// checkPolicy refuses command when a policy entry of cfg denies it for one
+// of the destination URLs, e.g. every push URL of the remote. Destinations
+// that are not remote URLs, such as local paths, are not covered.
+func checkPolicy(cfg *config.Config, remoteName, command string, destinations []string) error {
+	if len(cfg.Policy) == 0 {
+		return nil
+	}
+	for _, rawURL := range destinations {
+		parsed, err := resolve.ParseRemote(cfg, remoteName, rawURL)
+		if err != nil {
+			continue
+		}
+		i := matcher.DeniedBy(cfg.Policy, parsed, command)
+		if i < 0 && parsed.Alias != "" {
+			alias := *parsed
+			alias.Host = parsed.Alias
+			i = matcher.DeniedBy(cfg.Policy, &alias, command)
+		}
+		if i < 0 {
+			continue
+		}
+		err = fmt.Errorf("policy violation: git %s to %s is denied by policy[%d] (%s)", command, giturl.Redact(rawURL), i, cfg.Policy[i].Deny)
+		if msg := cfg.Policy[i].Message; msg != "" {
+			err = fmt.Errorf("%w: %s", err, msg)
+		}
+		return withExitCode(exitPolicy, err)
+	}
+	return nil
+}
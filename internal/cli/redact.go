@@ -0,0 +1,263 @@
+package cli
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/pavelBuzdanov/mgit/internal/config"
+	"github.com/pavelBuzdanov/mgit/internal/sshkeys"
+)
+
+// publicHosts are the hosts of public forges, which --redact leaves alone:
+// they say nothing about who runs mgit.
+var publicHosts = []string{
+	"github.com", "ssh.github.com", "gitlab.com", "altssh.gitlab.com", "bitbucket.org", "altssh.bitbucket.org",
+	"ssh.dev.azure.com", "vs-ssh.visualstudio.com", "codeberg.org", "git.sr.ht", "gitee.com",
+}
+
+// Output fields whose values --redact masks as a whole.
+var (
+	redactKeyFields  = []string{"key", "keyPath", "signingKey", "defaultKey", "identityFile"}
+	redactUserFields = []string{"user", "httpsUser", "email", "userEmail", "username"}
+	redactHostFields = []string{"host", "alias"}
+	// publicUsers are the shared ssh users of forges, not account names.
+	publicUsers = []string{"git"}
+)
+
+// redactor masks what identifies the user in structured output: key paths,
+// user names and e-mail addresses, hosts other than public forges, and the
+// home directory. Masks are derived from a hash of the value, so the same
+// key or host gets the same mask wherever it appears.
+type redactor struct {
+	home string
+	// literals map values found anywhere in strings, longest first.
+	literals []redaction
+}
+
+type redaction struct {
+	value, mask string
+}
+
+func redactMask(kind, value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return "redacted-" + kind + "-" + hex.EncodeToString(sum[:4])
+}
+
+// setupRedaction decides whether structured output is redacted: --redact or
+// the config's redact setting, unless --show-secrets. The config is read
+// as is, without signature checks or remote rules; a config that does not
+// load only leaves its redact setting unread.
+func (a *App) setupRedaction(opts globalOptions) {
+	if opts.ShowSecrets || !opts.Output.Structured() {
+		return
+	}
+	if path, err := a.configPath(opts); err == nil {
+		if cfg, err := config.Load(path); err == nil {
+			a.redactConfig = cfg
+		}
+	}
+	a.redact = opts.Redact || (a.redactConfig != nil && a.redactConfig.Redact)
+}
+
+// redactOutput returns v, or v redacted as JSON when redaction is on.
+func (a *App) redactOutput(v any) any {
+	if !a.redact {
+		return v
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	redacted, err := newRedactor(a.redactConfig, data).redactJSON(data)
+	if err != nil {
+		return v
+	}
+	return json.RawMessage(redacted)
+}
+
+// newRedactor collects the values to mask from cfg, when loaded, and from
+// data, the encoded output.
+func newRedactor(cfg *config.Config, data []byte) *redactor {
+	r := &redactor{}
+	if home, err := os.UserHomeDir(); err == nil && len(home) > 1 {
+		r.home = filepath.Clean(home)
+	}
+	seen := map[string]bool{}
+	add := func(kind, value string) {
+		value = strings.TrimSpace(value)
+		if value == "" || value == "*" || seen[value] {
+			return
+		}
+		if kind == "user" && slices.Contains(publicUsers, value) {
+			return
+		}
+		if kind == "host" && (strings.ContainsAny(value, "*?[") || slices.Contains(publicHosts, strings.ToLower(value))) {
+			return
+		}
+		seen[value] = true
+		mask := redactMask(kind, value)
+		r.literals = append(r.literals, redaction{value, mask})
+		if kind == "key" {
+			r.literals = append(r.literals, redaction{value + ".pub", mask + ".pub"})
+			if expanded, err := config.ExpandPath(value); err == nil && expanded != value {
+				r.literals = append(r.literals, redaction{expanded, mask}, redaction{expanded + ".pub", mask + ".pub"})
+			}
+		}
+	}
+	addKey := func(key string) {
+		if key != "" && !sshkeys.IsAgentRef(key) && !sshkeys.IsProviderRef(key) && !strings.HasPrefix(key, "key::") {
+			add("key", key)
+		}
+	}
+	if cfg != nil {
+		for _, rule := range cfg.Rules {
+			add("host", rule.Host)
+			addKey(rule.Key)
+			addKey(rule.SigningKey)
+			add("user", rule.HTTPSUser)
+		}
+		addKey(cfg.DefaultKey)
+		for alias, host := range cfg.HostAliases {
+			add("host", alias)
+			add("host", host)
+		}
+		for _, d := range cfg.HostDefaults {
+			add("host", d.Host)
+			add("user", d.User)
+		}
+	}
+	_, _ = walkJSON(data, func(field, s string) string {
+		switch {
+		case slices.Contains(redactKeyFields, field):
+			addKey(s)
+		case slices.Contains(redactUserFields, field):
+			add("user", s)
+		case slices.Contains(redactHostFields, field):
+			add("host", s)
+		}
+		return s
+	})
+	slices.SortFunc(r.literals, func(x, y redaction) int { return len(y.value) - len(x.value) })
+	return r
+}
+
+// redactJSON returns data, a JSON document, with every string masked.
+func (r *redactor) redactJSON(data []byte) ([]byte, error) {
+	return walkJSON(data, func(field, s string) string {
+		if slices.Contains(redactUserFields, field) && s != "" && !slices.Contains(publicUsers, s) {
+			return redactMask("user", s)
+		}
+		return r.redactString(s)
+	})
+}
+
+func (r *redactor) redactString(s string) string {
+	for _, l := range r.literals {
+		s = replaceToken(s, l.value, l.mask)
+	}
+	if r.home != "" {
+		s = replaceToken(s, r.home, "~")
+	}
+	return s
+}
+
+// replaceToken replaces old in s where it is not part of a longer name:
+// "git.example.com" is not replaced inside "git.example.com.au".
+func replaceToken(s, old, new string) string {
+	var b strings.Builder
+	for {
+		i := strings.Index(s, old)
+		if i < 0 {
+			b.WriteString(s)
+			return b.String()
+		}
+		end := i + len(old)
+		if (i > 0 && isNameByte(s[i-1]) && isNameByte(old[0])) || (end < len(s) && isNameByte(s[end]) && isNameByte(old[len(old)-1])) {
+			b.WriteString(s[:end])
+		} else {
+			b.WriteString(s[:i] + new)
+		}
+		s = s[end:]
+	}
+}
+
+func isNameByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-' || c == '.'
+}
+
+// walkJSON re-encodes data with fn applied to every string, object keys
+// included; field is the key a value belongs to, or "" in arrays and for
+// keys. Field order is kept.
+func walkJSON(data []byte, fn func(field, s string) string) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var buf bytes.Buffer
+	if err := walkValue(dec, &buf, "", fn); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func walkValue(dec *json.Decoder, buf *bytes.Buffer, field string, fn func(field, s string) string) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	switch t := tok.(type) {
+	case json.Delim:
+		switch t {
+		case '{':
+			buf.WriteByte('{')
+			for n := 0; dec.More(); n++ {
+				k, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				if n > 0 {
+					buf.WriteByte(',')
+				}
+				key, _ := k.(string)
+				writeJSONString(buf, fn("", key))
+				buf.WriteByte(':')
+				if err := walkValue(dec, buf, key, fn); err != nil {
+					return err
+				}
+			}
+			buf.WriteByte('}')
+		case '[':
+			buf.WriteByte('[')
+			for n := 0; dec.More(); n++ {
+				if n > 0 {
+					buf.WriteByte(',')
+				}
+				if err := walkValue(dec, buf, field, fn); err != nil {
+					return err
+				}
+			}
+			buf.WriteByte(']')
+		default:
+			return fmt.Errorf("unexpected delimiter %v", t)
+		}
+		_, err := dec.Token()
+		return err
+	case string:
+		writeJSONString(buf, fn(field, t))
+	case nil:
+		buf.WriteString("null")
+	default:
+		fmt.Fprint(buf, t)
+	}
+	return nil
+}
+
+func writeJSONString(buf *bytes.Buffer, s string) {
+	data, _ := json.Marshal(s)
+	buf.Write(data)
+}
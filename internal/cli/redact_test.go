@@ -0,0 +1,61 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRedactResolveOutput(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	key := filepath.Join(home, ".ssh", "work")
+	cfgPath := filepath.Join(home, "config.json")
+	if err := os.WriteFile(cfgPath, []byte(`{"version":1,"rules":[{"id":"work","host":"git.corp.example","owner":"*","key":"`+key+`"}]}`), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	run := func(args ...string) string {
+		var stdout, stderr bytes.Buffer
+		args = append([]string{"--config", cfgPath, "--json"}, args...)
+		args = append(args, "resolve", "--url", "ssh://alice@git.corp.example/team/app.git")
+		if code := New(strings.NewReader(""), &stdout, &stderr).Run(context.Background(), args); code != 0 {
+			t.Fatalf("%v: code=%d stderr=%q", args, code, stderr.String())
+		}
+		if !json.Valid(stdout.Bytes()) {
+			t.Fatalf("%v: output is not JSON: %s", args, stdout.String())
+		}
+		return stdout.String()
+	}
+
+	out := run("--redact")
+	for _, leak := range []string{"alice", "git.corp.example", key, home} {
+		if strings.Contains(out, leak) {
+			t.Errorf("redacted output contains %q:\n%s", leak, out)
+		}
+	}
+	for _, want := range []string{redactMask("key", key), redactMask("host", "git.corp.example"), redactMask("user", "alice"), `"owner":"team"`} {
+		if !strings.Contains(strings.ReplaceAll(out, " ", ""), want) {
+			t.Errorf("redacted output lacks %q:\n%s", want, out)
+		}
+	}
+	if out := run("--redact", "--show-secrets"); !strings.Contains(out, key) {
+		t.Errorf("--show-secrets output lacks the key path:\n%s", out)
+	}
+}
+
+func TestReplaceToken(t *testing.T) {
+	for _, tc := range []struct{ s, old, want string }{
+		{"git@git.corp:x", "git.corp", "git@H:x"},
+		{"git.corp.au", "git.corp", "git.corp.au"},
+		{"-i '/h/.ssh/id' -i /h/.ssh/id_rsa", "/h/.ssh/id", "-i 'H' -i /h/.ssh/id_rsa"},
+		{"/h/me/x and /h/mexico", "/h/me", "H/x and /h/mexico"},
+	} {
+		if got := replaceToken(tc.s, tc.old, "H"); got != tc.want {
+			t.Errorf("replaceToken(%q, %q) = %q, want %q", tc.s, tc.old, got, tc.want)
+		}
+	}
+}
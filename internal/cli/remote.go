@@ -0,0 +1,162 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/pavelBuzdanov/mgit/internal/resolve"
+	"github.com/pavelBuzdanov/mgit/pkg/giturl"
+)
+
+// handleRemoteAdd runs `git remote add` and then reports whether a rule
+// covers the new remote, so a missing rule shows up now rather than as a
+// failed first push. With --auto-rule (or a yes at the prompt on a terminal)
+// it runs `rule add` for the remote's host and owner.
+func (a *App) handleRemoteAdd(ctx context.Context, opts globalOptions, gitArgs []string) int {
+	autoRule := false
+	gitArgs = slices.DeleteFunc(slices.Clone(gitArgs), func(arg string) bool {
+		if arg == "--auto-rule" {
+			autoRule = true
+			return true
+		}
+		return false
+	})
+	name, rawURL, ok := remoteAddArgs(gitArgs[2:])
+	if code := a.handleExec(ctx, opts, gitArgs); code != 0 || !ok {
+		return code
+	}
+	// Local paths and bundles are valid remotes but carry no host to match.
+	parsed, err := giturl.Parse(rawURL)
+	if err != nil {
+		return 0
+	}
+	if opts.DryRun && opts.Output.Structured() {
+		// handleExec already printed the plan as the one structured document.
+		return 0
+	}
+
+	res := a.remoteCoverage(opts, name, rawURL)
+	ruleAdded := false
+	if parsed.IsSSH() && (res == nil || res.MatchedRule == nil || res.Fallback) {
+		add, err := a.offerRule(opts, parsed, autoRule)
+		if err != nil {
+			return a.fail(opts, err)
+		}
+		if add {
+			ruleOpts := opts
+			ruleOpts.Quiet = opts.Quiet || opts.Output.Structured()
+			if code := a.handleRule(ctx, ruleOpts, []string{"add", "--url", rawURL}); code != 0 {
+				return code
+			}
+			ruleAdded = true
+			res = a.remoteCoverage(opts, name, rawURL)
+		}
+	}
+
+	if opts.Output.Structured() {
+		payload := map[string]any{
+			"remote":    name,
+			"url":       rawURL,
+			"host":      parsed.Host,
+			"owner":     parsed.Owner,
+			"covered":   res != nil && res.MatchedRule != nil && !res.Fallback,
+			"fallback":  res != nil && res.Fallback,
+			"ruleAdded": ruleAdded,
+		}
+		if res != nil && res.MatchedRule != nil && !res.Fallback {
+			payload["rule"] = res.MatchedRule.ID
+		}
+		a.printData(opts, payload)
+	}
+	return 0
+}
+
+// remoteCoverage resolves the new remote and, outside structured output,
+// prints which rule covers it. It returns nil when nothing does.
+func (a *App) remoteCoverage(opts globalOptions, name, rawURL string) *resolve.Result {
+	cfg, _, err := a.loadConfig(opts)
+	if err != nil {
+		cfg = nil
+	}
+	res, err := resolve.FromRemote(cfg, name, rawURL)
+	if err != nil {
+		res = nil
+	}
+	if opts.Output.Structured() {
+		return res
+	}
+	target := rawURL
+	if res != nil && res.Parsed != nil {
+		target = res.Parsed.Host + "/" + res.Parsed.Owner
+	}
+	switch {
+	case res != nil && res.MatchedRule != nil && !res.Fallback:
+		fmt.Fprintf(a.stdout, "Remote %s (%s) is covered by rule id=%s %s\n", name, target, res.MatchedRule.ID, ruleKeyField(*res.MatchedRule))
+	case res != nil && res.Fallback:
+		fmt.Fprintf(a.stdout, "Remote %s (%s) matches no rule; the defaultKey fallback (%s) would be used\n", name, target, res.KeyPath)
+	case res != nil && !res.Parsed.IsSSH():
+		fmt.Fprintf(a.stdout, "Remote %s (%s) uses %s; no SSH key is needed\n", name, target, res.Parsed.Transport)
+	default:
+		fmt.Fprintf(a.stdout, "Remote %s (%s) matches no rule; mgit push and fetch will fail until one does\n", name, target)
+	}
+	return res
+}
+
+// offerRule decides whether to add a rule for an uncovered remote: always
+// with --auto-rule, after asking on a terminal, and never otherwise, in
+// which case it prints the command to run.
+func (a *App) offerRule(opts globalOptions, parsed *giturl.ParsedRemote, autoRule bool) (bool, error) {
+	if opts.DryRun {
+		if autoRule || a.stdinIsTTY() {
+			a.infof(opts, "Dry run: would add a rule for host=%s owner=%s\n", parsed.Host, parsed.Owner)
+		}
+		return false, nil
+	}
+	if autoRule {
+		return true, nil
+	}
+	if !a.stdinIsTTY() {
+		if opts.Output.Structured() {
+			return false, nil
+		}
+		a.infof(opts, "Add one with: mgit rule add --url %s (or pass --auto-rule to remote add)\n", parsed.Original)
+		return false, nil
+	}
+	fmt.Fprintf(a.stderr, "Add a rule for host=%s owner=%s now? [y/N]: ", parsed.Host, parsed.Owner)
+	line, err := bufio.NewReader(a.stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return false, err
+	}
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "y", "yes":
+		return true, nil
+	}
+	return false, nil
+}
+
+// remoteAddArgs returns the name and URL from `git remote add` arguments,
+// skipping its options (-t and -m take a value).
+func remoteAddArgs(args []string) (name, rawURL string, ok bool) {
+	var pos []string
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; {
+		case arg == "--":
+			pos = append(pos, args[i+1:]...)
+			i = len(args)
+		case arg == "-t" || arg == "-m":
+			i++
+		case strings.HasPrefix(arg, "-"):
+		default:
+			pos = append(pos, arg)
+		}
+	}
+	if len(pos) != 2 {
+		return "", "", false
+	}
+	return pos[0], pos[1], true
+}
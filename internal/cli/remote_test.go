@@ -0,0 +1,47 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRemoteAddArgs(t *testing.T) {
+	name, url, ok := remoteAddArgs([]string{"-f", "-t", "main", "--tags", "upstream", "git@github.com:Other/x.git"})
+	if !ok || name != "upstream" || url != "git@github.com:Other/x.git" {
+		t.Fatalf("remoteAddArgs() = %q, %q, %v", name, url, ok)
+	}
+	if _, _, ok := remoteAddArgs([]string{"upstream"}); ok {
+		t.Fatalf("remoteAddArgs() accepted a missing URL")
+	}
+}
+
+func TestRemoteAddReportsCoverage(t *testing.T) {
+	cfgPath := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(cfgPath, []byte(`{"version":1,"rules":[{"id":"work","host":"github.com","owner":"CompanyOrg","key":"/tmp/work"}]}`), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	run := func(args ...string) string {
+		t.Helper()
+		var stdout, stderr bytes.Buffer
+		code := New(strings.NewReader(""), &stdout, &stderr).Run(context.Background(), append([]string{"--config", cfgPath, "--dry-run", "remote", "add"}, args...))
+		if code != 0 {
+			t.Fatalf("code=%d stderr=%q", code, stderr.String())
+		}
+		return stdout.String()
+	}
+
+	if out := run("origin", "git@github.com:CompanyOrg/app.git"); !strings.Contains(out, "Remote origin (github.com/CompanyOrg) is covered by rule id=work key=/tmp/work") {
+		t.Fatalf("covered remote:\n%s", out)
+	}
+	out := run("--auto-rule", "upstream", "git@github.com:Other/x.git")
+	if strings.Contains(out, "--auto-rule") || !strings.Contains(out, "Dry run: git remote add upstream git@github.com:Other/x.git") {
+		t.Fatalf("--auto-rule passed to git:\n%s", out)
+	}
+	if !strings.Contains(out, "matches no rule") || !strings.Contains(out, "Dry run: would add a rule for host=github.com owner=Other") {
+		t.Fatalf("uncovered remote:\n%s", out)
+	}
+}
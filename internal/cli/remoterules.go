@@ -0,0 +1,117 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pavelBuzdanov/mgit/internal/config"
+	"github.com/pavelBuzdanov/mgit/internal/doctor"
+)
+
+// remoteRulesResult is what loading the remote rules of one config gave,
+// kept for the rest of the run.
+type remoteRulesResult struct {
+	rules *config.RemoteRules
+	err   error
+}
+
+// withRemoteRules merges the remote rules of cfg, the config at path, below
+// its local rules. A failure to fetch them leaves the local rules alone;
+// rules not signed by a trusted key are an error unless --insecure.
+func (a *App) withRemoteRules(opts globalOptions, path string, cfg *config.Config) error {
+	if cfg.RemoteRules == "" {
+		return nil
+	}
+	res := a.remoteRulesFor(opts, path, cfg, false)
+	if res.err != nil {
+		return nil
+	}
+	if err := res.rules.SignatureErr; err != nil && !opts.Insecure {
+		return fmt.Errorf("remote rules %s: %w\nHint: pass --insecure to use them anyway", res.rules.URL, err)
+	}
+	config.MergeRemoteRules(cfg, res.rules)
+	return nil
+}
+
+// remoteRulesFor loads the remote rules of the config at path at most once
+// per run, since most commands load the config several times, and warns
+// once when they could not be fetched, or are used unsigned under
+// --insecure. refresh fetches them again.
+func (a *App) remoteRulesFor(opts globalOptions, path string, cfg *config.Config, refresh bool) remoteRulesResult {
+	a.remoteMu.Lock()
+	defer a.remoteMu.Unlock()
+	if res, ok := a.remoteRules[path]; ok && !refresh {
+		return res
+	}
+	rr, err := config.LoadRemoteRules(path, cfg, refresh)
+	switch {
+	case refresh:
+	case err != nil:
+		fmt.Fprintf(a.stderr, "warn: remote rules not loaded, using local rules only: %v\n", err)
+	case rr.SignatureErr != nil && opts.Insecure:
+		fmt.Fprintf(a.stderr, "warn: remote rules %s: %v; using them anyway (--insecure)\n", rr.URL, rr.SignatureErr)
+	case rr.FetchErr != nil:
+		fmt.Fprintf(a.stderr, "warn: using remote rules fetched %s ago: %v\n", since(rr.FetchedAt), rr.FetchErr)
+	}
+	if a.remoteRules == nil {
+		a.remoteRules = map[string]remoteRulesResult{}
+	}
+	res := remoteRulesResult{rules: rr, err: err}
+	a.remoteRules[path] = res
+	return res
+}
+
+// allowUnverified returns err, a config signature failure, except under
+// --insecure, where it is only a warning, once per run.
+func (a *App) allowUnverified(opts globalOptions, err error) error {
+	if err == nil || !opts.Insecure {
+		return err
+	}
+	a.remoteMu.Lock()
+	defer a.remoteMu.Unlock()
+	if !a.insecureWarned {
+		a.insecureWarned = true
+		fmt.Fprintf(a.stderr, "warn: %v; using it anyway (--insecure)\n", err)
+	}
+	return nil
+}
+
+// restrictConfig drops the settings of cfg, loaded from path, that run
+// programs unless it is trusted (see config.LoadVerified) or named with
+// --config, warning once per run.
+func (a *App) restrictConfig(opts globalOptions, path string, cfg *config.Config, trusted bool) {
+	if trusted || opts.ConfigPath != "" {
+		return
+	}
+	cleared := config.RestrictUntrusted(cfg)
+	if len(cleared) == 0 {
+		return
+	}
+	a.remoteMu.Lock()
+	defer a.remoteMu.Unlock()
+	if !a.untrustedWarned {
+		a.untrustedWarned = true
+		fmt.Fprintf(a.stderr, "warn: ignoring %s in %s: only the global config, --config and configs signed by a trusted key may run programs\n", strings.Join(cleared, ", "), config.DescribePath(path))
+	}
+}
+
+// remoteRulesCheck is the doctor check of the remote rules of cfg.
+func (a *App) remoteRulesCheck(opts globalOptions, path string, cfg *config.Config) doctor.Check {
+	res := a.remoteRulesFor(opts, path, cfg, false)
+	switch {
+	case res.err != nil:
+		return doctor.Check{Name: "remote-rules", Status: "error", Message: res.err.Error() + "; only local rules apply"}
+	case res.rules.SignatureErr != nil && opts.Insecure:
+		return doctor.Check{Name: "remote-rules", Status: "warn", Message: fmt.Sprintf("%v; used because of --insecure", res.rules.SignatureErr)}
+	case res.rules.SignatureErr != nil:
+		return doctor.Check{Name: "remote-rules", Status: "error", Message: fmt.Sprintf("%v; refusing the config", res.rules.SignatureErr)}
+	case res.rules.FetchErr != nil:
+		return doctor.Check{Name: "remote-rules", Status: "warn", Message: fmt.Sprintf("%v; using the copy fetched %s ago", res.rules.FetchErr, since(res.rules.FetchedAt)), Fix: "mgit config refresh"}
+	}
+	return doctor.Check{Name: "remote-rules", Status: "ok", Message: fmt.Sprintf("%d rule(s) from %s, fetched %s ago", len(res.rules.Rules), res.rules.URL, since(res.rules.FetchedAt))}
+}
+
+func since(t time.Time) time.Duration {
+	return time.Since(t).Round(time.Second)
+}
@@ -0,0 +1,142 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pavelBuzdanov/mgit/internal/config"
+	"github.com/pavelBuzdanov/mgit/internal/resolve"
+	"github.com/pavelBuzdanov/mgit/pkg/giturl"
+	"github.com/pavelBuzdanov/mgit/pkg/matcher"
+)
+
+type remoteListing struct {
+	Name      string   `json:"name"`
+	URL       string   `json:"url"`
+	PushURLs  []string `json:"pushUrls,omitempty"` // only when they differ from URL
+	Transport string   `json:"transport,omitempty"`
+	RuleID    string   `json:"ruleId,omitempty"`
+	KeyPath   string   `json:"keyPath,omitempty"`
+	Conflicts []string `json:"conflicts,omitempty"`
+}
+
+// handleRemotes lists every remote with the rule and key it resolves to and
+// the conflicts visible from the config alone: rules tying for the remote and
+// push URLs that need a different key than the fetch URL. Unlike doctor and
+// status it reads no key files beyond resolving and runs no other checks.
+func (a *App) handleRemotes(ctx context.Context, opts globalOptions, args []string) int {
+	fs := flag.NewFlagSet("mgit remotes", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	if err := fs.Parse(args); err != nil {
+		return a.fail(opts, usageError(err))
+	}
+	git := a.gitOps(opts, a.newShell(opts))
+	if ok, err := git.IsRepo(ctx); err != nil || !ok {
+		return a.fail(opts, errors.New("not a git repository"))
+	}
+	cfg, _, err := a.loadConfig(opts)
+	if err != nil {
+		return a.fail(opts, err)
+	}
+	remotes, err := git.AllRemoteURLs(ctx)
+	if err != nil {
+		return a.fail(opts, fmt.Errorf("failed to read remotes: %w", err))
+	}
+	names := make([]string, 0, len(remotes))
+	for name, urls := range remotes {
+		if urls.Fetch != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	list := []remoteListing{}
+	for _, name := range names {
+		var pushURLs []string
+		for _, u := range remotes[name].Push {
+			if u != remotes[name].Fetch {
+				pushURLs = append(pushURLs, u)
+			}
+		}
+		list = append(list, remoteListingFor(cfg, name, remotes[name].Fetch, pushURLs))
+	}
+
+	if opts.Output.Structured() {
+		a.printData(opts, list)
+		return 0
+	}
+	if len(list) == 0 {
+		fmt.Fprintln(a.stdout, "No remotes configured")
+		return 0
+	}
+	tw := tabwriter.NewWriter(a.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "REMOTE\tURL\tTRANSPORT\tRULE\tKEY\tCONFLICTS")
+	for _, r := range list {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			r.Name, r.URL, dash(r.Transport), dash(r.RuleID), dash(r.KeyPath), dash(strings.Join(r.Conflicts, "; ")))
+		for _, u := range r.PushURLs {
+			fmt.Fprintf(tw, "\t%s (push)\t\t\t\t\n", u)
+		}
+	}
+	_ = tw.Flush()
+	return 0
+}
+
+func remoteListingFor(cfg *config.Config, name, rawURL string, pushURLs []string) remoteListing {
+	rl := remoteListing{Name: name, URL: rawURL, PushURLs: pushURLs}
+	if parsed, err := giturl.Parse(rawURL); err == nil {
+		rl.Transport = string(parsed.Transport)
+	}
+	res, err := resolve.FromRemote(cfg, name, rawURL)
+	if err != nil {
+		return rl
+	}
+	switch {
+	case res.Fallback:
+		rl.RuleID = "defaultKey"
+	case res.MatchedRule != nil:
+		rl.RuleID = res.MatchedRule.ID
+	}
+	if res.SSHSelectionApplies {
+		rl.KeyPath = res.KeyPath
+	}
+	if cands, err := resolve.Candidates(cfg, name, rawURL); err == nil {
+		rl.Conflicts = append(rl.Conflicts, tiedRules(cands)...)
+	}
+	for _, u := range pushURLs {
+		push, err := resolve.FromRemote(cfg, name, u)
+		switch {
+		case err != nil:
+			rl.Conflicts = append(rl.Conflicts, fmt.Sprintf("push URL %s: %s", u, firstLine(err.Error())))
+		case push.SSHSelectionApplies != res.SSHSelectionApplies || push.GITSSHCommand != res.GITSSHCommand:
+			rl.Conflicts = append(rl.Conflicts, fmt.Sprintf("push URL %s uses %s", u, dash(push.KeyPath)))
+		}
+	}
+	return rl
+}
+
+// tiedRules names the rules that score the same as the winner among cands,
+// which then wins only by coming first in the config.
+func tiedRules(cands []matcher.Candidate) []string {
+	var winner *matcher.Candidate
+	for i := range cands {
+		if cands[i].Selected {
+			winner = &cands[i]
+		}
+	}
+	if winner == nil {
+		return nil
+	}
+	var tied []string
+	for _, c := range cands {
+		if c.Matched && !c.Selected && c.Score == winner.Score {
+			tied = append(tied, "ties with rule "+c.ID)
+		}
+	}
+	return tied
+}
@@ -0,0 +1,34 @@
+package cli
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/pavelBuzdanov/mgit/internal/config"
+)
+
+func TestRemoteListingFor(t *testing.T) {
+	cfg := &config.Config{Version: 1, Rules: []config.Rule{
+		{ID: "work", Host: "github.com", Owner: "CompanyOrg", Key: "/tmp/work"},
+		{ID: "work2", Host: "github.com", Owner: "CompanyOrg", Key: "/tmp/work2"},
+		{ID: "personal", Host: "github.com", Owner: "me", Key: "/tmp/personal"},
+	}}
+
+	rl := remoteListingFor(cfg, "origin", "git@github.com:CompanyOrg/app.git", []string{"git@github.com:me/app.git"})
+	if rl.RuleID != "work" || rl.KeyPath != "/tmp/work" || rl.Transport != "ssh" {
+		t.Fatalf("listing = %+v", rl)
+	}
+	want := []string{"ties with rule work2", "push URL git@github.com:me/app.git uses /tmp/personal"}
+	if !slices.Equal(rl.Conflicts, want) {
+		t.Errorf("conflicts = %q, want %q", rl.Conflicts, want)
+	}
+
+	rl = remoteListingFor(cfg, "upstream", "git@gitlab.com:x/app.git", nil)
+	if rl.RuleID != "" || rl.KeyPath != "" || len(rl.Conflicts) != 0 {
+		t.Errorf("unmatched listing = %+v", rl)
+	}
+	rl = remoteListingFor(cfg, "mirror", "https://github.com/me/app.git", nil)
+	if rl.Transport != "https" || rl.KeyPath != "" {
+		t.Errorf("https listing = %+v", rl)
+	}
+}
@@ -0,0 +1,547 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pavelBuzdanov/mgit/internal/config"
+	"github.com/pavelBuzdanov/mgit/internal/resolve"
+	"github.com/pavelBuzdanov/mgit/internal/sshkeys"
+	"github.com/pavelBuzdanov/mgit/pkg/matcher"
+)
+
+const ruleManageHelp = "↑/↓ select  K/J move  a add  e edit  d delete  t test URL  s save  q quit"
+
+// ruleManager is the state behind `mgit ui`: the config being edited, the
+// selected rule and the validation issues of the last edit. It does no IO so
+// the screen logic can be tested without a terminal.
+type ruleManager struct {
+	cfg      *config.Config
+	path     string
+	loaded   []byte // cfg as last loaded or saved, to notice changes made meanwhile
+	selected int
+	dirty    bool
+	status   []string
+	issues   map[int][]config.ValidationIssue
+	general  []config.ValidationIssue
+}
+
+func newRuleManager(cfg *config.Config, path string) *ruleManager {
+	m := &ruleManager{cfg: cfg, path: path}
+	m.loaded, _ = json.Marshal(cfg)
+	m.validate()
+	return m
+}
+
+// errConfigChanged is returned by save when the config file no longer holds
+// the config the editor started from.
+var errConfigChanged = errors.New("config changed on disk since it was loaded; quit without saving and run mgit ui again")
+
+// save writes the edited config under the config lock, refusing to
+// overwrite changes another mgit made to the file in the meantime.
+func (m *ruleManager) save() error {
+	var saved *config.Config
+	err := config.Update(m.path, func(disk *config.Config) error {
+		if current, _ := json.Marshal(disk); !bytes.Equal(current, m.loaded) {
+			return errConfigChanged
+		}
+		*disk = *m.cfg
+		saved = disk
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	m.loaded, _ = json.Marshal(saved)
+	m.dirty = false
+	return nil
+}
+
+// validate re-runs config validation and files each issue under its rule.
+func (m *ruleManager) validate() {
+	m.issues = map[int][]config.ValidationIssue{}
+	m.general = nil
+	for _, issue := range append(config.Validate(m.cfg), matcher.AmbiguityIssues(m.cfg.Rules)...) {
+		var i int
+		if _, err := fmt.Sscanf(issue.Field, "rules[%d]", &i); err == nil {
+			m.issues[i] = append(m.issues[i], issue)
+			continue
+		}
+		m.general = append(m.general, issue)
+	}
+}
+
+func (m *ruleManager) changed(status ...string) {
+	m.dirty = true
+	m.status = status
+	m.validate()
+}
+
+func (m *ruleManager) move(delta int) {
+	if len(m.cfg.Rules) == 0 {
+		return
+	}
+	m.selected = wrapIndex(m.selected+delta, len(m.cfg.Rules))
+}
+
+// reorder moves the selected rule up (delta<0) or down. Order only breaks
+// ties between equally specific rules, but it is what `rule list` shows.
+func (m *ruleManager) reorder(delta int) {
+	to := m.selected + delta
+	if to < 0 || to >= len(m.cfg.Rules) {
+		return
+	}
+	if err := config.MoveRule(m.cfg, m.selected, to); err != nil {
+		m.status = []string{err.Error()}
+		return
+	}
+	m.selected = to
+	m.changed(fmt.Sprintf("Moved rule id=%s to position %d", m.cfg.Rules[to].ID, to+1))
+}
+
+func (m *ruleManager) deleteSelected() {
+	if m.selected >= len(m.cfg.Rules) {
+		return
+	}
+	removed := m.cfg.Rules[m.selected]
+	m.cfg.Rules = append(m.cfg.Rules[:m.selected], m.cfg.Rules[m.selected+1:]...)
+	if m.selected >= len(m.cfg.Rules) && m.selected > 0 {
+		m.selected--
+	}
+	m.changed(fmt.Sprintf("Removed rule id=%s host=%s owner=%s", removed.ID, removed.Host, removed.Owner))
+}
+
+// testURL resolves rawURL, read from the git remote named remote ("" for a
+// plain URL), against the unsaved config and selects the rule that matched.
+func (m *ruleManager) testURL(remote, rawURL string) {
+	res, err := resolve.FromRemote(m.cfg, remote, rawURL)
+	if err != nil {
+		m.status = []string{fmt.Sprintf("Test %s: %v", rawURL, err)}
+		return
+	}
+	if res.MatchedRule == nil {
+		m.status = []string{fmt.Sprintf("Test %s: no rule applies", rawURL)}
+	} else {
+		if i := m.cfg.RuleIndex(res.MatchedRule.ID); i >= 0 {
+			m.selected = i
+		}
+		m.status = []string{fmt.Sprintf("Test %s: rule #%d id=%s key=%s", rawURL, m.selected+1, res.MatchedRule.ID, res.KeyPath)}
+	}
+	for _, n := range res.Notes {
+		m.status = append(m.status, "Note: "+n)
+	}
+}
+
+func ruleStatus(issues []config.ValidationIssue) string {
+	var errs, warns int
+	for _, issue := range issues {
+		if issue.Level == "error" {
+			errs++
+		} else {
+			warns++
+		}
+	}
+	switch {
+	case errs > 0:
+		return plural(errs, "error")
+	case warns > 0:
+		return plural(warns, "warning")
+	}
+	return "ok"
+}
+
+func plural(n int, word string) string {
+	if n == 1 {
+		return "1 " + word
+	}
+	return fmt.Sprintf("%d %ss", n, word)
+}
+
+func ruleKeyLabel(r config.Rule) string {
+	if r.UsesAgent() {
+		return "agent:" + r.Agent
+	}
+	if !r.HasSSH() && r.HasHTTPS() {
+		return "(HTTPS only)"
+	}
+	return r.Key
+}
+
+// lines renders the rule table, details for the selected rule, the status
+// message and the key help.
+func (m *ruleManager) lines() []string {
+	title := "mgit rules: " + m.path
+	if m.dirty {
+		title += " (modified)"
+	}
+	out := []string{title, ""}
+	if len(m.cfg.Rules) == 0 {
+		out = append(out, "  No rules configured. Press a to add one.")
+	} else {
+		var b strings.Builder
+		tw := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "#\tID\tHOST\tOWNER\tKEY/AGENT\tPRIO\tSTATUS")
+		for i, r := range m.cfg.Rules {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%d\t%s\n", i+1, r.ID, r.Host, r.Owner, ruleKeyLabel(r), r.Priority, ruleStatus(m.issues[i]))
+		}
+		_ = tw.Flush()
+		rows := strings.Split(strings.TrimRight(b.String(), "\n"), "\n")
+		out = append(out, "  "+rows[0])
+		for i, row := range rows[1:] {
+			out = append(out, menuLine(i == m.selected, row))
+		}
+	}
+	out = append(out, "")
+	if m.selected < len(m.cfg.Rules) {
+		if r := m.cfg.Rules[m.selected]; r.Description != "" || len(r.Tags) > 0 {
+			out = append(out, fmt.Sprintf("  %s [%s]", dash(r.Description), strings.Join(r.Tags, ", ")))
+		}
+	}
+	for _, issue := range append(m.issues[m.selected], m.general...) {
+		out = append(out, fmt.Sprintf("  %s %s: %s", strings.ToUpper(issue.Level), issue.Field, issue.Message))
+	}
+	out = append(out, m.status...)
+	out = append(out, "", ruleManageHelp)
+	return out
+}
+
+func (a *App) handleRuleManage(ctx context.Context, opts globalOptions, args []string) int {
+	_ = ctx
+	if len(args) > 0 {
+		return a.fail(opts, usageError(fmt.Errorf("unexpected arguments: %s", strings.Join(args, " "))))
+	}
+	stdinFile, ok := a.stdin.(*os.File)
+	if !ok || !a.stdinIsTTY() || !a.stdoutIsTTY() {
+		return a.fail(opts, errors.New("the rule manager needs an interactive terminal; use mgit rule add|list|remove instead"))
+	}
+	cfg, path, err := a.loadOrCreateConfig(opts)
+	if err != nil {
+		return a.fail(opts, err)
+	}
+	raw, err := newRawTerminal(stdinFile)
+	if err != nil {
+		return a.fail(opts, fmt.Errorf("switch terminal to raw mode: %w", err))
+	}
+	fmt.Fprint(a.stdout, "\x1b[?1049h")
+	hideCursor(a.stdout)
+	t := &ruleTUI{a: a, r: bufio.NewReader(a.stdin), m: newRuleManager(cfg, path)}
+	saved, runErr := t.run()
+	showCursor(a.stdout)
+	fmt.Fprint(a.stdout, "\x1b[?1049l")
+	raw.restore()
+	if runErr != nil {
+		return a.fail(opts, runErr)
+	}
+	if saved {
+		a.infof(opts, "Saved to %s\n", path)
+	}
+	return 0
+}
+
+// ruleTUI drives a ruleManager from raw terminal input.
+type ruleTUI struct {
+	a *App
+	r *bufio.Reader
+	m *ruleManager
+}
+
+func (t *ruleTUI) draw(lines []string) {
+	fmt.Fprint(t.a.stdout, "\x1b[H\x1b[2J"+strings.Join(lines, "\r\n"))
+}
+
+// run handles keys until the user quits. It reports whether the config was
+// written at least once.
+func (t *ruleTUI) run() (bool, error) {
+	saved := false
+	for {
+		t.draw(t.m.lines())
+		k, err := readKey(t.r)
+		if err != nil {
+			return saved, err
+		}
+		switch k.Kind {
+		case keyUp:
+			t.m.move(-1)
+		case keyDown:
+			t.m.move(1)
+		case keyEnter:
+			if err := t.edit(); err != nil {
+				return saved, err
+			}
+		case keyEscape, keyCtrlC:
+			done, err := t.quit(&saved)
+			if err != nil || done {
+				return saved, err
+			}
+		case keyRune:
+			switch k.Rune {
+			case 'k':
+				t.m.move(-1)
+			case 'j':
+				t.m.move(1)
+			case 'K':
+				t.m.reorder(-1)
+			case 'J':
+				t.m.reorder(1)
+			case 'a':
+				err = t.add()
+			case 'e':
+				err = t.edit()
+			case 'd':
+				err = t.delete()
+			case 't':
+				err = t.test()
+			case 's':
+				if t.save() {
+					saved = true
+				}
+			case 'q':
+				var done bool
+				done, err = t.quit(&saved)
+				if done {
+					return saved, err
+				}
+			}
+			if err != nil {
+				return saved, err
+			}
+		}
+	}
+}
+
+func (t *ruleTUI) save() bool {
+	if err := t.m.save(); err != nil {
+		t.m.status = []string{"Save failed: " + err.Error()}
+		return false
+	}
+	t.m.status = []string{"Saved to " + t.m.path}
+	if config.HasErrors(config.Validate(t.m.cfg)) {
+		t.m.status = append(t.m.status, "Config still has validation errors")
+	}
+	return true
+}
+
+func (t *ruleTUI) quit(saved *bool) (bool, error) {
+	if !t.m.dirty {
+		return true, nil
+	}
+	answer, ok, err := t.prompt("Save changes before quitting? [y/n] (Esc to stay): ", "")
+	if err != nil || !ok {
+		return false, err
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		if !t.save() {
+			return false, nil
+		}
+		*saved = true
+		return true, nil
+	case "n", "no":
+		return true, nil
+	}
+	return false, nil
+}
+
+// prompt reads a line at the bottom of the screen. ok is false when the user
+// pressed Esc.
+func (t *ruleTUI) prompt(label, initial string) (string, bool, error) {
+	buf := []rune(initial)
+	for {
+		t.draw(append(t.m.lines(), "", label+string(buf)+"_"))
+		k, err := readKey(t.r)
+		if err != nil {
+			return "", false, err
+		}
+		switch k.Kind {
+		case keyEnter:
+			return string(buf), true, nil
+		case keyEscape, keyCtrlC:
+			return "", false, nil
+		case keyBackspace:
+			if len(buf) > 0 {
+				buf = buf[:len(buf)-1]
+			}
+		case keyRune:
+			buf = append(buf, k.Rune)
+		}
+	}
+}
+
+// choose shows a menu below the rule table. ok is false when the user
+// pressed Esc or q.
+func (t *ruleTUI) choose(title string, items []string) (int, bool, error) {
+	selected := 0
+	for {
+		lines := append(t.m.lines(), "", title)
+		for i, item := range items {
+			lines = append(lines, menuLine(i == selected, item))
+		}
+		t.draw(lines)
+		k, err := readKey(t.r)
+		if err != nil {
+			return 0, false, err
+		}
+		switch k.Kind {
+		case keyUp:
+			selected = wrapIndex(selected-1, len(items))
+		case keyDown:
+			selected = wrapIndex(selected+1, len(items))
+		case keyEnter:
+			return selected, true, nil
+		case keyEscape, keyCtrlC:
+			return 0, false, nil
+		case keyRune:
+			switch {
+			case k.Rune == 'k':
+				selected = wrapIndex(selected-1, len(items))
+			case k.Rune == 'j':
+				selected = wrapIndex(selected+1, len(items))
+			case k.Rune == 'q':
+				return 0, false, nil
+			case k.Rune >= '1' && k.Rune <= '9' && int(k.Rune-'1') < len(items):
+				return int(k.Rune - '1'), true, nil
+			}
+		}
+	}
+}
+
+// pickKey offers keys from ~/.ssh and ssh-agent plus a custom path, and
+// stores the choice on r.
+func (t *ruleTUI) pickKey(r *config.Rule) (bool, error) {
+	keys, _ := discoverKeys()
+	items := make([]string, 0, len(keys)+1)
+	for _, k := range keys {
+		items = append(items, keyCandidateLabel(k))
+	}
+	items = append(items, "Custom path")
+	i, ok, err := t.choose(fmt.Sprintf("Select SSH key for host=%s owner=%s:", r.Host, r.Owner), items)
+	if err != nil || !ok {
+		return false, err
+	}
+	if i < len(keys) {
+		if keys[i].Source == sshkeys.SourceAgent {
+			r.Key, r.Agent = "", keys[i].Fingerprint
+		} else {
+			r.Key, r.Agent = keys[i].Path, ""
+		}
+		return true, nil
+	}
+	custom, ok, err := t.prompt("Key path: ", r.Key)
+	if err != nil || !ok || strings.TrimSpace(custom) == "" {
+		return false, err
+	}
+	r.Key, r.Agent = strings.TrimSpace(custom), ""
+	return true, nil
+}
+
+func (t *ruleTUI) add() error {
+	var r config.Rule
+	var ok bool
+	var err error
+	if r.Host, ok, err = t.prompt("Host (* for any): ", "*"); err != nil || !ok {
+		return err
+	}
+	if r.Owner, ok, err = t.prompt("Owner/namespace (* for any): ", "*"); err != nil || !ok {
+		return err
+	}
+	if ok, err = t.pickKey(&r); err != nil || !ok {
+		return err
+	}
+	if err := config.AddRule(t.m.cfg, r, false); err != nil {
+		t.m.status = []string{err.Error()}
+		return nil
+	}
+	t.m.selected = len(t.m.cfg.Rules) - 1
+	added := t.m.cfg.Rules[t.m.selected]
+	t.m.changed(fmt.Sprintf("Added rule id=%s host=%s owner=%s", added.ID, added.Host, added.Owner))
+	return nil
+}
+
+func (t *ruleTUI) edit() error {
+	if t.m.selected >= len(t.m.cfg.Rules) {
+		return nil
+	}
+	r := t.m.cfg.Rules[t.m.selected]
+	fields := []string{
+		"host: " + r.Host,
+		"owner: " + r.Owner,
+		"remote: " + dash(r.Remote),
+		"key: " + dash(ruleKeyLabel(r)),
+		"priority: " + strconv.Itoa(r.Priority),
+		"email: " + dash(r.Email),
+		"signingKey: " + dash(r.SigningKey),
+		"description: " + dash(r.Description),
+		"tags: " + dash(strings.Join(r.Tags, ",")),
+	}
+	i, ok, err := t.choose(fmt.Sprintf("Edit rule id=%s:", r.ID), fields)
+	if err != nil || !ok {
+		return err
+	}
+	name := strings.SplitN(fields[i], ":", 2)[0]
+	if name == "key" {
+		if ok, err = t.pickKey(&r); err != nil || !ok {
+			return err
+		}
+	} else if name == "tags" {
+		value, ok, err := t.prompt("tags (comma-separated): ", strings.Join(r.Tags, ","))
+		if err != nil || !ok {
+			return err
+		}
+		r.Tags = config.ParseTags(value)
+	} else {
+		target := map[string]*string{"host": &r.Host, "owner": &r.Owner, "remote": &r.Remote, "email": &r.Email, "signingKey": &r.SigningKey, "description": &r.Description}[name]
+		initial := strconv.Itoa(r.Priority)
+		if target != nil {
+			initial = *target
+		}
+		value, ok, err := t.prompt(name+": ", initial)
+		if err != nil || !ok {
+			return err
+		}
+		if target != nil {
+			*target = strings.TrimSpace(value)
+		} else if r.Priority, err = strconv.Atoi(strings.TrimSpace(value)); err != nil {
+			t.m.status = []string{fmt.Sprintf("priority must be a number: %q", value)}
+			return nil
+		}
+	}
+	t.m.cfg.Rules[t.m.selected] = r
+	t.m.changed(fmt.Sprintf("Updated %s of rule id=%s", name, r.ID))
+	return nil
+}
+
+func (t *ruleTUI) delete() error {
+	if t.m.selected >= len(t.m.cfg.Rules) {
+		return nil
+	}
+	r := t.m.cfg.Rules[t.m.selected]
+	answer, ok, err := t.prompt(fmt.Sprintf("Delete rule id=%s host=%s owner=%s? [y/N]: ", r.ID, r.Host, r.Owner), "")
+	if err != nil || !ok {
+		return err
+	}
+	if a := strings.ToLower(strings.TrimSpace(answer)); a == "y" || a == "yes" {
+		t.m.deleteSelected()
+	}
+	return nil
+}
+
+func (t *ruleTUI) test() error {
+	answer, ok, err := t.prompt("Test URL, or remote name and URL: ", "")
+	if err != nil || !ok || strings.TrimSpace(answer) == "" {
+		return err
+	}
+	remote, rawURL, found := strings.Cut(strings.TrimSpace(answer), " ")
+	if !found {
+		remote, rawURL = "", remote
+	}
+	t.m.testURL(remote, strings.TrimSpace(rawURL))
+	return nil
+}
@@ -0,0 +1,103 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pavelBuzdanov/mgit/internal/config"
+)
+
+func TestRuleManagerReorderAndValidation(t *testing.T) {
+	key := filepath.Join(t.TempDir(), "id_work")
+	if err := os.WriteFile(key, []byte("dummy"), 0o600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+	cfg := &config.Config{Version: 1, Rules: []config.Rule{
+		{ID: "work", Host: "github.com", Owner: "CompanyOrg", Key: key},
+		{ID: "broken", Host: "github.com", Owner: "*", Key: "/definitely/missing/key"},
+	}}
+	m := newRuleManager(cfg, "/tmp/config.json")
+	if got := ruleStatus(m.issues[1]); got != "1 error" {
+		t.Fatalf("status of broken rule = %q, want 1 error", got)
+	}
+	if got := ruleStatus(m.issues[0]); got != "ok" {
+		t.Fatalf("status of valid rule = %q, want ok", got)
+	}
+
+	m.move(1)
+	m.reorder(-1)
+	if cfg.Rules[0].ID != "broken" || m.selected != 0 || !m.dirty {
+		t.Fatalf("after reorder: rules=%v selected=%d dirty=%v", cfg.Rules, m.selected, m.dirty)
+	}
+	if got := ruleStatus(m.issues[0]); got != "1 error" {
+		t.Fatalf("issues did not follow the moved rule: %q", got)
+	}
+
+	screen := strings.Join(m.lines(), "\n")
+	for _, want := range []string{"(modified)", "KEY/AGENT", "ERROR rules[0].key", ruleManageHelp} {
+		if !strings.Contains(screen, want) {
+			t.Fatalf("screen missing %q:\n%s", want, screen)
+		}
+	}
+
+	m.testURL("", "git@github.com:CompanyOrg/repo.git")
+	if m.selected != 1 || len(m.status) == 0 || !strings.Contains(m.status[0], "id=work") {
+		t.Fatalf("testURL selected=%d status=%v", m.selected, m.status)
+	}
+
+	m.deleteSelected()
+	if len(cfg.Rules) != 1 || m.selected != 0 {
+		t.Fatalf("after delete: rules=%v selected=%d", cfg.Rules, m.selected)
+	}
+}
+
+func TestRuleManagerSaveRefusesConcurrentChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	key := filepath.Join(t.TempDir(), "id_work")
+	if err := config.Save(path, &config.Config{Version: 1, Rules: []config.Rule{{ID: "work", Host: "github.com", Owner: "*", Key: key}}}); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	m := newRuleManager(cfg, path)
+	m.deleteSelected()
+	if err := m.save(); err != nil || m.dirty {
+		t.Fatalf("save of an unchanged file: %v, dirty=%v", err, m.dirty)
+	}
+
+	if err := config.Update(path, func(c *config.Config) error {
+		return config.AddRule(c, config.Rule{ID: "other", Host: "gitlab.com", Owner: "*", Key: key}, false)
+	}); err != nil {
+		t.Fatalf("concurrent update: %v", err)
+	}
+	m.changed("edited")
+	if err := m.save(); !errors.Is(err, errConfigChanged) {
+		t.Fatalf("save after a concurrent change = %v, want errConfigChanged", err)
+	}
+	if got, _ := config.Load(path); len(got.Rules) != 1 || got.Rules[0].ID != "other" {
+		t.Fatalf("concurrent change was overwritten: %+v", got.Rules)
+	}
+}
+
+func TestReadKey(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("\x1b[Aq\rй\x7f\x1b[1;5B\x1b[3~x\x1b"))
+	want := []keyPress{
+		{Kind: keyUp}, {Kind: keyRune, Rune: 'q'}, {Kind: keyEnter}, {Kind: keyRune, Rune: 'й'}, {Kind: keyBackspace},
+		{Kind: keyDown}, {Kind: keyUnknown}, {Kind: keyRune, Rune: 'x'}, {Kind: keyEscape},
+	}
+	for i, w := range want {
+		got, err := readKey(r)
+		if err != nil {
+			t.Fatalf("readKey() #%d error = %v", i, err)
+		}
+		if got != w {
+			t.Fatalf("readKey() #%d = %+v, want %+v", i, got, w)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/pavelBuzdanov/mgit/internal/config"
+	"github.com/pavelBuzdanov/mgit/internal/doctor"
+	"github.com/pavelBuzdanov/mgit/internal/resolve"
+	"github.com/pavelBuzdanov/mgit/internal/runner"
+)
+
+// selftestURL is the remote of the selftest repository. The host never
+// resolves: the stand-in ssh serves it from a local bare repository.
+const selftestURL = "git@selftest.invalid:selftest/repo.git"
+
+// selftestSSH is the stand-in ssh of mgit selftest. It logs its arguments,
+// so the test can see which key mgit selected, and runs the git command it
+// is asked to run on the server against the local bare repository instead.
+const selftestSSH = `#!/bin/sh
+# Written by mgit selftest: logs its arguments and serves git locally.
+printf '%%s\n' "$@" >> %s
+for last; do :; done
+PATH="$(git --exec-path):$PATH"
+cd %s && exec sh -c "$last"
+`
+
+// selftest is the temporary world of mgit selftest: a bare repository
+// behind a stand-in ssh, a clone with a commit, a key file and a config
+// with one rule for them.
+type selftest struct {
+	root, work, bare string
+	key, log, config string
+	env              []string
+}
+
+func newSelftest(ctx context.Context) (*selftest, error) {
+	root, err := os.MkdirTemp("", "mgit-selftest-")
+	if err != nil {
+		return nil, err
+	}
+	t := &selftest{
+		root:   root,
+		work:   filepath.Join(root, "work"),
+		bare:   filepath.Join(root, "selftest", "repo.git"),
+		key:    filepath.Join(root, "id_selftest"),
+		log:    filepath.Join(root, "ssh.log"),
+		config: filepath.Join(root, "config.json"),
+	}
+	// Keep the user's git config, ssh settings and mgit environment out, so
+	// the result depends on mgit and git alone.
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		if !strings.HasPrefix(name, "GIT_") && !strings.HasPrefix(name, "MGIT_") {
+			t.env = append(t.env, kv)
+		}
+	}
+	t.env = append(t.env, "GIT_CONFIG_NOSYSTEM=1", "GIT_CONFIG_GLOBAL="+os.DevNull, "GIT_TERMINAL_PROMPT=0")
+
+	stub := filepath.Join(root, "bin", "ssh")
+	script := fmt.Sprintf(selftestSSH, runner.ShellArg(t.log), runner.ShellArg(root))
+	cfg := config.Config{
+		Version:    config.CurrentVersion,
+		SSHCommand: runner.ShellArg(stub),
+		Rules:      []config.Rule{{ID: "selftest", Host: "selftest.invalid", Owner: "selftest", Key: t.key}},
+	}
+	steps := []func() error{
+		func() error { return os.MkdirAll(filepath.Dir(stub), 0o700) },
+		func() error { return os.WriteFile(stub, []byte(script), 0o700) },
+		func() error {
+			return os.WriteFile(t.key, []byte("mgit selftest key; the stand-in ssh does not read it\n"), 0o600)
+		},
+		func() error { return config.Save(t.config, &cfg) },
+		func() error { return t.git(ctx, "", "init", "--bare", "--quiet", t.bare) },
+		func() error { return t.git(ctx, "", "init", "--quiet", t.work) },
+		func() error {
+			return t.git(ctx, t.work, "-c", "user.name=mgit selftest", "-c", "user.email=selftest@mgit.invalid",
+				"commit", "--quiet", "--allow-empty", "-m", "mgit selftest")
+		},
+		func() error { return t.git(ctx, t.work, "remote", "add", "origin", selftestURL) },
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			t.remove()
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+func (t *selftest) remove() {
+	_ = os.RemoveAll(t.root)
+}
+
+func (t *selftest) git(ctx context.Context, dir string, args ...string) error {
+	_, err := t.run(ctx, dir, "git", args...)
+	return err
+}
+
+// run runs name in dir with the selftest environment and returns its output.
+func (t *selftest) run(ctx context.Context, dir, name string, args ...string) (string, error) {
+	cmd := runner.CommandContext(ctx, name, args...)
+	cmd.Dir = dir
+	cmd.Env = t.env
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return "", fmt.Errorf("%s %s: %s", name, strings.Join(args, " "), msg)
+		}
+		return "", fmt.Errorf("%s %s: %w", name, strings.Join(args, " "), err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// handleSelftest runs the resolve and exec pipeline against a throwaway
+// repository served by a stand-in ssh, stage by stage, stopping at the first
+// failure. It proves the installation works independently of the user's
+// keys, config and servers.
+func (a *App) handleSelftest(ctx context.Context, opts globalOptions, args []string) int {
+	fs := flag.NewFlagSet("mgit selftest", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	keep := fs.Bool("keep", false, "keep the temporary directory for inspection")
+	if err := fs.Parse(args); err != nil {
+		return a.fail(opts, usageError(err))
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return a.fail(opts, fmt.Errorf("selftest: %w", err))
+	}
+
+	var checks []doctor.Check
+	var t *selftest
+	mgit := func(args ...string) (string, error) {
+		return t.run(ctx, t.work, self, append([]string{"--config", t.config}, args...)...)
+	}
+	stages := []struct {
+		name string
+		run  func() (string, error)
+	}{
+		{"git", func() (string, error) {
+			if _, err := exec.LookPath("git"); err != nil {
+				return "", errors.New("git not found on PATH")
+			}
+			return a.gitOps(opts, a.newShell(opts)).GitVersion(ctx)
+		}},
+		{"setup", func() (string, error) {
+			if t, err = newSelftest(ctx); err != nil {
+				return "", err
+			}
+			return "repository, stand-in ssh server and config in " + t.root, nil
+		}},
+		{"resolve", func() (string, error) {
+			cfg, err := config.Load(t.config)
+			if err != nil {
+				return "", err
+			}
+			res, err := resolve.FromRemote(cfg, "origin", selftestURL)
+			if err != nil {
+				return "", err
+			}
+			if res.MatchedRule == nil || res.MatchedRule.ID != "selftest" || res.KeyPath != t.key {
+				return "", fmt.Errorf("resolved to key %s instead of %s", dash(res.KeyPath), t.key)
+			}
+			return "rule selftest selects " + t.key, nil
+		}},
+		{"fetch", func() (string, error) {
+			if _, err := mgit("fetch", "origin"); err != nil {
+				return "", err
+			}
+			return "mgit fetch origin", nil
+		}},
+		{"ssh", func() (string, error) {
+			data, err := os.ReadFile(t.log)
+			if err != nil {
+				return "", errors.New("git did not run ssh: GIT_SSH_COMMAND was not applied")
+			}
+			args := strings.Split(string(data), "\n")
+			if i := slices.Index(args, "-i"); i < 0 || i+1 >= len(args) || args[i+1] != t.key {
+				return "", fmt.Errorf("ssh did not get -i %s: %s", t.key, strings.Join(args, " "))
+			}
+			return "ssh ran with -i " + t.key, nil
+		}},
+		{"push", func() (string, error) {
+			if _, err := mgit("push", "origin", "HEAD:refs/heads/selftest"); err != nil {
+				return "", err
+			}
+			head, err := t.run(ctx, t.work, "git", "rev-parse", "HEAD")
+			if err != nil {
+				return "", err
+			}
+			pushed, err := t.run(ctx, t.bare, "git", "rev-parse", "refs/heads/selftest")
+			if err != nil {
+				return "", fmt.Errorf("pushed branch not found on the server: %w", err)
+			}
+			if pushed != head {
+				return "", fmt.Errorf("server has %s instead of the pushed commit %s", pushed, head)
+			}
+			return "mgit push origin HEAD:refs/heads/selftest", nil
+		}},
+	}
+	failed := false
+	for _, stage := range stages {
+		msg, err := stage.run()
+		if err != nil {
+			checks = append(checks, doctor.Check{Name: stage.name, Status: "error", Message: err.Error()})
+			failed = true
+			break
+		}
+		checks = append(checks, doctor.Check{Name: stage.name, Status: "ok", Message: msg})
+	}
+	if t != nil {
+		if *keep {
+			a.infof(opts, "Kept %s\n", t.root)
+		} else {
+			t.remove()
+		}
+	}
+
+	if opts.Output.Structured() {
+		a.printData(opts, map[string]any{"checks": checks, "passed": !failed})
+	} else {
+		color := a.color(opts)
+		for _, c := range checks {
+			fmt.Fprintf(a.stdout, "[%s] %s: %s\n", color.Level(c.Status), c.Name, c.Message)
+		}
+		if failed {
+			fmt.Fprintln(a.stdout, "Selftest failed")
+		} else {
+			fmt.Fprintln(a.stdout, "Selftest passed")
+		}
+	}
+	if failed {
+		return exitFailure
+	}
+	return exitOK
+}
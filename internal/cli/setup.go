@@ -0,0 +1,242 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pavelBuzdanov/mgit/internal/config"
+	"github.com/pavelBuzdanov/mgit/internal/forge"
+	"github.com/pavelBuzdanov/mgit/internal/resolve"
+	"github.com/pavelBuzdanov/mgit/internal/runner"
+	"github.com/pavelBuzdanov/mgit/internal/sshkeys"
+)
+
+// setupProbe is one key tried against one host by `mgit setup`.
+type setupProbe struct {
+	Key     string `json:"key"`
+	Host    string `json:"host"`
+	Account string `json:"account,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// handleSetup is the first-run wizard: it discovers the user's keys, tries
+// each against the given hosts to learn which account it logs in as,
+// proposes one rule per (host, account) and writes the accepted ones to the
+// config. With --yes (or without a terminal, where --yes is required to
+// write) every proposal is taken as is.
+func (a *App) handleSetup(ctx context.Context, opts globalOptions, args []string) int {
+	fs := flag.NewFlagSet("mgit setup", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	hosts := fs.String("hosts", "github.com,gitlab.com", "")
+	if err := fs.Parse(args); err != nil {
+		return a.fail(opts, usageError(err))
+	}
+	var hostList []string
+	for _, h := range strings.Split(*hosts, ",") {
+		if h = strings.ToLower(strings.TrimSpace(h)); h != "" {
+			hostList = append(hostList, h)
+		}
+	}
+	if len(hostList) == 0 {
+		return a.fail(opts, usageError(errors.New("--hosts needs at least one host")))
+	}
+
+	keys, err := discoverKeys()
+	if err != nil {
+		return a.fail(opts, err)
+	}
+	var files []sshkeys.Candidate
+	for _, k := range keys {
+		// Security keys would wait for a touch per host; agent-only keys
+		// have no file to pin with -i.
+		if k.Source == sshkeys.SourceFile && !k.IsSecurityKey() {
+			files = append(files, k)
+		}
+	}
+	if len(files) == 0 {
+		return a.fail(opts, errors.New("no SSH keys found in ~/.ssh; create one with: mgit key generate"))
+	}
+	a.infof(opts, "Found %d key(s). Testing each against %s...\n", len(files), strings.Join(hostList, ", "))
+
+	client := a.sshBinary(opts)
+	var probes []setupProbe
+	progress := a.progressFor(opts, len(files)*len(hostList))
+	for _, k := range files {
+		for _, host := range hostList {
+			progress.Start(host + " " + k.Name)
+			p := a.probeAccount(ctx, client, k.Path, host)
+			progress.Done(host + " " + k.Name)
+			probes = append(probes, p)
+		}
+	}
+	progress.Finish()
+
+	cfg, _, cfgErr := a.tryLoadConfig(opts)
+	if cfgErr != nil {
+		cfg = &config.Config{Version: 1}
+	}
+	proposals := setupProposals(cfg, probes)
+	if opts.Output.Structured() {
+		a.printData(opts, map[string]any{"probes": probes, "rules": proposals})
+	} else {
+		a.printSetupProbes(probes)
+	}
+	if len(proposals) == 0 {
+		a.infof(opts, "No new rules to propose: no key logged in, or the config already covers every account found.\n")
+		return 0
+	}
+	if opts.DryRun {
+		if !opts.Output.Structured() {
+			for _, r := range proposals {
+				fmt.Fprintf(a.stdout, "Dry run: would add rule host=%s owner=%s key=%s\n", r.Host, r.Owner, r.Key)
+			}
+		}
+		return 0
+	}
+	interactive := a.stdinIsTTY() && !opts.Yes
+	if !interactive && !opts.Yes {
+		a.infof(opts, "Not a terminal; re-run with --yes to add the %d proposed rule(s).\n", len(proposals))
+		return 0
+	}
+
+	var accepted []config.Rule
+	for _, r := range proposals {
+		if interactive {
+			ok, err := a.askYesNo(fmt.Sprintf("Add rule host=%s owner=%s key=%s (%s)? [Y/n]: ", r.Host, r.Owner, r.Key, r.Description), true)
+			if err != nil {
+				return a.fail(opts, err)
+			}
+			if !ok {
+				continue
+			}
+		}
+		accepted = append(accepted, r)
+		if !interactive {
+			continue
+		}
+		// The greeting names the account, not the organizations it works
+		// in; those are owners too.
+		more, err := a.promptLine(fmt.Sprintf("Organizations or groups on %s that %s should also serve (comma-separated, empty for none): ", r.Host, r.Owner))
+		if err != nil && !errors.Is(err, io.EOF) {
+			return a.fail(opts, err)
+		}
+		for _, owner := range strings.Split(more, ",") {
+			if owner = strings.TrimSpace(owner); owner != "" {
+				extra := r
+				extra.Owner = owner
+				accepted = append(accepted, extra)
+			}
+		}
+	}
+	if len(accepted) == 0 {
+		a.infof(opts, "No rules added.\n")
+		return 0
+	}
+	path, err := a.updateConfig(opts, func(cfg *config.Config) error {
+		for _, r := range accepted {
+			if err := config.AddRule(cfg, r, false); err != nil {
+				return fmt.Errorf("rule host=%s owner=%s: %w", r.Host, r.Owner, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return a.fail(opts, err)
+	}
+	for _, r := range accepted {
+		a.infof(opts, "Rule added: host=%s owner=%s key=%s\n", r.Host, r.Owner, r.Key)
+	}
+	a.infof(opts, "Saved to %s\nCheck the result with: mgit doctor\n", path)
+	return 0
+}
+
+// probeAccount runs `ssh -T git@host` with only keyPath offered and reads
+// the account name from the host's greeting.
+func (a *App) probeAccount(ctx context.Context, client runner.SSHClient, keyPath, host string) setupProbe {
+	p := setupProbe{Key: keyPath, Host: host}
+	var out bytes.Buffer
+	shell := runner.NewShell(&out, &out, false)
+	args := append(client.Args(keyPath, resolve.WithKnownHosts(client, nil)...), client.BatchArgs()...)
+	args = append(args, "-o", "ConnectTimeout=10", "-T", "git@"+host)
+	err := shell.Run(ctx, client.Name(), args, nil)
+	if account, ok := forge.SSHAccount(out.String()); ok {
+		p.Account = account
+		return p
+	}
+	switch {
+	case strings.TrimSpace(out.String()) != "":
+		p.Error = lastLine(out.String())
+	case err != nil:
+		p.Error = err.Error()
+	default:
+		p.Error = "no greeting from host"
+	}
+	return p
+}
+
+// setupProposals turns successful probes into rules, one per host and
+// account, skipping accounts whose remotes the config already sends to the
+// same key. When several keys log in as the same account, the first wins.
+func setupProposals(cfg *config.Config, probes []setupProbe) []config.Rule {
+	var rules []config.Rule
+	seen := map[string]bool{}
+	for _, p := range probes {
+		if p.Account == "" || seen[p.Host+"/"+strings.ToLower(p.Account)] {
+			continue
+		}
+		seen[p.Host+"/"+strings.ToLower(p.Account)] = true
+		// A repository of the account is typically cloned as origin.
+		url := "git@" + p.Host + ":" + p.Account + "/repo.git"
+		if res, err := resolve.FromRemote(cfg, "origin", url); err == nil && !res.Fallback && sameKeyPath(res.KeyPath, p.Key) {
+			continue
+		}
+		rules = append(rules, config.Rule{
+			Host:        p.Host,
+			Owner:       p.Account,
+			Key:         p.Key,
+			Description: fmt.Sprintf("%s on %s (found by mgit setup)", p.Account, p.Host),
+		})
+	}
+	return rules
+}
+
+func sameKeyPath(a, b string) bool {
+	ea, errA := config.ExpandPath(a)
+	eb, errB := config.ExpandPath(b)
+	return errA == nil && errB == nil && ea == eb
+}
+
+func (a *App) printSetupProbes(probes []setupProbe) {
+	tw := tabwriter.NewWriter(a.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "KEY\tHOST\tACCOUNT")
+	for _, p := range probes {
+		account := p.Account
+		if account == "" {
+			account = "- (" + p.Error + ")"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", p.Key, p.Host, account)
+	}
+	_ = tw.Flush()
+}
+
+// askYesNo asks a yes/no question on stderr; an empty answer is def.
+func (a *App) askYesNo(prompt string, def bool) (bool, error) {
+	fmt.Fprint(a.stderr, prompt)
+	line, err := a.promptLine("")
+	if err != nil && !errors.Is(err, io.EOF) {
+		return false, err
+	}
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "":
+		return def, nil
+	case "y", "yes":
+		return true, nil
+	}
+	return false, nil
+}
@@ -0,0 +1,33 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/pavelBuzdanov/mgit/internal/config"
+)
+
+func TestSetupProposals(t *testing.T) {
+	cfg := &config.Config{Version: 1, Rules: []config.Rule{
+		{ID: "known", Host: "github.com", Owner: "alice", Key: "/keys/personal"},
+	}}
+	probes := []setupProbe{
+		{Key: "/keys/personal", Host: "github.com", Account: "alice"},
+		{Key: "/keys/personal", Host: "gitlab.com", Error: "Permission denied (publickey)."},
+		{Key: "/keys/work", Host: "github.com", Account: "alice-corp"},
+		{Key: "/keys/work2", Host: "github.com", Account: "Alice-Corp"},
+		{Key: "/keys/work", Host: "gitlab.com", Account: "acorp"},
+	}
+	got := setupProposals(cfg, probes)
+	want := []config.Rule{
+		{Host: "github.com", Owner: "alice-corp", Key: "/keys/work"},
+		{Host: "gitlab.com", Owner: "acorp", Key: "/keys/work"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("proposals = %+v", got)
+	}
+	for i, w := range want {
+		if got[i].Host != w.Host || got[i].Owner != w.Owner || got[i].Key != w.Key {
+			t.Errorf("proposal %d = %+v, want %+v", i, got[i], w)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/pavelBuzdanov/mgit/internal/shim"
+)
+
+// handleShim implements `mgit shim install|status|uninstall`: a `git` early
+// on PATH that sends plain `git push`, `git fetch`, ... through mgit.
+func (a *App) handleShim(ctx context.Context, opts globalOptions, args []string) int {
+	if len(args) == 0 {
+		a.printShimUsage()
+		return 2
+	}
+	fs := flag.NewFlagSet("mgit shim "+args[0], flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	dir := fs.String("dir", "", "")
+	gitPath := fs.String("git", "", "")
+	if err := fs.Parse(args[1:]); err != nil {
+		return a.fail(opts, usageError(err))
+	}
+	if *dir == "" {
+		d, err := shim.DefaultDir()
+		if err != nil {
+			return a.fail(opts, err)
+		}
+		*dir = d
+	}
+	if abs, err := filepath.Abs(*dir); err == nil {
+		*dir = abs
+	}
+	switch args[0] {
+	case "install":
+		return a.shimInstall(opts, *dir, *gitPath)
+	case "status":
+		return a.shimStatus(opts, *dir)
+	case "uninstall":
+		return a.shimUninstall(opts, *dir)
+	}
+	a.printShimUsage()
+	return 2
+}
+
+func (a *App) shimInstall(opts globalOptions, dir, gitPath string) int {
+	if runtime.GOOS == "windows" {
+		return a.fail(opts, errors.New("the git shim is a sh script and is not supported on Windows"))
+	}
+	if gitPath == "" {
+		p, err := shim.FindGit(os.Getenv("PATH"))
+		if err != nil {
+			return a.fail(opts, err)
+		}
+		gitPath = p
+	}
+	mgitPath, err := os.Executable()
+	if err != nil {
+		return a.fail(opts, fmt.Errorf("locate the mgit binary: %w", err))
+	}
+	path := filepath.Join(dir, "git")
+	if opts.DryRun {
+		fmt.Fprintf(a.stdout, "Dry run: would install %s (git: %s, mgit: %s)\n", path, gitPath, mgitPath)
+		return 0
+	}
+	updated, err := shim.Install(dir, gitPath, mgitPath)
+	if err != nil {
+		return a.fail(opts, err)
+	}
+	action := "installed"
+	if updated {
+		action = "updated"
+	}
+	st := shim.Inspect(dir, os.Getenv("PATH"))
+	if opts.Output.Structured() {
+		a.printData(opts, map[string]any{"action": action, "shim": st})
+		return 0
+	}
+	a.infof(opts, "Git shim %s: %s (git: %s, mgit: %s)\n", action, path, gitPath, mgitPath)
+	a.printShimPathHint(opts, dir, st)
+	return 0
+}
+
+func (a *App) shimStatus(opts globalOptions, dir string) int {
+	st := shim.Inspect(dir, os.Getenv("PATH"))
+	if opts.Output.Structured() {
+		a.printData(opts, map[string]any{"shim": st})
+		return 0
+	}
+	if !st.Installed {
+		fmt.Fprintf(a.stdout, "No git shim at %s\n", st.Path)
+		return 0
+	}
+	fmt.Fprintf(a.stdout, "Git shim: %s\n", st.Path)
+	fmt.Fprintf(a.stdout, "  git:  %s\n", st.Git)
+	fmt.Fprintf(a.stdout, "  mgit: %s\n", st.Mgit)
+	switch {
+	case st.Active:
+		fmt.Fprintln(a.stdout, "  active: plain git push, pull, fetch, clone and ls-remote go through mgit")
+	case st.OnPath:
+		fmt.Fprintln(a.stdout, "  inactive: another git comes first on PATH")
+	default:
+		fmt.Fprintln(a.stdout, "  inactive: its directory is not on PATH")
+	}
+	for _, p := range st.Stale {
+		fmt.Fprintf(a.stderr, "warn: %s no longer exists; run mgit shim install again\n", p)
+	}
+	return 0
+}
+
+func (a *App) shimUninstall(opts globalOptions, dir string) int {
+	path := filepath.Join(dir, "git")
+	if opts.DryRun {
+		fmt.Fprintf(a.stdout, "Dry run: would remove %s\n", path)
+		return 0
+	}
+	removed, err := shim.Uninstall(dir)
+	if err != nil {
+		return a.fail(opts, err)
+	}
+	if opts.Output.Structured() {
+		a.printData(opts, map[string]any{"path": path, "removed": removed})
+		return 0
+	}
+	if !removed {
+		a.infof(opts, "No git shim at %s\n", path)
+		return 0
+	}
+	a.infof(opts, "Removed %s\n", path)
+	return 0
+}
+
+// printShimPathHint tells how to put the shim in front of the real git.
+func (a *App) printShimPathHint(opts globalOptions, dir string, st shim.Status) {
+	switch {
+	case st.Active:
+		a.infof(opts, "Plain git push, pull, fetch, clone and ls-remote now go through mgit; set %s=1 to skip it\n", shim.BypassEnv)
+	case st.OnPath:
+		a.infof(opts, "Another git comes before %s on PATH; move the directory to the front\n", dir)
+	default:
+		a.infof(opts, "Activate it by putting its directory first on PATH, e.g. in your shell profile:\n  export PATH=\"%s:$PATH\"\n", dir)
+	}
+}
+
+func (a *App) printShimUsage() {
+	fmt.Fprintln(a.stdout, "Usage:")
+	fmt.Fprintln(a.stdout, "  mgit shim install [--dir DIR] [--git PATH]   # git shim routing push/pull/fetch/clone/ls-remote through mgit")
+	fmt.Fprintln(a.stdout, "  mgit shim status [--dir DIR]")
+	fmt.Fprintln(a.stdout, "  mgit shim uninstall [--dir DIR]")
+}
@@ -0,0 +1,153 @@
+package cli
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pavelBuzdanov/mgit/internal/config"
+	"github.com/pavelBuzdanov/mgit/internal/runner"
+)
+
+type controlSocket struct {
+	Path        string `json:"path"`
+	ControlPath string `json:"controlPath"`
+	// Status is alive or dead as found, then closed or removed once cleaned
+	// up, or failed. Sockets mgit leaves alone are skipped, with the reason
+	// in Error.
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// configControlPaths returns the ControlPath settings of the config: in
+// sshCommand, the rules' sshCommand and hostDefaults options.
+func configControlPaths(cfg *config.Config) []string {
+	var args []string
+	commands := []string{cfg.SSHCommand}
+	for _, r := range cfg.Rules {
+		commands = append(commands, r.SSHCommand)
+	}
+	for _, command := range commands {
+		if client, err := runner.ParseSSHClient(command); err == nil && len(client) > 1 && !client.Plink() {
+			args = append(args, client[1:]...)
+		}
+	}
+	for _, d := range cfg.HostDefaults {
+		for _, opt := range d.Options {
+			args = append(args, "-o", opt)
+		}
+	}
+	return runner.ControlPaths(args)
+}
+
+// socketRefused reports whether connecting to the unix socket at path is
+// refused, which is how a socket left behind by a master that is gone
+// answers.
+func socketRefused(path string) bool {
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err == nil {
+		_ = conn.Close()
+		return false
+	}
+	return errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// handleSSHCleanup closes the ssh master connections whose control sockets
+// the config's ControlPath settings create, and removes sockets no master
+// listens on any more, which otherwise make later connections fail after a
+// network change or reboot. Only sockets in directories private to the user
+// are touched (see checkPrivateDir), and a socket is removed only when
+// connecting to it is refused.
+func (a *App) handleSSHCleanup(ctx context.Context, opts globalOptions, args []string) int {
+	fs := flag.NewFlagSet("mgit ssh-cleanup", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	list := fs.Bool("list", false, "only list the control sockets and whether a master is alive")
+	if err := fs.Parse(args); err != nil {
+		return a.fail(opts, usageError(err))
+	}
+	if runtime.GOOS == "windows" {
+		return a.fail(opts, errors.New("ssh-cleanup: Windows OpenSSH does not support connection multiplexing"))
+	}
+	cfg, _, err := a.loadConfig(opts)
+	if err != nil {
+		return a.fail(opts, err)
+	}
+	client := a.sshBinary(opts)
+
+	sockets := []controlSocket{}
+	failed := 0
+	for _, controlPath := range configControlPaths(cfg) {
+		expanded, err := config.ExpandPath(controlPath)
+		if err != nil {
+			return a.fail(opts, err)
+		}
+		matches, err := filepath.Glob(runner.ControlPathGlob(expanded))
+		if err != nil {
+			return a.fail(opts, fmt.Errorf("ControlPath %s: %w", controlPath, err))
+		}
+		for _, path := range matches {
+			if info, err := os.Lstat(path); err != nil || info.Mode()&os.ModeSocket == 0 {
+				continue
+			}
+			s := controlSocket{Path: path, ControlPath: controlPath, Status: "alive"}
+			if err := checkPrivateDir(filepath.Dir(path)); err != nil {
+				s.Status, s.Error = "skipped", err.Error()
+				sockets = append(sockets, s)
+				continue
+			}
+			if client.Control(ctx, path, "check") != nil {
+				s.Status = "dead"
+			}
+			if !*list && !opts.DryRun {
+				switch {
+				case s.Status == "alive":
+					err = client.Control(ctx, path, "exit")
+					s.Status = "closed"
+				case !socketRefused(path):
+					s.Status, s.Error = "skipped", "no master answers, but the socket still accepts connections"
+					err = nil
+				default:
+					err = os.Remove(path)
+					s.Status = "removed"
+				}
+				if err != nil {
+					s.Status, s.Error = "failed", err.Error()
+					failed++
+				}
+			}
+			sockets = append(sockets, s)
+		}
+	}
+
+	slices.SortFunc(sockets, func(x, y controlSocket) int { return cmp.Compare(x.Path, y.Path) })
+	if opts.Output.Structured() {
+		a.printData(opts, map[string]any{"sockets": sockets, "failed": failed})
+	} else if len(sockets) == 0 {
+		a.infof(opts, "No control sockets found for the ControlPath settings in the config\n")
+	} else {
+		tw := tabwriter.NewWriter(a.stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "STATUS\tSOCKET\tERROR")
+		for _, s := range sockets {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", s.Status, s.Path, dash(s.Error))
+		}
+		_ = tw.Flush()
+		if opts.DryRun && !*list {
+			a.infof(opts, "Dry run: alive masters would be closed and dead sockets removed\n")
+		}
+	}
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
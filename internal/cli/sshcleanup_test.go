@@ -0,0 +1,45 @@
+//go:build !windows
+
+package cli
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSocketRefused(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "s")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	if socketRefused(path) {
+		t.Error("listening socket reported as refused")
+	}
+	_ = ln.Close()
+	if !socketRefused(path) {
+		t.Error("socket without a listener not reported as refused")
+	}
+	if socketRefused(filepath.Join(filepath.Dir(path), "missing")) {
+		t.Error("missing socket reported as refused")
+	}
+}
+
+func TestCheckPrivateDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Chmod(dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkPrivateDir(dir); err != nil {
+		t.Errorf("private dir: %v", err)
+	}
+	if err := os.Chmod(dir, 0o777); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkPrivateDir(dir); err == nil {
+		t.Error("world-writable dir accepted")
+	}
+}
@@ -0,0 +1,11 @@
+//go:build windows
+
+package cli
+
+import "errors"
+
+// checkPrivateDir is never reached on Windows, where ssh-cleanup is not
+// available.
+func checkPrivateDir(string) error {
+	return errors.New("not supported on Windows")
+}
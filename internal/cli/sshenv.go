@@ -0,0 +1,76 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pavelBuzdanov/mgit/internal/config"
+	"github.com/pavelBuzdanov/mgit/internal/resolve"
+	"github.com/pavelBuzdanov/mgit/internal/runner"
+)
+
+// externalSSHCommand returns an ssh command set outside mgit and where it
+// comes from: GIT_SSH_COMMAND in the environment, which git prefers, or the
+// repository's core.sshCommand.
+func externalSSHCommand(ctx context.Context, git *runner.GitOps) (command, source string) {
+	if env := strings.TrimSpace(os.Getenv("GIT_SSH_COMMAND")); env != "" {
+		return env, "GIT_SSH_COMMAND"
+	}
+	if v := git.ConfigValue(ctx, "core.sshCommand"); v != "" {
+		return v, "core.sshCommand"
+	}
+	return "", ""
+}
+
+// reconcileSSHCommand applies the config's externalSshCommand to a resolved
+// SSH remote when an ssh command is already set outside mgit. It reports
+// whether mgit should still set GIT_SSH_COMMAND (not when respecting the
+// existing one), a note for --dry-run, and a warning when the existing
+// command is overridden; --strict-env turns that warning into an error. In
+// merge mode res is rebuilt around the existing command.
+func (a *App) reconcileSSHCommand(ctx context.Context, opts globalOptions, cfg *config.Config, git *runner.GitOps, res *resolve.Result) (apply bool, note, warning string, err error) {
+	existing, source := externalSSHCommand(ctx, git)
+	if existing == "" || existing == res.GITSSHCommand {
+		return true, "", "", nil
+	}
+	mode := config.ExternalOverride
+	if cfg != nil {
+		if mode, err = config.ParseExternalSSHMode(cfg.ExternalSSHCommand); err != nil {
+			return false, "", "", err
+		}
+	}
+	switch mode {
+	case config.ExternalMerge:
+		client, err := runner.ParseSSHClient(existing)
+		if err != nil || len(client) == 0 {
+			return false, "", "", fmt.Errorf("cannot merge %s %q: %v", source, existing, err)
+		}
+		res.SSHClient = client
+		res.GITSSHCommand = client.Command(res.KeyPath, res.SSHOptions...)
+		return true, fmt.Sprintf("%s is set; the rule's key was added to it (externalSshCommand: merge)", source), "", nil
+	case config.ExternalRespect:
+		return false, fmt.Sprintf("%s is set and used as is; no key was selected (externalSshCommand: respect)", source), "", nil
+	}
+	if opts.StrictEnv {
+		return false, "", "", fmt.Errorf("%s is set (%s) and mgit would override it (--strict-env); set \"externalSshCommand\" to merge or respect, or unset it", source, existing)
+	}
+	return true, "", fmt.Sprintf("%s is set (%s); mgit overrides it with the rule's key. Set \"externalSshCommand\" to merge or respect to keep it", source, existing), nil
+}
+
+// externalSSHEffect describes for status what mgit does with an ssh command
+// set outside it.
+func externalSSHEffect(cfg *config.Config) string {
+	mode := config.ExternalOverride
+	if cfg != nil {
+		mode, _ = config.ParseExternalSSHMode(cfg.ExternalSSHCommand)
+	}
+	switch mode {
+	case config.ExternalMerge:
+		return "mgit adds the rule's key to it"
+	case config.ExternalRespect:
+		return "mgit uses it and selects no key"
+	}
+	return "mgit overrides it with GIT_SSH_COMMAND"
+}
@@ -0,0 +1,107 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pavelBuzdanov/mgit/internal/config"
+	"github.com/pavelBuzdanov/mgit/internal/resolve"
+)
+
+type ruleStats struct {
+	ID       string `json:"id"`
+	Host     string `json:"host"`
+	Owner    string `json:"owner"`
+	Key      string `json:"key"`
+	Count    int    `json:"count"`
+	LastUsed string `json:"lastUsed,omitempty"`
+}
+
+// recordUsage counts the rule an exec used when the config opts in to stats.
+// Failures only warn: stats must never fail a git command.
+func (a *App) recordUsage(opts globalOptions, res *resolve.Result) {
+	if res == nil || res.MatchedRule == nil || !res.SSHSelectionApplies {
+		return
+	}
+	cfg, path, err := a.loadConfig(opts)
+	if err != nil || !cfg.Stats {
+		return
+	}
+	if err := config.RecordUsage(path, *res.MatchedRule, time.Now()); err != nil && opts.Verbose {
+		fmt.Fprintf(a.stderr, "warn: failed to record usage stats: %v\n", err)
+	}
+}
+
+func (a *App) handleStats(ctx context.Context, opts globalOptions, args []string) int {
+	_ = ctx
+	if len(args) > 0 {
+		switch args[0] {
+		case "enable", "disable":
+			enable := args[0] == "enable"
+			path, err := a.updateConfig(opts, func(cfg *config.Config) error {
+				cfg.Stats = enable
+				return nil
+			})
+			if err != nil {
+				return a.fail(opts, err)
+			}
+			if enable {
+				a.infof(opts, "Usage stats enabled; recording to %s\n", config.UsagePath(path))
+			} else {
+				a.infof(opts, "Usage stats disabled; recorded stats are kept in %s\n", config.UsagePath(path))
+			}
+			return 0
+		default:
+			a.printStatsUsage()
+			return 2
+		}
+	}
+	cfg, path, err := a.loadConfig(opts)
+	if err != nil {
+		return a.fail(opts, err)
+	}
+	usage, err := config.LoadUsage(path)
+	if err != nil {
+		return a.fail(opts, err)
+	}
+	rows := make([]ruleStats, 0, len(cfg.Rules))
+	for _, r := range cfg.Rules {
+		u := usage[r.ID]
+		rows = append(rows, ruleStats{ID: r.ID, Host: r.Host, Owner: r.Owner, Key: ruleKeyLabel(r), Count: u.Count, LastUsed: u.LastUsed})
+	}
+	if opts.Output.Structured() {
+		a.printData(opts, map[string]any{
+			"enabled":   cfg.Stats,
+			"statsPath": config.UsagePath(path),
+			"rules":     rows,
+		})
+		return 0
+	}
+	if !cfg.Stats {
+		a.infof(opts, "Usage stats are off; turn them on with: mgit stats enable\n")
+		if len(usage) == 0 {
+			return 0
+		}
+	}
+	if len(rows) == 0 {
+		fmt.Fprintln(a.stdout, "No rules configured")
+		return 0
+	}
+	tw := tabwriter.NewWriter(a.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "#\tID\tHOST\tOWNER\tKEY/AGENT\tUSES\tLAST USED")
+	for i, r := range rows {
+		lastUsed := "never"
+		if t, err := time.Parse(time.RFC3339, r.LastUsed); err == nil {
+			lastUsed = t.Local().Format("2006-01-02 15:04")
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%d\t%s\n", i+1, r.ID, r.Host, r.Owner, r.Key, r.Count, lastUsed)
+	}
+	_ = tw.Flush()
+	return 0
+}
+
+func (a *App) printStatsUsage() {
+	fmt.Fprintln(a.stdout, "Usage: mgit stats [enable | disable]")
+}
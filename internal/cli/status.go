@@ -0,0 +1,165 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pavelBuzdanov/mgit/internal/config"
+	"github.com/pavelBuzdanov/mgit/internal/guard"
+	"github.com/pavelBuzdanov/mgit/internal/resolve"
+	"github.com/pavelBuzdanov/mgit/internal/runner"
+	"github.com/pavelBuzdanov/mgit/pkg/giturl"
+)
+
+type remoteStatus struct {
+	Name      string   `json:"name"`
+	URL       string   `json:"url"`
+	Host      string   `json:"host,omitempty"`
+	Owner     string   `json:"owner,omitempty"`
+	Transport string   `json:"transport,omitempty"`
+	RuleID    string   `json:"ruleId,omitempty"`
+	KeyPath   string   `json:"keyPath,omitempty"`
+	Warnings  []string `json:"warnings,omitempty"`
+}
+
+type repoStatus struct {
+	ConfigPath string         `json:"configPath,omitempty"`
+	UserEmail  string         `json:"userEmail,omitempty"`
+	SSHCommand string         `json:"coreSshCommand,omitempty"`
+	Remotes    []remoteStatus `json:"remotes"`
+	Warnings   []string       `json:"warnings,omitempty"`
+}
+
+func (a *App) handleStatus(ctx context.Context, opts globalOptions, args []string) int {
+	fs := flag.NewFlagSet("mgit status", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	if err := fs.Parse(args); err != nil {
+		return a.fail(opts, usageError(err))
+	}
+	git := a.gitOps(opts, a.newShell(opts))
+	git.ReadConfigFiles = true
+	if ok, err := git.IsRepo(ctx); err != nil || !ok {
+		return a.fail(opts, errors.New("not a git repository"))
+	}
+	st, err := a.buildRepoStatus(ctx, opts, git)
+	if err != nil {
+		return a.fail(opts, err)
+	}
+	if opts.Output.Structured() {
+		a.printData(opts, st)
+		return 0
+	}
+	a.printRepoStatus(st)
+	return 0
+}
+
+func (a *App) buildRepoStatus(ctx context.Context, opts globalOptions, git *runner.GitOps) (repoStatus, error) {
+	var st repoStatus
+	cfg, cfgPath, cfgErr := a.loadConfig(opts)
+	st.ConfigPath = cfgPath
+	if cfgErr != nil {
+		st.Warnings = append(st.Warnings, "config not loaded: "+firstLine(cfgErr.Error()))
+	}
+	st.UserEmail = git.ConfigValue(ctx, "user.email")
+	st.SSHCommand = git.ConfigValue(ctx, "core.sshCommand")
+	if st.SSHCommand != "" {
+		st.Warnings = append(st.Warnings, "core.sshCommand is set: plain git uses it, "+externalSSHEffect(cfg))
+	}
+	if env := os.Getenv("GIT_SSH_COMMAND"); env != "" {
+		st.Warnings = append(st.Warnings, "GIT_SSH_COMMAND is set in the environment: for SSH remotes "+externalSSHEffect(cfg))
+	}
+
+	remotes, err := git.Remotes(ctx)
+	if err != nil {
+		return st, fmt.Errorf("failed to read remotes: %w", err)
+	}
+	names := make([]string, 0, len(remotes))
+	for name := range remotes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	st.Remotes = []remoteStatus{}
+	for _, name := range names {
+		st.Remotes = append(st.Remotes, remoteStatusFor(cfg, name, remotes[name], st.UserEmail))
+	}
+	return st, nil
+}
+
+func remoteStatusFor(cfg *config.Config, name, rawURL, userEmail string) remoteStatus {
+	rs := remoteStatus{Name: name, URL: rawURL}
+	if cfg == nil {
+		cfg = &config.Config{}
+	}
+	res, err := resolve.FromRemote(cfg, name, rawURL)
+	if err != nil {
+		rs.Warnings = append(rs.Warnings, "no matching rule")
+		if parsed, perr := giturl.Parse(rawURL); perr == nil {
+			rs.Host, rs.Owner, rs.Transport = parsed.Host, parsed.Owner, string(parsed.Transport)
+		}
+		return rs
+	}
+	if res.Parsed != nil {
+		rs.Host, rs.Owner, rs.Transport = res.Parsed.Host, res.Parsed.Owner, string(res.Parsed.Transport)
+	}
+	if !res.SSHSelectionApplies {
+		if res.MatchedRule != nil {
+			rs.RuleID = res.MatchedRule.ID
+		} else {
+			rs.Warnings = append(rs.Warnings, "HTTPS: SSH key selection not applied")
+		}
+		return rs
+	}
+	rs.RuleID = res.MatchedRule.ID
+	rs.KeyPath = res.KeyPath
+	if res.Fallback {
+		rs.Warnings = append(rs.Warnings, "no rule matched; fallback defaultKey used")
+	}
+	if res.KeyNeedsPassphrase {
+		rs.Warnings = append(rs.Warnings, "key needs a passphrase (not in ssh-agent)")
+	}
+	if res.MatchedRule.Email != "" && !guard.EmailMatches(res.MatchedRule.Email, userEmail) {
+		rs.Warnings = append(rs.Warnings, fmt.Sprintf("user.email does not match expected %s", res.MatchedRule.Email))
+	}
+	return rs
+}
+
+func (a *App) printRepoStatus(st repoStatus) {
+	email := st.UserEmail
+	if email == "" {
+		email = "(unset)"
+	}
+	fmt.Fprintf(a.stdout, "user.email: %s\n", email)
+	if len(st.Remotes) == 0 {
+		fmt.Fprintln(a.stdout, "No remotes configured")
+	} else {
+		tw := tabwriter.NewWriter(a.stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "REMOTE\tHOST\tOWNER\tRULE\tKEY\tWARNINGS")
+		for _, r := range st.Remotes {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
+				r.Name, dash(r.Host), dash(r.Owner), dash(r.RuleID), dash(r.KeyPath), dash(strings.Join(r.Warnings, "; ")))
+		}
+		_ = tw.Flush()
+	}
+	for _, w := range st.Warnings {
+		fmt.Fprintf(a.stdout, "Warning: %s\n", w)
+	}
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
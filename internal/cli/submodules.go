@@ -0,0 +1,161 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pavelBuzdanov/mgit/internal/config"
+	"github.com/pavelBuzdanov/mgit/internal/resolve"
+	"github.com/pavelBuzdanov/mgit/internal/runner"
+	"github.com/pavelBuzdanov/mgit/internal/ui"
+	"github.com/pavelBuzdanov/mgit/pkg/giturl"
+)
+
+// submoduleReport is one .gitmodules entry in resolve --submodules.
+type submoduleReport struct {
+	runner.Submodule
+	// ResolvedURL is the URL a relative submodule URL resolves to.
+	ResolvedURL string          `json:"resolvedUrl,omitempty"`
+	Result      *resolve.Result `json:"result,omitempty"`
+	Error       string          `json:"error,omitempty"`
+	Warning     string          `json:"warning,omitempty"`
+}
+
+// resolveSubmodules implements resolve --submodules: the rule and key for
+// every URL in .gitmodules, so a recursive clone can be checked before it is
+// started. It fails when any submodule has no key.
+func (a *App) resolveSubmodules(ctx context.Context, opts globalOptions) int {
+	git := a.gitOps(opts, a.newShell(opts))
+	subs, err := git.Submodules(ctx)
+	if err != nil {
+		return a.fail(opts, err)
+	}
+	cfg, _, cfgErr := a.loadConfig(opts)
+	if cfgErr != nil {
+		cfg = nil
+	}
+
+	// Relative URLs resolve against the superproject's remote, and a
+	// recursive clone hands the superproject's GIT_SSH_COMMAND to every
+	// submodule, so resolve the superproject too.
+	var superRemote, superURL string
+	var super *resolve.Result
+	quiet := a.newShell(opts)
+	quiet.Stderr = io.Discard // no upstream is fine here
+	if remote, err := a.gitOps(opts, quiet).GuessDefaultRemote(ctx); err == nil {
+		if u, err := git.RemoteURL(ctx, remote); err == nil {
+			superRemote, superURL = remote, u
+			super, _ = resolve.FromRemote(cfg, remote, u)
+		}
+	}
+
+	reports := make([]submoduleReport, 0, len(subs))
+	failed := false
+	for _, s := range subs {
+		rep := resolveSubmodule(cfg, cfgErr, s, superURL, super)
+		if rep.Error != "" {
+			failed = true
+		}
+		rep.Result = redactResult(opts, rep.Result)
+		reports = append(reports, rep)
+	}
+
+	switch {
+	case opts.Output.Structured():
+		payload := map[string]any{"submodules": reports}
+		if superRemote != "" {
+			payload["remote"] = superRemote
+			payload["url"] = superURL
+		}
+		a.printData(opts, payload)
+	case len(reports) == 0:
+		fmt.Fprintln(a.stdout, "No submodules (.gitmodules not found or empty)")
+	case opts.Output == ui.FormatTable:
+		a.printSubmoduleTable(reports)
+	default:
+		c := a.color(opts)
+		for _, r := range reports {
+			fmt.Fprintf(a.stdout, "%s (%s) => %s\n", r.Name, dash(r.Path), r.URL)
+			if r.ResolvedURL != "" {
+				fmt.Fprintf(a.stdout, "    resolved: %s\n", r.ResolvedURL)
+			}
+			switch {
+			case r.Error != "":
+				fmt.Fprintf(a.stdout, "    %s %s\n", c.Red("error:"), r.Error)
+			case r.Result.MatchedRule != nil && r.Result.SSHSelectionApplies:
+				fmt.Fprintf(a.stdout, "    rule: id=%s key=%s\n", r.Result.MatchedRule.ID, r.Result.KeyPath)
+			case r.Result.MatchedRule != nil:
+				fmt.Fprintf(a.stdout, "    rule: id=%s (%s)\n", r.Result.MatchedRule.ID, r.Result.Parsed.Transport)
+			default:
+				fmt.Fprintf(a.stdout, "    rule: n/a (%s remote)\n", r.Result.Parsed.Transport)
+			}
+			if r.Warning != "" {
+				fmt.Fprintf(a.stdout, "    %s %s\n", c.Yellow("warning:"), r.Warning)
+			}
+		}
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+func resolveSubmodule(cfg *config.Config, cfgErr error, s runner.Submodule, superURL string, super *resolve.Result) submoduleReport {
+	rep := submoduleReport{Submodule: s}
+	url := s.URL
+	if giturl.IsRelative(url) {
+		if superURL == "" {
+			rep.Error = "relative URL, but the superproject has no remote to resolve it against"
+			return rep
+		}
+		url = giturl.JoinRelative(superURL, url)
+		rep.ResolvedURL = url
+	}
+	// git names a submodule's remote origin when it clones it.
+	res, err := resolve.FromRemote(cfg, "origin", url)
+	if err != nil {
+		if _, perr := giturl.Parse(url); perr == nil && cfg == nil && cfgErr != nil {
+			// Only SSH remotes need the config; report why it is missing.
+			err = cfgErr
+		}
+		rep.Error = err.Error()
+		return rep
+	}
+	rep.Result = res
+	var warnings []string
+	if res.Fallback {
+		warnings = append(warnings, "no rule matched; fallback defaultKey used")
+	}
+	if res.KeyNeedsPassphrase {
+		warnings = append(warnings, resolve.PassphraseWarning(res.KeyPath))
+	}
+	if super != nil && super.SSHSelectionApplies && res.SSHSelectionApplies && res.KeyPath != super.KeyPath {
+		warnings = append(warnings, fmt.Sprintf("needs key %s, but mgit clone --recurse-submodules passes the superproject's key (%s) to every submodule", res.KeyPath, super.KeyPath))
+	}
+	rep.Warning = strings.Join(warnings, "; ")
+	return rep
+}
+
+func (a *App) printSubmoduleTable(reports []submoduleReport) {
+	tw := tabwriter.NewWriter(a.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SUBMODULE\tPATH\tURL\tRULE\tKEY\tPROBLEM")
+	for _, r := range reports {
+		rule, key := "-", "-"
+		if r.Result != nil && r.Result.MatchedRule != nil {
+			rule, key = r.Result.MatchedRule.ID, dash(r.Result.KeyPath)
+		}
+		problem := r.Error
+		if problem == "" {
+			problem = r.Warning
+		}
+		url := r.URL
+		if r.ResolvedURL != "" {
+			url = r.ResolvedURL
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", r.Name, dash(r.Path), url, rule, key, dash(problem))
+	}
+	_ = tw.Flush()
+}
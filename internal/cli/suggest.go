@@ -0,0 +1,92 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/pavelBuzdanov/mgit/internal/runner"
+)
+
+// builtinCommands are the subcommands dispatched in Run.
+var builtinCommands = []string{
+	"help", "version", "setup", "import", "export", "config", "rule", "ui", "resolve", "doctor", "status", "selftest", "remotes", "which", "ssh-test", "ssh-cleanup", "agent", "ssh-config-hook", "match-host", "install-dispatcher", "pin", "unpin",
+	"key", "knownhosts", "guard", "hooks", "shim", "gh", "glab", "sync", "stats", "ws", "workspace", "exec",
+}
+
+// suggest returns the candidate closest to s, or "" when none is close
+// enough to be a plausible typo.
+func suggest(s string, candidates []string) string {
+	limit := 1
+	if len(s) >= 5 {
+		limit = 2
+	}
+	best, bestDist := "", limit+1
+	for _, c := range candidates {
+		if c == s {
+			return ""
+		}
+		if d := editDistance(strings.ToLower(s), strings.ToLower(c)); d < bestDist {
+			best, bestDist = c, d
+		}
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance with adjacent transpositions
+// counted as one edit, so "reslove" is one step from "resolve".
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	d := make([][]int, len(ra)+1)
+	for i := range d {
+		d[i] = make([]int, len(rb)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(ra)][len(rb)]
+}
+
+// suggestCommand returns the mgit command or plugin that name looks like a
+// typo of. Names git knows (subcommands, git-* tools, aliases) are left alone
+// because they are passed through to git.
+func (a *App) suggestCommand(ctx context.Context, opts globalOptions, name string) string {
+	if strings.HasPrefix(name, "-") {
+		return ""
+	}
+	hint := suggest(name, append(slices.Clone(builtinCommands), discoverPlugins()...))
+	if hint == "" {
+		return ""
+	}
+	gitCommands, err := a.gitOps(opts, a.newShell(opts)).Commands(ctx)
+	if err != nil || slices.Contains(gitCommands, name) {
+		return ""
+	}
+	return hint
+}
+
+// remoteURLError wraps a failed remote lookup, naming the configured remote
+// the user most likely meant.
+func remoteURLError(ctx context.Context, git *runner.GitOps, name string, err error) error {
+	err = fmt.Errorf("failed to get URL for remote %q: %w", name, err)
+	if names, listErr := git.RemoteNames(ctx); listErr == nil {
+		if hint := suggest(name, names); hint != "" {
+			return fmt.Errorf("%w\nDid you mean %q?", err, hint)
+		}
+	}
+	return err
+}
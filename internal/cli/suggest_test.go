@@ -0,0 +1,33 @@
+package cli
+
+import "testing"
+
+func TestSuggest(t *testing.T) {
+	cases := []struct {
+		in   string
+		want string
+	}{
+		{"reslove", "resolve"},
+		{"orgin", "origin"},
+		{"stauts", "status"},
+		{"docter", "doctor"},
+		{"origin", ""},
+		{"commit", ""},
+		{"xy", ""},
+	}
+	candidates := append([]string{"origin", "upstream"}, builtinCommands...)
+	for _, c := range cases {
+		if got := suggest(c.in, candidates); got != c.want {
+			t.Errorf("suggest(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	if d := editDistance("reslove", "resolve"); d != 1 {
+		t.Fatalf("transposition distance = %d, want 1", d)
+	}
+	if d := editDistance("kitten", "sitting"); d != 3 {
+		t.Fatalf("editDistance(kitten, sitting) = %d, want 3", d)
+	}
+}
@@ -0,0 +1,251 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pavelBuzdanov/mgit/internal/config"
+	"github.com/pavelBuzdanov/mgit/internal/resolve"
+	"github.com/pavelBuzdanov/mgit/internal/runner"
+	"github.com/pavelBuzdanov/mgit/internal/ui"
+	"github.com/pavelBuzdanov/mgit/internal/workspace"
+)
+
+type syncResult struct {
+	Name     string `json:"name"`
+	Path     string `json:"path"`
+	Branch   string `json:"branch,omitempty"`
+	Remote   string `json:"remote,omitempty"`
+	RuleID   string `json:"ruleId,omitempty"`
+	Upstream bool   `json:"upstream"`
+	Ahead    int    `json:"ahead"`
+	Behind   int    `json:"behind"`
+	Error    string `json:"error,omitempty"`
+	// Output is git's output, kept only for failed repositories.
+	Output string `json:"output,omitempty"`
+}
+
+func (a *App) handleSync(ctx context.Context, opts globalOptions, args []string) int {
+	fs := flag.NewFlagSet("mgit sync", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	scan := fs.String("scan", "", "")
+	useWorkspace := fs.Bool("workspace", false, "")
+	pull := fs.Bool("pull", false, "")
+	jobs := fs.Int("jobs", 4, "")
+	if err := fs.Parse(args); err != nil {
+		return a.fail(opts, usageError(err))
+	}
+	if *scan != "" && *useWorkspace {
+		return a.fail(opts, usageError(errors.New("use either --scan or --workspace")))
+	}
+	if *jobs < 1 {
+		return a.fail(opts, usageError(errors.New("--jobs must be at least 1")))
+	}
+
+	var repos []workspace.Repo
+	if *scan != "" {
+		root, err := config.ExpandPath(*scan)
+		if err != nil {
+			return a.fail(opts, usageError(err))
+		}
+		if repos, err = workspace.Scan(root); err != nil {
+			return a.fail(opts, err)
+		}
+	} else {
+		reg, _, err := a.loadWorkspace()
+		if err != nil {
+			return a.fail(opts, err)
+		}
+		repos = reg.Repos
+	}
+	if len(repos) == 0 {
+		return a.fail(opts, errors.New("no repositories to sync; register some with `mgit ws add` or use --scan <dir>"))
+	}
+
+	progress := a.progressFor(opts, len(repos))
+	results := make([]syncResult, len(repos))
+	sem := make(chan struct{}, *jobs)
+	var wg sync.WaitGroup
+	for i, repo := range repos {
+		wg.Add(1)
+		go func(i int, repo workspace.Repo) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			progress.Start(repo.Name)
+			results[i] = a.syncRepo(ctx, opts, repo, *pull, progress.Printf)
+			progress.Done(repo.Name)
+			if opts.Output == ui.FormatJSONL {
+				a.printLine(results[i])
+			}
+		}(i, repo)
+	}
+	wg.Wait()
+	progress.Finish()
+
+	failed := 0
+	for _, r := range results {
+		if r.Error != "" {
+			failed++
+		}
+	}
+	switch {
+	case opts.Output == ui.FormatJSONL:
+	case opts.Output.Structured():
+		a.printData(opts, map[string]any{"repos": results, "failed": failed})
+	case !opts.DryRun:
+		a.printSyncSummary(results, failed)
+	}
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// syncRepo fetches (or pulls) the default remote of one repository with the
+// key its own config resolves for that remote.
+func (a *App) syncRepo(ctx context.Context, opts globalOptions, repo workspace.Repo, pull bool, progress func(string, ...any)) syncResult {
+	res := syncResult{Name: repo.Name, Path: repo.Path}
+	fail := func(err error, output string) syncResult {
+		res.Error = firstLine(err.Error())
+		res.Output = strings.TrimSpace(output)
+		progress("[%s] failed: %s", repo.Name, res.Error)
+		return res
+	}
+
+	var out bytes.Buffer
+	shell := runner.NewShell(&out, &out, false)
+	shell.Dir = repo.Path
+	git := a.gitOps(opts, shell)
+	if ok, err := git.IsRepo(ctx); err != nil || !ok {
+		return fail(errors.New("not a git repository"), "")
+	}
+	res.Branch, _ = git.CurrentBranch(ctx)
+	remote, err := git.GuessDefaultRemote(ctx)
+	if err != nil {
+		return fail(err, "")
+	}
+	res.Remote = remote
+	rawURL, err := git.RemoteURL(ctx, remote)
+	if err != nil {
+		return fail(fmt.Errorf("failed to get URL for remote %q: %w", remote, err), "")
+	}
+
+	repoOpts := opts
+	repoOpts.Dir = repo.Path
+	resolved, _, err := a.resolveRemote(repoOpts, remote, rawURL)
+	if err != nil {
+		return fail(err, "")
+	}
+	extraEnv := map[string]string{}
+	if env, _ := a.ruleEnv(repoOpts, remote, rawURL); len(env) > 0 {
+		maps.Copy(extraEnv, env)
+	}
+	if resolved.SSHSelectionApplies {
+		res.RuleID = resolved.MatchedRule.ID
+		extraEnv["GIT_SSH_COMMAND"] = resolved.GITSSHCommand
+	} else if resolved.MatchedRule != nil {
+		res.RuleID = resolved.MatchedRule.ID
+	}
+
+	gitArgs := []string{"fetch", remote}
+	if pull {
+		gitArgs = append([]string{"pull", "--ff-only", remote}, pullRef(ctx, git, remote, res.Branch)...)
+	}
+	gitArgs = append(resolve.GitConfigArgs(resolved.GitConfig), gitArgs...)
+	if opts.DryRun {
+		progress("Dry run: [%s] git %s %s", repo.Name, strings.Join(gitArgs, " "), formatEnv(extraEnv))
+		return res
+	}
+
+	progress("[%s] %s %s (rule %s)", repo.Name, gitArgs[0], remote, dash(res.RuleID))
+	if resolved.KeyProvider != "" {
+		cleanup, err := resolved.MaterializeKey(ctx)
+		defer cleanup()
+		if err != nil {
+			return fail(err, "")
+		}
+		extraEnv["GIT_SSH_COMMAND"] = resolved.GITSSHCommand
+	}
+	if resolved.SSHSelectionApplies {
+		env, err := a.passphraseEnv(repoOpts, resolved)
+		if err != nil {
+			return fail(err, "")
+		}
+		maps.Copy(extraEnv, env)
+	}
+	out.Reset()
+	retry := func(attempt, attempts int, wait time.Duration, reason string) {
+		progress("[%s] retrying in %s (attempt %d/%d) after: %s", repo.Name, wait, attempt, attempts, reason)
+	}
+	if err := git.RunGitRetry(ctx, gitArgs, extraEnv, a.retries(repoOpts), retry); err != nil {
+		return fail(err, out.String())
+	}
+	res.Ahead, res.Behind, res.Upstream, err = git.AheadBehind(ctx)
+	if err != nil {
+		return fail(err, out.String())
+	}
+	if res.Upstream {
+		progress("[%s] done: ahead %d, behind %d", repo.Name, res.Ahead, res.Behind)
+	} else {
+		progress("[%s] done: no upstream", repo.Name)
+	}
+	return res
+}
+
+// pullRef is what `sync --pull` merges from remote: the branch's upstream
+// when it lives on remote, else the branch of the same name. Naming remote
+// and branch keeps git from pulling an upstream on another remote, which
+// the key resolved for remote may not be able to read.
+func pullRef(ctx context.Context, git *runner.GitOps, remote, branch string) []string {
+	if branch == "" || branch == "HEAD" {
+		return nil
+	}
+	if git.ConfigValue(ctx, "branch."+branch+".remote") == remote {
+		if merge := git.ConfigValue(ctx, "branch."+branch+".merge"); merge != "" {
+			return []string{merge}
+		}
+	}
+	return []string{branch}
+}
+
+func (a *App) printSyncSummary(results []syncResult, failed int) {
+	fmt.Fprintln(a.stdout)
+	tw := tabwriter.NewWriter(a.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "REPO\tBRANCH\tAHEAD\tBEHIND\tSTATUS")
+	for _, r := range results {
+		ahead, behind, status := "-", "-", "ok"
+		if r.Upstream {
+			ahead, behind = fmt.Sprint(r.Ahead), fmt.Sprint(r.Behind)
+		} else if r.Error == "" {
+			status = "no upstream"
+		}
+		if r.Error != "" {
+			status = "failed: " + r.Error
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", r.Name, dash(r.Branch), ahead, behind, status)
+	}
+	_ = tw.Flush()
+	for _, r := range results {
+		if r.Output != "" {
+			fmt.Fprintf(a.stderr, "\n[%s] git output:\n%s\n", r.Name, r.Output)
+		}
+	}
+	fmt.Fprintf(a.stdout, "%d repositories, %d failed\n", len(results), failed)
+}
+
+func formatEnv(env map[string]string) string {
+	if len(env) == 0 {
+		return "(no SSH env override)"
+	}
+	return strings.Join(stableMapLines(env), " ")
+}
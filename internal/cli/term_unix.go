@@ -0,0 +1,45 @@
+//go:build !windows
+
+package cli
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+)
+
+type rawTerminal struct {
+	stdin *os.File
+	state string
+}
+
+func newRawTerminal(stdin *os.File) (*rawTerminal, error) {
+	get := exec.Command("stty", "-g")
+	get.Stdin = stdin
+	out, err := get.Output()
+	if err != nil {
+		return nil, err
+	}
+	state := strings.TrimSpace(string(out))
+	set := exec.Command("stty", "raw", "-echo")
+	set.Stdin = stdin
+	if err := set.Run(); err != nil {
+		return nil, err
+	}
+	return &rawTerminal{stdin: stdin, state: state}, nil
+}
+
+func (r *rawTerminal) restore() {
+	if r == nil || r.stdin == nil || r.state == "" {
+		return
+	}
+	cmd := exec.Command("stty", r.state)
+	cmd.Stdin = r.stdin
+	_ = cmd.Run()
+}
+
+// openTerminal opens the controlling terminal, which ssh also prompts on;
+// it fails when the process has none (cron, CI, detached sessions).
+func openTerminal() (*os.File, error) {
+	return os.OpenFile("/dev/tty", os.O_RDWR, 0)
+}
@@ -0,0 +1,73 @@
+//go:build windows
+
+package cli
+
+import (
+	"os"
+	"syscall"
+)
+
+// Console mode flags from wincon.h.
+const (
+	enableProcessedInput            = 0x0001
+	enableLineInput                 = 0x0002
+	enableEchoInput                 = 0x0004
+	enableVirtualTerminalInput      = 0x0200
+	enableProcessedOutput           = 0x0001
+	enableVirtualTerminalProcessing = 0x0004
+)
+
+var procSetConsoleMode = syscall.NewLazyDLL("kernel32.dll").NewProc("SetConsoleMode")
+
+func setConsoleMode(h syscall.Handle, mode uint32) error {
+	if r, _, err := procSetConsoleMode.Call(uintptr(h), uintptr(mode)); r == 0 {
+		return err
+	}
+	return nil
+}
+
+// rawTerminal switches the console to raw input with virtual terminal
+// sequences enabled, so arrow keys arrive as the same ESC [ A/B sequences
+// as on Unix and the menu's escape codes render in cmd, PowerShell and
+// Windows Terminal alike.
+type rawTerminal struct {
+	in, out         syscall.Handle
+	inMode, outMode uint32
+	outSet          bool
+}
+
+func newRawTerminal(stdin *os.File) (*rawTerminal, error) {
+	r := &rawTerminal{in: syscall.Handle(stdin.Fd())}
+	if err := syscall.GetConsoleMode(r.in, &r.inMode); err != nil {
+		return nil, err
+	}
+	raw := r.inMode&^(enableEchoInput|enableLineInput|enableProcessedInput) | enableVirtualTerminalInput
+	if err := setConsoleMode(r.in, raw); err != nil {
+		// Consoles older than Windows 10 reject VT input; callers fall back
+		// to the numbered prompt.
+		return nil, err
+	}
+	if out, err := syscall.GetStdHandle(syscall.STD_OUTPUT_HANDLE); err == nil {
+		if syscall.GetConsoleMode(out, &r.outMode) == nil &&
+			setConsoleMode(out, r.outMode|enableProcessedOutput|enableVirtualTerminalProcessing) == nil {
+			r.out, r.outSet = out, true
+		}
+	}
+	return r, nil
+}
+
+func (r *rawTerminal) restore() {
+	if r == nil {
+		return
+	}
+	_ = setConsoleMode(r.in, r.inMode)
+	if r.outSet {
+		_ = setConsoleMode(r.out, r.outMode)
+	}
+}
+
+// openTerminal opens the console input, which ssh also prompts on; it fails
+// when the process has no console.
+func openTerminal() (*os.File, error) {
+	return os.OpenFile("CONIN$", os.O_RDWR, 0)
+}
@@ -0,0 +1,171 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/pavelBuzdanov/mgit/internal/config"
+	"github.com/pavelBuzdanov/mgit/pkg/giturl"
+)
+
+type whichResult struct {
+	Remote string `json:"remote,omitempty"`
+	URL    string `json:"url"`
+	RuleID string `json:"ruleId,omitempty"`
+	Key    string `json:"keyPath"`
+}
+
+// handleWhich prints only the key a remote (default: the guessed one) or URL
+// resolves to, and with --rule the rule id after a tab. Meant for prompts and
+// scripts: nothing else goes to stdout, and it exits 1 when no SSH key
+// applies (e.g. an HTTPS remote). Answers for remotes are cached next to the
+// config (see whichCache) unless --no-cache is given.
+func (a *App) handleWhich(ctx context.Context, opts globalOptions, args []string) int {
+	fs := flag.NewFlagSet("mgit which", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	withRule := fs.Bool("rule", false, "")
+	noCache := fs.Bool("no-cache", false, "")
+	if err := fs.Parse(args); err != nil {
+		return a.fail(opts, usageError(err))
+	}
+	if fs.NArg() > 1 {
+		return a.fail(opts, usageError(errors.New("usage: mgit which [--rule] [--no-cache] [remote|url]")))
+	}
+
+	var out whichResult
+	var cache *whichCache
+	if !*noCache && !giturl.IsLikelyRemoteURL(fs.Arg(0)) {
+		cache = a.openWhichCache(opts, fs.Arg(0))
+	}
+	if e, ok := cache.lookup(); ok {
+		// The config is not loaded for a cached answer, but its signature
+		// is still checked.
+		if err := a.allowUnverified(opts, config.VerifyFile(cache.cfgPath)); err != nil {
+			return a.fail(opts, withExitCode(exitConfig, err))
+		}
+		out = whichResult{Remote: e.Remote, URL: e.URL, RuleID: e.RuleID, Key: e.Key}
+		a.printWhich(opts, out, *withRule)
+		return 0
+	}
+	quiet := a.newShell(opts)
+	quiet.Stderr = io.Discard // the error below says it better
+	git := a.gitOps(opts, quiet)
+	git.ReadConfigFiles = true
+	switch target := fs.Arg(0); {
+	case giturl.IsLikelyRemoteURL(target):
+		out.URL = target
+	default:
+		out.Remote = target
+		if out.Remote == "" {
+			remote, err := git.GuessDefaultRemote(ctx)
+			if err != nil {
+				return a.fail(opts, err)
+			}
+			out.Remote = remote
+		}
+		u, err := git.RemoteURL(ctx, out.Remote)
+		if err != nil {
+			return a.fail(opts, remoteURLError(ctx, git, out.Remote, err))
+		}
+		out.URL = u
+	}
+
+	res, _, err := a.resolveRemote(opts, out.Remote, out.URL)
+	if err != nil {
+		return a.fail(opts, err)
+	}
+	if !res.SSHSelectionApplies {
+		return a.fail(opts, fmt.Errorf("%s is not an SSH remote; no key applies", out.URL))
+	}
+	out.Key = res.KeyPath
+	out.RuleID = res.MatchedRule.ID
+	if res.Fallback {
+		out.RuleID = "defaultKey"
+	}
+	if err := cache.store(out); err != nil && opts.Verbose {
+		fmt.Fprintf(a.stderr, "warn: failed to cache the result: %v\n", err)
+	}
+	a.printWhich(opts, out, *withRule)
+	return 0
+}
+
+func (a *App) printWhich(opts globalOptions, out whichResult, withRule bool) {
+	switch {
+	case opts.Output.Structured():
+		a.printData(opts, out)
+	case withRule:
+		fmt.Fprintf(a.stdout, "%s\t%s\n", out.Key, out.RuleID)
+	default:
+		fmt.Fprintln(a.stdout, out.Key)
+	}
+}
+
+// whichCache is the cached answer of mgit which for one remote of the
+// current repository, kept in cache.json next to the config. It is keyed by
+// repository and remote and goes stale when the config, its signatures, the
+// trusted keys, the repository's git config or HEAD, or the global git
+// config changes. A nil *whichCache caches nothing.
+type whichCache struct {
+	cfgPath string
+	key     string
+	stamps  config.Stamps
+}
+
+// openWhichCache returns the cache for remote ("" for the default one), or
+// nil when there is no config or repository to key it by. The file stamps
+// are taken now, before git is asked anything, so a change made while
+// resolving invalidates the stored entry. --strict bypasses it: entries
+// don't record whether they were resolved strictly.
+func (a *App) openWhichCache(opts globalOptions, remote string) *whichCache {
+	if opts.Strict {
+		return nil
+	}
+	cfgPath, err := a.configPath(opts)
+	if err != nil {
+		return nil
+	}
+	if config.IsEnvSource(cfgPath) {
+		return nil
+	}
+	if st, err := os.Stat(cfgPath); err != nil || st.IsDir() {
+		return nil
+	}
+	dir := opts.Dir
+	if dir == "" {
+		dir = "."
+	}
+	root, ok, err := config.FindRepoRoot(dir)
+	if err != nil || !ok {
+		return nil
+	}
+	stamps, err := config.CacheStamps(cfgPath, root)
+	if err != nil {
+		return nil
+	}
+	return &whichCache{cfgPath: cfgPath, key: config.CacheKey(root, remote), stamps: stamps}
+}
+
+func (c *whichCache) lookup() (config.CacheEntry, bool) {
+	if c == nil {
+		return config.CacheEntry{}, false
+	}
+	e, ok := config.LoadCache(c.cfgPath)[c.key]
+	return e, ok && e.Fresh(c.stamps)
+}
+
+func (c *whichCache) store(out whichResult) error {
+	if c == nil {
+		return nil
+	}
+	return config.StoreCacheEntry(c.cfgPath, c.key, config.CacheEntry{
+		Remote: out.Remote,
+		URL:    out.URL,
+		RuleID: out.RuleID,
+		Key:    out.Key,
+		Stamps: c.stamps,
+	})
+}
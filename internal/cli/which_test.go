@@ -0,0 +1,35 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWhich(t *testing.T) {
+	cfgPath := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(cfgPath, []byte(`{"version":1,"defaultKey":"/tmp/fallback","rules":[{"id":"work","host":"github.com","owner":"CompanyOrg","key":"/tmp/key"}]}`), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	run := func(args ...string) (int, string, string) {
+		var stdout, stderr bytes.Buffer
+		code := New(strings.NewReader(""), &stdout, &stderr).Run(context.Background(), append([]string{"--config", cfgPath}, args...))
+		return code, stdout.String(), stderr.String()
+	}
+
+	if code, out, _ := run("which", "git@github.com:CompanyOrg/app.git"); code != 0 || out != "/tmp/key\n" {
+		t.Errorf("which: code=%d stdout=%q", code, out)
+	}
+	if code, out, _ := run("which", "--rule", "git@github.com:CompanyOrg/app.git"); code != 0 || out != "/tmp/key\twork\n" {
+		t.Errorf("which --rule: code=%d stdout=%q", code, out)
+	}
+	if code, out, _ := run("which", "--rule", "git@gitlab.com:other/app.git"); code != 0 || out != "/tmp/fallback\tdefaultKey\n" {
+		t.Errorf("which fallback: code=%d stdout=%q", code, out)
+	}
+	if code, out, errOut := run("which", "https://github.com/CompanyOrg/app.git"); code != 1 || out != "" || !strings.Contains(errOut, "not an SSH remote") {
+		t.Errorf("which https: code=%d stdout=%q stderr=%q", code, out, errOut)
+	}
+}
@@ -0,0 +1,284 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pavelBuzdanov/mgit/internal/config"
+	"github.com/pavelBuzdanov/mgit/internal/runner"
+	"github.com/pavelBuzdanov/mgit/internal/workspace"
+)
+
+type workspaceRepoStatus struct {
+	workspace.Repo
+	Status *repoStatus `json:"status,omitempty"`
+	Error  string      `json:"error,omitempty"`
+}
+
+func (a *App) handleWorkspace(ctx context.Context, opts globalOptions, args []string) int {
+	if len(args) == 0 {
+		a.printWorkspaceUsage()
+		return 2
+	}
+	switch args[0] {
+	case "add":
+		return a.handleWorkspaceAdd(ctx, opts, args[1:])
+	case "remove", "rm":
+		return a.handleWorkspaceRemove(opts, args[1:])
+	case "list", "ls":
+		return a.handleWorkspaceList(opts)
+	case "exec":
+		return a.handleWorkspaceExec(ctx, opts, args[1:])
+	case "status":
+		return a.handleWorkspaceStatus(ctx, opts)
+	default:
+		a.printWorkspaceUsage()
+		return 2
+	}
+}
+
+func (a *App) loadWorkspace() (*workspace.Registry, string, error) {
+	path, err := workspace.DefaultPath()
+	if err != nil {
+		return nil, "", err
+	}
+	reg, err := workspace.Load(path)
+	return reg, path, err
+}
+
+func (a *App) handleWorkspaceAdd(ctx context.Context, opts globalOptions, args []string) int {
+	fs := flag.NewFlagSet("mgit ws add", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	name := fs.String("name", "", "")
+	if err := fs.Parse(args); err != nil {
+		return a.fail(opts, usageError(err))
+	}
+	if fs.NArg() > 1 {
+		return a.fail(opts, usageError(errors.New("usage: mgit ws add [--name NAME] [<path>]")))
+	}
+	target := "."
+	if opts.Dir != "" {
+		target = opts.Dir
+	}
+	if fs.NArg() == 1 {
+		target = fs.Arg(0)
+	}
+	dir, err := config.ExpandPath(target)
+	if err != nil {
+		return a.fail(opts, usageError(err))
+	}
+	shell := runner.NewShell(io.Discard, io.Discard, opts.Verbose)
+	shell.Dir = dir
+	root, err := a.gitOps(opts, shell).TopLevel(ctx)
+	if err != nil || root == "" {
+		return a.fail(opts, fmt.Errorf("%s is not a git repository", dir))
+	}
+
+	reg, path, err := a.loadWorkspace()
+	if err != nil {
+		return a.fail(opts, err)
+	}
+	repo, added, err := reg.Add(root, *name)
+	if err != nil {
+		return a.fail(opts, err)
+	}
+	if opts.DryRun {
+		fmt.Fprintf(a.stdout, "Dry run: register %s as %s in %s\n", repo.Path, repo.Name, path)
+		return 0
+	}
+	if added {
+		if err := workspace.Save(path, reg); err != nil {
+			return a.fail(opts, err)
+		}
+	}
+	if opts.Output.Structured() {
+		a.printData(opts, map[string]any{"workspace": path, "repo": repo, "added": added})
+		return 0
+	}
+	if added {
+		a.infof(opts, "Added %s (%s)\n", repo.Name, repo.Path)
+	} else {
+		a.infof(opts, "Already registered: %s (%s)\n", repo.Name, repo.Path)
+	}
+	return 0
+}
+
+func (a *App) handleWorkspaceRemove(opts globalOptions, args []string) int {
+	if len(args) != 1 {
+		return a.fail(opts, usageError(errors.New("usage: mgit ws remove <name|path>")))
+	}
+	reg, path, err := a.loadWorkspace()
+	if err != nil {
+		return a.fail(opts, err)
+	}
+	repo, ok := reg.Remove(args[0])
+	if !ok {
+		if abs, err := config.ExpandPath(args[0]); err == nil {
+			repo, ok = reg.Remove(abs)
+		}
+	}
+	if !ok {
+		return a.fail(opts, fmt.Errorf("%q is not registered in the workspace", args[0]))
+	}
+	if opts.DryRun {
+		fmt.Fprintf(a.stdout, "Dry run: unregister %s (%s)\n", repo.Name, repo.Path)
+		return 0
+	}
+	if err := workspace.Save(path, reg); err != nil {
+		return a.fail(opts, err)
+	}
+	if opts.Output.Structured() {
+		a.printData(opts, map[string]any{"workspace": path, "removed": repo})
+		return 0
+	}
+	a.infof(opts, "Removed %s (%s)\n", repo.Name, repo.Path)
+	return 0
+}
+
+func (a *App) handleWorkspaceList(opts globalOptions) int {
+	reg, path, err := a.loadWorkspace()
+	if err != nil {
+		return a.fail(opts, err)
+	}
+	if opts.Output.Structured() {
+		a.printData(opts, map[string]any{"workspace": path, "repos": reg.Repos})
+		return 0
+	}
+	if len(reg.Repos) == 0 {
+		fmt.Fprintln(a.stdout, "No repositories registered; add one with: mgit ws add <path>")
+		return 0
+	}
+	tw := tabwriter.NewWriter(a.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tPATH")
+	for _, r := range reg.Repos {
+		p := r.Path
+		if _, err := os.Stat(r.Path); err != nil {
+			p += " (missing)"
+		}
+		fmt.Fprintf(tw, "%s\t%s\n", r.Name, p)
+	}
+	_ = tw.Flush()
+	return 0
+}
+
+// handleWorkspaceExec runs a git command in every registered repository. Each
+// repository resolves its own config and rule, exactly as `mgit exec` would
+// when run from inside it.
+func (a *App) handleWorkspaceExec(ctx context.Context, opts globalOptions, args []string) int {
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return a.fail(opts, usageError(errors.New("missing git arguments; use e.g. `mgit ws exec -- fetch`")))
+	}
+	reg, _, err := a.loadWorkspace()
+	if err != nil {
+		return a.fail(opts, err)
+	}
+	if len(reg.Repos) == 0 {
+		return a.fail(opts, errors.New("no repositories registered; add one with: mgit ws add <path>"))
+	}
+	var failed []string
+	for _, repo := range reg.Repos {
+		if !opts.Output.Structured() {
+			fmt.Fprintf(a.stdout, "==> %s (%s)\n", repo.Name, repo.Path)
+		}
+		if _, err := os.Stat(repo.Path); err != nil {
+			a.printErr(fmt.Errorf("%s: %w", repo.Name, err))
+			failed = append(failed, repo.Name)
+			continue
+		}
+		repoOpts := opts
+		repoOpts.Dir = repo.Path
+		if code := a.handleExec(ctx, repoOpts, append([]string(nil), args...)); code != 0 {
+			failed = append(failed, repo.Name)
+		}
+	}
+	if len(failed) > 0 {
+		return a.fail(opts, fmt.Errorf("%d of %d repositories failed: %s", len(failed), len(reg.Repos), strings.Join(failed, ", ")))
+	}
+	return 0
+}
+
+func (a *App) handleWorkspaceStatus(ctx context.Context, opts globalOptions) int {
+	reg, path, err := a.loadWorkspace()
+	if err != nil {
+		return a.fail(opts, err)
+	}
+	statuses := make([]workspaceRepoStatus, 0, len(reg.Repos))
+	for _, repo := range reg.Repos {
+		statuses = append(statuses, a.workspaceRepoStatus(ctx, opts, repo))
+	}
+	if opts.Output.Structured() {
+		a.printData(opts, map[string]any{"workspace": path, "repos": statuses})
+		return 0
+	}
+	if len(statuses) == 0 {
+		fmt.Fprintln(a.stdout, "No repositories registered; add one with: mgit ws add <path>")
+		return 0
+	}
+	tw := tabwriter.NewWriter(a.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "REPO\tUSER.EMAIL\tREMOTE\tRULE\tKEY\tWARNINGS")
+	var notes []string
+	for _, s := range statuses {
+		if s.Error != "" {
+			fmt.Fprintf(tw, "%s\t-\t-\t-\t-\t%s\n", s.Name, s.Error)
+			continue
+		}
+		email := dash(s.Status.UserEmail)
+		if len(s.Status.Remotes) == 0 {
+			fmt.Fprintf(tw, "%s\t%s\t-\t-\t-\tno remotes\n", s.Name, email)
+		}
+		for _, r := range s.Status.Remotes {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
+				s.Name, email, r.Name, dash(r.RuleID), dash(r.KeyPath), dash(strings.Join(r.Warnings, "; ")))
+		}
+		for _, w := range s.Status.Warnings {
+			notes = append(notes, s.Name+": "+w)
+		}
+	}
+	_ = tw.Flush()
+	for _, n := range notes {
+		fmt.Fprintf(a.stdout, "Warning: %s\n", n)
+	}
+	return 0
+}
+
+func (a *App) workspaceRepoStatus(ctx context.Context, opts globalOptions, repo workspace.Repo) workspaceRepoStatus {
+	out := workspaceRepoStatus{Repo: repo}
+	if _, err := os.Stat(repo.Path); err != nil {
+		out.Error = "missing"
+		return out
+	}
+	repoOpts := opts
+	repoOpts.Dir = repo.Path
+	shell := runner.NewShell(io.Discard, io.Discard, opts.Verbose)
+	shell.Dir = repo.Path
+	git := a.gitOps(opts, shell)
+	if ok, err := git.IsRepo(ctx); err != nil || !ok {
+		out.Error = "not a git repository"
+		return out
+	}
+	st, err := a.buildRepoStatus(ctx, repoOpts, git)
+	if err != nil {
+		out.Error = firstLine(err.Error())
+		return out
+	}
+	out.Status = &st
+	return out
+}
+
+func (a *App) printWorkspaceUsage() {
+	fmt.Fprintln(a.stdout, "Usage:")
+	fmt.Fprintln(a.stdout, "  mgit ws add [--name NAME] [<path>]   # register a repository (default: current)")
+	fmt.Fprintln(a.stdout, "  mgit ws remove <name|path>")
+	fmt.Fprintln(a.stdout, "  mgit ws list")
+	fmt.Fprintln(a.stdout, "  mgit ws exec -- <git args>            # run in every repository with its own key")
+	fmt.Fprintln(a.stdout, "  mgit ws status                        # identities and rules per repository")
+}
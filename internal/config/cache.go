@@ -0,0 +1,143 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+)
+
+// CacheEntry is a remembered resolution of one remote of one repository,
+// valid while none of the files in Stamps changed.
+type CacheEntry struct {
+	Remote string `json:"remote"`
+	URL    string `json:"url"`
+	RuleID string `json:"ruleId,omitempty"`
+	Key    string `json:"keyPath"`
+	Stamps Stamps `json:"stamps"`
+}
+
+// Stamps maps each file a resolution depends on to its size, modification
+// time, inode and change time (see loadStamp), all zero when it did not
+// exist.
+type Stamps map[string]loadStamp
+
+// Fresh reports whether the entry was stored when the files it depends on
+// had the stamps current, which the caller takes with CacheStamps. The
+// whole set is compared, so an entry that leaves files out, such as one in
+// a cache.json shipped with a repository, is never fresh.
+func (e CacheEntry) Fresh(current Stamps) bool {
+	return len(current) > 0 && maps.Equal(e.Stamps, current)
+}
+
+// unchanged reports whether no file the entry recorded changed since it was
+// stored.
+func (e CacheEntry) unchanged() bool {
+	if len(e.Stamps) == 0 {
+		return false
+	}
+	for file, stamp := range e.Stamps {
+		if fileStamp(file) != stamp {
+			return false
+		}
+	}
+	return true
+}
+
+// Cache maps CacheKey(repo, remote) to the remote's resolution.
+type Cache map[string]CacheEntry
+
+// CachePath is the resolution cache for the config at path: cache.json next
+// to it.
+func CachePath(path string) string {
+	return filepath.Join(filepath.Dir(path), "cache.json")
+}
+
+// CacheKey identifies remote of the repository at repoRoot in a Cache. An
+// empty remote is the one mgit picks by default.
+func CacheKey(repoRoot, remote string) string {
+	return repoRoot + "\x00" + remote
+}
+
+// LoadCache reads the resolution cache of the config at path. A missing or
+// unreadable cache is empty: it only ever saves work.
+func LoadCache(path string) Cache {
+	data, err := os.ReadFile(CachePath(path))
+	if err != nil {
+		return Cache{}
+	}
+	cache := Cache{}
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return Cache{}
+	}
+	return cache
+}
+
+// StoreCacheEntry saves e under key in the cache of the config at path,
+// dropping entries that went stale meanwhile.
+func StoreCacheEntry(path, key string, e CacheEntry) error {
+	file := CachePath(path)
+	unlock, err := Lock(file)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	cache := LoadCache(path)
+	for k, old := range cache {
+		if !old.unchanged() {
+			delete(cache, k)
+		}
+	}
+	cache[key] = e
+	data, err := json.MarshalIndent(cache, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode resolution cache: %w", err)
+	}
+	return writeFileAtomic(file, append(data, '\n'))
+}
+
+// CacheStamps records the files a resolution of a remote of the repository
+// at repoRoot depends on: the config at path, its signatures and the trusted
+// keys, the repository's git config and HEAD (the default remote follows
+// the current branch), and the global git config files, which can rewrite
+// URLs with insteadOf, and the cached remote rules.
+func CacheStamps(path, repoRoot string) (Stamps, error) {
+	files := []string{path, path + ".sig", path + ".minisig", RemoteRulesCachePath(path)}
+	if keys, err := TrustedKeysPath(); err == nil {
+		files = append(files, keys)
+	}
+	gitDir, err := workTreeGitDir(repoRoot)
+	if err != nil {
+		return nil, err
+	}
+	common, err := gitCommonDir(repoRoot)
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, filepath.Join(gitDir, "HEAD"), filepath.Join(common, "config"))
+	home, _ := os.UserHomeDir()
+	if global := os.Getenv("GIT_CONFIG_GLOBAL"); global != "" {
+		files = append(files, global)
+	} else if home != "" {
+		files = append(files, filepath.Join(home, ".gitconfig"))
+	}
+	if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+		files = append(files, filepath.Join(xdg, "git", "config"))
+	} else if home != "" {
+		files = append(files, filepath.Join(home, ".config", "git", "config"))
+	}
+	stamps := make(Stamps, len(files))
+	for _, f := range files {
+		stamps[f] = fileStamp(f)
+	}
+	return stamps, nil
+}
+
+func fileStamp(file string) loadStamp {
+	st, err := os.Stat(file)
+	if err != nil {
+		return loadStamp{}
+	}
+	return stampOf(st)
+}
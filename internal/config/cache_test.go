@@ -0,0 +1,103 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestResolutionCache(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("GIT_CONFIG_GLOBAL", "")
+	keys := filepath.Join(t.TempDir(), "trusted_keys")
+	t.Setenv(TrustedKeysEnv, keys)
+	repo := t.TempDir()
+	for _, f := range []string{".git/HEAD", ".git/config", ".mgit/config.json"} {
+		p := filepath.Join(repo, f)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte("x\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfgPath := filepath.Join(repo, RepoConfigRelativePath)
+	now := func() Stamps {
+		stamps, err := CacheStamps(cfgPath, repo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return stamps
+	}
+
+	stamps, err := CacheStamps(cfgPath, repo)
+	if err != nil {
+		t.Fatalf("CacheStamps() error = %v", err)
+	}
+	key := CacheKey(repo, "origin")
+	if err := StoreCacheEntry(cfgPath, key, CacheEntry{Remote: "origin", Key: "/tmp/key", Stamps: stamps}); err != nil {
+		t.Fatalf("StoreCacheEntry() error = %v", err)
+	}
+	e, ok := LoadCache(cfgPath)[key]
+	if !ok || e.Key != "/tmp/key" || !e.Fresh(now()) {
+		t.Fatalf("LoadCache()[key] = %+v, %v; want a fresh entry", e, ok)
+	}
+
+	// An entry recording only some of the files, as a cache.json shipped
+	// with a repository could, is not fresh.
+	shipped := CacheEntry{Remote: "origin", Key: "/evil", Stamps: Stamps{filepath.Join(repo, "missing"): {}}}
+	if !shipped.unchanged() || shipped.Fresh(now()) {
+		t.Fatal("entry with a partial set of stamps is fresh")
+	}
+
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(filepath.Join(repo, ".git", "config"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	if LoadCache(cfgPath)[key].Fresh(now()) {
+		t.Fatal("entry still fresh after the git config changed")
+	}
+
+	// Storing another entry drops the stale one.
+	stamps, _ = CacheStamps(cfgPath, repo)
+	if err := StoreCacheEntry(cfgPath, CacheKey(repo, ""), CacheEntry{Remote: "origin", Key: "/tmp/key", Stamps: stamps}); err != nil {
+		t.Fatalf("StoreCacheEntry() error = %v", err)
+	}
+	if cache := LoadCache(cfgPath); len(cache) != 1 {
+		t.Fatalf("LoadCache() = %+v, want only the new entry", cache)
+	}
+
+	// Trusting keys, or replacing the config with one of the same size and
+	// modification time, makes entries stale too.
+	key = CacheKey(repo, "")
+	if err := os.WriteFile(keys, []byte("ssh-ed25519 AAAA\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if LoadCache(cfgPath)[key].Fresh(now()) {
+		t.Fatal("entry still fresh after trusted keys were added")
+	}
+	stamps, _ = CacheStamps(cfgPath, repo)
+	if err := StoreCacheEntry(cfgPath, key, CacheEntry{Remote: "origin", Key: "/tmp/key", Stamps: stamps}); err != nil {
+		t.Fatalf("StoreCacheEntry() error = %v", err)
+	}
+	st, err := os.Stat(cfgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replacement := cfgPath + ".new"
+	if err := os.WriteFile(replacement, []byte("y\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(replacement, st.ModTime(), st.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(replacement, cfgPath); err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" && LoadCache(cfgPath)[key].Fresh(now()) {
+		t.Fatal("entry still fresh after the config was replaced")
+	}
+}
@@ -1,38 +1,28 @@
 package config
 
 import (
-	"crypto/rand"
-	"encoding/hex"
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io/fs"
+	"maps"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
-)
-
-const CurrentVersion = 1
-const RepoConfigRelativePath = ".mgit/config.json"
+	"time"
 
-type Config struct {
-	Version int    `json:"version"`
-	Rules   []Rule `json:"rules"`
-}
+	"github.com/pavelBuzdanov/mgit/internal/runner"
+	"github.com/pavelBuzdanov/mgit/internal/sshkeys"
+	pkgconfig "github.com/pavelBuzdanov/mgit/pkg/config"
+	"github.com/pavelBuzdanov/mgit/pkg/trace"
+)
 
-type Rule struct {
-	ID       string `json:"id,omitempty"`
-	Host     string `json:"host"`
-	Owner    string `json:"owner"`
-	Key      string `json:"key"`
-	Priority int    `json:"priority,omitempty"`
-}
-
-type ValidationIssue struct {
-	Level   string `json:"level"` // error|warning
-	Field   string `json:"field,omitempty"`
-	Message string `json:"message"`
-}
+// reservedEnv are variables mgit sets itself from the rule's key.
+var reservedEnv = map[string]bool{"GIT_SSH_COMMAND": true, "GIT_SSH": true, "GIT_SSH_VARIANT": true}
 
 type RemoveSelector struct {
 	ID    string
@@ -42,144 +32,108 @@ type RemoveSelector struct {
 	Index int // 1-based, <=0 ignored
 }
 
-func GlobalDefaultPath() (string, error) {
-	dir, err := os.UserConfigDir()
-	if err != nil {
-		return "", fmt.Errorf("determine user config dir: %w", err)
-	}
-	return filepath.Join(dir, "mgit", "config.json"), nil
-}
-
-func DefaultPath() (string, error) {
-	return AutoPath()
-}
-
-func ResolvePath(custom string) (string, error) {
-	if strings.TrimSpace(custom) == "" {
-		return AutoPath()
-	}
-	return ExpandPath(custom)
-}
-
-func AutoPath() (string, error) {
-	wd, err := os.Getwd()
+// Load is pkg/config's Load with the in-process cache, and the on-disk one
+// when LoadCacheEnv is set, in front of it.
+func Load(path string) (*Config, error) {
+	resolved, err := ResolvePath(path)
 	if err != nil {
-		return "", fmt.Errorf("determine current working directory: %w", err)
-	}
-	if p, ok, err := FindNearestConfig(wd); err == nil && ok {
-		return p, nil
-	} else if err != nil {
-		return "", err
-	}
-	if repoRoot, ok, err := FindRepoRoot(wd); err == nil && ok {
-		return filepath.Join(repoRoot, RepoConfigRelativePath), nil
-	} else if err != nil {
-		return "", err
+		return nil, err
 	}
-	return filepath.Join(wd, RepoConfigRelativePath), nil
-}
-
-func FindNearestConfig(start string) (string, bool, error) {
-	dir, err := ExpandPath(start)
-	if err != nil {
-		return "", false, err
+	if IsEnvSource(resolved) {
+		return LoadEnv()
 	}
-	for {
-		candidate := filepath.Join(dir, RepoConfigRelativePath)
-		if st, err := os.Stat(candidate); err == nil && !st.IsDir() {
-			return candidate, true, nil
+	st, statErr := os.Stat(resolved)
+	var stamp loadStamp
+	if statErr == nil {
+		stamp = stampOf(st)
+		if cfg, ok := cachedLoad(resolved, stamp); ok {
+			trace.Event("config.load", "path", resolved, "rules", len(cfg.Rules), "cached", "memory")
+			return cfg, nil
 		}
-		parent := filepath.Dir(dir)
-		if parent == dir {
-			return "", false, nil
+		if cfg, ok := diskCachedLoad(resolved, stamp); ok {
+			trace.Event("config.load", "path", resolved, "rules", len(cfg.Rules), "cached", "disk")
+			storeLoaded(resolved, stamp, cfg)
+			return cfg, nil
 		}
-		dir = parent
 	}
-}
-
-func FindRepoRoot(start string) (string, bool, error) {
-	dir, err := ExpandPath(start)
-	if err != nil {
-		return "", false, err
-	}
-	for {
-		gitMarker := filepath.Join(dir, ".git")
-		if _, err := os.Stat(gitMarker); err == nil {
-			return dir, true, nil
-		}
-		parent := filepath.Dir(dir)
-		if parent == dir {
-			return "", false, nil
-		}
-		dir = parent
+	cfg, err := pkgconfig.Load(resolved)
+	if err == nil && statErr == nil {
+		storeLoaded(resolved, stamp, cfg)
+		storeDiskLoaded(resolved, stamp, cfg)
 	}
+	return cfg, err
 }
 
-func ExpandPath(p string) (string, error) {
-	s := strings.TrimSpace(p)
-	if s == "" {
-		return "", errors.New("empty path")
-	}
-	if strings.HasPrefix(s, "~") {
-		home, err := os.UserHomeDir()
-		if err != nil {
-			return "", fmt.Errorf("determine home dir: %w", err)
-		}
-		switch s {
-		case "~":
-			s = home
-		default:
-			if strings.HasPrefix(s, "~/") {
-				s = filepath.Join(home, s[2:])
-			}
-		}
+// Save writes cfg to path atomically (temp file + rename) under the config
+// lock. Use Update for read-modify-write changes.
+func Save(path string, cfg *Config) error {
+	if cfg == nil {
+		return errors.New("nil config")
 	}
-	s = os.ExpandEnv(s)
-	if !filepath.IsAbs(s) {
-		abs, err := filepath.Abs(s)
-		if err != nil {
-			return "", fmt.Errorf("resolve absolute path: %w", err)
-		}
-		s = abs
+	unlock, err := Lock(path)
+	if err != nil {
+		return err
 	}
-	return filepath.Clean(s), nil
+	defer unlock()
+	return writeAtomic(path, cfg)
 }
 
-func Load(path string) (*Config, error) {
+// writeAtomic snapshots the current config into the history and replaces it
+// with cfg. Callers hold the lock.
+func writeAtomic(path string, cfg *Config) error {
 	resolved, err := ResolvePath(path)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	data, err := os.ReadFile(resolved)
+	cfg.Normalize()
+	forgetLoaded(resolved)
+	data, err := json.MarshalIndent(cfg, "", "  ")
 	if err != nil {
-		return nil, fmt.Errorf("read config %s: %w", resolved, err)
+		return fmt.Errorf("encode config JSON: %w", err)
 	}
-	var cfg Config
-	if err := json.Unmarshal(data, &cfg); err != nil {
-		return nil, fmt.Errorf("parse JSON config %s: %w", resolved, err)
+	data = append(data, '\n')
+	if old, err := os.ReadFile(resolved); err == nil && !bytes.Equal(old, data) {
+		if err := snapshot(resolved, old); err != nil {
+			return err
+		}
 	}
-	cfg.Normalize()
-	return &cfg, nil
+	return writeFileAtomic(resolved, data)
 }
 
-func Save(path string, cfg *Config) error {
-	if cfg == nil {
-		return errors.New("nil config")
-	}
-	resolved, err := ResolvePath(path)
-	if err != nil {
-		return err
-	}
+// writeFileAtomic replaces the file in one rename, so readers see either the
+// old or the new file, never a partial write. A symlinked file (a config kept
+// in a dotfiles repository) is written through: the rename replaces the file
+// the link points to, not the link.
+func writeFileAtomic(resolved string, data []byte) error {
 	if err := os.MkdirAll(filepath.Dir(resolved), 0o755); err != nil {
 		return fmt.Errorf("create config directory: %w", err)
 	}
-	cfg.Normalize()
-	data, err := json.MarshalIndent(cfg, "", "  ")
+	target, err := filepath.EvalSymlinks(resolved)
+	switch {
+	case err == nil:
+		resolved = target
+	case !errors.Is(err, fs.ErrNotExist):
+		return fmt.Errorf("write config %s: %w", resolved, err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(resolved), "."+filepath.Base(resolved)+".*.tmp")
 	if err != nil {
-		return fmt.Errorf("encode config JSON: %w", err)
+		return fmt.Errorf("write config %s: %w", resolved, err)
 	}
-	data = append(data, '\n')
-	if err := os.WriteFile(resolved, data, 0o600); err != nil {
+	// CreateTemp already uses mode 0600. After a successful rename the
+	// deferred Remove is a no-op.
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("write config %s: %w", resolved, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("write config %s: %w", resolved, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write config %s: %w", resolved, err)
+	}
+	if err := os.Rename(tmp.Name(), resolved); err != nil {
 		return fmt.Errorf("write config %s: %w", resolved, err)
 	}
 	return nil
@@ -190,6 +144,9 @@ func Init(path string, force bool) (string, bool, error) {
 	if err != nil {
 		return "", false, err
 	}
+	if IsEnvSource(resolved) {
+		return resolved, false, ErrEnvSource
+	}
 	if _, err := os.Stat(resolved); err == nil && !force {
 		return resolved, false, fmt.Errorf("config already exists at %s (use --force to overwrite)", resolved)
 	}
@@ -200,52 +157,6 @@ func Init(path string, force bool) (string, bool, error) {
 	return resolved, true, nil
 }
 
-func EnsureGitignoreExcludesMgit(configPath string) (bool, error) {
-	resolved, err := ResolvePath(configPath)
-	if err != nil {
-		return false, err
-	}
-	if filepath.Base(resolved) != "config.json" {
-		return false, nil
-	}
-	cfgDir := filepath.Dir(resolved)
-	if filepath.Base(cfgDir) != ".mgit" {
-		return false, nil
-	}
-	repoRoot := filepath.Dir(cfgDir)
-	gitignorePath := filepath.Join(repoRoot, ".gitignore")
-	st, err := os.Stat(gitignorePath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return false, nil
-		}
-		return false, fmt.Errorf("stat %s: %w", gitignorePath, err)
-	}
-	if st.IsDir() {
-		return false, nil
-	}
-	data, err := os.ReadFile(gitignorePath)
-	if err != nil {
-		return false, fmt.Errorf("read %s: %w", gitignorePath, err)
-	}
-	for _, line := range strings.Split(string(data), "\n") {
-		switch strings.TrimSpace(line) {
-		case ".mgit", ".mgit/":
-			return false, nil
-		}
-	}
-	var b strings.Builder
-	b.Write(data)
-	if len(data) > 0 && data[len(data)-1] != '\n' {
-		b.WriteByte('\n')
-	}
-	b.WriteString(".mgit\n")
-	if err := os.WriteFile(gitignorePath, []byte(b.String()), st.Mode().Perm()); err != nil {
-		return false, fmt.Errorf("write %s: %w", gitignorePath, err)
-	}
-	return true, nil
-}
-
 func ExampleConfig() *Config {
 	return &Config{
 		Version: CurrentVersion,
@@ -258,44 +169,76 @@ func ExampleConfig() *Config {
 	}
 }
 
-func (c *Config) Normalize() {
-	if c.Version == 0 {
-		c.Version = CurrentVersion
-	}
-	for i := range c.Rules {
-		r := &c.Rules[i]
-		r.Host = normalizePattern(r.Host)
-		r.Owner = normalizePattern(r.Owner)
-		r.Key = strings.TrimSpace(r.Key)
-		if r.ID == "" {
-			r.ID = newRuleID()
+// PinnedRule returns the rule a pin forces: the rule Pin.Rule names, or a
+// catch-all built from Pin.Key. It returns false without a pin, and an
+// error when the pinned rule no longer exists.
+func PinnedRule(c *Config) (Rule, bool, error) {
+	switch {
+	case c.Pin == nil:
+		return Rule{}, false, nil
+	case c.Pin.Rule != "":
+		for _, r := range c.Rules {
+			if r.ID == c.Pin.Rule {
+				return r, true, nil
+			}
 		}
+		return Rule{}, false, fmt.Errorf("pinned rule %q not found (mgit unpin removes the pin)", c.Pin.Rule)
+	case c.Pin.Key != "":
+		r := Rule{ID: PinnedRuleID, Host: "*", Owner: "*"}
+		if sshkeys.IsAgentRef(c.Pin.Key) {
+			r.Agent = c.Pin.Key
+		} else {
+			r.Key = c.Pin.Key
+		}
+		return r, true, nil
 	}
+	return Rule{}, false, nil
 }
 
-func normalizePattern(s string) string {
-	s = strings.TrimSpace(s)
-	if s == "" {
-		return "*"
-	}
-	return s
+// DefaultRule returns DefaultKey as a catch-all rule, or false when no
+// default key is configured.
+func DefaultRule(c *Config) (Rule, bool) {
+	key := strings.TrimSpace(c.DefaultKey)
+	if key == "" {
+		return Rule{}, false
+	}
+	r := Rule{ID: DefaultKeyRuleID, Host: "*", Owner: "*"}
+	if sshkeys.IsAgentRef(key) {
+		r.Agent = key
+	} else {
+		r.Key = key
+	}
+	return r, true
 }
 
-func (c *Config) AddRule(r Rule, force bool) error {
+func AddRule(c *Config, r Rule, force bool) error {
 	c.Normalize()
-	r.Host = normalizePattern(r.Host)
-	r.Owner = normalizePattern(r.Owner)
-	r.Key = strings.TrimSpace(r.Key)
-	if r.Key == "" {
-		return errors.New("key path is required")
-	}
-	if r.ID == "" {
-		r.ID = newRuleID()
+	// Normalizing the rule on its own also gives it an ID.
+	single := Config{Rules: []Rule{r}}
+	single.Normalize()
+	r = single.Rules[0]
+	if !r.HasSSH() && !r.HasHTTPS() {
+		return errors.New("key path or agent identity is required")
+	}
+	if r.Key != "" && r.Agent != "" {
+		return errors.New("use either key path or agent identity, not both")
+	}
+	if level, msg := RuleKeyTypeIssue(c, r); level == "error" {
+		return errors.New(msg)
+	}
+	for _, issue := range hostKeyIssues("", r) {
+		if issue.Level == "error" {
+			return errors.New(issue.Message)
+		}
 	}
 	for _, existing := range c.Rules {
 		if strings.EqualFold(existing.Host, r.Host) &&
 			strings.EqualFold(existing.Owner, r.Owner) &&
+			existing.Remote == r.Remote &&
 			existing.Key == r.Key &&
+			existing.Agent == r.Agent &&
+			existing.HTTPSUser == r.HTTPSUser &&
+			existing.CredentialHelper == r.CredentialHelper &&
 			existing.Priority == r.Priority {
 			if !force {
 				return fmt.Errorf("rule already exists (id=%s); use --force to add duplicate", existing.ID)
@@ -306,7 +249,7 @@ func (c *Config) AddRule(r Rule, force bool) error {
 	return nil
 }
 
-func (c *Config) RemoveRule(sel RemoveSelector) (Rule, bool) {
+func RemoveRule(c *Config, sel RemoveSelector) (Rule, bool) {
 	c.Normalize()
 	if sel.Index > 0 && sel.Index <= len(c.Rules) {
 		i := sel.Index - 1
@@ -327,6 +270,18 @@ func (c *Config) RemoveRule(sel RemoveSelector) (Rule, bool) {
 	return Rule{}, false
 }
 
+// MoveRule moves the rule at index from to index to, shifting the rules in
+// between. Order breaks ties between rules with equal match scores.
+func MoveRule(c *Config, from, to int) error {
+	if from < 0 || from >= len(c.Rules) || to < 0 || to >= len(c.Rules) {
+		return fmt.Errorf("rule index out of range (have %d rules)", len(c.Rules))
+	}
+	r := c.Rules[from]
+	c.Rules = append(c.Rules[:from], c.Rules[from+1:]...)
+	c.Rules = append(c.Rules[:to], append([]Rule{r}, c.Rules[to:]...)...)
+	return nil
+}
+
 func matchesRemoveSelector(r Rule, sel RemoveSelector) bool {
 	if sel.Host == "" && sel.Owner == "" && sel.Key == "" {
 		return false
@@ -343,17 +298,81 @@ func matchesRemoveSelector(r Rule, sel RemoveSelector) bool {
 	return true
 }
 
-func (c *Config) Validate() []ValidationIssue {
+func Validate(c *Config) []ValidationIssue {
 	c.Normalize()
 	var issues []ValidationIssue
 	if c.Version <= 0 {
 		issues = append(issues, ValidationIssue{Level: "error", Field: "version", Message: "version must be >= 1"})
+	} else if c.Version > CurrentVersion {
+		issues = append(issues, ValidationIssue{Level: "error", Field: "version", Message: fmt.Sprintf("version %d is newer than this mgit supports (%d)", c.Version, CurrentVersion)})
+	}
+	if def, ok := DefaultRule(c); ok && def.Key != "" {
+		issues = append(issues, keyFileIssues("defaultKey", def.Key)...)
+	}
+	issues = append(issues, sshCommandIssues("sshCommand", c.SSHCommand)...)
+	if c.SSHBinary != "" {
+		issues = append(issues, sshCommandIssues("sshBinary", runner.ShellArg(c.SSHBinary))...)
+	}
+	issues = append(issues, remoteRulesIssues(c)...)
+	if _, err := ParseIgnoreMode(c.Gitignore); err != nil {
+		issues = append(issues, ValidationIssue{Level: "error", Field: "gitignore", Message: err.Error()})
+	}
+	if c.Askpass != "" && c.Askpass != AskpassPrompt {
+		if path, err := ExpandPath(c.Askpass); err != nil {
+			issues = append(issues, ValidationIssue{Level: "error", Field: "askpass", Message: err.Error()})
+		} else if _, err := exec.LookPath(path); err != nil {
+			issues = append(issues, ValidationIssue{Level: "warning", Field: "askpass", Message: fmt.Sprintf("askpass program %s not found", c.Askpass)})
+		}
+	}
+	if p := c.Pin; p != nil {
+		switch {
+		case (p.Rule == "") == (p.Key == ""):
+			issues = append(issues, ValidationIssue{Level: "error", Field: "pin", Message: "pin needs either rule or key"})
+		case p.Rule != "":
+			if _, _, err := PinnedRule(c); err != nil {
+				issues = append(issues, ValidationIssue{Level: "error", Field: "pin.rule", Message: err.Error()})
+			}
+		case !sshkeys.IsAgentRef(p.Key):
+			issues = append(issues, keyFileIssues("pin.key", p.Key)...)
+		}
+	}
+	if c.Retry < 0 {
+		issues = append(issues, ValidationIssue{Level: "error", Field: "retry", Message: "retry must be >= 0"})
+	}
+	if _, err := ParseExternalSSHMode(c.ExternalSSHCommand); err != nil {
+		issues = append(issues, ValidationIssue{Level: "error", Field: "externalSshCommand", Message: err.Error()})
+	}
+	issues = append(issues, gitCommandIssues("allowedGitCommands", c.AllowedGitCommands)...)
+	issues = append(issues, gitCommandIssues("deniedGitCommands", c.DeniedGitCommands)...)
+	for _, alias := range slices.Sorted(maps.Keys(c.HostAliases)) {
+		field, host := "hostAliases."+alias, c.HostAliases[alias]
+		switch {
+		case alias == "" || hasWildcard(alias):
+			issues = append(issues, ValidationIssue{Level: "error", Field: field, Message: fmt.Sprintf("host alias %q must be a literal host", alias)})
+		case host == "" || hasWildcard(host):
+			issues = append(issues, ValidationIssue{Level: "error", Field: field, Message: fmt.Sprintf("canonical host %q must be a literal host", host)})
+		default:
+			if next, ok := c.CanonicalHost(host); ok {
+				issues = append(issues, ValidationIssue{Level: "warning", Field: field, Message: fmt.Sprintf("%s is itself an alias (of %s); aliases are not followed in chains", host, next)})
+			}
+		}
+	}
+	for i, d := range c.HostDefaults {
+		issues = append(issues, hostDefaultIssues(fmt.Sprintf("hostDefaults[%d]", i), d)...)
+	}
+	for i, e := range c.Policy {
+		issues = append(issues, policyIssues(fmt.Sprintf("policy[%d]", i), e)...)
 	}
 	seenExact := map[string]string{}
 	for i, r := range c.Rules {
 		prefix := fmt.Sprintf("rules[%d]", i)
-		if strings.TrimSpace(r.Key) == "" {
-			issues = append(issues, ValidationIssue{Level: "error", Field: prefix + ".key", Message: "key is required"})
+		switch {
+		case !r.HasSSH() && !r.HasHTTPS():
+			issues = append(issues, ValidationIssue{Level: "error", Field: prefix + ".key", Message: "key, agent or httpsUser/credentialHelper is required"})
+		case r.Key != "" && r.Agent != "":
+			issues = append(issues, ValidationIssue{Level: "error", Field: prefix + ".agent", Message: "use either key or agent, not both"})
+		case r.Agent != "" && !sshkeys.IsAgentRef(r.Agent):
+			issues = append(issues, ValidationIssue{Level: "error", Field: prefix + ".agent", Message: "agent must be a SHA256 fingerprint or a public key line"})
 		}
 		if _, err := validatePattern(r.Host); err != nil {
 			issues = append(issues, ValidationIssue{Level: "error", Field: prefix + ".host", Message: err.Error()})
@@ -361,17 +380,68 @@ func (c *Config) Validate() []ValidationIssue {
 		if _, err := validatePattern(r.Owner); err != nil {
 			issues = append(issues, ValidationIssue{Level: "error", Field: prefix + ".owner", Message: err.Error()})
 		}
+		if r.Remote != "" {
+			if _, err := validatePattern(r.Remote); err != nil {
+				issues = append(issues, ValidationIssue{Level: "error", Field: prefix + ".remote", Message: err.Error()})
+			}
+		}
 		if r.Key != "" {
-			expanded, err := ExpandPath(r.Key)
-			if err != nil {
-				issues = append(issues, ValidationIssue{Level: "error", Field: prefix + ".key", Message: err.Error()})
-			} else if st, statErr := os.Stat(expanded); statErr != nil {
-				issues = append(issues, ValidationIssue{Level: "error", Field: prefix + ".key", Message: fmt.Sprintf("key file not found: %s", expanded)})
-			} else if st.IsDir() {
-				issues = append(issues, ValidationIssue{Level: "error", Field: prefix + ".key", Message: fmt.Sprintf("key path is a directory: %s", expanded)})
+			issues = append(issues, keyFileIssues(prefix+".key", r.Key)...)
+		}
+		if c.DefaultKey != "" && r.CatchAll() && r.Remote == "" {
+			issues = append(issues, ValidationIssue{Level: "warning", Field: prefix, Message: "catch-all rule matches every remote, so defaultKey is never used"})
+		}
+		if r.CreatedAt != "" {
+			if _, err := time.Parse(time.RFC3339, r.CreatedAt); err != nil {
+				issues = append(issues, ValidationIssue{Level: "error", Field: prefix + ".createdAt", Message: "createdAt must be an RFC 3339 timestamp"})
+			}
+		}
+		if r.RotateAfter != "" {
+			if _, err := ParseRotateAfter(r.RotateAfter); err != nil {
+				issues = append(issues, ValidationIssue{Level: "error", Field: prefix + ".rotateAfter", Message: err.Error()})
+			}
+		}
+		if r.Email != "" {
+			if _, err := filepath.Match(r.Email, "example@example.com"); err != nil {
+				issues = append(issues, ValidationIssue{Level: "error", Field: prefix + ".email", Message: fmt.Sprintf("invalid email pattern %q: %v", r.Email, err)})
+			}
+		}
+		issues = append(issues, sshCommandIssues(prefix+".sshCommand", r.SSHCommand)...)
+		if strings.ContainsAny(r.HTTPSUser, " \t\n") {
+			issues = append(issues, ValidationIssue{Level: "error", Field: prefix + ".httpsUser", Message: fmt.Sprintf("invalid HTTPS user %q", r.HTTPSUser)})
+		}
+		for name := range r.Env {
+			switch {
+			case name == "" || strings.ContainsAny(name, "= \t"):
+				issues = append(issues, ValidationIssue{Level: "error", Field: prefix + ".env", Message: fmt.Sprintf("invalid environment variable name %q", name)})
+			case reservedEnv[strings.ToUpper(name)]:
+				issues = append(issues, ValidationIssue{Level: "error", Field: prefix + ".env", Message: fmt.Sprintf("%s is set by mgit from the rule's key and cannot be overridden", name)})
 			}
 		}
-		key := strings.ToLower(r.Host) + "|" + strings.ToLower(r.Owner) + "|" + fmt.Sprintf("%d", r.Priority)
+		switch r.SigningFormat {
+		case "", "ssh", "openpgp", "x509":
+		default:
+			issues = append(issues, ValidationIssue{Level: "error", Field: prefix + ".signingFormat", Message: "signingFormat must be ssh, openpgp or x509"})
+		}
+		if r.SigningFormat != "" && r.SigningKey == "" {
+			issues = append(issues, ValidationIssue{Level: "warning", Field: prefix + ".signingFormat", Message: "signingFormat has no effect without signingKey"})
+		}
+		if r.SigningKey != "" && r.EffectiveSigningFormat() == "ssh" && !strings.HasPrefix(r.SigningKey, "key::") {
+			if expanded, err := ExpandPath(r.SigningKey); err != nil {
+				issues = append(issues, ValidationIssue{Level: "error", Field: prefix + ".signingKey", Message: err.Error()})
+			} else if _, statErr := os.Stat(expanded); statErr != nil {
+				issues = append(issues, ValidationIssue{Level: "warning", Field: prefix + ".signingKey", Message: fmt.Sprintf("signing key file not found: %s", expanded)})
+			}
+		}
+		issues = append(issues, hostKeyIssues(prefix, r)...)
+		if p := r.SecurityKeyProvider; p != "" && p != "internal" {
+			if expanded, err := ExpandPath(p); err != nil {
+				issues = append(issues, ValidationIssue{Level: "error", Field: prefix + ".securityKeyProvider", Message: err.Error()})
+			} else if _, statErr := os.Stat(expanded); statErr != nil {
+				issues = append(issues, ValidationIssue{Level: "warning", Field: prefix + ".securityKeyProvider", Message: fmt.Sprintf("security key provider not found: %s", expanded)})
+			}
+		}
+		key := strings.ToLower(r.Host) + "|" + strings.ToLower(r.Owner) + "|" + r.Remote + "|" + fmt.Sprintf("%d", r.Priority)
 		if prevID, ok := seenExact[key]; ok {
 			issues = append(issues, ValidationIssue{
 				Level:   "warning",
@@ -382,9 +452,84 @@ func (c *Config) Validate() []ValidationIssue {
 			seenExact[key] = r.ID
 		}
 	}
+	issues = append(issues, keyReuseIssues(c)...)
+	issues = append(issues, crossHostKeyIssues(c)...)
+	issues = append(issues, keyTypeIssues(c)...)
 	return issues
 }
 
+// keyFileIssues checks that a key path points at a file. Provider references
+// (op://, pass:) are fetched at run time and have no file to check.
+func keyFileIssues(field, key string) []ValidationIssue {
+	if sshkeys.IsProviderRef(key) {
+		return nil
+	}
+	expanded, err := ExpandPath(key)
+	if err != nil {
+		return []ValidationIssue{{Level: "error", Field: field, Message: err.Error()}}
+	}
+	st, err := os.Stat(expanded)
+	if err != nil {
+		return []ValidationIssue{{Level: "error", Field: field, Message: fmt.Sprintf("key file not found: %s", expanded)}}
+	}
+	if st.IsDir() {
+		return []ValidationIssue{{Level: "error", Field: field, Message: fmt.Sprintf("key path is a directory: %s", expanded)}}
+	}
+	return nil
+}
+
+// sshCommandIssues checks that a configured ssh client parses and that its
+// executable can be found.
+func sshCommandIssues(field, command string) []ValidationIssue {
+	if command == "" {
+		return nil
+	}
+	client, err := runner.ParseSSHClient(command)
+	if err != nil {
+		return []ValidationIssue{{Level: "error", Field: field, Message: err.Error()}}
+	}
+	if len(client) == 0 {
+		return []ValidationIssue{{Level: "error", Field: field, Message: "ssh command is empty"}}
+	}
+	name := client.Name()
+	if strings.HasPrefix(name, "~") {
+		name, err = ExpandPath(name)
+	}
+	if err == nil {
+		_, err = exec.LookPath(name)
+	}
+	if err != nil {
+		return []ValidationIssue{{Level: "warning", Field: field, Message: fmt.Sprintf("ssh client %s not found", client.Name())}}
+	}
+	return nil
+}
+
+// SSHClientFor returns the ssh client for a rule: its own sshCommand, else
+// the config's, else the ssh binary (see SSHBinaryPath).
+func SSHClientFor(c *Config, r Rule) (runner.SSHClient, error) {
+	command := r.SSHCommand
+	if command == "" {
+		command = c.SSHCommand
+	}
+	client, err := runner.ParseSSHClient(command)
+	if err != nil {
+		return nil, fmt.Errorf("rule %q: %w", r.ID, err)
+	}
+	if command == "" && c.SSHBinaryPath() != "" {
+		client = runner.SSHClient{c.SSHBinaryPath()}
+	}
+	if len(client) > 0 && strings.HasPrefix(client[0], "~") {
+		if client[0], err = ExpandPath(client[0]); err != nil {
+			return nil, err
+		}
+	}
+	return client, nil
+}
+
+func hasWildcard(s string) bool {
+	return strings.ContainsAny(s, "*?[")
+}
+
 func HasErrors(issues []ValidationIssue) bool {
 	for _, i := range issues {
 		if i.Level == "error" {
@@ -401,18 +546,12 @@ func SortedRulesCopy(rules []Rule) []Rule {
 }
 
 func validatePattern(p string) (string, error) {
-	p = normalizePattern(p)
+	if p = strings.TrimSpace(p); p == "" {
+		p = "*"
+	}
 	_, err := filepath.Match(p, "example")
 	if err != nil {
 		return "", fmt.Errorf("invalid wildcard pattern %q: %w", p, err)
 	}
 	return p, nil
 }
-
-func newRuleID() string {
-	var b [4]byte
-	if _, err := rand.Read(b[:]); err != nil {
-		return "rule"
-	}
-	return "r_" + hex.EncodeToString(b[:])
-}
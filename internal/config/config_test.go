@@ -3,7 +3,11 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+
+	"github.com/pavelBuzdanov/mgit/internal/sshkeys"
 )
 
 func canonicalPath(p string) string {
@@ -30,7 +34,7 @@ func TestValidateConfigOK(t *testing.T) {
 			{ID: "a", Host: "github.com", Owner: "CompanyOrg", Key: key},
 		},
 	}
-	issues := cfg.Validate()
+	issues := Validate(cfg)
 	if HasErrors(issues) {
 		t.Fatalf("expected valid config, got issues: %+v", issues)
 	}
@@ -43,7 +47,7 @@ func TestValidateConfigMissingKeyFile(t *testing.T) {
 			{ID: "a", Host: "github.com", Owner: "CompanyOrg", Key: "/definitely/missing/key"},
 		},
 	}
-	issues := cfg.Validate()
+	issues := Validate(cfg)
 	if !HasErrors(issues) {
 		t.Fatalf("expected validation error, got %+v", issues)
 	}
@@ -62,7 +66,7 @@ func TestValidateConfigDuplicateRulesWarns(t *testing.T) {
 			{ID: "b", Host: "github.com", Owner: "CompanyOrg", Key: key2},
 		},
 	}
-	issues := cfg.Validate()
+	issues := Validate(cfg)
 	foundWarning := false
 	for _, issue := range issues {
 		if issue.Level == "warning" {
@@ -81,7 +85,7 @@ func TestAddRuleRejectsDuplicateWithoutForce(t *testing.T) {
 			{ID: "a", Host: "github.com", Owner: "CompanyOrg", Key: "/tmp/key"},
 		},
 	}
-	err := cfg.AddRule(Rule{Host: "github.com", Owner: "CompanyOrg", Key: "/tmp/key"}, false)
+	err := AddRule(cfg, Rule{Host: "github.com", Owner: "CompanyOrg", Key: "/tmp/key"}, false)
 	if err == nil {
 		t.Fatalf("expected duplicate rejection")
 	}
@@ -151,6 +155,26 @@ func TestResolvePathDefaultsToRepoRootWhenConfigMissing(t *testing.T) {
 	}
 }
 
+func TestResolvePathInUsesGivenDirectory(t *testing.T) {
+	repo := t.TempDir()
+	if err := os.Mkdir(filepath.Join(repo, ".git"), 0o755); err != nil {
+		t.Fatalf("mkdir .git: %v", err)
+	}
+	subdir := filepath.Join(repo, "src")
+	if err := os.MkdirAll(subdir, 0o755); err != nil {
+		t.Fatalf("mkdir subdir: %v", err)
+	}
+
+	got, err := ResolvePathIn("", subdir)
+	if err != nil {
+		t.Fatalf("ResolvePathIn(): %v", err)
+	}
+	want := filepath.Join(repo, ".mgit", "config.json")
+	if canonicalPath(got) != canonicalPath(want) {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+}
+
 func TestEnsureGitignoreExcludesMgitAddsEntry(t *testing.T) {
 	repo := t.TempDir()
 	if err := os.MkdirAll(filepath.Join(repo, ".mgit"), 0o755); err != nil {
@@ -220,3 +244,485 @@ func TestEnsureGitignoreExcludesMgitNoGitignore(t *testing.T) {
 		t.Fatalf("expected no change without .gitignore")
 	}
 }
+
+func TestValidateAgentRuleSkipsKeyFileCheck(t *testing.T) {
+	cfg := &Config{
+		Version: 1,
+		Rules: []Rule{
+			{ID: "a", Host: "github.com", Owner: "CompanyOrg", Agent: "SHA256:Zm9vYmFy"},
+		},
+	}
+	issues := Validate(cfg)
+	if HasErrors(issues) {
+		t.Fatalf("expected agent rule to be valid, got %+v", issues)
+	}
+}
+
+func TestAddRuleRejectsKeyAndAgent(t *testing.T) {
+	cfg := &Config{Version: 1}
+	err := AddRule(cfg, Rule{Host: "github.com", Owner: "CompanyOrg", Key: "/tmp/key", Agent: "SHA256:Zm9vYmFy"}, false)
+	if err == nil {
+		t.Fatalf("expected key/agent conflict error")
+	}
+}
+
+func TestValidateProviderKeySkipsFileCheck(t *testing.T) {
+	cfg := &Config{
+		Version: 1,
+		Rules: []Rule{
+			{ID: "a", Host: "github.com", Owner: "CompanyOrg", Key: "op://Private/github-work/private key"},
+		},
+	}
+	if issues := Validate(cfg); HasErrors(issues) {
+		t.Fatalf("expected provider key to be valid, got %+v", issues)
+	}
+}
+
+func TestEffectiveSigningFormat(t *testing.T) {
+	cases := map[string]string{
+		"~/.ssh/signing_key.pub":   "ssh",
+		"key::ssh-ed25519 AAAA":    "ssh",
+		"/home/me/.ssh/id_ed25519": "ssh",
+		"3AA5C34371567BD2":         "openpgp",
+	}
+	for key, want := range cases {
+		if got := (Rule{SigningKey: key}).EffectiveSigningFormat(); got != want {
+			t.Fatalf("EffectiveSigningFormat(%q) = %q, want %q", key, got, want)
+		}
+	}
+	if got := (Rule{SigningKey: "ABC", SigningFormat: "x509"}).EffectiveSigningFormat(); got != "x509" {
+		t.Fatalf("explicit format ignored: %q", got)
+	}
+}
+
+func TestMoveRule(t *testing.T) {
+	cfg := &Config{Rules: []Rule{{ID: "a"}, {ID: "b"}, {ID: "c"}}}
+	if err := MoveRule(cfg, 2, 0); err != nil {
+		t.Fatalf("MoveRule() error = %v", err)
+	}
+	if got := cfg.Rules[0].ID + cfg.Rules[1].ID + cfg.Rules[2].ID; got != "cab" {
+		t.Fatalf("order after MoveRule(2, 0) = %s, want cab", got)
+	}
+	if err := MoveRule(cfg, 0, 1); err != nil {
+		t.Fatalf("MoveRule() error = %v", err)
+	}
+	if got := cfg.Rules[0].ID + cfg.Rules[1].ID + cfg.Rules[2].ID; got != "acb" {
+		t.Fatalf("order after MoveRule(0, 1) = %s, want acb", got)
+	}
+	if err := MoveRule(cfg, 0, 3); err == nil {
+		t.Fatalf("MoveRule() out of range should fail")
+	}
+}
+
+func TestNormalizeTags(t *testing.T) {
+	cfg := &Config{Rules: []Rule{{ID: "a", Description: "  Acme  ", Tags: []string{" client-a ", "", "infra"}}}}
+	cfg.Normalize()
+	r := cfg.Rules[0]
+	if r.Description != "Acme" || len(r.Tags) != 2 || r.Tags[0] != "client-a" {
+		t.Fatalf("Normalize() rule = %+v", r)
+	}
+	if !r.HasTag("Client-A") || r.HasTag("client") {
+		t.Fatalf("HasTag() mismatch for %v", r.Tags)
+	}
+}
+
+func TestDefaultKeyValidation(t *testing.T) {
+	cfg := &Config{Version: 1, DefaultKey: "/definitely/missing/key", Rules: []Rule{
+		{ID: "all", Host: "*", Owner: "*", Agent: "SHA256:Zm9vYmFy"},
+	}}
+	issues := Validate(cfg)
+	var fields []string
+	for _, issue := range issues {
+		fields = append(fields, issue.Level+" "+issue.Field)
+	}
+	if len(issues) != 2 || issues[0].Field != "defaultKey" || issues[1].Level != "warning" {
+		t.Fatalf("Validate() issues = %v", fields)
+	}
+	if r, ok := DefaultRule(&Config{DefaultKey: "SHA256:Zm9vYmFy"}); !ok || r.Agent == "" || r.ID != DefaultKeyRuleID {
+		t.Fatalf("DefaultRule() for agent ref = %+v, %v", r, ok)
+	}
+}
+
+func TestPinnedRule(t *testing.T) {
+	cfg := &Config{Version: 1, Pin: &Pin{Rule: "work"}, Rules: []Rule{
+		{ID: "work", Host: "github.com", Owner: "CompanyOrg", Agent: "SHA256:Zm9vYmFy"},
+	}}
+	if r, ok, err := PinnedRule(cfg); err != nil || !ok || r.ID != "work" {
+		t.Fatalf("PinnedRule() = %+v, %v, %v", r, ok, err)
+	}
+	if issues := Validate(cfg); len(issues) != 0 {
+		t.Fatalf("Validate() issues = %+v", issues)
+	}
+
+	cfg.Pin = &Pin{Key: "SHA256:Zm9vYmFy"}
+	if r, ok, err := PinnedRule(cfg); err != nil || !ok || r.ID != PinnedRuleID || r.Agent == "" || r.Host != "*" {
+		t.Fatalf("PinnedRule() for key = %+v, %v, %v", r, ok, err)
+	}
+
+	for _, pin := range []*Pin{{Rule: "gone"}, {}, {Rule: "work", Key: "/k"}, {Key: "/definitely/missing/key"}} {
+		cfg.Pin = pin
+		if !HasErrors(Validate(cfg)) {
+			t.Fatalf("Validate() with pin %+v: want an error", pin)
+		}
+	}
+	if _, _, err := PinnedRule(&Config{Pin: &Pin{Rule: "gone"}}); err == nil {
+		t.Fatal("PinnedRule() for missing rule: want error")
+	}
+}
+
+func TestValidateRuleEnv(t *testing.T) {
+	cfg := &Config{Version: 1, Rules: []Rule{
+		{ID: "a", Host: "github.com", Owner: "CompanyOrg", Agent: "SHA256:Zm9vYmFy", Env: map[string]string{"GIT_SSL_CAINFO": "/ca.pem", "GIT_SSH_COMMAND": "ssh", "A=B": "x"}},
+	}}
+	issues := Validate(cfg)
+	if len(issues) != 2 || !HasErrors(issues) {
+		t.Fatalf("Validate() issues = %+v, want two env errors", issues)
+	}
+}
+
+func TestHostDefaultsFor(t *testing.T) {
+	cfg := &Config{Version: 1, HostDefaults: []HostDefault{
+		{Host: "gerrit.example.com", User: "gerrit", Options: []string{"HostKeyAlgorithms=+ssh-rsa"}},
+		{Host: "*.example.com", User: "git", Port: 29418, Options: []string{"ConnectTimeout=5"}},
+	}}
+	d, ok := cfg.HostDefaultsFor("Gerrit.Example.com")
+	if !ok {
+		t.Fatal("HostDefaultsFor() found no defaults")
+	}
+	want := []string{"User=gerrit", "Port=29418", "HostKeyAlgorithms=+ssh-rsa", "ConnectTimeout=5"}
+	if got := d.SSHOptions(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("SSHOptions() = %v, want %v", got, want)
+	}
+	if _, ok := cfg.HostDefaultsFor("github.com"); ok {
+		t.Fatal("HostDefaultsFor(github.com) matched")
+	}
+}
+
+func TestValidateHostDefaults(t *testing.T) {
+	cfg := &Config{Version: 1, HostDefaults: []HostDefault{
+		{Host: "gerrit.example.com", User: "gerrit", Port: 29418},
+		{Host: "[", User: "a@b", Port: 70000, Options: []string{"ConnectTimeout 5"}},
+	}}
+	issues := Validate(cfg)
+	if len(issues) != 4 || !HasErrors(issues) {
+		t.Fatalf("Validate() issues = %+v, want four errors on hostDefaults[1]", issues)
+	}
+	for _, issue := range issues {
+		if !strings.HasPrefix(issue.Field, "hostDefaults[1].") {
+			t.Errorf("issue on %s, want hostDefaults[1]", issue.Field)
+		}
+	}
+}
+
+func TestValidateHTTPSOnlyRule(t *testing.T) {
+	cfg := &Config{Version: 1, Rules: []Rule{
+		{ID: "https", Host: "git.corp.example", Owner: "*", HTTPSUser: "jdoe"},
+		{ID: "none", Host: "git.corp.example", Owner: "team"},
+	}}
+	issues := Validate(cfg)
+	if len(issues) != 1 || issues[0].Field != "rules[1].key" {
+		t.Fatalf("Validate() issues = %+v, want only rules[1].key", issues)
+	}
+}
+
+func TestValidateHostAliases(t *testing.T) {
+	cfg := &Config{Version: 1, HostAliases: map[string]string{
+		" github-work ": "github.com",
+		"gh":            "github-work",
+		"*.corp":        "git.corp.example",
+	}}
+	issues := Validate(cfg)
+	if _, ok := cfg.HostAliases["github-work"]; !ok {
+		t.Fatalf("Normalize() kept untrimmed alias: %v", cfg.HostAliases)
+	}
+	if len(issues) != 2 || issues[0].Field != "hostAliases.*.corp" || issues[1].Field != "hostAliases.gh" || issues[1].Level != "warning" {
+		t.Fatalf("Validate() issues = %+v, want an error for *.corp and a chain warning for gh", issues)
+	}
+}
+
+func TestHostDefaultsForAlias(t *testing.T) {
+	cfg := &Config{Version: 1, HostDefaults: []HostDefault{{Host: "github-work", Options: []string{"HostName=github.com"}}}}
+	d, ok := cfg.HostDefaultsFor("github-work", "github.com")
+	if !ok || !reflect.DeepEqual(d.SSHOptions(), []string{"HostName=github.com"}) {
+		t.Fatalf("HostDefaultsFor(alias) = %+v, %v", d, ok)
+	}
+}
+
+func TestCheckGitCommand(t *testing.T) {
+	cfg := &Config{
+		AllowedGitCommands: []string{"fetch", "push"},
+		DeniedGitCommands:  []string{"push --force*", "push +*"},
+	}
+	for _, tc := range []struct {
+		args []string
+		ok   bool
+	}{
+		{[]string{"fetch", "origin"}, true},
+		{[]string{"push", "origin", "main"}, true},
+		{[]string{"push", "origin", "main", "--force-with-lease"}, false},
+		{[]string{"push", "origin", "+main"}, false},
+		{[]string{"-C", "repo", "push", "--force"}, false},
+		{[]string{"reset", "--hard"}, false},
+	} {
+		if err := CheckGitCommand(cfg, tc.args); (err == nil) != tc.ok {
+			t.Errorf("CheckGitCommand(%q) = %v, want ok=%v", tc.args, err, tc.ok)
+		}
+	}
+	if err := CheckGitCommand(&Config{}, []string{"reset", "--hard"}); err != nil {
+		t.Errorf("empty policy refused a command: %v", err)
+	}
+}
+
+func TestExpandGitAliases(t *testing.T) {
+	aliases := map[string]string{"p": "push", "pf": "p --force", "loop": "loop", "sh": "!git push", "q": `push "origin"`}
+	lookup := func(name string) string { return aliases[name] }
+	for _, tc := range []struct {
+		args []string
+		want []string
+		err  bool
+	}{
+		{args: []string{"fetch", "origin"}, want: []string{"fetch", "origin"}},
+		{args: []string{"p", "origin"}, want: []string{"push", "origin"}},
+		{args: []string{"-C", "repo", "pf", "origin"}, want: []string{"-C", "repo", "push", "--force", "origin"}},
+		{args: []string{"-c", "alias.x=push -f", "x", "origin"}, want: []string{"-c", "alias.x=push -f", "push", "-f", "origin"}},
+		{args: []string{"-c", "alias.P=fetch", "-c", "alias.p=status", "p"}, want: []string{"-c", "alias.P=fetch", "-c", "alias.p=status", "status"}},
+		{args: []string{"--config-env=alias.x=VAR", "x"}, err: true},
+		{args: []string{"sh"}, err: true},
+		{args: []string{"q"}, err: true},
+		{args: []string{"loop"}, err: true},
+	} {
+		got, err := ExpandGitAliases(tc.args, lookup)
+		if (err != nil) != tc.err || !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("ExpandGitAliases(%q) = %q, %v", tc.args, got, err)
+		}
+	}
+	cfg := &Config{DeniedGitCommands: []string{"push --force*"}}
+	args, err := ExpandGitAliases([]string{"-c", "alias.p=push", "p", "--force", "origin"}, lookup)
+	if err != nil || CheckGitCommand(cfg, args) == nil {
+		t.Errorf("aliased push --force allowed: %q, %v", args, err)
+	}
+}
+
+func TestValidateGitCommandPatterns(t *testing.T) {
+	cfg := &Config{Version: 1, DeniedGitCommands: []string{"--force", "push [", " "}}
+	issues := Validate(cfg)
+	n := 0
+	for _, is := range issues {
+		if strings.HasPrefix(is.Field, "deniedGitCommands[") {
+			n++
+		}
+	}
+	if n != 3 {
+		t.Fatalf("got %d deniedGitCommands issues, want 3: %+v", n, issues)
+	}
+}
+
+func TestValidatePolicy(t *testing.T) {
+	cfg := &Config{Version: 1, Policy: []PolicyEntry{
+		{Deny: &PolicyMatch{Host: "github.com", Owner: "me", Commands: []string{"push"}}},
+		{Message: "no deny"},
+		{Deny: &PolicyMatch{Host: "[", Commands: []string{"--force"}}},
+	}}
+	cfg.Normalize()
+	var fields []string
+	for _, is := range Validate(cfg) {
+		if strings.HasPrefix(is.Field, "policy[") {
+			fields = append(fields, is.Field)
+		}
+	}
+	want := []string{"policy[1].deny", "policy[2].deny.host", "policy[2].deny.commands[0]"}
+	if !reflect.DeepEqual(fields, want) {
+		t.Fatalf("policy issues = %v, want %v", fields, want)
+	}
+}
+
+func TestKeyTypeIssue(t *testing.T) {
+	ed := sshkeys.AgentIdentity{Type: "ssh-ed25519", Bits: 256}
+	rsa1024 := sshkeys.AgentIdentity{Type: "ssh-rsa", Bits: 1024}
+	rsa4096 := sshkeys.AgentIdentity{Type: "ssh-rsa", Bits: 4096}
+	dsa := sshkeys.AgentIdentity{Type: "ssh-dss", Bits: 1024}
+	for _, tc := range []struct {
+		require []string
+		id      sshkeys.AgentIdentity
+		want    string
+	}{
+		{nil, ed, ""},
+		{nil, rsa4096, ""},
+		{nil, rsa1024, "warning"},
+		{nil, dsa, "warning"},
+		{[]string{"ed25519"}, ed, ""},
+		{[]string{"ed25519"}, rsa4096, "error"},
+		{[]string{"ed25519", "rsa:3072"}, rsa4096, ""},
+		{[]string{"ed25519", "rsa:3072"}, rsa1024, "error"},
+	} {
+		cfg := &Config{RequireKeyTypes: tc.require}
+		if level, msg := KeyTypeIssue(cfg, tc.id); level != tc.want {
+			t.Errorf("requireKeyTypes=%v %s-%d: level %q (%s), want %q", tc.require, tc.id.Type, tc.id.Bits, level, msg, tc.want)
+		}
+	}
+}
+
+func TestRequireKeyTypesRejectsRuleKeys(t *testing.T) {
+	dir := t.TempDir()
+	key := filepath.Join(dir, "id_rsa")
+	if err := os.WriteFile(key, []byte("private"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// The public half of a 1024-bit RSA key.
+	pub := "ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAAAgQDEqzzmzkMxGSiKGUIW8pFCTZ4jDrazNuDxRKgqFsGF6ItH7hytqWNTlLKtYre42G+mCaRklHUtRUJaS2MTgTgSX0c2Y+7TrcUgh//zvPbis+lClZBGKX29m0VVWHJgZwgc5QfF4J0sm5nF982HCTPuqrXjJofrR0ReyF1TxMhKBw== test\n"
+	if err := os.WriteFile(key+".pub", []byte(pub), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &Config{Version: 1, RequireKeyTypes: []string{"ed25519", "bogus"}}
+	if err := AddRule(cfg, Rule{Host: "github.com", Owner: "a", Key: key}, true); err == nil {
+		t.Fatal("AddRule accepted an RSA key with requireKeyTypes ed25519")
+	}
+	cfg.Rules = []Rule{{ID: "a", Host: "github.com", Owner: "a", Key: key}}
+	var fields []string
+	for _, is := range Validate(cfg) {
+		if is.Level == "error" && (is.Field == "rules[0].key" || is.Field == "requireKeyTypes[1]") {
+			fields = append(fields, is.Field)
+		}
+	}
+	if len(fields) != 2 {
+		t.Fatalf("Validate() errors = %v, want rules[0].key and requireKeyTypes[1]", fields)
+	}
+}
+
+func TestValidateWarnsOnKeyReuseAcrossOwners(t *testing.T) {
+	cfg := &Config{Version: 1, Rules: []Rule{
+		{ID: "a", Host: "github.com", Owner: "alice", Key: "/tmp/shared"},
+		{ID: "b", Host: "GitHub.com", Owner: "bob", Key: "/tmp/../tmp/shared"},
+		{ID: "c", Host: "gitlab.com", Owner: "bob", Key: "/tmp/shared"},
+		{ID: "d", Host: "github.com", Owner: "*", Key: "/tmp/shared"},
+		{ID: "e", Host: "bitbucket.org", Owner: "x", Key: "/tmp/shared", Email: "me@example.com"},
+		{ID: "f", Host: "bitbucket.org", Owner: "y", Key: "/tmp/shared", Email: "me@example.com"},
+	}}
+	var got []string
+	for _, is := range Validate(cfg) {
+		if strings.Contains(is.Message, "same account") {
+			got = append(got, is.Field)
+		}
+	}
+	if len(got) != 1 || got[0] != "rules[1].key" {
+		t.Fatalf("key reuse warnings on %q, want only rules[1].key", got)
+	}
+}
+
+func TestCrossHostKeys(t *testing.T) {
+	cfg := &Config{Version: 1, HostAliases: map[string]string{"github-work": "github.com"}, Rules: []Rule{
+		{ID: "a", Host: "github.com", Owner: "me", Key: "/tmp/shared"},
+		{ID: "b", Host: "github-work", Owner: "corp", Key: "/tmp/shared"},
+		{ID: "c", Host: "gitlab.client.example", Owner: "*", Key: "/tmp/../tmp/shared"},
+		{ID: "d", Host: "*", Owner: "*", Key: "/tmp/shared"},
+		{ID: "e", Host: "gitlab.corp.example", Owner: "*", Key: "/tmp/corp"},
+		{ID: "f", Host: "*.corp.example", Owner: "*", Key: "/tmp/corp"},
+	}}
+	got := CrossHostKeys(cfg)
+	want := []SharedKey{{
+		Fingerprint: "/tmp/shared",
+		Keys:        []string{"/tmp/shared", "/tmp/../tmp/shared"},
+		Hosts:       []SharedHost{{Host: "github.com", Rules: []string{"a", "b"}}, {Host: "gitlab.client.example", Rules: []string{"c"}}},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("CrossHostKeys() = %+v, want %+v", got, want)
+	}
+	var fields []string
+	for _, is := range Validate(cfg) {
+		if strings.Contains(is.Message, "unrelated hosts") {
+			fields = append(fields, is.Field)
+			if !strings.Contains(is.Message, "gitlab.client.example (rule c)") {
+				t.Errorf("warning lacks the hosts per key: %q", is.Message)
+			}
+		}
+	}
+	if !reflect.DeepEqual(fields, []string{"rules[0].key"}) {
+		t.Fatalf("cross-host warnings on %q, want rules[0].key", fields)
+	}
+}
+
+func TestValidateHostKeyOptions(t *testing.T) {
+	cfg := &Config{Version: 1, Rules: []Rule{
+		{ID: "a", Host: "a.example", Owner: "*", Agent: "SHA256:x", StrictHostKeyChecking: "Accept-New"},
+		{ID: "b", Host: "b.example", Owner: "*", Agent: "SHA256:x", StrictHostKeyChecking: "maybe"},
+		{ID: "c", Host: "c.example", Owner: "*", Agent: "SHA256:x", StrictHostKeyChecking: "no"},
+		{ID: "d", Host: "d.example", Owner: "*", Agent: "SHA256:x", KnownHostsFile: filepath.Join(t.TempDir(), "missing")},
+	}}
+	got := map[string]string{}
+	for _, is := range Validate(cfg) {
+		if strings.Contains(is.Field, "HostKeyChecking") || strings.Contains(is.Field, "knownHostsFile") {
+			got[is.Field] = is.Level
+		}
+	}
+	want := map[string]string{
+		"rules[1].strictHostKeyChecking": "error",
+		"rules[2].strictHostKeyChecking": "warning",
+		"rules[3].knownHostsFile":        "warning",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("host key issues = %v, want %v", got, want)
+	}
+	if got := cfg.Rules[3].EffectiveStrictHostKeyChecking(); got != "yes" {
+		t.Errorf("EffectiveStrictHostKeyChecking() with knownHostsFile = %q, want yes", got)
+	}
+	if err := AddRule(cfg, Rule{Host: "e.example", Owner: "*", Agent: "SHA256:x", StrictHostKeyChecking: "sometimes"}, false); err == nil {
+		t.Error("AddRule() accepted an invalid strictHostKeyChecking")
+	}
+}
+
+func TestSSHBinary(t *testing.T) {
+	t.Setenv(SSHBinaryEnv, "")
+	cfg := &Config{Version: 1, SSHBinary: "/opt/openssh/bin/ssh"}
+	client := func(r Rule) []string {
+		t.Helper()
+		c, err := SSHClientFor(cfg, r)
+		if err != nil {
+			t.Fatalf("SSHClientFor() error = %v", err)
+		}
+		return c
+	}
+	if got := client(Rule{}); !reflect.DeepEqual(got, []string{"/opt/openssh/bin/ssh"}) {
+		t.Fatalf("SSHClientFor() = %q, want sshBinary", got)
+	}
+	if got := client(Rule{SSHCommand: "plink.exe"}); !reflect.DeepEqual(got, []string{"plink.exe"}) {
+		t.Fatalf("SSHClientFor(sshCommand) = %q, want the rule's sshCommand", got)
+	}
+	t.Setenv(SSHBinaryEnv, "/usr/local/bin/ssh")
+	if got := client(Rule{}); !reflect.DeepEqual(got, []string{"/usr/local/bin/ssh"}) {
+		t.Fatalf("SSHClientFor() = %q, want MGIT_SSH", got)
+	}
+
+	cfg.SSHBinary = filepath.Join(t.TempDir(), "ssh")
+	if issues := Validate(cfg); len(issues) != 1 || issues[0].Field != "sshBinary" {
+		t.Fatalf("Validate() with a missing sshBinary = %+v", issues)
+	}
+}
+
+func TestSaveWritesThroughSymlink(t *testing.T) {
+	dir := t.TempDir()
+	real := filepath.Join(dir, "dotfiles", "mgit.json")
+	if err := os.MkdirAll(filepath.Dir(real), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(real, []byte(`{"version":1,"rules":[]}`+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "config.json")
+	if err := os.Symlink(real, link); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &Config{Version: CurrentVersion, Rules: []Rule{{Host: "github.com", Owner: "me", Key: "/k"}}}
+	if err := Save(link, cfg); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if target, err := os.Readlink(link); err != nil || target != real {
+		t.Fatalf("config symlink was replaced: %q, %v", target, err)
+	}
+	got, err := Load(real)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Rules) != 1 {
+		t.Fatalf("symlink target has %d rules, want 1", len(got.Rules))
+	}
+}
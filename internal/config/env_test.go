@@ -0,0 +1,37 @@
+package config
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEnvSource(t *testing.T) {
+	t.Setenv(RulesEnv, `[{"host":"github.com","owner":"CompanyOrg","key":"/k/work"},{"id":"home","host":"github.com","owner":"me","key":"/k/home"}]`)
+	t.Setenv(DefaultKeyEnv, " /k/default ")
+	if path, err := ResolvePathIn("", t.TempDir()); err != nil || path != EnvSource {
+		t.Fatalf("ResolvePathIn() = %q, %v; want %q", path, err, EnvSource)
+	}
+	if path, err := ResolvePath("/etc/mgit.json"); err != nil || path != "/etc/mgit.json" {
+		t.Fatalf("ResolvePath(explicit) = %q, %v; --config wins over MGIT_RULES", path, err)
+	}
+
+	cfg, err := Load(EnvSource)
+	if err != nil {
+		t.Fatalf("Load(env) error = %v", err)
+	}
+	if len(cfg.Rules) != 2 || cfg.Rules[0].ID != "env_1" || cfg.Rules[1].ID != "home" || cfg.DefaultKey != "/k/default" {
+		t.Fatalf("Load(env) = %+v", cfg)
+	}
+	if err := Update(EnvSource, func(*Config) error { return nil }); !errors.Is(err, ErrEnvSource) {
+		t.Fatalf("Update(env) error = %v, want ErrEnvSource", err)
+	}
+	if err := RecordUsage(EnvSource, cfg.Rules[0], time.Now()); err != nil {
+		t.Fatalf("RecordUsage(env) error = %v, want a no-op", err)
+	}
+
+	t.Setenv(RulesEnv, `{"rules":[]}`)
+	if _, err := Load(EnvSource); err == nil {
+		t.Fatal("Load(env) accepted an object")
+	}
+}
@@ -0,0 +1,169 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// gitOptionsWithValue are git's global options that take the next argument
+// as their value, e.g. `git -C dir push`.
+var gitOptionsWithValue = map[string]bool{
+	"-C": true, "-c": true, "--config-env": true, "--git-dir": true, "--work-tree": true, "--namespace": true, "--exec-path": true,
+}
+
+// maxAliasDepth bounds alias expansion, as aliases can name each other.
+const maxAliasDepth = 16
+
+// HasGitPolicy reports whether c restricts the git passthrough, with
+// allowedGitCommands, deniedGitCommands or policy entries.
+func HasGitPolicy(c *Config) bool {
+	return len(c.AllowedGitCommands) > 0 || len(c.DeniedGitCommands) > 0 || len(c.Policy) > 0
+}
+
+// ExpandGitAliases replaces the subcommand of args, a git passthrough
+// without the leading "git", by the command it is an alias for, as git
+// would, so a policy sees "push" where "git -c alias.p=push p" is run. An
+// alias set with -c in args wins over lookup, which returns the value of
+// alias.<name> from git's config ("" for none). Shell aliases ("!...") and
+// aliases that need quoting cannot be checked and are an error.
+func ExpandGitAliases(args []string, lookup func(name string) string) ([]string, error) {
+	for range maxAliasDepth {
+		i := GitSubcommandIndex(args)
+		if i < 0 {
+			return args, nil
+		}
+		value, ok, err := commandLineAlias(args[:i], args[i])
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			value = lookup(args[i])
+		}
+		value = strings.TrimSpace(value)
+		switch {
+		case value == "":
+			return args, nil
+		case strings.HasPrefix(value, "!"):
+			return nil, fmt.Errorf("git %s is the shell alias %q, which the config's git policy cannot check", args[i], value)
+		case strings.ContainsAny(value, `"'\`):
+			return nil, fmt.Errorf("git %s is the alias %q, whose quoting the config's git policy cannot check", args[i], value)
+		}
+		args = slices.Concat(args[:i], strings.Fields(value), args[i+1:])
+	}
+	return nil, errors.New("git aliases nest too deeply to check against the config's git policy")
+}
+
+// commandLineAlias returns the value the git options opts give alias.<name>
+// with -c; the last one wins. --config-env takes the value from the
+// environment of git, which cannot be checked.
+func commandLineAlias(opts []string, name string) (value string, ok bool, err error) {
+	key := "alias." + strings.ToLower(name)
+	for i := 0; i < len(opts); i++ {
+		opt, arg := opts[i], ""
+		if gitOptionsWithValue[opt] && i+1 < len(opts) {
+			i++
+			arg = opts[i]
+		} else if v, found := strings.CutPrefix(opt, "--config-env="); found {
+			opt, arg = "--config-env", v
+		}
+		k, v, _ := strings.Cut(arg, "=")
+		switch {
+		case opt == "-c" && strings.ToLower(k) == key:
+			value, ok = v, true
+		case opt == "--config-env" && strings.HasPrefix(strings.ToLower(k), "alias."):
+			return "", false, fmt.Errorf("--config-env %s sets an alias the config's git policy cannot check", arg)
+		}
+	}
+	return value, ok, nil
+}
+
+// CheckGitCommand enforces allowedGitCommands and deniedGitCommands on the
+// arguments of a git passthrough (without the leading "git"). Each entry is
+// a subcommand followed by arguments, all glob patterns: "push --force*"
+// matches any push with an argument starting with --force, wherever it is.
+// With allowedGitCommands set, a command must match one of its entries; a
+// match in deniedGitCommands rejects the command either way.
+func CheckGitCommand(c *Config, args []string) error {
+	for _, pattern := range c.DeniedGitCommands {
+		if MatchGitCommand(pattern, args) {
+			return fmt.Errorf("git %s is denied by the config (deniedGitCommands: %q)", strings.Join(args, " "), pattern)
+		}
+	}
+	if len(c.AllowedGitCommands) == 0 {
+		return nil
+	}
+	for _, pattern := range c.AllowedGitCommands {
+		if MatchGitCommand(pattern, args) {
+			return nil
+		}
+	}
+	return fmt.Errorf("git %s is not in the config's allowedGitCommands", strings.Join(args, " "))
+}
+
+// MatchGitCommand reports whether args match a policy entry: the first word
+// matches the git subcommand and every other word matches some argument
+// after it. git's own options before the subcommand (-C, -c, ...) are skipped.
+func MatchGitCommand(pattern string, args []string) bool {
+	words := strings.Fields(pattern)
+	i := GitSubcommandIndex(args)
+	if len(words) == 0 || i < 0 || !globMatch(words[0], args[i]) {
+		return false
+	}
+	for _, w := range words[1:] {
+		found := false
+		for _, arg := range args[i+1:] {
+			if globMatch(w, arg) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// GitSubcommandIndex returns the index of the git subcommand in args, after
+// git's own options, or -1 when there is none.
+func GitSubcommandIndex(args []string) int {
+	for i := 0; i < len(args); i++ {
+		switch {
+		case gitOptionsWithValue[args[i]]:
+			i++
+		case strings.HasPrefix(args[i], "-"):
+		default:
+			return i
+		}
+	}
+	return -1
+}
+
+func globMatch(pattern, value string) bool {
+	ok, err := filepath.Match(pattern, value)
+	return err == nil && ok
+}
+
+func gitCommandIssues(field string, patterns []string) []ValidationIssue {
+	var issues []ValidationIssue
+	for i, p := range patterns {
+		f := fmt.Sprintf("%s[%d]", field, i)
+		words := strings.Fields(p)
+		if len(words) == 0 {
+			issues = append(issues, ValidationIssue{Level: "error", Field: f, Message: "entry is empty"})
+			continue
+		}
+		if strings.HasPrefix(words[0], "-") {
+			issues = append(issues, ValidationIssue{Level: "error", Field: f, Message: fmt.Sprintf("%q must start with a git subcommand, e.g. \"push --force\"", p)})
+		}
+		for _, w := range words {
+			if _, err := filepath.Match(w, ""); err != nil {
+				issues = append(issues, ValidationIssue{Level: "error", Field: f, Message: fmt.Sprintf("invalid pattern %q", w)})
+			}
+		}
+	}
+	return issues
+}
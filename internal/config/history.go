@@ -0,0 +1,157 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// HistoryLimit is how many snapshots are kept per config; older ones are
+// pruned whenever a new snapshot is taken.
+var HistoryLimit = 50
+
+const snapshotTimeLayout = "20060102T150405.000000000Z"
+
+// Snapshot is a previous version of a config, saved before it was replaced.
+type Snapshot struct {
+	Path  string    `json:"path"`
+	Time  time.Time `json:"time"`
+	Rules int       `json:"rules"`
+}
+
+// HistoryDir is where snapshots of the config at path are kept: a history/
+// directory next to it, i.e. .mgit/history/ for a repo-local config.
+func HistoryDir(path string) string {
+	return filepath.Join(filepath.Dir(path), "history")
+}
+
+// History lists the snapshots of the config at path, newest first.
+func History(path string) ([]Snapshot, error) {
+	resolved, err := ResolvePath(path)
+	if err != nil || IsEnvSource(resolved) {
+		return nil, err
+	}
+	out, err := snapshotFiles(resolved, "-"+filepath.Base(resolved))
+	if err != nil {
+		return nil, err
+	}
+	for i := range out {
+		if cfg, err := Load(out[i].Path); err == nil {
+			out[i].Rules = len(cfg.Rules)
+		}
+	}
+	return out, nil
+}
+
+// snapshotFiles lists the files in the history directory of the config at
+// resolved whose names are a snapshot time followed by suffix, newest first.
+// Only names are read, so pruning doesn't parse every snapshot.
+func snapshotFiles(resolved, suffix string) ([]Snapshot, error) {
+	dir := HistoryDir(resolved)
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read config history: %w", err)
+	}
+	var out []Snapshot
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, suffix) {
+			continue
+		}
+		ts, err := time.Parse(snapshotTimeLayout, strings.TrimSuffix(name, suffix))
+		if err != nil {
+			continue
+		}
+		out = append(out, Snapshot{Path: filepath.Join(dir, name), Time: ts})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Time.After(out[j].Time) })
+	return out, nil
+}
+
+// Undo restores the newest snapshot of the config at path and drops it from
+// the history, so repeated calls step further back. It returns the snapshot
+// that was restored. The config it replaces is kept in the history directory
+// with an undoneSuffix, out of the way of later undos.
+func Undo(path string) (Snapshot, error) {
+	unlock, err := Lock(path)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	defer unlock()
+	history, err := History(path)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	if len(history) == 0 {
+		return Snapshot{}, errors.New("no config history to undo")
+	}
+	latest := history[0]
+	data, err := os.ReadFile(latest.Path)
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("read snapshot: %w", err)
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return Snapshot{}, fmt.Errorf("parse snapshot %s: %w", latest.Path, err)
+	}
+	resolved, err := ResolvePath(path)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	if current, err := os.ReadFile(resolved); err == nil {
+		if err := writeSnapshot(resolved, current, undoneSuffix); err != nil {
+			return Snapshot{}, err
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return Snapshot{}, fmt.Errorf("read config: %w", err)
+	}
+	forgetLoaded(resolved)
+	if err := writeFileAtomic(resolved, data); err != nil {
+		return Snapshot{}, err
+	}
+	if err := os.Remove(latest.Path); err != nil {
+		return latest, fmt.Errorf("drop restored snapshot: %w", err)
+	}
+	return latest, nil
+}
+
+// undoneSuffix marks the snapshot of a config replaced by Undo. History
+// doesn't list these, so undoing twice steps back twice.
+const undoneSuffix = ".undone"
+
+// snapshot saves data, the current contents of the config at resolved, into
+// its history directory and prunes snapshots beyond HistoryLimit.
+func snapshot(resolved string, data []byte) error {
+	return writeSnapshot(resolved, data, "")
+}
+
+// writeSnapshot is snapshot for the snapshots whose names end in kind after
+// the config's file name; the newest HistoryLimit of each kind are kept.
+func writeSnapshot(resolved string, data []byte, kind string) error {
+	dir := HistoryDir(resolved)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("create config history: %w", err)
+	}
+	suffix := "-" + filepath.Base(resolved) + kind
+	name := time.Now().UTC().Format(snapshotTimeLayout) + suffix
+	if err := os.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+		return fmt.Errorf("write config history: %w", err)
+	}
+	files, err := snapshotFiles(resolved, suffix)
+	if err != nil {
+		return err
+	}
+	for i := HistoryLimit; i < len(files); i++ {
+		_ = os.Remove(files[i].Path)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package config
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestHistoryAndUndo(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".mgit", "config.json")
+	for _, owner := range []string{"a", "b", "c"} {
+		if err := Update(path, func(cfg *Config) error {
+			return AddRule(cfg, Rule{Host: "github.com", Owner: owner, Key: "/tmp/key"}, false)
+		}); err != nil {
+			t.Fatalf("Update() error = %v", err)
+		}
+	}
+	history, err := History(path)
+	if err != nil {
+		t.Fatalf("History() error = %v", err)
+	}
+	// The first Update created the file, so only the two replacements were snapshotted.
+	if len(history) != 2 || history[0].Rules != 2 || history[1].Rules != 1 {
+		t.Fatalf("History() = %+v, want snapshots with 2 then 1 rules", history)
+	}
+
+	restored, err := Undo(path)
+	if err != nil {
+		t.Fatalf("Undo() error = %v", err)
+	}
+	if restored.Rules != 2 {
+		t.Fatalf("Undo() restored %d rules, want 2", restored.Rules)
+	}
+	undone, err := snapshotFiles(path, "-config.json"+undoneSuffix)
+	if err != nil || len(undone) != 1 {
+		t.Fatalf("undone snapshots = %+v, %v; want the replaced config", undone, err)
+	}
+	if cfg, err := Load(undone[0].Path); err != nil || len(cfg.Rules) != 3 {
+		t.Fatalf("undone snapshot = %+v, %v; want the 3-rule config", cfg, err)
+	}
+	if _, err := Undo(path); err != nil {
+		t.Fatalf("second Undo() error = %v", err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(cfg.Rules) != 1 || cfg.Rules[0].Owner != "a" {
+		t.Fatalf("after two undos rules = %+v, want only owner a", cfg.Rules)
+	}
+	if _, err := Undo(path); err == nil {
+		t.Fatalf("Undo() with empty history should fail")
+	}
+}
+
+func TestHistoryPrunesOldSnapshots(t *testing.T) {
+	defer func(n int) { HistoryLimit = n }(HistoryLimit)
+	HistoryLimit = 3
+	path := filepath.Join(t.TempDir(), "config.json")
+	for i := 0; i < 6; i++ {
+		if err := Update(path, func(cfg *Config) error {
+			cfg.Rules = append(cfg.Rules, Rule{Host: "github.com", Owner: "*", Key: "/tmp/key"})
+			return nil
+		}); err != nil {
+			t.Fatalf("Update() error = %v", err)
+		}
+	}
+	history, err := History(path)
+	if err != nil {
+		t.Fatalf("History() error = %v", err)
+	}
+	if len(history) != 3 || history[0].Rules != 5 {
+		t.Fatalf("History() = %+v, want the 3 newest snapshots", history)
+	}
+}
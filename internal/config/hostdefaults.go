@@ -0,0 +1,29 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+func hostDefaultIssues(prefix string, d HostDefault) []ValidationIssue {
+	var issues []ValidationIssue
+	if _, err := validatePattern(d.Host); err != nil {
+		issues = append(issues, ValidationIssue{Level: "error", Field: prefix + ".host", Message: err.Error()})
+	}
+	if strings.ContainsAny(d.User, "@ \t") {
+		issues = append(issues, ValidationIssue{Level: "error", Field: prefix + ".user", Message: fmt.Sprintf("invalid ssh user %q", d.User)})
+	}
+	if d.Port < 0 || d.Port > 65535 {
+		issues = append(issues, ValidationIssue{Level: "error", Field: prefix + ".port", Message: "port must be between 1 and 65535"})
+	}
+	for _, o := range d.Options {
+		name, _, ok := strings.Cut(o, "=")
+		if !ok || name == "" || strings.ContainsAny(name, " \t") {
+			issues = append(issues, ValidationIssue{Level: "error", Field: prefix + ".options", Message: fmt.Sprintf("option %q must be Name=value", o)})
+		}
+	}
+	if d.User == "" && d.Port == 0 && len(d.Options) == 0 {
+		issues = append(issues, ValidationIssue{Level: "warning", Field: prefix, Message: "sets no user, port or options"})
+	}
+	return issues
+}
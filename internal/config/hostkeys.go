@@ -0,0 +1,30 @@
+package config
+
+import (
+	"fmt"
+	"os"
+)
+
+// hostKeyIssues checks a rule's strictHostKeyChecking and knownHostsFile;
+// prefix is the rule's field path, e.g. "rules[2]".
+func hostKeyIssues(prefix string, r Rule) []ValidationIssue {
+	var issues []ValidationIssue
+	switch r.StrictHostKeyChecking {
+	case "", "yes", "accept-new", "ask":
+	case "no", "off":
+		issues = append(issues, ValidationIssue{Level: "warning", Field: prefix + ".strictHostKeyChecking", Message: "host keys are not checked: any server answering for the host gets the connection; accept-new at least pins the first key seen"})
+	default:
+		issues = append(issues, ValidationIssue{Level: "error", Field: prefix + ".strictHostKeyChecking", Message: fmt.Sprintf("strictHostKeyChecking must be yes, accept-new, ask or no, not %q", r.StrictHostKeyChecking)})
+	}
+	if r.KnownHostsFile == "" {
+		return issues
+	}
+	expanded, err := ExpandPath(r.KnownHostsFile)
+	if err != nil {
+		return append(issues, ValidationIssue{Level: "error", Field: prefix + ".knownHostsFile", Message: err.Error()})
+	}
+	if _, err := os.Stat(expanded); err != nil && r.EffectiveStrictHostKeyChecking() == "yes" {
+		issues = append(issues, ValidationIssue{Level: "warning", Field: prefix + ".knownHostsFile", Message: fmt.Sprintf("known hosts file not found: %s; with strictHostKeyChecking yes every connection fails until it lists the host's keys", expanded)})
+	}
+	return issues
+}
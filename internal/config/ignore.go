@@ -0,0 +1,163 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// IgnoreMode controls how mgit keeps a repo-local .mgit directory out of git
+// when it creates a config.
+type IgnoreMode string
+
+const (
+	// IgnoreGitignore adds .mgit to the repository's .gitignore if it has one.
+	IgnoreGitignore IgnoreMode = "gitignore"
+	// IgnoreExclude adds .mgit to .git/info/exclude, leaving tracked files alone.
+	IgnoreExclude IgnoreMode = "exclude"
+	// IgnoreOff leaves both files untouched.
+	IgnoreOff IgnoreMode = "off"
+)
+
+// ParseIgnoreMode parses a mode name; empty means IgnoreGitignore.
+func ParseIgnoreMode(s string) (IgnoreMode, error) {
+	switch m := IgnoreMode(strings.ToLower(strings.TrimSpace(s))); m {
+	case "":
+		return IgnoreGitignore, nil
+	case IgnoreGitignore, IgnoreExclude, IgnoreOff:
+		return m, nil
+	}
+	return "", fmt.Errorf("invalid ignore mode %q (use gitignore, exclude or off)", s)
+}
+
+// ExcludeMgit keeps the .mgit directory of a repo-local config out of git as
+// mode says. It returns the file it changed, or "" when nothing changed
+// (mode off, a config outside .mgit, or .mgit already listed).
+func ExcludeMgit(configPath string, mode IgnoreMode) (string, error) {
+	if mode == IgnoreOff {
+		return "", nil
+	}
+	repoRoot, ok, err := repoRootForConfig(configPath)
+	if err != nil || !ok {
+		return "", err
+	}
+	var file string
+	if mode == IgnoreExclude {
+		gitDir, err := gitCommonDir(repoRoot)
+		if err != nil {
+			return "", err
+		}
+		file = filepath.Join(gitDir, "info", "exclude")
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			return "", fmt.Errorf("create %s: %w", filepath.Dir(file), err)
+		}
+	} else {
+		file = filepath.Join(repoRoot, ".gitignore")
+		// Only edit an existing .gitignore; creating one would add a file to the project.
+		if st, err := os.Stat(file); os.IsNotExist(err) || (err == nil && st.IsDir()) {
+			return "", nil
+		}
+	}
+	changed, err := appendIgnoreEntry(file)
+	if err != nil || !changed {
+		return "", err
+	}
+	return file, nil
+}
+
+func EnsureGitignoreExcludesMgit(configPath string) (bool, error) {
+	file, err := ExcludeMgit(configPath, IgnoreGitignore)
+	return file != "", err
+}
+
+// repoRootForConfig returns the directory holding .mgit/config.json; ok is
+// false for configs stored anywhere else.
+func repoRootForConfig(configPath string) (string, bool, error) {
+	resolved, err := ResolvePath(configPath)
+	if err != nil {
+		return "", false, err
+	}
+	if filepath.Base(resolved) != "config.json" {
+		return "", false, nil
+	}
+	cfgDir := filepath.Dir(resolved)
+	if filepath.Base(cfgDir) != ".mgit" {
+		return "", false, nil
+	}
+	return filepath.Dir(cfgDir), true, nil
+}
+
+// gitCommonDir finds the git directory whose info/exclude applies to the
+// work tree at repoRoot, following the .git file of linked worktrees and
+// submodules.
+func gitCommonDir(repoRoot string) (string, error) {
+	gitDir, err := workTreeGitDir(repoRoot)
+	if err != nil {
+		return "", err
+	}
+	// Linked worktrees share info/exclude with the main repository.
+	if common, err := os.ReadFile(filepath.Join(gitDir, "commondir")); err == nil {
+		c := strings.TrimSpace(string(common))
+		if !filepath.IsAbs(c) {
+			c = filepath.Join(gitDir, c)
+		}
+		return filepath.Clean(c), nil
+	}
+	return gitDir, nil
+}
+
+// workTreeGitDir finds the git directory of the work tree at repoRoot: .git
+// itself, or where the .git file of a linked worktree or submodule points.
+func workTreeGitDir(repoRoot string) (string, error) {
+	dotGit := filepath.Join(repoRoot, ".git")
+	st, err := os.Stat(dotGit)
+	if err != nil {
+		return "", fmt.Errorf("%s is not a git work tree: %w", repoRoot, err)
+	}
+	if st.IsDir() {
+		return dotGit, nil
+	}
+	data, err := os.ReadFile(dotGit)
+	if err != nil {
+		return "", fmt.Errorf("read %s: %w", dotGit, err)
+	}
+	gitDir, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir:")
+	if !ok {
+		return "", fmt.Errorf("unrecognized %s", dotGit)
+	}
+	gitDir = strings.TrimSpace(gitDir)
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(repoRoot, gitDir)
+	}
+	return filepath.Clean(gitDir), nil
+}
+
+// appendIgnoreEntry adds a .mgit line to an ignore file unless one is
+// already there, creating the file if needed.
+func appendIgnoreEntry(file string) (bool, error) {
+	data, err := os.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return false, fmt.Errorf("read %s: %w", file, err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		switch strings.TrimSpace(line) {
+		case ".mgit", ".mgit/", "/.mgit", "/.mgit/":
+			return false, nil
+		}
+	}
+	perm := os.FileMode(0o644)
+	if st, err := os.Stat(file); err == nil {
+		perm = st.Mode().Perm()
+	}
+	var b strings.Builder
+	b.Write(data)
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		b.WriteByte('\n')
+	}
+	b.WriteString(".mgit\n")
+	if err := os.WriteFile(file, []byte(b.String()), perm); err != nil {
+		return false, fmt.Errorf("write %s: %w", file, err)
+	}
+	return true, nil
+}
@@ -0,0 +1,65 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExcludeMgitWritesInfoExclude(t *testing.T) {
+	repo := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(repo, ".git"), 0o755); err != nil {
+		t.Fatalf("mkdir .git: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(repo, ".gitignore"), []byte("node_modules/\n"), 0o644); err != nil {
+		t.Fatalf("write .gitignore: %v", err)
+	}
+	cfgPath := filepath.Join(repo, ".mgit", "config.json")
+
+	file, err := ExcludeMgit(cfgPath, IgnoreExclude)
+	if err != nil {
+		t.Fatalf("ExcludeMgit() error = %v", err)
+	}
+	want := filepath.Join(repo, ".git", "info", "exclude")
+	if file != want {
+		t.Fatalf("ExcludeMgit() changed %q, want %q", file, want)
+	}
+	if data, _ := os.ReadFile(want); string(data) != ".mgit\n" {
+		t.Fatalf("info/exclude = %q", data)
+	}
+	if data, _ := os.ReadFile(filepath.Join(repo, ".gitignore")); string(data) != "node_modules/\n" {
+		t.Fatalf(".gitignore was modified: %q", data)
+	}
+	if file, err := ExcludeMgit(cfgPath, IgnoreExclude); err != nil || file != "" {
+		t.Fatalf("second ExcludeMgit() = %q, %v; want no change", file, err)
+	}
+	if file, err := ExcludeMgit(cfgPath, IgnoreOff); err != nil || file != "" {
+		t.Fatalf("ExcludeMgit(off) = %q, %v", file, err)
+	}
+}
+
+func TestExcludeMgitFollowsWorktreeGitFile(t *testing.T) {
+	root := t.TempDir()
+	common := filepath.Join(root, "main", ".git")
+	wtGitDir := filepath.Join(common, "worktrees", "feature")
+	if err := os.MkdirAll(wtGitDir, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(wtGitDir, "commondir"), []byte("../..\n"), 0o644); err != nil {
+		t.Fatalf("write commondir: %v", err)
+	}
+	wt := filepath.Join(root, "feature")
+	if err := os.MkdirAll(wt, 0o755); err != nil {
+		t.Fatalf("mkdir worktree: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(wt, ".git"), []byte("gitdir: "+wtGitDir+"\n"), 0o644); err != nil {
+		t.Fatalf("write .git file: %v", err)
+	}
+	file, err := ExcludeMgit(filepath.Join(wt, ".mgit", "config.json"), IgnoreExclude)
+	if err != nil {
+		t.Fatalf("ExcludeMgit() error = %v", err)
+	}
+	if want := filepath.Join(common, "info", "exclude"); file != want {
+		t.Fatalf("ExcludeMgit() changed %q, want %q", file, want)
+	}
+}
@@ -0,0 +1,10 @@
+package config
+
+// Import is configuration read from another tool (ssh_config, git's
+// conditional includes) to be merged into an mgit config.
+type Import struct {
+	Rules        []Rule            `json:"rules"`
+	HostAliases  map[string]string `json:"hostAliases,omitempty"`
+	HostDefaults []HostDefault     `json:"hostDefaults,omitempty"`
+	Notes        []string          `json:"notes,omitempty"`
+}
@@ -0,0 +1,208 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/pavelBuzdanov/mgit/internal/sshkeys"
+)
+
+// keyReuseIssues warns about rules for the same literal host that use the
+// same key for different literal owners. The host authenticates the key, not
+// the owner, so both push as one account, which is often a copy-paste
+// mistake. Rules that declare the same email are taken to be one account on
+// purpose and not reported.
+func keyReuseIssues(c *Config) []ValidationIssue {
+	type seen struct {
+		index int
+		rule  Rule
+	}
+	first := map[string]seen{}
+	var issues []ValidationIssue
+	for i, r := range c.Rules {
+		id := keyIdentity(r)
+		host := strings.ToLower(r.Host)
+		if canonical, ok := c.CanonicalHost(host); ok {
+			host = canonical
+		}
+		if id == "" || hasWildcard(host) || hasWildcard(r.Owner) {
+			continue
+		}
+		k := host + "|" + id
+		prev, ok := first[k]
+		if !ok {
+			first[k] = seen{i, r}
+			continue
+		}
+		if strings.EqualFold(prev.rule.Owner, r.Owner) {
+			continue
+		}
+		if r.Email != "" && strings.EqualFold(r.Email, prev.rule.Email) {
+			continue
+		}
+		msg := fmt.Sprintf("uses the same key as rule id=%s (owner %s) on %s: pushes for %s and %s authenticate as the same account", prev.rule.ID, prev.rule.Owner, host, prev.rule.Owner, r.Owner)
+		if r.Email != "" && prev.rule.Email != "" {
+			msg += fmt.Sprintf(", although the rules expect different emails (%s, %s)", prev.rule.Email, r.Email)
+		} else {
+			msg += "; if that is intended, give both rules the same email"
+		}
+		issues = append(issues, ValidationIssue{Level: "warning", Field: fmt.Sprintf("rules[%d].key", i), Message: msg})
+	}
+	return issues
+}
+
+// keyIdentity names the key a rule authenticates with, so rules referencing
+// it differently (~/ or $HOME) still compare equal.
+func keyIdentity(r Rule) string {
+	switch {
+	case r.Agent != "":
+		return "agent:" + strings.TrimSpace(r.Agent)
+	case r.Key == "":
+		return ""
+	}
+	if expanded, err := ExpandPath(r.Key); err == nil {
+		return "key:" + filepath.Clean(expanded)
+	}
+	return "key:" + r.Key
+}
+
+// SharedKey is a key that rules use for unrelated hosts.
+type SharedKey struct {
+	// Fingerprint is the key's SHA256 fingerprint, or its path when the
+	// public key cannot be read.
+	Fingerprint string       `json:"fingerprint"`
+	Keys        []string     `json:"keys"`
+	Hosts       []SharedHost `json:"hosts"`
+	// rule is the index of the first rule using the key.
+	rule int
+}
+
+// SharedHost is one host a shared key is used for, with the rules using it.
+type SharedHost struct {
+	Host  string   `json:"host"`
+	Rules []string `json:"rules"`
+}
+
+// CrossHostKeys returns the keys that rules use for more than one unrelated
+// host, e.g. github.com and a client's GitLab, which many security policies
+// forbid: a key leaked from one party then opens the other. Hosts in one
+// domain (gitlab.example.com, git.example.com) and aliases of one host count
+// as related. Catch-all rules and agent fingerprints are left out.
+func CrossHostKeys(c *Config) []SharedKey {
+	type group struct {
+		key     SharedKey
+		domains map[string]bool
+	}
+	var order []string
+	groups := map[string]*group{}
+	for i, r := range c.Rules {
+		host := strings.ToLower(r.Host)
+		if canonical, ok := c.CanonicalHost(host); ok {
+			host = canonical
+		}
+		id := keyFingerprint(r)
+		if id == "" || host == "" || host == "*" {
+			continue
+		}
+		g, ok := groups[id]
+		if !ok {
+			g = &group{key: SharedKey{Fingerprint: id, rule: i}, domains: map[string]bool{}}
+			groups[id] = g
+			order = append(order, id)
+		}
+		if key := r.Key; key != "" && !slices.Contains(g.key.Keys, key) {
+			g.key.Keys = append(g.key.Keys, key)
+		}
+		g.domains[hostDomain(host)] = true
+		j := slices.IndexFunc(g.key.Hosts, func(h SharedHost) bool { return h.Host == host })
+		if j < 0 {
+			g.key.Hosts = append(g.key.Hosts, SharedHost{Host: host})
+			j = len(g.key.Hosts) - 1
+		}
+		g.key.Hosts[j].Rules = append(g.key.Hosts[j].Rules, r.ID)
+	}
+	var shared []SharedKey
+	for _, id := range order {
+		if g := groups[id]; len(g.domains) > 1 {
+			shared = append(shared, g.key)
+		}
+	}
+	return shared
+}
+
+func (k SharedKey) String() string {
+	hosts := make([]string, len(k.Hosts))
+	for i, h := range k.Hosts {
+		noun := "rule"
+		if len(h.Rules) > 1 {
+			noun = "rules"
+		}
+		hosts[i] = fmt.Sprintf("%s (%s %s)", h.Host, noun, strings.Join(h.Rules, ", "))
+	}
+	name := k.Fingerprint
+	if len(k.Keys) > 0 && k.Keys[0] != k.Fingerprint {
+		name += " (" + strings.Join(k.Keys, ", ") + ")"
+	}
+	return fmt.Sprintf("key %s is used for unrelated hosts: %s", name, strings.Join(hosts, "; "))
+}
+
+// crossHostKeyIssues warns about each key CrossHostKeys reports, on the key
+// of its first rule.
+func crossHostKeyIssues(c *Config) []ValidationIssue {
+	var issues []ValidationIssue
+	for _, k := range CrossHostKeys(c) {
+		field := fmt.Sprintf("rules[%d].key", k.rule)
+		if c.Rules[k.rule].Agent != "" {
+			field = fmt.Sprintf("rules[%d].agent", k.rule)
+		}
+		issues = append(issues, ValidationIssue{Level: "warning", Field: field, Message: k.String() + "; use a separate key per host"})
+	}
+	return issues
+}
+
+// keyFingerprint identifies the key a rule authenticates with by its
+// fingerprint, so copies of a key and agent entries for it compare equal.
+// It falls back to keyIdentity when the public key cannot be read.
+func keyFingerprint(r Rule) string {
+	switch {
+	case r.Agent != "":
+		if id, err := sshkeys.ParsePublicKeyLine(r.Agent); err == nil {
+			return id.Fingerprint
+		}
+		return strings.TrimSpace(r.Agent)
+	case r.Key == "":
+		return ""
+	case !sshkeys.IsProviderRef(r.Key):
+		if path, err := ExpandPath(r.Key); err == nil {
+			if id, err := sshkeys.InspectKey(path); err == nil {
+				return id.Fingerprint
+			}
+		}
+	}
+	return strings.TrimPrefix(keyIdentity(r), "key:")
+}
+
+// hostDomain reduces a host or host pattern to the domain it belongs to:
+// its last two labels, without wildcard labels. Azure DevOps' old and new
+// ssh hosts map to one domain.
+func hostDomain(host string) string {
+	host = strings.TrimSuffix(host, ".")
+	if net.ParseIP(strings.Trim(host, "[]")) != nil {
+		return host
+	}
+	labels := strings.Split(host, ".")
+	for len(labels) > 1 && hasWildcard(labels[0]) {
+		labels = labels[1:]
+	}
+	if len(labels) > 2 {
+		labels = labels[len(labels)-2:]
+	}
+	domain := strings.Join(labels, ".")
+	if domain == "visualstudio.com" {
+		return "azure.com"
+	}
+	return domain
+}
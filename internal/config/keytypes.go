@@ -0,0 +1,116 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pavelBuzdanov/mgit/internal/sshkeys"
+)
+
+// minRSABits is the RSA key size below which keys are weak even without
+// requireKeyTypes, as DSA keys always are.
+const minRSABits = 2048
+
+// keyTypeNames are the key types requireKeyTypes accepts.
+var keyTypeNames = []string{"ed25519", "ed25519-sk", "ecdsa", "ecdsa-sk", "rsa", "dsa"}
+
+// parseKeyTypeSpec splits a requireKeyTypes entry, "ed25519" or "rsa:3072"
+// for RSA keys of at least 3072 bits, into type and minimum size.
+func parseKeyTypeSpec(spec string) (string, int, error) {
+	name, bits, sized := strings.Cut(strings.ToLower(strings.TrimSpace(spec)), ":")
+	if !slices.Contains(keyTypeNames, name) {
+		return "", 0, fmt.Errorf("unknown key type %q (known: %s)", spec, strings.Join(keyTypeNames, ", "))
+	}
+	if !sized {
+		return name, 0, nil
+	}
+	n, err := strconv.Atoi(bits)
+	if err != nil || n <= 0 {
+		return "", 0, fmt.Errorf("invalid minimum key size in %q", spec)
+	}
+	return name, n, nil
+}
+
+// KeyTypeIssue checks the key id against requireKeyTypes: a key of a type
+// it does not list, or smaller than the size it asks for, is an error.
+// Without requireKeyTypes, DSA keys and RSA keys under 2048 bits are a
+// warning. It returns "" for a key that is fine.
+func KeyTypeIssue(c *Config, id sshkeys.AgentIdentity) (level, message string) {
+	return KeyTypeNameIssue(c, sshkeys.TypeName(id.Type), id.Bits)
+}
+
+// KeyTypeNameIssue is KeyTypeIssue for a key of type name, as ssh-keygen -t
+// spells it, and bits, 0 when unknown.
+func KeyTypeNameIssue(c *Config, name string, bits int) (level, message string) {
+	desc := name
+	if bits > 0 {
+		desc = fmt.Sprintf("%s-%d", name, bits)
+	}
+	if len(c.RequireKeyTypes) == 0 {
+		if name == "dsa" || name == "rsa" && bits > 0 && bits < minRSABits {
+			return "warning", fmt.Sprintf("%s key is weak; replace it with an ed25519 key (mgit key rotate)", desc)
+		}
+		return "", ""
+	}
+	for _, spec := range c.RequireKeyTypes {
+		want, min, err := parseKeyTypeSpec(spec)
+		if err != nil || want != name {
+			continue
+		}
+		// A size that could not be read is not held against the key.
+		if min == 0 || bits == 0 || bits >= min {
+			return "", ""
+		}
+	}
+	return "error", fmt.Sprintf("%s key is not allowed by requireKeyTypes (%s)", desc, strings.Join(c.RequireKeyTypes, ", "))
+}
+
+// RuleKeyTypeIssue is KeyTypeIssue for the key of rule r: its key file, or
+// its agent identity when given as a public key line. Keys mgit cannot
+// inspect, such as missing files, provider keys and agent fingerprints, are
+// not reported here.
+func RuleKeyTypeIssue(c *Config, r Rule) (level, message string) {
+	var id sshkeys.AgentIdentity
+	var err error
+	switch {
+	case r.Agent != "":
+		id, err = sshkeys.ParsePublicKeyLine(r.Agent)
+	case r.Key != "" && !sshkeys.IsProviderRef(r.Key):
+		var path string
+		if path, err = ExpandPath(r.Key); err == nil {
+			id, err = sshkeys.InspectKey(path)
+		}
+	default:
+		return "", ""
+	}
+	if err != nil {
+		return "", ""
+	}
+	return KeyTypeIssue(c, id)
+}
+
+func keyTypeIssues(c *Config) []ValidationIssue {
+	var issues []ValidationIssue
+	for i, spec := range c.RequireKeyTypes {
+		if _, _, err := parseKeyTypeSpec(spec); err != nil {
+			issues = append(issues, ValidationIssue{Level: "error", Field: fmt.Sprintf("requireKeyTypes[%d]", i), Message: err.Error()})
+		}
+	}
+	for i, r := range c.Rules {
+		field := fmt.Sprintf("rules[%d].key", i)
+		if r.Agent != "" {
+			field = fmt.Sprintf("rules[%d].agent", i)
+		}
+		if level, msg := RuleKeyTypeIssue(c, r); level != "" {
+			issues = append(issues, ValidationIssue{Level: level, Field: field, Message: msg})
+		}
+	}
+	if def, ok := DefaultRule(c); ok {
+		if level, msg := RuleKeyTypeIssue(c, def); level != "" {
+			issues = append(issues, ValidationIssue{Level: level, Field: "defaultKey", Message: msg})
+		}
+	}
+	return issues
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pavelBuzdanov/mgit/internal/sshkeys"
+)
+
+// KnownHostsPath is the known_hosts file `mgit knownhosts add` maintains,
+// next to the global config. Generated ssh commands check host keys
+// against it in addition to the user's own known_hosts files.
+func KnownHostsPath() (string, error) {
+	global, err := GlobalDefaultPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(global), "known_hosts"), nil
+}
+
+// KnownHostsFiles are the files mgit's ssh commands check host keys
+// against: sshkeys.KnownHostsFiles and KnownHostsPath.
+func KnownHostsFiles() []string {
+	files := sshkeys.KnownHostsFiles()
+	if path, err := KnownHostsPath(); err == nil {
+		files = append(files, path)
+	}
+	return files
+}
+
+// KnownHostsOption is the ssh -o option that adds KnownHostsPath to the
+// user's known_hosts files, or "" while there is no such file. The user's
+// files come first, so ssh keeps recording newly accepted hosts there.
+func KnownHostsOption() string {
+	path, err := KnownHostsPath()
+	if err != nil {
+		return ""
+	}
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	if strings.ContainsAny(path, " \t") {
+		path = `"` + path + `"`
+	}
+	return "UserKnownHostsFile=~/.ssh/known_hosts ~/.ssh/known_hosts2 " + path
+}
+
+// ReadKnownHosts returns the entries of the known_hosts file at path; a
+// missing file has none.
+func ReadKnownHosts(path string) ([]sshkeys.HostKey, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return sshkeys.ParseHostKeys(string(data)), nil
+}
+
+// SetKnownHostKeys replaces the entries for host name in the known_hosts
+// file at path with keys, creating the file when needed.
+func SetKnownHostKeys(path, name string, keys []sshkeys.HostKey) error {
+	existing, err := ReadKnownHosts(path)
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	b.WriteString("# Managed by mgit knownhosts; entries are replaced by `mgit knownhosts add`.\n")
+	for _, k := range existing {
+		if k.Host != name {
+			b.WriteString(k.Line() + "\n")
+		}
+	}
+	for _, k := range keys {
+		k.Host = name
+		b.WriteString(k.Line() + "\n")
+	}
+	return writeFileAtomic(path, []byte(b.String()))
+}
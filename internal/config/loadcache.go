@@ -0,0 +1,179 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// LoadCacheEnv opts in to the on-disk load cache: when set to 1, Load keeps
+// the parsed config in the user's cache directory, so quick successive
+// invocations (a shell prompt, an editor integration) skip parsing it.
+const LoadCacheEnv = "MGIT_LOAD_CACHE"
+
+// loadStamp identifies one version of a config file. Size and modification
+// time alone miss a same-size rewrite within the file system's timestamp
+// granularity, so the inode (replaced by every atomic save) and the change
+// time are part of it where the platform reports them.
+type loadStamp struct {
+	Size       int64  `json:"size"`
+	ModTime    int64  `json:"mtime"`
+	Inode      uint64 `json:"inode,omitempty"`
+	ChangeTime int64  `json:"ctime,omitempty"`
+}
+
+func stampOf(st os.FileInfo) loadStamp {
+	s := loadStamp{Size: st.Size(), ModTime: st.ModTime().UnixNano()}
+	s.Inode, s.ChangeTime = fileIdentity(st)
+	return s
+}
+
+// loaded is a parsed config file as it was when Load last read it.
+type loaded struct {
+	stamp loadStamp
+	cfg   *Config
+}
+
+// loadedConfigs caches Load by resolved path, so the handlers of one process
+// (and the checks of one doctor run) parse the config once. An entry is used
+// only while the file keeps its stamp; writeAtomic drops it for writes made
+// through mgit.
+var loadedConfigs = struct {
+	sync.Mutex
+	byPath map[string]loaded
+}{byPath: map[string]loaded{}}
+
+// cachedLoad returns a copy of the config cached for resolved when the file
+// still has stamp.
+func cachedLoad(resolved string, stamp loadStamp) (*Config, bool) {
+	loadedConfigs.Lock()
+	defer loadedConfigs.Unlock()
+	e, ok := loadedConfigs.byPath[resolved]
+	if !ok || e.stamp != stamp {
+		return nil, false
+	}
+	return clone(e.cfg), true
+}
+
+func storeLoaded(resolved string, stamp loadStamp, cfg *Config) {
+	loadedConfigs.Lock()
+	defer loadedConfigs.Unlock()
+	loadedConfigs.byPath[resolved] = loaded{stamp: stamp, cfg: clone(cfg)}
+}
+
+// forgetLoaded drops both caches of the config at resolved.
+func forgetLoaded(resolved string) {
+	loadedConfigs.Lock()
+	delete(loadedConfigs.byPath, resolved)
+	loadedConfigs.Unlock()
+	if file := diskCachePath(resolved); file != "" {
+		_ = os.Remove(file)
+	}
+}
+
+// diskLoaded is the content of a disk cache file (see diskCachePath): the
+// normalized config of the file at Path as it was at Stamp.
+type diskLoaded struct {
+	Path   string    `json:"path"`
+	Stamp  loadStamp `json:"stamp"`
+	Config *Config   `json:"config"`
+}
+
+func diskCacheEnabled() bool {
+	return strings.TrimSpace(os.Getenv(LoadCacheEnv)) == "1"
+}
+
+// diskCachePath is where the parsed config at resolved is cached:
+// mgit/load-cache/<hash of the path>.json in the user's cache directory.
+func diskCachePath(resolved string) string {
+	return userCacheFile("load-cache", resolved)
+}
+
+// userCacheFile is the file caching something about the config at path:
+// mgit/<kind>/<hash of the path>.json in the user's cache directory, never
+// next to the config, where a repository could ship one. It is "" when
+// there is no cache directory.
+func userCacheFile(kind, path string) string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	sum := sha256.Sum256([]byte(path))
+	return filepath.Join(dir, "mgit", kind, hex.EncodeToString(sum[:16])+".json")
+}
+
+// diskCachedLoad returns the config cached on disk for resolved when the file
+// still has stamp. A missing, unreadable or stale cache is a miss.
+func diskCachedLoad(resolved string, stamp loadStamp) (*Config, bool) {
+	file := diskCachePath(resolved)
+	if !diskCacheEnabled() || file == "" {
+		return nil, false
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, false
+	}
+	var e diskLoaded
+	if err := json.Unmarshal(data, &e); err != nil || e.Path != resolved || e.Stamp != stamp || e.Config == nil {
+		return nil, false
+	}
+	return e.Config, true
+}
+
+// storeDiskLoaded writes the disk cache of resolved. It only ever saves
+// work, so errors are ignored.
+func storeDiskLoaded(resolved string, stamp loadStamp, cfg *Config) {
+	file := diskCachePath(resolved)
+	if !diskCacheEnabled() || file == "" {
+		return
+	}
+	data, err := json.Marshal(diskLoaded{Path: resolved, Stamp: stamp, Config: cfg})
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0o700); err != nil {
+		return
+	}
+	_ = writeFileAtomic(file, data)
+}
+
+// clone returns a deep copy of c: callers of Load change the config they get
+// (Normalize, AddRule, --strict), which must not reach the cached one.
+func clone(c *Config) *Config {
+	out := *c
+	out.Rules = slices.Clone(c.Rules)
+	for i := range out.Rules {
+		out.Rules[i].Tags = slices.Clone(out.Rules[i].Tags)
+		out.Rules[i].Env = maps.Clone(out.Rules[i].Env)
+	}
+	out.HostAliases = maps.Clone(c.HostAliases)
+	out.HostDefaults = slices.Clone(c.HostDefaults)
+	for i := range out.HostDefaults {
+		out.HostDefaults[i].Options = slices.Clone(out.HostDefaults[i].Options)
+	}
+	out.AllowedGitCommands = slices.Clone(c.AllowedGitCommands)
+	out.DeniedGitCommands = slices.Clone(c.DeniedGitCommands)
+	out.RequireKeyTypes = slices.Clone(c.RequireKeyTypes)
+	out.Policy = slices.Clone(c.Policy)
+	for i := range out.Policy {
+		if m := out.Policy[i].Deny; m != nil {
+			deny := *m
+			deny.Commands = slices.Clone(m.Commands)
+			out.Policy[i].Deny = &deny
+		}
+	}
+	if c.Pin != nil {
+		pin := *c.Pin
+		out.Pin = &pin
+	}
+	return &out
+}
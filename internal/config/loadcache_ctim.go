@@ -0,0 +1,17 @@
+//go:build linux || openbsd || dragonfly || solaris
+
+package config
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileIdentity returns the inode and change time of the file st describes.
+func fileIdentity(st os.FileInfo) (uint64, int64) {
+	sys, ok := st.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0
+	}
+	return uint64(sys.Ino), sys.Ctim.Nano()
+}
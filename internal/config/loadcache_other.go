@@ -0,0 +1,12 @@
+//go:build !(linux || openbsd || dragonfly || solaris || darwin || freebsd || netbsd)
+
+package config
+
+import "os"
+
+// fileIdentity reports no inode or change time: Windows has neither in
+// os.FileInfo, and the load caches fall back to size and modification time,
+// which NTFS keeps to 100ns.
+func fileIdentity(os.FileInfo) (uint64, int64) {
+	return 0, 0
+}
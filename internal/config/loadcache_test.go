@@ -0,0 +1,228 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadCachesUntilFileChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"version":1,"rules":[{"host":"github.com","owner":"me","key":"/k","tags":["work"]}]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	first, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.Rules[0].Tags[0] = "changed"
+	first.Rules = append(first.Rules, Rule{Host: "gitlab.com", Owner: "*", Key: "/k2"})
+
+	second, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(second.Rules) != 1 || second.Rules[0].Tags[0] != "work" {
+		t.Fatalf("cached config was changed through an earlier Load: %+v", second.Rules)
+	}
+
+	// Same size, later mtime: an edit made outside mgit.
+	if err := os.WriteFile(path, []byte(`{"version":1,"rules":[{"host":"gitlab.com","owner":"me","key":"/k","tags":["work"]}]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	third, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if third.Rules[0].Host != "gitlab.com" {
+		t.Fatalf("Load returned a stale config after the file changed: %+v", third.Rules)
+	}
+
+	third.Rules[0].Owner = "team"
+	if err := Save(path, third); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	fourth, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fourth.Rules[0].Owner != "team" {
+		t.Fatalf("Load returned a stale config after Save: %+v", fourth.Rules)
+	}
+}
+
+func TestLoadCacheSeesSameSizeRewriteWithSameMtime(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"version":1,"rules":[{"host":"github.com","owner":"me","key":"/k"}]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	st, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inode, ctime := fileIdentity(st); inode == 0 && ctime == 0 {
+		t.Skip("no inode or change time on this platform")
+	}
+	if _, err := Load(path); err != nil {
+		t.Fatal(err)
+	}
+	// Rewritten in place within the timestamp granularity: same size and,
+	// after the reset, the same mtime; only the change time moves.
+	time.Sleep(10 * time.Millisecond)
+	if err := os.WriteFile(path, []byte(`{"version":1,"rules":[{"host":"gitlab.com","owner":"me","key":"/k"}]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, st.ModTime(), st.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Rules[0].Host != "gitlab.com" {
+		t.Fatalf("Load returned a stale config after a same-size rewrite: %+v", cfg.Rules)
+	}
+}
+
+func TestLoadDiskCache(t *testing.T) {
+	cache := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", cache)
+	t.Setenv("HOME", cache)
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"version":1,"rules":[{"host":"github.com","owner":"me","key":"/k"}]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	forgetMemory := func() {
+		loadedConfigs.Lock()
+		delete(loadedConfigs.byPath, path)
+		loadedConfigs.Unlock()
+	}
+
+	if _, err := Load(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(diskCachePath(path)); !os.IsNotExist(err) {
+		t.Fatalf("disk cache written without %s: %v", LoadCacheEnv, err)
+	}
+
+	t.Setenv(LoadCacheEnv, "1")
+	forgetMemory()
+	if _, err := Load(path); err != nil {
+		t.Fatal(err)
+	}
+	// Mark the cached copy, so a later Load shows where it came from.
+	data, err := os.ReadFile(diskCachePath(path))
+	if err != nil {
+		t.Fatalf("disk cache not written: %v", err)
+	}
+	if !strings.HasPrefix(diskCachePath(path), cache) {
+		t.Fatalf("disk cache %s outside the user cache dir %s", diskCachePath(path), cache)
+	}
+	var e diskLoaded
+	if err := json.Unmarshal(data, &e); err != nil {
+		t.Fatal(err)
+	}
+	e.Config.Rules[0].Owner = "from-disk"
+	if data, err = json.Marshal(e); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(diskCachePath(path), data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	forgetMemory()
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Rules[0].Owner != "from-disk" {
+		t.Fatalf("Load did not use the disk cache: %+v", cfg.Rules)
+	}
+
+	cfg.Rules[0].Owner = "team"
+	if err := Save(path, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(diskCachePath(path)); !os.IsNotExist(err) {
+		t.Fatalf("disk cache kept after Save: %v", err)
+	}
+	forgetMemory()
+	if cfg, err = Load(path); err != nil || cfg.Rules[0].Owner != "team" {
+		t.Fatalf("Load after Save = %+v, %v", cfg, err)
+	}
+}
+
+// TestCloneSharesNothing fills every field of a Config and checks that no
+// slice, map or pointer of the clone aliases the original, so fields added
+// later can't leak changes into the Load cache unnoticed.
+func TestCloneSharesNothing(t *testing.T) {
+	var cfg Config
+	fill(reflect.ValueOf(&cfg).Elem())
+	cp := clone(&cfg)
+	if !reflect.DeepEqual(&cfg, cp) {
+		t.Fatalf("clone differs from the original:\n%+v\n%+v", cfg, *cp)
+	}
+	assertNoAlias(t, "Config", reflect.ValueOf(cfg), reflect.ValueOf(*cp))
+}
+
+func fill(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString("x")
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Int:
+		v.SetInt(1)
+	case reflect.Pointer:
+		v.Set(reflect.New(v.Type().Elem()))
+		fill(v.Elem())
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(v.Type(), 1, 1))
+		fill(v.Index(0))
+	case reflect.Map:
+		v.Set(reflect.MakeMap(v.Type()))
+		elem := reflect.New(v.Type().Elem()).Elem()
+		fill(elem)
+		v.SetMapIndex(reflect.ValueOf("k"), elem)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				fill(v.Field(i))
+			}
+		}
+	}
+}
+
+func assertNoAlias(t *testing.T, path string, a, b reflect.Value) {
+	t.Helper()
+	switch a.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Map:
+		if !a.IsNil() && a.UnsafePointer() == b.UnsafePointer() {
+			t.Errorf("%s is shared between a config and its clone", path)
+		}
+	}
+	switch a.Kind() {
+	case reflect.Pointer:
+		if !a.IsNil() {
+			assertNoAlias(t, path, a.Elem(), b.Elem())
+		}
+	case reflect.Slice:
+		for i := 0; i < a.Len(); i++ {
+			assertNoAlias(t, path+"[]", a.Index(i), b.Index(i))
+		}
+	case reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			assertNoAlias(t, path+"."+a.Type().Field(i).Name, a.Field(i), b.Field(i))
+		}
+	}
+}
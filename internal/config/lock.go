@@ -0,0 +1,100 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Lock waits and stale thresholds. mgit holds the lock for milliseconds, so
+// a lock file older than lockStaleAfter belongs to a process that died.
+var (
+	lockWait       = 10 * time.Second
+	lockStaleAfter = 30 * time.Second
+	lockRetry      = 25 * time.Millisecond
+)
+
+// LockPath is the advisory lock file guarding the config at path.
+func LockPath(path string) string {
+	return path + ".lock"
+}
+
+// Lock takes the advisory lock for the config at path, waiting for other
+// mgit processes to release it. The lock is a file created exclusively next
+// to the config, which works the same on every platform and filesystem.
+func Lock(path string) (unlock func(), err error) {
+	resolved, err := ResolvePath(path)
+	if err != nil {
+		return nil, err
+	}
+	if IsEnvSource(resolved) {
+		return nil, ErrEnvSource
+	}
+	if err := os.MkdirAll(filepath.Dir(resolved), 0o755); err != nil {
+		return nil, fmt.Errorf("create config directory: %w", err)
+	}
+	lockPath := LockPath(resolved)
+	deadline := time.Now().Add(lockWait)
+	for {
+		f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err == nil {
+			_, _ = f.WriteString(strconv.Itoa(os.Getpid()) + "\n")
+			_ = f.Close()
+			return func() { _ = os.Remove(lockPath) }, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, fmt.Errorf("lock config: %w", err)
+		}
+		if info, statErr := os.Stat(lockPath); statErr == nil && time.Since(info.ModTime()) > lockStaleAfter {
+			breakStaleLock(lockPath)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("config %s is locked by another mgit process (remove %s if no mgit is running)", resolved, lockPath)
+		}
+		time.Sleep(lockRetry)
+	}
+}
+
+// breakStaleLock removes the stale lock file at lockPath. Another process may
+// have broken it and taken the lock since it was seen stale, so the file is
+// first moved aside under a name of its own and checked again: a lock that
+// turns out to be fresh is put back rather than removed.
+func breakStaleLock(lockPath string) {
+	aside := fmt.Sprintf("%s.stale.%d.%d", lockPath, os.Getpid(), time.Now().UnixNano())
+	if err := os.Rename(lockPath, aside); err != nil {
+		return
+	}
+	if info, err := os.Stat(aside); err == nil && time.Since(info.ModTime()) <= lockStaleAfter {
+		// Link does not replace a lock taken in the meantime.
+		_ = os.Link(aside, lockPath)
+	}
+	_ = os.Remove(aside)
+}
+
+// Update applies fn to the config at path and saves the result while holding
+// the config lock, so concurrent read-modify-write commands don't lose each
+// other's changes. A missing config starts out empty. Nothing is written
+// when fn fails.
+func Update(path string, fn func(cfg *Config) error) error {
+	unlock, err := Lock(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	cfg, err := Load(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		cfg, err = &Config{Version: CurrentVersion, Rules: []Rule{}}, nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := fn(cfg); err != nil {
+		return err
+	}
+	return writeAtomic(path, cfg)
+}
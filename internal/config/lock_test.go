@@ -0,0 +1,147 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestUpdateConcurrentAddsAllPersist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".mgit", "config.json")
+	const n = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- Update(path, func(cfg *Config) error {
+				return AddRule(cfg, Rule{Host: "github.com", Owner: fmt.Sprintf("org%d", i), Key: "/tmp/key"}, false)
+			})
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Update() error = %v", err)
+		}
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(cfg.Rules) != n {
+		t.Fatalf("got %d rules, want %d", len(cfg.Rules), n)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	for _, e := range entries {
+		if !e.IsDir() && e.Name() != "config.json" {
+			t.Fatalf("leftover file next to config: %s", e.Name())
+		}
+	}
+}
+
+func TestLockTakesOverStaleLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(LockPath(path), []byte("999999\n"), 0o600); err != nil {
+		t.Fatalf("write lock: %v", err)
+	}
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(LockPath(path), old, old); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+	unlock, err := Lock(path)
+	if err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+	unlock()
+	if _, err := os.Stat(LockPath(path)); !os.IsNotExist(err) {
+		t.Fatalf("lock file left behind: %v", err)
+	}
+}
+
+func TestLockTimesOutWhileHeld(t *testing.T) {
+	defer func(w time.Duration) { lockWait = w }(lockWait)
+	lockWait = 50 * time.Millisecond
+	path := filepath.Join(t.TempDir(), "config.json")
+	unlock, err := Lock(path)
+	if err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+	defer unlock()
+	if _, err := Lock(path); err == nil {
+		t.Fatalf("second Lock() should time out")
+	}
+	if err := Update(path, func(*Config) error { return nil }); err == nil {
+		t.Fatalf("Update() should fail while the lock is held")
+	}
+}
+
+func TestLockStaleTakeoverAdmitsOneHolder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(LockPath(path), []byte("999999\n"), 0o600); err != nil {
+		t.Fatalf("write lock: %v", err)
+	}
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(LockPath(path), old, old); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+	const n = 16
+	var (
+		wg      sync.WaitGroup
+		holders atomic.Int32
+		start   = make(chan struct{})
+		errs    = make(chan error, n)
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			unlock, err := Lock(path)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if h := holders.Add(1); h != 1 {
+				errs <- fmt.Errorf("%d processes hold the lock", h)
+			}
+			time.Sleep(time.Millisecond)
+			holders.Add(-1)
+			unlock()
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	for _, e := range entries {
+		t.Errorf("leftover file next to config: %s", e.Name())
+	}
+}
+
+// TestBreakStaleLockKeepsFreshLock covers the lock being broken and taken by
+// another process between the stale check and breakStaleLock.
+func TestBreakStaleLockKeepsFreshLock(t *testing.T) {
+	lockPath := LockPath(filepath.Join(t.TempDir(), "config.json"))
+	if err := os.WriteFile(lockPath, []byte("1\n"), 0o600); err != nil {
+		t.Fatalf("write lock: %v", err)
+	}
+	breakStaleLock(lockPath)
+	data, err := os.ReadFile(lockPath)
+	if err != nil || string(data) != "1\n" {
+		t.Fatalf("fresh lock was not kept: %q, %v", data, err)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(lockPath))
+	if len(entries) != 1 {
+		t.Fatalf("files next to config = %d, want only the lock", len(entries))
+	}
+}
@@ -0,0 +1,241 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Get returns the value at key, a path of JSON field names and [N] indexes
+// such as rules[2].priority. A rule may also be addressed by ID: rules[work].
+// Everything after a map field names one of its entries, e.g.
+// hostAliases.github-work or rules[0].env.FOO. It returns the canonical path,
+// with rule IDs replaced by indexes.
+func Get(c *Config, key string) (any, string, error) {
+	s, err := lookup(c, key, false)
+	if err != nil {
+		return nil, "", err
+	}
+	return s.v.Interface(), s.canon, nil
+}
+
+// Set parses value according to the type of the field at key and stores it.
+// Strings are taken as is, numbers and booleans are parsed, string lists
+// accept a comma-separated list or a JSON array, and rules or whole lists
+// take JSON. Unset objects on the way, such as pin in pin.rule, are created,
+// and an empty value removes a map entry. It returns the canonical path of
+// the field.
+func Set(c *Config, key, value string) (string, error) {
+	s, err := lookup(c, key, true)
+	if err != nil {
+		return "", err
+	}
+	v, canon := s.v, s.canon
+	switch {
+	case v.Kind() == reflect.String:
+		v.SetString(value)
+	case v.Kind() == reflect.Int:
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return "", fmt.Errorf("%s: expected an integer, got %q", canon, value)
+		}
+		v.SetInt(int64(n))
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return "", fmt.Errorf("%s: expected true or false, got %q", canon, value)
+		}
+		v.SetBool(b)
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String && !strings.HasPrefix(strings.TrimSpace(value), "["):
+		v.Set(reflect.ValueOf(ParseTags(value)))
+	default:
+		if strings.TrimSpace(value) == "null" && s.required {
+			return "", fmt.Errorf("%s is required and cannot be null", canon)
+		}
+		ptr := reflect.New(v.Type())
+		if err := json.Unmarshal([]byte(value), ptr.Interface()); err != nil {
+			return "", fmt.Errorf("%s: expected JSON for %s: %v", canon, describeType(v.Type()), err)
+		}
+		v.Set(ptr.Elem())
+	}
+	s.store()
+	c.Normalize()
+	return canon, nil
+}
+
+// slot is the value lookup found. Map entries can't be set in place, so for
+// them v is a copy that store writes back into m. required is set for fields
+// the config always carries (no omitempty), such as version and rules.
+type slot struct {
+	v        reflect.Value
+	canon    string
+	m        reflect.Value
+	key      reflect.Value
+	required bool
+}
+
+func (s slot) store() {
+	if !s.m.IsValid() {
+		return
+	}
+	if s.v.IsZero() {
+		s.m.SetMapIndex(s.key, reflect.Value{})
+		return
+	}
+	s.m.SetMapIndex(s.key, s.v)
+}
+
+// lookup walks key through c. With alloc, nil pointers and maps on the way
+// are created and a missing map entry is not an error, so Set can fill them.
+func lookup(c *Config, key string, alloc bool) (slot, error) {
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return slot{}, fmt.Errorf("empty config key")
+	}
+	v := reflect.ValueOf(c).Elem()
+	var canon strings.Builder
+	required := false
+	parts := strings.Split(key, ".")
+	for n, part := range parts {
+		if v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				if !alloc {
+					return slot{}, fmt.Errorf("%s is not set", canon.String())
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		if v.Kind() == reflect.Map {
+			// Map keys (host names) may contain dots themselves.
+			return mapEntry(v, strings.Join(parts[n:], "."), canon.String(), alloc)
+		}
+		name, rest, indexed := strings.Cut(part, "[")
+		if indexed && rest == "" {
+			return slot{}, fmt.Errorf("invalid config key %q", key)
+		}
+		if name != "" {
+			field, ok, req := fieldByJSONName(v, name)
+			if !ok {
+				return slot{}, fmt.Errorf("unknown config key %q (valid keys under %s: %s)", canon.String()+dot(canon.Len())+name, keyScope(canon.String()), strings.Join(jsonNames(v), ", "))
+			}
+			v, required = field, req
+			canon.WriteString(dot(canon.Len()) + name)
+		} else if rest == "" || canon.Len() == 0 {
+			return slot{}, fmt.Errorf("invalid config key %q", key)
+		}
+		for rest != "" {
+			idx, after, ok := strings.Cut(rest, "]")
+			if !ok || (after != "" && !strings.HasPrefix(after, "[")) {
+				return slot{}, fmt.Errorf("invalid config key %q", key)
+			}
+			rest = strings.TrimPrefix(after, "[")
+			if v.Kind() != reflect.Slice {
+				return slot{}, fmt.Errorf("%s is not a list", canon.String())
+			}
+			i, err := sliceIndex(v, idx)
+			if err != nil {
+				return slot{}, fmt.Errorf("%s: %w", canon.String(), err)
+			}
+			v, required = v.Index(i), true
+			fmt.Fprintf(&canon, "[%d]", i)
+		}
+	}
+	return slot{v: v, canon: canon.String(), required: required}, nil
+}
+
+// mapEntry is the slot for the entry k of the map m, found at canon.
+func mapEntry(m reflect.Value, k, canon string, alloc bool) (slot, error) {
+	if k == "" {
+		return slot{}, fmt.Errorf("%s: missing entry name", canon)
+	}
+	key := reflect.ValueOf(k)
+	s := slot{v: reflect.New(m.Type().Elem()).Elem(), canon: canon + "." + k, m: m, key: key}
+	if cur := m.MapIndex(key); cur.IsValid() {
+		s.v.Set(cur)
+	} else if !alloc {
+		return slot{}, fmt.Errorf("%s: no entry %q", canon, k)
+	}
+	if m.IsNil() {
+		m.Set(reflect.MakeMap(m.Type()))
+	}
+	return s, nil
+}
+
+// sliceIndex resolves a 0-based index, or a rule ID for the rules list.
+func sliceIndex(v reflect.Value, idx string) (int, error) {
+	if i, err := strconv.Atoi(idx); err == nil {
+		if i < 0 || i >= v.Len() {
+			return 0, fmt.Errorf("index %d out of range (%d entries)", i, v.Len())
+		}
+		return i, nil
+	}
+	if rules, ok := v.Interface().([]Rule); ok {
+		for i, r := range rules {
+			if r.ID == idx {
+				return i, nil
+			}
+		}
+		return 0, fmt.Errorf("no rule with id %q", idx)
+	}
+	return 0, fmt.Errorf("invalid index %q", idx)
+}
+
+// fieldByJSONName finds the struct field with the given JSON name and
+// reports whether it is required, i.e. not omitempty.
+func fieldByJSONName(v reflect.Value, name string) (reflect.Value, bool, bool) {
+	if v.Kind() != reflect.Struct {
+		return reflect.Value{}, false, false
+	}
+	for i := 0; i < v.NumField(); i++ {
+		if f := v.Type().Field(i); jsonName(f) == name {
+			return v.Field(i), true, !strings.Contains(f.Tag.Get("json"), ",omitempty")
+		}
+	}
+	return reflect.Value{}, false, false
+}
+
+func jsonNames(v reflect.Value) []string {
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	names := make([]string, 0, v.NumField())
+	for i := 0; i < v.NumField(); i++ {
+		names = append(names, jsonName(v.Type().Field(i)))
+	}
+	return names
+}
+
+func jsonName(f reflect.StructField) string {
+	return strings.Split(f.Tag.Get("json"), ",")[0]
+}
+
+func describeType(t reflect.Type) string {
+	switch {
+	case t == reflect.TypeOf(Rule{}):
+		return "a rule object"
+	case t == reflect.TypeOf(HostDefault{}):
+		return "a host defaults object"
+	case t.Kind() == reflect.Slice:
+		return "a list"
+	case t.Kind() == reflect.Map:
+		return "an object"
+	}
+	return t.Kind().String()
+}
+
+func dot(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return "."
+}
+
+func keyScope(prefix string) string {
+	if prefix == "" {
+		return "the config"
+	}
+	return prefix
+}
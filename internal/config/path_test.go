@@ -0,0 +1,95 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConfigGetSet(t *testing.T) {
+	cfg := &Config{Version: 1, Rules: []Rule{
+		{ID: "work", Host: "github.com", Owner: "CompanyOrg", Key: "/k/work"},
+		{ID: "home", Host: "github.com", Owner: "me", Key: "/k/home"},
+	}}
+	if v, canon, err := Get(cfg, "rules[work].owner"); err != nil || v != "CompanyOrg" || canon != "rules[0].owner" {
+		t.Fatalf("Get(rules[work].owner) = %v, %q, %v", v, canon, err)
+	}
+	if _, err := Set(cfg, "rules[1].priority", "10"); err != nil || cfg.Rules[1].Priority != 10 {
+		t.Fatalf("Set(priority) err=%v rule=%+v", err, cfg.Rules[1])
+	}
+	if _, err := Set(cfg, "rules[1].priority", "high"); err == nil || !strings.Contains(err.Error(), "expected an integer") {
+		t.Fatalf("Set(priority, high) error = %v", err)
+	}
+	if _, err := Set(cfg, "stats", "true"); err != nil || !cfg.Stats {
+		t.Fatalf("Set(stats) err=%v stats=%v", err, cfg.Stats)
+	}
+	if _, err := Set(cfg, "rules[0].tags", "a, b"); err != nil || len(cfg.Rules[0].Tags) != 2 {
+		t.Fatalf("Set(tags) err=%v tags=%v", err, cfg.Rules[0].Tags)
+	}
+	if _, err := Set(cfg, "rules[0].tags", `["x"]`); err != nil || len(cfg.Rules[0].Tags) != 1 {
+		t.Fatalf("Set(tags JSON) err=%v tags=%v", err, cfg.Rules[0].Tags)
+	}
+	if _, err := Set(cfg, "rules[1]", `{"id":"home","host":"gitlab.com","owner":"me","key":"/k/home"}`); err != nil || cfg.Rules[1].Host != "gitlab.com" {
+		t.Fatalf("Set(rule JSON) err=%v rule=%+v", err, cfg.Rules[1])
+	}
+	for key, want := range map[string]string{
+		"defaults.strict": `unknown config key "defaults"`,
+		"rules[5].key":    "out of range",
+		"rules[nope].key": `no rule with id "nope"`,
+		"rules[0].hostx":  "valid keys under rules[0]: id, host",
+		"version[0]":      "version is not a list",
+		"rules[0":         "invalid config key",
+		"rules[":          "invalid config key",
+		"rules[0].key[":   "invalid config key",
+	} {
+		if _, _, err := Get(cfg, key); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("Get(%q) error = %v, want %q", key, err, want)
+		}
+	}
+}
+
+func TestConfigGetSetPointersAndMaps(t *testing.T) {
+	cfg := &Config{Version: 1, Rules: []Rule{{ID: "work", Host: "github.com", Owner: "CompanyOrg", Key: "/k/work"}}}
+	if _, _, err := Get(cfg, "pin.rule"); err == nil || !strings.Contains(err.Error(), "pin is not set") {
+		t.Fatalf("Get(pin.rule) on an unpinned config error = %v", err)
+	}
+	if _, err := Set(cfg, "pin.rule", "work"); err != nil || cfg.Pin == nil || cfg.Pin.Rule != "work" {
+		t.Fatalf("Set(pin.rule) err=%v pin=%+v", err, cfg.Pin)
+	}
+	if v, _, err := Get(cfg, "pin.rule"); err != nil || v != "work" {
+		t.Fatalf("Get(pin.rule) = %v, %v", v, err)
+	}
+
+	canon, err := Set(cfg, "hostAliases.gitlab.example.com", "gitlab.com")
+	if err != nil || canon != "hostAliases.gitlab.example.com" || cfg.HostAliases["gitlab.example.com"] != "gitlab.com" {
+		t.Fatalf("Set(hostAliases entry) = %q, %v; aliases=%v", canon, err, cfg.HostAliases)
+	}
+	if v, _, err := Get(cfg, "hostAliases.gitlab.example.com"); err != nil || v != "gitlab.com" {
+		t.Fatalf("Get(hostAliases entry) = %v, %v", v, err)
+	}
+	if _, err := Set(cfg, "rules[work].env.FOO", "bar"); err != nil || cfg.Rules[0].Env["FOO"] != "bar" {
+		t.Fatalf("Set(env entry) err=%v env=%v", err, cfg.Rules[0].Env)
+	}
+	if canon, err := Set(cfg, "rules[work].env.FOO", ""); err != nil || canon != "rules[0].env.FOO" || len(cfg.Rules[0].Env) != 0 {
+		t.Fatalf("Set(env entry, empty) = %q, %v; env=%v", canon, err, cfg.Rules[0].Env)
+	}
+	if _, _, err := Get(cfg, "rules[0].env.FOO"); err == nil || !strings.Contains(err.Error(), `no entry "FOO"`) {
+		t.Fatalf("Get(removed env entry) error = %v", err)
+	}
+	if _, err := Set(cfg, "strict", "true"); err != nil || !cfg.Strict {
+		t.Fatalf("Set(strict) err=%v strict=%v", err, cfg.Strict)
+	}
+	for _, key := range []string{"rules", "rules[0]"} {
+		if _, err := Set(cfg, key, "null"); err == nil || !strings.Contains(err.Error(), "cannot be null") {
+			t.Errorf("Set(%s, null) error = %v", key, err)
+		}
+	}
+	if _, err := Set(cfg, "pin", "null"); err != nil || cfg.Pin != nil {
+		t.Errorf("Set(pin, null) err=%v pin=%+v", err, cfg.Pin)
+	}
+	if _, err := Set(cfg, "version", "99"); err != nil {
+		t.Fatalf("Set(version, 99): %v", err)
+	}
+	if !HasErrors(Validate(cfg)) {
+		t.Error("Validate() accepted a version newer than CurrentVersion")
+	}
+}
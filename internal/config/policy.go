@@ -0,0 +1,31 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+func policyIssues(prefix string, e PolicyEntry) []ValidationIssue {
+	if e.Deny == nil {
+		return []ValidationIssue{{Level: "error", Field: prefix + ".deny", Message: "deny is required"}}
+	}
+	var issues []ValidationIssue
+	patterns := []struct{ field, pattern string }{
+		{"host", e.Deny.Host}, {"owner", e.Deny.Owner}, {"repo", e.Deny.Repo},
+	}
+	for i, c := range e.Deny.Commands {
+		patterns = append(patterns, struct{ field, pattern string }{fmt.Sprintf("commands[%d]", i), c})
+	}
+	for _, p := range patterns {
+		if _, err := filepath.Match(p.pattern, ""); err != nil {
+			issues = append(issues, ValidationIssue{Level: "error", Field: prefix + ".deny." + p.field, Message: fmt.Sprintf("invalid pattern %q", p.pattern)})
+		}
+	}
+	for i, c := range e.Deny.Commands {
+		if strings.HasPrefix(c, "-") || strings.ContainsAny(c, " \t") {
+			issues = append(issues, ValidationIssue{Level: "error", Field: fmt.Sprintf("%s.deny.commands[%d]", prefix, i), Message: fmt.Sprintf("%q must be a git subcommand such as push", c)})
+		}
+	}
+	return issues
+}
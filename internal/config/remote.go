@@ -0,0 +1,310 @@
+package config
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pavelBuzdanov/mgit/pkg/trace"
+)
+
+// DefaultRemoteRulesTTL is how long fetched remote rules are used when the
+// config sets no remoteRulesTTL.
+const DefaultRemoteRulesTTL = 24 * time.Hour
+
+// maxRemoteRulesSize bounds the rule document mgit downloads.
+const maxRemoteRulesSize = 4 << 20
+
+// remoteRulesClient fetches https:// rule sets; tests replace it.
+var remoteRulesClient = &http.Client{Timeout: 15 * time.Second}
+
+// RemoteRules are the rules of a config's remoteRules URL.
+type RemoteRules struct {
+	URL       string
+	Rules     []Rule
+	FetchedAt time.Time
+	// FetchErr is set when fetching failed and Rules are the cached copy
+	// from FetchedAt.
+	FetchErr error
+	// SignatureErr is set when there are trusted keys and the rules are not
+	// signed by one of them. Such rules are not cached.
+	SignatureErr error
+	// verified is whether the rules were signed by a trusted key.
+	verified bool
+}
+
+// remoteRulesCache is the last rule set fetched for a config.
+type remoteRulesCache struct {
+	URL       string `json:"url"`
+	FetchedAt string `json:"fetchedAt"`
+	Rules     []Rule `json:"rules"`
+	Verified  bool   `json:"verified,omitempty"`
+}
+
+// RemoteRulesCachePath is where the remote rules of the config at path are
+// cached: mgit/remote-rules/<hash of the path>.json in the user's cache
+// directory, so a repository cannot ship rules marked as verified. It is ""
+// when there is no cache directory.
+func RemoteRulesCachePath(path string) string {
+	return userCacheFile("remote-rules", path)
+}
+
+// RemoteRulesTTLDuration is remoteRulesTTL, or DefaultRemoteRulesTTL.
+func RemoteRulesTTLDuration(c *Config) (time.Duration, error) {
+	if c.RemoteRulesTTL == "" {
+		return DefaultRemoteRulesTTL, nil
+	}
+	return parseWindow(c.RemoteRulesTTL, "remoteRulesTTL")
+}
+
+// LoadRemoteRules returns the remote rules of cfg, the config at path: the
+// cached copy while it is younger than the TTL, else a fresh download. When
+// the download fails, an older cached copy of the same URL is still used,
+// with FetchErr set, so mgit keeps working offline. refresh skips the TTL.
+// With trusted keys, only signed rules are cached, and a copy cached before
+// there were trusted keys is fetched again. It returns nil without
+// remoteRules.
+func LoadRemoteRules(path string, cfg *Config, refresh bool) (*RemoteRules, error) {
+	if cfg.RemoteRules == "" {
+		return nil, nil
+	}
+	ttl, err := RemoteRulesTTLDuration(cfg)
+	if err != nil {
+		return nil, err
+	}
+	_, trusted, err := TrustedKeys()
+	if err != nil {
+		return nil, err
+	}
+	cached := readRemoteRulesCache(path, cfg.RemoteRules)
+	if cached != nil && trusted && !cached.verified {
+		cached.SignatureErr = errors.New("cached copy was fetched before there were trusted keys and is not verified")
+	}
+	if cached != nil && cached.SignatureErr == nil && !refresh && time.Since(cached.FetchedAt) < ttl {
+		return cached, nil
+	}
+	done := trace.Start("config.remote_rules", "url", cfg.RemoteRules)
+	rr, err := FetchRemoteRules(cfg.RemoteRules)
+	if err != nil {
+		done("error", err.Error())
+		if cached != nil {
+			cached.FetchErr = err
+			return cached, nil
+		}
+		return nil, err
+	}
+	done("rules", len(rr.Rules))
+	if rr.SignatureErr != nil {
+		return rr, nil
+	}
+	data, err := json.MarshalIndent(remoteRulesCache{URL: rr.URL, FetchedAt: rr.FetchedAt.UTC().Format(time.RFC3339Nano), Rules: rr.Rules, Verified: rr.verified}, "", "  ")
+	// The cache only saves downloads; failing to write it is not an error.
+	if file := RemoteRulesCachePath(path); err == nil && file != "" && os.MkdirAll(filepath.Dir(file), 0o700) == nil {
+		_ = writeFileAtomic(file, append(data, '\n'))
+	}
+	return rr, nil
+}
+
+func readRemoteRulesCache(path, rawURL string) *RemoteRules {
+	file := RemoteRulesCachePath(path)
+	if file == "" {
+		return nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil
+	}
+	var c remoteRulesCache
+	if err := json.Unmarshal(data, &c); err != nil || c.URL != rawURL {
+		return nil
+	}
+	fetched, err := time.Parse(time.RFC3339Nano, c.FetchedAt)
+	if err != nil {
+		return nil
+	}
+	return &RemoteRules{URL: c.URL, Rules: c.Rules, FetchedAt: fetched, verified: c.Verified}
+}
+
+// FetchRemoteRules downloads a rule set: a JSON array of rules, or an
+// object with a "rules" array such as a config file. Rules without an ID
+// get remote_1, remote_2, ... by position. A set with invalid rules is
+// refused as a whole; key files missing on this machine are not invalid.
+// With trusted keys, the detached signatures next to the set, URL.sig and
+// URL.minisig, are fetched as well and SignatureErr is set when they do not
+// verify.
+func FetchRemoteRules(rawURL string) (*RemoteRules, error) {
+	u, err := remoteRulesURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	keys, trusted, err := TrustedKeys()
+	if err != nil {
+		return nil, err
+	}
+	data, err := fetchRemote(u, "")
+	if err != nil {
+		return nil, fmt.Errorf("fetch remote rules %s: %w", rawURL, err)
+	}
+	rr := &RemoteRules{URL: rawURL, FetchedAt: time.Now()}
+	if trusted {
+		var sshSig, minisig []byte
+		if len(keys.SSH) > 0 {
+			sshSig, err = fetchRemote(u, ".sig")
+		}
+		if err == nil && len(keys.Minisign) > 0 {
+			minisig, err = fetchRemote(u, ".minisig")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("fetch remote rules signature %s: %w", rawURL, err)
+		}
+		if err := keys.Verify(data, sshSig, minisig); err != nil {
+			rr.SignatureErr = signatureError(err)
+		}
+		rr.verified = rr.SignatureErr == nil
+	}
+	var doc struct {
+		Rules []Rule `json:"rules"`
+	}
+	if trimmed := strings.TrimSpace(string(data)); strings.HasPrefix(trimmed, "[") {
+		err = json.Unmarshal(data, &doc.Rules)
+	} else {
+		err = json.Unmarshal(data, &doc)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse remote rules %s: %w", rawURL, err)
+	}
+	for i := range doc.Rules {
+		if strings.TrimSpace(doc.Rules[i].ID) == "" {
+			doc.Rules[i].ID = fmt.Sprintf("remote_%d", i+1)
+		}
+	}
+	set := Config{Version: CurrentVersion, Rules: doc.Rules}
+	for _, issue := range Validate(&set) {
+		// Key files live on each machine; a missing one is reported where
+		// the merged rules are validated, not held against the whole set.
+		if keyFileField(set.Rules, issue.Field) {
+			continue
+		}
+		if issue.Level == "error" {
+			return nil, fmt.Errorf("remote rules %s: %s: %s", rawURL, issue.Field, issue.Message)
+		}
+	}
+	rr.Rules = set.Rules
+	return rr, nil
+}
+
+// fetchRemote reads the rule set at u, or with suffix a file next to it. A
+// signature file that does not exist is nil, not an error.
+func fetchRemote(u *url.URL, suffix string) ([]byte, error) {
+	if u.Scheme == "file" {
+		data, err := os.ReadFile(u.Path + suffix)
+		if suffix != "" && errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return data, err
+	}
+	target := *u
+	target.Path += suffix
+	data, err := httpGetRules(target.String())
+	if suffix != "" && errors.Is(err, errNotFound) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// keyFileField reports whether field, "rules[N].key", is about a key file
+// the rule names rather than a missing key.
+func keyFileField(rules []Rule, field string) bool {
+	var i int
+	if _, err := fmt.Sscanf(field, "rules[%d].key", &i); err != nil || i < 0 || i >= len(rules) {
+		return false
+	}
+	return rules[i].Key != ""
+}
+
+var errNotFound = errors.New("HTTP 404 Not Found")
+
+func httpGetRules(rawURL string) ([]byte, error) {
+	resp, err := remoteRulesClient.Get(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxRemoteRulesSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxRemoteRulesSize {
+		return nil, fmt.Errorf("larger than %d bytes", maxRemoteRulesSize)
+	}
+	return data, nil
+}
+
+// remoteRulesURL parses a remoteRules value. Only https:// and file:// are
+// accepted: rules pick the keys git authenticates with, so they must not
+// come over a connection anyone on the network can rewrite.
+func remoteRulesURL(rawURL string) (*url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("remoteRules: %w", err)
+	}
+	switch {
+	case u.Scheme == "https" && u.Host != "":
+	case u.Scheme == "file" && u.Path != "":
+	default:
+		return nil, errors.New("remoteRules must be an https:// or file:// URL")
+	}
+	return u, nil
+}
+
+// MergeRemoteRules appends the remote rules below the local ones. Their
+// priorities are shifted, keeping their order, to below the lowest local
+// priority, so a local rule that matches always wins, however specific a
+// remote rule is. A remote rule whose ID a local rule already uses is left
+// out, so a local rule can replace a central one.
+func MergeRemoteRules(c *Config, rr *RemoteRules) {
+	if rr == nil || len(rr.Rules) == 0 {
+		return
+	}
+	shift := 0
+	if len(c.Rules) > 0 {
+		localMin := slices.MinFunc(c.Rules, func(a, b Rule) int { return cmp.Compare(a.Priority, b.Priority) }).Priority
+		remoteMax := slices.MaxFunc(rr.Rules, func(a, b Rule) int { return cmp.Compare(a.Priority, b.Priority) }).Priority
+		shift = max(0, remoteMax-localMin+1)
+	}
+	for _, r := range rr.Rules {
+		if c.RuleIndex(r.ID) < 0 {
+			r.Priority -= shift
+			c.Rules = append(c.Rules, r)
+		}
+	}
+}
+
+func remoteRulesIssues(c *Config) []ValidationIssue {
+	var issues []ValidationIssue
+	if c.RemoteRules != "" {
+		if _, err := remoteRulesURL(c.RemoteRules); err != nil {
+			issues = append(issues, ValidationIssue{Level: "error", Field: "remoteRules", Message: err.Error()})
+		}
+	}
+	if _, err := RemoteRulesTTLDuration(c); err != nil {
+		issues = append(issues, ValidationIssue{Level: "error", Field: "remoteRulesTTL", Message: err.Error()})
+	}
+	return issues
+}
@@ -0,0 +1,140 @@
+package config
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pavelBuzdanov/mgit/pkg/giturl"
+	"github.com/pavelBuzdanov/mgit/pkg/matcher"
+)
+
+func TestLoadRemoteRules(t *testing.T) {
+	t.Setenv(TrustedKeysEnv, filepath.Join(t.TempDir(), "none"))
+	cache := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", cache)
+	t.Setenv("HOME", cache)
+	body := `{"version":1,"rules":[{"host":"github.com","owner":"CompanyOrg","key":"/k/central"},{"id":"home","host":"github.com","owner":"me","key":"/k/central-home"}]}`
+	requests := 0
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		_, _ = w.Write([]byte(body))
+	}))
+	defer srv.Close()
+	old := remoteRulesClient
+	remoteRulesClient = srv.Client()
+	t.Cleanup(func() { remoteRulesClient = old })
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	cfg := &Config{Version: 1, Rules: []Rule{{ID: "home", Host: "github.com", Owner: "me", Key: "/k/home"}}, RemoteRules: srv.URL + "/rules.json"}
+	rr, err := LoadRemoteRules(path, cfg, false)
+	if err != nil {
+		t.Fatalf("LoadRemoteRules() error = %v", err)
+	}
+	if len(rr.Rules) != 2 || rr.Rules[0].ID != "remote_1" {
+		t.Fatalf("rules = %+v", rr.Rules)
+	}
+	MergeRemoteRules(cfg, rr)
+	if len(cfg.Rules) != 2 || cfg.Rules[0].Key != "/k/home" || cfg.Rules[1].ID != "remote_1" {
+		t.Fatalf("merged rules = %+v; local rules come first and win on ID", cfg.Rules)
+	}
+
+	// Within the TTL the cache answers; after it, or when asked to refresh,
+	// the server does.
+	if _, err := LoadRemoteRules(path, cfg, false); err != nil || requests != 1 {
+		t.Fatalf("second load: err=%v requests=%d, want the cache", err, requests)
+	}
+	if _, err := LoadRemoteRules(path, cfg, true); err != nil || requests != 2 {
+		t.Fatalf("refresh: err=%v requests=%d", err, requests)
+	}
+
+	// Offline, the cached copy is still used and the failure reported.
+	srv.Close()
+	cfg.RemoteRulesTTL = "1ns"
+	time.Sleep(time.Millisecond)
+	rr, err = LoadRemoteRules(path, cfg, false)
+	if err != nil || rr.FetchErr == nil || len(rr.Rules) != 2 {
+		t.Fatalf("offline: rr=%+v err=%v, want the cached rules with FetchErr", rr, err)
+	}
+	if err := os.Remove(RemoteRulesCachePath(path)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadRemoteRules(path, cfg, false); err == nil {
+		t.Fatal("offline without a cache: no error")
+	}
+}
+
+func TestLoadRemoteRulesIgnoresShippedCache(t *testing.T) {
+	dir := t.TempDir()
+	keys := filepath.Join(dir, "trusted_keys")
+	t.Setenv(TrustedKeysEnv, keys)
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(dir, "cache"))
+	t.Setenv("HOME", filepath.Join(dir, "cache"))
+	key, _ := minisignFiles(t)
+	if err := os.WriteFile(keys, []byte(key+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "rules.json")
+	if err := os.WriteFile(file, []byte(`[{"host":"github.com","owner":"a","key":"/k"}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "repo", ".mgit", "config.json")
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &Config{Version: 1, RemoteRules: "file://" + file}
+	shipped := `{"url":"file://` + file + `","fetchedAt":"2999-01-01T00:00:00Z","verified":true,"rules":[{"host":"*","key":"/evil","sshCommand":"/tmp/x"}]}`
+	if err := os.WriteFile(filepath.Join(filepath.Dir(path), "remote-rules.json"), []byte(shipped), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	rr, err := LoadRemoteRules(path, cfg, false)
+	if err != nil || rr.SignatureErr == nil || len(rr.Rules) != 1 || rr.Rules[0].Key != "/k" {
+		t.Fatalf("rr=%+v err=%v, want the fetched, unsigned rules", rr, err)
+	}
+}
+
+func TestFetchRemoteRulesRefusesBadSets(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(TrustedKeysEnv, filepath.Join(dir, "none"))
+	file := filepath.Join(dir, "rules.json")
+	if err := os.WriteFile(file, []byte(`[{"host":"github.com","owner":"a","key":"/k"}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if rr, err := FetchRemoteRules("file://" + file); err != nil || len(rr.Rules) != 1 {
+		t.Fatalf("file:// = %+v, %v", rr, err)
+	}
+	if _, err := FetchRemoteRules("http://intranet/rules.json"); err == nil {
+		t.Error("plain http accepted")
+	}
+	if err := os.WriteFile(file, []byte(`[{"host":"github.com","owner":"a"}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FetchRemoteRules("file://" + file); err == nil {
+		t.Error("rule set with an invalid rule accepted")
+	}
+}
+
+func TestMergeRemoteRulesRanksLocalFirst(t *testing.T) {
+	cfg := &Config{Rules: []Rule{
+		{ID: "home", Host: "github.com", Owner: "*", Key: "/k/home"},
+		{ID: "pinned", Host: "gitlab.com", Owner: "*", Key: "/k/pinned", Priority: 5},
+	}}
+	MergeRemoteRules(cfg, &RemoteRules{Rules: []Rule{
+		{ID: "org", Host: "github.com", Owner: "CompanyOrg", Key: "/k/org", Priority: 10},
+		{ID: "low", Host: "*", Owner: "*", Key: "/k/low", Priority: 2},
+	}})
+	if got := []int{cfg.Rules[2].Priority, cfg.Rules[3].Priority}; got[0] != -1 || got[1] != -9 {
+		t.Fatalf("remote priorities = %v, want [-1 -9]: below every local rule, in their order", got)
+	}
+	remote, err := giturl.Parse("git@github.com:CompanyOrg/app.git")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m, err := matcher.Match(cfg.Rules, remote); err != nil || m.Rule.ID != "home" {
+		t.Fatalf("match = %+v, %v; want the local catch-all over the more specific remote rule", m, err)
+	}
+}
@@ -0,0 +1,58 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseRotateAfter parses a rotation window such as "90d", "12w", "1y" or a Go duration ("2160h").
+func ParseRotateAfter(s string) (time.Duration, error) {
+	return parseWindow(s, "rotation window")
+}
+
+// parseWindow parses a duration in days, weeks or years ("90d", "12w",
+// "1y") or a Go duration ("2160h"); what names it in errors.
+func parseWindow(s, what string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, fmt.Errorf("empty %s", what)
+	}
+	day := 24 * time.Hour
+	units := map[byte]time.Duration{'d': day, 'w': 7 * day, 'y': 365 * day}
+	if unit, ok := units[s[len(s)-1]]; ok {
+		n, err := strconv.Atoi(s[:len(s)-1])
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid %s %q", what, s)
+		}
+		return time.Duration(n) * unit, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid %s %q (use e.g. 90d, 12w, 1y)", what, s)
+	}
+	return d, nil
+}
+
+// RotationDue reports whether the rule's key is older than its rotation window.
+// Rules without createdAt/rotateAfter are never due.
+func RotationDue(r Rule, now time.Time) (bool, time.Duration) {
+	if r.CreatedAt == "" || r.RotateAfter == "" {
+		return false, 0
+	}
+	created, err := time.Parse(time.RFC3339, r.CreatedAt)
+	if err != nil {
+		return false, 0
+	}
+	window, err := ParseRotateAfter(r.RotateAfter)
+	if err != nil {
+		return false, 0
+	}
+	age := now.Sub(created)
+	return age > window, age
+}
+
+func Timestamp(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRotateAfter(t *testing.T) {
+	cases := map[string]time.Duration{
+		"90d":   90 * 24 * time.Hour,
+		"2w":    14 * 24 * time.Hour,
+		"1y":    365 * 24 * time.Hour,
+		"2160h": 2160 * time.Hour,
+	}
+	for in, want := range cases {
+		got, err := ParseRotateAfter(in)
+		if err != nil || got != want {
+			t.Fatalf("ParseRotateAfter(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	for _, bad := range []string{"", "0d", "-1d", "soon"} {
+		if _, err := ParseRotateAfter(bad); err == nil {
+			t.Fatalf("ParseRotateAfter(%q) expected error", bad)
+		}
+	}
+}
+
+func TestRuleRotationDue(t *testing.T) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	r := Rule{CreatedAt: "2025-01-01T00:00:00Z", RotateAfter: "90d"}
+	if due, _ := RotationDue(r, now); !due {
+		t.Fatalf("expected rotation to be due")
+	}
+	r.RotateAfter = "1y"
+	if due, _ := RotationDue(r, now); due {
+		t.Fatalf("expected rotation not to be due")
+	}
+	if due, _ := RotationDue(Rule{}, now); due {
+		t.Fatalf("rules without metadata are never due")
+	}
+}
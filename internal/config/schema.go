@@ -0,0 +1,300 @@
+package config
+
+// Schema is the JSON Schema (draft 2020-12) for config version
+// CurrentVersion, for editor completion and CI validation of hand-edited
+// configs. Keep it in step with Config, Rule and HostDefault; TestSchemaCoversConfig
+// fails when a field is missing.
+const Schema = `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "title": "mgit config",
+  "description": "SSH key selection rules for mgit (.mgit/config.json).",
+  "type": "object",
+  "required": ["version", "rules"],
+  "additionalProperties": false,
+  "properties": {
+    "$schema": {
+      "type": "string",
+      "description": "Path or URL of this schema, for editors."
+    },
+    "version": {
+      "const": 1,
+      "description": "Config format version."
+    },
+    "defaultKey": {
+      "type": "string",
+      "minLength": 1,
+      "description": "Key used only when no rule matches: a key path, a provider reference (op://, pass:) or an ssh-agent fingerprint/public key. Reported as a fallback by resolve and doctor."
+    },
+    "sshCommand": {
+      "type": "string",
+      "description": "ssh client for all rules: a binary with optional arguments, e.g. /usr/bin/ssh -4 or plink.exe. Defaults to ssh.",
+      "examples": ["/usr/bin/ssh -4", "plink.exe"]
+    },
+    "sshBinary": {
+      "type": "string",
+      "minLength": 1,
+      "description": "Path of the ssh executable for rules without an sshCommand, instead of ssh from PATH. The MGIT_SSH environment variable overrides it.",
+      "examples": ["/usr/bin/ssh", "C:\\Windows\\System32\\OpenSSH\\ssh.exe"]
+    },
+    "askpass": {
+      "type": "string",
+      "minLength": 1,
+      "description": "Supplies passphrases of encrypted keys that are not loaded in ssh-agent: an SSH_ASKPASS program, or prompt to have mgit ask once per run on the terminal. The MGIT_ASKPASS environment variable overrides it.",
+      "examples": ["prompt", "/usr/lib/ssh/x11-ssh-askpass"]
+    },
+    "hostAliases": {
+      "type": "object",
+      "additionalProperties": { "type": "string", "pattern": "^[^*?\\[]+$" },
+      "propertyNames": { "pattern": "^[^*?\\[]+$" },
+      "description": "Maps hosts as written in remote URLs (ssh_config aliases, DNS shortcuts) to the canonical host used for rule matching. git still connects to the alias.",
+      "examples": [{ "github-work": "github.com" }]
+    },
+    "hostDefaults": {
+      "type": "array",
+      "items": { "$ref": "#/$defs/hostDefault" },
+      "description": "ssh user, port and options per host pattern, applied to every rule. The first matching entry to set user or port wins."
+    },
+    "retry": {
+      "type": "integer",
+      "minimum": 0,
+      "description": "Retries for fetch, pull, push and ls-remote after a transient network error (connection reset, timeout, early EOF), with exponential backoff. --retry overrides it."
+    },
+    "allowedGitCommands": {
+      "type": "array",
+      "items": { "type": "string", "minLength": 1 },
+      "description": "If set, the git passthrough only runs commands matching an entry: a subcommand and arguments, as glob patterns, e.g. \"fetch\" or \"push origin *\"."
+    },
+    "deniedGitCommands": {
+      "type": "array",
+      "items": { "type": "string", "minLength": 1 },
+      "description": "The git passthrough refuses commands matching an entry, e.g. \"push --force*\" or \"push +*\". Takes precedence over allowedGitCommands."
+    },
+    "requireKeyTypes": {
+      "type": "array",
+      "items": { "type": "string", "pattern": "^(ed25519|ed25519-sk|ecdsa|ecdsa-sk|rsa|dsa)(:[1-9][0-9]*)?$" },
+      "description": "Key types rules may use; rsa:3072 allows RSA keys of at least 3072 bits. Other keys fail validation and rule add. Without it, DSA keys and RSA keys under 2048 bits are warned about.",
+      "examples": [["ed25519", "ed25519-sk"], ["ed25519", "rsa:3072"]]
+    },
+    "policy": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "required": ["deny"],
+        "additionalProperties": false,
+        "properties": {
+          "deny": {
+            "type": "object",
+            "required": ["host"],
+            "additionalProperties": false,
+            "properties": {
+              "host": { "type": "string", "description": "Remote host or glob pattern." },
+              "owner": { "type": "string", "description": "Owner or group glob pattern; \"**\" spans nested groups. Empty matches any." },
+              "repo": { "type": "string", "description": "Repository name glob pattern. Empty matches any." },
+              "commands": {
+                "type": "array",
+                "items": { "type": "string", "pattern": "^[^- \t][^ \t]*$" },
+                "description": "git subcommands, as glob patterns, that are denied. Empty denies every command that contacts the remote.",
+                "examples": [["push"]]
+              }
+            }
+          },
+          "message": { "type": "string", "description": "Added to the policy violation error, e.g. where to push instead." }
+        }
+      },
+      "description": "Git commands mgit refuses to run against matching remotes, e.g. pushes to a personal namespace. A refused command exits with code 7."
+    },
+    "externalSshCommand": {
+      "type": "string",
+      "enum": ["override", "merge", "respect"],
+      "description": "What to do when GIT_SSH_COMMAND (environment) or core.sshCommand (repository) is already set: override it with the rule's (default), merge the rule's key and options into it, or respect it and skip key selection."
+    },
+    "pin": {
+      "type": "object",
+      "additionalProperties": false,
+      "oneOf": [{ "required": ["rule"] }, { "required": ["key"] }],
+      "properties": {
+        "rule": { "type": "string", "minLength": 1, "description": "ID of the rule every SSH remote uses." },
+        "key": { "type": "string", "minLength": 1, "description": "Key every SSH remote uses: a key path, a provider reference or an ssh-agent identity." }
+      },
+      "description": "Forces one resolution for every SSH remote of this repository, whatever the rules match. Set with mgit pin, removed with mgit unpin."
+    },
+    "strict": {
+      "type": "boolean",
+      "description": "Refuse SSH remotes that only a catch-all rule (host and owner \"*\") or defaultKey would cover, instead of silently using that key. --strict turns it on for one command."
+    },
+    "redact": {
+      "type": "boolean",
+      "description": "Mask key paths, user names, e-mail addresses and hosts other than public forges in JSON, JSONL and YAML output, as --redact does. --show-secrets turns it off for one command."
+    },
+    "gitignore": {
+      "type": "string",
+      "enum": ["gitignore", "exclude", "off"],
+      "description": "How mgit keeps the .mgit directory of a repo-local config it creates out of git: add it to an existing .gitignore (the default), to .git/info/exclude, or neither. Read from the global config; --gitignore and MGIT_GITIGNORE take precedence."
+    },
+    "remoteRules": {
+      "type": "string",
+      "pattern": "^(https|file)://",
+      "description": "URL of a centrally managed rule set (a JSON array of rules, or an object with a rules array), merged below the local rules. Fetched copies are cached next to the config and still used when a later fetch fails. mgit config refresh fetches it now.",
+      "examples": ["https://intranet.example.com/mgit-rules.json"]
+    },
+    "remoteRulesTTL": {
+      "type": "string",
+      "pattern": "^([1-9][0-9]*[dwy]|[0-9.]+(ns|us|µs|ms|s|m|h))+$",
+      "description": "How long fetched remote rules are used before they are fetched again: days, weeks or years (7d, 2w) or a Go duration (12h). Defaults to 24h.",
+      "examples": ["12h", "7d"]
+    },
+    "stats": {
+      "type": "boolean",
+      "description": "Record per-rule usage locally (mgit stats)."
+    },
+    "rules": {
+      "type": "array",
+      "items": { "$ref": "#/$defs/rule" }
+    }
+  },
+  "$defs": {
+    "hostDefault": {
+      "type": "object",
+      "required": ["host"],
+      "additionalProperties": false,
+      "properties": {
+        "host": {
+          "type": "string",
+          "description": "Remote host or glob pattern.",
+          "examples": ["gerrit.example.com", "*.corp.example.com"]
+        },
+        "user": {
+          "type": "string",
+          "pattern": "^[^@ \t]+$",
+          "description": "ssh user, used regardless of the user in the remote URL.",
+          "examples": ["gerrit"]
+        },
+        "port": {
+          "type": "integer",
+          "minimum": 1,
+          "maximum": 65535,
+          "description": "ssh port, used regardless of the port in the remote URL."
+        },
+        "options": {
+          "type": "array",
+          "items": { "type": "string", "pattern": "^[^= \t]+=" },
+          "description": "Extra ssh -o options as Name=value.",
+          "examples": [["HostKeyAlgorithms=+ssh-rsa"]]
+        }
+      }
+    },
+    "rule": {
+      "type": "object",
+      "required": ["host", "owner"],
+      "additionalProperties": false,
+      "anyOf": [
+        { "required": ["key"] },
+        { "required": ["agent"] },
+        { "required": ["httpsUser"] },
+        { "required": ["credentialHelper"] }
+      ],
+      "not": { "required": ["key", "agent"] },
+      "properties": {
+        "id": {
+          "type": "string",
+          "description": "Stable rule ID; generated when omitted."
+        },
+        "host": {
+          "type": "string",
+          "description": "Remote host, glob pattern, or * for any host.",
+          "examples": ["github.com", "*.gitlab.example.com", "*"]
+        },
+        "owner": {
+          "type": "string",
+          "description": "Owner or namespace (GitLab groups may be nested), glob pattern, or * for any owner. A ** segment matches any number of nested groups.",
+          "examples": ["CompanyOrg", "group/subgroup", "group/**", "*"]
+        },
+        "remote": {
+          "type": "string",
+          "description": "Only match URLs read from git remotes with this name (glob pattern), e.g. upstream or fork-*. Plain URLs never match.",
+          "examples": ["origin", "upstream", "fork-*"]
+        },
+        "key": {
+          "type": "string",
+          "minLength": 1,
+          "description": "Private key path (~ is expanded) or provider reference (op://, pass:). Mutually exclusive with agent."
+        },
+        "agent": {
+          "type": "string",
+          "pattern": "^(SHA256:.+|[a-z0-9@.-]+ [A-Za-z0-9+/=]+( .*)?)$",
+          "description": "ssh-agent identity: SHA256 fingerprint (ssh-add -l) or public key line. Mutually exclusive with key."
+        },
+        "priority": {
+          "type": "integer",
+          "description": "Overrides specificity scoring; higher wins."
+        },
+        "securityKeyProvider": {
+          "type": "string",
+          "description": "ssh SecurityKeyProvider for FIDO2 (sk-) keys: internal or a middleware library path."
+        },
+        "strictHostKeyChecking": {
+          "type": "string",
+          "enum": ["yes", "accept-new", "ask", "no"],
+          "description": "ssh StrictHostKeyChecking for the rule's remotes. Unset, ssh's default applies, or yes when knownHostsFile is set."
+        },
+        "knownHostsFile": {
+          "type": "string",
+          "description": "known_hosts file (~ is expanded) that replaces every other one for the rule's remotes, pinning their host keys."
+        },
+        "createdAt": {
+          "type": "string",
+          "format": "date-time",
+          "description": "When the key was created (RFC 3339); drives rotation reminders."
+        },
+        "rotateAfter": {
+          "type": "string",
+          "pattern": "^([1-9][0-9]*[dwy]|[0-9.]+(ns|us|µs|ms|s|m|h))+$",
+          "description": "Rotation window, e.g. 90d, 12w, 1y.",
+          "examples": ["90d", "12w", "1y"]
+        },
+        "signingKey": {
+          "type": "string",
+          "description": "user.signingkey for commits, tags and merges made through mgit."
+        },
+        "signingFormat": {
+          "enum": ["ssh", "openpgp", "x509"],
+          "description": "gpg.format for signingKey; defaults to ssh for key paths and openpgp for GPG key IDs."
+        },
+        "email": {
+          "type": "string",
+          "description": "Expected author email (wildcards allowed, e.g. *@company.com), enforced by mgit guard."
+        },
+        "description": {
+          "type": "string",
+          "description": "Free-form note on what the rule is for."
+        },
+        "tags": {
+          "type": "array",
+          "items": { "type": "string", "minLength": 1 },
+          "description": "Labels for rule list --tag."
+        },
+        "sshCommand": {
+          "type": "string",
+          "description": "ssh client for this rule's remotes, overriding the top-level sshCommand."
+        },
+        "env": {
+          "type": "object",
+          "additionalProperties": { "type": "string" },
+          "propertyNames": { "pattern": "^[^= \t]+$", "not": { "enum": ["GIT_SSH_COMMAND", "GIT_SSH", "GIT_SSH_VARIANT"] } },
+          "description": "Environment variables for git commands run for this rule's remotes, e.g. GIT_SSL_CAINFO or HTTPS_PROXY."
+        },
+        "httpsUser": {
+          "type": "string",
+          "pattern": "^[^ \\t\\n]+$",
+          "description": "Username for HTTPS remotes, set as credential.<url>.username for the remote's host."
+        },
+        "credentialHelper": {
+          "type": "string",
+          "description": "Credential helper for HTTPS remotes, replacing other helpers for the remote's host, e.g. store --file ~/.git-credentials-work.",
+          "examples": ["store --file ~/.git-credentials-work", "manager"]
+        }
+      }
+    }
+  }
+}
+`
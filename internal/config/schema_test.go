@@ -0,0 +1,39 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSchemaCoversConfig(t *testing.T) {
+	var schema struct {
+		Properties map[string]any `json:"properties"`
+		Defs       struct {
+			Rule struct {
+				Properties map[string]any `json:"properties"`
+			} `json:"rule"`
+			HostDefault struct {
+				Properties map[string]any `json:"properties"`
+			} `json:"hostDefault"`
+		} `json:"$defs"`
+	}
+	if err := json.Unmarshal([]byte(Schema), &schema); err != nil {
+		t.Fatalf("Schema is not valid JSON: %v", err)
+	}
+	check := func(typ reflect.Type, props map[string]any) {
+		for i := 0; i < typ.NumField(); i++ {
+			name := strings.Split(typ.Field(i).Tag.Get("json"), ",")[0]
+			if _, ok := props[name]; !ok {
+				t.Errorf("schema for %s is missing %q", typ.Name(), name)
+			}
+		}
+		if len(props) != typ.NumField() {
+			t.Errorf("schema for %s has %d properties, struct has %d fields", typ.Name(), len(props), typ.NumField())
+		}
+	}
+	check(reflect.TypeOf(Config{}), schema.Properties)
+	check(reflect.TypeOf(Rule{}), schema.Defs.Rule.Properties)
+	check(reflect.TypeOf(HostDefault{}), schema.Defs.HostDefault.Properties)
+}
@@ -0,0 +1,32 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ExternalSSHMode says what mgit does when GIT_SSH_COMMAND is already set in
+// the environment or core.sshCommand in the repository.
+type ExternalSSHMode string
+
+const (
+	// ExternalOverride replaces the existing command with the rule's.
+	ExternalOverride ExternalSSHMode = "override"
+	// ExternalMerge runs the existing command as the ssh client, with the
+	// rule's key and options added.
+	ExternalMerge ExternalSSHMode = "merge"
+	// ExternalRespect leaves the existing command alone and skips key
+	// selection.
+	ExternalRespect ExternalSSHMode = "respect"
+)
+
+// ParseExternalSSHMode parses a mode name; empty means ExternalOverride.
+func ParseExternalSSHMode(s string) (ExternalSSHMode, error) {
+	switch m := ExternalSSHMode(strings.ToLower(strings.TrimSpace(s))); m {
+	case "":
+		return ExternalOverride, nil
+	case ExternalOverride, ExternalMerge, ExternalRespect:
+		return m, nil
+	}
+	return "", fmt.Errorf("invalid externalSshCommand %q (use override, merge or respect)", s)
+}
@@ -0,0 +1,217 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/pavelBuzdanov/mgit/internal/signature"
+	pkgconfig "github.com/pavelBuzdanov/mgit/pkg/config"
+	"github.com/pavelBuzdanov/mgit/pkg/trace"
+)
+
+// TrustedKeysEnv names a trusted keys file to use instead of the default
+// one (see TrustedKeysPath).
+const TrustedKeysEnv = "MGIT_TRUSTED_KEYS"
+
+// TrustedKeysPath is the file of public keys shared configs and remote rule
+// sets must be signed with: MGIT_TRUSTED_KEYS, else trusted_keys next to
+// the global config. It lives outside every config it vouches for, so a
+// config cannot name the keys it is checked against.
+func TrustedKeysPath() (string, error) {
+	if p := strings.TrimSpace(os.Getenv(TrustedKeysEnv)); p != "" {
+		return ExpandPath(p)
+	}
+	global, err := GlobalDefaultPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(global), "trusted_keys"), nil
+}
+
+// TrustedKeys loads the trusted keys. ok is false when there is no trusted
+// keys file, in which case signatures are not checked.
+func TrustedKeys() (keys signature.Keys, ok bool, err error) {
+	path, err := TrustedKeysPath()
+	if err != nil {
+		return signature.Keys{}, false, err
+	}
+	keys, err = signature.LoadKeys(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return signature.Keys{}, false, nil
+	}
+	if err != nil {
+		return signature.Keys{}, false, err
+	}
+	if keys.Empty() {
+		return signature.Keys{}, false, fmt.Errorf("trusted keys %s: no keys", path)
+	}
+	return keys, true, nil
+}
+
+// VerifyFile checks the detached signature of the config at path, path.sig
+// (ssh-keygen -Y sign -n mgit) or path.minisig, when there are trusted
+// keys. The global config and the env source are not checked: whoever can
+// change them can change the trusted keys as well.
+func VerifyFile(path string) error {
+	resolved, err := ResolvePath(path)
+	if err != nil || selfTrusted(resolved) {
+		return err
+	}
+	keys, ok, err := TrustedKeys()
+	if err != nil || !ok {
+		return err
+	}
+	data, err := os.ReadFile(resolved)
+	if err != nil {
+		return err
+	}
+	return verifyConfigData(keys, resolved, data)
+}
+
+// LoadVerified is Load followed by VerifyFile, except that the signature is
+// checked over the very bytes that are parsed, so the file cannot be
+// swapped in between. sigErr is VerifyFile's error, returned along with
+// the config. trusted reports whether the config may name programs for mgit
+// and ssh to run (see RestrictUntrusted): it is the global config, the env
+// source or signed by a trusted key. A config named explicitly with
+// --config is the user's own as well; any other, typically the
+// .mgit/config.json of a cloned repository, must be signed.
+func LoadVerified(path string) (cfg *Config, trusted bool, sigErr, err error) {
+	resolved, err := ResolvePath(path)
+	if err != nil {
+		return nil, false, nil, err
+	}
+	if selfTrusted(resolved) {
+		cfg, err := Load(resolved)
+		return cfg, err == nil, nil, err
+	}
+	keys, ok, keysErr := TrustedKeys()
+	if keysErr != nil || !ok {
+		cfg, err := Load(resolved)
+		return cfg, false, keysErr, err
+	}
+	data, err := os.ReadFile(resolved)
+	if err != nil {
+		return nil, false, nil, fmt.Errorf("read config %s: %w", resolved, err)
+	}
+	if cfg, err = pkgconfig.Parse(resolved, data); err != nil {
+		return nil, false, nil, err
+	}
+	trace.Event("config.load", "path", resolved, "rules", len(cfg.Rules), "signed", true)
+	if err := verifyConfigData(keys, resolved, data); err != nil {
+		return cfg, false, err, nil
+	}
+	return cfg, true, nil, nil
+}
+
+// selfTrusted reports whether resolved is the env source or the global
+// config, which are not signed.
+func selfTrusted(resolved string) bool {
+	if IsEnvSource(resolved) {
+		return true
+	}
+	global, err := GlobalDefaultPath()
+	return err == nil && filepath.Clean(global) == resolved
+}
+
+// verifyConfigData checks data, the contents of the config at resolved,
+// against its signature files.
+func verifyConfigData(keys signature.Keys, resolved string, data []byte) error {
+	if err := keys.Verify(data, readSignature(resolved+".sig"), readSignature(resolved+".minisig")); err != nil {
+		return fmt.Errorf("config %s: %w", resolved, signatureError(err))
+	}
+	return nil
+}
+
+// untrustedEnv are the rule env variables an untrusted config may still set:
+// proxies and CA bundles, which change where git connects and what it
+// accepts but run nothing.
+var untrustedEnv = map[string]bool{
+	"HTTP_PROXY": true, "HTTPS_PROXY": true, "ALL_PROXY": true, "NO_PROXY": true,
+	"GIT_SSL_CAINFO": true, "GIT_SSL_CAPATH": true, "GIT_PROXY_SSL_CAINFO": true,
+	"SSL_CERT_FILE": true, "SSL_CERT_DIR": true, "CURL_CA_BUNDLE": true,
+}
+
+// commandOptions are the ssh options, lowercased, that run a command or load
+// a library, which hostDefaults of an untrusted config may not pass.
+var commandOptions = map[string]bool{
+	"proxycommand": true, "localcommand": true, "permitlocalcommand": true,
+	"knownhostscommand": true, "securitykeyprovider": true, "pkcs11provider": true,
+}
+
+// sshOptionName is the keyword of the ssh -o option o, which ssh separates
+// from the value with "=" or whitespace.
+func sshOptionName(o string) string {
+	name, _, _ := strings.Cut(strings.TrimSpace(o), "=")
+	if i := strings.IndexAny(name, " \t"); i >= 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+// RestrictUntrusted clears the settings of cfg that make mgit or ssh run a
+// program of the config's choosing, for a config that is not trusted (see
+// LoadVerified), and returns their keys, e.g. "rules[2].sshCommand".
+func RestrictUntrusted(cfg *Config) []string {
+	var cleared []string
+	drop := func(key string, v *string) {
+		if *v != "" {
+			*v = ""
+			cleared = append(cleared, key)
+		}
+	}
+	drop("sshCommand", &cfg.SSHCommand)
+	drop("sshBinary", &cfg.SSHBinary)
+	if cfg.Askpass != AskpassPrompt {
+		drop("askpass", &cfg.Askpass)
+	}
+	for i := range cfg.Rules {
+		r := &cfg.Rules[i]
+		drop(fmt.Sprintf("rules[%d].sshCommand", i), &r.SSHCommand)
+		drop(fmt.Sprintf("rules[%d].credentialHelper", i), &r.CredentialHelper)
+		if r.SecurityKeyProvider != "internal" {
+			drop(fmt.Sprintf("rules[%d].securityKeyProvider", i), &r.SecurityKeyProvider)
+		}
+		for _, name := range slices.Sorted(maps.Keys(r.Env)) {
+			if !untrustedEnv[strings.ToUpper(name)] {
+				delete(r.Env, name)
+				cleared = append(cleared, fmt.Sprintf("rules[%d].env.%s", i, name))
+			}
+		}
+	}
+	for i := range cfg.HostDefaults {
+		d := &cfg.HostDefaults[i]
+		d.Options = slices.DeleteFunc(d.Options, func(o string) bool {
+			name := sshOptionName(o)
+			if !commandOptions[strings.ToLower(name)] {
+				return false
+			}
+			cleared = append(cleared, fmt.Sprintf("hostDefaults[%d].options %s", i, name))
+			return true
+		})
+	}
+	return cleared
+}
+
+// readSignature returns the signature file at path, or nil when there is
+// none.
+func readSignature(path string) []byte {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+func signatureError(err error) error {
+	if errors.Is(err, signature.ErrNoSignature) {
+		return errors.New("not signed by a trusted key (no .sig or .minisig file for the trusted key types)")
+	}
+	return fmt.Errorf("signature does not verify: %w", err)
+}
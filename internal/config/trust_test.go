@@ -0,0 +1,177 @@
+package config
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// minisignFiles returns a minisign public key and a function that writes
+// the .minisig of a file, as minisign -S -l would.
+func minisignFiles(t *testing.T) (string, func(path string)) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := []byte("mgittest")
+	key := base64.StdEncoding.EncodeToString(append(append([]byte("Ed"), id...), pub...))
+	return key, func(path string) {
+		t.Helper()
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig := ed25519.Sign(priv, data)
+		trusted := "timestamp:1700000000"
+		global := ed25519.Sign(priv, append(append([]byte{}, sig...), trusted...))
+		out := "untrusted comment: test\n" + base64.StdEncoding.EncodeToString(append(append([]byte("Ed"), id...), sig...)) +
+			"\ntrusted comment: " + trusted + "\n" + base64.StdEncoding.EncodeToString(global) + "\n"
+		if err := os.WriteFile(path+".minisig", []byte(out), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestVerifyFile(t *testing.T) {
+	dir := t.TempDir()
+	keys := filepath.Join(dir, "trusted_keys")
+	t.Setenv(TrustedKeysEnv, keys)
+	path := filepath.Join(dir, "shared.json")
+	if err := os.WriteFile(path, []byte(`{"version":1,"rules":[]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := VerifyFile(path); err != nil {
+		t.Fatalf("without trusted keys: %v", err)
+	}
+	key, sign := minisignFiles(t)
+	if err := os.WriteFile(keys, []byte("untrusted comment: team\n"+key+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyFile(path); err == nil || !strings.Contains(err.Error(), "not signed") {
+		t.Fatalf("unsigned: %v", err)
+	}
+	sign(path)
+	if err := VerifyFile(path); err != nil {
+		t.Fatalf("signed: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(`{"version":1,"rules":[{"host":"*","key":"/evil"}]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyFile(path); err == nil || !strings.Contains(err.Error(), "does not verify") {
+		t.Fatalf("modified after signing: %v", err)
+	}
+}
+
+func TestFetchRemoteRulesVerifiesSignature(t *testing.T) {
+	dir := t.TempDir()
+	keys := filepath.Join(dir, "trusted_keys")
+	t.Setenv(TrustedKeysEnv, keys)
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(dir, "cache"))
+	t.Setenv("HOME", filepath.Join(dir, "cache"))
+	key, sign := minisignFiles(t)
+	if err := os.WriteFile(keys, []byte(key+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "rules.json")
+	if err := os.WriteFile(file, []byte(`[{"host":"github.com","owner":"a","key":"/k"}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "config.json")
+	cfg := &Config{Version: 1, RemoteRules: "file://" + file}
+
+	rr, err := LoadRemoteRules(path, cfg, false)
+	if err != nil || rr.SignatureErr == nil || len(rr.Rules) != 1 {
+		t.Fatalf("unsigned: rr=%+v err=%v, want the rules with SignatureErr", rr, err)
+	}
+	if _, err := os.Stat(RemoteRulesCachePath(path)); err == nil {
+		t.Fatal("unsigned rules were cached")
+	}
+	sign(file)
+	if rr, err = LoadRemoteRules(path, cfg, false); err != nil || rr.SignatureErr != nil {
+		t.Fatalf("signed: rr=%+v err=%v", rr, err)
+	}
+	if rr := readRemoteRulesCache(path, cfg.RemoteRules); rr == nil || !rr.verified {
+		t.Fatalf("cache = %+v, want the verified rules", rr)
+	}
+}
+
+func TestLoadVerified(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "home"))
+	keys := filepath.Join(dir, "trusted_keys")
+	t.Setenv(TrustedKeysEnv, keys)
+	path := filepath.Join(dir, "repo", ".mgit", "config.json")
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(`{"version":1,"rules":[]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	global, err := GlobalDefaultPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(global), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(global, []byte(`{"version":1,"rules":[]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg, trusted, sigErr, err := LoadVerified(path); err != nil || sigErr != nil || cfg == nil || trusted {
+		t.Fatalf("without trusted keys: cfg=%v trusted=%v sigErr=%v err=%v; want it loaded, untrusted", cfg, trusted, sigErr, err)
+	}
+	key, sign := minisignFiles(t)
+	if err := os.WriteFile(keys, []byte(key+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, trusted, sigErr, err := LoadVerified(global); err != nil || sigErr != nil || !trusted {
+		t.Fatalf("global config: trusted=%v sigErr=%v err=%v", trusted, sigErr, err)
+	}
+	if cfg, trusted, sigErr, err := LoadVerified(path); err != nil || cfg == nil || trusted || sigErr == nil || !strings.Contains(sigErr.Error(), "not signed") {
+		t.Fatalf("unsigned: cfg=%v trusted=%v sigErr=%v err=%v", cfg, trusted, sigErr, err)
+	}
+	sign(path)
+	if _, trusted, sigErr, err := LoadVerified(path); err != nil || sigErr != nil || !trusted {
+		t.Fatalf("signed: trusted=%v sigErr=%v err=%v", trusted, sigErr, err)
+	}
+	if err := os.WriteFile(path, []byte(`{"version":1,"rules":[{"host":"*","key":"/evil"}]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if cfg, trusted, sigErr, err := LoadVerified(path); err != nil || trusted || sigErr == nil || len(cfg.Rules) != 1 {
+		t.Fatalf("modified after signing: cfg=%v trusted=%v sigErr=%v err=%v; want the new rules, unverified", cfg, trusted, sigErr, err)
+	}
+	if err := os.WriteFile(path, []byte(`{`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := LoadVerified(path); err == nil || !strings.Contains(err.Error(), "parse JSON") {
+		t.Fatalf("broken config error = %v", err)
+	}
+}
+
+func TestRestrictUntrusted(t *testing.T) {
+	cfg := &Config{SSHCommand: "/tmp/x", SSHBinary: "/tmp/ssh", Askpass: "/tmp/askpass", Rules: []Rule{
+		{Host: "a", SecurityKeyProvider: "internal", Env: map[string]string{"https_proxy": "http://proxy:3128", "GIT_SSL_CAINFO": "/ca.pem"}},
+		{Host: "b", SSHCommand: "/tmp/y", CredentialHelper: "!/tmp/helper", SecurityKeyProvider: "/tmp/sk.so", Env: map[string]string{"GIT_PROXY_COMMAND": "/tmp/z", "LD_PRELOAD": "/tmp/z.so", "NO_PROXY": "corp"}},
+	}, HostDefaults: []HostDefault{
+		{Host: "*", Options: []string{"ControlMaster=auto", "proxycommand=sh -c x", "LocalCommand /tmp/x", "PermitLocalCommand=yes"}},
+	}}
+	got := RestrictUntrusted(cfg)
+	if want := []string{"sshCommand", "sshBinary", "askpass", "rules[1].sshCommand", "rules[1].credentialHelper", "rules[1].securityKeyProvider", "rules[1].env.GIT_PROXY_COMMAND", "rules[1].env.LD_PRELOAD",
+		"hostDefaults[0].options proxycommand", "hostDefaults[0].options LocalCommand", "hostDefaults[0].options PermitLocalCommand"}; !slices.Equal(got, want) {
+		t.Errorf("cleared %q, want %q", got, want)
+	}
+	if cfg.SSHCommand != "" || cfg.SSHBinary != "" || cfg.Askpass != "" || cfg.Rules[1].SSHCommand != "" || cfg.Rules[1].CredentialHelper != "" || cfg.Rules[0].SecurityKeyProvider != "internal" || cfg.Rules[1].SecurityKeyProvider != "" || len(cfg.Rules[0].Env) != 2 || len(cfg.Rules[1].Env) != 1 || !slices.Equal(cfg.HostDefaults[0].Options, []string{"ControlMaster=auto"}) {
+		t.Errorf("not cleared: %+v", cfg)
+	}
+	prompt := &Config{Askpass: AskpassPrompt}
+	if got := RestrictUntrusted(prompt); len(got) != 0 || prompt.Askpass != AskpassPrompt {
+		t.Errorf("askpass prompt cleared: %q", got)
+	}
+}
@@ -0,0 +1,59 @@
+package config
+
+import (
+	pkgconfig "github.com/pavelBuzdanov/mgit/pkg/config"
+)
+
+// The config types, path resolution and the plain loader live in pkg/config,
+// the read-only view other tools embed. They are repeated here so the rest
+// of mgit keeps importing one config package.
+type (
+	Config          = pkgconfig.Config
+	Rule            = pkgconfig.Rule
+	Pin             = pkgconfig.Pin
+	HostDefault     = pkgconfig.HostDefault
+	PolicyEntry     = pkgconfig.PolicyEntry
+	PolicyMatch     = pkgconfig.PolicyMatch
+	ValidationIssue = pkgconfig.ValidationIssue
+)
+
+const (
+	CurrentVersion         = pkgconfig.CurrentVersion
+	RepoConfigRelativePath = pkgconfig.RepoConfigRelativePath
+	DefaultKeyRuleID       = pkgconfig.DefaultKeyRuleID
+	PinnedRuleID           = pkgconfig.PinnedRuleID
+	SSHBinaryEnv           = pkgconfig.SSHBinaryEnv
+	AskpassEnv             = pkgconfig.AskpassEnv
+	AskpassPrompt          = pkgconfig.AskpassPrompt
+	EnvSource              = pkgconfig.EnvSource
+	RulesEnv               = pkgconfig.RulesEnv
+	DefaultKeyEnv          = pkgconfig.DefaultKeyEnv
+)
+
+var ErrEnvSource = pkgconfig.ErrEnvSource
+
+func ParseTags(s string) []string { return pkgconfig.ParseTags(s) }
+
+func GlobalDefaultPath() (string, error) { return pkgconfig.GlobalDefaultPath() }
+
+func DefaultPath() (string, error) { return pkgconfig.DefaultPath() }
+
+func ResolvePath(custom string) (string, error) { return pkgconfig.ResolvePath(custom) }
+
+func ResolvePathIn(custom, dir string) (string, error) { return pkgconfig.ResolvePathIn(custom, dir) }
+
+func AutoPath() (string, error) { return pkgconfig.AutoPath() }
+
+func AutoPathIn(dir string) (string, error) { return pkgconfig.AutoPathIn(dir) }
+
+func FindNearestConfig(start string) (string, bool, error) { return pkgconfig.FindNearestConfig(start) }
+
+func FindRepoRoot(start string) (string, bool, error) { return pkgconfig.FindRepoRoot(start) }
+
+func ExpandPath(p string) (string, error) { return pkgconfig.ExpandPath(p) }
+
+func IsEnvSource(path string) bool { return pkgconfig.IsEnvSource(path) }
+
+func DescribePath(path string) string { return pkgconfig.DescribePath(path) }
+
+func LoadEnv() (*Config, error) { return pkgconfig.LoadEnv() }
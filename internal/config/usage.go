@@ -0,0 +1,80 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// RuleUsage counts how often a rule was used by mgit exec and when it was
+// last used. Key is the key or agent identity the rule pointed at then.
+type RuleUsage struct {
+	Key      string `json:"key,omitempty"`
+	Count    int    `json:"count"`
+	LastUsed string `json:"lastUsed"`
+}
+
+// Usage maps rule IDs to their recorded usage.
+type Usage map[string]RuleUsage
+
+// UsagePath is the usage file for the config at path: stats.json next to it.
+// Usage is only recorded when the config has Stats enabled.
+func UsagePath(path string) string {
+	return filepath.Join(filepath.Dir(path), "stats.json")
+}
+
+// LoadUsage reads the usage recorded for the config at path. No file means
+// nothing has been recorded yet.
+func LoadUsage(path string) (Usage, error) {
+	resolved, err := ResolvePath(path)
+	if err != nil || IsEnvSource(resolved) {
+		return Usage{}, err
+	}
+	data, err := os.ReadFile(UsagePath(resolved))
+	if errors.Is(err, fs.ErrNotExist) {
+		return Usage{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read usage stats: %w", err)
+	}
+	usage := Usage{}
+	if err := json.Unmarshal(data, &usage); err != nil {
+		return nil, fmt.Errorf("parse usage stats %s: %w", UsagePath(resolved), err)
+	}
+	return usage, nil
+}
+
+// RecordUsage counts one use of rule at now for the config at path.
+func RecordUsage(path string, rule Rule, now time.Time) error {
+	resolved, err := ResolvePath(path)
+	if err != nil || IsEnvSource(resolved) {
+		return err // an env config has nowhere to keep stats
+	}
+	file := UsagePath(resolved)
+	unlock, err := Lock(file)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	usage, err := LoadUsage(resolved)
+	if err != nil {
+		return err
+	}
+	u := usage[rule.ID]
+	u.Count++
+	u.LastUsed = Timestamp(now)
+	u.Key = rule.Key
+	if rule.UsesAgent() {
+		u.Key = rule.Agent
+	}
+	usage[rule.ID] = u
+	data, err := json.MarshalIndent(usage, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode usage stats: %w", err)
+	}
+	return writeFileAtomic(file, append(data, '\n'))
+}
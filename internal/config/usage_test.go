@@ -0,0 +1,31 @@
+package config
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRecordUsage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".mgit", "config.json")
+	work := Rule{ID: "work", Key: "~/.ssh/work"}
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		if err := RecordUsage(path, work, now.Add(time.Duration(i)*time.Hour)); err != nil {
+			t.Fatalf("RecordUsage() error = %v", err)
+		}
+	}
+	if err := RecordUsage(path, Rule{ID: "agent", Agent: "SHA256:abc"}, now); err != nil {
+		t.Fatalf("RecordUsage() error = %v", err)
+	}
+	usage, err := LoadUsage(path)
+	if err != nil {
+		t.Fatalf("LoadUsage() error = %v", err)
+	}
+	if got := usage["work"]; got.Count != 3 || got.LastUsed != "2026-03-01T14:00:00Z" || got.Key != "~/.ssh/work" {
+		t.Fatalf("usage[work] = %+v", got)
+	}
+	if got := usage["agent"]; got.Count != 1 || got.Key != "SHA256:abc" {
+		t.Fatalf("usage[agent] = %+v", got)
+	}
+}
@@ -0,0 +1,146 @@
+package doctor
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/pavelBuzdanov/mgit/internal/config"
+	"github.com/pavelBuzdanov/mgit/internal/resolve"
+)
+
+// SeenRemote is a git remote found in a repository, for Coverage.
+type SeenRemote struct {
+	Repo string `json:"repo"`
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// CoveragePair is one (host, owner) seen across remotes and the rule that
+// wins it. Remotes whose names make a different rule win get their own pair.
+type CoveragePair struct {
+	Host      string `json:"host"`
+	Owner     string `json:"owner"`
+	Transport string `json:"transport"`
+	// Remotes are "repo:remote" (just the remote for the current repo).
+	Remotes  []string `json:"remotes"`
+	Rule     string   `json:"rule,omitempty"`
+	Fallback bool     `json:"fallback,omitempty"`
+	// Hole: an SSH pair no rule covers (the defaultKey fallback counts).
+	Hole bool `json:"hole,omitempty"`
+	// Losing are other rules that match the pair but lose to Rule.
+	Losing []string `json:"losing,omitempty"`
+}
+
+// RuleCoverage says how a rule fared across all pairs: "used" when it wins
+// at least one, "shadowed" when it matches some but always loses, "unused"
+// when it matches none.
+type RuleCoverage struct {
+	ID         string   `json:"id"`
+	Host       string   `json:"host"`
+	Owner      string   `json:"owner"`
+	Status     string   `json:"status"`
+	Pairs      int      `json:"pairs"`
+	ShadowedBy []string `json:"shadowedBy,omitempty"`
+}
+
+// CoverageReport is the result of doctor --coverage.
+type CoverageReport struct {
+	Pairs []CoveragePair `json:"pairs"`
+	Rules []RuleCoverage `json:"rules"`
+	// MissingRules has one host/owner stub per hole, ready to be completed
+	// with a key and added (e.g. with mgit rule add).
+	MissingRules []config.Rule `json:"missingRules"`
+	// Skipped are remotes that are not network URLs (local paths, bundles).
+	Skipped []SeenRemote `json:"skipped,omitempty"`
+}
+
+// Coverage matches every seen remote against cfg's rules.
+func Coverage(cfg *config.Config, remotes []SeenRemote) CoverageReport {
+	rep := CoverageReport{Pairs: []CoveragePair{}, MissingRules: []config.Rule{}}
+	index := map[string]int{}
+	wins := make([]int, len(cfg.Rules))
+	matched := make([]bool, len(cfg.Rules))
+	shadowedBy := make([][]string, len(cfg.Rules))
+	for _, sr := range remotes {
+		parsed, err := resolve.ParseRemote(cfg, sr.Name, sr.URL)
+		if err != nil {
+			rep.Skipped = append(rep.Skipped, sr)
+			continue
+		}
+		cands, err := resolve.Candidates(cfg, sr.Name, sr.URL)
+		if err != nil {
+			rep.Skipped = append(rep.Skipped, sr)
+			continue
+		}
+		winner := -1
+		for _, c := range cands {
+			if c.Selected {
+				winner = c.Index
+			}
+		}
+		rule := ""
+		if winner >= 0 {
+			rule = cfg.Rules[winner].ID
+		}
+		owner := strings.ToLower(parsed.Owner)
+		key := strings.Join([]string{parsed.Host, owner, string(parsed.Transport), rule}, "|")
+		label := sr.Name
+		if sr.Repo != "" {
+			label = sr.Repo + ":" + sr.Name
+		}
+		if i, ok := index[key]; ok {
+			rep.Pairs[i].Remotes = append(rep.Pairs[i].Remotes, label)
+			continue
+		}
+		pair := CoveragePair{Host: parsed.Host, Owner: owner, Transport: string(parsed.Transport), Remotes: []string{label}, Rule: rule}
+		if parsed.IsSSH() && winner < 0 {
+			pair.Fallback = cfg.DefaultKey != ""
+			pair.Hole = true
+			rep.MissingRules = append(rep.MissingRules, config.Rule{Host: parsed.Host, Owner: parsed.Owner})
+		}
+		for _, c := range cands {
+			if !c.Matched {
+				continue
+			}
+			matched[c.Index] = true
+			if c.Selected {
+				wins[c.Index]++
+				continue
+			}
+			pair.Losing = append(pair.Losing, c.ID)
+			if !slices.Contains(shadowedBy[c.Index], rule) {
+				shadowedBy[c.Index] = append(shadowedBy[c.Index], rule)
+			}
+		}
+		index[key] = len(rep.Pairs)
+		rep.Pairs = append(rep.Pairs, pair)
+	}
+	slices.SortStableFunc(rep.Pairs, func(a, b CoveragePair) int {
+		return strings.Compare(a.Host+"/"+a.Owner, b.Host+"/"+b.Owner)
+	})
+	for i, r := range cfg.Rules {
+		rc := RuleCoverage{ID: r.ID, Host: r.Host, Owner: r.Owner, Pairs: wins[i]}
+		switch {
+		case wins[i] > 0:
+			rc.Status = "used"
+		case matched[i]:
+			rc.Status = "shadowed"
+			rc.ShadowedBy = shadowedBy[i]
+		default:
+			rc.Status = "unused"
+		}
+		rep.Rules = append(rep.Rules, rc)
+	}
+	return rep
+}
+
+// Holes counts the pairs no rule covers.
+func (r CoverageReport) Holes() int {
+	n := 0
+	for _, p := range r.Pairs {
+		if p.Hole {
+			n++
+		}
+	}
+	return n
+}
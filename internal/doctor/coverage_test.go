@@ -0,0 +1,59 @@
+package doctor
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/pavelBuzdanov/mgit/internal/config"
+)
+
+func TestCoverage(t *testing.T) {
+	cfg := &config.Config{
+		Version:    1,
+		DefaultKey: "~/.ssh/id_ed25519",
+		Rules: []config.Rule{
+			{ID: "r_org", Host: "github.com", Owner: "acme", Key: "~/.ssh/acme"},
+			{ID: "r_any", Host: "github.com", Owner: "*", Key: "~/.ssh/personal", Priority: -1},
+			{ID: "r_acme2", Host: "github.com", Owner: "acme", Key: "~/.ssh/acme2", Priority: -5},
+			{ID: "r_gitlab", Host: "gitlab.com", Owner: "grp", Key: "~/.ssh/gl"},
+		},
+	}
+	rep := Coverage(cfg, []SeenRemote{
+		{Repo: "api", Name: "origin", URL: "git@github.com:acme/api.git"},
+		{Repo: "web", Name: "origin", URL: "git@github.com:acme/web.git"},
+		{Repo: "web", Name: "fork", URL: "git@bitbucket.org:me/web.git"},
+		{Repo: "docs", Name: "origin", URL: "../docs.git"},
+	})
+
+	if len(rep.Pairs) != 2 {
+		t.Fatalf("pairs = %+v, want 2", rep.Pairs)
+	}
+	acme := rep.Pairs[1]
+	if acme.Host != "github.com" || acme.Rule != "r_org" || !slices.Equal(acme.Remotes, []string{"api:origin", "web:origin"}) {
+		t.Errorf("acme pair = %+v", acme)
+	}
+	if !slices.Equal(acme.Losing, []string{"r_any", "r_acme2"}) {
+		t.Errorf("acme losing = %q", acme.Losing)
+	}
+	hole := rep.Pairs[0]
+	if hole.Host != "bitbucket.org" || !hole.Hole || !hole.Fallback || hole.Rule != "" {
+		t.Errorf("hole pair = %+v", hole)
+	}
+	if rep.Holes() != 1 || len(rep.MissingRules) != 1 || rep.MissingRules[0].Host != "bitbucket.org" || rep.MissingRules[0].Owner != "me" {
+		t.Errorf("missing rules = %+v", rep.MissingRules)
+	}
+	if len(rep.Skipped) != 1 || rep.Skipped[0].Repo != "docs" {
+		t.Errorf("skipped = %+v", rep.Skipped)
+	}
+
+	status := map[string]string{}
+	for _, r := range rep.Rules {
+		status[r.ID] = r.Status
+	}
+	want := map[string]string{"r_org": "used", "r_any": "shadowed", "r_acme2": "shadowed", "r_gitlab": "unused"}
+	for id, s := range want {
+		if status[id] != s {
+			t.Errorf("rule %s status = %q, want %q", id, status[id], s)
+		}
+	}
+}
@@ -3,113 +3,267 @@ package doctor
 import (
 	"context"
 	"fmt"
+	"os/exec"
 	"sort"
+	"strings"
+	"sync"
+	"time"
 
-	"mgit/internal/config"
-	"mgit/internal/resolve"
-	"mgit/internal/runner"
+	"github.com/pavelBuzdanov/mgit/internal/config"
+	"github.com/pavelBuzdanov/mgit/internal/resolve"
+	"github.com/pavelBuzdanov/mgit/internal/runner"
+	"github.com/pavelBuzdanov/mgit/pkg/matcher"
 )
 
 type Check struct {
 	Name    string `json:"name"`
 	Status  string `json:"status"` // ok|warn|error
 	Message string `json:"message"`
+	// Fix is a shell command that addresses the finding, for --emit-fixes.
+	Fix string `json:"fix,omitempty"`
 }
 
 type RemoteReport struct {
-	Name    string          `json:"name"`
-	URL     string          `json:"url"`
-	Result  *resolve.Result `json:"result,omitempty"`
-	Error   string          `json:"error,omitempty"`
-	Warning string          `json:"warning,omitempty"`
+	Name       string          `json:"name"`
+	URL        string          `json:"url"`
+	Result     *resolve.Result `json:"result,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	Warning    string          `json:"warning,omitempty"`
+	Fix        string          `json:"fix,omitempty"`
+	Connection *Connection     `json:"connection,omitempty"`
+}
+
+// Connection is the outcome of `doctor --connect`: an SSH handshake with the
+// remote's host using the key its rule resolves to.
+type Connection struct {
+	OK      bool   `json:"ok"`
+	Message string `json:"message,omitempty"`
 }
 
 type Report struct {
-	ConfigPath    string                   `json:"configPath"`
-	Checks        []Check                  `json:"checks"`
-	ConfigIssues  []config.ValidationIssue `json:"configIssues,omitempty"`
-	Remotes       []RemoteReport           `json:"remotes,omitempty"`
-	Unmatched     []string                 `json:"unmatchedRemotes,omitempty"`
-	GitVersion    string                   `json:"gitVersion,omitempty"`
-	IsGitRepo     bool                     `json:"isGitRepo"`
-	ConfigLoaded  bool                     `json:"configLoaded"`
+	ConfigPath   string                   `json:"configPath"`
+	Checks       []Check                  `json:"checks"`
+	ConfigIssues []config.ValidationIssue `json:"configIssues,omitempty"`
+	// SharedKeys lists the keys rules use for unrelated hosts, with the
+	// hosts and rules per key; configIssues has a warning for each.
+	SharedKeys   []config.SharedKey `json:"sharedKeys,omitempty"`
+	Remotes      []RemoteReport     `json:"remotes,omitempty"`
+	Unmatched    []string           `json:"unmatchedRemotes,omitempty"`
+	GitVersion   string             `json:"gitVersion,omitempty"`
+	IsGitRepo    bool               `json:"isGitRepo"`
+	ConfigLoaded bool               `json:"configLoaded"`
 }
 
+// Parallelism bounds how many remotes doctor resolves, inspects or connects
+// to at once.
+const Parallelism = 8
+
+// Build runs the checks and resolves every remote of the repository git
+// works in. Independent checks run concurrently, as does the per-remote
+// work, but the report lists them in a fixed order. git's shell must be
+// safe for concurrent use (see runner.Shell.SerializeOutput).
 func Build(ctx context.Context, git *runner.GitOps, cfg *config.Config, cfgPath string) Report {
 	rep := Report{ConfigPath: cfgPath}
 
+	// Validate normalizes cfg in place, so everything reading cfg runs in
+	// one goroutine until resolution starts.
+	var gitChecks, cfgChecks, repoChecks []Check
+	var remotes map[string]string
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		gitChecks = gitVersionChecks(ctx, git, &rep)
+	}()
+	go func() {
+		defer wg.Done()
+		cfgChecks = append([]Check{sshClientCheck(ctx, cfg)}, configChecks(cfg, cfgPath, &rep)...)
+	}()
+	go func() {
+		defer wg.Done()
+		repoChecks, remotes = repoRemotes(ctx, git, &rep)
+	}()
+	wg.Wait()
+	rep.Checks = append(append(append(rep.Checks, gitChecks...), cfgChecks...), repoChecks...)
+	if len(remotes) == 0 {
+		return rep
+	}
+
+	names := make([]string, 0, len(remotes))
+	for name := range remotes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	rep.Remotes = make([]RemoteReport, len(names))
+	unmatched := make([]bool, len(names))
+	forEach(len(names), func(i int) {
+		rep.Remotes[i], unmatched[i] = remoteReport(cfg, names[i], remotes[names[i]])
+	})
+	for i, name := range names {
+		if unmatched[i] {
+			rep.Unmatched = append(rep.Unmatched, name)
+		}
+	}
+	rep.Checks = append(rep.Checks, keyFileChecks(rep.Remotes, config.KnownHostsFiles())...)
+	rep.Checks = append(rep.Checks, sshCommandChecks(ctx, git, rep.Remotes)...)
+	return rep
+}
+
+// gitVersionChecks reports the git version and the features it lacks.
+func gitVersionChecks(ctx context.Context, git *runner.GitOps, rep *Report) []Check {
 	if err := runner.GitInstalled(); err != nil {
-		rep.Checks = append(rep.Checks, Check{Name: "git", Status: "error", Message: err.Error()})
-	} else {
-		ver, err := git.GitVersion(ctx)
-		if err != nil {
-			rep.Checks = append(rep.Checks, Check{Name: "git", Status: "warn", Message: err.Error()})
-		} else {
-			rep.GitVersion = ver
-			rep.Checks = append(rep.Checks, Check{Name: "git", Status: "ok", Message: ver})
+		if git.UsesGoGit() {
+			return []Check{{Name: "git", Status: "warn", Message: err.Error() + "; clone, fetch and push run with the go-git backend, other git commands fail"}}
 		}
+		return []Check{{Name: "git", Status: "error", Message: err.Error()}}
 	}
+	ver, err := git.GitVersion(ctx)
+	if err != nil {
+		return []Check{{Name: "git", Status: "warn", Message: err.Error()}}
+	}
+	rep.GitVersion = ver
+	checks := []Check{{Name: "git", Status: "ok", Message: ver}}
+	for _, d := range runner.CapabilitiesFor(ver).Degraded() {
+		checks = append(checks, Check{Name: "git-capabilities", Status: "warn", Message: d})
+	}
+	return checks
+}
 
-	if cfg != nil {
-		rep.ConfigLoaded = true
-		issues := cfg.Validate()
-		rep.ConfigIssues = issues
-		if config.HasErrors(issues) {
-			rep.Checks = append(rep.Checks, Check{Name: "config", Status: "error", Message: "config validation failed"})
-		} else if len(issues) > 0 {
-			rep.Checks = append(rep.Checks, Check{Name: "config", Status: "warn", Message: "config has warnings"})
+// configChecks validates cfg and reports rotation, plink and pin findings.
+func configChecks(cfg *config.Config, cfgPath string, rep *Report) []Check {
+	if cfg == nil {
+		return []Check{{Name: "config", Status: "error", Message: "config not loaded"}}
+	}
+	var checks []Check
+	rep.ConfigLoaded = true
+	issues := append(config.Validate(cfg), matcher.AmbiguityIssues(cfg.Rules)...)
+	rep.ConfigIssues = issues
+	rep.SharedKeys = config.CrossHostKeys(cfg)
+	if config.HasErrors(issues) {
+		checks = append(checks, Check{Name: "config", Status: "error", Message: "config validation failed"})
+	} else if len(issues) > 0 {
+		checks = append(checks, Check{Name: "config", Status: "warn", Message: "config has warnings"})
+	} else {
+		checks = append(checks, Check{Name: "config", Status: "ok", Message: "config is valid"})
+	}
+	if config.IsEnvSource(cfgPath) {
+		checks = append(checks, Check{Name: "config-source", Status: "ok", Message: fmt.Sprintf("read from %s, %d rule(s)", config.DescribePath(cfgPath), len(cfg.Rules))})
+	}
+	checks = append(checks, rotationChecks(cfg.Rules, time.Now())...)
+	checks = append(checks, plinkChecks(cfg)...)
+	if cfg.Pin != nil {
+		if _, _, err := config.PinnedRule(cfg); err != nil {
+			checks = append(checks, Check{Name: "pin", Status: "error", Message: err.Error(), Fix: "mgit unpin"})
 		} else {
-			rep.Checks = append(rep.Checks, Check{Name: "config", Status: "ok", Message: "config is valid"})
+			checks = append(checks, Check{Name: "pin", Status: "ok", Message: resolve.PinNote(cfg.Pin)})
 		}
-	} else {
-		rep.Checks = append(rep.Checks, Check{Name: "config", Status: "error", Message: "config not loaded"})
 	}
+	return checks
+}
 
+// repoRemotes checks that git works in a repository and returns its
+// remotes, none when there is no repository to read them from.
+func repoRemotes(ctx context.Context, git *runner.GitOps, rep *Report) ([]Check, map[string]string) {
 	isRepo, err := git.IsRepo(ctx)
 	if err != nil {
-		rep.IsGitRepo = false
-		rep.Checks = append(rep.Checks, Check{Name: "repo", Status: "warn", Message: "not a git repository (or git unavailable in current directory)"})
-		return rep
+		return []Check{{Name: "repo", Status: "warn", Message: "not a git repository (or git unavailable in current directory)"}}, nil
 	}
 	rep.IsGitRepo = isRepo
 	if !isRepo {
-		rep.Checks = append(rep.Checks, Check{Name: "repo", Status: "warn", Message: "current directory is not a git repository"})
-		return rep
+		return []Check{{Name: "repo", Status: "warn", Message: "current directory is not a git repository"}}, nil
 	}
-	rep.Checks = append(rep.Checks, Check{Name: "repo", Status: "ok", Message: "inside git repository"})
-
+	checks := []Check{{Name: "repo", Status: "ok", Message: "inside git repository"}}
 	remotes, err := git.Remotes(ctx)
 	if err != nil {
-		rep.Checks = append(rep.Checks, Check{Name: "remotes", Status: "error", Message: fmt.Sprintf("failed to read remotes: %v", err)})
-		return rep
+		return append(checks, Check{Name: "remotes", Status: "error", Message: fmt.Sprintf("failed to read remotes: %v", err)}), nil
 	}
 	if len(remotes) == 0 {
-		rep.Checks = append(rep.Checks, Check{Name: "remotes", Status: "warn", Message: "no remotes configured"})
-		return rep
+		return append(checks, Check{Name: "remotes", Status: "warn", Message: "no remotes configured"}), nil
 	}
-	rep.Checks = append(rep.Checks, Check{Name: "remotes", Status: "ok", Message: fmt.Sprintf("%d remote(s) found", len(remotes))})
+	return append(checks, Check{Name: "remotes", Status: "ok", Message: fmt.Sprintf("%d remote(s) found", len(remotes))}), remotes
+}
 
-	names := make([]string, 0, len(remotes))
-	for name := range remotes {
-		names = append(names, name)
+// remoteReport resolves one remote; unmatched is set when no rule covers it.
+func remoteReport(cfg *config.Config, name, url string) (rr RemoteReport, unmatched bool) {
+	rr = RemoteReport{Name: name, URL: url}
+	if cfg == nil {
+		rr.Warning = "config not loaded"
+		return rr, false
 	}
-	sort.Strings(names)
-	for _, name := range names {
-		url := remotes[name]
-		rr := RemoteReport{Name: name, URL: url}
-		if cfg == nil {
-			rr.Warning = "config not loaded"
-			rep.Remotes = append(rep.Remotes, rr)
-			continue
+	res, err := resolve.FromRemote(cfg, name, url)
+	if err != nil {
+		rr.Error = err.Error()
+		if noRuleMatches(cfg, name, url) {
+			rr.Fix = "mgit rule add " + runner.ShellArg(url)
 		}
-		res, err := resolve.FromURL(cfg, url)
-		if err != nil {
-			rr.Error = err.Error()
-			rep.Unmatched = append(rep.Unmatched, name)
-		} else {
-			rr.Result = res
+		return rr, true
+	}
+	rr.Result = res
+	var warnings []string
+	if res.Fallback {
+		warnings = append(warnings, "no rule matched; fallback defaultKey used")
+		rr.Fix = fmt.Sprintf("mgit rule add --host %s --owner %s --key %s", runner.ShellArg(res.Parsed.Host), runner.ShellArg(res.Parsed.Owner), runner.ShellArg(res.KeyPath))
+	}
+	if res.KeyNeedsPassphrase {
+		warnings = append(warnings, resolve.PassphraseWarning(res.KeyPath))
+	}
+	rr.Warning = strings.Join(warnings, "; ")
+	return rr, false
+}
+
+// forEach calls fn for 0 through n-1, at most Parallelism calls at a time,
+// and returns when all are done.
+func forEach(n int, fn func(i int)) {
+	sem := make(chan struct{}, Parallelism)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
+
+// sshClientCheck finds the ssh client rules without their own sshCommand use
+// and reports its version.
+func sshClientCheck(ctx context.Context, cfg *config.Config) Check {
+	var client runner.SSHClient
+	if cfg != nil {
+		var err error
+		if client, err = config.SSHClientFor(cfg, config.Rule{}); err != nil {
+			return Check{Name: "ssh", Status: "error", Message: err.Error()}
 		}
-		rep.Remotes = append(rep.Remotes, rr)
 	}
-	return rep
+	ver, err := client.Version(ctx)
+	if err != nil {
+		return Check{Name: "ssh", Status: "error", Message: fmt.Sprintf("%v; set sshBinary in the config or %s to the ssh executable", err, config.SSHBinaryEnv)}
+	}
+	if path, err := exec.LookPath(client.Name()); err == nil {
+		return Check{Name: "ssh", Status: "ok", Message: fmt.Sprintf("%s (%s)", ver, path)}
+	}
+	return Check{Name: "ssh", Status: "ok", Message: ver}
+}
+
+func rotationChecks(rules []config.Rule, now time.Time) []Check {
+	var checks []Check
+	for _, r := range rules {
+		due, age := config.RotationDue(r, now)
+		if !due {
+			continue
+		}
+		checks = append(checks, Check{
+			Name:   "rotation",
+			Status: "warn",
+			Message: fmt.Sprintf(
+				"rule %s: key is %d days old (rotate after %s); run: mgit key rotate --rule %s",
+				r.ID, int(age.Hours()/24), r.RotateAfter, r.ID,
+			),
+			Fix: "mgit key rotate --rule " + runner.ShellArg(r.ID),
+		})
+	}
+	return checks
 }
@@ -0,0 +1,60 @@
+package doctor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"slices"
+	"testing"
+
+	"github.com/pavelBuzdanov/mgit/internal/config"
+	"github.com/pavelBuzdanov/mgit/internal/runner"
+)
+
+func TestBuildOrdersConcurrentWork(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	shell := runner.NewShell(io.Discard, io.Discard, false)
+	shell.Dir = dir
+	ctx := context.Background()
+	if err := shell.Run(ctx, "git", []string{"init", "-q"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	var names, unmatched []string
+	for i := 0; i < 3*Parallelism; i++ {
+		name, owner := fmt.Sprintf("r%02d", i), "known"
+		if i%3 == 0 {
+			owner = "other"
+			unmatched = append(unmatched, name)
+		}
+		names = append(names, name)
+		url := fmt.Sprintf("git@git.example.com:%s/%s.git", owner, name)
+		if err := shell.Run(ctx, "git", []string{"remote", "add", name, url}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg := &config.Config{Version: 1, Rules: []config.Rule{{ID: "known", Host: "git.example.com", Owner: "known", Key: "/tmp/key"}}}
+	shell.SerializeOutput()
+	rep := Build(ctx, runner.NewGitOps(shell), cfg, "config.json")
+
+	var got []string
+	for _, r := range rep.Remotes {
+		got = append(got, r.Name)
+	}
+	if !slices.Equal(got, names) || !slices.Equal(rep.Unmatched, unmatched) {
+		t.Fatalf("remotes = %q, unmatched = %q; want %q and %q", got, rep.Unmatched, names, unmatched)
+	}
+	var checks []string
+	for _, c := range rep.Checks {
+		if !slices.Contains(checks, c.Name) {
+			checks = append(checks, c.Name)
+		}
+	}
+	if want := []string{"git", "ssh", "config", "repo", "remotes"}; len(checks) < len(want) || !slices.Equal(checks[:len(want)], want) {
+		t.Fatalf("check order = %q, want it to start with %q", checks, want)
+	}
+}
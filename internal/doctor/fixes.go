@@ -0,0 +1,127 @@
+package doctor
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pavelBuzdanov/mgit/internal/config"
+	"github.com/pavelBuzdanov/mgit/internal/resolve"
+	"github.com/pavelBuzdanov/mgit/internal/runner"
+	"github.com/pavelBuzdanov/mgit/internal/sshkeys"
+)
+
+// Fix is one command of a doctor --emit-fixes script and the finding it
+// addresses.
+type Fix struct {
+	Finding string `json:"finding"`
+	Command string `json:"command"`
+}
+
+// Fixes collects the fix of every check and remote that has one, in report
+// order.
+func (r Report) Fixes() []Fix {
+	var fixes []Fix
+	for _, c := range r.Checks {
+		if c.Fix != "" {
+			fixes = append(fixes, Fix{Finding: c.Name + ": " + c.Message, Command: c.Fix})
+		}
+	}
+	for _, rr := range r.Remotes {
+		if rr.Fix == "" {
+			continue
+		}
+		finding := rr.Warning
+		if rr.Error != "" {
+			finding = rr.Error
+		}
+		fixes = append(fixes, Fix{Finding: "remote " + rr.Name + ": " + finding, Command: rr.Fix})
+	}
+	return fixes
+}
+
+// FixScript renders fixes as a POSIX shell script meant to be read before it
+// is run: every command follows a comment with the finding it fixes, and
+// the script stops at the first failure.
+func FixScript(fixes []Fix, now time.Time) string {
+	var b strings.Builder
+	b.WriteString("#!/bin/sh\n")
+	fmt.Fprintf(&b, "# Generated by mgit doctor --emit-fixes on %s.\n", now.Format(time.RFC3339))
+	b.WriteString("# Review every command before running it; nothing here has been applied yet.\n")
+	b.WriteString("set -eu\n")
+	if len(fixes) == 0 {
+		b.WriteString("\n# doctor found nothing it knows how to fix.\n")
+	}
+	for _, f := range fixes {
+		b.WriteString("\n")
+		for _, line := range strings.Split(f.Finding, "\n") {
+			b.WriteString("# " + line + "\n")
+		}
+		b.WriteString(f.Command + "\n")
+	}
+	return b.String()
+}
+
+// keyFileChecks warns about the key files and hosts of SSH remotes that ssh
+// would reject or stop at: private keys readable by others, and hosts missing
+// from knownHosts, which make the first connection prompt (or fail in batch
+// mode). Each key and host is reported once.
+func keyFileChecks(remotes []RemoteReport, knownHosts []string) []Check {
+	var checks []Check
+	seen := map[string]bool{}
+	for _, rr := range remotes {
+		res := rr.Result
+		if res == nil || !res.SSHSelectionApplies || res.Parsed == nil {
+			continue
+		}
+		if key := res.KeyPath; res.KeyProvider == "" && !sshkeys.IsAgentRef(key) && !seen["key:"+key] {
+			seen["key:"+key] = true
+			if mode, loose := sshkeys.LoosePermissions(key); loose {
+				checks = append(checks, Check{
+					Name:    "key-permissions",
+					Status:  "warn",
+					Message: fmt.Sprintf("%s is mode %04o; ssh ignores private keys others can read", key, mode),
+					Fix:     "chmod 600 " + runner.ShellArg(key),
+				})
+			}
+		}
+		// A host alias may be an ssh_config Host entry; only ssh knows
+		// which name it checks then.
+		p := res.Parsed
+		if p.Alias != "" || seen["host:"+p.Host+":"+p.Port] {
+			continue
+		}
+		seen["host:"+p.Host+":"+p.Port] = true
+		if known, err := sshkeys.IsKnownHost(knownHosts, p.Host, p.Port); err == nil && !known {
+			add := "mgit knownhosts add "
+			if p.Port != "" && p.Port != "22" {
+				add += "--port " + p.Port + " "
+			}
+			checks = append(checks, Check{
+				Name:    "known-hosts",
+				Status:  "warn",
+				Message: fmt.Sprintf("%s has no entry in known_hosts; the first connection asks to confirm its host key, and fails in batch mode", sshkeys.KnownHostName(p.Host, p.Port)),
+				Fix:     add + runner.ShellArg(p.Host),
+			})
+		}
+	}
+	return checks
+}
+
+// noRuleMatches reports whether url is an SSH remote that no rule matches.
+func noRuleMatches(cfg *config.Config, name, url string) bool {
+	parsed, err := resolve.ParseRemote(cfg, name, url)
+	if err != nil || !parsed.IsSSH() {
+		return false
+	}
+	cands, err := resolve.Candidates(cfg, name, url)
+	if err != nil {
+		return false
+	}
+	for _, c := range cands {
+		if c.Selected {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,71 @@
+package doctor
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pavelBuzdanov/mgit/internal/resolve"
+	"github.com/pavelBuzdanov/mgit/pkg/giturl"
+)
+
+func TestKeyFileChecks(t *testing.T) {
+	dir := t.TempDir()
+	key := filepath.Join(dir, "id work")
+	if err := os.WriteFile(key, []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	knownHosts := filepath.Join(dir, "known_hosts")
+	if err := os.WriteFile(knownHosts, []byte("github.com ssh-ed25519 AAAA\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	remote := func(host, port string) RemoteReport {
+		return RemoteReport{Result: &resolve.Result{
+			SSHSelectionApplies: true,
+			KeyPath:             key,
+			Parsed:              &giturl.ParsedRemote{Transport: giturl.TransportSSH, Host: host, Port: port},
+		}}
+	}
+	checks := keyFileChecks([]RemoteReport{remote("github.com", ""), remote("git.corp.example", "2222"), remote("github.com", "")}, []string{knownHosts})
+
+	var fixes []string
+	for _, c := range checks {
+		fixes = append(fixes, c.Fix)
+	}
+	want := []string{"mgit knownhosts add --port 2222 git.corp.example"}
+	if runtime.GOOS != "windows" {
+		want = append([]string{"chmod 600 '" + key + "'"}, want...)
+	}
+	if len(fixes) != len(want) {
+		t.Fatalf("fixes = %q, want %q", fixes, want)
+	}
+	for i := range want {
+		if !strings.HasPrefix(fixes[i], want[i]) {
+			t.Errorf("fix %d = %q, want prefix %q", i, fixes[i], want[i])
+		}
+	}
+}
+
+func TestFixScript(t *testing.T) {
+	rep := Report{
+		Checks:  []Check{{Name: "rotation", Status: "warn", Message: "rule r1: key is old", Fix: "mgit key rotate --rule r1"}, {Name: "git", Status: "ok", Message: "2.45"}},
+		Remotes: []RemoteReport{{Name: "origin", Error: "no SSH key rule matched", Fix: "mgit rule add git@github.com:a/b.git"}},
+	}
+	script := FixScript(rep.Fixes(), time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC))
+	for _, want := range []string{
+		"#!/bin/sh\n",
+		"set -eu\n",
+		"# rotation: rule r1: key is old\nmgit key rotate --rule r1\n",
+		"# remote origin: no SSH key rule matched\nmgit rule add git@github.com:a/b.git\n",
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("script missing %q:\n%s", want, script)
+		}
+	}
+	if strings.Contains(script, "2.45") {
+		t.Errorf("script has a line for a check without a fix:\n%s", script)
+	}
+}
@@ -0,0 +1,46 @@
+package doctor
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/pavelBuzdanov/mgit/internal/config"
+	"github.com/pavelBuzdanov/mgit/internal/sshkeys"
+)
+
+// plinkChecks cover rules whose ssh client is PuTTY's plink: it reads keys
+// in PuTTY's .ppk format only, and gets agent identities from Pageant on
+// Windows.
+func plinkChecks(cfg *config.Config) []Check {
+	var checks []Check
+	needsPageant := false
+	plinkRules := 0
+	for _, r := range cfg.Rules {
+		client, err := config.SSHClientFor(cfg, r)
+		if err != nil || !client.Plink() || !r.HasSSH() {
+			continue
+		}
+		plinkRules++
+		switch {
+		case r.UsesAgent():
+			needsPageant = true
+		case r.Key != "" && !sshkeys.IsProviderRef(r.Key) && !strings.EqualFold(filepath.Ext(filepath.ToSlash(r.Key)), ".ppk"):
+			checks = append(checks, Check{Name: "plink", Status: "warn", Message: fmt.Sprintf(
+				"rule %s: plink only reads PuTTY .ppk keys; convert %s with: puttygen %s -o key.ppk", r.ID, r.Key, r.Key)})
+		}
+	}
+	if plinkRules == 0 || runtime.GOOS != "windows" {
+		return checks
+	}
+	switch {
+	case sshkeys.PageantRunning():
+		checks = append(checks, Check{Name: "pageant", Status: "ok", Message: "Pageant is running; plink uses the keys it holds"})
+	case needsPageant:
+		checks = append(checks, Check{Name: "pageant", Status: "error", Message: "rules use agent identities with plink, which reads them from Pageant, but Pageant is not running"})
+	default:
+		checks = append(checks, Check{Name: "pageant", Status: "warn", Message: "Pageant is not running; plink can only use the key files the rules name"})
+	}
+	return checks
+}
@@ -0,0 +1,107 @@
+package doctor
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pavelBuzdanov/mgit/internal/config"
+	"github.com/pavelBuzdanov/mgit/internal/runner"
+)
+
+// sshCommandChecks compare what plain git would use with mgit's resolution:
+// a core.sshCommand pinning a different key than a remote's rule, and
+// per-remote ssh settings git does not read at all. mgit's GIT_SSH_COMMAND
+// wins whenever it runs git, so these only bite plain `git push`.
+func sshCommandChecks(ctx context.Context, git *runner.GitOps, remotes []RemoteReport) []Check {
+	var checks []Check
+	if command, origin := git.ConfigOrigin(ctx, "core.sshCommand"); command != "" {
+		keys := SSHCommandKeys(command)
+		for _, rr := range remotes {
+			if rr.Result == nil || !rr.Result.SSHSelectionApplies {
+				continue
+			}
+			want := rr.Result.KeyPath
+			switch {
+			case len(keys) == 0:
+				checks = append(checks, Check{Name: "core.sshCommand", Status: "warn", Message: fmt.Sprintf(
+					"core.sshCommand (%s) pins no key, so plain git uses ssh's default keys for %s; mgit uses %s", origin, rr.Name, want)})
+			case !sameKey(keys[0], want):
+				checks = append(checks, Check{Name: "core.sshCommand", Status: "warn", Message: fmt.Sprintf(
+					"core.sshCommand (%s) uses key %s, but mgit resolves %s to %s; plain git pushes as a different account", origin, keys[0], rr.Name, want)})
+			}
+		}
+	}
+	perRemote := make([][]Check, len(remotes))
+	forEach(len(remotes), func(i int) {
+		rr := remotes[i]
+		pattern := `^remote\.` + regexp.QuoteMeta(rr.Name) + `\.`
+		for _, e := range git.ConfigEntries(ctx, pattern) {
+			field := strings.ToLower(e[0][strings.LastIndex(e[0], ".")+1:])
+			if field == "sshcommand" || field == "identityfile" {
+				msg := fmt.Sprintf("%s = %s is not a git setting; plain git ignores it", e[0], e[1])
+				if rr.Result != nil && rr.Result.SSHSelectionApplies {
+					msg += fmt.Sprintf(" (mgit uses %s for %s)", rr.Result.KeyPath, rr.Name)
+				}
+				perRemote[i] = append(perRemote[i], Check{Name: "remote-config", Status: "warn", Message: msg})
+			}
+		}
+	})
+	for _, c := range perRemote {
+		checks = append(checks, c...)
+	}
+	return checks
+}
+
+// SSHCommandKeys returns the identity files an ssh command line names with
+// -i or -o IdentityFile, in order.
+func SSHCommandKeys(command string) []string {
+	words, err := runner.ParseSSHClient(command)
+	if err != nil {
+		return nil
+	}
+	var keys []string
+	for i := 0; i < len(words); i++ {
+		w := words[i]
+		switch {
+		case w == "-i" && i+1 < len(words):
+			i++
+			keys = append(keys, words[i])
+		case strings.HasPrefix(w, "-i") && len(w) > 2:
+			keys = append(keys, w[2:])
+		case w == "-o" && i+1 < len(words):
+			i++
+			if k, ok := identityFileOption(words[i]); ok {
+				keys = append(keys, k)
+			}
+		case strings.HasPrefix(w, "-o"):
+			if k, ok := identityFileOption(w[2:]); ok {
+				keys = append(keys, k)
+			}
+		}
+	}
+	return keys
+}
+
+func identityFileOption(opt string) (string, bool) {
+	name, value, ok := strings.Cut(opt, "=")
+	if !ok {
+		name, value, ok = strings.Cut(opt, " ")
+	}
+	if !ok || !strings.EqualFold(strings.TrimSpace(name), "IdentityFile") {
+		return "", false
+	}
+	return strings.TrimSpace(value), true
+}
+
+func sameKey(a, b string) bool {
+	if ea, err := config.ExpandPath(a); err == nil {
+		a = ea
+	}
+	if eb, err := config.ExpandPath(b); err == nil {
+		b = eb
+	}
+	return filepath.Clean(a) == filepath.Clean(b)
+}
@@ -0,0 +1,39 @@
+package doctor
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/pavelBuzdanov/mgit/internal/config"
+)
+
+func TestSSHCommandKeys(t *testing.T) {
+	for command, want := range map[string][]string{
+		"ssh -i ~/.ssh/work -o IdentitiesOnly=yes":      {"~/.ssh/work"},
+		"ssh -i'/tmp/my key'":                           {"/tmp/my key"},
+		"ssh -o IdentityFile=/k1 -oidentityfile=/k2 -4": {"/k1", "/k2"},
+		"ssh -v": nil,
+	} {
+		if got := SSHCommandKeys(command); !slices.Equal(got, want) {
+			t.Errorf("SSHCommandKeys(%q) = %q, want %q", command, got, want)
+		}
+	}
+}
+
+func TestPlinkChecks(t *testing.T) {
+	cfg := &config.Config{Version: 1, SSHCommand: "plink.exe", Rules: []config.Rule{
+		{ID: "ppk", Host: "github.com", Owner: "a", Key: `C:\keys\a.ppk`},
+		{ID: "openssh", Host: "github.com", Owner: "b", Key: `C:\keys\id_ed25519`},
+		{ID: "ssh", Host: "gitlab.com", Owner: "*", Key: "/k", SSHCommand: "ssh"},
+	}}
+	var warned []string
+	for _, c := range plinkChecks(cfg) {
+		if c.Name == "plink" {
+			warned = append(warned, c.Message)
+		}
+	}
+	if len(warned) != 1 || !strings.Contains(warned[0], "rule openssh") {
+		t.Fatalf("plinkChecks() warnings = %q, want one for rule openssh", warned)
+	}
+}
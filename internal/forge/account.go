@@ -0,0 +1,28 @@
+package forge
+
+import (
+	"regexp"
+	"strings"
+)
+
+// sshGreetings match the banners git hosts print for `ssh -T`, capturing the
+// account the key belongs to.
+var sshGreetings = []*regexp.Regexp{
+	regexp.MustCompile(`Hi ([^!\s]+)! You've successfully authenticated`),        // GitHub, GitHub Enterprise
+	regexp.MustCompile(`Welcome to GitLab, @([^!\s]+)!`),                         // GitLab
+	regexp.MustCompile(`logged in as ([^.\s]+)`),                                 // Bitbucket
+	regexp.MustCompile(`Hi there, ([^!\s]+)! You've successfully authenticated`), // Gitea, Forgejo
+}
+
+// SSHAccount extracts the account name from the output of `ssh -T git@host`.
+// It returns false when the output carries no greeting, e.g. when the key
+// was rejected.
+func SSHAccount(output string) (string, bool) {
+	flat := strings.Join(strings.Fields(output), " ")
+	for _, re := range sshGreetings {
+		if m := re.FindStringSubmatch(flat); m != nil {
+			return m[1], true
+		}
+	}
+	return "", false
+}
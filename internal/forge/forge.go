@@ -0,0 +1,140 @@
+package forge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	ProviderGitHub = "github"
+	ProviderGitLab = "gitlab"
+)
+
+type Client struct {
+	Provider string
+	// APIURL is the API base, e.g. https://api.github.com or https://gitlab.example.com/api/v4.
+	APIURL string
+	Token  string
+	HTTP   *http.Client
+}
+
+type UploadedKey struct {
+	ID    int64  `json:"id"`
+	Title string `json:"title"`
+	Key   string `json:"key"`
+}
+
+// DetectProvider guesses the forge from a host name.
+func DetectProvider(host string) string {
+	h := strings.ToLower(host)
+	switch {
+	case strings.Contains(h, "github"):
+		return ProviderGitHub
+	case strings.Contains(h, "gitlab"):
+		return ProviderGitLab
+	default:
+		return ""
+	}
+}
+
+// DefaultAPIURL returns the API base for a provider on the given host.
+func DefaultAPIURL(provider, host string) (string, error) {
+	host = strings.ToLower(strings.TrimSpace(host))
+	switch provider {
+	case ProviderGitHub:
+		if host == "" || host == "github.com" {
+			return "https://api.github.com", nil
+		}
+		return "https://" + host + "/api/v3", nil
+	case ProviderGitLab:
+		if host == "" {
+			host = "gitlab.com"
+		}
+		return "https://" + host + "/api/v4", nil
+	default:
+		return "", fmt.Errorf("unsupported provider %q (supported: github, gitlab)", provider)
+	}
+}
+
+// TokenFromEnv reads the API token conventionally used by each forge's CLI.
+func TokenFromEnv(provider string) string {
+	var names []string
+	switch provider {
+	case ProviderGitHub:
+		names = []string{"GITHUB_TOKEN", "GH_TOKEN"}
+	case ProviderGitLab:
+		names = []string{"GITLAB_TOKEN", "GITLAB_PRIVATE_TOKEN"}
+	}
+	for _, n := range names {
+		if v := strings.TrimSpace(os.Getenv(n)); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// UploadKey registers an SSH public key on the authenticated user's account.
+func (c *Client) UploadKey(ctx context.Context, title, publicKey string) (*UploadedKey, error) {
+	if strings.TrimSpace(c.Token) == "" {
+		return nil, errors.New("API token is required")
+	}
+	body, err := json.Marshal(map[string]string{"title": title, "key": strings.TrimSpace(publicKey)})
+	if err != nil {
+		return nil, fmt.Errorf("encode request: %w", err)
+	}
+	endpoint := strings.TrimSuffix(c.APIURL, "/") + "/user/keys"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	switch c.Provider {
+	case ProviderGitHub:
+		req.Header.Set("Accept", "application/vnd.github+json")
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	case ProviderGitLab:
+		req.Header.Set("PRIVATE-TOKEN", c.Token)
+	default:
+		return nil, fmt.Errorf("unsupported provider %q", c.Provider)
+	}
+
+	httpClient := c.HTTP
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 30 * time.Second}
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("upload key to %s: %w", c.Provider, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("read %s response: %w", c.Provider, err)
+	}
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("upload key to %s: %s: %s", c.Provider, resp.Status, apiErrorMessage(data))
+	}
+	var out UploadedKey
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, fmt.Errorf("parse %s response: %w", c.Provider, err)
+	}
+	return &out, nil
+}
+
+func apiErrorMessage(data []byte) string {
+	var payload struct {
+		Message any `json:"message"`
+	}
+	if err := json.Unmarshal(data, &payload); err == nil && payload.Message != nil {
+		return fmt.Sprint(payload.Message)
+	}
+	return strings.TrimSpace(string(data))
+}
@@ -0,0 +1,81 @@
+package forge
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUploadKeyGitHub(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/user/keys" || r.Method != http.MethodPost {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer tok" {
+			t.Errorf("unexpected Authorization header %q", got)
+		}
+		var body map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]any{"id": 7, "title": body["title"], "key": body["key"]})
+	}))
+	defer srv.Close()
+
+	c := &Client{Provider: ProviderGitHub, APIURL: srv.URL, Token: "tok"}
+	got, err := c.UploadKey(context.Background(), "laptop", "ssh-ed25519 AAAA comment\n")
+	if err != nil {
+		t.Fatalf("UploadKey() error = %v", err)
+	}
+	if got.ID != 7 || got.Title != "laptop" || got.Key != "ssh-ed25519 AAAA comment" {
+		t.Fatalf("unexpected key: %+v", got)
+	}
+}
+
+func TestUploadKeyGitLabError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("PRIVATE-TOKEN"); got != "tok" {
+			t.Errorf("unexpected PRIVATE-TOKEN header %q", got)
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"message":{"key":["has already been taken"]}}`))
+	}))
+	defer srv.Close()
+
+	c := &Client{Provider: ProviderGitLab, APIURL: srv.URL, Token: "tok"}
+	if _, err := c.UploadKey(context.Background(), "laptop", "ssh-ed25519 AAAA"); err == nil {
+		t.Fatalf("expected upload error")
+	}
+}
+
+func TestDefaultAPIURL(t *testing.T) {
+	cases := []struct {
+		provider, host, want string
+	}{
+		{ProviderGitHub, "github.com", "https://api.github.com"},
+		{ProviderGitHub, "github.example.com", "https://github.example.com/api/v3"},
+		{ProviderGitLab, "gitlab.com", "https://gitlab.com/api/v4"},
+	}
+	for _, tc := range cases {
+		got, err := DefaultAPIURL(tc.provider, tc.host)
+		if err != nil || got != tc.want {
+			t.Fatalf("DefaultAPIURL(%q, %q) = %q, %v; want %q", tc.provider, tc.host, got, err, tc.want)
+		}
+	}
+}
+
+func TestSSHAccount(t *testing.T) {
+	for output, want := range map[string]string{
+		"Hi alice! You've successfully authenticated, but GitHub does not provide shell access.": "alice",
+		"Welcome to GitLab, @bob!": "bob",
+		"authenticated via ssh key.\n\nYou can use git to connect to Bitbucket. Shell access is disabled.\nlogged in as carol.": "carol",
+		"Hi there, dave! You've successfully authenticated, but Gitea does not provide shell access.":                           "dave",
+		"git@github.com: Permission denied (publickey).":                                                                        "",
+	} {
+		got, ok := SSHAccount(output)
+		if got != want || ok != (want != "") {
+			t.Errorf("SSHAccount(%q) = %q, %v; want %q", output, got, ok, want)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package guard
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/pavelBuzdanov/mgit/internal/config"
+	"github.com/pavelBuzdanov/mgit/internal/runner"
+)
+
+type Issue struct {
+	Kind     string `json:"kind"` // email|commit-author|signing-key
+	Expected string `json:"expected"`
+	Actual   string `json:"actual"`
+	Commit   string `json:"commit,omitempty"`
+}
+
+type Report struct {
+	Remote  string  `json:"remote"`
+	RuleID  string  `json:"ruleId,omitempty"`
+	Checked bool    `json:"checked"`
+	Issues  []Issue `json:"issues,omitempty"`
+}
+
+func (r Report) OK() bool {
+	return len(r.Issues) == 0
+}
+
+// Check compares the repository's identity with the one the rule expects:
+// the configured user.email, the authors of commits not yet on remote, and
+// user.signingkey. Rules without email or signingKey are not checked.
+func Check(ctx context.Context, git *runner.GitOps, rule config.Rule, remote string) (Report, error) {
+	rep := Report{Remote: remote, RuleID: rule.ID}
+	if rule.Email == "" && rule.SigningKey == "" {
+		return rep, nil
+	}
+	rep.Checked = true
+	if rule.Email != "" {
+		if email := git.ConfigValue(ctx, "user.email"); !EmailMatches(rule.Email, email) {
+			rep.Issues = append(rep.Issues, Issue{Kind: "email", Expected: rule.Email, Actual: email})
+		}
+		commits, err := git.UnpushedAuthors(ctx, remote)
+		if err != nil {
+			return rep, fmt.Errorf("list unpushed commits: %w", err)
+		}
+		for _, c := range commits {
+			if !EmailMatches(rule.Email, c.Email) {
+				rep.Issues = append(rep.Issues, Issue{Kind: "commit-author", Expected: rule.Email, Actual: c.Email, Commit: c.Hash})
+			}
+		}
+	}
+	if rule.SigningKey != "" {
+		// Commits made through mgit get the rule's key via -c; a different
+		// configured key means plain `git commit` signs with the wrong identity.
+		if actual := git.ConfigValue(ctx, "user.signingkey"); actual != "" && !sameSigningKey(rule.SigningKey, actual) {
+			rep.Issues = append(rep.Issues, Issue{Kind: "signing-key", Expected: rule.SigningKey, Actual: actual})
+		}
+	}
+	return rep, nil
+}
+
+// EmailMatches compares case-insensitively; expected may be a wildcard such as *@company.com.
+func EmailMatches(expected, actual string) bool {
+	expected = strings.ToLower(strings.TrimSpace(expected))
+	actual = strings.ToLower(strings.TrimSpace(actual))
+	if actual == "" {
+		return false
+	}
+	ok, err := filepath.Match(expected, actual)
+	return err == nil && ok
+}
+
+func sameSigningKey(expected, actual string) bool {
+	if expected == actual {
+		return true
+	}
+	e, err1 := config.ExpandPath(expected)
+	a, err2 := config.ExpandPath(actual)
+	return err1 == nil && err2 == nil && e == a
+}
@@ -0,0 +1,20 @@
+package guard
+
+import "testing"
+
+func TestEmailMatches(t *testing.T) {
+	cases := []struct {
+		expected, actual string
+		want             bool
+	}{
+		{"me@company.com", "Me@Company.com", true},
+		{"*@company.com", "dev@company.com", true},
+		{"*@company.com", "dev@home.org", false},
+		{"me@company.com", "", false},
+	}
+	for _, tc := range cases {
+		if got := EmailMatches(tc.expected, tc.actual); got != tc.want {
+			t.Fatalf("EmailMatches(%q, %q) = %v, want %v", tc.expected, tc.actual, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package hooks
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Marker identifies hook scripts written by mgit.
+const Marker = "# installed by mgit"
+
+// ChainedSuffix is appended to a pre-existing hook that mgit moves aside and runs first.
+const ChainedSuffix = ".mgit-chained"
+
+var Supported = []string{"pre-push", "pre-commit"}
+
+type Result struct {
+	Hook    string `json:"hook"`
+	Path    string `json:"path"`
+	Action  string `json:"action"` // installed|updated|chained|removed|restored|skipped
+	Chained string `json:"chained,omitempty"`
+}
+
+// Script returns the hook body for name.
+func Script(name string) (string, error) {
+	var check string
+	switch name {
+	case "pre-push":
+		check = `# $1 is the remote name, $2 its URL; pushes straight to a URL have no rule-bound remote.
+[ "$1" = "$2" ] && exit 0
+exec mgit guard $guard_flags --remote "$1"`
+	case "pre-commit":
+		check = `# A repository without remotes (fresh git init, local-only) has no identity to check.
+[ -n "$(git remote)" ] || exit 0
+exec mgit guard $guard_flags`
+	default:
+		return "", fmt.Errorf("unsupported hook %q (supported: %s)", name, strings.Join(Supported, ", "))
+	}
+	return fmt.Sprintf(`#!/bin/sh
+%s: identity guard (%s)
+hook_dir=$(dirname "$0")
+chained="$hook_dir/%s%s"
+if [ -x "$chained" ]; then
+	stdin_copy=$(mktemp) || exit 1
+	cat > "$stdin_copy"
+	"$chained" "$@" < "$stdin_copy"
+	status=$?
+	rm -f "$stdin_copy"
+	[ $status -eq 0 ] || exit $status
+fi
+case "$MGIT_GUARD" in
+off) exit 0 ;;
+warn) guard_flags=--force ;;
+*) guard_flags= ;;
+esac
+if ! command -v mgit >/dev/null 2>&1; then
+	echo "mgit not found in PATH; skipping identity guard" >&2
+	exit 0
+fi
+%s
+`, Marker, name, name, ChainedSuffix, check), nil
+}
+
+func IsMgitHook(path string) bool {
+	data, err := os.ReadFile(path)
+	return err == nil && bytes.Contains(data, []byte(Marker))
+}
+
+// Install writes the mgit hook into dir. An existing foreign hook is moved to
+// <name>.mgit-chained and keeps running before the guard.
+func Install(dir, name string) (Result, error) {
+	script, err := Script(name)
+	if err != nil {
+		return Result{}, err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return Result{}, fmt.Errorf("create hooks dir: %w", err)
+	}
+	path := filepath.Join(dir, name)
+	res := Result{Hook: name, Path: path, Action: "installed"}
+	if _, err := os.Stat(path); err == nil {
+		if IsMgitHook(path) {
+			res.Action = "updated"
+		} else {
+			chained := path + ChainedSuffix
+			if _, err := os.Stat(chained); err == nil {
+				return res, fmt.Errorf("%s already exists; refusing to overwrite a previously chained hook", chained)
+			}
+			if err := os.Rename(path, chained); err != nil {
+				return res, fmt.Errorf("move existing hook aside: %w", err)
+			}
+			res.Action = "chained"
+			res.Chained = chained
+		}
+	}
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		return res, fmt.Errorf("write hook %s: %w", path, err)
+	}
+	return res, nil
+}
+
+// Uninstall removes the mgit hook and restores a chained hook if there is one.
+func Uninstall(dir, name string) (Result, error) {
+	path := filepath.Join(dir, name)
+	res := Result{Hook: name, Path: path, Action: "skipped"}
+	if _, err := os.Stat(path); err != nil {
+		return res, nil
+	}
+	if !IsMgitHook(path) {
+		return res, nil
+	}
+	if err := os.Remove(path); err != nil {
+		return res, fmt.Errorf("remove hook %s: %w", path, err)
+	}
+	res.Action = "removed"
+	chained := path + ChainedSuffix
+	if _, err := os.Stat(chained); err == nil {
+		if err := os.Rename(chained, path); err != nil {
+			return res, fmt.Errorf("restore chained hook: %w", err)
+		}
+		res.Action = "restored"
+		res.Chained = chained
+	}
+	return res, nil
+}
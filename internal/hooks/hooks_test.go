@@ -0,0 +1,89 @@
+package hooks
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestInstallChainsExistingHookAndUninstallRestoresIt(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "pre-push")
+	if err := os.WriteFile(existing, []byte("#!/bin/sh\nexit 0\n"), 0o755); err != nil {
+		t.Fatalf("write existing hook: %v", err)
+	}
+
+	res, err := Install(dir, "pre-push")
+	if err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+	if res.Action != "chained" || !IsMgitHook(existing) {
+		t.Fatalf("unexpected install result: %+v", res)
+	}
+	if _, err := os.Stat(existing + ChainedSuffix); err != nil {
+		t.Fatalf("expected chained hook: %v", err)
+	}
+
+	res, err = Install(dir, "pre-push")
+	if err != nil || res.Action != "updated" {
+		t.Fatalf("reinstall = %+v, %v; want updated", res, err)
+	}
+
+	res, err = Uninstall(dir, "pre-push")
+	if err != nil || res.Action != "restored" {
+		t.Fatalf("Uninstall() = %+v, %v; want restored", res, err)
+	}
+	if IsMgitHook(existing) {
+		t.Fatalf("expected original hook to be restored")
+	}
+}
+
+func TestUninstallLeavesForeignHook(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "pre-commit")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatalf("write hook: %v", err)
+	}
+	res, err := Uninstall(dir, "pre-commit")
+	if err != nil || res.Action != "skipped" {
+		t.Fatalf("Uninstall() = %+v, %v; want skipped", res, err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("foreign hook removed: %v", err)
+	}
+}
+
+func TestPreCommitSkipsRepositoryWithoutRemotes(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not in PATH")
+	}
+	repo := t.TempDir()
+	if out, err := exec.Command("git", "init", "-q", repo).CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v\n%s", err, out)
+	}
+	res, err := Install(filepath.Join(repo, ".git", "hooks"), "pre-commit")
+	if err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+	// A stand-in mgit whose guard always refuses.
+	bin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bin, "mgit"), []byte("#!/bin/sh\nexit 2\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	run := func() error {
+		cmd := exec.Command("sh", res.Path)
+		cmd.Dir = repo
+		cmd.Env = append(os.Environ(), "PATH="+bin+string(os.PathListSeparator)+os.Getenv("PATH"), "MGIT_GUARD=")
+		return cmd.Run()
+	}
+	if err := run(); err != nil {
+		t.Fatalf("pre-commit without remotes = %v, want success", err)
+	}
+	if out, err := exec.Command("git", "-C", repo, "remote", "add", "origin", "git@github.com:me/repo.git").CombinedOutput(); err != nil {
+		t.Fatalf("git remote add: %v\n%s", err, out)
+	}
+	if err := run(); err == nil {
+		t.Fatal("pre-commit with a remote skipped the guard")
+	}
+}
@@ -1,27 +1,56 @@
+// Package resolve turns a remote URL and a config into the SSH key and
+// GIT_SSH_COMMAND mgit would use for it. pkg/resolve is the public view of
+// this package for programs embedding mgit.
 package resolve
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"os"
+	"strings"
 
-	"mgit/internal/config"
-	"mgit/internal/giturl"
-	"mgit/internal/matcher"
-	"mgit/internal/runner"
+	"github.com/pavelBuzdanov/mgit/internal/config"
+	"github.com/pavelBuzdanov/mgit/internal/runner"
+	"github.com/pavelBuzdanov/mgit/internal/sshkeys"
+	"github.com/pavelBuzdanov/mgit/pkg/giturl"
+	"github.com/pavelBuzdanov/mgit/pkg/matcher"
+	"github.com/pavelBuzdanov/mgit/pkg/trace"
 )
 
 type Result struct {
-	URL                string             `json:"url"`
-	Parsed             *giturl.ParsedRemote `json:"parsed,omitempty"`
-	SSHSelectionApplies bool              `json:"sshSelectionApplies"`
-	MatchedRule        *config.Rule       `json:"matchedRule,omitempty"`
-	KeyPath            string             `json:"keyPath,omitempty"`
-	GITSSHCommand      string             `json:"gitSshCommand,omitempty"`
-	MatchScore         int                `json:"matchScore,omitempty"`
-	Notes              []string           `json:"notes,omitempty"`
+	URL                 string               `json:"url"`
+	Parsed              *giturl.ParsedRemote `json:"parsed,omitempty"`
+	SSHSelectionApplies bool                 `json:"sshSelectionApplies"`
+	MatchedRule         *config.Rule         `json:"matchedRule,omitempty"`
+	KeyPath             string               `json:"keyPath,omitempty"`
+	GITSSHCommand       string               `json:"gitSshCommand,omitempty"`
+	MatchScore          int                  `json:"matchScore,omitempty"`
+	Fallback            bool                 `json:"fallback,omitempty"` // no rule matched; the config's defaultKey was used
+	Pinned              bool                 `json:"pinned,omitempty"`   // the config's pin was used instead of matching
+	KeyNeedsPassphrase  bool                 `json:"keyNeedsPassphrase,omitempty"`
+	KeyType             string               `json:"keyType,omitempty"`
+	SecurityKey         bool                 `json:"securityKey,omitempty"`
+	SSHOptions          []string             `json:"sshOptions,omitempty"`
+	HostDefaults        *config.HostDefault  `json:"hostDefaults,omitempty"` // merged hostDefaults entries for the remote's host
+	SSHClient           runner.SSHClient     `json:"sshClient,omitempty"`    // empty means plain ssh
+	KeyProvider         string               `json:"keyProvider,omitempty"`
+	GitConfig           []string             `json:"gitConfig,omitempty"` // key=value pairs passed to git as -c, e.g. HTTPS credential settings
+	Notes               []string             `json:"notes,omitempty"`
 }
 
+// FromURL resolves rawURL against cfg. Non-SSH remotes resolve without a
+// config and with SSHSelectionApplies false; SSH remotes need a matching rule
+// or the config's defaultKey, in which case Fallback is set.
 func FromURL(cfg *config.Config, rawURL string) (*Result, error) {
-	parsed, err := giturl.Parse(rawURL)
+	return FromRemote(cfg, "", rawURL)
+}
+
+// FromRemote is FromURL for a URL read from the git remote named remote, so
+// rules conditioned on the remote name can match. An empty remote is a plain
+// URL.
+func FromRemote(cfg *config.Config, remote, rawURL string) (*Result, error) {
+	parsed, err := ParseRemote(cfg, remote, rawURL)
 	if err != nil {
 		return nil, err
 	}
@@ -29,10 +58,16 @@ func FromURL(cfg *config.Config, rawURL string) (*Result, error) {
 		URL:    rawURL,
 		Parsed: parsed,
 	}
+	if parsed.Alias != "" {
+		res.Notes = append(res.Notes, fmt.Sprintf("host alias %s is matched as %s; git still connects to %s", parsed.Alias, parsed.Host, parsed.Alias))
+	}
 	if !parsed.IsSSH() {
 		res.SSHSelectionApplies = false
 		if parsed.IsHTTPS() {
 			res.Notes = append(res.Notes, "HTTPS remote detected: SSH key selection is not applied")
+			if cfg != nil {
+				resolveHTTPS(cfg, parsed, res)
+			}
 		} else {
 			res.Notes = append(res.Notes, fmt.Sprintf("transport %q is not SSH: SSH key selection is not applied", parsed.Transport))
 		}
@@ -41,22 +76,352 @@ func FromURL(cfg *config.Config, rawURL string) (*Result, error) {
 	if cfg == nil {
 		return nil, fmt.Errorf("config is required for SSH remote")
 	}
-	match, err := matcher.Match(cfg.Rules, parsed)
+	pinned, ok, err := config.PinnedRule(cfg)
 	if err != nil {
-		return nil, fmt.Errorf("%w. %s", err, AddRuleHint(parsed))
+		return nil, err
+	}
+	var match *matcher.MatchResult
+	if ok {
+		match = &matcher.MatchResult{Rule: pinned, Index: -1}
+		res.Pinned = true
+		res.Notes = append(res.Notes, PinNote(cfg.Pin))
+	} else if match, err = matcher.Match(rulesWith(cfg.Rules, config.Rule.HasSSH), parsed); err != nil {
+		def, ok := config.DefaultRule(cfg)
+		if !ok {
+			return nil, fmt.Errorf("%w. %s", err, AddRuleHint(parsed))
+		}
+		match = &matcher.MatchResult{Rule: def, Index: -1}
+		res.Fallback = true
+		res.Notes = append(res.Notes, fmt.Sprintf("fallback used: no rule matched (host=%s, owner=%s), so the config's defaultKey applies", parsed.Host, parsed.Owner))
 	}
-	keyPath, err := config.ExpandPath(match.Rule.Key)
+	if cfg.Strict && !res.Pinned {
+		if err := strictError(match, res.Fallback, parsed); err != nil {
+			return nil, err
+		}
+	}
+	if note := TieNote(match); note != "" {
+		res.Notes = append(res.Notes, note)
+	}
+	keyPath, err := RuleKeyPath(match.Rule)
 	if err != nil {
-		return nil, fmt.Errorf("expand key path for rule %q: %w", match.Rule.ID, err)
+		return nil, err
+	}
+	res.KeyProvider = sshkeys.ProviderName(keyPath)
+	switch {
+	case match.Rule.UsesAgent():
+		res.Notes = append(res.Notes, "key is provided by ssh-agent; SSH_AUTH_SOCK must point at an agent holding it")
+	case res.KeyProvider != "":
+		res.Notes = append(res.Notes, fmt.Sprintf("key is fetched from %s at run time and removed afterwards", res.KeyProvider))
+	case sshkeys.NeedsPassphrase(keyPath):
+		res.KeyNeedsPassphrase = true
+		res.Notes = append(res.Notes, PassphraseWarning(keyPath))
 	}
 	res.SSHSelectionApplies = true
 	res.MatchedRule = &match.Rule
 	res.MatchScore = match.Score
 	res.KeyPath = keyPath
-	res.GITSSHCommand = runner.BuildGITSSHCommand(keyPath)
+	if pub, err := sshkeys.ReadPublicKeyFile(sshkeys.PublicKeyPath(keyPath)); err == nil {
+		res.KeyType = pub.Type
+		res.SecurityKey = sshkeys.IsSecurityKeyType(pub.Type)
+	}
+	res.SSHOptions = RuleSSHOptions(match.Rule)
+	if d, ok := cfg.HostDefaultsFor(parsed.Address(), parsed.Host); ok {
+		res.HostDefaults = &d
+		res.SSHOptions = append(res.SSHOptions, d.SSHOptions()...)
+		res.Notes = append(res.Notes, fmt.Sprintf("host defaults for %s: %s", parsed.Host, d))
+	}
+	if res.SecurityKey {
+		res.Notes = append(res.Notes, "security key (FIDO2): confirm user presence by touching the device when prompted")
+	}
+	if res.SSHClient, err = config.SSHClientFor(cfg, match.Rule); err != nil {
+		return nil, err
+	}
+	res.SSHOptions = WithKnownHosts(res.SSHClient, res.SSHOptions)
+	if dropped := runner.PlinkDropped(res.SSHOptions); res.SSHClient.Plink() && len(dropped) > 0 {
+		res.Notes = append(res.Notes, "plink does not take ssh -o options; ignoring "+strings.Join(dropped, ", "))
+	}
+	res.GITSSHCommand = res.SSHClient.Command(keyPath, res.SSHOptions...)
+	trace.Event("resolve.env", "url", rawURL, "rule", match.Rule.ID, "key", keyPath, "GIT_SSH_COMMAND", res.GITSSHCommand)
 	return res, nil
 }
 
+// strictError refuses a match that only a catch-all rule or the defaultKey
+// fallback provided. It wraps matcher.ErrNoMatch: under strict matching the
+// remote has no rule of its own.
+func strictError(match *matcher.MatchResult, fallback bool, parsed *giturl.ParsedRemote) error {
+	var via string
+	switch {
+	case fallback:
+		via = "the config's defaultKey"
+	case match.Rule.CatchAll():
+		via = fmt.Sprintf("catch-all rule %s (host=%s, owner=%s)", match.Rule.ID, match.Rule.Host, match.Rule.Owner)
+	default:
+		return nil
+	}
+	return fmt.Errorf("%w (host=%s, owner=%s): strict mode refuses to use %s. %s", matcher.ErrNoMatch, parsed.Host, parsed.Owner, via, AddRuleHint(parsed))
+}
+
+// resolveHTTPS applies the best rule with HTTPS settings to an HTTPS remote.
+// Rules without them are skipped, so an SSH catch-all doesn't shadow them.
+func resolveHTTPS(cfg *config.Config, parsed *giturl.ParsedRemote, res *Result) {
+	match, err := matcher.Match(rulesWith(cfg.Rules, config.Rule.HasHTTPS), parsed)
+	if err != nil {
+		return
+	}
+	res.MatchedRule = &match.Rule
+	res.MatchScore = match.Score
+	res.GitConfig = HTTPSConfig(match.Rule, parsed)
+	if note := TieNote(match); note != "" {
+		res.Notes = append(res.Notes, note)
+	}
+	res.Notes = append(res.Notes, fmt.Sprintf("HTTPS credential settings from rule %s are passed to git with -c", match.Rule.ID))
+}
+
+// HTTPSConfig returns the git config that applies a rule's HTTPS settings,
+// scoped to the remote's scheme and host so other hosts in the same command
+// (submodules, redirects) keep their own credentials. The empty helper entry
+// clears helpers from other config levels before the rule's is added.
+func HTTPSConfig(r config.Rule, parsed *giturl.ParsedRemote) []string {
+	scope := "credential." + parsed.Scheme + "://" + parsed.Address()
+	if parsed.Port != "" {
+		scope += ":" + parsed.Port
+	}
+	var out []string
+	if r.HTTPSUser != "" {
+		out = append(out, scope+".username="+r.HTTPSUser)
+	}
+	if r.CredentialHelper != "" {
+		out = append(out, scope+".helper=", scope+".helper="+r.CredentialHelper)
+	}
+	return out
+}
+
+// GitConfigArgs turns key=value pairs into git -c arguments.
+func GitConfigArgs(pairs []string) []string {
+	args := make([]string, 0, 2*len(pairs))
+	for _, p := range pairs {
+		args = append(args, "-c", p)
+	}
+	return args
+}
+
+// Candidates explains how every rule in cfg fared for rawURL, read from the
+// git remote named remote, including rules skipped because they have nothing
+// for its transport: no key or agent for SSH, no HTTPS settings for HTTPS.
+func Candidates(cfg *config.Config, remote, rawURL string) ([]matcher.Candidate, error) {
+	parsed, err := ParseRemote(cfg, remote, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	keep, skipped := config.Rule.HasSSH, "no key or agent (HTTPS-only rule)"
+	switch {
+	case parsed.IsHTTPS():
+		keep, skipped = config.Rule.HasHTTPS, "no httpsUser or credentialHelper for an HTTPS remote"
+	case !parsed.IsSSH():
+		keep, skipped = func(config.Rule) bool { return false }, fmt.Sprintf("transport %s is not handled by rules", parsed.Transport)
+	}
+	var eligible []config.Rule
+	var positions []int
+	out := make([]matcher.Candidate, len(cfg.Rules))
+	for i, r := range cfg.Rules {
+		out[i] = matcher.NewCandidate(i, r)
+		out[i].Reason = skipped
+		if keep(r) {
+			eligible = append(eligible, r)
+			positions = append(positions, i)
+		}
+	}
+	explained, err := matcher.Explain(eligible, parsed)
+	if err != nil {
+		return nil, err
+	}
+	for j, c := range explained {
+		c.Index = positions[j]
+		out[c.Index] = c
+	}
+	return out, nil
+}
+
+func rulesWith(rules []config.Rule, keep func(config.Rule) bool) []config.Rule {
+	out := make([]config.Rule, 0, len(rules))
+	for _, r := range rules {
+		if keep(r) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// PinNote explains that p replaced rule matching.
+func PinNote(p *config.Pin) string {
+	what := "key " + p.Key
+	if p.Rule != "" {
+		what = "rule " + p.Rule
+	}
+	return fmt.Sprintf("pinned: this repository uses %s for every SSH remote, whatever the rules match (mgit unpin removes the pin)", what)
+}
+
+// TieNote warns when other rules scored the same as the match, which then
+// won only by coming first in the config.
+func TieNote(match *matcher.MatchResult) string {
+	if len(match.Tied) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("ambiguous match: rule %s ties with %s (score %d) and wins because it is listed first; set priority to choose explicitly", match.Rule.ID, strings.Join(match.Tied, ", "), match.Score)
+}
+
+// RuleKeyPath returns the identity file passed to ssh for a rule. For agent
+// rules this is a cached copy of the public key, which ssh pairs with the
+// matching agent identity.
+func RuleKeyPath(r config.Rule) (string, error) {
+	if r.UsesAgent() {
+		path, err := sshkeys.AgentIdentityFile(r.Agent)
+		if err != nil {
+			return "", keyError{fmt.Errorf("resolve agent identity for rule %q: %w", r.ID, err)}
+		}
+		return path, nil
+	}
+	if sshkeys.IsProviderRef(r.Key) {
+		return r.Key, nil
+	}
+	keyPath, err := config.ExpandPath(r.Key)
+	if err != nil {
+		return "", fmt.Errorf("expand key path for rule %q: %w", r.ID, err)
+	}
+	return keyPath, nil
+}
+
+// ErrKeyMissing marks errors about a rule's key being unavailable: a missing
+// key file, an agent without the identity, a secret manager that failed.
+var ErrKeyMissing = errors.New("key missing")
+
+type keyError struct{ err error }
+
+func (e keyError) Error() string   { return e.err.Error() }
+func (e keyError) Unwrap() []error { return []error{e.err, ErrKeyMissing} }
+
+// CheckKey reports a key file that does not exist, which ssh would only
+// notice as a failed login. Agent and provider keys are checked when they
+// are resolved or fetched.
+func (r *Result) CheckKey() error {
+	if !r.SSHSelectionApplies || r.KeyProvider != "" || r.MatchedRule == nil || r.MatchedRule.UsesAgent() {
+		return nil
+	}
+	if _, err := os.Stat(r.KeyPath); err != nil {
+		return keyError{fmt.Errorf("key file %s of rule %s: %w", r.KeyPath, r.MatchedRule.ID, err)}
+	}
+	return nil
+}
+
+// MaterializeKey fetches a provider-backed key into a temp file and points
+// KeyPath and GITSSHCommand at it. The returned cleanup is always non-nil.
+func (r *Result) MaterializeKey(ctx context.Context) (func(), error) {
+	if r.KeyProvider == "" {
+		return func() {}, nil
+	}
+	path, cleanup, err := sshkeys.Materialize(ctx, r.KeyPath)
+	if err != nil {
+		return func() {}, keyError{err}
+	}
+	r.KeyPath = path
+	r.GITSSHCommand = r.SSHClient.Command(path, r.SSHOptions...)
+	return cleanup, nil
+}
+
+// RuleSSHOptions returns the per-rule ssh -o options.
+func RuleSSHOptions(r config.Rule) []string {
+	var opts []string
+	if r.SecurityKeyProvider != "" {
+		opts = append(opts, "SecurityKeyProvider="+r.SecurityKeyProvider)
+	}
+	if v := r.EffectiveStrictHostKeyChecking(); v != "" {
+		opts = append(opts, "StrictHostKeyChecking="+v)
+	}
+	if path := r.KnownHostsFile; path != "" {
+		if expanded, err := config.ExpandPath(path); err == nil {
+			path = expanded
+		}
+		if strings.ContainsAny(path, " \t") {
+			path = `"` + path + `"`
+		}
+		opts = append(opts, "UserKnownHostsFile="+path)
+	}
+	return opts
+}
+
+// WithKnownHosts adds the option that makes ssh check host keys against the
+// known_hosts file `mgit knownhosts add` maintains, once it exists. Options
+// that already set UserKnownHostsFile win, and plink has its own host key
+// store.
+func WithKnownHosts(client runner.SSHClient, options []string) []string {
+	opt := config.KnownHostsOption()
+	if opt == "" || client.Plink() {
+		return options
+	}
+	for _, o := range options {
+		if name, _, _ := strings.Cut(o, "="); strings.EqualFold(name, "UserKnownHostsFile") {
+			return options
+		}
+	}
+	return append(options, opt)
+}
+
+// SigningArgs returns the `git -c` arguments that apply a rule's signing identity.
+func SigningArgs(r config.Rule) ([]string, error) {
+	if r.SigningKey == "" {
+		return nil, nil
+	}
+	key := r.SigningKey
+	format := r.EffectiveSigningFormat()
+	if format == "ssh" && !strings.HasPrefix(key, "key::") {
+		expanded, err := config.ExpandPath(key)
+		if err != nil {
+			return nil, fmt.Errorf("expand signing key for rule %q: %w", r.ID, err)
+		}
+		key = expanded
+	}
+	return []string{"-c", "gpg.format=" + format, "-c", "user.signingkey=" + key}, nil
+}
+
+// ParseRemote parses rawURL, read from the git remote named remote, and maps
+// a host alias from cfg to its canonical host.
+func ParseRemote(cfg *config.Config, remote, rawURL string) (*giturl.ParsedRemote, error) {
+	parsed, err := giturl.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	parsed.Remote = remote
+	if cfg != nil {
+		if host, ok := cfg.CanonicalHost(parsed.Host); ok {
+			parsed.Alias, parsed.Host = parsed.Host, host
+		}
+	}
+	return parsed, nil
+}
+
+// RuleForURL finds the rule for rawURL regardless of transport, since commit
+// signing and identity checks apply to HTTPS remotes as well.
+func RuleForURL(cfg *config.Config, rawURL string) (*config.Rule, error) {
+	return RuleForRemote(cfg, "", rawURL)
+}
+
+// RuleForRemote is RuleForURL for a URL read from the git remote named remote.
+func RuleForRemote(cfg *config.Config, remote, rawURL string) (*config.Rule, error) {
+	parsed, err := ParseRemote(cfg, remote, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	match, err := matcher.Match(cfg.Rules, parsed)
+	if err != nil {
+		return nil, err
+	}
+	return &match.Rule, nil
+}
+
+func PassphraseWarning(keyPath string) string {
+	return fmt.Sprintf("key %s is passphrase-protected and not loaded in ssh-agent: non-interactive runs (CI, BatchMode=yes) will fail; load it with: ssh-add %s", keyPath, keyPath)
+}
+
 func AddRuleHint(parsed *giturl.ParsedRemote) string {
 	if parsed == nil {
 		return "Add a rule with: mgit rule add --host <host> --owner <owner> --key ~/.ssh/<key>"
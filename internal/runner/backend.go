@@ -0,0 +1,42 @@
+package runner
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Backend is how GitOps runs git: BackendGit spawns the git binary, and
+// BackendGoGit performs the operations mgit needs itself (remote listing,
+// upstream detection, clone, fetch and push) in process with go-git, for
+// minimal containers without git.
+type Backend string
+
+const (
+	// BackendAuto picks BackendGit when git is on PATH and BackendGoGit
+	// otherwise. It is the zero value.
+	BackendAuto  Backend = ""
+	BackendGit   Backend = "git"
+	BackendGoGit Backend = "go-git"
+)
+
+// ParseBackend parses a --backend value; empty and "auto" mean BackendAuto.
+func ParseBackend(s string) (Backend, error) {
+	switch b := Backend(strings.ToLower(strings.TrimSpace(s))); b {
+	case BackendAuto, "auto":
+		return BackendAuto, nil
+	case BackendGit, BackendGoGit:
+		return b, nil
+	}
+	return "", fmt.Errorf("invalid backend %q (use auto, git or go-git)", s)
+}
+
+// Select resolves BackendAuto to the backend that will run.
+func (b Backend) Select() Backend {
+	if b != BackendAuto {
+		return b
+	}
+	if GitInstalled() != nil {
+		return BackendGoGit
+	}
+	return BackendGit
+}
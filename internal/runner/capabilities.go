@@ -0,0 +1,143 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Capabilities are the git features mgit adapts to, derived from
+// `git --version`. An unrecognized version counts as a modern git.
+type Capabilities struct {
+	// Version is the `git --version` output.
+	Version string `json:"version"`
+	// SSHCommand: GIT_SSH_COMMAND is honored (git 2.3); otherwise ssh
+	// settings go through a GIT_SSH wrapper script.
+	SSHCommand bool `json:"sshCommand"`
+	// RemoteGetURL: `git remote get-url` exists (git 2.7); otherwise remote
+	// URLs are read from `git remote -v`.
+	RemoteGetURL bool `json:"remoteGetUrl"`
+	// ConfigFlag: `git -c name=value` exists (git 1.7.2); otherwise mgit's
+	// -c settings (HTTPS credentials, signing) are dropped.
+	ConfigFlag bool `json:"configFlag"`
+}
+
+var gitVersionRE = regexp.MustCompile(`(\d+)\.(\d+)(?:\.(\d+))?`)
+
+// ParseGitVersion extracts major, minor and patch from `git --version`
+// output such as "git version 2.39.3 (Apple Git-146)".
+func ParseGitVersion(out string) ([3]int, bool) {
+	m := gitVersionRE.FindStringSubmatch(out)
+	if m == nil {
+		return [3]int{}, false
+	}
+	var v [3]int
+	for i := range v {
+		v[i], _ = strconv.Atoi(m[i+1])
+	}
+	return v, true
+}
+
+// CapabilitiesFor derives the capabilities of a git from its
+// `git --version` output.
+func CapabilitiesFor(versionOutput string) Capabilities {
+	c := Capabilities{Version: strings.TrimSpace(versionOutput), SSHCommand: true, RemoteGetURL: true, ConfigFlag: true}
+	v, ok := ParseGitVersion(versionOutput)
+	if !ok {
+		return c
+	}
+	atLeast := func(min [3]int) bool {
+		for i := range v {
+			if v[i] != min[i] {
+				return v[i] > min[i]
+			}
+		}
+		return true
+	}
+	c.SSHCommand = atLeast([3]int{2, 3, 0})
+	c.RemoteGetURL = atLeast([3]int{2, 7, 0})
+	c.ConfigFlag = atLeast([3]int{1, 7, 2})
+	return c
+}
+
+// Degraded lists the features mgit works around or does without on this git.
+func (c Capabilities) Degraded() []string {
+	var out []string
+	if !c.SSHCommand {
+		out = append(out, "no GIT_SSH_COMMAND: ssh settings are passed through a GIT_SSH wrapper script")
+	}
+	if !c.RemoteGetURL {
+		out = append(out, "no `remote get-url`: remote URLs are read from `git remote -v`")
+	}
+	if !c.ConfigFlag {
+		out = append(out, "no `git -c`: HTTPS credential and signing settings are not applied")
+	}
+	return out
+}
+
+// capabilities caches the probe; PATH does not change during a run.
+var capabilities struct {
+	sync.Mutex
+	caps Capabilities
+	done bool
+}
+
+// Capabilities probes `git --version` once per process. When git cannot be
+// run, every feature is assumed, so the real command reports the problem.
+func (g *GitOps) Capabilities(ctx context.Context) Capabilities {
+	capabilities.Lock()
+	defer capabilities.Unlock()
+	if !capabilities.done {
+		quiet := *g.Shell
+		quiet.Verbose = false
+		out, err := quiet.Output(ctx, "git", []string{"--version"}, nil)
+		if err != nil {
+			// Don't cache a failure: ctx may just have been cancelled.
+			return CapabilitiesFor("")
+		}
+		capabilities.caps, capabilities.done = CapabilitiesFor(out), true
+	}
+	return capabilities.caps
+}
+
+// adapt fits a git invocation to the capabilities of the installed git:
+// leading -c settings are dropped when git has no -c, and GIT_SSH_COMMAND
+// becomes a GIT_SSH wrapper script when git ignores it. The cleanup func
+// removes the script.
+func (g *GitOps) adapt(ctx context.Context, args []string, extraEnv map[string]string) ([]string, map[string]string, func(), error) {
+	if len(args) > 1 && args[0] == "-c" && !g.Capabilities(ctx).ConfigFlag {
+		var dropped []string
+		for len(args) > 1 && args[0] == "-c" {
+			dropped = append(dropped, args[1])
+			args = args[2:]
+		}
+		if g.Shell.Log != nil {
+			fmt.Fprintf(g.Shell.Log, "warn: this git has no -c option; ignoring %s\n", strings.Join(dropped, ", "))
+		}
+	}
+	env, cleanup, err := g.sshEnv(ctx, extraEnv)
+	return args, env, cleanup, err
+}
+
+// remoteVerboseURLs reads the fetch or push URLs of a remote from
+// `git remote -v`, for gits without `remote get-url`.
+func (g *GitOps) remoteVerboseURLs(ctx context.Context, name, kind string) ([]string, error) {
+	all, err := g.AllRemoteURLs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	urls := all[name].Push
+	if kind == "fetch" {
+		urls = nil
+		if u := all[name].Fetch; u != "" {
+			urls = []string{u}
+		}
+	}
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("no such remote '%s'", name)
+	}
+	return urls, nil
+}
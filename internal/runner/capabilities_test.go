@@ -0,0 +1,28 @@
+package runner
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCapabilitiesFor(t *testing.T) {
+	for out, want := range map[string]Capabilities{
+		"git version 2.39.3 (Apple Git-146)": {SSHCommand: true, RemoteGetURL: true, ConfigFlag: true},
+		"git version 2.45.1.windows.1":       {SSHCommand: true, RemoteGetURL: true, ConfigFlag: true},
+		"git version 2.5.0":                  {SSHCommand: true, RemoteGetURL: false, ConfigFlag: true},
+		"git version 1.8.3.1":                {SSHCommand: false, RemoteGetURL: false, ConfigFlag: true},
+		"git version 1.7.1":                  {},
+		"something else":                     {SSHCommand: true, RemoteGetURL: true, ConfigFlag: true},
+	} {
+		want.Version = out
+		if got := CapabilitiesFor(out); got != want {
+			t.Errorf("CapabilitiesFor(%q) = %+v, want %+v", out, got, want)
+		}
+	}
+	if d := CapabilitiesFor("git version 2.45.0").Degraded(); len(d) != 0 {
+		t.Errorf("modern git degraded: %q", d)
+	}
+	if d := CapabilitiesFor("git version 1.8.3.1").Degraded(); len(d) != 2 || !strings.HasPrefix(d[0], "no GIT_SSH_COMMAND") {
+		t.Errorf("git 1.8 degraded = %q", d)
+	}
+}
@@ -0,0 +1,91 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ControlPaths returns the ControlPath values set in ssh arguments, as
+// -o ControlPath=PATH or -S PATH. "none" disables multiplexing and is
+// skipped.
+func ControlPaths(args []string) []string {
+	var paths []string
+	add := func(p string) {
+		if p = strings.TrimSpace(p); p != "" && !strings.EqualFold(p, "none") && !slices.Contains(paths, p) {
+			paths = append(paths, p)
+		}
+	}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-o" || arg == "-S":
+			if i+1 >= len(args) {
+				continue
+			}
+			i++
+			if arg == "-S" {
+				add(args[i])
+			} else if value, ok := controlPathOption(args[i]); ok {
+				add(value)
+			}
+		case strings.HasPrefix(arg, "-o"):
+			if value, ok := controlPathOption(arg[2:]); ok {
+				add(value)
+			}
+		case strings.HasPrefix(arg, "-S"):
+			add(arg[2:])
+		}
+	}
+	return paths
+}
+
+// controlPathOption returns the value of an -o option when it is
+// ControlPath, written as ControlPath=PATH or ControlPath PATH.
+func controlPathOption(opt string) (string, bool) {
+	key, value, ok := strings.Cut(strings.TrimSpace(opt), "=")
+	if !ok {
+		key, value, ok = strings.Cut(strings.TrimSpace(opt), " ")
+	}
+	return value, ok && strings.EqualFold(strings.TrimSpace(key), "ControlPath")
+}
+
+// ControlPathGlob turns a ControlPath into a filepath.Glob pattern: each
+// %-token ssh expands per connection (%h, %p, %r, %C, ...) matches anything,
+// "%%" is a literal percent, and glob characters in the rest are escaped.
+func ControlPathGlob(path string) string {
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		switch c := path[i]; {
+		case c == '%' && i+1 < len(path):
+			i++
+			if path[i] == '%' {
+				b.WriteByte('%')
+			} else if !strings.HasSuffix(b.String(), "*") {
+				b.WriteByte('*')
+			}
+		case strings.IndexByte(`*?[\`, c) >= 0:
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// Control sends a multiplexing command (ssh -O: check, exit, stop) to the
+// master listening on socket.
+func (c SSHClient) Control(ctx context.Context, socket, command string) error {
+	args := append(slices.Clone(c[min(1, len(c)):]), "-S", socket, "-O", command, "mgit")
+	out, err := CommandContext(ctx, c.Name(), args...).CombinedOutput()
+	if err != nil {
+		if msg, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n"); msg != "" {
+			return errors.New(msg)
+		}
+		return fmt.Errorf("%s -O %s: %w", c.Name(), command, err)
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package runner
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestControlPaths(t *testing.T) {
+	args := []string{"-4", "-o", "ControlMaster=auto", "-o", "controlpath=~/.ssh/cm-%C", "-oControlPath /tmp/a", "-S", "/tmp/b", "-o", "ControlPath=none", "-S/tmp/a"}
+	if got, want := ControlPaths(args), []string{"~/.ssh/cm-%C", "/tmp/a", "/tmp/b"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("ControlPaths() = %q, want %q", got, want)
+	}
+}
+
+func TestControlPathGlob(t *testing.T) {
+	for path, want := range map[string]string{
+		"/run/cm-%r@%h:%p": "/run/cm-*@*:*",
+		"/run/cm-%C":       "/run/cm-*",
+		"/run/%h%p":        "/run/*",
+		"/run/100%%-[x]":   `/run/100%-\[x]`,
+	} {
+		if got := ControlPathGlob(path); got != want {
+			t.Errorf("ControlPathGlob(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
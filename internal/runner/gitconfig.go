@@ -0,0 +1,404 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// configVar is one variable of a git config file. Name is lowercased
+// except for its subsection, like `git config --get-regexp` prints it.
+type configVar struct {
+	Name, Value string
+}
+
+// errNeedsGit reports a config setup the file reader does not reproduce, so
+// the caller asks git instead.
+var errNeedsGit = errors.New("config needs git to evaluate")
+
+// repoFiles is what ReadConfigFiles answers from: the repository found by
+// walking up from Shell.Dir and the variables of every config file git
+// would read there, lowest precedence first.
+type repoFiles struct {
+	Root      string
+	GitDir    string
+	CommonDir string
+	Vars      []configVar
+}
+
+// readRepoFiles finds the repository containing dir and reads its config
+// files. It returns errNeedsGit, or a parse error, for anything it cannot
+// read exactly as git would: includes, insteadOf rewrites, per-worktree
+// config, environment overrides and unknown syntax.
+func readRepoFiles(dir string) (*repoFiles, error) {
+	if runtime.GOOS == "windows" {
+		return nil, errNeedsGit // the system config lives next to git.exe
+	}
+	for _, env := range []string{"GIT_DIR", "GIT_WORK_TREE", "GIT_COMMON_DIR", "GIT_CONFIG", "GIT_CONFIG_COUNT", "GIT_CONFIG_PARAMETERS", "GIT_CEILING_DIRECTORIES"} {
+		if os.Getenv(env) != "" {
+			return nil, errNeedsGit
+		}
+	}
+	if dir == "" {
+		dir = "."
+	}
+	start, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	rf := &repoFiles{}
+	for d := start; ; {
+		if _, err := os.Stat(filepath.Join(d, ".git")); err == nil {
+			rf.Root = d
+			break
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			return nil, errNeedsGit // not a work tree, or a bare repository
+		}
+		d = parent
+	}
+	if rf.GitDir, err = dotGitDir(rf.Root); err != nil {
+		return nil, err
+	}
+	rf.CommonDir = rf.GitDir
+	if data, err := os.ReadFile(filepath.Join(rf.GitDir, "commondir")); err == nil {
+		rf.CommonDir = strings.TrimSpace(string(data))
+		if !filepath.IsAbs(rf.CommonDir) {
+			rf.CommonDir = filepath.Join(rf.GitDir, rf.CommonDir)
+		}
+	}
+
+	var files []string
+	if os.Getenv("GIT_CONFIG_NOSYSTEM") == "" {
+		system := os.Getenv("GIT_CONFIG_SYSTEM")
+		if system == "" {
+			system = "/etc/gitconfig"
+		}
+		files = append(files, system)
+	}
+	if global := os.Getenv("GIT_CONFIG_GLOBAL"); global != "" {
+		files = append(files, global)
+	} else {
+		home, _ := os.UserHomeDir()
+		xdg := os.Getenv("XDG_CONFIG_HOME")
+		if xdg == "" && home != "" {
+			xdg = filepath.Join(home, ".config")
+		}
+		if xdg != "" {
+			files = append(files, filepath.Join(xdg, "git", "config"))
+		}
+		if home != "" {
+			files = append(files, filepath.Join(home, ".gitconfig"))
+		}
+	}
+	files = append(files, filepath.Join(rf.CommonDir, "config"))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		vars, err := parseGitConfig(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		rf.Vars = append(rf.Vars, vars...)
+	}
+	for _, v := range rf.Vars {
+		section, _, _ := strings.Cut(v.Name, ".")
+		key := v.Name[strings.LastIndex(v.Name, ".")+1:]
+		switch {
+		case section == "include" || section == "includeif":
+			return nil, errNeedsGit
+		case section == "url" && (key == "insteadof" || key == "pushinsteadof"):
+			return nil, errNeedsGit
+		case v.Name == "extensions.worktreeconfig" || v.Name == "extensions.refstorage":
+			return nil, errNeedsGit
+		}
+	}
+	return rf, nil
+}
+
+// dotGitDir is the git directory of the work tree at root: .git itself, or
+// where the .git file of a linked worktree or submodule points.
+func dotGitDir(root string) (string, error) {
+	dotGit := filepath.Join(root, ".git")
+	st, err := os.Stat(dotGit)
+	if err != nil {
+		return "", err
+	}
+	if st.IsDir() {
+		return dotGit, nil
+	}
+	data, err := os.ReadFile(dotGit)
+	if err != nil {
+		return "", err
+	}
+	gitDir, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir:")
+	if !ok {
+		return "", fmt.Errorf("unrecognized %s", dotGit)
+	}
+	gitDir = strings.TrimSpace(gitDir)
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(root, gitDir)
+	}
+	return filepath.Clean(gitDir), nil
+}
+
+// get returns the last value of the variable name, as `git config --get`
+// does.
+func (rf *repoFiles) get(name string) (string, bool) {
+	name = normalizeConfigName(name)
+	value, found := "", false
+	for _, v := range rf.Vars {
+		if v.Name == name {
+			value, found = v.Value, true
+		}
+	}
+	return value, found
+}
+
+// remotes collects the URLs of every remote the way `git remote -v` lists
+// them: the first url to fetch from, and the pushurls, or else every url, to
+// push to.
+func (rf *repoFiles) remotes() map[string]RemoteURLs {
+	urls := map[string][]string{}
+	pushURLs := map[string][]string{}
+	for _, v := range rf.Vars {
+		rest, ok := strings.CutPrefix(v.Name, "remote.")
+		if !ok {
+			continue
+		}
+		if name, ok := strings.CutSuffix(rest, ".url"); ok && v.Value != "" {
+			urls[name] = append(urls[name], v.Value)
+		} else if name, ok := strings.CutSuffix(rest, ".pushurl"); ok && v.Value != "" {
+			pushURLs[name] = append(pushURLs[name], v.Value)
+		}
+	}
+	result := map[string]RemoteURLs{}
+	for name, u := range urls {
+		push := pushURLs[name]
+		if len(push) == 0 {
+			push = u
+		}
+		result[name] = RemoteURLs{Fetch: u[0], Push: push}
+	}
+	return result
+}
+
+// upstreamRemote is the remote of the current branch's upstream, or "" when
+// HEAD is detached or the branch has none. Like git, it requires the
+// remote-tracking branch to exist.
+func (rf *repoFiles) upstreamRemote() (string, error) {
+	data, err := os.ReadFile(filepath.Join(rf.GitDir, "HEAD"))
+	if err != nil {
+		return "", err
+	}
+	branch, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "ref: refs/heads/")
+	if !ok {
+		return "", nil
+	}
+	remote, _ := rf.get("branch." + branch + ".remote")
+	merge, _ := rf.get("branch." + branch + ".merge")
+	if remote == "" || merge == "" {
+		return "", nil
+	}
+	merged, ok := strings.CutPrefix(merge, "refs/heads/")
+	if remote == "." || !ok {
+		return "", errNeedsGit // a local branch as upstream, or an odd merge ref
+	}
+	// Only the default refspec is mapped here; anything else is left to git.
+	for _, v := range rf.Vars {
+		if v.Name == "remote."+remote+".fetch" && strings.TrimPrefix(v.Value, "+") != "refs/heads/*:refs/remotes/"+remote+"/*" {
+			return "", errNeedsGit
+		}
+	}
+	tracking := "refs/remotes/" + remote + "/" + merged
+	if _, err := os.Stat(filepath.Join(rf.CommonDir, filepath.FromSlash(tracking))); err == nil {
+		return remote, nil
+	}
+	packed, err := os.ReadFile(filepath.Join(rf.CommonDir, "packed-refs"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+	for _, line := range strings.Split(string(packed), "\n") {
+		if strings.HasSuffix(line, " "+tracking) {
+			return remote, nil
+		}
+	}
+	return "", nil
+}
+
+// normalizeConfigName lowercases the section and key of a variable name,
+// keeping the subsection as it is.
+func normalizeConfigName(name string) string {
+	first, last := strings.Index(name, "."), strings.LastIndex(name, ".")
+	if first < 0 {
+		return strings.ToLower(name)
+	}
+	return strings.ToLower(name[:first]) + name[first:last] + strings.ToLower(name[last:])
+}
+
+// parseGitConfig parses the text of a git config file. It understands the
+// syntax git writes and documents, and rejects anything else rather than
+// guessing.
+func parseGitConfig(text string) ([]configVar, error) {
+	var vars []configVar
+	var section string
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimLeft(lines[i], " \t")
+		if strings.HasPrefix(line, "[") {
+			end := strings.Index(line, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated section header", i+1)
+			}
+			var err error
+			if section, err = parseSectionHeader(line[1:end]); err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+1, err)
+			}
+			line = strings.TrimLeft(line[end+1:], " \t")
+		}
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if section == "" {
+			return nil, fmt.Errorf("line %d: variable outside a section", i+1)
+		}
+		key := line
+		raw, hasValue := "", false
+		if eq := strings.IndexByte(line, '='); eq >= 0 {
+			key, raw, hasValue = line[:eq], line[eq+1:], true
+		}
+		key = strings.TrimSpace(key)
+		if k, _, ok := strings.Cut(key, "#"); ok && !hasValue {
+			key = strings.TrimSpace(k) // "flag # comment"
+		}
+		if !validConfigKey(key) {
+			return nil, fmt.Errorf("line %d: invalid variable name %q", i+1, key)
+		}
+		value := "true"
+		if hasValue {
+			var err error
+			if value, i, err = parseConfigValue(raw, lines, i); err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+1, err)
+			}
+		}
+		vars = append(vars, configVar{Name: section + "." + strings.ToLower(key), Value: value})
+	}
+	return vars, nil
+}
+
+// parseSectionHeader turns `remote "origin"` or the deprecated `remote.origin`
+// into the variable name prefix "remote.origin".
+func parseSectionHeader(h string) (string, error) {
+	name, sub, quoted := strings.Cut(strings.TrimSpace(h), " ")
+	if !quoted {
+		if n, s, ok := strings.Cut(name, "."); ok {
+			if !validConfigKey(n) {
+				return "", fmt.Errorf("invalid section %q", h)
+			}
+			return strings.ToLower(n) + "." + strings.ToLower(s), nil
+		}
+		if !validConfigKey(name) {
+			return "", fmt.Errorf("invalid section %q", h)
+		}
+		return strings.ToLower(name), nil
+	}
+	sub = strings.TrimSpace(sub)
+	if len(sub) < 2 || sub[0] != '"' || sub[len(sub)-1] != '"' || !validConfigKey(name) {
+		return "", fmt.Errorf("invalid section %q", h)
+	}
+	var b strings.Builder
+	for i := 1; i < len(sub)-1; i++ {
+		c := sub[i]
+		if c == '\\' && i+1 < len(sub)-1 {
+			i++
+			c = sub[i]
+		} else if c == '"' {
+			return "", fmt.Errorf("invalid section %q", h)
+		}
+		b.WriteByte(c)
+	}
+	return strings.ToLower(name) + "." + b.String(), nil
+}
+
+// parseConfigValue decodes a value starting with raw, the rest of line i
+// after '=', following line continuations. It returns the index of the last
+// line it consumed.
+func parseConfigValue(raw string, lines []string, i int) (string, int, error) {
+	var b strings.Builder
+	inQuote, started := false, false
+	keep := 0 // b's length without trailing unquoted whitespace
+	for {
+		continued := false
+	scan:
+		for j := 0; j < len(raw); j++ {
+			c := raw[j]
+			switch {
+			case c == '"':
+				inQuote, started = !inQuote, true
+				keep = b.Len()
+				continue
+			case !inQuote && (c == '#' || c == ';'):
+				break scan
+			case !inQuote && (c == ' ' || c == '\t'):
+				if started {
+					b.WriteByte(c)
+				}
+				continue
+			case c == '\\':
+				if j+1 == len(raw) {
+					continued = true
+					break scan
+				}
+				j++
+				switch raw[j] {
+				case 'n':
+					c = '\n'
+				case 't':
+					c = '\t'
+				case 'b':
+					c = '\b'
+				case '\\', '"':
+					c = raw[j]
+				default:
+					return "", i, fmt.Errorf("invalid escape \\%c", raw[j])
+				}
+			}
+			b.WriteByte(c)
+			started, keep = true, b.Len()
+		}
+		if !continued {
+			if inQuote {
+				return "", i, errors.New("unterminated quote")
+			}
+			return b.String()[:keep], i, nil
+		}
+		if i++; i == len(lines) {
+			return "", i - 1, errors.New("continuation at end of file")
+		}
+		raw = lines[i]
+	}
+}
+
+func validConfigKey(k string) bool {
+	if k == "" {
+		return false
+	}
+	for i, c := range k {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case i > 0 && (c >= '0' && c <= '9' || c == '-'):
+		default:
+			return false
+		}
+	}
+	return true
+}
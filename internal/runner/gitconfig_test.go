@@ -0,0 +1,164 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	gogit "github.com/go-git/go-git/v5"
+)
+
+func TestParseGitConfig(t *testing.T) {
+	got, err := parseGitConfig(`# comment
+[core]
+	bare = false
+	Filemode
+[remote "Origin"]
+	url = git@github.com:org/app.git ; trailing comment
+	pushurl = "git@github.com:org/app #1.git"
+[Branch.Main]
+	remote = origin
+[user]
+	name = "A \"B\"" C
+	email = a@\
+example.com
+[alias] st = status
+`)
+	if err != nil {
+		t.Fatalf("parseGitConfig() error = %v", err)
+	}
+	want := []configVar{
+		{"core.bare", "false"},
+		{"core.filemode", "true"},
+		{"remote.Origin.url", "git@github.com:org/app.git"},
+		{"remote.Origin.pushurl", "git@github.com:org/app #1.git"},
+		{"branch.main.remote", "origin"},
+		{"user.name", `A "B" C`},
+		{"user.email", "a@example.com"},
+		{"alias.st", "status"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("parseGitConfig() = %q, want %q", got, want)
+	}
+
+	for _, bad := range []string{"key = outside", "[core\n", "[core]\n\tname = \"open", "[core]\n\t1key = x", "[core]\n\tk = \\q"} {
+		if _, err := parseGitConfig(bad); err == nil {
+			t.Errorf("parseGitConfig(%q): want error", bad)
+		}
+	}
+}
+
+func TestReadConfigFilesMatchesGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	repo := t.TempDir()
+	ctx := context.Background()
+	plain := NewGitOps(&Shell{Dir: repo, Stdout: io.Discard, Stderr: io.Discard})
+	for _, args := range [][]string{
+		{"init", "-q", "-b", "main"},
+		{"remote", "add", "origin", "git@github.com:org/app.git"},
+		{"remote", "add", "mirror", "git@gitlab.com:org/app.git"},
+		{"remote", "set-url", "--add", "--push", "mirror", "git@example.com:org/app.git"},
+		{"config", "branch.main.remote", "mirror"},
+		{"config", "branch.main.merge", "refs/heads/main"},
+		{"config", "user.email", "dev@example.com"},
+		{"-c", "user.name=dev", "commit", "-q", "--allow-empty", "-m", "init"},
+	} {
+		if err := plain.RunGit(ctx, args, nil); err != nil {
+			t.Fatalf("git %v: %v", args, err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(repo, ".gitmodules"), []byte("[submodule \"lib\"]\n\tpath = lib\n\turl = ../lib.git\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func() {
+		t.Helper()
+		fast := NewGitOps(&Shell{Dir: repo, Stdout: io.Discard, Stderr: io.Discard})
+		fast.ReadConfigFiles = true
+		wantRemotes, _ := plain.AllRemoteURLs(ctx)
+		if got, _ := fast.AllRemoteURLs(ctx); !reflect.DeepEqual(got, wantRemotes) {
+			t.Errorf("AllRemoteURLs() = %+v, git says %+v", got, wantRemotes)
+		}
+		wantUp, _ := plain.CurrentUpstreamRemote(ctx)
+		if got, _ := fast.CurrentUpstreamRemote(ctx); got != wantUp {
+			t.Errorf("CurrentUpstreamRemote() = %q, git says %q", got, wantUp)
+		}
+		if got, want := fast.ConfigValue(ctx, "User.Email"), plain.ConfigValue(ctx, "user.email"); got != want {
+			t.Errorf("ConfigValue() = %q, git says %q", got, want)
+		}
+		wantSubs, _ := plain.Submodules(ctx)
+		if got, _ := fast.Submodules(ctx); !reflect.DeepEqual(got, wantSubs) {
+			t.Errorf("Submodules() = %+v, git says %+v", got, wantSubs)
+		}
+	}
+	if _, err := readRepoFiles(repo); err != nil {
+		t.Fatalf("readRepoFiles() error = %v", err)
+	}
+	check()
+
+	// With the remote-tracking branch in place, both see the upstream.
+	for _, args := range [][]string{{"update-ref", "refs/remotes/mirror/main", "HEAD"}, {"pack-refs", "--all"}} {
+		if err := plain.RunGit(ctx, args, nil); err != nil {
+			t.Fatalf("git %v: %v", args, err)
+		}
+		if got, _ := plain.CurrentUpstreamRemote(ctx); got != "mirror" {
+			t.Fatalf("git upstream remote = %q, want mirror", got)
+		}
+		check()
+	}
+
+	// insteadOf rewrites are left to git.
+	if err := plain.RunGit(ctx, []string{"config", "url.git@internal:.insteadOf", "git@github.com:"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readRepoFiles(repo); !errors.Is(err, errNeedsGit) {
+		t.Fatalf("readRepoFiles() with insteadOf error = %v, want errNeedsGit", err)
+	}
+	check()
+}
+
+func TestReadConfigFilesWithoutGit(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("PATH", t.TempDir())
+	repo := t.TempDir()
+	if _, err := gogit.PlainInit(repo, false); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(filepath.Join(repo, ".git", "config"), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.WriteString("[remote \"origin\"]\n\turl = git@github.com:org/app.git\n\tpushurl = git@mirror:org/app.git\n[branch \"master\"]\n\tremote = origin\n")
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	git := NewGitOps(&Shell{Dir: repo, Stdout: io.Discard, Stderr: io.Discard})
+	if !git.UsesGoGit() {
+		t.Fatal("the go-git backend should be picked without a git binary")
+	}
+	ctx := context.Background()
+	remotes, err := git.Remotes(ctx)
+	if err != nil || remotes["origin"] != "git@github.com:org/app.git" {
+		t.Fatalf("Remotes() without git = %v, %v", remotes, err)
+	}
+	if push, err := git.PushURLs(ctx, "origin"); err != nil || len(push) != 1 || push[0] != "git@mirror:org/app.git" {
+		t.Fatalf("PushURLs() without git = %v, %v", push, err)
+	}
+	if remote, err := git.CurrentUpstreamRemote(ctx); err != nil || remote != "origin" {
+		t.Fatalf("CurrentUpstreamRemote() without git = %q, %v", remote, err)
+	}
+}
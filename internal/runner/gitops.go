@@ -4,12 +4,33 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io/fs"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 )
 
 type GitOps struct {
 	Shell *Shell
+	// ReadConfigFiles answers read-only queries (remote URLs, the upstream
+	// remote, config values, .gitmodules) from the config files instead of
+	// running git, whenever they can be read exactly as git would. Set it
+	// for commands where spawning git dominates the run time. Without a git
+	// binary on PATH the files are always read, so read-only commands work
+	// in minimal containers.
+	ReadConfigFiles bool
+	// Backend runs clone, fetch and push and answers remote and upstream
+	// queries; the zero value picks go-git only when git is missing.
+	Backend Backend
+	// Identity authenticates SSH remotes for the go-git backend; nil leaves
+	// it to ssh-agent. The git binary gets GIT_SSH_COMMAND instead.
+	Identity *SSHIdentity
+
+	filesOnce sync.Once
+	files     *repoFiles
 }
 
 func NewGitOps(shell *Shell) *GitOps {
@@ -23,19 +44,48 @@ func GitInstalled() error {
 	return nil
 }
 
+// RunGit runs git with args. With the go-git backend only clone, fetch and
+// push run, and extraEnv is not used.
 func (g *GitOps) RunGit(ctx context.Context, args []string, extraEnv map[string]string) error {
-	return g.Shell.Run(ctx, "git", args, extraEnv)
+	if g.UsesGoGit() {
+		return g.runGoGit(ctx, args)
+	}
+	args, env, cleanup, err := g.adapt(ctx, args, extraEnv)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	return g.Shell.Run(ctx, "git", args, env)
 }
 
 func (g *GitOps) GitOutput(ctx context.Context, args []string, extraEnv map[string]string) (string, error) {
-	return g.Shell.Output(ctx, "git", args, extraEnv)
+	args, env, cleanup, err := g.adapt(ctx, args, extraEnv)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+	return g.Shell.Output(ctx, "git", args, env)
 }
 
 func (g *GitOps) GitVersion(ctx context.Context) (string, error) {
 	return g.GitOutput(ctx, []string{"--version"}, nil)
 }
 
+// configFiles returns the repository's config files, or nil when git has
+// to be asked instead.
+func (g *GitOps) configFiles() *repoFiles {
+	g.filesOnce.Do(func() {
+		if g.ReadConfigFiles || GitInstalled() != nil {
+			g.files, _ = readRepoFiles(g.Shell.Dir)
+		}
+	})
+	return g.files
+}
+
 func (g *GitOps) IsRepo(ctx context.Context) (bool, error) {
+	if g.configFiles() != nil {
+		return true, nil
+	}
 	out, err := g.GitOutput(ctx, []string{"rev-parse", "--is-inside-work-tree"}, nil)
 	if err != nil {
 		return false, err
@@ -47,30 +97,151 @@ func (g *GitOps) RemoteURL(ctx context.Context, name string) (string, error) {
 	if strings.TrimSpace(name) == "" {
 		return "", errors.New("empty remote name")
 	}
+	if g.UsesGoGit() {
+		urls, err := g.remoteVerboseURLs(ctx, name, "fetch")
+		if err != nil {
+			return "", err
+		}
+		return urls[0], nil
+	}
+	if files := g.configFiles(); files != nil {
+		if urls, ok := files.remotes()[name]; ok {
+			return urls.Fetch, nil
+		}
+	}
+	if !g.Capabilities(ctx).RemoteGetURL {
+		urls, err := g.remoteVerboseURLs(ctx, name, "fetch")
+		if err != nil {
+			return "", err
+		}
+		return urls[0], nil
+	}
 	return g.GitOutput(ctx, []string{"remote", "get-url", name}, nil)
 }
 
+// PushURLs returns the URLs `git push <name>` pushes to: every
+// remote.<name>.pushurl, or the fetch URL when there is none.
+func (g *GitOps) PushURLs(ctx context.Context, name string) ([]string, error) {
+	if strings.TrimSpace(name) == "" {
+		return nil, errors.New("empty remote name")
+	}
+	if g.UsesGoGit() {
+		return g.remoteVerboseURLs(ctx, name, "push")
+	}
+	if files := g.configFiles(); files != nil {
+		if urls, ok := files.remotes()[name]; ok {
+			return urls.Push, nil
+		}
+	}
+	if !g.Capabilities(ctx).RemoteGetURL {
+		return g.remoteVerboseURLs(ctx, name, "push")
+	}
+	return g.outputLines(ctx, "remote", "get-url", "--push", "--all", name)
+}
+
+func (g *GitOps) RemoteNames(ctx context.Context) ([]string, error) {
+	if g.UsesGoGit() {
+		all, err := g.goGitRemotes()
+		if err != nil {
+			return nil, err
+		}
+		return sortedRemoteNames(all), nil
+	}
+	return g.outputLines(ctx, "remote")
+}
+
+// Remotes maps each remote with a URL to its fetch URL, as RemoteURL
+// returns it.
 func (g *GitOps) Remotes(ctx context.Context) (map[string]string, error) {
-	list, err := g.GitOutput(ctx, []string{"remote"}, nil)
+	all, err := g.AllRemoteURLs(ctx)
 	if err != nil {
 		return nil, err
 	}
-	result := map[string]string{}
-	for _, line := range strings.Split(list, "\n") {
-		name := strings.TrimSpace(line)
-		if name == "" {
+	result := make(map[string]string, len(all))
+	for name, urls := range all {
+		if urls.Fetch != "" {
+			result[name] = urls.Fetch
+		}
+	}
+	return result, nil
+}
+
+// RemoteURLs are the URLs of one remote after insteadOf rewriting: the one
+// git fetches from, and every one `git push` pushes to.
+type RemoteURLs struct {
+	Fetch string
+	Push  []string
+}
+
+// AllRemoteURLs reads the URLs of every remote with a single
+// `git remote -v`, instead of a `git remote get-url` per remote.
+func (g *GitOps) AllRemoteURLs(ctx context.Context) (map[string]RemoteURLs, error) {
+	if g.UsesGoGit() {
+		return g.goGitRemotes()
+	}
+	if files := g.configFiles(); files != nil {
+		return files.remotes(), nil
+	}
+	lines, err := g.outputLines(ctx, "remote", "-v")
+	if err != nil {
+		return nil, err
+	}
+	return parseRemoteVerbose(lines), nil
+}
+
+// parseRemoteVerbose parses `git remote -v` lines such as
+// "origin\tgit@github.com:org/repo.git (push)". git lists only the first URL
+// of a remote as fetch URL, and all push URLs.
+func parseRemoteVerbose(lines []string) map[string]RemoteURLs {
+	result := map[string]RemoteURLs{}
+	for _, line := range lines {
+		name, rest, ok := strings.Cut(line, "\t")
+		if !ok {
 			continue
 		}
-		u, err := g.RemoteURL(ctx, name)
-		if err != nil {
-			return nil, fmt.Errorf("get URL for remote %q: %w", name, err)
+		urls := result[name]
+		if u, ok := strings.CutSuffix(rest, " (fetch)"); ok && urls.Fetch == "" {
+			urls.Fetch = u
+		} else if u, ok := strings.CutSuffix(rest, " (push)"); ok {
+			urls.Push = append(urls.Push, u)
 		}
-		result[name] = u
+		result[name] = urls
 	}
-	return result, nil
+	return result
+}
+
+// Commands lists git's own subcommands, external git-* commands and aliases.
+func (g *GitOps) Commands(ctx context.Context) ([]string, error) {
+	return g.outputLines(ctx, "--list-cmds=main,others,alias,nohelpers")
+}
+
+func (g *GitOps) outputLines(ctx context.Context, args ...string) ([]string, error) {
+	out, err := g.GitOutput(ctx, args, nil)
+	if err != nil {
+		return nil, err
+	}
+	var lines []string
+	for _, line := range strings.Split(out, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, nil
 }
 
 func (g *GitOps) CurrentUpstreamRemote(ctx context.Context) (string, error) {
+	if g.UsesGoGit() {
+		return g.goGitUpstreamRemote()
+	}
+	if files := g.configFiles(); files != nil {
+		remote, err := files.upstreamRemote()
+		switch {
+		case err == nil && remote == "":
+			return "", errors.New("no upstream configured for the current branch")
+		case err == nil:
+			return remote, nil
+		}
+	}
 	out, err := g.GitOutput(ctx, []string{"rev-parse", "--abbrev-ref", "--symbolic-full-name", "@{upstream}"}, nil)
 	if err != nil {
 		return "", err
@@ -100,3 +271,247 @@ func (g *GitOps) GuessDefaultRemote(ctx context.Context) (string, error) {
 	}
 	return "", fmt.Errorf("cannot determine default remote automatically")
 }
+
+// DefaultPushRemote returns the remote a bare `git push` pushes to:
+// branch.<name>.pushRemote, then remote.pushDefault, then the remote
+// GuessDefaultRemote picks for fetching.
+func (g *GitOps) DefaultPushRemote(ctx context.Context) (string, error) {
+	// symbolic-ref works on unborn branches and is quiet when detached.
+	if branch, err := g.GitOutput(ctx, []string{"symbolic-ref", "--short", "-q", "HEAD"}, nil); err == nil && branch != "" {
+		if remote := g.ConfigValue(ctx, "branch."+branch+".pushRemote"); remote != "" {
+			return remote, nil
+		}
+	}
+	if remote := g.ConfigValue(ctx, "remote.pushDefault"); remote != "" {
+		return remote, nil
+	}
+	return g.GuessDefaultRemote(ctx)
+}
+
+// ConfigValue returns the effective value of a git config key, or "" when unset.
+func (g *GitOps) ConfigValue(ctx context.Context, key string) string {
+	if files := g.configFiles(); files != nil {
+		value, _ := files.get(key)
+		return value
+	}
+	out, err := g.Shell.Output(ctx, "git", []string{"config", "--get", key}, nil)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(out)
+}
+
+// ConfigOrigin is ConfigValue plus where the value is set, as printed by
+// `git config --show-origin`, e.g. "file:.git/config".
+func (g *GitOps) ConfigOrigin(ctx context.Context, key string) (value, origin string) {
+	out, err := g.Shell.Output(ctx, "git", []string{"config", "--show-origin", "--get", key}, nil)
+	if err != nil {
+		return "", ""
+	}
+	origin, value, _ = strings.Cut(strings.TrimSpace(out), "\t")
+	return value, origin
+}
+
+// ConfigEntries returns the config entries whose names match the regular
+// expression pattern, as name and value pairs. Names are lowercased by git
+// except for their subsection.
+func (g *GitOps) ConfigEntries(ctx context.Context, pattern string) [][2]string {
+	out, err := g.Shell.Output(ctx, "git", []string{"config", "--get-regexp", pattern}, nil)
+	if err != nil {
+		return nil
+	}
+	var entries [][2]string
+	for _, line := range strings.Split(out, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			name, value, _ := strings.Cut(line, " ")
+			entries = append(entries, [2]string{name, value})
+		}
+	}
+	return entries
+}
+
+// ConfigEntry is a config entry and the file it was read from.
+type ConfigEntry struct {
+	Name, Value string
+	// Origin is the file path, without git's "file:" prefix.
+	Origin string
+}
+
+// ScopedConfigEntries is ConfigEntries for one scope, e.g. "--global" or
+// "--file=<path>", without following includes.
+func (g *GitOps) ScopedConfigEntries(ctx context.Context, scope, pattern string) []ConfigEntry {
+	out, err := g.Shell.Output(ctx, "git", []string{"config", scope, "--no-includes", "--show-origin", "--get-regexp", pattern}, nil)
+	if err != nil {
+		return nil
+	}
+	var entries []ConfigEntry
+	for _, line := range strings.Split(out, "\n") {
+		origin, rest, ok := strings.Cut(strings.TrimSpace(line), "\t")
+		if !ok {
+			continue
+		}
+		name, value, _ := strings.Cut(rest, " ")
+		entries = append(entries, ConfigEntry{Name: name, Value: value, Origin: strings.TrimPrefix(origin, "file:")})
+	}
+	return entries
+}
+
+type CommitAuthor struct {
+	Hash  string `json:"hash"`
+	Email string `json:"email"`
+}
+
+// UnpushedAuthors lists commits reachable from HEAD that are not on any
+// remote-tracking branch of remote, with their author emails.
+func (g *GitOps) UnpushedAuthors(ctx context.Context, remote string) ([]CommitAuthor, error) {
+	if _, err := g.GitOutput(ctx, []string{"rev-parse", "--verify", "-q", "HEAD"}, nil); err != nil {
+		// Unborn branch: nothing has been committed yet.
+		return nil, nil
+	}
+	out, err := g.GitOutput(ctx, []string{"log", "--format=%H%x09%ae", "HEAD", "--not", "--remotes=" + remote}, nil)
+	if err != nil {
+		return nil, err
+	}
+	var commits []CommitAuthor
+	for _, line := range strings.Split(out, "\n") {
+		hash, email, ok := strings.Cut(strings.TrimSpace(line), "\t")
+		if !ok {
+			continue
+		}
+		commits = append(commits, CommitAuthor{Hash: hash, Email: email})
+	}
+	return commits, nil
+}
+
+// HooksDir returns the absolute hooks directory, honoring core.hooksPath.
+func (g *GitOps) HooksDir(ctx context.Context) (string, error) {
+	out, err := g.GitOutput(ctx, []string{"rev-parse", "--git-path", "hooks"}, nil)
+	if err != nil {
+		return "", err
+	}
+	dir := strings.TrimSpace(out)
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(g.Shell.Dir, dir)
+	}
+	return filepath.Abs(dir)
+}
+
+// TopLevel returns the root of the working tree containing Shell.Dir.
+func (g *GitOps) TopLevel(ctx context.Context) (string, error) {
+	return g.GitOutput(ctx, []string{"rev-parse", "--show-toplevel"}, nil)
+}
+
+// CurrentBranch returns the checked-out branch name, or "HEAD" when detached.
+func (g *GitOps) CurrentBranch(ctx context.Context) (string, error) {
+	return g.GitOutput(ctx, []string{"rev-parse", "--abbrev-ref", "HEAD"}, nil)
+}
+
+// AheadBehind counts commits HEAD has that its upstream lacks and vice versa.
+// ok is false when the current branch has no upstream.
+func (g *GitOps) AheadBehind(ctx context.Context) (ahead, behind int, ok bool, err error) {
+	if _, err := g.GitOutput(ctx, []string{"rev-parse", "--verify", "-q", "@{upstream}"}, nil); err != nil {
+		return 0, 0, false, nil
+	}
+	out, err := g.GitOutput(ctx, []string{"rev-list", "--left-right", "--count", "HEAD...@{upstream}"}, nil)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	fields := strings.Fields(out)
+	if len(fields) != 2 {
+		return 0, 0, false, fmt.Errorf("unexpected rev-list output %q", out)
+	}
+	if ahead, err = strconv.Atoi(fields[0]); err == nil {
+		behind, err = strconv.Atoi(fields[1])
+	}
+	if err != nil {
+		return 0, 0, false, fmt.Errorf("parse rev-list output %q: %w", out, err)
+	}
+	return ahead, behind, true, nil
+}
+
+// Submodule is an entry of .gitmodules.
+type Submodule struct {
+	Name string `json:"name"`
+	Path string `json:"path,omitempty"`
+	URL  string `json:"url"`
+}
+
+// Submodules reads .gitmodules at the root of the working tree, in file
+// order. It returns nil without error when the file does not exist.
+func (g *GitOps) Submodules(ctx context.Context) ([]Submodule, error) {
+	if files := g.configFiles(); files != nil {
+		if subs, err := readGitmodules(filepath.Join(files.Root, ".gitmodules")); err == nil {
+			return subs, nil
+		}
+	}
+	top, err := g.TopLevel(ctx)
+	if err != nil {
+		return nil, err
+	}
+	file := filepath.Join(strings.TrimSpace(top), ".gitmodules")
+	if _, err := os.Stat(file); errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	lines, err := g.outputLines(ctx, "config", "--file", file, "--get-regexp", `^submodule\..*\.(url|path)$`)
+	if err != nil {
+		// git config exits 1 when nothing matches.
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+			return nil, nil
+		}
+		return nil, err
+	}
+	vars := make([]configVar, 0, len(lines))
+	for _, line := range lines {
+		name, value, _ := strings.Cut(line, " ")
+		vars = append(vars, configVar{Name: name, Value: value})
+	}
+	return submodulesFrom(vars), nil
+}
+
+// readGitmodules is Submodules reading the file itself.
+func readGitmodules(file string) ([]Submodule, error) {
+	data, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	vars, err := parseGitConfig(string(data))
+	if err != nil {
+		return nil, err
+	}
+	return submodulesFrom(vars), nil
+}
+
+// submodulesFrom collects the submodule.<name>.url and .path variables of
+// .gitmodules into submodules, in the order they first appear.
+func submodulesFrom(vars []configVar) []Submodule {
+	var subs []Submodule
+	index := map[string]int{}
+	for _, v := range vars {
+		key, ok := strings.CutPrefix(v.Name, "submodule.")
+		dot := strings.LastIndex(key, ".")
+		if !ok || dot < 0 {
+			continue
+		}
+		name, field := key[:dot], key[dot+1:]
+		if field != "url" && field != "path" {
+			continue
+		}
+		value := v.Value
+		i, ok := index[name]
+		if !ok {
+			i = len(subs)
+			index[name] = i
+			subs = append(subs, Submodule{Name: name})
+		}
+		if field == "url" {
+			subs[i].URL = value
+		} else {
+			subs[i].Path = value
+		}
+	}
+	return subs
+}
@@ -0,0 +1,24 @@
+package runner
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRemoteVerbose(t *testing.T) {
+	got := parseRemoteVerbose([]string{
+		"origin\tgit@github.com:org/app.git (fetch)",
+		"origin\tgit@github.com:org/app.git (push)",
+		"origin\tgit@gitlab.com:org/app.git (push)",
+		"mirror\thttps://example.com/app.git (fetch)",
+		"mirror\tgit@example.com:app.git (push)",
+		"not a remote line",
+	})
+	want := map[string]RemoteURLs{
+		"origin": {Fetch: "git@github.com:org/app.git", Push: []string{"git@github.com:org/app.git", "git@gitlab.com:org/app.git"}},
+		"mirror": {Fetch: "https://example.com/app.git", Push: []string{"git@example.com:app.git"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("parseRemoteVerbose() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,571 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	gogit "github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/pavelBuzdanov/mgit/pkg/trace"
+)
+
+// SSHIdentity is how the go-git backend authenticates over SSH, its
+// counterpart of the GIT_SSH_COMMAND mgit builds for the git binary. ssh
+// options (hostDefaults, sshCommand, ProxyJump) have no equivalent there.
+type SSHIdentity struct {
+	// KeyPath is the private key, or the public key of an ssh-agent
+	// identity; empty uses every key in ssh-agent. A key file that cannot
+	// be used without its passphrase is looked for in ssh-agent by its
+	// .pub file.
+	KeyPath string
+	// KnownHostsFiles verify the server; empty means ~/.ssh/known_hosts.
+	KnownHostsFiles []string
+	// StrictHostKeyChecking is the rule's ssh setting: "no" accepts any
+	// host key and "accept-new" records an unknown host in the first of
+	// KnownHostsFiles, as ssh does. Otherwise, "ask" included since go-git
+	// cannot prompt, a host not in KnownHostsFiles is refused.
+	StrictHostKeyChecking string
+}
+
+// UsesGoGit reports whether g runs clone, fetch and push through go-git.
+func (g *GitOps) UsesGoGit() bool {
+	return g.Backend.Select() == BackendGoGit
+}
+
+func (g *GitOps) openRepo() (*gogit.Repository, error) {
+	dir := g.Shell.Dir
+	if dir == "" {
+		dir = "."
+	}
+	repo, err := gogit.PlainOpenWithOptions(dir, &gogit.PlainOpenOptions{DetectDotGit: true, EnableDotGitCommonDir: true})
+	if err != nil {
+		return nil, fmt.Errorf("open repository: %w", err)
+	}
+	return repo, nil
+}
+
+// goGitRemotes is AllRemoteURLs read by go-git.
+func (g *GitOps) goGitRemotes() (map[string]RemoteURLs, error) {
+	repo, err := g.openRepo()
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := repo.Config()
+	if err != nil {
+		return nil, fmt.Errorf("read git config: %w", err)
+	}
+	result := make(map[string]RemoteURLs, len(cfg.Remotes))
+	for name, r := range cfg.Remotes {
+		if len(r.URLs) == 0 {
+			continue
+		}
+		// go-git has no pushurl of its own; git pushes to those instead of the URLs.
+		push := cfg.Raw.Section("remote").Subsection(name).Options.GetAll("pushurl")
+		if len(push) == 0 {
+			push = slices.Clone(r.URLs)
+		}
+		result[name] = RemoteURLs{Fetch: r.URLs[0], Push: push}
+	}
+	return result, nil
+}
+
+// goGitUpstreamRemote is CurrentUpstreamRemote read by go-git.
+func (g *GitOps) goGitUpstreamRemote() (string, error) {
+	repo, err := g.openRepo()
+	if err != nil {
+		return "", err
+	}
+	branch, err := goGitBranch(repo)
+	if err != nil {
+		return "", err
+	}
+	cfg, err := repo.Config()
+	if err != nil {
+		return "", fmt.Errorf("read git config: %w", err)
+	}
+	if b, ok := cfg.Branches[branch]; ok && b.Remote != "" {
+		return b.Remote, nil
+	}
+	return "", errors.New("no upstream configured for the current branch")
+}
+
+// goGitBranch returns the branch HEAD points at, born or not.
+func goGitBranch(repo *gogit.Repository) (string, error) {
+	head, err := repo.Storer.Reference(plumbing.HEAD)
+	if err != nil {
+		return "", fmt.Errorf("read HEAD: %w", err)
+	}
+	if head.Type() != plumbing.SymbolicReference || !head.Target().IsBranch() {
+		return "", errors.New("HEAD is detached")
+	}
+	return head.Target().Short(), nil
+}
+
+// runGoGit runs the clone, fetch or push in args with go-git, authenticating
+// SSH remotes with g.Identity. The -c options mgit puts in front of args are
+// for the git binary and are dropped; callers warn about them.
+func (g *GitOps) runGoGit(ctx context.Context, args []string) error {
+	for len(args) > 1 && args[0] == "-c" {
+		args = args[2:]
+	}
+	if len(args) == 0 {
+		return errors.New("no git command")
+	}
+	if g.Shell.Verbose {
+		fmt.Fprintf(g.Shell.Log, "go-git: %s\n", strings.Join(args, " "))
+	}
+	done := trace.Start("gogit", "args", args, "dir", g.Shell.Dir)
+	var err error
+	switch args[0] {
+	case "clone":
+		err = g.goGitClone(ctx, args[1:])
+	case "fetch":
+		err = g.goGitFetch(ctx, args[1:])
+	case "push":
+		err = g.goGitPush(ctx, args[1:])
+	default:
+		err = fmt.Errorf("git %s needs the git binary: the go-git backend runs only clone, fetch and push", args[0])
+	}
+	if err != nil {
+		done("error", err.Error())
+		return err
+	}
+	done()
+	return nil
+}
+
+// goGitFlags splits args into the flags named in spec and positional
+// arguments. spec maps each flag, long and short spelling, to whether it
+// takes a value.
+func goGitFlags(command string, args []string, spec map[string]bool) (map[string]string, []string, error) {
+	flags := map[string]string{}
+	var positional []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			positional = append(positional, args[i+1:]...)
+			break
+		}
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			positional = append(positional, arg)
+			continue
+		}
+		name, value, hasValue := strings.Cut(arg, "=")
+		takesValue, ok := spec[name]
+		if !ok {
+			return nil, nil, fmt.Errorf("git %s %s needs the git binary: the go-git backend does not support it", command, name)
+		}
+		if takesValue && !hasValue {
+			if i+1 >= len(args) {
+				return nil, nil, fmt.Errorf("%s requires a value", name)
+			}
+			i++
+			value = args[i]
+		}
+		flags[name] = value
+	}
+	return flags, positional, nil
+}
+
+func flagValue(flags map[string]string, names ...string) (string, bool) {
+	for _, n := range names {
+		if v, ok := flags[n]; ok {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+func (g *GitOps) progress(flags map[string]string) io.Writer {
+	if _, quiet := flagValue(flags, "-q", "--quiet"); quiet {
+		return nil
+	}
+	return g.Shell.Stderr
+}
+
+func (g *GitOps) goGitClone(ctx context.Context, args []string) error {
+	flags, positional, err := goGitFlags("clone", args, map[string]bool{
+		"-b": true, "--branch": true, "--depth": true, "-o": true, "--origin": true,
+		"--single-branch": false, "-n": false, "--no-checkout": false, "--bare": false,
+		"--recurse-submodules": false, "-q": false, "--quiet": false, "--progress": false,
+	})
+	if err != nil {
+		return err
+	}
+	if len(positional) == 0 || len(positional) > 2 {
+		return errors.New("usage: git clone <url> [<directory>]")
+	}
+	url := positional[0]
+	dir := humanishDir(url)
+	if len(positional) == 2 {
+		dir = positional[1]
+	}
+	if !filepath.IsAbs(dir) && g.Shell.Dir != "" {
+		dir = filepath.Join(g.Shell.Dir, dir)
+	}
+	auth, err := g.Identity.auth(url)
+	if err != nil {
+		return err
+	}
+	opts := &gogit.CloneOptions{URL: url, Auth: auth, Progress: g.progress(flags)}
+	if b, ok := flagValue(flags, "-b", "--branch"); ok {
+		opts.ReferenceName = plumbing.NewBranchReferenceName(b)
+	}
+	if o, ok := flagValue(flags, "-o", "--origin"); ok {
+		opts.RemoteName = o
+	}
+	if d, ok := flags["--depth"]; ok {
+		if opts.Depth, err = strconv.Atoi(d); err != nil || opts.Depth < 1 {
+			return fmt.Errorf("--depth: expected a positive number, got %q", d)
+		}
+	}
+	_, opts.SingleBranch = flags["--single-branch"]
+	_, opts.NoCheckout = flagValue(flags, "-n", "--no-checkout")
+	if _, ok := flags["--recurse-submodules"]; ok {
+		opts.RecurseSubmodules = gogit.DefaultSubmoduleRecursionDepth
+	}
+	_, bare := flags["--bare"]
+	fmt.Fprintf(g.Shell.Stderr, "Cloning into '%s'...\n", filepath.Base(dir))
+	if _, err := gogit.PlainCloneContext(ctx, dir, bare, opts); err != nil {
+		return fmt.Errorf("clone %s: %w", url, err)
+	}
+	return nil
+}
+
+func (g *GitOps) goGitFetch(ctx context.Context, args []string) error {
+	flags, positional, err := goGitFlags("fetch", args, map[string]bool{
+		"-p": false, "--prune": false, "-t": false, "--tags": false, "-f": false, "--force": false,
+		"--depth": true, "-q": false, "--quiet": false, "--progress": false,
+	})
+	if err != nil {
+		return err
+	}
+	repo, err := g.openRepo()
+	if err != nil {
+		return err
+	}
+	remote, refspecs, err := g.remoteAndRefspecs(ctx, positional, g.GuessDefaultRemote)
+	if err != nil {
+		return err
+	}
+	url, err := g.RemoteURL(ctx, remote)
+	if err != nil {
+		return err
+	}
+	auth, err := g.Identity.auth(url)
+	if err != nil {
+		return err
+	}
+	opts := &gogit.FetchOptions{RemoteName: remote, Auth: auth, Progress: g.progress(flags)}
+	for _, r := range refspecs {
+		opts.RefSpecs = append(opts.RefSpecs, gitconfig.RefSpec(fetchRefSpec(r, remote)))
+	}
+	_, opts.Prune = flagValue(flags, "-p", "--prune")
+	_, opts.Force = flagValue(flags, "-f", "--force")
+	if _, ok := flagValue(flags, "-t", "--tags"); ok {
+		opts.Tags = gogit.AllTags
+	}
+	if d, ok := flags["--depth"]; ok {
+		if opts.Depth, err = strconv.Atoi(d); err != nil || opts.Depth < 1 {
+			return fmt.Errorf("--depth: expected a positive number, got %q", d)
+		}
+	}
+	if err := repo.FetchContext(ctx, opts); err != nil && !errors.Is(err, gogit.NoErrAlreadyUpToDate) {
+		return fmt.Errorf("fetch %s: %w", remote, err)
+	}
+	return nil
+}
+
+func (g *GitOps) goGitPush(ctx context.Context, args []string) error {
+	flags, positional, err := goGitFlags("push", args, map[string]bool{
+		"-f": false, "--force": false, "--tags": false, "-u": false, "--set-upstream": false,
+		"-q": false, "--quiet": false, "--progress": false, "--atomic": false,
+	})
+	if err != nil {
+		return err
+	}
+	repo, err := g.openRepo()
+	if err != nil {
+		return err
+	}
+	remote, refspecs, err := g.remoteAndRefspecs(ctx, positional, g.DefaultPushRemote)
+	if err != nil {
+		return err
+	}
+	if len(refspecs) == 0 {
+		// Like push.default=simple: the current branch to the same name.
+		branch, err := goGitBranch(repo)
+		if err != nil {
+			return err
+		}
+		refspecs = []string{branch}
+	}
+	specs := make([]gitconfig.RefSpec, 0, len(refspecs)+1)
+	for _, r := range refspecs {
+		specs = append(specs, gitconfig.RefSpec(pushRefSpec(r)))
+	}
+	if _, ok := flags["--tags"]; ok {
+		specs = append(specs, "refs/tags/*:refs/tags/*")
+	}
+	urls, err := g.PushURLs(ctx, remote)
+	if err != nil {
+		return err
+	}
+	_, force := flagValue(flags, "-f", "--force")
+	_, atomic := flags["--atomic"]
+	upToDate := true
+	for _, url := range urls {
+		auth, err := g.Identity.auth(url)
+		if err != nil {
+			return err
+		}
+		err = repo.PushContext(ctx, &gogit.PushOptions{
+			RemoteName: remote, RemoteURL: url, RefSpecs: specs, Auth: auth,
+			Force: force, Atomic: atomic, Progress: g.progress(flags),
+		})
+		switch {
+		case errors.Is(err, gogit.NoErrAlreadyUpToDate):
+		case err != nil:
+			return fmt.Errorf("push %s: %w", url, err)
+		default:
+			upToDate = false
+		}
+	}
+	if upToDate {
+		fmt.Fprintln(g.Shell.Stderr, "Everything up-to-date")
+	}
+	if _, ok := flagValue(flags, "-u", "--set-upstream"); ok {
+		return setUpstreams(repo, remote, specs)
+	}
+	return nil
+}
+
+// remoteAndRefspecs splits the positional arguments of fetch or push into
+// the remote, guessed when absent, and refspecs.
+func (g *GitOps) remoteAndRefspecs(ctx context.Context, positional []string, guess func(context.Context) (string, error)) (string, []string, error) {
+	if len(positional) > 0 {
+		return positional[0], positional[1:], nil
+	}
+	remote, err := guess(ctx)
+	return remote, nil, err
+}
+
+// fetchRefSpec expands a short fetch refspec such as "main" into one that
+// updates the remote-tracking branch.
+func fetchRefSpec(r, remote string) string {
+	if strings.Contains(r, ":") || strings.HasPrefix(r, "refs/") {
+		return r
+	}
+	force, name := "", r
+	if n, ok := strings.CutPrefix(r, "+"); ok {
+		force, name = "+", n
+	}
+	return force + "refs/heads/" + name + ":refs/remotes/" + remote + "/" + name
+}
+
+// pushRefSpec expands a push refspec with short names, "main" or
+// "+topic:main", into full ref names.
+func pushRefSpec(r string) string {
+	force := ""
+	if rest, ok := strings.CutPrefix(r, "+"); ok {
+		force, r = "+", rest
+	}
+	src, dst, ok := strings.Cut(r, ":")
+	if !ok {
+		dst = src
+	}
+	full := func(name string) string {
+		if name == "" || strings.HasPrefix(name, "refs/") || name == "HEAD" {
+			return name
+		}
+		return "refs/heads/" + name
+	}
+	return force + full(src) + ":" + full(dst)
+}
+
+// setUpstreams records remote as the upstream of every local branch pushed
+// by specs, as push -u does.
+func setUpstreams(repo *gogit.Repository, remote string, specs []gitconfig.RefSpec) error {
+	cfg, err := repo.Config()
+	if err != nil {
+		return fmt.Errorf("read git config: %w", err)
+	}
+	for _, s := range specs {
+		src, dst := plumbing.ReferenceName(s.Src()), s.Dst("")
+		if !src.IsBranch() || !dst.IsBranch() {
+			continue
+		}
+		cfg.Branches[src.Short()] = &gitconfig.Branch{Name: src.Short(), Remote: remote, Merge: dst}
+	}
+	if err := repo.SetConfig(cfg); err != nil {
+		return fmt.Errorf("set upstream: %w", err)
+	}
+	return nil
+}
+
+// humanishDir is the directory git clone picks for url: its last path
+// element without .git.
+func humanishDir(url string) string {
+	url = strings.TrimRight(url, "/")
+	url = strings.TrimSuffix(url, ".git")
+	if i := strings.LastIndexAny(url, "/:"); i >= 0 {
+		url = url[i+1:]
+	}
+	return url
+}
+
+// auth returns the go-git auth method for url: nil for anything but SSH,
+// and for a nil identity, in which case go-git falls back to ssh-agent.
+func (id *SSHIdentity) auth(url string) (transport.AuthMethod, error) {
+	if id == nil {
+		return nil, nil
+	}
+	ep, err := transport.NewEndpoint(url)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", url, err)
+	}
+	if ep.Protocol != "ssh" {
+		return nil, nil
+	}
+	user := ep.User
+	if user == "" {
+		user = "git"
+	}
+	var helper *gitssh.HostKeyCallbackHelper
+	var auth transport.AuthMethod
+	if id.KeyPath == "" {
+		a, err := gitssh.NewSSHAgentAuth(user)
+		if err != nil {
+			return nil, fmt.Errorf("ssh-agent: %w", err)
+		}
+		auth, helper = a, &a.HostKeyCallbackHelper
+	} else if a, err := gitssh.NewPublicKeysFromFile(user, id.KeyPath, ""); err == nil {
+		auth, helper = a, &a.HostKeyCallbackHelper
+	} else {
+		pub, pubErr := readPublicKey(id.KeyPath)
+		if pubErr != nil {
+			return nil, fmt.Errorf("load key %s: %w", id.KeyPath, err)
+		}
+		a, err := agentAuthFor(user, id.KeyPath, pub)
+		if err != nil {
+			return nil, err
+		}
+		auth, helper = a, &a.HostKeyCallbackHelper
+	}
+	callback, err := id.hostKeyCallback()
+	if err != nil {
+		return nil, err
+	}
+	if callback != nil {
+		helper.HostKeyCallback = callback
+	}
+	return auth, nil
+}
+
+// hostKeyCallback checks server host keys as StrictHostKeyChecking asks. It
+// is nil, go-git's default, without KnownHostsFiles or a setting.
+func (id *SSHIdentity) hostKeyCallback() (ssh.HostKeyCallback, error) {
+	switch {
+	case id.StrictHostKeyChecking == "no":
+		return ssh.InsecureIgnoreHostKey(), nil
+	case len(id.KnownHostsFiles) == 0:
+		return nil, nil
+	}
+	known, err := gitssh.NewKnownHostsCallback(id.KnownHostsFiles...)
+	if id.StrictHostKeyChecking != "accept-new" {
+		if err != nil {
+			return nil, fmt.Errorf("known hosts: %w", err)
+		}
+		return known, nil
+	}
+	// With no known_hosts file yet, every host is new.
+	return func(host string, remote net.Addr, key ssh.PublicKey) error {
+		if err == nil {
+			var keyErr *knownhosts.KeyError
+			if err := known(host, remote, key); err == nil || !errors.As(err, &keyErr) || len(keyErr.Want) > 0 {
+				return err
+			}
+		}
+		return appendKnownHost(id.KnownHostsFiles[0], host, key)
+	}, nil
+}
+
+// appendKnownHost records key for host, "name:port", in the known_hosts
+// file at path.
+func appendKnownHost(path, host string, key ssh.PublicKey) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("record host key of %s: %w", host, err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("record host key of %s: %w", host, err)
+	}
+	_, err = fmt.Fprintln(f, knownhosts.Line([]string{knownhosts.Normalize(host)}, key))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("record host key of %s: %w", host, err)
+	}
+	return nil
+}
+
+// readPublicKey reads the public key of keyPath: the file itself when it is
+// a .pub file, else keyPath.pub.
+func readPublicKey(keyPath string) (ssh.PublicKey, error) {
+	if !strings.HasSuffix(keyPath, ".pub") {
+		keyPath += ".pub"
+	}
+	data, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	return pub, err
+}
+
+// agentAuthFor authenticates as user with the ssh-agent identity pub only,
+// for agent rules and for key files that need a passphrase, as ssh does
+// with IdentitiesOnly.
+func agentAuthFor(user, keyPath string, pub ssh.PublicKey) (*gitssh.PublicKeysCallback, error) {
+	a, err := gitssh.NewSSHAgentAuth(user)
+	if err != nil {
+		return nil, fmt.Errorf("key %s needs ssh-agent: %w", keyPath, err)
+	}
+	signers := a.Callback
+	a.Callback = func() ([]ssh.Signer, error) {
+		all, err := signers()
+		if err != nil {
+			return nil, err
+		}
+		want := pub.Marshal()
+		for _, s := range all {
+			if bytes.Equal(s.PublicKey().Marshal(), want) {
+				return []ssh.Signer{s}, nil
+			}
+		}
+		return nil, fmt.Errorf("key %s is not loaded in ssh-agent; add it with ssh-add", keyPath)
+	}
+	return a, nil
+}
+
+// sortedRemoteNames lists the remotes of all, as `git remote` does.
+func sortedRemoteNames(all map[string]RemoteURLs) []string {
+	return slices.Sorted(maps.Keys(all))
+}
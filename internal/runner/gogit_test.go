@@ -0,0 +1,253 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+func TestRefSpecsAndCloneDir(t *testing.T) {
+	for in, want := range map[string]string{
+		"main":                      "refs/heads/main:refs/heads/main",
+		"+topic:main":               "+refs/heads/topic:refs/heads/main",
+		"HEAD:refs/heads/x":         "HEAD:refs/heads/x",
+		"refs/tags/v1:refs/tags/v1": "refs/tags/v1:refs/tags/v1",
+	} {
+		if got := pushRefSpec(in); got != want {
+			t.Errorf("pushRefSpec(%q) = %q, want %q", in, got, want)
+		}
+	}
+	if got := fetchRefSpec("+main", "origin"); got != "+refs/heads/main:refs/remotes/origin/main" {
+		t.Errorf("fetchRefSpec(+main) = %q", got)
+	}
+	for url, want := range map[string]string{
+		"git@github.com:org/app.git":   "app",
+		"https://example.com/org/app/": "app",
+		"ssh://git@host:2222/srv/repo": "repo",
+	} {
+		if got := humanishDir(url); got != want {
+			t.Errorf("humanishDir(%q) = %q, want %q", url, got, want)
+		}
+	}
+}
+
+func TestGoGitBackendClonePushFetch(t *testing.T) {
+	// go-git's file:// transport runs git-upload-pack and git-receive-pack.
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	for k, v := range map[string]string{"GIT_AUTHOR_NAME": "t", "GIT_AUTHOR_EMAIL": "t@example.com", "GIT_COMMITTER_NAME": "t", "GIT_COMMITTER_EMAIL": "t@example.com"} {
+		t.Setenv(k, v)
+	}
+	dir := t.TempDir()
+	origin, work := filepath.Join(dir, "origin.git"), filepath.Join(dir, "work")
+	git := func(args ...string) string {
+		t.Helper()
+		out, err := exec.Command("git", args...).CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	git("init", "-q", "--bare", "-b", "main", origin)
+	git("init", "-q", "-b", "main", work)
+	git("-C", work, "commit", "-q", "--allow-empty", "-m", "first")
+	git("-C", work, "push", "-q", origin, "main")
+	git("-C", work, "remote", "add", "origin", origin)
+
+	ctx := context.Background()
+	ops := func(dir string) *GitOps {
+		g := NewGitOps(&Shell{Dir: dir, Stdout: io.Discard, Stderr: io.Discard})
+		g.Backend = BackendGoGit
+		return g
+	}
+	if err := ops(dir).RunGit(ctx, []string{"clone", "file://" + origin, "copy"}, nil); err != nil {
+		t.Fatalf("go-git clone: %v", err)
+	}
+	copyDir := filepath.Join(dir, "copy")
+	if _, err := os.Stat(filepath.Join(copyDir, ".git")); err != nil {
+		t.Fatalf("clone left no repository: %v", err)
+	}
+
+	git("-C", copyDir, "commit", "-q", "--allow-empty", "-m", "second")
+	if err := ops(copyDir).RunGit(ctx, []string{"push"}, nil); err != nil {
+		t.Fatalf("go-git push: %v", err)
+	}
+	head := git("-C", copyDir, "rev-parse", "HEAD")
+	if got := git("--git-dir", origin, "rev-parse", "main"); got != head {
+		t.Fatalf("origin main = %s after push, want %s", got, head)
+	}
+
+	if err := ops(work).RunGit(ctx, []string{"fetch", "origin"}, nil); err != nil {
+		t.Fatalf("go-git fetch: %v", err)
+	}
+	if got := git("-C", work, "rev-parse", "origin/main"); got != head {
+		t.Fatalf("origin/main = %s after fetch, want %s", got, head)
+	}
+
+	if err := ops(work).RunGit(ctx, []string{"pull"}, nil); err == nil || !strings.Contains(err.Error(), "needs the git binary") {
+		t.Fatalf("go-git pull error = %v, want a pointer to the git binary", err)
+	}
+}
+
+func TestSSHIdentityAuth(t *testing.T) {
+	var none *SSHIdentity
+	if auth, err := none.auth("git@github.com:org/app.git"); auth != nil || err != nil {
+		t.Fatalf("nil identity auth = %v, %v; want go-git's default", auth, err)
+	}
+	id := &SSHIdentity{KeyPath: filepath.Join(t.TempDir(), "missing")}
+	if auth, err := id.auth("https://github.com/org/app.git"); auth != nil || err != nil {
+		t.Fatalf("HTTPS auth = %v, %v; want none", auth, err)
+	}
+	if _, err := id.auth("git@github.com:org/app.git"); err == nil || !strings.Contains(err.Error(), "load key") {
+		t.Fatalf("auth with a missing key error = %v", err)
+	}
+}
+
+func TestSSHIdentityAuthUsesAgentKey(t *testing.T) {
+	dir := t.TempDir()
+	pubPath := func(name string, pub ssh.PublicKey) string {
+		path := filepath.Join(dir, name+".pub")
+		if err := os.WriteFile(path, ssh.MarshalAuthorizedKey(pub), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	keyring := agent.NewKeyring()
+	var wantPath string
+	var want ssh.PublicKey
+	for _, name := range []string{"other", "work"} {
+		_, priv, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := keyring.Add(agent.AddedKey{PrivateKey: priv}); err != nil {
+			t.Fatal(err)
+		}
+		signer, err := ssh.NewSignerFromKey(priv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantPath, want = pubPath(name, signer.PublicKey()), signer.PublicKey()
+	}
+	_, missing, _ := ed25519.GenerateKey(nil)
+	missingSigner, _ := ssh.NewSignerFromKey(missing)
+	missingPath := pubPath("missing", missingSigner.PublicKey())
+
+	sock := filepath.Join(dir, "agent.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				agent.ServeAgent(keyring, conn)
+			}()
+		}
+	}()
+	t.Setenv("SSH_AUTH_SOCK", sock)
+
+	auth, err := (&SSHIdentity{KeyPath: wantPath}).auth("git@github.com:org/app.git")
+	if err != nil {
+		t.Fatalf("auth: %v", err)
+	}
+	cb, ok := auth.(*gitssh.PublicKeysCallback)
+	if !ok {
+		t.Fatalf("auth = %T, want ssh-agent auth", auth)
+	}
+	signers, err := cb.Callback()
+	if err != nil || len(signers) != 1 || !bytes.Equal(signers[0].PublicKey().Marshal(), want.Marshal()) {
+		t.Fatalf("agent signers = %v, %v; want only %s", signers, err, wantPath)
+	}
+
+	auth, err = (&SSHIdentity{KeyPath: missingPath}).auth("git@github.com:org/app.git")
+	if err != nil {
+		t.Fatalf("auth: %v", err)
+	}
+	if _, err := auth.(*gitssh.PublicKeysCallback).Callback(); err == nil || !strings.Contains(err.Error(), "ssh-add") {
+		t.Fatalf("key not in agent error = %v", err)
+	}
+
+	t.Setenv("SSH_AUTH_SOCK", "")
+	if _, err := (&SSHIdentity{KeyPath: wantPath}).auth("git@github.com:org/app.git"); err == nil || !strings.Contains(err.Error(), "needs ssh-agent") {
+		t.Fatalf("auth without ssh-agent error = %v", err)
+	}
+}
+
+func TestSSHIdentityHostKeyCallback(t *testing.T) {
+	dir := t.TempDir()
+	newKey := func() ssh.PublicKey {
+		pub, _, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, err := ssh.NewPublicKey(pub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+	hostKey, otherKey := newKey(), newKey()
+	addr := &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 22}
+	known := filepath.Join(dir, "ssh", "known_hosts")
+
+	if cb, err := (&SSHIdentity{}).hostKeyCallback(); cb != nil || err != nil {
+		t.Fatalf("no files: callback = %v, %v; want go-git's default", cb, err)
+	}
+	cb, err := (&SSHIdentity{StrictHostKeyChecking: "no"}).hostKeyCallback()
+	if err != nil || cb("github.com:22", addr, hostKey) != nil {
+		t.Fatalf("StrictHostKeyChecking=no refused the host: %v", err)
+	}
+
+	// accept-new records an unknown host, creating the file, and then
+	// holds it to that key.
+	cb, err = (&SSHIdentity{KnownHostsFiles: []string{known, filepath.Join(dir, "missing")}, StrictHostKeyChecking: "accept-new"}).hostKeyCallback()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cb("github.com:22", addr, hostKey); err != nil {
+		t.Fatalf("accept-new refused a new host: %v", err)
+	}
+	data, err := os.ReadFile(known)
+	if err != nil || !strings.HasPrefix(string(data), "github.com ssh-ed25519 ") {
+		t.Fatalf("known_hosts = %q, %v", data, err)
+	}
+	cb, err = (&SSHIdentity{KnownHostsFiles: []string{known}, StrictHostKeyChecking: "accept-new"}).hostKeyCallback()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cb("github.com:22", addr, hostKey); err != nil {
+		t.Fatalf("accept-new refused the recorded key: %v", err)
+	}
+	if err := cb("github.com:22", addr, otherKey); err == nil {
+		t.Fatal("accept-new took a changed host key")
+	}
+
+	cb, err = (&SSHIdentity{KnownHostsFiles: []string{known}, StrictHostKeyChecking: "yes"}).hostKeyCallback()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cb("gitlab.com:22", addr, otherKey); err == nil {
+		t.Fatal("StrictHostKeyChecking=yes took an unknown host")
+	}
+}
@@ -4,7 +4,7 @@ import (
 	"fmt"
 	"strings"
 
-	"mgit/internal/giturl"
+	"github.com/pavelBuzdanov/mgit/pkg/giturl"
 )
 
 type TargetKind string
@@ -16,12 +16,12 @@ const (
 )
 
 type GitTarget struct {
-	Kind       TargetKind `json:"kind"`
-	Command    string     `json:"command,omitempty"`
-	RemoteName string     `json:"remoteName,omitempty"`
-	URL        string     `json:"url,omitempty"`
-	Notes      string     `json:"notes,omitempty"`
-	SkipSSHSelection bool `json:"skipSshSelection,omitempty"`
+	Kind             TargetKind `json:"kind"`
+	Command          string     `json:"command,omitempty"`
+	RemoteName       string     `json:"remoteName,omitempty"`
+	URL              string     `json:"url,omitempty"`
+	Notes            string     `json:"notes,omitempty"`
+	SkipSSHSelection bool       `json:"skipSshSelection,omitempty"`
 }
 
 func InferGitTarget(args []string) (GitTarget, error) {
@@ -74,6 +74,16 @@ func InferGitTarget(args []string) (GitTarget, error) {
 	return GitTarget{Kind: TargetNone, Command: cmd}, nil
 }
 
+// CreatesSignedObjects reports whether a git subcommand may sign commits or tags.
+func CreatesSignedObjects(cmd string) bool {
+	switch cmd {
+	case "commit", "tag", "merge", "rebase", "cherry-pick", "revert", "am", "pull":
+		return true
+	default:
+		return false
+	}
+}
+
 func positionalArgs(args []string) []string {
 	out := make([]string, 0, len(args))
 	for i := 0; i < len(args); i++ {
@@ -0,0 +1,9 @@
+//go:build windows
+
+package runner
+
+import "os/exec"
+
+// killGroupOnCancel leaves cmd as is: cancelling its context kills git, and
+// the pipe to the ssh it started closes with it.
+func killGroupOnCancel(cmd *exec.Cmd) {}
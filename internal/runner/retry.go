@@ -0,0 +1,109 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"time"
+)
+
+// transientErrors are git and ssh messages for network failures that often
+// go away on a second attempt. Authentication and missing-repository errors
+// are deliberately absent: retrying them only delays the failure.
+var transientErrors = []string{
+	"connection reset",
+	"connection timed out",
+	"operation timed out",
+	"timed out waiting",
+	"early eof",
+	"unexpected disconnect",
+	"the remote end hung up unexpectedly",
+	"kex_exchange_identification",
+	"connection closed by remote host",
+	"temporary failure in name resolution",
+	"curl 18",
+	"curl 56",
+	"http/2 stream",
+	"gnutls recv error",
+	"ssl_read",
+}
+
+// RetryableCommand reports whether a failure of the git subcommand may be
+// retried: it only talks to the network and is safe to repeat.
+func RetryableCommand(cmd string) bool {
+	switch cmd {
+	case "fetch", "pull", "push", "ls-remote":
+		return true
+	}
+	return false
+}
+
+// TransientFailure returns the first line of git's stderr that shows a
+// network failure worth retrying.
+func TransientFailure(stderr string) (string, bool) {
+	for _, line := range strings.Split(stderr, "\n") {
+		lower := strings.ToLower(line)
+		for _, pattern := range transientErrors {
+			if strings.Contains(lower, pattern) {
+				return strings.TrimSpace(line), true
+			}
+		}
+	}
+	return "", false
+}
+
+// Backoff is the wait before retry n (1-based): 1s, 2s, 4s, ... up to 30s.
+func Backoff(n int) time.Duration {
+	d := time.Second << min(n-1, 5)
+	return min(d, 30*time.Second)
+}
+
+// RunGitRetry is RunGit that repeats a run failing with a transient network
+// error up to retries more times, waiting Backoff between attempts. notify
+// is called before each wait. git's stderr is still passed through, but
+// since it is no longer a terminal git shows no progress meter.
+func (g *GitOps) RunGitRetry(ctx context.Context, args []string, extraEnv map[string]string, retries int, notify func(attempt, attempts int, wait time.Duration, reason string)) error {
+	if retries <= 0 {
+		return g.RunGit(ctx, args, extraEnv)
+	}
+	for attempt := 1; ; attempt++ {
+		var tail tailBuffer
+		shell := *g.Shell
+		shell.Stderr = io.MultiWriter(g.Shell.Stderr, &tail)
+		attemptOps := NewGitOps(&shell)
+		attemptOps.Backend, attemptOps.Identity = g.Backend, g.Identity
+		err := attemptOps.RunGit(ctx, args, extraEnv)
+		if err == nil || attempt > retries || ctx.Err() != nil {
+			return err
+		}
+		// go-git reports network failures in the error, not on stderr.
+		reason, ok := TransientFailure(tail.String() + "\n" + err.Error())
+		if !ok {
+			return err
+		}
+		wait := Backoff(attempt)
+		notify(attempt+1, retries+1, wait, reason)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+	}
+}
+
+// tailBuffer keeps the last 8 KiB written to it.
+type tailBuffer struct {
+	buf bytes.Buffer
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	const limit = 8 << 10
+	t.buf.Write(p)
+	if extra := t.buf.Len() - limit; extra > 0 {
+		t.buf.Next(extra)
+	}
+	return len(p), nil
+}
+
+func (t *tailBuffer) String() string { return t.buf.String() }
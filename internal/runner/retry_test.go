@@ -0,0 +1,29 @@
+package runner
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTransientFailure(t *testing.T) {
+	reason, ok := TransientFailure("Cloning into 'x'...\nfetch-pack: unexpected disconnect while reading sideband packet\nfatal: early EOF\n")
+	if !ok || reason != "fetch-pack: unexpected disconnect while reading sideband packet" {
+		t.Fatalf("TransientFailure() = %q, %v", reason, ok)
+	}
+	for _, stderr := range []string{
+		"git@github.com: Permission denied (publickey).\nfatal: Could not read from remote repository.",
+		"ERROR: Repository not found.",
+	} {
+		if _, ok := TransientFailure(stderr); ok {
+			t.Errorf("TransientFailure(%q) = true", stderr)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for n, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 6: 30 * time.Second, 20: 30 * time.Second} {
+		if got := Backoff(n); got != want {
+			t.Errorf("Backoff(%d) = %s, want %s", n, got, want)
+		}
+	}
+}
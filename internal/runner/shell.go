@@ -9,6 +9,10 @@ import (
 	"os/exec"
 	"sort"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/pavelBuzdanov/mgit/pkg/trace"
 )
 
 type Shell struct {
@@ -16,43 +20,113 @@ type Shell struct {
 	Stdout  io.Writer
 	Stderr  io.Writer
 	Verbose bool
+	// Log receives the --verbose command lines; NewShell sets it to stderr.
+	Log io.Writer
 }
 
 func NewShell(stdout, stderr io.Writer, verbose bool) *Shell {
-	return &Shell{Stdout: stdout, Stderr: stderr, Verbose: verbose}
+	return &Shell{Stdout: stdout, Stderr: stderr, Verbose: verbose, Log: stderr}
 }
 
-func (s *Shell) Run(ctx context.Context, name string, args []string, extraEnv map[string]string) error {
+// SerializeOutput lets commands run from several goroutines share the
+// shell: writes to Stdout, Stderr and Log take turns under one lock.
+// Subprocesses then write through pipes, even when the writers are
+// terminals, so it suits commands whose output is captured or only read
+// on failure.
+func (s *Shell) SerializeOutput() {
+	mu := &sync.Mutex{}
+	for _, w := range []*io.Writer{&s.Stdout, &s.Stderr, &s.Log} {
+		if *w != nil {
+			*w = lockedWriter{mu: mu, w: *w}
+		}
+	}
+}
+
+type lockedWriter struct {
+	mu *sync.Mutex
+	w  io.Writer
+}
+
+func (l lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
+
+// CommandContext is exec.CommandContext for commands that must not outlive
+// a deadline on ctx (--timeout): when it expires the command is killed along
+// with its children, and Wait gives up on output pipes they still hold after
+// a few seconds. The process group is only split off without a terminal on
+// stdin, since a background group cannot prompt for passphrases or receive
+// Ctrl-C.
+func CommandContext(ctx context.Context, name string, args ...string) *exec.Cmd {
 	cmd := exec.CommandContext(ctx, name, args...)
+	if _, ok := ctx.Deadline(); ok {
+		if !stdinIsTerminal() {
+			killGroupOnCancel(cmd)
+		}
+		cmd.WaitDelay = 5 * time.Second
+	}
+	return cmd
+}
+
+// stdinIsTerminal reports whether stdin is a character device other than
+// the null device, which CI jobs commonly attach.
+func stdinIsTerminal() bool {
+	info, err := os.Stdin.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	null, err := os.Stat(os.DevNull)
+	return err != nil || !os.SameFile(info, null)
+}
+
+// runError describes a failed command, as a timeout or cancellation when
+// ctx ended first.
+func runError(ctx context.Context, name string, args []string, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		err = ctxErr
+	}
+	return fmt.Errorf("%s %s failed: %w", name, strings.Join(args, " "), err)
+}
+
+func (s *Shell) Run(ctx context.Context, name string, args []string, extraEnv map[string]string) error {
+	cmd := CommandContext(ctx, name, args...)
 	cmd.Dir = s.Dir
 	cmd.Stdout = s.Stdout
 	cmd.Stderr = s.Stderr
 	cmd.Env = mergeEnv(extraEnv)
 	if s.Verbose {
-		fmt.Fprintf(s.Stderr, "exec: %s %s\n", name, strings.Join(args, " "))
+		fmt.Fprintf(s.Log, "exec: %s %s\n", name, strings.Join(args, " "))
 		if len(extraEnv) > 0 {
-			fmt.Fprintf(s.Stderr, "env: %s\n", sortedEnvDebug(extraEnv))
+			fmt.Fprintf(s.Log, "env: %s\n", sortedEnvDebug(extraEnv))
 		}
 	}
+	done := trace.Start("exec", "cmd", name, "args", args, "dir", s.Dir, "env", sortedEnvDebug(extraEnv))
 	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("%s %s failed: %w", name, strings.Join(args, " "), err)
+		done("error", err.Error())
+		return runError(ctx, name, args, err)
 	}
+	done()
 	return nil
 }
 
 func (s *Shell) Output(ctx context.Context, name string, args []string, extraEnv map[string]string) (string, error) {
-	cmd := exec.CommandContext(ctx, name, args...)
+	cmd := CommandContext(ctx, name, args...)
 	cmd.Dir = s.Dir
 	cmd.Stderr = s.Stderr
 	cmd.Env = mergeEnv(extraEnv)
 	var out bytes.Buffer
 	cmd.Stdout = &out
 	if s.Verbose {
-		fmt.Fprintf(s.Stderr, "exec(out): %s %s\n", name, strings.Join(args, " "))
+		fmt.Fprintf(s.Log, "exec(out): %s %s\n", name, strings.Join(args, " "))
 	}
+	done := trace.Start("exec.output", "cmd", name, "args", args, "dir", s.Dir, "env", sortedEnvDebug(extraEnv))
 	if err := cmd.Run(); err != nil {
-		return "", fmt.Errorf("%s %s failed: %w", name, strings.Join(args, " "), err)
+		done("error", err.Error())
+		return "", runError(ctx, name, args, err)
 	}
+	done()
 	return strings.TrimSpace(out.String()), nil
 }
 
@@ -92,10 +166,64 @@ func sortedEnvDebug(extra map[string]string) string {
 	return strings.Join(parts, " ")
 }
 
-func BuildGITSSHCommand(keyPath string) string {
-	// GIT_SSH_COMMAND is interpreted by a shell, so single-quote escaping is required.
+// SSHArgs returns the ssh arguments that pin a connection to keyPath.
+// Each option is a "Name=value" pair passed with -o.
+func SSHArgs(keyPath string, options ...string) []string {
 	// Use -F /dev/null to ignore user-level ~/.ssh/config overrides (Host github.com, IdentityFile, etc.).
-	return "ssh -F /dev/null -i " + shellQuote(keyPath) + " -o IdentitiesOnly=yes"
+	args := []string{"-F", "/dev/null", "-i", keyPath, "-o", "IdentitiesOnly=yes"}
+	for _, o := range options {
+		args = append(args, "-o", o)
+	}
+	return args
+}
+
+func BuildGITSSHCommand(keyPath string, options ...string) string {
+	// GIT_SSH_COMMAND is interpreted by a shell, so single-quote escaping is required.
+	return SSHClient(nil).Command(keyPath, options...)
+}
+
+// ReproCommand is a POSIX shell command line that runs git with gitArgs and
+// the env assignments in env, in dir when it is set: what mgit runs, for
+// pasting into a shell without mgit.
+func ReproCommand(dir string, env map[string]string, gitArgs []string) string {
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys)+len(gitArgs)+3)
+	for _, k := range keys {
+		parts = append(parts, k+"="+reproValue(env[k]))
+	}
+	parts = append(parts, "git")
+	if dir != "" {
+		parts = append(parts, "-C", ShellArg(dir))
+	}
+	for _, a := range gitArgs {
+		parts = append(parts, ShellArg(a))
+	}
+	return strings.Join(parts, " ")
+}
+
+// reproValue quotes an env value for ReproCommand. GIT_SSH_COMMAND already
+// holds single-quoted paths, which read better inside double quotes.
+func reproValue(s string) string {
+	if strings.Contains(s, "'") && !strings.ContainsAny(s, "\"$`\\!\n") {
+		return `"` + s + `"`
+	}
+	return ShellArg(s)
+}
+
+// ShellArg quotes s for a POSIX shell when it contains special characters.
+func ShellArg(s string) string {
+	return quoteIfNeeded(s)
+}
+
+func quoteIfNeeded(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\n'\"\\$`!*?[]{}()<>|&;#~") {
+		return s
+	}
+	return shellQuote(s)
 }
 
 func shellQuote(s string) string {
@@ -0,0 +1,82 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunKillsProcessGroupOnTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("process groups are unix-only")
+	}
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not found")
+	}
+	if stdinIsTerminal() {
+		t.Skip("the process group is only split off without a terminal")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	// The background sleep keeps stdout open after sh is killed, as ssh does
+	// for git; only killing the group ends the run promptly.
+	err := NewShell(io.Discard, io.Discard, false).Run(ctx, "sh", []string{"-c", "sleep 30 & sleep 30"}, nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Run() error = %v, want deadline exceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 4*time.Second {
+		t.Fatalf("Run() took %s after the deadline", elapsed)
+	}
+}
+
+func TestBuildGITSSHCommandQuotesKeyPath(t *testing.T) {
+	got := BuildGITSSHCommand("/home/me/.ssh/it's key")
+	want := `ssh -F /dev/null -i '/home/me/.ssh/it'"'"'s key' -o IdentitiesOnly=yes`
+	if got != want {
+		t.Fatalf("BuildGITSSHCommand() = %q, want %q", got, want)
+	}
+}
+
+func TestBuildGITSSHCommandWithOptions(t *testing.T) {
+	got := BuildGITSSHCommand("/k", "SecurityKeyProvider=internal", "UserKnownHostsFile=/my hosts")
+	want := `ssh -F /dev/null -i '/k' -o IdentitiesOnly=yes -o SecurityKeyProvider=internal -o 'UserKnownHostsFile=/my hosts'`
+	if got != want {
+		t.Fatalf("BuildGITSSHCommand() = %q, want %q", got, want)
+	}
+}
+
+func TestReproCommandRoundTrips(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a POSIX shell")
+	}
+	bin := t.TempDir()
+	script := "#!/bin/sh\nprintf '%s\\n' \"$GIT_SSH_COMMAND\" \"$@\"\n"
+	if err := os.WriteFile(filepath.Join(bin, "git"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	env := map[string]string{"GIT_SSH_COMMAND": BuildGITSSHCommand("/home/me/.ssh/it's key")}
+	args := []string{"push", "origin", "my branch", "$HOME"}
+	repro := ReproCommand("", env, args)
+	cmd := exec.Command("/bin/sh", "-c", repro)
+	cmd.Env = append(os.Environ(), "PATH="+bin)
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("sh -c %q: %v", repro, err)
+	}
+	want := strings.Join(append([]string{env["GIT_SSH_COMMAND"]}, args...), "\n") + "\n"
+	if string(out) != want {
+		t.Fatalf("sh -c %q printed %q, want %q", repro, out, want)
+	}
+	env["GIT_SSH_COMMAND"] = BuildGITSSHCommand("/k")
+	if got, want := ReproCommand("/src/app", env, []string{"fetch"}), `GIT_SSH_COMMAND="ssh -F /dev/null -i '/k' -o IdentitiesOnly=yes" git -C /src/app fetch`; got != want {
+		t.Fatalf("ReproCommand() = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,184 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// SSHClient is the ssh program mgit runs and puts into GIT_SSH_COMMAND: an
+// executable plus fixed leading arguments, e.g. ["/usr/bin/ssh", "-4"] or
+// ["vpn-exec", "ssh"]. The zero value is plain "ssh".
+type SSHClient []string
+
+// ParseSSHClient splits a configured ssh command into words. Single and
+// double quotes group words, so Windows paths with spaces can be quoted.
+func ParseSSHClient(s string) (SSHClient, error) {
+	var words []string
+	var cur strings.Builder
+	inWord := false
+	var quote rune
+	for _, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				cur.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, cur.String())
+				cur.Reset()
+				inWord = false
+			}
+		default:
+			cur.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in ssh command %q", s)
+	}
+	if inWord {
+		words = append(words, cur.String())
+	}
+	return SSHClient(words), nil
+}
+
+// Name is the executable to run.
+func (c SSHClient) Name() string {
+	if len(c) == 0 {
+		return "ssh"
+	}
+	return c[0]
+}
+
+// Plink reports whether the client is PuTTY's plink, which takes its own
+// flags instead of OpenSSH's -F/-o.
+func (c SSHClient) Plink() bool {
+	base := strings.ToLower(filepath.Base(strings.ReplaceAll(c.Name(), `\`, "/")))
+	base = strings.TrimSuffix(base, ".exe")
+	return base == "plink" || base == "tortoiseplink"
+}
+
+// Args returns the arguments after Name that pin a connection to keyPath.
+// plink has no -o; User and Port options become its -l and -P, and the
+// others are dropped (see PlinkDropped).
+func (c SSHClient) Args(keyPath string, options ...string) []string {
+	var args []string
+	if len(c) > 1 {
+		args = append(args, c[1:]...)
+	}
+	if c.Plink() {
+		args = append(args, "-i", keyPath)
+		for _, o := range options {
+			name, value, _ := strings.Cut(o, "=")
+			switch strings.ToLower(name) {
+			case "user":
+				args = append(args, "-l", value)
+			case "port":
+				args = append(args, "-P", value)
+			}
+		}
+		return args
+	}
+	return append(args, SSHArgs(keyPath, options...)...)
+}
+
+// PlinkDropped returns the ssh -o options plink has no flag for.
+func PlinkDropped(options []string) []string {
+	var dropped []string
+	for _, o := range options {
+		name, _, _ := strings.Cut(o, "=")
+		if n := strings.ToLower(name); n != "user" && n != "port" {
+			dropped = append(dropped, o)
+		}
+	}
+	return dropped
+}
+
+// PortArgs selects a port other than 22 for the client: -p for OpenSSH, -P
+// for plink.
+func (c SSHClient) PortArgs(port string) []string {
+	if port == "" || port == "22" {
+		return nil
+	}
+	if c.Plink() {
+		return []string{"-P", port}
+	}
+	return []string{"-p", port}
+}
+
+// Verbose returns the client with ssh's debug output turned up by level:
+// -v, -vv or -vvv for OpenSSH (3 is its maximum), and -v for plink, which has
+// a single level. Level 0 returns c unchanged.
+func (c SSHClient) Verbose(level int) SSHClient {
+	if level <= 0 {
+		return c
+	}
+	flag := "-" + strings.Repeat("v", min(level, 3))
+	if c.Plink() {
+		flag = "-v"
+	}
+	return append(SSHClient{c.Name()}, append(slices.Clone(c[min(1, len(c)):]), flag)...)
+}
+
+// Version runs the client with -V and returns the first line it prints, e.g.
+// "OpenSSH_9.6p1, OpenSSL 3.0.13 30 Jan 2024". It fails when the executable
+// is not found.
+func (c SSHClient) Version(ctx context.Context) (string, error) {
+	if _, err := exec.LookPath(c.Name()); err != nil {
+		return "", fmt.Errorf("ssh client %s not found: %w", c.Name(), err)
+	}
+	args := append(slices.Clone(c[min(1, len(c)):]), "-V")
+	out, err := CommandContext(ctx, c.Name(), args...).CombinedOutput()
+	first, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+	if err != nil && first == "" {
+		return "", fmt.Errorf("%s -V: %w", c.Name(), err)
+	}
+	return strings.TrimSpace(first), nil
+}
+
+// shellPath writes a Windows path with forward slashes. Git for Windows runs
+// GIT_SSH_COMMAND through its bundled sh, and both Windows OpenSSH and plink
+// accept forward slashes, so the command survives being copied into a
+// double-quoted string or core.sshCommand, where backslashes are escapes.
+func shellPath(p string, windows bool) string {
+	if !windows {
+		return p
+	}
+	return strings.ReplaceAll(p, `\`, "/")
+}
+
+// BatchArgs disable interactive prompts.
+func (c SSHClient) BatchArgs() []string {
+	if c.Plink() {
+		return []string{"-batch"}
+	}
+	return []string{"-o", "BatchMode=yes"}
+}
+
+// Command renders the client for GIT_SSH_COMMAND, which git runs through a
+// shell. git picks its ssh variant from the first word, so plink is detected
+// there as well.
+func (c SSHClient) Command(keyPath string, options ...string) string {
+	windows := runtime.GOOS == "windows"
+	args := c.Args(keyPath, options...)
+	words := make([]string, 0, len(args)+1)
+	words = append(words, quoteIfNeeded(shellPath(c.Name(), windows)))
+	for i, a := range args {
+		if i > 0 && args[i-1] == "-i" {
+			words = append(words, shellQuote(shellPath(a, windows)))
+		} else {
+			words = append(words, quoteIfNeeded(a))
+		}
+	}
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,94 @@
+package runner
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSSHClient(t *testing.T) {
+	got, err := ParseSSHClient(`"C:\Program Files\PuTTY\plink.exe" -v`)
+	if err != nil {
+		t.Fatalf("ParseSSHClient() error = %v", err)
+	}
+	if want := (SSHClient{`C:\Program Files\PuTTY\plink.exe`, "-v"}); !reflect.DeepEqual(got, want) {
+		t.Fatalf("ParseSSHClient() = %q, want %q", got, want)
+	}
+	if !got.Plink() {
+		t.Fatalf("Plink() = false for %q", got)
+	}
+	if _, err := ParseSSHClient(`ssh 'unterminated`); err == nil {
+		t.Fatalf("ParseSSHClient() accepted an unterminated quote")
+	}
+}
+
+func TestSSHClientCommand(t *testing.T) {
+	client := SSHClient{"/usr/bin/ssh", "-4"}
+	want := `/usr/bin/ssh -4 -F /dev/null -i '/k' -o IdentitiesOnly=yes -o SecurityKeyProvider=internal`
+	if got := client.Command("/k", "SecurityKeyProvider=internal"); got != want {
+		t.Fatalf("Command() = %q, want %q", got, want)
+	}
+	plink := SSHClient{"plink.exe"}
+	if got, want := plink.Command("/k.ppk", "SecurityKeyProvider=internal"), `plink.exe -i '/k.ppk'`; got != want {
+		t.Fatalf("plink Command() = %q, want %q", got, want)
+	}
+	if got := plink.BatchArgs(); !reflect.DeepEqual(got, []string{"-batch"}) {
+		t.Fatalf("plink BatchArgs() = %q", got)
+	}
+}
+
+func TestSSHClientVerbose(t *testing.T) {
+	for _, tc := range []struct {
+		client SSHClient
+		level  int
+		want   SSHClient
+	}{
+		{nil, 0, nil},
+		{nil, 2, SSHClient{"ssh", "-vv"}},
+		{SSHClient{"/usr/bin/ssh", "-4"}, 9, SSHClient{"/usr/bin/ssh", "-4", "-vvv"}},
+		{SSHClient{"plink.exe"}, 3, SSHClient{"plink.exe", "-v"}},
+	} {
+		if got := tc.client.Verbose(tc.level); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%q.Verbose(%d) = %q, want %q", tc.client, tc.level, got, tc.want)
+		}
+	}
+	client := SSHClient{"ssh"}
+	client.Verbose(1)
+	if len(client) != 1 {
+		t.Fatalf("Verbose() modified the client: %q", client)
+	}
+}
+
+func TestSSHClientPlinkArgs(t *testing.T) {
+	plink := SSHClient{`C:\Program Files\PuTTY\plink.exe`}
+	got := plink.Args(`C:\keys\work.ppk`, "User=gerrit", "Port=29418", "ServerAliveInterval=30")
+	if want := []string{"-i", `C:\keys\work.ppk`, "-l", "gerrit", "-P", "29418"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("plink Args() = %q, want %q", got, want)
+	}
+	if got := PlinkDropped([]string{"User=gerrit", "ServerAliveInterval=30"}); !reflect.DeepEqual(got, []string{"ServerAliveInterval=30"}) {
+		t.Fatalf("PlinkDropped() = %q", got)
+	}
+	if got := plink.PortArgs("2222"); !reflect.DeepEqual(got, []string{"-P", "2222"}) {
+		t.Fatalf("plink PortArgs() = %q", got)
+	}
+	if got := SSHClient(nil).PortArgs("2222"); !reflect.DeepEqual(got, []string{"-p", "2222"}) {
+		t.Fatalf("PortArgs() = %q", got)
+	}
+	if got := SSHClient(nil).PortArgs("22"); got != nil {
+		t.Fatalf("PortArgs(22) = %q, want none", got)
+	}
+}
+
+func TestShellPathOnWindows(t *testing.T) {
+	for in, want := range map[string]string{
+		`C:\Users\Jo Doe\.ssh\id_ed25519`: "C:/Users/Jo Doe/.ssh/id_ed25519",
+		`\\server\share\key`:              "//server/share/key",
+		"/home/jo/.ssh/key":               "/home/jo/.ssh/key",
+	} {
+		if got := shellPath(in, true); got != want {
+			t.Errorf("shellPath(%q) = %q, want %q", in, got, want)
+		}
+	}
+	if got := shellPath(`a\b`, false); got != `a\b` {
+		t.Errorf("shellPath() off Windows = %q, want it unchanged", got)
+	}
+}
@@ -0,0 +1,58 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+)
+
+// sshEnv returns extraEnv for a git run, with GIT_SSH_COMMAND replaced by a
+// GIT_SSH wrapper script when git is too old to read it. The cleanup func
+// removes the script.
+func (g *GitOps) sshEnv(ctx context.Context, extraEnv map[string]string) (map[string]string, func(), error) {
+	command, ok := extraEnv["GIT_SSH_COMMAND"]
+	if !ok || g.Capabilities(ctx).SSHCommand {
+		return extraEnv, func() {}, nil
+	}
+	path, cleanup, err := WriteSSHWrapper(command)
+	if err != nil {
+		return nil, nil, err
+	}
+	env := maps.Clone(extraEnv)
+	delete(env, "GIT_SSH_COMMAND")
+	env["GIT_SSH"] = path
+	return env, cleanup, nil
+}
+
+// WriteSSHWrapper writes a script that runs command, a GIT_SSH_COMMAND
+// value, with the arguments git passes to GIT_SSH. Like GIT_SSH_COMMAND, the
+// command is interpreted by sh. Old git recognizes plink by "plink" anywhere
+// in the GIT_SSH path, so the file name keeps that hint.
+func WriteSSHWrapper(command string) (string, func(), error) {
+	pattern := "mgit-ssh-*"
+	if client, err := ParseSSHClient(command); err == nil && client.Plink() {
+		pattern = "mgit-plink-*"
+	}
+	f, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return "", nil, fmt.Errorf("create GIT_SSH wrapper: %w", err)
+	}
+	path := f.Name()
+	cleanup := func() { _ = os.Remove(path) }
+	script := "#!/bin/sh\n# Written by mgit for a git without GIT_SSH_COMMAND support.\nexec " + command + " \"$@\"\n"
+	if _, err := f.WriteString(script); err != nil {
+		_ = f.Close()
+		cleanup()
+		return "", nil, fmt.Errorf("write GIT_SSH wrapper: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("write GIT_SSH wrapper: %w", err)
+	}
+	if err := os.Chmod(path, 0o700); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("chmod GIT_SSH wrapper: %w", err)
+	}
+	return path, cleanup, nil
+}
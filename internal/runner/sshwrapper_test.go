@@ -0,0 +1,30 @@
+package runner
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestWriteSSHWrapperPassesArguments(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("wrapper is a sh script")
+	}
+	path, cleanup, err := WriteSSHWrapper("echo -F /dev/null -i '/tmp/my key'")
+	if err != nil {
+		t.Fatalf("WriteSSHWrapper: %v", err)
+	}
+	out, err := exec.Command(path, "-p", "22", "git@example.com", "git-upload-pack 'a/b.git'").Output()
+	if err != nil {
+		t.Fatalf("run wrapper: %v", err)
+	}
+	if got, want := strings.TrimSpace(string(out)), "-F /dev/null -i /tmp/my key -p 22 git@example.com git-upload-pack 'a/b.git'"; got != want {
+		t.Errorf("wrapper ran %q, want %q", got, want)
+	}
+	cleanup()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("cleanup left %s: %v", path, err)
+	}
+}
@@ -0,0 +1,97 @@
+package shim
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// DispatcherMarker identifies ssh dispatchers written by mgit.
+const DispatcherMarker = "# installed by mgit: ssh dispatcher"
+
+// DispatchBypassEnv, when non-empty, makes the dispatcher run ssh directly.
+const DispatchBypassEnv = "MGIT_DISPATCH_BYPASS"
+
+// DefaultDispatcherDir is where `mgit install-dispatcher` puts the
+// dispatcher unless told otherwise. It is not meant to be on PATH.
+func DefaultDispatcherDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("determine user config dir: %w", err)
+	}
+	return filepath.Join(dir, "mgit", "dispatcher"), nil
+}
+
+// DispatcherScript returns an ssh stand-in for core.sshCommand or GIT_SSH.
+// It is called "ssh" so git passes it OpenSSH options (-p, -o SendEnv), finds
+// the destination and the remote command (git-upload-pack 'owner/repo')
+// among its arguments, and asks mgit for the ssh command that selects the
+// key. When mgit has none it runs the real ssh unchanged.
+func DispatcherScript(sshPath, mgitPath string) string {
+	return fmt.Sprintf(`#!/bin/sh
+%s for git (remove with: mgit install-dispatcher --uninstall)
+real_ssh=%s
+mgit=%s
+if [ -n "$%s" ] || [ ! -x "$mgit" ]; then
+	exec "$real_ssh" "$@"
+fi
+target= port= command= next=
+for arg in "$@"; do
+	case "$next" in
+	port) port=$arg; next=; continue ;;
+	skip) next=; continue ;;
+	esac
+	case "$arg" in
+	-p) next=port ;;
+	-[BbcDEeFIiJLlmOoQRSWw]) next=skip ;;
+	-*) ;;
+	*) if [ -z "$target" ]; then target=$arg; else command=$arg; fi ;;
+	esac
+done
+if [ -n "$target" ] && cmd=$("$mgit" resolve --target "$target" ${port:+--port "$port"} ${command:+--command "$command"} --ssh-command 2>/dev/null); then
+	eval "exec $cmd \"\$@\""
+fi
+exec "$real_ssh" "$@"
+`, DispatcherMarker, shellQuote(sshPath), shellQuote(mgitPath), DispatchBypassEnv)
+}
+
+// IsDispatcher reports whether path is a dispatcher written by mgit.
+func IsDispatcher(path string) bool {
+	data, err := os.ReadFile(path)
+	return err == nil && bytes.Contains(data, []byte(DispatcherMarker))
+}
+
+// InstallDispatcher writes the dispatcher into dir as "ssh" and returns its
+// path. An existing file there is only replaced when it is a dispatcher.
+func InstallDispatcher(dir, sshPath, mgitPath string) (path string, updated bool, err error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", false, fmt.Errorf("create dispatcher dir: %w", err)
+	}
+	path = filepath.Join(dir, "ssh")
+	if _, err := os.Stat(path); err == nil {
+		if !IsDispatcher(path) {
+			return path, false, fmt.Errorf("%s exists and was not written by mgit; refusing to overwrite it", path)
+		}
+		updated = true
+	}
+	if err := os.WriteFile(path, []byte(DispatcherScript(sshPath, mgitPath)), 0o755); err != nil {
+		return path, updated, fmt.Errorf("write dispatcher %s: %w", path, err)
+	}
+	return path, updated, nil
+}
+
+// UninstallDispatcher removes the dispatcher from dir; it reports false when
+// there was none.
+func UninstallDispatcher(dir string) (bool, error) {
+	path := filepath.Join(dir, "ssh")
+	if !IsDispatcher(path) {
+		return false, nil
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return false, fmt.Errorf("remove dispatcher %s: %w", path, err)
+	}
+	return true, nil
+}
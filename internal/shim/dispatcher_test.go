@@ -0,0 +1,73 @@
+package shim
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestDispatcherAsksMgitForTheSSHCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the dispatcher is a sh script")
+	}
+	bin, dir := t.TempDir(), t.TempDir()
+	realSSH, mgit := filepath.Join(bin, "ssh"), filepath.Join(bin, "mgit")
+	writeScript(t, realSSH, `echo "ssh $*"`)
+	// mgit knows a key for github.com only, and shows what it was asked.
+	writeScript(t, mgit, `echo "$*" >`+shellQuote(filepath.Join(bin, "asked"))+`
+case "$3" in
+git@github.com) echo "echo keyed -i '/keys/work key'" ;;
+*) exit 1 ;;
+esac`)
+	path, _, err := InstallDispatcher(dir, realSSH, mgit)
+	if err != nil {
+		t.Fatalf("InstallDispatcher: %v", err)
+	}
+	for _, tc := range []struct {
+		args      []string
+		env       string
+		want, ask string
+	}{
+		{[]string{"-o", "SendEnv=GIT_PROTOCOL", "git@github.com", "git-upload-pack 'CompanyOrg/app.git'"}, "",
+			"keyed -i /keys/work key -o SendEnv=GIT_PROTOCOL git@github.com git-upload-pack 'CompanyOrg/app.git'",
+			"resolve --target git@github.com --command git-upload-pack 'CompanyOrg/app.git' --ssh-command"},
+		{[]string{"-p", "2222", "git@example.org", "git-receive-pack '/x/y.git'"}, "",
+			"ssh -p 2222 git@example.org git-receive-pack '/x/y.git'",
+			"resolve --target git@example.org --port 2222 --command git-receive-pack '/x/y.git' --ssh-command"},
+		{[]string{"git@github.com", "git-upload-pack 'a/b.git'"}, DispatchBypassEnv + "=1",
+			"ssh git@github.com git-upload-pack 'a/b.git'", ""},
+	} {
+		os.Remove(filepath.Join(bin, "asked"))
+		cmd := exec.Command(path, tc.args...)
+		cmd.Env = append(os.Environ(), tc.env)
+		out, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("run dispatcher %q: %v", tc.args, err)
+		}
+		if got := strings.TrimSpace(string(out)); got != tc.want {
+			t.Errorf("dispatcher %q ran %q, want %q", tc.args, got, tc.want)
+		}
+		asked, _ := os.ReadFile(filepath.Join(bin, "asked"))
+		if got := strings.TrimSpace(string(asked)); got != tc.ask {
+			t.Errorf("dispatcher %q asked mgit %q, want %q", tc.args, got, tc.ask)
+		}
+	}
+
+	if removed, err := UninstallDispatcher(dir); err != nil || !removed {
+		t.Fatalf("UninstallDispatcher() = %v, %v", removed, err)
+	}
+}
+
+func TestInstallDispatcherRefusesForeignSSH(t *testing.T) {
+	dir := t.TempDir()
+	writeScript(t, filepath.Join(dir, "ssh"), "exit 0")
+	if _, _, err := InstallDispatcher(dir, "/usr/bin/ssh", "/usr/bin/mgit"); err == nil {
+		t.Fatal("InstallDispatcher overwrote an ssh it did not write")
+	}
+	if removed, err := UninstallDispatcher(dir); err != nil || removed {
+		t.Fatalf("UninstallDispatcher() = %v, %v", removed, err)
+	}
+}
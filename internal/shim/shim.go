@@ -0,0 +1,186 @@
+// Package shim installs a `git` executable that routes network commands
+// through mgit, so plain `git push` gets mgit's key selection.
+package shim
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Marker identifies shims written by mgit.
+const Marker = "# installed by mgit"
+
+// BypassEnv, when non-empty, makes the shim run the real git directly.
+const BypassEnv = "MGIT_SHIM_BYPASS"
+
+// activeEnv is set for mgit started by the shim, so the git that mgit runs
+// in turn goes straight to the real git instead of looping.
+const activeEnv = "MGIT_SHIM_ACTIVE"
+
+// Commands are the git subcommands the shim hands to mgit; everything else,
+// including subcommands mgit has its own meaning for (status, config,
+// remote), goes to git unchanged.
+var Commands = []string{"push", "pull", "fetch", "clone", "ls-remote"}
+
+// Status describes an installed shim.
+type Status struct {
+	Path      string `json:"path"`
+	Installed bool   `json:"installed"`
+	// OnPath: the shim's directory is on PATH; Active: its git is the first
+	// one found there.
+	OnPath bool `json:"onPath"`
+	Active bool `json:"active"`
+	// Git and Mgit are the binaries the shim runs; Stale lists the ones that
+	// no longer exist.
+	Git   string   `json:"git,omitempty"`
+	Mgit  string   `json:"mgit,omitempty"`
+	Stale []string `json:"stale,omitempty"`
+}
+
+// DefaultDir is where `mgit shim install` puts the shim unless told
+// otherwise. The user puts it first on PATH.
+func DefaultDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("determine user config dir: %w", err)
+	}
+	return filepath.Join(dir, "mgit", "shim"), nil
+}
+
+// Script returns the shim body for the given real git and mgit binaries.
+func Script(gitPath, mgitPath string) string {
+	return fmt.Sprintf(`#!/bin/sh
+%s: git shim routing %s through mgit (remove with: mgit shim uninstall)
+real_git=%s
+mgit=%s
+if [ -n "$%s" ] || [ -n "$%s" ] || [ ! -x "$mgit" ]; then
+	exec "$real_git" "$@"
+fi
+case "$1" in
+%s)
+	%s=1
+	export %s
+	exec "$mgit" "$@"
+	;;
+esac
+exec "$real_git" "$@"
+`, Marker, strings.Join(Commands, ", "), shellQuote(gitPath), shellQuote(mgitPath),
+		BypassEnv, activeEnv, strings.Join(Commands, "|"), activeEnv, activeEnv)
+}
+
+// IsShim reports whether path is a shim written by mgit.
+func IsShim(path string) bool {
+	data, err := os.ReadFile(path)
+	return err == nil && bytes.Contains(data, []byte(Marker))
+}
+
+// FindGit returns the first git on pathList (a PATH value) that is not an
+// mgit shim, for the shim to run.
+func FindGit(pathList string) (string, error) {
+	if p, err := lookPath(pathList, true); err == nil {
+		return p, nil
+	}
+	return "", errors.New("git not found in PATH (outside mgit shims)")
+}
+
+// Install writes the shim into dir as "git". An existing file there is only
+// replaced when it is an mgit shim; it reports whether one was replaced.
+func Install(dir, gitPath, mgitPath string) (updated bool, err error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return false, fmt.Errorf("create shim dir: %w", err)
+	}
+	path := filepath.Join(dir, "git")
+	if _, err := os.Stat(path); err == nil {
+		if !IsShim(path) {
+			return false, fmt.Errorf("%s exists and was not written by mgit; refusing to overwrite it", path)
+		}
+		updated = true
+	}
+	if err := os.WriteFile(path, []byte(Script(gitPath, mgitPath)), 0o755); err != nil {
+		return updated, fmt.Errorf("write shim %s: %w", path, err)
+	}
+	return updated, nil
+}
+
+// Uninstall removes the shim from dir; it reports false when there was none.
+func Uninstall(dir string) (bool, error) {
+	path := filepath.Join(dir, "git")
+	if !IsShim(path) {
+		return false, nil
+	}
+	if err := os.Remove(path); err != nil {
+		return false, fmt.Errorf("remove shim %s: %w", path, err)
+	}
+	return true, nil
+}
+
+// Inspect reports on the shim in dir, judging PATH by pathList.
+func Inspect(dir, pathList string) Status {
+	st := Status{Path: filepath.Join(dir, "git")}
+	data, err := os.ReadFile(st.Path)
+	if err != nil || !bytes.Contains(data, []byte(Marker)) {
+		return st
+	}
+	st.Installed = true
+	for _, line := range strings.Split(string(data), "\n") {
+		if v, ok := strings.CutPrefix(line, "real_git="); ok {
+			st.Git = shellUnquote(v)
+		} else if v, ok := strings.CutPrefix(line, "mgit="); ok {
+			st.Mgit = shellUnquote(v)
+		}
+	}
+	for _, p := range []string{st.Git, st.Mgit} {
+		if _, err := os.Stat(p); errors.Is(err, fs.ErrNotExist) {
+			st.Stale = append(st.Stale, p)
+		}
+	}
+	for _, d := range filepath.SplitList(pathList) {
+		if sameDir(d, dir) {
+			st.OnPath = true
+			break
+		}
+	}
+	if first, err := lookPath(pathList, false); err == nil {
+		st.Active = sameDir(filepath.Dir(first), dir)
+	}
+	return st
+}
+
+// lookPath is exec.LookPath("git") against pathList instead of $PATH,
+// optionally passing over mgit shims.
+func lookPath(pathList string, skipShims bool) (string, error) {
+	for _, dir := range filepath.SplitList(pathList) {
+		if dir == "" {
+			continue
+		}
+		p := filepath.Join(dir, "git")
+		if info, err := os.Stat(p); err == nil && !info.IsDir() && info.Mode()&0o111 != 0 && !(skipShims && IsShim(p)) {
+			return p, nil
+		}
+	}
+	return "", exec.ErrNotFound
+}
+
+func sameDir(a, b string) bool {
+	ia, errA := os.Stat(a)
+	ib, errB := os.Stat(b)
+	if errA != nil || errB != nil {
+		return filepath.Clean(a) == filepath.Clean(b)
+	}
+	return os.SameFile(ia, ib)
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func shellUnquote(s string) string {
+	s = strings.ReplaceAll(s, `'\''`, "'")
+	return strings.TrimSuffix(strings.TrimPrefix(s, "'"), "'")
+}
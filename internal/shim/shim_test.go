@@ -0,0 +1,73 @@
+package shim
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func writeScript(t *testing.T, path, body string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body+"\n"), 0o755); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+}
+
+func TestShimRoutesNetworkCommandsThroughMgit(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the shim is a sh script")
+	}
+	bin, dir := t.TempDir(), t.TempDir()
+	realGit, mgit := filepath.Join(bin, "git"), filepath.Join(bin, "mgit")
+	writeScript(t, realGit, `echo "git $*"`)
+	writeScript(t, mgit, `echo "mgit $* active=$MGIT_SHIM_ACTIVE"`)
+	if _, err := Install(dir, realGit, mgit); err != nil {
+		t.Fatalf("Install: %v", err)
+	}
+	for _, tc := range []struct {
+		args []string
+		env  string
+		want string
+	}{
+		{[]string{"push", "origin", "main"}, "", "mgit push origin main active=1"},
+		{[]string{"status"}, "", "git status"},
+		{[]string{"fetch"}, BypassEnv + "=1", "git fetch"},
+		{[]string{"fetch"}, "MGIT_SHIM_ACTIVE=1", "git fetch"},
+	} {
+		cmd := exec.Command(filepath.Join(dir, "git"), tc.args...)
+		cmd.Env = append(os.Environ(), tc.env)
+		out, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("run shim %q: %v", tc.args, err)
+		}
+		if got := strings.TrimSpace(string(out)); got != tc.want {
+			t.Errorf("shim %q (%s) ran %q, want %q", tc.args, tc.env, got, tc.want)
+		}
+	}
+
+	st := Inspect(dir, dir+string(os.PathListSeparator)+bin)
+	if !st.Installed || !st.Active || st.Git != realGit || st.Mgit != mgit || len(st.Stale) != 0 {
+		t.Errorf("Inspect() = %+v", st)
+	}
+	if got, err := FindGit(dir + string(os.PathListSeparator) + bin); err != nil || got != realGit {
+		t.Errorf("FindGit() = %q, %v; want the real git past the shim", got, err)
+	}
+}
+
+func TestInstallRefusesForeignGitAndUninstallLeavesIt(t *testing.T) {
+	dir := t.TempDir()
+	foreign := filepath.Join(dir, "git")
+	writeScript(t, foreign, "exit 0")
+	if _, err := Install(dir, "/usr/bin/git", "/usr/bin/mgit"); err == nil {
+		t.Fatal("Install overwrote a git it did not write")
+	}
+	if removed, err := Uninstall(dir); err != nil || removed {
+		t.Fatalf("Uninstall() = %v, %v", removed, err)
+	}
+	if _, err := os.Stat(foreign); err != nil {
+		t.Fatalf("foreign git removed: %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package signature
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// A minisign public key is "Ed", an 8-byte key ID and the Ed25519 key; a
+// signature is the algorithm, "Ed" for the file itself or "ED" for its
+// BLAKE2b-512 hash, the key ID and the Ed25519 signature.
+const (
+	minisignKeyLen = 2 + 8 + ed25519.PublicKeySize
+	minisignSigLen = 2 + 8 + ed25519.SignatureSize
+)
+
+type minisignKey struct {
+	id  []byte
+	key ed25519.PublicKey
+}
+
+func parseMinisignKey(s string) (minisignKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || len(raw) != minisignKeyLen || string(raw[:2]) != "Ed" {
+		return minisignKey{}, errors.New("invalid minisign public key")
+	}
+	return minisignKey{id: raw[2:10], key: ed25519.PublicKey(raw[10:])}, nil
+}
+
+// verifyMinisign checks a .minisig file: the signature of data and the
+// global signature over it and its trusted comment.
+func verifyMinisign(keys []string, data, sig []byte) error {
+	lines := strings.Split(strings.TrimRight(string(sig), "\r\n"), "\n")
+	if len(lines) < 4 || !strings.HasPrefix(lines[2], "trusted comment: ") {
+		return errors.New("malformed signature file")
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[1]))
+	if err != nil || len(raw) != minisignSigLen {
+		return errors.New("malformed signature")
+	}
+	global, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[3]))
+	if err != nil || len(global) != ed25519.SignatureSize {
+		return errors.New("malformed global signature")
+	}
+	alg, id, signature := string(raw[:2]), raw[2:10], raw[10:]
+	msg := data
+	switch alg {
+	case "Ed":
+	case "ED":
+		sum := blake2b.Sum512(data)
+		msg = sum[:]
+	default:
+		return errors.New("unsupported signature algorithm " + alg)
+	}
+	trusted := strings.TrimSuffix(strings.TrimPrefix(lines[2], "trusted comment: "), "\r")
+	for _, s := range keys {
+		k, err := parseMinisignKey(s)
+		if err != nil || !bytes.Equal(k.id, id) {
+			continue
+		}
+		if !ed25519.Verify(k.key, msg, signature) {
+			return errors.New("signature does not verify")
+		}
+		if !ed25519.Verify(k.key, append(append([]byte{}, signature...), trusted...), global) {
+			return errors.New("trusted comment does not verify")
+		}
+		return nil
+	}
+	return errors.New("signed by a key that is not trusted")
+}
@@ -0,0 +1,95 @@
+// Package signature verifies detached signatures of shared config files and
+// rule sets against trusted public keys: SSH signatures made with
+// "ssh-keygen -Y sign -n mgit" and minisign signatures.
+package signature
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Namespace is the ssh-keygen -Y namespace mgit signatures are made in, so
+// a signature made for another purpose with the same key is not accepted.
+const Namespace = "mgit"
+
+// ErrNoSignature is returned when there is no signature of a kind any
+// trusted key could verify.
+var ErrNoSignature = errors.New("not signed")
+
+// Keys are the trusted public keys signatures are verified against.
+type Keys struct {
+	// SSH are public keys in authorized_keys format.
+	SSH []string
+	// Minisign are minisign public keys, the base64 line of a .pub file.
+	Minisign []string
+}
+
+// Empty reports whether there are no trusted keys.
+func (k Keys) Empty() bool {
+	return len(k.SSH) == 0 && len(k.Minisign) == 0
+}
+
+// ParseKeys reads trusted keys, one per line: SSH public keys as in
+// authorized_keys and minisign public keys. Blank lines, # comments and the
+// "untrusted comment:" lines of minisign .pub files are skipped, so either
+// kind of .pub file can be pasted as is.
+func ParseKeys(text string) (Keys, error) {
+	var k Keys
+	for n, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "", strings.HasPrefix(line, "#"), strings.HasPrefix(line, "untrusted comment:"):
+		case strings.HasPrefix(line, "ssh-"), strings.HasPrefix(line, "ecdsa-"), strings.HasPrefix(line, "sk-"):
+			k.SSH = append(k.SSH, line)
+		default:
+			if _, err := parseMinisignKey(line); err != nil {
+				return Keys{}, fmt.Errorf("line %d: not an SSH or minisign public key", n+1)
+			}
+			k.Minisign = append(k.Minisign, line)
+		}
+	}
+	return k, nil
+}
+
+// LoadKeys reads the trusted keys file at path.
+func LoadKeys(path string) (Keys, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Keys{}, err
+	}
+	k, err := ParseKeys(string(data))
+	if err != nil {
+		return Keys{}, fmt.Errorf("trusted keys %s: %w", path, err)
+	}
+	return k, nil
+}
+
+// Verify checks that sshSig or minisig, the detached signatures of data that
+// were found (nil for none), verify against one of the trusted keys. It
+// returns ErrNoSignature when neither is present for a kind of key trusted.
+func (k Keys) Verify(data, sshSig, minisig []byte) error {
+	tried := false
+	var errs []error
+	if sshSig != nil && len(k.SSH) > 0 {
+		tried = true
+		err := verifySSH(k.SSH, data, sshSig)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("SSH signature: %w", err))
+	}
+	if minisig != nil && len(k.Minisign) > 0 {
+		tried = true
+		err := verifyMinisign(k.Minisign, data, minisig)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("minisign signature: %w", err))
+	}
+	if !tried {
+		return ErrNoSignature
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,133 @@
+package signature
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// minisign signs data like minisign -S does, prehashed unless legacy.
+func minisign(priv ed25519.PrivateKey, id []byte, data []byte, legacy bool) []byte {
+	alg, msg := "ED", data
+	if legacy {
+		alg = "Ed"
+	} else {
+		sum := blake2b.Sum512(data)
+		msg = sum[:]
+	}
+	sig := ed25519.Sign(priv, msg)
+	trusted := "timestamp:1700000000\tfile:config.json"
+	global := ed25519.Sign(priv, append(append([]byte{}, sig...), trusted...))
+	raw := append(append([]byte(alg), id...), sig...)
+	return []byte("untrusted comment: signature from minisign secret key\n" +
+		base64.StdEncoding.EncodeToString(raw) + "\ntrusted comment: " + trusted + "\n" +
+		base64.StdEncoding.EncodeToString(global) + "\n")
+}
+
+func minisignPub(pub ed25519.PublicKey, id []byte) string {
+	return base64.StdEncoding.EncodeToString(append(append([]byte("Ed"), id...), pub...))
+}
+
+func TestVerifyMinisign(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	_, otherPriv, _ := ed25519.GenerateKey(nil)
+	id := []byte("12345678")
+	keys, err := ParseKeys("# team key\nuntrusted comment: minisign public key 3837363534333231\n" + minisignPub(pub, id) + "\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte(`{"version":1,"rules":[]}`)
+
+	for _, legacy := range []bool{false, true} {
+		if err := keys.Verify(data, nil, minisign(priv, id, data, legacy)); err != nil {
+			t.Errorf("legacy=%v: %v", legacy, err)
+		}
+	}
+	if err := keys.Verify([]byte(`{"version":1,"rules":[{}]}`), nil, minisign(priv, id, data, false)); err == nil {
+		t.Error("modified data verified")
+	}
+	if err := keys.Verify(data, nil, minisign(otherPriv, []byte("87654321"), data, false)); err == nil || !strings.Contains(err.Error(), "not trusted") {
+		t.Errorf("untrusted key: %v", err)
+	}
+	// A key ID collision does not help a forger.
+	if err := keys.Verify(data, nil, minisign(otherPriv, id, data, false)); err == nil {
+		t.Error("signature of another key with the same ID verified")
+	}
+	tampered := strings.Replace(string(minisign(priv, id, data, false)), "file:config.json", "file:evil.json", 1)
+	if err := keys.Verify(data, nil, []byte(tampered)); err == nil {
+		t.Error("tampered trusted comment verified")
+	}
+	if err := keys.Verify(data, nil, nil); !errors.Is(err, ErrNoSignature) {
+		t.Errorf("no signature: %v", err)
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	k, err := ParseKeys("ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIE alice\n\necdsa-sha2-nistp256 AAAA bob\n")
+	if err != nil || len(k.SSH) != 2 || len(k.Minisign) != 0 {
+		t.Fatalf("ParseKeys = %+v, %v", k, err)
+	}
+	if _, err := ParseKeys("not a key\n"); err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Errorf("ParseKeys(garbage) err = %v", err)
+	}
+	if k, _ := ParseKeys("# only comments\n"); !k.Empty() {
+		t.Errorf("Empty() = false for %+v", k)
+	}
+}
+
+func TestVerifySSH(t *testing.T) {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen not found")
+	}
+	dir := t.TempDir()
+	key := filepath.Join(dir, "id_ed25519")
+	if out, err := exec.Command("ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-C", "signer", "-f", key).CombinedOutput(); err != nil {
+		t.Fatalf("ssh-keygen: %v: %s", err, out)
+	}
+	file := filepath.Join(dir, "config.json")
+	data := []byte(`{"version":1,"rules":[]}`)
+	if err := os.WriteFile(file, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	sign := func(namespace string) []byte {
+		t.Helper()
+		_ = os.Remove(file + ".sig")
+		if out, err := exec.Command("ssh-keygen", "-Y", "sign", "-f", key, "-n", namespace, file).CombinedOutput(); err != nil {
+			t.Fatalf("ssh-keygen -Y sign: %v: %s", err, out)
+		}
+		sig, err := os.ReadFile(file + ".sig")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sig
+	}
+	pub, err := os.ReadFile(key + ".pub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := ParseKeys(string(pub))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sig := sign(Namespace)
+	if err := keys.Verify(data, sig, nil); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+	if err := keys.Verify(append(data, ' '), sig, nil); err == nil {
+		t.Error("modified data verified")
+	}
+	if err := keys.Verify(data, sign("file"), nil); err == nil {
+		t.Error("signature in another namespace verified")
+	}
+	if err := (Keys{Minisign: []string{"x"}}).Verify(data, sig, nil); !errors.Is(err, ErrNoSignature) {
+		t.Errorf("SSH signature without trusted SSH keys: %v", err)
+	}
+}
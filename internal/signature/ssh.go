@@ -0,0 +1,47 @@
+package signature
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// verifySSH runs ssh-keygen -Y verify with the trusted keys as allowed
+// signers. ssh-keygen wants files, so they go to a private temporary
+// directory.
+func verifySSH(keys []string, data, sig []byte) error {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		return errors.New("ssh-keygen not found on PATH")
+	}
+	dir, err := os.MkdirTemp("", "mgit-verify-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	var signers strings.Builder
+	for _, key := range keys {
+		fmt.Fprintf(&signers, "%s namespaces=%q %s\n", Namespace, Namespace, key)
+	}
+	allowed := filepath.Join(dir, "allowed_signers")
+	sigFile := filepath.Join(dir, "data.sig")
+	if err := os.WriteFile(allowed, []byte(signers.String()), 0o600); err != nil {
+		return err
+	}
+	if err := os.WriteFile(sigFile, sig, 0o600); err != nil {
+		return err
+	}
+	cmd := exec.Command("ssh-keygen", "-Y", "verify", "-f", allowed, "-I", Namespace, "-n", Namespace, "-s", sigFile)
+	cmd.Stdin = bytes.NewReader(data)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return errors.New(msg)
+		}
+		return err
+	}
+	return nil
+}
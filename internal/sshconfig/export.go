@@ -0,0 +1,145 @@
+package sshconfig
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pavelBuzdanov/mgit/internal/config"
+	"github.com/pavelBuzdanov/mgit/internal/resolve"
+	"github.com/pavelBuzdanov/mgit/internal/sshkeys"
+)
+
+// generatedID matches the rule IDs mgit makes up; other IDs were chosen by
+// the user and make better alias names.
+var generatedID = regexp.MustCompile(`^r_[0-9a-f]{8}$`)
+
+// Export renders cfg's rules as ssh_config Host blocks. A rule for one owner
+// becomes an alias (e.g. github.com-work) whose remotes must use it; a rule
+// for every owner on a host becomes a block for the host itself. Rules ssh
+// has no way to express (owner patterns, remote conditions, keys fetched at
+// run time) are listed as comments.
+func Export(cfg *config.Config) string {
+	var b strings.Builder
+	var aliases, hosts, wildcards, skipped []string
+	used := map[string]bool{}
+	for _, r := range cfg.Rules {
+		if !r.HasSSH() {
+			continue
+		}
+		label := fmt.Sprintf("rule %s (%s/%s)", r.ID, r.Host, r.Owner)
+		switch {
+		case r.Remote != "":
+			skipped = append(skipped, label+": limited to remote "+r.Remote+", which ssh cannot see")
+			continue
+		case sshkeys.IsProviderRef(r.Key):
+			skipped = append(skipped, label+": key is fetched from "+r.Key+" at run time")
+			continue
+		case r.SSHCommand != "":
+			skipped = append(skipped, label+": uses its own ssh command "+r.SSHCommand)
+			continue
+		case r.Owner != "*" && (strings.ContainsAny(r.Owner, "*?[") || strings.ContainsAny(r.Host, "*?[")):
+			skipped = append(skipped, label+": ssh matches hosts only, so an owner pattern needs an alias per owner")
+			continue
+		}
+		key, err := resolve.RuleKeyPath(r)
+		if err != nil {
+			skipped = append(skipped, label+": "+err.Error())
+			continue
+		}
+		if !r.UsesAgent() {
+			key = r.Key // as written, ~ and all
+		}
+		d, _ := cfg.HostDefaultsFor(r.Host)
+		lines := []string{"  IdentityFile " + quoteArg(key), "  IdentitiesOnly yes"}
+		if d.User != "" {
+			lines = append(lines, "  User "+d.User)
+		}
+		if d.Port != 0 {
+			lines = append(lines, "  Port "+strconv.Itoa(d.Port))
+		}
+		for _, o := range append(d.Options, resolve.RuleSSHOptions(r)...) {
+			k, v, _ := strings.Cut(o, "=")
+			lines = append(lines, "  "+k+" "+v)
+		}
+		block := strings.Join(lines, "\n") + "\n"
+
+		if r.Owner == "*" {
+			header := fmt.Sprintf("# %s\nHost %s\n", label, r.Host)
+			if strings.ContainsAny(r.Host, "*?[") {
+				wildcards = append(wildcards, header+block)
+			} else {
+				hosts = append(hosts, header+block)
+			}
+			continue
+		}
+		alias := uniqueAlias(r, used)
+		hostName := "  HostName " + r.Host + "\n"
+		if hasOption(d.Options, "HostName") {
+			hostName = ""
+		}
+		owner := r.Owner
+		aliases = append(aliases, fmt.Sprintf("# %s\n# clone with git@%s:%s/<repo>.git, or rewrite the usual URLs:\n#   git config --global url.\"git@%s:%s/\".insteadOf \"git@%s:%s/\"\nHost %s\n%s%s",
+			label, alias, owner, alias, owner, r.Host, owner, alias, hostName, block))
+	}
+
+	b.WriteString("# Generated by mgit export ssh-config. Add to ~/.ssh/config, or save it\n")
+	b.WriteString("# to a file and add \"Include <file>\" at the top of ~/.ssh/config.\n")
+	// ssh uses the first value it finds, so specific blocks go first.
+	for _, block := range append(append(aliases, hosts...), wildcards...) {
+		b.WriteString("\n" + block)
+	}
+	if len(skipped) > 0 {
+		b.WriteString("\n# Not exported:\n")
+		for _, s := range skipped {
+			b.WriteString("#   " + s + "\n")
+		}
+	}
+	return b.String()
+}
+
+// uniqueAlias names the Host alias for a rule: host-<id> for IDs chosen by
+// the user, host-<owner> otherwise.
+func uniqueAlias(r config.Rule, used map[string]bool) string {
+	name := r.Owner
+	if r.ID != "" && !generatedID.MatchString(r.ID) {
+		name = r.ID
+	}
+	base := strings.ToLower(r.Host) + "-" + slug(name)
+	alias := base
+	for n := 2; used[alias]; n++ {
+		alias = base + "-" + strconv.Itoa(n)
+	}
+	used[alias] = true
+	return alias
+}
+
+func slug(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '.' || r == '_' {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('-')
+		}
+	}
+	return strings.Trim(b.String(), "-")
+}
+
+func hasOption(options []string, name string) bool {
+	for _, o := range options {
+		if k, _, _ := strings.Cut(o, "="); strings.EqualFold(k, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// quoteArg double-quotes a path with spaces, the only quoting ssh_config has.
+func quoteArg(s string) string {
+	if strings.ContainsAny(s, " \t") {
+		return `"` + s + `"`
+	}
+	return s
+}
@@ -0,0 +1,39 @@
+package sshconfig
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pavelBuzdanov/mgit/internal/config"
+)
+
+func TestExport(t *testing.T) {
+	cfg := &config.Config{
+		Rules: []config.Rule{
+			{ID: "r_0123abcd", Host: "github.com", Owner: "CompanyOrg", Key: "~/.ssh/id_work"},
+			{ID: "personal", Host: "github.com", Owner: "me", Key: "~/.ssh/id_me"},
+			{ID: "r_11112222", Host: "*.corp.example", Owner: "*", Key: "~/.ssh/id_corp"},
+			{ID: "r_33334444", Host: "gitlab.corp.example", Owner: "*", Key: "~/.ssh/my key"},
+			{ID: "r_55556666", Host: "github.com", Owner: "Team*", Key: "~/.ssh/id_team"},
+			{ID: "r_77778888", Host: "github.com", Owner: "x", Remote: "upstream", Key: "~/.ssh/id_up"},
+		},
+		HostDefaults: []config.HostDefault{{Host: "gitlab.corp.example", Port: 2222, Options: []string{"ServerAliveInterval=30"}}},
+	}
+	out := Export(cfg)
+	for _, want := range []string{
+		"Host github.com-companyorg\n  HostName github.com\n  IdentityFile ~/.ssh/id_work\n  IdentitiesOnly yes\n",
+		`url."git@github.com-companyorg:CompanyOrg/".insteadOf "git@github.com:CompanyOrg/"`,
+		"Host github.com-personal\n",
+		"Host gitlab.corp.example\n  IdentityFile \"~/.ssh/my key\"\n  IdentitiesOnly yes\n  Port 2222\n  ServerAliveInterval 30\n",
+		"rule r_55556666 (github.com/Team*): ssh matches hosts only",
+		"rule r_77778888 (github.com/x): limited to remote upstream",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q:\n%s", want, out)
+		}
+	}
+	// Wildcard hosts come after literal ones, since ssh takes the first value.
+	if strings.Index(out, "Host *.corp.example") < strings.Index(out, "Host gitlab.corp.example") {
+		t.Errorf("wildcard block before literal host:\n%s", out)
+	}
+}
@@ -0,0 +1,103 @@
+package sshconfig
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pavelBuzdanov/mgit/internal/config"
+)
+
+type entry struct {
+	alias, hostName, user, port, key, source string
+}
+
+// ToConfig converts the Host blocks that pin an IdentityFile into rules for
+// any owner on that host. An alias whose HostName differs is mapped to the
+// real host with hostAliases when it is the only entry for that host;
+// when several aliases share a host (one key per account, the usual reason
+// for aliases), each keeps a rule on its alias so they stay apart. Either
+// way mgit runs ssh without ~/.ssh/config, so the alias's HostName, User
+// and Port become a hostDefaults entry.
+func ToConfig(blocks []Block) config.Import {
+	var imp config.Import
+	var entries []entry
+	seen := map[string]bool{}
+	for _, b := range blocks {
+		if len(b.IdentityFiles) == 0 {
+			continue
+		}
+		where := fmt.Sprintf("Host %s (%s:%d)", strings.Join(b.Patterns, " "), b.File, b.Line)
+		literal := b.Literal()
+		if len(literal) == 0 {
+			imp.Notes = append(imp.Notes, where+": no literal host name; skipped")
+			continue
+		}
+		if len(b.IdentityFiles) > 1 {
+			imp.Notes = append(imp.Notes, fmt.Sprintf("%s: has %d IdentityFile lines; imported the first", where, len(b.IdentityFiles)))
+		}
+		for _, alias := range literal {
+			alias = strings.ToLower(alias)
+			if seen[alias] {
+				// ssh takes the first value it finds for a host.
+				imp.Notes = append(imp.Notes, fmt.Sprintf("%s: %s already configured by an earlier block; skipped", where, alias))
+				continue
+			}
+			seen[alias] = true
+			e := entry{alias: alias, user: b.User, port: b.Port, key: expandTokens(b.IdentityFiles[0], alias), source: where}
+			e.hostName = strings.ToLower(expandTokens(b.HostName, alias))
+			if e.hostName == "" {
+				e.hostName = alias
+			}
+			entries = append(entries, e)
+		}
+	}
+
+	targets := map[string]int{}
+	for _, e := range entries {
+		targets[e.hostName]++
+	}
+	for _, e := range entries {
+		d := config.HostDefault{Host: e.alias, User: e.user}
+		if e.port != "" {
+			port, err := strconv.Atoi(e.port)
+			if err != nil || port <= 0 || port > 65535 {
+				imp.Notes = append(imp.Notes, fmt.Sprintf("%s: invalid Port %q; skipped", e.source, e.port))
+			} else if port != 22 {
+				d.Port = port
+			}
+		}
+		ruleHost := e.alias
+		if e.hostName != e.alias {
+			d.Options = []string{"HostName=" + e.hostName}
+			if targets[e.hostName] == 1 {
+				if imp.HostAliases == nil {
+					imp.HostAliases = map[string]string{}
+				}
+				imp.HostAliases[e.alias] = e.hostName
+				ruleHost = e.hostName
+			}
+		}
+		if d.User != "" || d.Port != 0 || len(d.Options) > 0 {
+			imp.HostDefaults = append(imp.HostDefaults, d)
+		}
+		imp.Rules = append(imp.Rules, config.Rule{
+			Host:        ruleHost,
+			Owner:       "*",
+			Key:         e.key,
+			Description: "imported from ssh config Host " + e.alias,
+		})
+	}
+	return imp
+}
+
+// expandTokens replaces the ssh_config tokens that make sense outside a
+// connection: %h (the host), %d (the home directory) and %%.
+func expandTokens(s, host string) string {
+	s = strings.ReplaceAll(s, "%%", "\x00")
+	s = strings.ReplaceAll(s, "%h", host)
+	if strings.HasPrefix(s, "%d/") {
+		s = "~/" + s[3:]
+	}
+	return strings.ReplaceAll(s, "\x00", "%")
+}
@@ -0,0 +1,185 @@
+// Package sshconfig reads the parts of OpenSSH client config files that say
+// which key and address a host uses, for importing them as mgit rules.
+package sshconfig
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Block is one Host section. Only the first value of each keyword counts,
+// as in ssh; IdentityFile keeps all of them.
+type Block struct {
+	Patterns      []string
+	HostName      string
+	User          string
+	Port          string
+	IdentityFiles []string
+	// File and Line locate the Host line, for messages.
+	File string
+	Line int
+}
+
+// Literal returns the patterns that name a single host: no wildcards and no
+// negation.
+func (b Block) Literal() []string {
+	var out []string
+	for _, p := range b.Patterns {
+		if !strings.ContainsAny(p, "*?!") {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// Load reads the config at path, following Include directives (relative
+// paths are under ~/.ssh, globs allowed). Match sections are skipped: their
+// conditions can't be evaluated without a connection.
+func Load(path string) ([]Block, error) {
+	return load(path, 0)
+}
+
+func load(path string, depth int) ([]Block, error) {
+	if depth > 16 {
+		return nil, fmt.Errorf("%s: too many nested Include directives", path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parse(f, path, depth)
+}
+
+// Parse reads config text; Include directives are followed from disk.
+func Parse(r io.Reader, name string) ([]Block, error) {
+	return parse(r, name, 0)
+}
+
+func parse(r io.Reader, name string, depth int) ([]Block, error) {
+	var blocks []Block
+	cur := -1 // index of the section keywords apply to; -1 before any Host
+	skipping := false
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		key, args := splitLine(sc.Text())
+		if key == "" {
+			continue
+		}
+		switch key {
+		case "host":
+			blocks = append(blocks, Block{Patterns: args, File: name, Line: n})
+			cur, skipping = len(blocks)-1, false
+			continue
+		case "match":
+			cur, skipping = -1, true
+			continue
+		case "include":
+			if skipping {
+				continue
+			}
+			for _, pattern := range args {
+				included, err := include(pattern, depth)
+				if err != nil {
+					return nil, fmt.Errorf("%s:%d: %w", name, n, err)
+				}
+				// Keywords before the included file's first Host are
+				// dropped; ssh would apply them to the current section.
+				blocks = append(blocks, included...)
+			}
+			continue
+		}
+		if cur < 0 || len(args) == 0 {
+			continue
+		}
+		b := &blocks[cur]
+		switch key {
+		case "hostname":
+			setOnce(&b.HostName, args[0])
+		case "user":
+			setOnce(&b.User, args[0])
+		case "port":
+			setOnce(&b.Port, args[0])
+		case "identityfile":
+			b.IdentityFiles = append(b.IdentityFiles, args[0])
+		}
+	}
+	return blocks, sc.Err()
+}
+
+func include(pattern string, depth int) ([]Block, error) {
+	if strings.HasPrefix(pattern, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		pattern = filepath.Join(home, pattern[2:])
+	} else if !filepath.IsAbs(pattern) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		pattern = filepath.Join(home, ".ssh", pattern)
+	}
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	var blocks []Block
+	for _, p := range paths {
+		b, err := load(p, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, b...)
+	}
+	return blocks, nil
+}
+
+func setOnce(field *string, value string) {
+	if *field == "" {
+		*field = value
+	}
+}
+
+// splitLine returns the lowercased keyword and its arguments. ssh allows
+// "Key value", "Key=value" and double-quoted arguments.
+func splitLine(line string) (string, []string) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", nil
+	}
+	i := strings.IndexAny(line, " \t=")
+	if i < 0 {
+		return strings.ToLower(line), nil
+	}
+	key := strings.ToLower(line[:i])
+	rest := strings.TrimLeft(line[i:], " \t")
+	rest = strings.TrimPrefix(rest, "=")
+	var args []string
+	var word strings.Builder
+	inWord, quoted := false, false
+	for _, r := range rest {
+		switch {
+		case r == '"':
+			quoted, inWord = !quoted, true
+		case (r == ' ' || r == '\t') && !quoted:
+			if inWord {
+				args = append(args, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if inWord {
+		args = append(args, word.String())
+	}
+	return key, args
+}
@@ -0,0 +1,104 @@
+package sshconfig
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const sample = `
+Host github.com
+  IdentityFile ~/.ssh/personal
+  IdentityFile ~/.ssh/other
+
+Host github-work
+  HostName github.com
+  IdentityFile ~/.ssh/work
+
+Host gl-corp
+  HostName=gitlab.corp.example
+  Port 2222
+  User git
+  IdentityFile "%d/.ssh/corp key"
+
+Host *.internal !bad.internal
+  IdentityFile ~/.ssh/internal
+
+Match host foo
+  IdentityFile ~/.ssh/foo
+
+Host github.com
+  IdentityFile ~/.ssh/late
+`
+
+func TestParse(t *testing.T) {
+	blocks, err := Parse(strings.NewReader(sample), "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 5 {
+		t.Fatalf("blocks = %+v", blocks)
+	}
+	corp := blocks[2]
+	if corp.HostName != "gitlab.corp.example" || corp.Port != "2222" || corp.User != "git" || corp.IdentityFiles[0] != "%d/.ssh/corp key" || corp.Line != 10 {
+		t.Errorf("gl-corp block = %+v", corp)
+	}
+	if got := blocks[3].Literal(); len(got) != 0 {
+		t.Errorf("wildcard block literal = %q", got)
+	}
+}
+
+func TestLoadFollowsInclude(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	if err := os.MkdirAll(filepath.Join(dir, ".ssh", "conf.d"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ".ssh", "conf.d", "work"), []byte("Host gh-work\n  IdentityFile ~/.ssh/work\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	main := filepath.Join(dir, ".ssh", "config")
+	if err := os.WriteFile(main, []byte("Include conf.d/*\nHost gh\n  IdentityFile ~/.ssh/me\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	blocks, err := Load(main)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 2 || blocks[0].Patterns[0] != "gh-work" || blocks[1].IdentityFiles[0] != "~/.ssh/me" {
+		t.Errorf("blocks = %+v", blocks)
+	}
+}
+
+func TestToConfig(t *testing.T) {
+	blocks, err := Parse(strings.NewReader(sample), "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	imp := ToConfig(blocks)
+
+	want := map[string]string{
+		"github.com":          "~/.ssh/personal",
+		"github-work":         "~/.ssh/work", // shares github.com, so no alias
+		"gitlab.corp.example": "~/.ssh/corp key",
+	}
+	if len(imp.Rules) != len(want) {
+		t.Fatalf("rules = %+v", imp.Rules)
+	}
+	for _, r := range imp.Rules {
+		if want[r.Host] != r.Key || r.Owner != "*" {
+			t.Errorf("rule %+v, want key %q", r, want[r.Host])
+		}
+	}
+	if len(imp.HostAliases) != 1 || imp.HostAliases["gl-corp"] != "gitlab.corp.example" {
+		t.Errorf("aliases = %v", imp.HostAliases)
+	}
+	if len(imp.HostDefaults) != 2 || imp.HostDefaults[1].Port != 2222 || imp.HostDefaults[1].Options[0] != "HostName=gitlab.corp.example" {
+		t.Errorf("host defaults = %+v", imp.HostDefaults)
+	}
+	// Multiple IdentityFile lines, the wildcard block and the repeated host.
+	if len(imp.Notes) != 3 {
+		t.Errorf("notes = %q", imp.Notes)
+	}
+}
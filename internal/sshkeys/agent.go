@@ -0,0 +1,215 @@
+package sshkeys
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+type AgentIdentity struct {
+	Type        string `json:"type"`
+	Bits        int    `json:"bits,omitempty"`
+	Fingerprint string `json:"fingerprint"`
+	Comment     string `json:"comment,omitempty"`
+	PublicKey   string `json:"publicKey"`
+}
+
+// IsAgentRef reports whether ref looks like an agent key reference:
+// either a SHA256 fingerprint or an authorized_keys style public key line.
+func IsAgentRef(ref string) bool {
+	ref = strings.TrimSpace(ref)
+	if strings.HasPrefix(ref, "SHA256:") {
+		return len(ref) > len("SHA256:")
+	}
+	_, err := ParsePublicKeyLine(ref)
+	return err == nil
+}
+
+// ParsePublicKeyLine parses a single "<type> <base64> [comment]" line.
+func ParsePublicKeyLine(line string) (AgentIdentity, error) {
+	fields := strings.Fields(strings.TrimSpace(line))
+	if len(fields) < 2 {
+		return AgentIdentity{}, fmt.Errorf("invalid public key %q", line)
+	}
+	if !isKeyType(fields[0]) {
+		return AgentIdentity{}, fmt.Errorf("unsupported public key type %q", fields[0])
+	}
+	blob, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return AgentIdentity{}, fmt.Errorf("decode public key: %w", err)
+	}
+	id := AgentIdentity{
+		Type:        fields[0],
+		Bits:        keyBits(fields[0], blob),
+		Fingerprint: Fingerprint(blob),
+		PublicKey:   fields[0] + " " + fields[1],
+	}
+	if len(fields) > 2 {
+		id.Comment = strings.Join(fields[2:], " ")
+	}
+	return id, nil
+}
+
+// Fingerprint returns the OpenSSH SHA256 fingerprint of a raw public key blob.
+func Fingerprint(blob []byte) string {
+	sum := sha256.Sum256(blob)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+// DisplayType returns the short algorithm name used by ssh-keygen -l, e.g. ED25519 or ECDSA-SK.
+func DisplayType(t string) string {
+	switch {
+	case t == "ssh-rsa":
+		return "RSA"
+	case t == "ssh-dss":
+		return "DSA"
+	case t == "ssh-ed25519":
+		return "ED25519"
+	case strings.HasPrefix(t, "ecdsa-"):
+		return "ECDSA"
+	case strings.HasPrefix(t, "sk-ssh-ed25519"):
+		return "ED25519-SK"
+	case strings.HasPrefix(t, "sk-ecdsa-"):
+		return "ECDSA-SK"
+	default:
+		return strings.ToUpper(t)
+	}
+}
+
+// IsSecurityKeyType reports whether t is a FIDO2 hardware-backed key type (ed25519-sk, ecdsa-sk).
+func IsSecurityKeyType(t string) bool {
+	return strings.HasPrefix(t, "sk-")
+}
+
+// keyBits derives the key size from the SSH wire-format public key blob.
+func keyBits(t string, blob []byte) int {
+	switch {
+	case strings.Contains(t, "ed25519"):
+		return 256
+	case strings.Contains(t, "nistp256"):
+		return 256
+	case strings.Contains(t, "nistp384"):
+		return 384
+	case strings.Contains(t, "nistp521"):
+		return 521
+	case t == "ssh-rsa":
+		// string type, mpint e, mpint n
+		fields := readWireStrings(blob, 3)
+		if len(fields) < 3 {
+			return 0
+		}
+		return new(big.Int).SetBytes(fields[2]).BitLen()
+	case t == "ssh-dss":
+		// string type, mpint p, ...
+		fields := readWireStrings(blob, 2)
+		if len(fields) < 2 {
+			return 0
+		}
+		return new(big.Int).SetBytes(fields[1]).BitLen()
+	default:
+		return 0
+	}
+}
+
+func readWireStrings(blob []byte, n int) [][]byte {
+	var out [][]byte
+	for len(out) < n && len(blob) >= 4 {
+		l := int(blob[0])<<24 | int(blob[1])<<16 | int(blob[2])<<8 | int(blob[3])
+		blob = blob[4:]
+		if l < 0 || l > len(blob) {
+			break
+		}
+		out = append(out, blob[:l])
+		blob = blob[l:]
+	}
+	return out
+}
+
+func isKeyType(t string) bool {
+	return strings.HasPrefix(t, "ssh-") ||
+		strings.HasPrefix(t, "ecdsa-") ||
+		strings.HasPrefix(t, "sk-")
+}
+
+// ListAgentIdentities returns the identities loaded in the agent at SSH_AUTH_SOCK.
+func ListAgentIdentities() ([]AgentIdentity, error) {
+	if strings.TrimSpace(os.Getenv("SSH_AUTH_SOCK")) == "" {
+		return nil, errors.New("SSH_AUTH_SOCK is not set: no ssh-agent available")
+	}
+	cmd := exec.Command("ssh-add", "-L")
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if err := cmd.Run(); err != nil {
+		// ssh-add exits with 1 when the agent has no identities.
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("list ssh-agent identities: %w", err)
+	}
+	return parseAgentList(out.String()), nil
+}
+
+func parseAgentList(out string) []AgentIdentity {
+	var ids []AgentIdentity
+	for _, line := range strings.Split(out, "\n") {
+		id, err := ParsePublicKeyLine(line)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// AgentIdentityFile materializes the public key referenced by ref into a .pub
+// file under the user cache dir. Passing that file to `ssh -i` together with
+// IdentitiesOnly=yes makes ssh use the matching agent identity.
+func AgentIdentityFile(ref string) (string, error) {
+	ref = strings.TrimSpace(ref)
+	var id AgentIdentity
+	if strings.HasPrefix(ref, "SHA256:") {
+		ids, err := ListAgentIdentities()
+		if err != nil {
+			return "", err
+		}
+		found := false
+		for _, candidate := range ids {
+			if candidate.Fingerprint == ref {
+				id = candidate
+				found = true
+				break
+			}
+		}
+		if !found {
+			return "", fmt.Errorf("no ssh-agent identity with fingerprint %s (is the key loaded? check with: ssh-add -l)", ref)
+		}
+	} else {
+		parsed, err := ParsePublicKeyLine(ref)
+		if err != nil {
+			return "", err
+		}
+		id = parsed
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("determine user cache dir: %w", err)
+	}
+	dir = filepath.Join(dir, "mgit", "agent-keys")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", fmt.Errorf("create agent key cache dir: %w", err)
+	}
+	name := strings.NewReplacer("/", "_", "+", "-").Replace(strings.TrimPrefix(id.Fingerprint, "SHA256:"))
+	path := filepath.Join(dir, name+".pub")
+	if err := os.WriteFile(path, []byte(id.PublicKey+"\n"), 0o600); err != nil {
+		return "", fmt.Errorf("write agent public key %s: %w", path, err)
+	}
+	return path, nil
+}
@@ -0,0 +1,64 @@
+package sshkeys
+
+import "testing"
+
+const testPublicKey = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIOMqqnkVzrm0SdG6UOoqKLsabgH5C9okWi0dh2l9GKJl work@laptop"
+
+func TestParsePublicKeyLine(t *testing.T) {
+	id, err := ParsePublicKeyLine(testPublicKey)
+	if err != nil {
+		t.Fatalf("ParsePublicKeyLine() error = %v", err)
+	}
+	if id.Type != "ssh-ed25519" || id.Comment != "work@laptop" {
+		t.Fatalf("unexpected identity: %+v", id)
+	}
+	if len(id.Fingerprint) != len("SHA256:")+43 {
+		t.Fatalf("unexpected fingerprint: %q", id.Fingerprint)
+	}
+}
+
+func TestIsAgentRef(t *testing.T) {
+	cases := map[string]bool{
+		testPublicKey:          true,
+		"SHA256:abcdef":        true,
+		"SHA256:":              false,
+		"~/.ssh/id_ed25519":    false,
+		"ssh-ed25519 not-b64!": false,
+	}
+	for ref, want := range cases {
+		if got := IsAgentRef(ref); got != want {
+			t.Fatalf("IsAgentRef(%q) = %v, want %v", ref, got, want)
+		}
+	}
+}
+
+func TestParseAgentListSkipsNoise(t *testing.T) {
+	ids := parseAgentList("The agent has no identities.\n" + testPublicKey + "\n")
+	if len(ids) != 1 || ids[0].Comment != "work@laptop" {
+		t.Fatalf("unexpected identities: %+v", ids)
+	}
+}
+
+func TestCandidateSummary(t *testing.T) {
+	id, err := ParsePublicKeyLine(testPublicKey)
+	if err != nil {
+		t.Fatalf("ParsePublicKeyLine() error = %v", err)
+	}
+	c := Candidate{Type: id.Type, Bits: id.Bits, Fingerprint: id.Fingerprint, Comment: id.Comment}
+	want := "256 " + id.Fingerprint + " work@laptop (ED25519)"
+	if got := c.Summary(); got != want {
+		t.Fatalf("Summary() = %q, want %q", got, want)
+	}
+}
+
+func TestMergeAgentSkipsKnownFingerprints(t *testing.T) {
+	files := []Candidate{{Path: "/k/a", Source: SourceFile, Fingerprint: "SHA256:a"}}
+	agent := []Candidate{
+		{Source: SourceAgent, Fingerprint: "SHA256:a"},
+		{Source: SourceAgent, Fingerprint: "SHA256:b"},
+	}
+	got := MergeAgent(files, agent)
+	if len(got) != 2 || got[1].Fingerprint != "SHA256:b" {
+		t.Fatalf("unexpected merge result: %+v", got)
+	}
+}
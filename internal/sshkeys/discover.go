@@ -5,13 +5,51 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 )
 
+const (
+	SourceFile  = "file"
+	SourceAgent = "agent"
+)
+
 type Candidate struct {
-	Path          string `json:"path"`
+	Path          string `json:"path,omitempty"`
 	Name          string `json:"name"`
 	HasPublicPair bool   `json:"hasPublicPair"`
+	Source        string `json:"source"` // file|agent
+	Type          string `json:"type,omitempty"`
+	Bits          int    `json:"bits,omitempty"`
+	Fingerprint   string `json:"fingerprint,omitempty"`
+	Comment       string `json:"comment,omitempty"`
+	Encrypted     bool   `json:"encrypted,omitempty"`
+}
+
+func (c Candidate) IsSecurityKey() bool {
+	return IsSecurityKeyType(c.Type)
+}
+
+// Summary renders key metadata the way `ssh-keygen -l` does: "256 SHA256:... comment (ED25519)".
+func (c Candidate) Summary() string {
+	if c.Fingerprint == "" {
+		return ""
+	}
+	var parts []string
+	if c.Bits > 0 {
+		parts = append(parts, fmt.Sprintf("%d", c.Bits))
+	}
+	parts = append(parts, c.Fingerprint)
+	if c.Comment != "" {
+		parts = append(parts, c.Comment)
+	}
+	if c.Type != "" {
+		parts = append(parts, "("+DisplayType(c.Type)+")")
+	}
+	if c.Encrypted {
+		parts = append(parts, "[passphrase]")
+	}
+	return strings.Join(parts, " ")
 }
 
 func DiscoverDefault() ([]Candidate, error) {
@@ -46,16 +84,97 @@ func Discover(dir string) ([]Candidate, error) {
 		if err != nil || !info.Mode().IsRegular() {
 			continue
 		}
-		out = append(out, Candidate{
+		c := Candidate{
 			Path:          path,
 			Name:          name,
 			HasPublicPair: hasPub,
-		})
+			Source:        SourceFile,
+		}
+		if encrypted, err := IsEncrypted(path); err == nil {
+			c.Encrypted = encrypted
+		}
+		if hasPub {
+			if id, err := ReadPublicKeyFile(path + ".pub"); err == nil {
+				c.Type = id.Type
+				c.Bits = id.Bits
+				c.Fingerprint = id.Fingerprint
+				c.Comment = id.Comment
+			}
+		}
+		out = append(out, c)
 	}
 	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
 	return out, nil
 }
 
+// DiscoverAgent lists identities loaded in the ssh-agent as key candidates.
+func DiscoverAgent() ([]Candidate, error) {
+	ids, err := ListAgentIdentities()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Candidate, 0, len(ids))
+	for _, id := range ids {
+		name := id.Comment
+		if name == "" {
+			name = id.Fingerprint
+		}
+		out = append(out, Candidate{
+			Name:          name,
+			HasPublicPair: true,
+			Source:        SourceAgent,
+			Type:          id.Type,
+			Bits:          id.Bits,
+			Fingerprint:   id.Fingerprint,
+			Comment:       id.Comment,
+		})
+	}
+	return out, nil
+}
+
+// MergeAgent appends agent candidates whose fingerprint is not already
+// represented by an on-disk key.
+func MergeAgent(files, agent []Candidate) []Candidate {
+	seen := map[string]bool{}
+	for _, c := range files {
+		if c.Fingerprint != "" {
+			seen[c.Fingerprint] = true
+		}
+	}
+	out := append([]Candidate(nil), files...)
+	for _, c := range agent {
+		if seen[c.Fingerprint] {
+			continue
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// PublicKeyPath returns the .pub file that describes keyPath. Agent rules and
+// rules pointing at a public key already reference it directly.
+func PublicKeyPath(keyPath string) string {
+	if strings.HasSuffix(keyPath, ".pub") {
+		return keyPath
+	}
+	return keyPath + ".pub"
+}
+
+// ReadPublicKeyFile parses the first public key line of a .pub file.
+func ReadPublicKeyFile(path string) (AgentIdentity, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return AgentIdentity{}, fmt.Errorf("read public key %s: %w", path, err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		return ParsePublicKeyLine(line)
+	}
+	return AgentIdentity{}, fmt.Errorf("public key %s is empty", path)
+}
+
 func fileExists(path string) bool {
 	st, err := os.Stat(path)
 	return err == nil && !st.IsDir()
@@ -92,3 +211,43 @@ func isLikelyPrivateKeyName(name string) bool {
 	// Fallback heuristic: accept files with a public pair next to them.
 	return false
 }
+
+// Select picks one candidate non-interactively. selector is either a 1-based
+// index into candidates (the numbering the interactive picker shows) or a
+// glob matched against the key path, its file name, the agent comment and
+// the fingerprint. A glob must match exactly one candidate.
+func Select(candidates []Candidate, selector string) (Candidate, error) {
+	selector = strings.TrimSpace(selector)
+	if selector == "" {
+		return Candidate{}, fmt.Errorf("empty key selector")
+	}
+	if n, err := strconv.Atoi(selector); err == nil {
+		if n < 1 || n > len(candidates) {
+			return Candidate{}, fmt.Errorf("key index %d out of range (%d keys discovered)", n, len(candidates))
+		}
+		return candidates[n-1], nil
+	}
+	if _, err := filepath.Match(selector, ""); err != nil {
+		return Candidate{}, fmt.Errorf("invalid key pattern %q: %w", selector, err)
+	}
+	var matches []Candidate
+	for _, c := range candidates {
+		for _, s := range []string{c.Path, filepath.Base(c.Path), c.Name, c.Comment, c.Fingerprint} {
+			if ok, _ := filepath.Match(selector, s); ok && s != "" {
+				matches = append(matches, c)
+				break
+			}
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return Candidate{}, fmt.Errorf("no discovered key matches %q", selector)
+	case 1:
+		return matches[0], nil
+	}
+	names := make([]string, 0, len(matches))
+	for _, m := range matches {
+		names = append(names, m.Name)
+	}
+	return Candidate{}, fmt.Errorf("%q matches %d keys (%s); use a narrower pattern", selector, len(matches), strings.Join(names, ", "))
+}
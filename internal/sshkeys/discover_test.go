@@ -0,0 +1,39 @@
+package sshkeys
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSelect(t *testing.T) {
+	candidates := []Candidate{
+		{Path: "/home/me/.ssh/id_ed25519", Name: "id_ed25519", Source: SourceFile},
+		{Path: "/home/me/.ssh/work_ed25519", Name: "work_ed25519", Source: SourceFile},
+		{Name: "ci@build", Comment: "ci@build", Fingerprint: "SHA256:Zm9vYmFy", Source: SourceAgent},
+	}
+	cases := []struct {
+		selector string
+		want     string
+		err      string
+	}{
+		{selector: "2", want: "work_ed25519"},
+		{selector: "work_*", want: "work_ed25519"},
+		{selector: "/home/me/.ssh/id_*", want: "id_ed25519"},
+		{selector: "ci@*", want: "ci@build"},
+		{selector: "*_ed25519", err: "matches 2 keys"},
+		{selector: "4", err: "out of range"},
+		{selector: "nope*", err: "no discovered key"},
+	}
+	for _, c := range cases {
+		got, err := Select(candidates, c.selector)
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("Select(%q) error = %v, want %q", c.selector, err, c.err)
+			}
+			continue
+		}
+		if err != nil || got.Name != c.want {
+			t.Errorf("Select(%q) = %q, %v; want %q", c.selector, got.Name, err, c.want)
+		}
+	}
+}
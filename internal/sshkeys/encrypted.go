@@ -0,0 +1,80 @@
+package sshkeys
+
+import (
+	"bytes"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const openSSHKeyMagic = "openssh-key-v1\x00"
+
+// IsEncrypted reports whether the private key at path is protected by a passphrase.
+// It understands the OpenSSH key format, legacy PEM (Proc-Type ENCRYPTED),
+// PKCS#8 and PuTTY .ppk files. Unknown formats are reported as not encrypted.
+func IsEncrypted(path string) (bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false, fmt.Errorf("read private key %s: %w", path, err)
+	}
+	return isEncryptedKeyData(data), nil
+}
+
+func isEncryptedKeyData(data []byte) bool {
+	if bytes.HasPrefix(data, []byte("PuTTY-User-Key-File-")) {
+		for _, line := range strings.Split(string(data), "\n") {
+			if v, ok := strings.CutPrefix(strings.TrimSpace(line), "Encryption:"); ok {
+				return strings.TrimSpace(v) != "none"
+			}
+		}
+		return false
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return false
+	}
+	switch block.Type {
+	case "OPENSSH PRIVATE KEY":
+		return openSSHCipher(block.Bytes) != "none"
+	case "ENCRYPTED PRIVATE KEY":
+		return true
+	default:
+		return strings.Contains(block.Headers["Proc-Type"], "ENCRYPTED")
+	}
+}
+
+// openSSHCipher returns the cipher name from an openssh-key-v1 blob.
+func openSSHCipher(blob []byte) string {
+	if !bytes.HasPrefix(blob, []byte(openSSHKeyMagic)) {
+		return "none"
+	}
+	fields := readWireStrings(blob[len(openSSHKeyMagic):], 1)
+	if len(fields) == 0 {
+		return "none"
+	}
+	return string(fields[0])
+}
+
+// NeedsPassphrase reports whether using keyPath will make ssh prompt for a
+// passphrase: the key is encrypted and its public half is not loaded in ssh-agent.
+func NeedsPassphrase(keyPath string) bool {
+	encrypted, err := IsEncrypted(keyPath)
+	if err != nil || !encrypted {
+		return false
+	}
+	pub, err := ReadPublicKeyFile(keyPath + ".pub")
+	if err != nil {
+		return true
+	}
+	ids, err := ListAgentIdentities()
+	if err != nil {
+		return true
+	}
+	for _, id := range ids {
+		if id.Fingerprint == pub.Fingerprint {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,122 @@
+package sshkeys
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type GenerateOptions struct {
+	Type         string
+	Path         string
+	Comment      string
+	NoPassphrase bool
+	// SecurityKeyProvider is the FIDO middleware passed to ssh-keygen -w for sk types.
+	SecurityKeyProvider string
+}
+
+// SupportedKeyTypes lists the --type values accepted by key generation.
+var SupportedKeyTypes = []string{"ed25519", "ecdsa", "rsa", "ed25519-sk", "ecdsa-sk"}
+
+// DefaultKeyName builds a key file name such as id_ed25519_github_com_CompanyOrg.
+func DefaultKeyName(keyType, host, owner string) string {
+	parts := []string{"id", strings.ReplaceAll(keyType, "-", "_")}
+	for _, s := range []string{host, owner} {
+		s = sanitizeNamePart(s)
+		if s != "" {
+			parts = append(parts, s)
+		}
+	}
+	return strings.Join(parts, "_")
+}
+
+func sanitizeNamePart(s string) string {
+	s = strings.TrimSpace(s)
+	if s == "*" {
+		return ""
+	}
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-':
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	return strings.Trim(b.String(), "_")
+}
+
+// GenerateArgs returns the ssh-keygen arguments for opts.
+func GenerateArgs(opts GenerateOptions) ([]string, error) {
+	args := []string{"-t", opts.Type}
+	switch opts.Type {
+	case "ed25519":
+	case "ecdsa":
+		args = append(args, "-b", "521")
+	case "rsa":
+		args = append(args, "-b", "4096")
+	case "ed25519-sk", "ecdsa-sk":
+		// Resident keys can be re-imported on another machine with ssh-keygen -K.
+		args = append(args, "-O", "resident")
+		if opts.SecurityKeyProvider != "" {
+			args = append(args, "-w", opts.SecurityKeyProvider)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported key type %q (supported: %s)", opts.Type, strings.Join(SupportedKeyTypes, ", "))
+	}
+	if strings.TrimSpace(opts.Path) == "" {
+		return nil, fmt.Errorf("key path is required")
+	}
+	args = append(args, "-f", opts.Path, "-C", opts.Comment)
+	if opts.NoPassphrase {
+		args = append(args, "-N", "")
+	}
+	return args, nil
+}
+
+// CheckGenerateTarget fails if either half of the key pair already exists.
+func CheckGenerateTarget(path string) error {
+	for _, p := range []string{path, path + ".pub"} {
+		if _, err := os.Stat(p); err == nil {
+			return fmt.Errorf("%s already exists; choose another --name", p)
+		}
+	}
+	return os.MkdirAll(filepath.Dir(path), 0o700)
+}
+
+// KeyPairExists reports whether either half of the pair at path exists.
+func KeyPairExists(path string) bool {
+	for _, p := range []string{path, path + ".pub"} {
+		if _, err := os.Lstat(p); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// RemoveKeyPair deletes both halves of the pair at path, e.g. a pair that
+// was generated for a rule that could not be saved.
+func RemoveKeyPair(path string) error {
+	var errs []error
+	for _, p := range []string{path, path + ".pub"} {
+		if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// FixPermissions applies the modes OpenSSH expects for a freshly generated pair.
+func FixPermissions(path string) error {
+	if err := os.Chmod(path, 0o600); err != nil {
+		return fmt.Errorf("chmod private key: %w", err)
+	}
+	if err := os.Chmod(path+".pub", 0o644); err != nil {
+		return fmt.Errorf("chmod public key: %w", err)
+	}
+	return nil
+}
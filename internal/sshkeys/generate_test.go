@@ -0,0 +1,40 @@
+package sshkeys
+
+import "testing"
+
+func TestDefaultKeyName(t *testing.T) {
+	cases := []struct {
+		host, owner, want string
+	}{
+		{"github.com", "CompanyOrg", "id_ed25519_github_com_CompanyOrg"},
+		{"gitlab.com", "Group/sub", "id_ed25519_gitlab_com_Group_sub"},
+		{"github.com", "*", "id_ed25519_github_com"},
+	}
+	for _, tc := range cases {
+		if got := DefaultKeyName("ed25519", tc.host, tc.owner); got != tc.want {
+			t.Fatalf("DefaultKeyName(%q, %q) = %q, want %q", tc.host, tc.owner, got, tc.want)
+		}
+	}
+}
+
+func TestGenerateArgsRejectsUnknownType(t *testing.T) {
+	if _, err := GenerateArgs(GenerateOptions{Type: "dsa", Path: "/tmp/k"}); err == nil {
+		t.Fatalf("expected unsupported type error")
+	}
+}
+
+func TestGenerateArgsSecurityKey(t *testing.T) {
+	args, err := GenerateArgs(GenerateOptions{Type: "ed25519-sk", Path: "/tmp/k", Comment: "c", SecurityKeyProvider: "internal"})
+	if err != nil {
+		t.Fatalf("GenerateArgs() error = %v", err)
+	}
+	want := []string{"-t", "ed25519-sk", "-O", "resident", "-w", "internal", "-f", "/tmp/k", "-C", "c"}
+	if len(args) != len(want) {
+		t.Fatalf("GenerateArgs() = %q, want %q", args, want)
+	}
+	for i := range want {
+		if args[i] != want[i] {
+			t.Fatalf("GenerateArgs() = %q, want %q", args, want)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package sshkeys
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// TypeName returns the key type name of an SSH key algorithm as the key
+// type settings and ssh-keygen -t spell it: ed25519, ecdsa, rsa, dsa,
+// ed25519-sk or ecdsa-sk.
+func TypeName(t string) string {
+	return strings.ToLower(DisplayType(t))
+}
+
+// InspectKey returns the public key of the key file at path, without asking
+// for a passphrase: from its .pub file, else from the public half OpenSSH
+// private keys carry unencrypted. Legacy PEM keys only give their type, and
+// for unencrypted RSA keys their size.
+func InspectKey(path string) (AgentIdentity, error) {
+	if id, err := ReadPublicKeyFile(PublicKeyPath(path)); err == nil {
+		return id, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return AgentIdentity{}, fmt.Errorf("read private key %s: %w", path, err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return AgentIdentity{}, fmt.Errorf("%s: unknown key format", path)
+	}
+	switch block.Type {
+	case "OPENSSH PRIVATE KEY":
+		blob, err := openSSHPublicKey(block.Bytes)
+		if err != nil {
+			return AgentIdentity{}, fmt.Errorf("%s: %w", path, err)
+		}
+		fields := readWireStrings(blob, 1)
+		if len(fields) == 0 {
+			return AgentIdentity{}, fmt.Errorf("%s: invalid public key", path)
+		}
+		return ParsePublicKeyLine(string(fields[0]) + " " + base64.StdEncoding.EncodeToString(blob))
+	case "RSA PRIVATE KEY":
+		id := AgentIdentity{Type: "ssh-rsa"}
+		if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+			id.Bits = key.N.BitLen()
+		}
+		return id, nil
+	case "DSA PRIVATE KEY":
+		return AgentIdentity{Type: "ssh-dss"}, nil
+	case "EC PRIVATE KEY":
+		id := AgentIdentity{Type: "ecdsa-sha2-nistp256"}
+		if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+			id.Bits = key.Curve.Params().BitSize
+		}
+		return id, nil
+	}
+	return AgentIdentity{}, fmt.Errorf("%s: cannot tell the key type of a %s", path, strings.ToLower(block.Type))
+}
+
+// openSSHPublicKey returns the first public key blob of an openssh-key-v1
+// blob: magic, cipher, kdf name, kdf options, key count, public keys.
+func openSSHPublicKey(blob []byte) ([]byte, error) {
+	if !bytes.HasPrefix(blob, []byte(openSSHKeyMagic)) {
+		return nil, errors.New("not an OpenSSH private key")
+	}
+	rest := blob[len(openSSHKeyMagic):]
+	fields := readWireStrings(rest, 3)
+	if len(fields) < 3 {
+		return nil, errors.New("truncated OpenSSH private key")
+	}
+	for _, f := range fields {
+		rest = rest[4+len(f):]
+	}
+	if len(rest) < 4 {
+		return nil, errors.New("truncated OpenSSH private key")
+	}
+	keys := readWireStrings(rest[4:], 1)
+	if len(keys) == 0 {
+		return nil, errors.New("OpenSSH private key has no public key")
+	}
+	return keys[0], nil
+}
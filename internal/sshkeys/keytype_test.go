@@ -0,0 +1,56 @@
+package sshkeys
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestInspectKey(t *testing.T) {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen not found")
+	}
+	dir := t.TempDir()
+	for _, tc := range []struct {
+		args       []string
+		name, want string
+		bits       int
+	}{
+		{[]string{"-t", "ed25519", "-N", ""}, "plain", "ed25519", 256},
+		{[]string{"-t", "ed25519", "-N", "secret"}, "encrypted", "ed25519", 256},
+		{[]string{"-t", "rsa", "-b", "1024", "-N", "secret"}, "rsa", "rsa", 1024},
+	} {
+		path := filepath.Join(dir, tc.name)
+		if out, err := exec.Command("ssh-keygen", append([]string{"-q", "-f", path}, tc.args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("ssh-keygen %v: %v: %s", tc.args, err, out)
+		}
+		// Without the .pub file the public half comes from the private key,
+		// which does not need the passphrase.
+		if err := os.Remove(path + ".pub"); err != nil {
+			t.Fatal(err)
+		}
+		id, err := InspectKey(path)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if TypeName(id.Type) != tc.want || id.Bits != tc.bits {
+			t.Errorf("%s: type=%s bits=%d, want %s %d", tc.name, TypeName(id.Type), id.Bits, tc.want, tc.bits)
+		}
+	}
+}
+
+func TestTypeName(t *testing.T) {
+	for typ, want := range map[string]string{
+		"ssh-ed25519":                        "ed25519",
+		"sk-ssh-ed25519@openssh.com":         "ed25519-sk",
+		"ecdsa-sha2-nistp384":                "ecdsa",
+		"sk-ecdsa-sha2-nistp256@openssh.com": "ecdsa-sk",
+		"ssh-rsa":                            "rsa",
+		"ssh-dss":                            "dsa",
+	} {
+		if got := TypeName(typ); got != want {
+			t.Errorf("TypeName(%s) = %s, want %s", typ, got, want)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package sshkeys
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// KnownHostsFiles are the files ssh checks host keys against by default:
+// the user's known_hosts and known_hosts2, then the system-wide list.
+func KnownHostsFiles() []string {
+	var files []string
+	if home, err := os.UserHomeDir(); err == nil {
+		files = append(files, filepath.Join(home, ".ssh", "known_hosts"), filepath.Join(home, ".ssh", "known_hosts2"))
+	}
+	if runtime.GOOS != "windows" {
+		files = append(files, "/etc/ssh/ssh_known_hosts", "/etc/ssh/ssh_known_hosts2")
+	}
+	return files
+}
+
+// IsKnownHost reports whether any of files has a host key for host on port
+// (empty or "22" for the default). It understands hashed entries, pattern
+// lists with * and ? wildcards and negations; @revoked lines do not count.
+// Missing files are skipped.
+func IsKnownHost(files []string, host, port string) (bool, error) {
+	name := strings.ToLower(host)
+	if port != "" && port != "22" {
+		name = "[" + name + "]:" + port
+	}
+	found := false
+	err := eachKnownHost(files, func(patterns string, _ []byte) bool {
+		found = knownHostsPatternMatch(patterns, name)
+		return !found
+	})
+	return found, err
+}
+
+// HostsForKey returns the host names files pin to the host key blob: the
+// literal names of its entries, without port, and those of candidates that
+// match one of its hashed or wildcard entries.
+func HostsForKey(files []string, blob []byte, candidates []string) ([]string, error) {
+	var hosts []string
+	add := func(h string) {
+		if h = strings.ToLower(h); !slices.Contains(hosts, h) {
+			hosts = append(hosts, h)
+		}
+	}
+	err := eachKnownHost(files, func(patterns string, key []byte) bool {
+		if !bytes.Equal(key, blob) {
+			return true
+		}
+		if !strings.HasPrefix(patterns, "|") {
+			for _, p := range strings.Split(patterns, ",") {
+				if h, _, ok := strings.Cut(strings.TrimPrefix(p, "["), "]:"); ok {
+					p = h
+				}
+				if !strings.ContainsAny(p, "*?!") {
+					add(p)
+				}
+			}
+		}
+		for _, c := range candidates {
+			if knownHostsPatternMatch(patterns, strings.ToLower(c)) {
+				add(c)
+			}
+		}
+		return true
+	})
+	return hosts, err
+}
+
+// eachKnownHost calls fn with the host patterns and decoded key of every
+// entry in files except @revoked ones, until fn returns false. Missing
+// files are skipped.
+func eachKnownHost(files []string, fn func(patterns string, key []byte) bool) error {
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		sc := bufio.NewScanner(strings.NewReader(string(data)))
+		sc.Buffer(make([]byte, 64<<10), 1<<20)
+		for sc.Scan() {
+			fields := strings.Fields(sc.Text())
+			if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+				continue
+			}
+			if strings.HasPrefix(fields[0], "@") {
+				if fields[0] == "@revoked" || len(fields) < 2 {
+					continue
+				}
+				fields = fields[1:]
+			}
+			if len(fields) < 3 {
+				continue
+			}
+			key, _ := base64.StdEncoding.DecodeString(fields[2])
+			if !fn(fields[0], key) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+func knownHostsPatternMatch(patterns, name string) bool {
+	if strings.HasPrefix(patterns, "|1|") {
+		return hashedHostMatch(patterns, name)
+	}
+	matched := false
+	for _, p := range strings.Split(strings.ToLower(patterns), ",") {
+		negated := strings.HasPrefix(p, "!")
+		if ok, err := filepath.Match(strings.TrimPrefix(p, "!"), name); err != nil || !ok {
+			continue
+		}
+		if negated {
+			return false
+		}
+		matched = true
+	}
+	return matched
+}
+
+// hashedHostMatch checks a HashKnownHosts entry, |1|<salt>|<hmac-sha1>.
+func hashedHostMatch(entry, name string) bool {
+	parts := strings.Split(entry, "|")
+	if len(parts) != 4 {
+		return false
+	}
+	salt, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	want, err := base64.StdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte(name))
+	return hmac.Equal(mac.Sum(nil), want)
+}
+
+// LoosePermissions reports whether the private key at path is readable by
+// group or others, which ssh refuses with "UNPROTECTED PRIVATE KEY FILE".
+// Always false on Windows, where modes do not map to ACLs.
+func LoosePermissions(path string) (os.FileMode, bool) {
+	if runtime.GOOS == "windows" {
+		return 0, false
+	}
+	st, err := os.Stat(path)
+	if err != nil || !st.Mode().IsRegular() {
+		return 0, false
+	}
+	return st.Mode().Perm(), st.Mode().Perm()&0o077 != 0
+}
+
+// HostKey is a known_hosts entry for one host name and key.
+type HostKey struct {
+	Host        string `json:"host"`
+	Type        string `json:"type"`
+	Fingerprint string `json:"fingerprint"`
+	// Key is the base64 public key blob.
+	Key string `json:"-"`
+}
+
+// Line formats k as a known_hosts line.
+func (k HostKey) Line() string {
+	return k.Host + " " + k.Type + " " + k.Key
+}
+
+// KnownHostName is the name known_hosts stores host under: the host for
+// port 22, [host]:port otherwise.
+func KnownHostName(host, port string) string {
+	name := strings.ToLower(host)
+	if port != "" && port != "22" {
+		name = "[" + name + "]:" + port
+	}
+	return name
+}
+
+// ParseHostKeys reads known_hosts lines, as written by ssh-keyscan, into one
+// HostKey per host name and key. Comments, @cert-authority and @revoked
+// lines, hashed entries and patterns are skipped.
+func ParseHostKeys(data string) []HostKey {
+	var keys []HostKey
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || strings.HasPrefix(fields[0], "#") || strings.HasPrefix(fields[0], "@") || strings.HasPrefix(fields[0], "|") {
+			continue
+		}
+		id, err := ParsePublicKeyLine(fields[1] + " " + fields[2])
+		if err != nil {
+			continue
+		}
+		for _, host := range strings.Split(strings.ToLower(fields[0]), ",") {
+			if host == "" || strings.ContainsAny(host, "*?!") {
+				continue
+			}
+			keys = append(keys, HostKey{Host: host, Type: id.Type, Fingerprint: id.Fingerprint, Key: fields[2]})
+		}
+	}
+	return keys
+}
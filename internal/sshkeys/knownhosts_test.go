@@ -0,0 +1,113 @@
+package sshkeys
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"testing"
+)
+
+func TestIsKnownHost(t *testing.T) {
+	salt := []byte("0123456789abcdefghij")
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte("[git.example.com]:2222"))
+	hashed := "|1|" + base64.StdEncoding.EncodeToString(salt) + "|" + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	file := filepath.Join(t.TempDir(), "known_hosts")
+	content := "# comment\n" +
+		"github.com,140.82.121.4 ssh-ed25519 AAAA\n" +
+		"*.corp.example,!bad.corp.example ssh-ed25519 AAAA\n" +
+		"@revoked gitlab.com ssh-rsa AAAA\n" +
+		hashed + " ssh-ed25519 AAAA\n"
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	files := []string{filepath.Join(t.TempDir(), "missing"), file}
+	for _, tc := range []struct {
+		host, port string
+		want       bool
+	}{
+		{"github.com", "", true},
+		{"GitHub.com", "22", true},
+		{"github.com", "443", false},
+		{"git.corp.example", "", true},
+		{"bad.corp.example", "", false},
+		{"gitlab.com", "", false},
+		{"git.example.com", "2222", true},
+		{"git.example.com", "", false},
+	} {
+		got, err := IsKnownHost(files, tc.host, tc.port)
+		if err != nil || got != tc.want {
+			t.Errorf("IsKnownHost(%s, %q) = %v, %v; want %v", tc.host, tc.port, got, err, tc.want)
+		}
+	}
+}
+
+func TestHostsForKey(t *testing.T) {
+	salt := []byte("0123456789abcdefghij")
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte("git.example.com"))
+	hashed := "|1|" + base64.StdEncoding.EncodeToString(salt) + "|" + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	file := filepath.Join(t.TempDir(), "known_hosts")
+	content := "github.com,[ssh.github.com]:443 ssh-ed25519 R0g=\n" + // "GH"
+		"gitlab.com ssh-ed25519 R0w=\n" +
+		"@revoked *.corp.example ssh-ed25519 R0g=\n" +
+		hashed + " ssh-ed25519 R0g=\n"
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	got, err := HostsForKey([]string{file}, []byte("GH"), []string{"git.example.com", "gitlab.com", "x.corp.example"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"github.com", "ssh.github.com", "git.example.com"}; !slices.Equal(got, want) {
+		t.Errorf("HostsForKey = %q, want %q", got, want)
+	}
+}
+
+func TestLoosePermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes")
+	}
+	key := filepath.Join(t.TempDir(), "id")
+	if err := os.WriteFile(key, []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if mode, loose := LoosePermissions(key); !loose || mode != 0o644 {
+		t.Errorf("LoosePermissions(0644) = %v, %v", mode, loose)
+	}
+	if err := os.Chmod(key, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, loose := LoosePermissions(key); loose {
+		t.Error("0600 reported as loose")
+	}
+}
+
+func TestParseHostKeys(t *testing.T) {
+	const key = "AAAAC3NzaC1lZDI1NTE5AAAAIDZEsmwrZQYbOtVJ0yfiERS6xC1mKVyLYE5jxoh24Le4"
+	data := "# github.com:22 SSH-2.0-babeld\n" +
+		"GitHub.com,140.82.121.4 ssh-ed25519 " + key + "\n" +
+		"[git.example.com]:2222 ssh-ed25519 " + key + "\n" +
+		"*.corp ssh-ed25519 " + key + "\n" +
+		"@revoked gitlab.com ssh-ed25519 " + key + "\n" +
+		"bad.example ssh-ed25519 !!!\n"
+	var hosts []string
+	for _, k := range ParseHostKeys(data) {
+		hosts = append(hosts, k.Host)
+		if k.Fingerprint != "SHA256:AzErAd2Rs97WgT1/BP+mDdCjVyW8Bu23Zmqtd0q+GtA" || k.Line() != k.Host+" ssh-ed25519 "+key {
+			t.Errorf("ParseHostKeys() entry = %+v", k)
+		}
+	}
+	if want := []string{"github.com", "140.82.121.4", "[git.example.com]:2222"}; !slices.Equal(hosts, want) {
+		t.Fatalf("ParseHostKeys() hosts = %q, want %q", hosts, want)
+	}
+	if got := KnownHostName("Git.Example.com", "2222"); got != "[git.example.com]:2222" {
+		t.Errorf("KnownHostName() = %q", got)
+	}
+}
@@ -0,0 +1,7 @@
+//go:build !windows
+
+package sshkeys
+
+// PageantRunning reports whether PuTTY's agent is running. Pageant only
+// exists on Windows.
+func PageantRunning() bool { return false }
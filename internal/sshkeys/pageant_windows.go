@@ -0,0 +1,21 @@
+//go:build windows
+
+package sshkeys
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var procFindWindow = syscall.NewLazyDLL("user32.dll").NewProc("FindWindowW")
+
+// PageantRunning reports whether PuTTY's agent is running: Pageant owns a
+// window of class "Pageant", which is also how plink finds it.
+func PageantRunning() bool {
+	name, err := syscall.UTF16PtrFromString("Pageant")
+	if err != nil || procFindWindow.Find() != nil {
+		return false
+	}
+	hwnd, _, _ := procFindWindow.Call(uintptr(unsafe.Pointer(name)), uintptr(unsafe.Pointer(name)))
+	return hwnd != 0
+}
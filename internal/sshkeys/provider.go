@@ -0,0 +1,90 @@
+package sshkeys
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Key provider prefixes recognized in a rule's key field.
+const (
+	providerOnePassword = "op://"
+	providerPass        = "pass:"
+)
+
+// ProviderName returns the secret manager a key reference points to
+// ("1password", "pass"), or "" for a plain file path.
+func ProviderName(key string) string {
+	key = strings.TrimSpace(key)
+	switch {
+	case strings.HasPrefix(key, providerOnePassword):
+		return "1password"
+	case strings.HasPrefix(key, providerPass):
+		return "pass"
+	default:
+		return ""
+	}
+}
+
+func IsProviderRef(key string) bool {
+	return ProviderName(key) != ""
+}
+
+// Materialize fetches the private key referenced by ref from its secret
+// manager and writes it to a 0600 temp file. The returned cleanup removes the
+// file and must be called once the key is no longer needed.
+func Materialize(ctx context.Context, ref string) (string, func(), error) {
+	ref = strings.TrimSpace(ref)
+	var cmd *exec.Cmd
+	switch ProviderName(ref) {
+	case "1password":
+		cmd = exec.CommandContext(ctx, "op", "read", ref)
+	case "pass":
+		cmd = exec.CommandContext(ctx, "pass", "show", strings.TrimPrefix(ref, providerPass))
+	default:
+		return "", nil, fmt.Errorf("%q is not a key provider reference", ref)
+	}
+	var out, errOut bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &errOut
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(errOut.String())
+		if msg != "" {
+			return "", nil, fmt.Errorf("fetch key %s: %w: %s", ref, err, msg)
+		}
+		return "", nil, fmt.Errorf("fetch key %s: %w", ref, err)
+	}
+	secret := out.Bytes()
+	if len(bytes.TrimSpace(secret)) == 0 {
+		return "", nil, fmt.Errorf("fetch key %s: provider returned an empty secret", ref)
+	}
+	// ssh refuses keys without a trailing newline after the PEM footer.
+	if secret[len(secret)-1] != '\n' {
+		secret = append(secret, '\n')
+	}
+
+	f, err := os.CreateTemp("", "mgit-key-*")
+	if err != nil {
+		return "", nil, fmt.Errorf("create temp key file: %w", err)
+	}
+	path := f.Name()
+	cleanup := func() { _ = os.Remove(path) }
+	if err := f.Chmod(0o600); err != nil {
+		_ = f.Close()
+		cleanup()
+		return "", nil, fmt.Errorf("chmod temp key file: %w", err)
+	}
+	if _, err := f.Write(secret); err != nil {
+		_ = f.Close()
+		cleanup()
+		return "", nil, fmt.Errorf("write temp key file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("close temp key file: %w", err)
+	}
+	return path, cleanup, nil
+}
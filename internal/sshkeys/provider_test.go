@@ -0,0 +1,54 @@
+package sshkeys
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestProviderName(t *testing.T) {
+	cases := map[string]string{
+		"op://Private/github-work/private key": "1password",
+		"pass:ssh/github-work":                 "pass",
+		"~/.ssh/id_ed25519":                    "",
+	}
+	for ref, want := range cases {
+		if got := ProviderName(ref); got != want {
+			t.Fatalf("ProviderName(%q) = %q, want %q", ref, got, want)
+		}
+	}
+}
+
+func TestMaterializeWritesPrivateTempFile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake provider is a shell script")
+	}
+	bin := t.TempDir()
+	script := "#!/bin/sh\nprintf 'KEY-FOR-%s' \"$2\"\n"
+	if err := os.WriteFile(filepath.Join(bin, "pass"), []byte(script), 0o755); err != nil {
+		t.Fatalf("write fake pass: %v", err)
+	}
+	t.Setenv("PATH", bin)
+
+	path, cleanup, err := Materialize(context.Background(), "pass:ssh/work")
+	if err != nil {
+		t.Fatalf("Materialize() error = %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read materialized key: %v", err)
+	}
+	if string(data) != "KEY-FOR-ssh/work\n" {
+		t.Fatalf("unexpected key contents: %q", data)
+	}
+	st, _ := os.Stat(path)
+	if st.Mode().Perm() != 0o600 {
+		t.Fatalf("expected 0600 permissions, got %v", st.Mode().Perm())
+	}
+	cleanup()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected temp key to be removed, stat err = %v", err)
+	}
+}
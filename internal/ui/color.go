@@ -0,0 +1,82 @@
+package ui
+
+import (
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	ansiReset  = "\x1b[0m"
+	ansiRed    = "\x1b[31m"
+	ansiGreen  = "\x1b[32m"
+	ansiYellow = "\x1b[33m"
+)
+
+// Color wraps text in ANSI colors when enabled and returns it unchanged otherwise.
+type Color struct {
+	Enabled bool
+}
+
+// ColorEnabled reports whether output to w should be colored: never with
+// --no-color, a non-empty NO_COLOR (https://no-color.org) or TERM=dumb, and
+// only when w is a terminal.
+func ColorEnabled(w io.Writer, noColor bool) bool {
+	if noColor || os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	return IsTerminal(w)
+}
+
+// IsTerminal reports whether w, or the writer it wraps (see Unwrap), is a
+// terminal.
+func IsTerminal(w io.Writer) bool {
+	f, ok := Unwrap(w).(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return (info.Mode() & os.ModeCharDevice) != 0
+}
+
+// Unwrap returns the innermost writer of a chain of wrappers with an
+// Unwrap() io.Writer method, such as the CLI's output redaction.
+func Unwrap(w io.Writer) io.Writer {
+	for {
+		u, ok := w.(interface{ Unwrap() io.Writer })
+		if !ok {
+			return w
+		}
+		w = u.Unwrap()
+	}
+}
+
+func (c Color) Red(s string) string    { return c.wrap(ansiRed, s) }
+func (c Color) Green(s string) string  { return c.wrap(ansiGreen, s) }
+func (c Color) Yellow(s string) string { return c.wrap(ansiYellow, s) }
+
+// Level renders a status or validation level (ok, warn, warning, error) in
+// upper case, colored by severity.
+func (c Color) Level(level string) string {
+	text := strings.ToUpper(level)
+	switch strings.ToLower(level) {
+	case "ok":
+		return c.Green(text)
+	case "warn", "warning":
+		return c.Yellow(text)
+	case "error", "fail", "failed":
+		return c.Red(text)
+	default:
+		return text
+	}
+}
+
+func (c Color) wrap(code, s string) string {
+	if !c.Enabled || s == "" {
+		return s
+	}
+	return code + s + ansiReset
+}
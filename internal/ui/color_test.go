@@ -0,0 +1,33 @@
+package ui
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestColorEnabled(t *testing.T) {
+	t.Setenv("NO_COLOR", "")
+	if ColorEnabled(&bytes.Buffer{}, false) {
+		t.Fatalf("ColorEnabled() = true for a non-terminal writer")
+	}
+	t.Setenv("NO_COLOR", "1")
+	if ColorEnabled(&bytes.Buffer{}, false) {
+		t.Fatalf("ColorEnabled() = true with NO_COLOR set")
+	}
+}
+
+func TestColorLevel(t *testing.T) {
+	on := Color{Enabled: true}
+	if got := on.Level("error"); got != "\x1b[31mERROR\x1b[0m" {
+		t.Fatalf("Level(error) = %q", got)
+	}
+	if got := on.Level("warning"); got != "\x1b[33mWARNING\x1b[0m" {
+		t.Fatalf("Level(warning) = %q", got)
+	}
+	if got := on.Level("info"); got != "INFO" {
+		t.Fatalf("Level(info) = %q", got)
+	}
+	if got := (Color{}).Level("ok"); got != "OK" {
+		t.Fatalf("disabled Level(ok) = %q", got)
+	}
+}
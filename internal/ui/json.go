@@ -1,16 +0,0 @@
-package ui
-
-import (
-	"encoding/json"
-	"fmt"
-	"io"
-)
-
-func PrintJSON(w io.Writer, v any) error {
-	enc := json.NewEncoder(w)
-	enc.SetIndent("", "  ")
-	if err := enc.Encode(v); err != nil {
-		return fmt.Errorf("encode JSON output: %w", err)
-	}
-	return nil
-}
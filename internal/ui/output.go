@@ -0,0 +1,107 @@
+package ui
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Format is an output format selected with --output.
+type Format string
+
+const (
+	FormatText  Format = "text" // human-readable, the default
+	FormatTable Format = "table"
+	FormatJSON  Format = "json"
+	FormatYAML  Format = "yaml"
+	// FormatJSONL is JSON Lines: one compact object per line. Bulk commands
+	// stream a line per target as it completes.
+	FormatJSONL Format = "jsonl"
+)
+
+// SchemaVersion is stamped on every JSON/YAML payload as "schemaVersion".
+// Bump it when a field is renamed or removed; adding fields keeps it.
+const SchemaVersion = 1
+
+// ParseFormat validates an --output value. The empty string means text.
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(strings.TrimSpace(s))); f {
+	case "":
+		return FormatText, nil
+	case FormatText, FormatTable, FormatJSON, FormatYAML, FormatJSONL:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown output format %q (want json, jsonl, yaml, table or text)", s)
+}
+
+// Structured reports whether f is a machine-readable format.
+func (f Format) Structured() bool {
+	return f == FormatJSON || f == FormatYAML || f == FormatJSONL
+}
+
+// Print writes v in a structured format. Object payloads get "schemaVersion"
+// as their first field; field names come from the payload's JSON tags.
+func Print(w io.Writer, f Format, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("encode %s output: %w", f, err)
+	}
+	if f == FormatJSONL {
+		return printLines(w, data)
+	}
+	data = withSchemaVersion(data)
+	if f == FormatYAML {
+		out, err := jsonToYAML(data)
+		if err != nil {
+			return fmt.Errorf("encode yaml output: %w", err)
+		}
+		_, err = w.Write(out)
+		return err
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, data, "", "  "); err != nil {
+		return fmt.Errorf("encode json output: %w", err)
+	}
+	buf.WriteByte('\n')
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// PrintLine writes v as one line of JSON Lines output.
+func PrintLine(w io.Writer, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("encode jsonl output: %w", err)
+	}
+	_, err = w.Write(append(withSchemaVersion(data), '\n'))
+	return err
+}
+
+// printLines writes an encoded array as one line per element, and anything
+// else as a single line.
+func printLines(w io.Writer, data []byte) error {
+	var items []json.RawMessage
+	if len(data) == 0 || data[0] != '[' || json.Unmarshal(data, &items) != nil {
+		items = []json.RawMessage{data}
+	}
+	var buf bytes.Buffer
+	for _, item := range items {
+		buf.Write(withSchemaVersion(item))
+		buf.WriteByte('\n')
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func withSchemaVersion(data []byte) []byte {
+	if len(data) < 2 || data[0] != '{' {
+		return data
+	}
+	head := fmt.Sprintf(`{"schemaVersion":%d`, SchemaVersion)
+	if data[1] == '}' {
+		return []byte(head + "}")
+	}
+	return append([]byte(head+","), data[1:]...)
+}
@@ -0,0 +1,96 @@
+package ui
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+type sample struct {
+	Name  string            `json:"name"`
+	Valid bool              `json:"valid"`
+	Tags  []string          `json:"tags"`
+	Rules []map[string]any  `json:"rules"`
+	Env   map[string]string `json:"env"`
+	Note  string            `json:"note"`
+}
+
+var samplePayload = sample{
+	Name:  "work",
+	Valid: true,
+	Tags:  []string{"a", "yes"},
+	Rules: []map[string]any{{"host": "github.com", "priority": 10}},
+	Env:   map[string]string{},
+	Note:  "key: ~/.ssh/id_work",
+}
+
+func TestPrintJSONAddsSchemaVersion(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Print(&buf, FormatJSON, samplePayload); err != nil {
+		t.Fatalf("Print() error = %v", err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, buf.String())
+	}
+	if got["schemaVersion"] != float64(SchemaVersion) || got["name"] != "work" {
+		t.Fatalf("unexpected payload: %v", got)
+	}
+}
+
+func TestPrintYAML(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Print(&buf, FormatYAML, samplePayload); err != nil {
+		t.Fatalf("Print() error = %v", err)
+	}
+	want := `schemaVersion: 1
+name: work
+valid: true
+tags:
+- a
+- "yes"
+rules:
+- host: github.com
+  priority: 10
+env: {}
+note: "key: ~/.ssh/id_work"
+`
+	if got := buf.String(); got != want {
+		t.Fatalf("yaml output:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	if f, err := ParseFormat(""); err != nil || f != FormatText {
+		t.Fatalf("ParseFormat(\"\") = %q, %v", f, err)
+	}
+	if f, err := ParseFormat("YAML"); err != nil || f != FormatYAML {
+		t.Fatalf("ParseFormat(YAML) = %q, %v", f, err)
+	}
+	if _, err := ParseFormat("xml"); err == nil {
+		t.Fatalf("ParseFormat(xml) should fail")
+	}
+}
+
+func TestPrintJSONL(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Print(&buf, FormatJSONL, []sample{{Name: "a"}, {Name: "b"}}); err != nil {
+		t.Fatalf("Print() error = %v", err)
+	}
+	if err := PrintLine(&buf, map[string]int{"failed": 0}); err != nil {
+		t.Fatalf("PrintLine() error = %v", err)
+	}
+	lines := bytes.Split(bytes.TrimSuffix(buf.Bytes(), []byte("\n")), []byte("\n"))
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines:\n%s", len(lines), buf.String())
+	}
+	for i, want := range []string{"a", "b", ""} {
+		var got map[string]any
+		if err := json.Unmarshal(lines[i], &got); err != nil {
+			t.Fatalf("line %d is not JSON: %v", i, err)
+		}
+		if got["schemaVersion"] != float64(SchemaVersion) || (want != "" && got["name"] != want) {
+			t.Fatalf("line %d = %s", i, lines[i])
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package ui
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Progress reports how far a multi-target operation has got: targets done
+// out of total, the targets in flight and the elapsed time. On a terminal it
+// keeps one status line up to date; on other writers it prints a plain line
+// every PlainInterval so logs show the operation is still alive. All methods
+// are safe for concurrent use, and a nil *Progress does nothing.
+type Progress struct {
+	w      io.Writer
+	out    io.Writer
+	tty    bool
+	total  int
+	start  time.Time
+	mu     sync.Mutex
+	done   int
+	active []string
+	drawn  bool
+	stop   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// PlainInterval is how often a non-terminal Progress reports.
+var PlainInterval = 10 * time.Second
+
+// NewProgress starts reporting on w for total targets. Regular output
+// written with Printf goes to out, which may be a different stream than w.
+func NewProgress(w, out io.Writer, total int) *Progress {
+	p := &Progress{w: w, out: out, tty: IsTerminal(w), total: total, start: time.Now(), stop: make(chan struct{})}
+	interval := PlainInterval
+	if p.tty {
+		interval = time.Second // keeps the elapsed time ticking
+	}
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-p.stop:
+				return
+			case <-t.C:
+				p.mu.Lock()
+				p.report()
+				p.mu.Unlock()
+			}
+		}
+	}()
+	return p
+}
+
+// Start marks target as in flight.
+func (p *Progress) Start(target string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.active = append(p.active, target)
+	if p.tty {
+		p.report()
+	}
+}
+
+// Done marks target as finished.
+func (p *Progress) Done(target string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, t := range p.active {
+		if t == target {
+			p.active = append(p.active[:i], p.active[i+1:]...)
+			break
+		}
+	}
+	p.done++
+	if p.tty {
+		p.report()
+	}
+}
+
+// Printf writes a line of regular output without garbling the status line.
+func (p *Progress) Printf(format string, args ...any) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clear()
+	fmt.Fprintf(p.out, format+"\n", args...)
+	if p.tty {
+		p.report()
+	}
+}
+
+// Finish stops reporting and removes the status line.
+func (p *Progress) Finish() {
+	if p == nil {
+		return
+	}
+	close(p.stop)
+	p.wg.Wait()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clear()
+}
+
+func (p *Progress) status() string {
+	s := fmt.Sprintf("[%d/%d] %s", p.done, p.total, time.Since(p.start).Round(time.Second))
+	if len(p.active) > 0 {
+		s += "  " + strings.Join(p.active, ", ")
+	}
+	return s
+}
+
+// report draws the status line; callers hold p.mu.
+func (p *Progress) report() {
+	if !p.tty {
+		if p.done < p.total {
+			fmt.Fprintln(p.w, "progress: "+p.status())
+		}
+		return
+	}
+	fmt.Fprint(p.w, "\r\x1b[2K"+p.status())
+	p.drawn = true
+}
+
+func (p *Progress) clear() {
+	if p.drawn {
+		fmt.Fprint(p.w, "\r\x1b[2K")
+		p.drawn = false
+	}
+}
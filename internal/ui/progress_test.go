@@ -0,0 +1,62 @@
+package ui
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestProgressPlainLines(t *testing.T) {
+	old := PlainInterval
+	PlainInterval = 10 * time.Millisecond
+	defer func() { PlainInterval = old }()
+
+	var status, out syncBuffer
+	p := NewProgress(&status, &out, 2)
+	p.Start("repo-a")
+	p.Printf("[repo-a] fetch origin")
+	time.Sleep(50 * time.Millisecond)
+	p.Done("repo-a")
+	p.Finish()
+
+	if got := out.String(); got != "[repo-a] fetch origin\n" {
+		t.Fatalf("regular output = %q, want only the Printf line", got)
+	}
+	got := status.String()
+	if strings.Contains(got, "fetch origin") {
+		t.Fatalf("regular output written with the progress lines: %q", got)
+	}
+	if !strings.Contains(got, "progress: [0/2]") || !strings.Contains(got, "repo-a") {
+		t.Fatalf("missing periodic progress line: %q", got)
+	}
+	if strings.Contains(got, "\x1b") {
+		t.Fatalf("non-terminal output contains escape codes: %q", got)
+	}
+}
+
+func TestNilProgressIsNoop(t *testing.T) {
+	var p *Progress
+	p.Start("x")
+	p.Printf("ignored")
+	p.Done("x")
+	p.Finish()
+}
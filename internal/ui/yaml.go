@@ -0,0 +1,155 @@
+package ui
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// jsonToYAML re-encodes a JSON document as block-style YAML, keeping object
+// field order. It covers what encoding/json produces and nothing more, which
+// keeps mgit free of a YAML dependency.
+func jsonToYAML(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	v, err := decodeOrdered(dec)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if isCollection(v) && !isEmpty(v) {
+		writeYAML(&buf, v, 0)
+	} else {
+		buf.WriteString(yamlScalar(v) + "\n")
+	}
+	return buf.Bytes(), nil
+}
+
+type yamlField struct {
+	key   string
+	value any
+}
+
+type yamlObject []yamlField
+
+func decodeOrdered(dec *json.Decoder) (any, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t := tok.(type) {
+	case json.Delim:
+		switch t {
+		case '{':
+			obj := yamlObject{}
+			for dec.More() {
+				k, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				v, err := decodeOrdered(dec)
+				if err != nil {
+					return nil, err
+				}
+				obj = append(obj, yamlField{key: k.(string), value: v})
+			}
+			_, err := dec.Token()
+			return obj, err
+		case '[':
+			list := []any{}
+			for dec.More() {
+				v, err := decodeOrdered(dec)
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, v)
+			}
+			_, err := dec.Token()
+			return list, err
+		}
+		return nil, fmt.Errorf("unexpected delimiter %v", t)
+	}
+	return tok, nil
+}
+
+func isCollection(v any) bool {
+	switch v.(type) {
+	case yamlObject, []any:
+		return true
+	}
+	return false
+}
+
+func isEmpty(v any) bool {
+	switch t := v.(type) {
+	case yamlObject:
+		return len(t) == 0
+	case []any:
+		return len(t) == 0
+	}
+	return false
+}
+
+// writeYAML writes a non-empty object or list at the given indent.
+func writeYAML(w io.Writer, v any, indent int) {
+	pad := strings.Repeat("  ", indent)
+	switch t := v.(type) {
+	case yamlObject:
+		for _, f := range t {
+			key := yamlScalar(f.key)
+			if isCollection(f.value) && !isEmpty(f.value) {
+				fmt.Fprintf(w, "%s%s:\n", pad, key)
+				childIndent := indent + 1
+				if _, ok := f.value.([]any); ok {
+					childIndent = indent
+				}
+				writeYAML(w, f.value, childIndent)
+				continue
+			}
+			fmt.Fprintf(w, "%s%s: %s\n", pad, key, yamlScalar(f.value))
+		}
+	case []any:
+		for _, item := range t {
+			if !isCollection(item) || isEmpty(item) {
+				fmt.Fprintf(w, "%s- %s\n", pad, yamlScalar(item))
+				continue
+			}
+			// Render the item one level deeper, then replace the first
+			// line's indentation with the "- " marker.
+			var sub bytes.Buffer
+			writeYAML(&sub, item, indent+1)
+			fmt.Fprint(w, pad+"- "+strings.TrimPrefix(sub.String(), pad+"  "))
+		}
+	}
+}
+
+var plainYAML = regexp.MustCompile(`^[A-Za-z_/.][A-Za-z0-9_/.@+=~-]*$`)
+
+func yamlScalar(v any) string {
+	switch t := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return strconv.FormatBool(t)
+	case json.Number:
+		return t.String()
+	case yamlObject:
+		return "{}"
+	case []any:
+		return "[]"
+	case string:
+		switch strings.ToLower(t) {
+		case "true", "false", "yes", "no", "on", "off", "null", "~", "y", "n":
+			return strconv.Quote(t)
+		}
+		if plainYAML.MatchString(t) {
+			return t
+		}
+		return strconv.Quote(t)
+	}
+	return strconv.Quote(fmt.Sprint(v))
+}
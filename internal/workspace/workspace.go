@@ -0,0 +1,147 @@
+package workspace
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const CurrentVersion = 1
+
+// Registry is the list of repositories mgit ws commands operate on. It lives
+// next to the global config and is independent of per-repo rule configs.
+type Registry struct {
+	Version int    `json:"version"`
+	Repos   []Repo `json:"repos"`
+}
+
+type Repo struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+func DefaultPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("determine user config dir: %w", err)
+	}
+	return filepath.Join(dir, "mgit", "workspace.json"), nil
+}
+
+// Load reads the registry at path. A missing file is an empty registry.
+func Load(path string) (*Registry, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &Registry{Version: CurrentVersion, Repos: []Repo{}}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read workspace %s: %w", path, err)
+	}
+	var reg Registry
+	if err := json.Unmarshal(data, &reg); err != nil {
+		return nil, fmt.Errorf("parse workspace %s: %w", path, err)
+	}
+	if reg.Version == 0 {
+		reg.Version = CurrentVersion
+	}
+	if reg.Repos == nil {
+		reg.Repos = []Repo{}
+	}
+	return &reg, nil
+}
+
+func Save(path string, reg *Registry) error {
+	if reg == nil {
+		return errors.New("nil workspace")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("create workspace directory: %w", err)
+	}
+	sort.SliceStable(reg.Repos, func(i, j int) bool { return reg.Repos[i].Name < reg.Repos[j].Name })
+	data, err := json.MarshalIndent(reg, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode workspace JSON: %w", err)
+	}
+	data = append(data, '\n')
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return fmt.Errorf("write workspace %s: %w", path, err)
+	}
+	return nil
+}
+
+// Add registers the repository at path (absolute, repository root). The name
+// defaults to the directory name. Adding an already registered path is a
+// no-op and reports added=false.
+func (r *Registry) Add(path, name string) (Repo, bool, error) {
+	path = filepath.Clean(strings.TrimSpace(path))
+	if !filepath.IsAbs(path) {
+		return Repo{}, false, fmt.Errorf("workspace path must be absolute: %s", path)
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = filepath.Base(path)
+	}
+	for _, repo := range r.Repos {
+		if repo.Path == path {
+			return repo, false, nil
+		}
+		if repo.Name == name {
+			return Repo{}, false, fmt.Errorf("name %q is already used by %s (use --name to pick another)", name, repo.Path)
+		}
+	}
+	repo := Repo{Name: name, Path: path}
+	r.Repos = append(r.Repos, repo)
+	return repo, true, nil
+}
+
+// Remove unregisters the repository matching a name or path.
+func (r *Registry) Remove(nameOrPath string) (Repo, bool) {
+	nameOrPath = strings.TrimSpace(nameOrPath)
+	for i, repo := range r.Repos {
+		if repo.Name == nameOrPath || repo.Path == filepath.Clean(nameOrPath) {
+			r.Repos = append(r.Repos[:i], r.Repos[i+1:]...)
+			return repo, true
+		}
+	}
+	return Repo{}, false
+}
+
+// Scan finds git repositories below root. It does not descend into
+// repositories it found or into hidden directories; repos are named by their
+// path relative to root.
+func Scan(root string) ([]Repo, error) {
+	root = filepath.Clean(root)
+	var repos []Repo
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			return nil // unreadable subdirectories are skipped
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != root && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if _, err := os.Stat(filepath.Join(path, ".git")); err == nil {
+			name, relErr := filepath.Rel(root, path)
+			if relErr != nil || name == "." {
+				name = filepath.Base(path)
+			}
+			repos = append(repos, Repo{Name: filepath.ToSlash(name), Path: path})
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scan %s: %w", root, err)
+	}
+	return repos, nil
+}
@@ -0,0 +1,87 @@
+package workspace
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadMissingFileIsEmpty(t *testing.T) {
+	reg, err := Load(filepath.Join(t.TempDir(), "workspace.json"))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(reg.Repos) != 0 || reg.Version != CurrentVersion {
+		t.Fatalf("Load() = %+v, want empty registry", reg)
+	}
+}
+
+func TestAddRemoveRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "workspace.json")
+	reg, _ := Load(path)
+
+	repoA := filepath.Join(dir, "api")
+	if _, added, err := reg.Add(repoA, ""); err != nil || !added {
+		t.Fatalf("Add() = %v, %v; want added", added, err)
+	}
+	if _, added, err := reg.Add(repoA, ""); err != nil || added {
+		t.Fatalf("Add() duplicate = %v, %v; want no-op", added, err)
+	}
+	if _, _, err := reg.Add(filepath.Join(dir, "other", "api"), ""); err == nil {
+		t.Fatalf("Add() with clashing name should fail")
+	}
+	if _, _, err := reg.Add(filepath.Join(dir, "other", "api"), "other-api"); err != nil {
+		t.Fatalf("Add() with explicit name: %v", err)
+	}
+	if _, _, err := reg.Add("relative/path", ""); err == nil {
+		t.Fatalf("Add() with relative path should fail")
+	}
+	if err := Save(path, reg); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(loaded.Repos) != 2 || loaded.Repos[0].Name != "api" || loaded.Repos[1].Name != "other-api" {
+		t.Fatalf("Load() repos = %+v", loaded.Repos)
+	}
+	if removed, ok := loaded.Remove("api"); !ok || removed.Path != repoA {
+		t.Fatalf("Remove(name) = %+v, %v", removed, ok)
+	}
+	if _, ok := loaded.Remove(filepath.Join(dir, "other", "api")); !ok {
+		t.Fatalf("Remove(path) should find the repo")
+	}
+	if len(loaded.Repos) != 0 {
+		t.Fatalf("repos left after removal: %+v", loaded.Repos)
+	}
+}
+
+func TestScanFindsRepositories(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{
+		"api/.git",
+		"group/web/.git",
+		"group/web/vendor/nested/.git", // inside a repo: not descended into
+		".cache/hidden/.git",
+		"plain",
+	} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0o755); err != nil {
+			t.Fatalf("mkdir %s: %v", dir, err)
+		}
+	}
+	repos, err := Scan(root)
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	var names []string
+	for _, r := range repos {
+		names = append(names, r.Name)
+	}
+	if strings.Join(names, ",") != "api,group/web" {
+		t.Fatalf("Scan() names = %v, want [api group/web]", names)
+	}
+}
@@ -0,0 +1,430 @@
+// Package config is a read-only view of mgit configuration files for tools
+// that embed mgit's resolution logic. It defines the config types and finds
+// and loads configs exactly like the mgit CLI; writing configs remains the
+// CLI's job.
+package config
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pavelBuzdanov/mgit/pkg/trace"
+)
+
+const CurrentVersion = 1
+
+// RepoConfigRelativePath is where a repository keeps its config.
+const RepoConfigRelativePath = ".mgit/config.json"
+
+type Config struct {
+	// SchemaURL is kept so a "$schema" reference added for editors survives
+	// saves; mgit itself ignores it.
+	SchemaURL string `json:"$schema,omitempty"`
+
+	Version int    `json:"version"`
+	Rules   []Rule `json:"rules"`
+
+	// DefaultKey is used only when no rule matches: a key path, a provider
+	// reference or an ssh-agent identity. Unlike a "*"/"*" rule, resolve and
+	// doctor report its use as a fallback.
+	DefaultKey string `json:"defaultKey,omitempty"`
+
+	// SSHCommand is the ssh client for every rule that doesn't set its own:
+	// a binary with optional arguments, e.g. "/usr/bin/ssh -4" or "plink.exe".
+	SSHCommand string `json:"sshCommand,omitempty"`
+
+	// SSHBinary is the ssh executable used where no sshCommand applies,
+	// instead of whatever "ssh" is first on PATH. MGIT_SSH overrides it.
+	SSHBinary string `json:"sshBinary,omitempty"`
+
+	// Askpass supplies passphrases of encrypted keys that are not in an
+	// agent: an SSH_ASKPASS program, or "prompt" to have mgit ask once per
+	// run on the terminal. MGIT_ASKPASS overrides it.
+	Askpass string `json:"askpass,omitempty"`
+
+	// HostAliases map hosts as written in remote URLs (ssh_config aliases such
+	// as "github-work", internal DNS shortcuts) to the canonical host rules are
+	// written for. Only matching uses the canonical host.
+	HostAliases map[string]string `json:"hostAliases,omitempty"`
+
+	// HostDefaults set the ssh user, port and options per host pattern for
+	// every rule (see HostDefault).
+	HostDefaults []HostDefault `json:"hostDefaults,omitempty"`
+
+	// Stats opts in to recording which rule each mgit exec used (see
+	// RecordUsage). Nothing leaves the machine.
+	Stats bool `json:"stats,omitempty"`
+
+	// Retry is how many times fetch, pull, push and ls-remote are retried
+	// after a transient network error when --retry is not given.
+	Retry int `json:"retry,omitempty"`
+
+	// AllowedGitCommands and DeniedGitCommands restrict what the git
+	// passthrough runs (see CheckGitCommand), e.g. on shared automation
+	// accounts.
+	AllowedGitCommands []string `json:"allowedGitCommands,omitempty"`
+	DeniedGitCommands  []string `json:"deniedGitCommands,omitempty"`
+
+	// RequireKeyTypes lists the key types rules may use, e.g. "ed25519" or
+	// "rsa:3072" for RSA keys of at least 3072 bits (see KeyTypeIssue).
+	RequireKeyTypes []string `json:"requireKeyTypes,omitempty"`
+
+	// Policy refuses git commands against the remotes its entries deny,
+	// before anything runs (see matcher.DeniedBy).
+	Policy []PolicyEntry `json:"policy,omitempty"`
+
+	// ExternalSSHCommand is "override" (the default), "merge" or "respect":
+	// what to do with a GIT_SSH_COMMAND or core.sshCommand set outside mgit
+	// (see ExternalSSHMode).
+	ExternalSSHCommand string `json:"externalSshCommand,omitempty"`
+
+	// Strict refuses SSH remotes that only a catch-all rule or DefaultKey
+	// covers (see resolve.FromRemote), so a work repository without a rule
+	// fails instead of silently using a personal fallback key.
+	Strict bool `json:"strict,omitempty"`
+
+	// Redact masks key paths, user names and private hosts in structured
+	// output, as --redact does, for configs whose output ends up in CI logs.
+	Redact bool `json:"redact,omitempty"`
+
+	// Gitignore is how mgit keeps the .mgit directory of a repo-local config
+	// it creates out of git: gitignore (the default), exclude or off. Set in
+	// the global config, it applies to every repository; --gitignore and
+	// MGIT_GITIGNORE take precedence.
+	Gitignore string `json:"gitignore,omitempty"`
+
+	// RemoteRules is the https:// or file:// URL of a centrally managed rule
+	// set, merged below the local rules (see LoadRemoteRules).
+	RemoteRules string `json:"remoteRules,omitempty"`
+	// RemoteRulesTTL is how long fetched remote rules are used before they
+	// are fetched again, e.g. "12h" or "7d"; 24h when empty.
+	RemoteRulesTTL string `json:"remoteRulesTTL,omitempty"`
+
+	// Pin overrides matching for every SSH remote of the repository this
+	// config belongs to (see PinnedRule). Set with mgit pin.
+	Pin *Pin `json:"pin,omitempty"`
+}
+
+// Pin is a fixed resolution for one repository, for the odd one the rules
+// get wrong: the rule with ID Rule, or Key. Exactly one is set.
+type Pin struct {
+	Rule string `json:"rule,omitempty"`
+	Key  string `json:"key,omitempty"`
+}
+
+type Rule struct {
+	ID       string `json:"id,omitempty"`
+	Host     string `json:"host"`
+	Owner    string `json:"owner"`
+	Key      string `json:"key,omitempty"`
+	Agent    string `json:"agent,omitempty"` // ssh-agent identity: SHA256 fingerprint or public key
+	Priority int    `json:"priority,omitempty"`
+
+	// Remote restricts the rule to git remotes with a matching name (wildcards
+	// allowed, e.g. "fork-*"), so one host/owner can use different keys for
+	// origin and upstream. Plain URLs with no remote name never match it.
+	Remote string `json:"remote,omitempty"`
+
+	// SecurityKeyProvider is passed to ssh as -o SecurityKeyProvider for FIDO2 (sk-) keys:
+	// "internal" or a path to a middleware library.
+	SecurityKeyProvider string `json:"securityKeyProvider,omitempty"`
+
+	// StrictHostKeyChecking (yes, accept-new, ask, no) and KnownHostsFile
+	// become ssh's StrictHostKeyChecking and UserKnownHostsFile for the
+	// rule's remotes, so a sensitive host can be pinned to its own
+	// known_hosts file while a lab host uses accept-new. Unset, ssh's
+	// defaults apply; a KnownHostsFile alone implies "yes".
+	StrictHostKeyChecking string `json:"strictHostKeyChecking,omitempty"`
+	KnownHostsFile        string `json:"knownHostsFile,omitempty"`
+
+	// CreatedAt (RFC 3339) and RotateAfter (e.g. "180d") drive key rotation reminders.
+	CreatedAt   string `json:"createdAt,omitempty"`
+	RotateAfter string `json:"rotateAfter,omitempty"`
+
+	// SigningKey is applied as user.signingkey for commits, tags and merges
+	// made through mgit; SigningFormat maps to gpg.format (ssh|openpgp|x509).
+	SigningKey    string `json:"signingKey,omitempty"`
+	SigningFormat string `json:"signingFormat,omitempty"`
+
+	// Email is the expected author email (wildcards allowed, e.g. *@company.com),
+	// enforced by mgit guard before pushes.
+	Email string `json:"email,omitempty"`
+
+	// Description and Tags are free-form notes for telling similar rules
+	// apart (e.g. which contract a key belongs to); matching ignores them.
+	Description string   `json:"description,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+
+	// SSHCommand overrides the config's ssh client for this rule's remotes.
+	SSHCommand string `json:"sshCommand,omitempty"`
+
+	// Env is added to the environment of git commands run for the rule's
+	// remotes, e.g. GIT_SSL_CAINFO or HTTPS_PROXY for one host.
+	Env map[string]string `json:"env,omitempty"`
+
+	// HTTPSUser and CredentialHelper route HTTPS remotes: they become
+	// credential.<url>.username and credential.<url>.helper for the remote's
+	// host. A rule with either may omit key and agent to serve HTTPS only.
+	HTTPSUser        string `json:"httpsUser,omitempty"`
+	CredentialHelper string `json:"credentialHelper,omitempty"`
+}
+
+// HasTag reports whether the rule carries tag, compared case-insensitively.
+func (r Rule) HasTag(tag string) bool {
+	for _, t := range r.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseTags splits a comma-separated tag list, dropping blanks.
+func ParseTags(s string) []string {
+	var tags []string
+	for _, t := range strings.Split(s, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+// EffectiveSigningFormat returns SigningFormat, defaulting to "ssh" for key
+// paths and literal "key::" values and to "openpgp" for GPG key IDs.
+func (r Rule) EffectiveSigningFormat() string {
+	if r.SigningFormat != "" {
+		return r.SigningFormat
+	}
+	k := r.SigningKey
+	if strings.HasPrefix(k, "key::") || strings.HasPrefix(k, "~") || strings.ContainsAny(k, `/\`) {
+		return "ssh"
+	}
+	return "openpgp"
+}
+
+// EffectiveStrictHostKeyChecking is the StrictHostKeyChecking value ssh gets
+// for the rule: its own setting, "yes" when it pins a KnownHostsFile, else
+// "" for ssh's default.
+func (r Rule) EffectiveStrictHostKeyChecking() string {
+	if r.StrictHostKeyChecking != "" {
+		return r.StrictHostKeyChecking
+	}
+	if r.KnownHostsFile != "" {
+		return "yes"
+	}
+	return ""
+}
+
+// HasHTTPS reports whether the rule carries settings for HTTPS remotes.
+func (r Rule) HasHTTPS() bool {
+	return r.HTTPSUser != "" || r.CredentialHelper != ""
+}
+
+// HasSSH reports whether the rule names an SSH key or agent identity.
+func (r Rule) HasSSH() bool {
+	return r.Key != "" || r.Agent != ""
+}
+
+// CatchAll reports whether r matches every host and owner, e.g. "*"/"*".
+func (r Rule) CatchAll() bool {
+	anything := func(p string) bool { return p == "*" || p == "**" }
+	return anything(r.Host) && anything(r.Owner)
+}
+
+// UsesAgent reports whether the rule selects an ssh-agent identity instead of a key file.
+func (r Rule) UsesAgent() bool {
+	return strings.TrimSpace(r.Agent) != ""
+}
+
+type ValidationIssue struct {
+	Level   string `json:"level"` // error|warning
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+func (c *Config) Normalize() {
+	if c.Version == 0 {
+		c.Version = CurrentVersion
+	}
+	c.DefaultKey = strings.TrimSpace(c.DefaultKey)
+	c.SSHCommand = strings.TrimSpace(c.SSHCommand)
+	c.SSHBinary = strings.TrimSpace(c.SSHBinary)
+	c.Askpass = strings.TrimSpace(c.Askpass)
+	c.RemoteRules = strings.TrimSpace(c.RemoteRules)
+	c.RemoteRulesTTL = strings.TrimSpace(c.RemoteRulesTTL)
+	c.Gitignore = strings.ToLower(strings.TrimSpace(c.Gitignore))
+	if c.Pin != nil {
+		c.Pin.Rule = strings.TrimSpace(c.Pin.Rule)
+		c.Pin.Key = strings.TrimSpace(c.Pin.Key)
+	}
+	for alias, host := range c.HostAliases {
+		delete(c.HostAliases, alias)
+		c.HostAliases[strings.TrimSpace(alias)] = strings.TrimSpace(host)
+	}
+	requireKeyTypes := c.RequireKeyTypes[:0]
+	for _, t := range c.RequireKeyTypes {
+		if t = strings.ToLower(strings.TrimSpace(t)); t != "" {
+			requireKeyTypes = append(requireKeyTypes, t)
+		}
+	}
+	c.RequireKeyTypes = requireKeyTypes
+	if len(c.RequireKeyTypes) == 0 {
+		c.RequireKeyTypes = nil
+	}
+	for i := range c.Policy {
+		c.Policy[i].normalize()
+	}
+	for i := range c.HostDefaults {
+		c.HostDefaults[i].normalize()
+	}
+	for i := range c.Rules {
+		r := &c.Rules[i]
+		r.Host = normalizePattern(r.Host)
+		r.Owner = normalizePattern(r.Owner)
+		r.Remote = strings.TrimSpace(r.Remote)
+		r.Key = strings.TrimSpace(r.Key)
+		r.Agent = strings.TrimSpace(r.Agent)
+		r.SecurityKeyProvider = strings.TrimSpace(r.SecurityKeyProvider)
+		r.StrictHostKeyChecking = strings.ToLower(strings.TrimSpace(r.StrictHostKeyChecking))
+		r.KnownHostsFile = strings.TrimSpace(r.KnownHostsFile)
+		r.SigningKey = strings.TrimSpace(r.SigningKey)
+		r.Email = strings.TrimSpace(r.Email)
+		r.Description = strings.TrimSpace(r.Description)
+		r.SSHCommand = strings.TrimSpace(r.SSHCommand)
+		r.HTTPSUser = strings.TrimSpace(r.HTTPSUser)
+		r.CredentialHelper = strings.TrimSpace(r.CredentialHelper)
+		r.Tags = ParseTags(strings.Join(r.Tags, ","))
+		r.SigningFormat = strings.ToLower(strings.TrimSpace(r.SigningFormat))
+		if r.ID == "" {
+			r.ID = newRuleID()
+		}
+	}
+}
+
+// DefaultKeyRuleID is the ID of the rule synthesized from DefaultKey.
+const DefaultKeyRuleID = "defaultKey"
+
+// PinnedRuleID is the ID of the rule synthesized from a pinned key.
+const PinnedRuleID = "pinned"
+
+func normalizePattern(s string) string {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "*"
+	}
+	return s
+}
+
+// RuleIndex returns the position of the rule with the given ID, or -1.
+func (c *Config) RuleIndex(id string) int {
+	for i, r := range c.Rules {
+		if r.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// SSHBinaryEnv overrides the config's sshBinary.
+const SSHBinaryEnv = "MGIT_SSH"
+
+// SSHBinaryPath is the ssh executable for rules without an sshCommand:
+// MGIT_SSH, else sshBinary, else "" for ssh on PATH.
+func (c *Config) SSHBinaryPath() string {
+	if env := strings.TrimSpace(os.Getenv(SSHBinaryEnv)); env != "" {
+		return env
+	}
+	return c.SSHBinary
+}
+
+// AskpassEnv overrides the config's askpass.
+const AskpassEnv = "MGIT_ASKPASS"
+
+// AskpassPrompt is the askpass value that makes mgit read the passphrase on
+// the terminal itself.
+const AskpassPrompt = "prompt"
+
+// AskpassProgram is how passphrases are supplied: MGIT_ASKPASS, else
+// askpass, else "" to leave it to ssh.
+func (c *Config) AskpassProgram() string {
+	if env := strings.TrimSpace(os.Getenv(AskpassEnv)); env != "" {
+		return env
+	}
+	return c.Askpass
+}
+
+// CanonicalHost returns the host that host is an alias of, compared
+// case-insensitively, or false when host is not an alias.
+func (c *Config) CanonicalHost(host string) (string, bool) {
+	for alias, canonical := range c.HostAliases {
+		if strings.EqualFold(alias, host) {
+			return canonical, true
+		}
+	}
+	return "", false
+}
+
+func newRuleID() string {
+	var b [4]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "rule"
+	}
+	return "r_" + hex.EncodeToString(b[:])
+}
+
+// Find returns the config path mgit uses for a command run in dir: the nearest
+// .mgit/config.json above dir, else the one at the repository root. The file
+// may not exist.
+func Find(dir string) (string, error) {
+	return ResolvePathIn("", dir)
+}
+
+// Load reads and normalizes the config at path. An empty path is resolved
+// like Find for the current working directory.
+func Load(path string) (*Config, error) {
+	resolved, err := ResolvePath(path)
+	if err != nil {
+		return nil, err
+	}
+	if IsEnvSource(resolved) {
+		return LoadEnv()
+	}
+	done := trace.Start("config.load", "path", resolved)
+	data, err := os.ReadFile(resolved)
+	if err != nil {
+		done("error", err.Error())
+		return nil, fmt.Errorf("read config %s: %w", resolved, err)
+	}
+	cfg, err := Parse(resolved, data)
+	if err != nil {
+		done("error", err.Error())
+		return nil, err
+	}
+	done("rules", len(cfg.Rules))
+	return cfg, nil
+}
+
+// Parse decodes and normalizes data, the contents of the config at path.
+func Parse(path string, data []byte) (*Config, error) {
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parse JSON config %s: %w", path, err)
+	}
+	cfg.Normalize()
+	return &cfg, nil
+}
+
+// LoadFrom finds the config for dir and loads it, returning its path.
+func LoadFrom(dir string) (*Config, string, error) {
+	path, err := Find(dir)
+	if err != nil {
+		return nil, "", err
+	}
+	cfg, err := Load(path)
+	return cfg, path, err
+}
@@ -0,0 +1,34 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadFromFindsRepoConfig(t *testing.T) {
+	repo := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(repo, ".mgit"), 0o755); err != nil {
+		t.Fatalf("mkdir .mgit: %v", err)
+	}
+	data := []byte(`{"version":1,"rules":[{"id":"work","host":" github.com ","owner":"Org","key":"~/.ssh/id_work"}]}`)
+	if err := os.WriteFile(filepath.Join(repo, RepoConfigRelativePath), data, 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	sub := filepath.Join(repo, "src", "pkg")
+	if err := os.MkdirAll(sub, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+
+	cfg, path, err := LoadFrom(sub)
+	if err != nil {
+		t.Fatalf("LoadFrom() error = %v", err)
+	}
+	if path != filepath.Join(repo, RepoConfigRelativePath) {
+		t.Fatalf("LoadFrom() path = %s", path)
+	}
+	var rule Rule = cfg.Rules[0]
+	if rule.ID != "work" || rule.Host != "github.com" {
+		t.Fatalf("LoadFrom() rule = %+v, want normalized rule", rule)
+	}
+}
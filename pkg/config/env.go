@@ -0,0 +1,69 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pavelBuzdanov/mgit/pkg/trace"
+)
+
+// EnvSource is the path ResolvePath returns when the config comes from the
+// environment instead of a file: MGIT_RULES holds the rules as a JSON array
+// and MGIT_DEFAULT_KEY the defaultKey. It is selected by setting MGIT_RULES
+// without --config, or with --config env.
+const EnvSource = "env"
+
+// Environment variables of the env config source.
+const (
+	RulesEnv      = "MGIT_RULES"
+	DefaultKeyEnv = "MGIT_DEFAULT_KEY"
+)
+
+// ErrEnvSource is returned when a command would write a config that comes
+// from the environment.
+var ErrEnvSource = errors.New("config comes from " + RulesEnv + " and cannot be changed; set the rules there or use --config PATH")
+
+// IsEnvSource reports whether path is the env config source.
+func IsEnvSource(path string) bool {
+	return path == EnvSource
+}
+
+// DescribePath is path for people: the file, or the variables an env config
+// is read from.
+func DescribePath(path string) string {
+	if IsEnvSource(path) {
+		return EnvSource + " (" + RulesEnv + ", " + DefaultKeyEnv + ")"
+	}
+	return path
+}
+
+// envSelected reports whether MGIT_RULES asks for the env config source.
+func envSelected() bool {
+	return strings.TrimSpace(os.Getenv(RulesEnv)) != ""
+}
+
+// LoadEnv builds the config from MGIT_RULES and MGIT_DEFAULT_KEY. Rules
+// without an ID get env_1, env_2, ... by position, so IDs are the same on
+// every run.
+func LoadEnv() (*Config, error) {
+	done := trace.Start("config.load", "path", EnvSource)
+	cfg := Config{Version: CurrentVersion, Rules: []Rule{}}
+	if raw := strings.TrimSpace(os.Getenv(RulesEnv)); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &cfg.Rules); err != nil {
+			done("error", err.Error())
+			return nil, fmt.Errorf("parse %s: expected a JSON array of rules: %w", RulesEnv, err)
+		}
+	}
+	for i := range cfg.Rules {
+		if strings.TrimSpace(cfg.Rules[i].ID) == "" {
+			cfg.Rules[i].ID = fmt.Sprintf("env_%d", i+1)
+		}
+	}
+	cfg.DefaultKey = os.Getenv(DefaultKeyEnv)
+	cfg.Normalize()
+	done("rules", len(cfg.Rules))
+	return &cfg, nil
+}
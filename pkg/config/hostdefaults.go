@@ -0,0 +1,89 @@
+package config
+
+import (
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// HostDefault sets the ssh user, port and extra -o options for every SSH
+// remote whose host matches Host, so appliances that insist on e.g. user
+// "gerrit" on port 29418 don't need it repeated on each rule. User and Port
+// apply regardless of what the remote URL says.
+type HostDefault struct {
+	Host    string   `json:"host"`
+	User    string   `json:"user,omitempty"`
+	Port    int      `json:"port,omitempty"`
+	Options []string `json:"options,omitempty"`
+}
+
+// HostDefaultsFor merges the hostDefaults entries matching any of hosts (a
+// host and its alias), in config order. As in ssh_config, the first entry to
+// set User or Port wins; options from all matching entries are kept. It
+// returns false when none match.
+func (c *Config) HostDefaultsFor(hosts ...string) (HostDefault, bool) {
+	merged := HostDefault{Host: strings.ToLower(hosts[0])}
+	found := false
+	for _, d := range c.HostDefaults {
+		if !slices.ContainsFunc(hosts, func(host string) bool {
+			ok, err := filepath.Match(strings.ToLower(d.Host), strings.ToLower(host))
+			return err == nil && ok
+		}) {
+			continue
+		}
+		found = true
+		if merged.User == "" {
+			merged.User = d.User
+		}
+		if merged.Port == 0 {
+			merged.Port = d.Port
+		}
+		merged.Options = append(merged.Options, d.Options...)
+	}
+	return merged, found
+}
+
+// SSHOptions returns d as ssh -o options. ssh keeps the first value it sees
+// for an option, so User and Port here override the user and port git passes
+// from the remote URL.
+func (d HostDefault) SSHOptions() []string {
+	var opts []string
+	if d.User != "" {
+		opts = append(opts, "User="+d.User)
+	}
+	if d.Port != 0 {
+		opts = append(opts, "Port="+strconv.Itoa(d.Port))
+	}
+	return append(opts, d.Options...)
+}
+
+// String summarizes what d sets, e.g. "user=gerrit port=29418".
+func (d HostDefault) String() string {
+	var parts []string
+	if d.User != "" {
+		parts = append(parts, "user="+d.User)
+	}
+	if d.Port != 0 {
+		parts = append(parts, "port="+strconv.Itoa(d.Port))
+	}
+	if len(d.Options) > 0 {
+		parts = append(parts, "options="+strings.Join(d.Options, ","))
+	}
+	return strings.Join(parts, " ")
+}
+
+func (d *HostDefault) normalize() {
+	d.Host = normalizePattern(d.Host)
+	d.User = strings.TrimSpace(d.User)
+	options := d.Options[:0]
+	for _, o := range d.Options {
+		if o = strings.TrimSpace(o); o != "" {
+			options = append(options, o)
+		}
+	}
+	d.Options = options
+	if len(d.Options) == 0 {
+		d.Options = nil
+	}
+}
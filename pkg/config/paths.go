@@ -0,0 +1,141 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pavelBuzdanov/mgit/pkg/trace"
+)
+
+func GlobalDefaultPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("determine user config dir: %w", err)
+	}
+	return filepath.Join(dir, "mgit", "config.json"), nil
+}
+
+func DefaultPath() (string, error) {
+	return AutoPath()
+}
+
+func ResolvePath(custom string) (string, error) {
+	return ResolvePathIn(custom, "")
+}
+
+// ResolvePathIn is ResolvePath for a command running in dir instead of the
+// current working directory; an empty dir means the working directory.
+// Without custom, MGIT_RULES selects the environment (EnvSource) over any
+// file.
+func ResolvePathIn(custom, dir string) (string, error) {
+	if IsEnvSource(custom) {
+		return EnvSource, nil
+	}
+	if strings.TrimSpace(custom) == "" && envSelected() {
+		trace.Event("config.resolve", "source", EnvSource, "path", EnvSource)
+		return EnvSource, nil
+	}
+	if strings.TrimSpace(custom) == "" {
+		return AutoPathIn(dir)
+	}
+	return ExpandPath(custom)
+}
+
+func AutoPath() (string, error) {
+	return AutoPathIn("")
+}
+
+func AutoPathIn(dir string) (string, error) {
+	wd := dir
+	if strings.TrimSpace(wd) == "" {
+		var err error
+		if wd, err = os.Getwd(); err != nil {
+			return "", fmt.Errorf("determine current working directory: %w", err)
+		}
+	}
+	if p, ok, err := FindNearestConfig(wd); err == nil && ok {
+		trace.Event("config.resolve", "dir", wd, "source", "nearest", "path", p)
+		return p, nil
+	} else if err != nil {
+		return "", err
+	}
+	if repoRoot, ok, err := FindRepoRoot(wd); err == nil && ok {
+		p := filepath.Join(repoRoot, RepoConfigRelativePath)
+		trace.Event("config.resolve", "dir", wd, "source", "repo-root", "path", p)
+		return p, nil
+	} else if err != nil {
+		return "", err
+	}
+	p := filepath.Join(wd, RepoConfigRelativePath)
+	trace.Event("config.resolve", "dir", wd, "source", "cwd", "path", p)
+	return p, nil
+}
+
+func FindNearestConfig(start string) (string, bool, error) {
+	dir, err := ExpandPath(start)
+	if err != nil {
+		return "", false, err
+	}
+	for {
+		candidate := filepath.Join(dir, RepoConfigRelativePath)
+		if st, err := os.Stat(candidate); err == nil && !st.IsDir() {
+			return candidate, true, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false, nil
+		}
+		dir = parent
+	}
+}
+
+func FindRepoRoot(start string) (string, bool, error) {
+	dir, err := ExpandPath(start)
+	if err != nil {
+		return "", false, err
+	}
+	for {
+		gitMarker := filepath.Join(dir, ".git")
+		if _, err := os.Stat(gitMarker); err == nil {
+			return dir, true, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false, nil
+		}
+		dir = parent
+	}
+}
+
+func ExpandPath(p string) (string, error) {
+	s := strings.TrimSpace(p)
+	if s == "" {
+		return "", errors.New("empty path")
+	}
+	if strings.HasPrefix(s, "~") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("determine home dir: %w", err)
+		}
+		switch s {
+		case "~":
+			s = home
+		default:
+			if strings.HasPrefix(s, "~/") {
+				s = filepath.Join(home, s[2:])
+			}
+		}
+	}
+	s = os.ExpandEnv(s)
+	if !filepath.IsAbs(s) {
+		abs, err := filepath.Abs(s)
+		if err != nil {
+			return "", fmt.Errorf("resolve absolute path: %w", err)
+		}
+		s = abs
+	}
+	return filepath.Clean(s), nil
+}
@@ -0,0 +1,59 @@
+package config
+
+import "strings"
+
+// PolicyEntry is one entry of policy. Deny names the destinations, and
+// optionally the git commands, mgit refuses to run against them, e.g. so a
+// company machine cannot push company code to a personal namespace.
+type PolicyEntry struct {
+	Deny *PolicyMatch `json:"deny"`
+	// Message is added to the error, e.g. to say where to push instead.
+	Message string `json:"message,omitempty"`
+}
+
+// PolicyMatch selects remotes like a rule does: Host and Owner are glob
+// patterns, with "**" spanning nested groups in Owner, and Repo is a glob
+// on the repository name. Empty Owner and Repo match any. Commands are git
+// subcommands, also globs; empty means every command that contacts the
+// remote.
+type PolicyMatch struct {
+	Host     string   `json:"host"`
+	Owner    string   `json:"owner,omitempty"`
+	Repo     string   `json:"repo,omitempty"`
+	Commands []string `json:"commands,omitempty"`
+}
+
+// String describes m, e.g. "host=github.com owner=me commands=push".
+func (m PolicyMatch) String() string {
+	parts := []string{"host=" + m.Host}
+	if m.Owner != "" {
+		parts = append(parts, "owner="+m.Owner)
+	}
+	if m.Repo != "" {
+		parts = append(parts, "repo="+m.Repo)
+	}
+	if len(m.Commands) > 0 {
+		parts = append(parts, "commands="+strings.Join(m.Commands, ","))
+	}
+	return strings.Join(parts, " ")
+}
+
+func (e *PolicyEntry) normalize() {
+	e.Message = strings.TrimSpace(e.Message)
+	if e.Deny == nil {
+		return
+	}
+	e.Deny.Host = normalizePattern(e.Deny.Host)
+	e.Deny.Owner = strings.TrimSpace(e.Deny.Owner)
+	e.Deny.Repo = strings.TrimSuffix(strings.TrimSpace(e.Deny.Repo), ".git")
+	commands := e.Deny.Commands[:0]
+	for _, c := range e.Deny.Commands {
+		if c = strings.TrimSpace(c); c != "" {
+			commands = append(commands, c)
+		}
+	}
+	e.Deny.Commands = commands
+	if len(e.Deny.Commands) == 0 {
+		e.Deny.Commands = nil
+	}
+}
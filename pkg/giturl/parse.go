@@ -1,3 +1,5 @@
+// Package giturl parses git remote URLs (scp-like SSH, ssh:// and https://)
+// into host, owner and repository parts.
 package giturl
 
 import (
@@ -7,6 +9,8 @@ import (
 	"path"
 	"regexp"
 	"strings"
+
+	"github.com/pavelBuzdanov/mgit/pkg/trace"
 )
 
 var scpLikeRe = regexp.MustCompile(`^(?:(?P<user>[^@]+)@)?(?P<host>[^:]+):(?P<path>.+)$`)
@@ -20,16 +24,24 @@ const (
 )
 
 type ParsedRemote struct {
-	Original   string    `json:"original"`
-	Transport  Transport `json:"transport"`
-	Scheme     string    `json:"scheme,omitempty"`
-	User       string    `json:"user,omitempty"`
-	Host       string    `json:"host"`
-	Port       string    `json:"port,omitempty"`
-	Owner      string    `json:"owner,omitempty"` // May contain nested namespaces, e.g. Group/subgroup
-	Repo       string    `json:"repo,omitempty"`
-	RawPath    string    `json:"rawPath,omitempty"`
-	IsRemoteURL bool     `json:"isRemoteURL"`
+	Original    string    `json:"original"`
+	Transport   Transport `json:"transport"`
+	Scheme      string    `json:"scheme,omitempty"`
+	User        string    `json:"user,omitempty"`
+	Host        string    `json:"host"`
+	Port        string    `json:"port,omitempty"`
+	Owner       string    `json:"owner,omitempty"` // May contain nested namespaces, e.g. Group/subgroup
+	Repo        string    `json:"repo,omitempty"`
+	RawPath     string    `json:"rawPath,omitempty"`
+	IsRemoteURL bool      `json:"isRemoteURL"`
+
+	// Remote is the name of the git remote the URL was read from, when known.
+	// Parse never sets it; callers do, for rules conditioned on remote names.
+	Remote string `json:"remote,omitempty"`
+
+	// Alias is the host as written in the URL when a config host alias mapped
+	// it to the canonical Host used for matching. ssh still connects to Alias.
+	Alias string `json:"alias,omitempty"`
 }
 
 func (p ParsedRemote) IsSSH() bool {
@@ -40,12 +52,20 @@ func (p ParsedRemote) IsHTTPS() bool {
 	return p.Transport == TransportHTTPS
 }
 
+// Address is the host git connects to: Alias when set, else Host.
+func (p ParsedRemote) Address() string {
+	if p.Alias != "" {
+		return p.Alias
+	}
+	return p.Host
+}
+
 func (p ParsedRemote) TargetUserHost() string {
 	user := p.User
 	if user == "" {
 		user = "git"
 	}
-	return user + "@" + p.Host
+	return user + "@" + p.Address()
 }
 
 func Parse(input string) (*ParsedRemote, error) {
@@ -54,10 +74,19 @@ func Parse(input string) (*ParsedRemote, error) {
 		return nil, errors.New("empty URL")
 	}
 
+	var p *ParsedRemote
+	var err error
 	if strings.Contains(s, "://") {
-		return parseURL(s)
+		p, err = parseURL(s)
+	} else {
+		p, err = parseSCPLike(s)
+	}
+	if err != nil {
+		trace.Event("url.parse", "url", s, "error", err.Error())
+		return nil, err
 	}
-	return parseSCPLike(s)
+	trace.Event("url.parse", "url", s, "transport", string(p.Transport), "host", p.Host, "owner", p.Owner, "repo", p.Repo)
+	return p, nil
 }
 
 func IsLikelyRemoteURL(s string) bool {
@@ -81,21 +110,25 @@ func parseURL(raw string) (*ParsedRemote, error) {
 		return nil, fmt.Errorf("parse repository path: %w", err)
 	}
 	out := &ParsedRemote{
-		Original:   raw,
-		Scheme:     strings.ToLower(u.Scheme),
-		Host:       host,
-		Port:       u.Port(),
-		User:       "",
-		Owner:      owner,
-		Repo:       repo,
-		RawPath:    cleanPath,
+		Original:    raw,
+		Scheme:      strings.ToLower(u.Scheme),
+		Host:        host,
+		Port:        u.Port(),
+		User:        "",
+		Owner:       owner,
+		Repo:        repo,
+		RawPath:     cleanPath,
 		IsRemoteURL: true,
-		Transport:  TransportOther,
+		Transport:   TransportOther,
 	}
 	if u.User != nil {
 		out.User = u.User.Username()
 	}
-	switch strings.ToLower(u.Scheme) {
+	switch out.Scheme {
+	case "git+ssh", "ssh+git":
+		// Legacy spellings git still accepts; treat them as plain ssh.
+		out.Scheme = "ssh"
+		out.Transport = TransportSSH
 	case "ssh":
 		out.Transport = TransportSSH
 	case "https":
@@ -123,14 +156,14 @@ func parseSCPLike(raw string) (*ParsedRemote, error) {
 		return nil, fmt.Errorf("parse repository path: %w", err)
 	}
 	return &ParsedRemote{
-		Original:   raw,
-		Transport:  TransportSSH,
-		Scheme:     "ssh",
-		User:       user,
-		Host:       host,
-		Owner:      owner,
-		Repo:       repo,
-		RawPath:    cleanPath,
+		Original:    raw,
+		Transport:   TransportSSH,
+		Scheme:      "ssh",
+		User:        user,
+		Host:        host,
+		Owner:       owner,
+		Repo:        repo,
+		RawPath:     cleanPath,
 		IsRemoteURL: true,
 	}, nil
 }
@@ -0,0 +1,54 @@
+package giturl
+
+import (
+	"regexp"
+	"strings"
+)
+
+// mask replaces credentials in printed URLs.
+const mask = "***"
+
+// userinfoRE matches the scheme and userinfo of each URL in a text. The
+// userinfo stops at the first character that cannot appear in it unescaped,
+// so a path or query containing @ is left alone.
+var userinfoRE = regexp.MustCompile(`([A-Za-z][A-Za-z0-9+.-]*://)([^/?#@\s"'<>]+)@`)
+
+// Redact hides credentials in every URL in s, e.g. in a URL, an error
+// message or a logged command line. Passwords become ***; so does a
+// username without a password on non-SSH URLs, since tokens are often
+// passed that way (https://<token>@github.com/...). SSH usernames are kept.
+func Redact(s string) string {
+	if !strings.Contains(s, "://") {
+		return s
+	}
+	return userinfoRE.ReplaceAllStringFunc(s, func(m string) string {
+		sub := userinfoRE.FindStringSubmatch(m)
+		scheme, userinfo := sub[1], sub[2]
+		user, _, hasPassword := strings.Cut(userinfo, ":")
+		switch {
+		case hasPassword:
+			return scheme + user + ":" + mask + "@"
+		case isSSHScheme(strings.TrimSuffix(scheme, "://")):
+			return m
+		}
+		return scheme + mask + "@"
+	})
+}
+
+// Redacted returns p with credentials hidden for printing: Original goes
+// through Redact and User is masked on non-SSH remotes.
+func (p ParsedRemote) Redacted() ParsedRemote {
+	p.Original = Redact(p.Original)
+	if p.User != "" && !p.IsSSH() {
+		p.User = mask
+	}
+	return p
+}
+
+func isSSHScheme(scheme string) bool {
+	switch strings.ToLower(scheme) {
+	case "ssh", "git+ssh", "ssh+git":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,37 @@
+package giturl
+
+import "strings"
+
+// IsRelative reports whether raw is a submodule URL relative to the
+// superproject's remote, such as ../lib.git or ./tools.
+func IsRelative(raw string) bool {
+	return strings.HasPrefix(raw, "./") || strings.HasPrefix(raw, "../")
+}
+
+// JoinRelative resolves a relative submodule URL against the superproject's
+// remote URL the way git submodule does: each ../ drops one path component
+// of base, including the path after an scp-style colon.
+func JoinRelative(base, rel string) string {
+	base = strings.TrimSuffix(base, "/")
+	sep := "/"
+	for {
+		switch {
+		case strings.HasPrefix(rel, "./"):
+			rel = rel[2:]
+			continue
+		case strings.HasPrefix(rel, "../"):
+			rel = rel[3:]
+			i := strings.LastIndexAny(base, "/:")
+			if i < 0 || strings.HasSuffix(base[:i], "/") {
+				// Nothing left to drop but the host.
+				continue
+			}
+			if base[i] == ':' {
+				sep = ":"
+			}
+			base = base[:i]
+			continue
+		}
+		return base + sep + rel
+	}
+}
@@ -0,0 +1,134 @@
+package matcher
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/pavelBuzdanov/mgit/pkg/config"
+	"github.com/pavelBuzdanov/mgit/pkg/giturl"
+)
+
+// Ambiguity is a pair of rules that tie for the best score on a concrete
+// remote, so only their order in the config decides between them.
+type Ambiguity struct {
+	Winner config.Rule `json:"winner"`
+	Loser  config.Rule `json:"loser"`
+	Index  int         `json:"index"` // position of Loser in the rules
+	Host   string      `json:"host"`
+	Owner  string      `json:"owner"`
+	Remote string      `json:"remote,omitempty"`
+	Score  int         `json:"score"`
+}
+
+// Ambiguities probes each host named literally in rules with owners and
+// remote names built from the rules that apply to it (wildcards filled in
+// with each other's samples) and reports each pair of rules that tie there.
+// Pairs with the same host, owner, remote and priority are left to config
+// validation, which already warns about them.
+func Ambiguities(rules []config.Rule) []Ambiguity {
+	var hosts []string
+	for _, r := range rules {
+		host := strings.ToLower(normalizePattern(r.Host))
+		if !hasWildcard(host) && !slices.Contains(hosts, host) {
+			hosts = append(hosts, host)
+		}
+	}
+
+	var out []Ambiguity
+	reported := map[[2]int]bool{}
+	for _, host := range hosts {
+		var ownerPatterns, remotePatterns []string
+		for _, r := range rules {
+			if ok, _ := globMatch(strings.ToLower(normalizePattern(r.Host)), host); ok {
+				ownerPatterns = append(ownerPatterns, strings.ToLower(normalizePattern(r.Owner)))
+				if r.Remote != "" {
+					remotePatterns = append(remotePatterns, r.Remote)
+				}
+			}
+		}
+		owners := probeValues(ownerPatterns)
+		remotes := append([]string{""}, probeValues(remotePatterns)...)
+		for _, owner := range owners {
+			for _, remote := range remotes {
+				probe := &giturl.ParsedRemote{Host: host, Owner: owner, Remote: remote}
+				winner, best := -1, 0
+				matched := make([]bool, len(rules))
+				scores := make([]int, len(rules))
+				for i, r := range rules {
+					matched[i], scores[i] = matchRule(r, probe)
+					if !matched[i] {
+						continue
+					}
+					if winner < 0 || scores[i] > best {
+						winner, best = i, scores[i]
+					}
+				}
+				for i := winner + 1; winner >= 0 && i < len(rules); i++ {
+					if !matched[i] || scores[i] != best || reported[[2]int{winner, i}] || samePatterns(rules[winner], rules[i]) {
+						continue
+					}
+					reported[[2]int{winner, i}] = true
+					out = append(out, Ambiguity{Winner: rules[winner], Loser: rules[i], Index: i, Host: host, Owner: owner, Remote: remote, Score: best})
+				}
+			}
+		}
+	}
+	return out
+}
+
+// probeValues returns values matched by the patterns: each pattern with its
+// wildcards filled in by "x" and by every other pattern's sample, so that
+// e.g. "comp*" and "*org" meet at "compxorg". Character classes are skipped.
+func probeValues(patterns []string) []string {
+	var samples, out []string
+	for _, p := range patterns {
+		if p != "*" && !strings.Contains(p, "[") {
+			samples = append(samples, fillWildcards(p, "x"))
+		}
+	}
+	add := func(v string) {
+		if !slices.Contains(out, v) {
+			out = append(out, v)
+		}
+	}
+	for _, v := range samples {
+		add(v)
+	}
+	for _, p := range patterns {
+		if p == "*" || strings.Contains(p, "[") || !hasWildcard(p) {
+			continue
+		}
+		for _, fill := range samples {
+			add(fillWildcards(p, fill))
+		}
+	}
+	return out
+}
+
+func fillWildcards(pattern, fill string) string {
+	pattern = strings.ReplaceAll(pattern, "**", fill)
+	pattern = strings.ReplaceAll(pattern, "*", fill)
+	return strings.ReplaceAll(pattern, "?", "x")
+}
+
+// AmbiguityIssues reports Ambiguities as config validation warnings.
+func AmbiguityIssues(rules []config.Rule) []config.ValidationIssue {
+	var issues []config.ValidationIssue
+	for _, a := range Ambiguities(rules) {
+		target := a.Host + "/" + a.Owner
+		if a.Remote != "" {
+			target += " (remote " + a.Remote + ")"
+		}
+		issues = append(issues, config.ValidationIssue{
+			Level:   "warning",
+			Field:   fmt.Sprintf("rules[%d]", a.Index),
+			Message: fmt.Sprintf("ties with rule id=%s for %s and loses only because it is listed later (set priority to decide)", a.Winner.ID, target),
+		})
+	}
+	return issues
+}
+
+func samePatterns(a, b config.Rule) bool {
+	return strings.EqualFold(a.Host, b.Host) && strings.EqualFold(a.Owner, b.Owner) && a.Remote == b.Remote && a.Priority == b.Priority
+}
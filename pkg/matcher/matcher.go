@@ -0,0 +1,258 @@
+// Package matcher picks the config rule for a parsed remote: wildcards are
+// allowed in host and owner, and the most specific, highest-priority rule wins.
+// A "**" owner segment spans nested groups, e.g. "platform/**".
+package matcher
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/pavelBuzdanov/mgit/pkg/config"
+	"github.com/pavelBuzdanov/mgit/pkg/giturl"
+	"github.com/pavelBuzdanov/mgit/pkg/trace"
+)
+
+type MatchResult struct {
+	Rule  config.Rule `json:"rule"`
+	Score int         `json:"score"`
+	Index int         `json:"index"`
+
+	// Tied lists the IDs of other rules that scored the same as Rule. Ties
+	// always go to the rule listed first in the config.
+	Tied []string `json:"tied,omitempty"`
+}
+
+// Candidate is how one rule fared against a remote: its score when it
+// matched, and otherwise or when it lost, the reason.
+type Candidate struct {
+	Index    int    `json:"index"`
+	ID       string `json:"id"`
+	Host     string `json:"host"`
+	Owner    string `json:"owner"`
+	Remote   string `json:"remote,omitempty"`
+	Priority int    `json:"priority,omitempty"`
+	Matched  bool   `json:"matched"`
+	Score    int    `json:"score,omitempty"`
+	Selected bool   `json:"selected,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// ErrNoMatch is returned by Match when no rule matches the remote.
+var ErrNoMatch = errors.New("no SSH key rule matched")
+
+func Match(rules []config.Rule, remote *giturl.ParsedRemote) (*MatchResult, error) {
+	candidates, err := Explain(rules, remote)
+	if err != nil {
+		return nil, err
+	}
+	var best *MatchResult
+	for _, c := range candidates {
+		if c.Selected {
+			best = &MatchResult{Rule: rules[c.Index], Score: c.Score, Index: c.Index}
+		}
+	}
+	if best == nil {
+		trace.Event("match.result", "host", remote.Host, "owner", remote.Owner, "matched", false)
+		return nil, fmt.Errorf(
+			"%w (host=%s, owner=%s)",
+			ErrNoMatch,
+			remote.Host,
+			remote.Owner,
+		)
+	}
+	for _, c := range candidates {
+		if c.Matched && !c.Selected && c.Score == best.Score {
+			best.Tied = append(best.Tied, c.ID)
+		}
+	}
+	trace.Event("match.result", "host", remote.Host, "owner", remote.Owner, "matched", true, "id", best.Rule.ID, "index", best.Index, "score", best.Score)
+	return best, nil
+}
+
+// Explain scores every rule against remote the way Match does and returns
+// one Candidate per rule, in config order, with the winner Selected.
+func Explain(rules []config.Rule, remote *giturl.ParsedRemote) ([]Candidate, error) {
+	if remote == nil {
+		return nil, fmt.Errorf("nil parsed remote")
+	}
+	if remote.Host == "" {
+		return nil, fmt.Errorf("parsed remote host is empty")
+	}
+	candidates := make([]Candidate, len(rules))
+	best := -1
+	for i, r := range rules {
+		score, reason := scoreRule(r, remote)
+		trace.Event("match.rule", "index", i, "id", r.ID, "host", r.Host, "owner", r.Owner, "matched", reason == "", "score", score)
+		candidates[i] = NewCandidate(i, r)
+		candidates[i].Matched = reason == ""
+		candidates[i].Reason = reason
+		if !candidates[i].Matched {
+			continue
+		}
+		candidates[i].Score = score
+		if best < 0 || score > candidates[best].Score {
+			best = i
+		}
+	}
+	if best < 0 {
+		return candidates, nil
+	}
+	winner := &candidates[best]
+	winner.Selected = true
+	for i := range candidates {
+		c := &candidates[i]
+		switch {
+		case !c.Matched || c.Selected:
+		case c.Score == winner.Score:
+			c.Reason = fmt.Sprintf("ties with rule %s, which is listed first", winner.ID)
+		default:
+			c.Reason = fmt.Sprintf("lower score than rule %s (%d)", winner.ID, winner.Score)
+		}
+	}
+	return candidates, nil
+}
+
+// MatchesHost reports whether r's host pattern matches host, whatever the
+// owner. It is for callers that only see the host, such as an ssh
+// connection.
+func MatchesHost(r config.Rule, host string) bool {
+	ok, err := globMatch(normalizePattern(strings.ToLower(r.Host)), strings.ToLower(host))
+	return err == nil && ok
+}
+
+// NewCandidate describes rule r at index i, before it is scored.
+func NewCandidate(i int, r config.Rule) Candidate {
+	return Candidate{Index: i, ID: r.ID, Host: r.Host, Owner: r.Owner, Remote: r.Remote, Priority: r.Priority}
+}
+
+func matchRule(r config.Rule, remote *giturl.ParsedRemote) (bool, int) {
+	score, reason := scoreRule(r, remote)
+	return reason == "", score
+}
+
+// scoreRule returns the rule's score for remote, or why it doesn't match.
+func scoreRule(r config.Rule, remote *giturl.ParsedRemote) (int, string) {
+	hostPattern := normalizePattern(strings.ToLower(r.Host))
+	ownerPattern := normalizePattern(strings.ToLower(r.Owner))
+	hostValue := strings.ToLower(remote.Host)
+	ownerValue := strings.ToLower(remote.Owner)
+
+	if ok, err := globMatch(hostPattern, hostValue); err != nil {
+		return 0, fmt.Sprintf("invalid host pattern %q", r.Host)
+	} else if !ok {
+		return 0, fmt.Sprintf("host %s does not match %s", remote.Host, r.Host)
+	}
+	if ok, err := globMatch(ownerPattern, ownerValue); err != nil {
+		return 0, fmt.Sprintf("invalid owner pattern %q", r.Owner)
+	} else if !ok {
+		return 0, fmt.Sprintf("owner %s does not match %s", remote.Owner, r.Owner)
+	}
+	score := r.Priority * 1000
+	score += specificityScore(hostPattern, hostValue)
+	score += specificityScore(ownerPattern, ownerValue)
+	score += literalChars(hostPattern) + literalChars(ownerPattern)
+	if r.Remote != "" {
+		// A remote condition only ever narrows a rule, so it scores like a
+		// third dimension and beats the same host/owner without one.
+		if remote.Remote == "" {
+			return 0, fmt.Sprintf("rule needs remote %s; a plain URL has no remote name", r.Remote)
+		}
+		if ok, err := filepath.Match(r.Remote, remote.Remote); err != nil {
+			return 0, fmt.Sprintf("invalid remote pattern %q", r.Remote)
+		} else if !ok {
+			return 0, fmt.Sprintf("remote %s does not match %s", remote.Remote, r.Remote)
+		}
+		score += specificityScore(r.Remote, remote.Remote) + literalChars(r.Remote)
+	}
+	return score, ""
+}
+
+// globMatch matches a slash-separated value such as a nested GitLab owner
+// segment by segment. A "**" segment matches any number of segments, none
+// included, so "platform/**" covers platform and every group below it; other
+// segments follow filepath.Match. A bare "*" matches any value.
+func globMatch(pattern, value string) (bool, error) {
+	if pattern == "*" {
+		return true, nil
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(value, "/"))
+}
+
+func matchSegments(pattern, value []string) (bool, error) {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for len(pattern) > 0 && pattern[0] == "**" {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true, nil
+			}
+			for i := range value {
+				if ok, err := matchSegments(pattern, value[i:]); ok || err != nil {
+					return ok, err
+				}
+			}
+			return false, nil
+		}
+		if len(value) == 0 {
+			return false, nil
+		}
+		if ok, err := filepath.Match(pattern[0], value[0]); !ok || err != nil {
+			return false, err
+		}
+		pattern, value = pattern[1:], value[1:]
+	}
+	return len(value) == 0, nil
+}
+
+func specificityScore(pattern, value string) int {
+	if pattern == "*" {
+		return 0
+	}
+	if !hasWildcard(pattern) && strings.EqualFold(pattern, value) {
+		return 400
+	}
+	if !hasWildcard(pattern) {
+		return 300
+	}
+	// Among wildcard patterns a deeper literal prefix wins ("a/b/**" over
+	// "a/*"), then "*" over "**" at the same depth.
+	score := 100
+	for _, seg := range strings.Split(pattern, "/") {
+		if hasWildcard(seg) {
+			if seg == "**" {
+				score -= 5
+			}
+			break
+		}
+		score += 10
+	}
+	return score
+}
+
+func literalChars(pattern string) int {
+	n := 0
+	for _, r := range pattern {
+		switch r {
+		case '*', '?', '[', ']':
+			continue
+		default:
+			n++
+		}
+	}
+	return n
+}
+
+func hasWildcard(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+func normalizePattern(s string) string {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "*"
+	}
+	return s
+}
@@ -0,0 +1,202 @@
+package matcher
+
+import (
+	"testing"
+
+	"github.com/pavelBuzdanov/mgit/pkg/config"
+	"github.com/pavelBuzdanov/mgit/pkg/giturl"
+)
+
+func mustParse(t *testing.T, s string) *giturl.ParsedRemote {
+	t.Helper()
+	p, err := giturl.Parse(s)
+	if err != nil {
+		t.Fatalf("parse %q: %v", s, err)
+	}
+	return p
+}
+
+func TestMatchPrefersSpecificOwnerOverWildcard(t *testing.T) {
+	parsed := mustParse(t, "git@github.com:CompanyOrg/proj.git")
+	rules := []config.Rule{
+		{ID: "wild", Host: "github.com", Owner: "*", Key: "/k/default"},
+		{ID: "spec", Host: "github.com", Owner: "CompanyOrg", Key: "/k/work"},
+	}
+	got, err := Match(rules, parsed)
+	if err != nil {
+		t.Fatalf("Match() error = %v", err)
+	}
+	if got.Rule.ID != "spec" {
+		t.Fatalf("expected specific rule, got %s", got.Rule.ID)
+	}
+}
+
+func TestMatchSupportsDefaultFallback(t *testing.T) {
+	parsed := mustParse(t, "git@gitlab.com:AnotherOrg/repo.git")
+	rules := []config.Rule{
+		{ID: "default", Host: "*", Owner: "*", Key: "/k/default"},
+	}
+	got, err := Match(rules, parsed)
+	if err != nil {
+		t.Fatalf("Match() error = %v", err)
+	}
+	if got.Rule.ID != "default" {
+		t.Fatalf("unexpected rule: %+v", got.Rule)
+	}
+}
+
+func TestMatchNoRule(t *testing.T) {
+	parsed := mustParse(t, "git@github.com:CompanyOrg/proj.git")
+	if _, err := Match(nil, parsed); err == nil {
+		t.Fatalf("expected no-match error")
+	}
+}
+
+func TestMatchDoubleStarCoversNestedGroups(t *testing.T) {
+	rules := []config.Rule{
+		{ID: "platform", Host: "gitlab.com", Owner: "platform/**", Key: "/k/platform"},
+		{ID: "team", Host: "gitlab.com", Owner: "platform/team/**", Key: "/k/team"},
+		{ID: "one", Host: "gitlab.com", Owner: "platform/*", Key: "/k/one"},
+	}
+	for _, tc := range []struct{ url, want string }{
+		{"git@gitlab.com:platform/repo.git", "platform"},
+		{"git@gitlab.com:platform/infra/repo.git", "one"},
+		{"git@gitlab.com:platform/infra/db/repo.git", "platform"},
+		{"git@gitlab.com:platform/team/repo.git", "team"},
+		{"git@gitlab.com:platform/team/subteam/deep/repo.git", "team"},
+	} {
+		got, err := Match(rules, mustParse(t, tc.url))
+		if err != nil {
+			t.Fatalf("Match(%s) error = %v", tc.url, err)
+		}
+		if got.Rule.ID != tc.want {
+			t.Errorf("Match(%s) = %s, want %s", tc.url, got.Rule.ID, tc.want)
+		}
+	}
+	if _, err := Match(rules, mustParse(t, "git@gitlab.com:platformx/repo.git")); err == nil {
+		t.Error("platform/** matched platformx")
+	}
+}
+
+func TestGlobMatch(t *testing.T) {
+	for _, tc := range []struct {
+		pattern, value string
+		want           bool
+	}{
+		{"*", "a/b/c", true},
+		{"a/*", "a/b/c", false},
+		{"a/**/c", "a/c", true},
+		{"a/**/c", "a/b/x/c", true},
+		{"a/**/c", "a/b/x", false},
+		{"**/deploy", "x/y/deploy", true},
+		{"a/b", "a/b", true},
+	} {
+		if got, _ := globMatch(tc.pattern, tc.value); got != tc.want {
+			t.Errorf("globMatch(%q, %q) = %v, want %v", tc.pattern, tc.value, got, tc.want)
+		}
+	}
+}
+
+func TestMatchRemoteCondition(t *testing.T) {
+	rules := []config.Rule{
+		{ID: "fork", Host: "github.com", Owner: "CompanyOrg", Key: "/k/personal"},
+		{ID: "upstream", Host: "github.com", Owner: "CompanyOrg", Remote: "upstream", Key: "/k/readonly"},
+		{ID: "forks", Host: "github.com", Owner: "*", Remote: "fork-*", Key: "/k/forks"},
+	}
+	for _, tc := range []struct{ remote, url, want string }{
+		{"upstream", "git@github.com:CompanyOrg/proj.git", "upstream"},
+		{"origin", "git@github.com:CompanyOrg/proj.git", "fork"},
+		{"", "git@github.com:CompanyOrg/proj.git", "fork"},
+		{"fork-alice", "git@github.com:alice/proj.git", "forks"},
+	} {
+		parsed := mustParse(t, tc.url)
+		parsed.Remote = tc.remote
+		got, err := Match(rules, parsed)
+		if err != nil {
+			t.Fatalf("Match(%s, %s) error = %v", tc.remote, tc.url, err)
+		}
+		if got.Rule.ID != tc.want {
+			t.Errorf("Match(%s, %s) = %s, want %s", tc.remote, tc.url, got.Rule.ID, tc.want)
+		}
+	}
+	if _, err := Match(rules, mustParse(t, "git@github.com:alice/proj.git")); err == nil {
+		t.Error("remote-conditioned rule matched a plain URL")
+	}
+}
+
+func TestMatchTiesGoToFirstRule(t *testing.T) {
+	rules := []config.Rule{
+		{ID: "comp", Host: "github.com", Owner: "Comp*", Key: "/k/a"},
+		{ID: "org", Host: "github.com", Owner: "*pOrg", Key: "/k/b"},
+	}
+	got, err := Match(rules, mustParse(t, "git@github.com:CompOrg/proj.git"))
+	if err != nil {
+		t.Fatalf("Match() error = %v", err)
+	}
+	if got.Rule.ID != "comp" || len(got.Tied) != 1 || got.Tied[0] != "org" {
+		t.Fatalf("Match() = %s tied=%v, want comp tied with org", got.Rule.ID, got.Tied)
+	}
+}
+
+func TestAmbiguities(t *testing.T) {
+	rules := []config.Rule{
+		{ID: "comp", Host: "github.com", Owner: "Comp*", Key: "/k/a"},
+		{ID: "org", Host: "github.com", Owner: "*pOrg", Key: "/k/b"},
+		{ID: "exact", Host: "github.com", Owner: "CompanyOrg", Key: "/k/c"},
+		{ID: "prio", Host: "gitlab.com", Owner: "team/*", Key: "/k/d", Priority: 1},
+		{ID: "other", Host: "gitlab.com", Owner: "*/app", Key: "/k/e"},
+	}
+	got := Ambiguities(rules)
+	if len(got) != 1 {
+		t.Fatalf("Ambiguities() = %+v, want one pair", got)
+	}
+	if a := got[0]; a.Winner.ID != "comp" || a.Loser.ID != "org" || a.Index != 1 || a.Host != "github.com" {
+		t.Fatalf("Ambiguities()[0] = %+v, want comp over org on github.com", a)
+	}
+}
+
+func TestExplainGivesReasons(t *testing.T) {
+	rules := []config.Rule{
+		{ID: "gitlab", Host: "gitlab.com", Owner: "*", Key: "/k/a"},
+		{ID: "wild", Host: "github.com", Owner: "*", Key: "/k/b"},
+		{ID: "spec", Host: "github.com", Owner: "CompanyOrg", Key: "/k/c"},
+		{ID: "up", Host: "github.com", Owner: "*", Remote: "upstream", Key: "/k/d"},
+	}
+	got, err := Explain(rules, mustParse(t, "git@github.com:CompanyOrg/proj.git"))
+	if err != nil {
+		t.Fatalf("Explain() error = %v", err)
+	}
+	want := []string{
+		"host github.com does not match gitlab.com",
+		"lower score than rule spec (820)",
+		"",
+		"rule needs remote upstream; a plain URL has no remote name",
+	}
+	for i, c := range got {
+		if c.Reason != want[i] || c.Selected != (c.ID == "spec") {
+			t.Errorf("candidate %d = %+v, want reason %q", i, c, want[i])
+		}
+	}
+}
+
+func TestDeniedBy(t *testing.T) {
+	policy := []config.PolicyEntry{
+		{Deny: &config.PolicyMatch{Host: "github.com", Owner: "MyPersonalUser", Commands: []string{"push"}}},
+		{Deny: &config.PolicyMatch{Host: "*.example.com", Owner: "archive/**", Repo: "legacy-*"}},
+	}
+	for _, tc := range []struct {
+		url, command string
+		want         int
+	}{
+		{"git@github.com:mypersonaluser/notes.git", "push", 0},
+		{"git@github.com:MyPersonalUser/notes.git", "fetch", -1},
+		{"git@github.com:CompanyOrg/notes.git", "push", -1},
+		{"git@git.example.com:archive/2019/legacy-app.git", "fetch", 1},
+		{"git@git.example.com:archive/legacy-app.git", "push", 1},
+		{"git@git.example.com:archive/app.git", "push", -1},
+	} {
+		if got := DeniedBy(policy, mustParse(t, tc.url), tc.command); got != tc.want {
+			t.Errorf("DeniedBy(%s, %s) = %d, want %d", tc.url, tc.command, got, tc.want)
+		}
+	}
+}
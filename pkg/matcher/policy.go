@@ -0,0 +1,44 @@
+package matcher
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/pavelBuzdanov/mgit/pkg/config"
+	"github.com/pavelBuzdanov/mgit/pkg/giturl"
+)
+
+// DeniedBy returns the index of the first policy entry that denies running
+// the git subcommand command against remote, or -1. Host and owner match as
+// in rules, case-insensitively; commands and repo follow filepath.Match.
+func DeniedBy(policy []config.PolicyEntry, remote *giturl.ParsedRemote, command string) int {
+	for i, e := range policy {
+		if e.Deny != nil && policyMatches(*e.Deny, remote, command) {
+			return i
+		}
+	}
+	return -1
+}
+
+func policyMatches(m config.PolicyMatch, remote *giturl.ParsedRemote, command string) bool {
+	if ok, err := globMatch(normalizePattern(strings.ToLower(m.Host)), strings.ToLower(remote.Host)); !ok || err != nil {
+		return false
+	}
+	if ok, err := globMatch(normalizePattern(strings.ToLower(m.Owner)), strings.ToLower(remote.Owner)); !ok || err != nil {
+		return false
+	}
+	if m.Repo != "" {
+		if ok, err := filepath.Match(strings.ToLower(m.Repo), strings.ToLower(remote.Repo)); !ok || err != nil {
+			return false
+		}
+	}
+	if len(m.Commands) == 0 {
+		return true
+	}
+	for _, c := range m.Commands {
+		if ok, err := filepath.Match(c, command); ok && err == nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+package resolve_test
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/pavelBuzdanov/mgit/pkg/config"
+	"github.com/pavelBuzdanov/mgit/pkg/matcher"
+	"github.com/pavelBuzdanov/mgit/pkg/resolve"
+)
+
+func ExampleFromURL() {
+	cfg := &config.Config{Version: 1, Rules: []config.Rule{
+		{ID: "work", Host: "github.com", Owner: "CompanyOrg", Key: "/keys/id_work"},
+		{ID: "fallback", Host: "*", Owner: "*", Key: "/keys/id_personal"},
+	}}
+	res, err := resolve.FromURL(cfg, "git@github.com:CompanyOrg/api.git")
+	if err != nil {
+		fmt.Println("error:", err)
+		return
+	}
+	fmt.Println(res.MatchedRule.ID, res.KeyPath)
+	// Output: work /keys/id_work
+}
+
+func ExampleFromURL_defaultKey() {
+	cfg := &config.Config{Version: 1, DefaultKey: "/keys/id_personal", Rules: []config.Rule{
+		{ID: "work", Host: "github.com", Owner: "CompanyOrg", Key: "/keys/id_work"},
+	}}
+	res, err := resolve.FromURL(cfg, "git@gitlab.com:someone/dotfiles.git")
+	if err != nil {
+		fmt.Println("error:", err)
+		return
+	}
+	fmt.Println(res.Fallback, res.KeyPath)
+	// Output: true /keys/id_personal
+}
+
+func ExampleFromURL_pin() {
+	cfg := &config.Config{Version: 1, Pin: &config.Pin{Key: "/keys/id_legacy"}, Rules: []config.Rule{
+		{ID: "work", Host: "github.com", Owner: "CompanyOrg", Key: "/keys/id_work"},
+	}}
+	res, err := resolve.FromURL(cfg, "git@github.com:CompanyOrg/api.git")
+	if err != nil {
+		fmt.Println("error:", err)
+		return
+	}
+	fmt.Println(res.Pinned, res.MatchedRule.ID, res.KeyPath)
+	// Output: true pinned /keys/id_legacy
+}
+
+func ExampleFromURL_strict() {
+	cfg := &config.Config{Version: 1, Strict: true, Rules: []config.Rule{
+		{ID: "work", Host: "github.com", Owner: "CompanyOrg", Key: "/keys/id_work"},
+		{ID: "fallback", Host: "*", Owner: "*", Key: "/keys/id_personal"},
+	}}
+	if _, err := resolve.FromURL(cfg, "git@github.com:someone/dotfiles.git"); err != nil {
+		fmt.Println(errors.Is(err, matcher.ErrNoMatch))
+	}
+	res, _ := resolve.FromURL(cfg, "git@github.com:CompanyOrg/api.git")
+	fmt.Println(res.KeyPath)
+	// Output:
+	// true
+	// /keys/id_work
+}
+
+func ExampleFromURL_sshCommand() {
+	cfg := &config.Config{Version: 1, SSHCommand: "/usr/bin/ssh -4", Rules: []config.Rule{
+		{ID: "work", Host: "github.com", Owner: "*", Key: "/keys/id_work"},
+	}}
+	res, err := resolve.FromURL(cfg, "git@github.com:CompanyOrg/api.git")
+	if err != nil {
+		fmt.Println("error:", err)
+		return
+	}
+	fmt.Println(res.GITSSHCommand)
+	// Output: /usr/bin/ssh -4 -F /dev/null -i '/keys/id_work' -o IdentitiesOnly=yes
+}
+
+func ExampleFromURL_hostDefaults() {
+	cfg := &config.Config{Version: 1,
+		HostDefaults: []config.HostDefault{{Host: "gerrit.example.com", User: "gerrit", Port: 29418}},
+		Rules: []config.Rule{
+			{ID: "gerrit", Host: "gerrit.example.com", Owner: "*", Key: "/keys/id_gerrit"},
+		},
+	}
+	res, err := resolve.FromURL(cfg, "ssh://git@gerrit.example.com/platform/api.git")
+	if err != nil {
+		fmt.Println("error:", err)
+		return
+	}
+	fmt.Println(res.GITSSHCommand)
+	// Output: ssh -F /dev/null -i '/keys/id_gerrit' -o IdentitiesOnly=yes -o User=gerrit -o Port=29418
+}
+
+func ExampleFromURL_hostAliases() {
+	cfg := &config.Config{Version: 1,
+		HostAliases: map[string]string{"github-work": "github.com"},
+		Rules: []config.Rule{
+			{ID: "work", Host: "github.com", Owner: "CompanyOrg", Key: "/keys/id_work"},
+		},
+	}
+	res, err := resolve.FromURL(cfg, "git@github-work:CompanyOrg/api.git")
+	if err != nil {
+		fmt.Println("error:", err)
+		return
+	}
+	fmt.Println(res.MatchedRule.ID, res.Parsed.Host, res.Parsed.TargetUserHost())
+	// Output: work github.com git@github-work
+}
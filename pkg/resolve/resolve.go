@@ -0,0 +1,117 @@
+// Package resolve turns a remote URL and a config into the SSH key and
+// GIT_SSH_COMMAND mgit would use for it. It is the public view of the
+// resolver the mgit CLI runs: results are built from pkg/config and
+// pkg/giturl types only, so embedders need nothing from mgit's internals.
+package resolve
+
+import (
+	"context"
+
+	"github.com/pavelBuzdanov/mgit/internal/resolve"
+	"github.com/pavelBuzdanov/mgit/pkg/config"
+	"github.com/pavelBuzdanov/mgit/pkg/giturl"
+	"github.com/pavelBuzdanov/mgit/pkg/matcher"
+)
+
+type Result struct {
+	URL                 string               `json:"url"`
+	Parsed              *giturl.ParsedRemote `json:"parsed,omitempty"`
+	SSHSelectionApplies bool                 `json:"sshSelectionApplies"`
+	MatchedRule         *config.Rule         `json:"matchedRule,omitempty"`
+	KeyPath             string               `json:"keyPath,omitempty"`
+	GITSSHCommand       string               `json:"gitSshCommand,omitempty"`
+	MatchScore          int                  `json:"matchScore,omitempty"`
+	Fallback            bool                 `json:"fallback,omitempty"` // no rule matched; the config's defaultKey was used
+	Pinned              bool                 `json:"pinned,omitempty"`   // the config's pin was used instead of matching
+	KeyNeedsPassphrase  bool                 `json:"keyNeedsPassphrase,omitempty"`
+	KeyType             string               `json:"keyType,omitempty"`
+	SecurityKey         bool                 `json:"securityKey,omitempty"`
+	SSHOptions          []string             `json:"sshOptions,omitempty"`
+	HostDefaults        *config.HostDefault  `json:"hostDefaults,omitempty"` // merged hostDefaults entries for the remote's host
+	SSHClient           []string             `json:"sshClient,omitempty"`    // ssh executable and leading arguments; empty means plain ssh
+	KeyProvider         string               `json:"keyProvider,omitempty"`
+	GitConfig           []string             `json:"gitConfig,omitempty"` // key=value pairs passed to git as -c, e.g. HTTPS credential settings
+	Notes               []string             `json:"notes,omitempty"`
+
+	res *resolve.Result
+}
+
+// ErrKeyMissing is wrapped by the errors of MaterializeKey.
+var ErrKeyMissing = resolve.ErrKeyMissing
+
+// FromURL resolves rawURL against cfg. Non-SSH remotes resolve without a
+// config and with SSHSelectionApplies false; SSH remotes need a matching rule
+// or the config's defaultKey, in which case Fallback is set.
+func FromURL(cfg *config.Config, rawURL string) (*Result, error) {
+	return FromRemote(cfg, "", rawURL)
+}
+
+// FromRemote is FromURL for a URL read from the git remote named remote, so
+// rules conditioned on the remote name can match. An empty remote is a plain
+// URL.
+func FromRemote(cfg *config.Config, remote, rawURL string) (*Result, error) {
+	res, err := resolve.FromRemote(cfg, remote, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return fromInternal(res), nil
+}
+
+func fromInternal(res *resolve.Result) *Result {
+	return &Result{
+		URL:                 res.URL,
+		Parsed:              res.Parsed,
+		SSHSelectionApplies: res.SSHSelectionApplies,
+		MatchedRule:         res.MatchedRule,
+		KeyPath:             res.KeyPath,
+		GITSSHCommand:       res.GITSSHCommand,
+		MatchScore:          res.MatchScore,
+		Fallback:            res.Fallback,
+		Pinned:              res.Pinned,
+		KeyNeedsPassphrase:  res.KeyNeedsPassphrase,
+		KeyType:             res.KeyType,
+		SecurityKey:         res.SecurityKey,
+		SSHOptions:          res.SSHOptions,
+		HostDefaults:        res.HostDefaults,
+		SSHClient:           res.SSHClient,
+		KeyProvider:         res.KeyProvider,
+		GitConfig:           res.GitConfig,
+		Notes:               res.Notes,
+		res:                 res,
+	}
+}
+
+// MaterializeKey fetches a provider-backed key into a temp file and points
+// KeyPath and GITSSHCommand at it. The returned cleanup is always non-nil.
+func (r *Result) MaterializeKey(ctx context.Context) (func(), error) {
+	if r.res == nil || r.KeyProvider == "" {
+		return func() {}, nil
+	}
+	cleanup, err := r.res.MaterializeKey(ctx)
+	r.KeyPath, r.GITSSHCommand = r.res.KeyPath, r.res.GITSSHCommand
+	return cleanup, err
+}
+
+// Candidates explains how every rule in cfg fared for rawURL, read from the
+// git remote named remote, including rules skipped because they have nothing
+// for its transport: no key or agent for SSH, no HTTPS settings for HTTPS.
+func Candidates(cfg *config.Config, remote, rawURL string) ([]matcher.Candidate, error) {
+	return resolve.Candidates(cfg, remote, rawURL)
+}
+
+// ParseRemote parses rawURL, read from the git remote named remote, and maps
+// a host alias from cfg to its canonical host.
+func ParseRemote(cfg *config.Config, remote, rawURL string) (*giturl.ParsedRemote, error) {
+	return resolve.ParseRemote(cfg, remote, rawURL)
+}
+
+// RuleForURL finds the rule for rawURL regardless of transport, since commit
+// signing and identity checks apply to HTTPS remotes as well.
+func RuleForURL(cfg *config.Config, rawURL string) (*config.Rule, error) {
+	return resolve.RuleForURL(cfg, rawURL)
+}
+
+// RuleForRemote is RuleForURL for a URL read from the git remote named remote.
+func RuleForRemote(cfg *config.Config, remote, rawURL string) (*config.Rule, error) {
+	return resolve.RuleForRemote(cfg, remote, rawURL)
+}
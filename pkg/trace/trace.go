@@ -0,0 +1,63 @@
+// Package trace records debug events (config resolution, URL parsing, rule
+// scoring, env construction, subprocesses) when enabled with --log-file or
+// MGIT_DEBUG. It is a no-op otherwise. Programs embedding the pkg/ packages
+// can call Enable to receive the same events from giturl, matcher and
+// resolve.
+package trace
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+var logger atomic.Pointer[slog.Logger]
+
+const (
+	FormatJSON = "json"
+	FormatText = "text" // key=value
+)
+
+// Enable sends trace events to w in the given format.
+func Enable(w io.Writer, format string) {
+	hopts := &slog.HandlerOptions{Level: slog.LevelDebug}
+	var h slog.Handler
+	if format == FormatJSON {
+		h = slog.NewJSONHandler(w, hopts)
+	} else {
+		h = slog.NewTextHandler(w, hopts)
+	}
+	logger.Store(slog.New(h))
+}
+
+// Disable stops tracing.
+func Disable() {
+	logger.Store(nil)
+}
+
+func Enabled() bool {
+	return logger.Load() != nil
+}
+
+// Event records a single trace entry; args are slog key/value pairs.
+func Event(msg string, args ...any) {
+	if l := logger.Load(); l != nil {
+		l.Log(context.Background(), slog.LevelDebug, msg, args...)
+	}
+}
+
+// Start begins a timed event. The returned func records msg with the start
+// args, any extra args and duration_ms.
+func Start(msg string, args ...any) func(extra ...any) {
+	if !Enabled() {
+		return func(...any) {}
+	}
+	start := time.Now()
+	return func(extra ...any) {
+		all := append(append([]any{}, args...), extra...)
+		all = append(all, "duration_ms", float64(time.Since(start).Microseconds())/1000)
+		Event(msg, all...)
+	}
+}
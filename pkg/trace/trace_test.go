@@ -0,0 +1,48 @@
+package trace
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestDisabledIsNoop(t *testing.T) {
+	Disable()
+	Event("ignored", "k", "v")
+	Start("ignored")()
+	if Enabled() {
+		t.Fatalf("Enabled() = true after Disable()")
+	}
+}
+
+func TestJSONEventWithDuration(t *testing.T) {
+	var buf bytes.Buffer
+	Enable(&buf, FormatJSON)
+	defer Disable()
+
+	done := Start("exec", "cmd", "git")
+	done("exit", 0)
+
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("trace output is not JSON: %v (%q)", err, buf.String())
+	}
+	if entry["msg"] != "exec" || entry["cmd"] != "git" || entry["exit"] != float64(0) {
+		t.Fatalf("unexpected entry: %v", entry)
+	}
+	if _, ok := entry["duration_ms"]; !ok {
+		t.Fatalf("entry has no duration_ms: %v", entry)
+	}
+}
+
+func TestTextFormat(t *testing.T) {
+	var buf bytes.Buffer
+	Enable(&buf, FormatText)
+	defer Disable()
+
+	Event("config.resolve", "path", "/repo/.mgit/config.json")
+	if got := buf.String(); !strings.Contains(got, "msg=config.resolve") || !strings.Contains(got, "path=/repo/.mgit/config.json") {
+		t.Fatalf("unexpected text trace: %q", got)
+	}
+}